@@ -1,7 +1,7 @@
 -- +goose Up
 -- +goose StatementBegin
 ALTER TABLE workouts
-ADD COLUMN user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE AFTER
+ADD COLUMN user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE;
 -- +goose StatementEnd
 
 -- +goose Down
@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+-- workout_id has no foreign key: the history of a workout outlives it
+CREATE TABLE IF NOT EXISTS workout_revisions (
+    workout_id INTEGER NOT NULL,
+    revision INTEGER NOT NULL,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    actor_id INTEGER NOT NULL,
+    action VARCHAR(20) NOT NULL,
+    snapshot JSONB NOT NULL,
+    diff JSONB DEFAULT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (workout_id, revision)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE workout_revisions;
+-- +goose StatementEnd
@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE workouts
+ADD COLUMN deleted_at TIMESTAMP WITH TIME ZONE DEFAULT NULL;
+
+CREATE INDEX workouts_trash_idx ON workouts (user_id, deleted_at) WHERE deleted_at IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX workouts_trash_idx;
+
+ALTER TABLE workouts
+DROP COLUMN deleted_at;
+-- +goose StatementEnd
@@ -0,0 +1,34 @@
+-- +goose Up
+-- +goose StatementBegin
+-- user_id is NULL for the catalog, and set for the custom exercises of a user
+CREATE TABLE IF NOT EXISTS exercises (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER DEFAULT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    aliases TEXT[] NOT NULL DEFAULT '{}',
+    primary_muscles TEXT[] NOT NULL DEFAULT '{}',
+    secondary_muscles TEXT[] NOT NULL DEFAULT '{}',
+    equipment VARCHAR(50) NOT NULL,
+    movement_type VARCHAR(50) NOT NULL,
+    tracking VARCHAR(10) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT tracking_in_reps_or_time CHECK (tracking IN ('reps', 'time'))
+);
+
+CREATE UNIQUE INDEX exercises_catalog_name_idx ON exercises (lower(name)) WHERE user_id IS NULL;
+CREATE UNIQUE INDEX exercises_custom_name_idx ON exercises (user_id, lower(name)) WHERE user_id IS NOT NULL;
+
+ALTER TABLE workout_exercises
+ADD COLUMN exercise_id INTEGER DEFAULT NULL REFERENCES exercises(id) ON DELETE SET NULL;
+
+CREATE INDEX workout_exercises_exercise_id_idx ON workout_exercises (exercise_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE workout_exercises
+DROP COLUMN exercise_id;
+
+DROP TABLE exercises;
+-- +goose StatementEnd
@@ -0,0 +1,62 @@
+-- +goose Up
+-- +goose StatementBegin
+-- the search document of a workout: its name, then its description and the
+-- names of its exercises, then the notes of its exercises
+CREATE FUNCTION workout_search_vector(workout_id INTEGER, name TEXT, description TEXT) RETURNS tsvector AS $$
+    SELECT setweight(to_tsvector('english', coalesce($2, '')), 'A')
+        || setweight(to_tsvector('english', coalesce($3, '')), 'B')
+        || setweight(to_tsvector('english', coalesce(string_agg(we.name, ' '), '')), 'B')
+        || setweight(to_tsvector('english', coalesce(string_agg(we.notes, ' '), '')), 'C')
+    FROM workout_exercises we
+    WHERE we.workout_id = $1
+$$ LANGUAGE sql STABLE;
+
+ALTER TABLE workouts
+ADD COLUMN search_vector tsvector NOT NULL DEFAULT '';
+
+UPDATE workouts SET search_vector = workout_search_vector(id, name, description);
+
+CREATE INDEX workouts_search_vector_idx ON workouts USING GIN (search_vector);
+
+CREATE FUNCTION workouts_update_search_vector() RETURNS trigger AS $$
+BEGIN
+    NEW.search_vector := workout_search_vector(NEW.id, NEW.name, NEW.description);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER workouts_search_vector_trigger
+BEFORE INSERT OR UPDATE OF name, description ON workouts
+FOR EACH ROW EXECUTE FUNCTION workouts_update_search_vector();
+
+-- when the exercises are deleted along with their workout, there is no workout
+-- left to update
+CREATE FUNCTION workout_exercises_update_search_vector() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP IN ('UPDATE', 'DELETE') THEN
+        UPDATE workouts SET search_vector = workout_search_vector(id, name, description) WHERE id = OLD.workout_id;
+    END IF;
+    IF TG_OP IN ('INSERT', 'UPDATE') AND (TG_OP = 'INSERT' OR NEW.workout_id <> OLD.workout_id) THEN
+        UPDATE workouts SET search_vector = workout_search_vector(id, name, description) WHERE id = NEW.workout_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER workout_exercises_search_vector_trigger
+AFTER INSERT OR UPDATE OF workout_id, name, notes OR DELETE ON workout_exercises
+FOR EACH ROW EXECUTE FUNCTION workout_exercises_update_search_vector();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER workout_exercises_search_vector_trigger ON workout_exercises;
+DROP FUNCTION workout_exercises_update_search_vector();
+DROP TRIGGER workouts_search_vector_trigger ON workouts;
+DROP FUNCTION workouts_update_search_vector();
+
+ALTER TABLE workouts
+DROP COLUMN search_vector;
+
+DROP FUNCTION workout_search_vector(INTEGER, TEXT, TEXT);
+-- +goose StatementEnd
@@ -0,0 +1,52 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS workout_templates (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    duration_minutes INTEGER NOT NULL,
+    calories_burned INTEGER DEFAULT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX workout_templates_user_id_idx ON workout_templates (user_id);
+
+-- the exercises of a template have the columns of workout_exercises
+CREATE TABLE IF NOT EXISTS workout_template_exercises (
+    id SERIAL PRIMARY KEY,
+    template_id INTEGER NOT NULL REFERENCES workout_templates(id) ON DELETE CASCADE,
+    exercise_id INTEGER DEFAULT NULL REFERENCES exercises(id) ON DELETE SET NULL,
+    name VARCHAR(100) NOT NULL,
+    sets SMALLINT NOT NULL,
+    reps SMALLINT DEFAULT NULL,
+    duration_seconds SMALLINT DEFAULT NULL,
+    weight DECIMAL(5,2) DEFAULT NULL,
+    notes TEXT DEFAULT NULL,
+    order_index SMALLINT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT no_reps_and_duration_together CHECK (
+        (reps IS NOT NULL OR duration_seconds IS NOT NULL) AND (reps IS NULL OR duration_seconds IS NULL)
+    )
+);
+
+CREATE INDEX workout_template_exercises_template_id_idx ON workout_template_exercises (template_id);
+CREATE INDEX workout_template_exercises_exercise_id_idx ON workout_template_exercises (exercise_id);
+
+-- the template a workout was started from, if any
+ALTER TABLE workouts
+ADD COLUMN template_id INTEGER DEFAULT NULL REFERENCES workout_templates(id) ON DELETE SET NULL;
+
+CREATE INDEX workouts_template_id_idx ON workouts (template_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE workouts
+DROP COLUMN template_id;
+
+DROP TABLE workout_template_exercises;
+DROP TABLE workout_templates;
+-- +goose StatementEnd
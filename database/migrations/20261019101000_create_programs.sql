@@ -0,0 +1,55 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS programs (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    weeks SMALLINT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- a day of a program is a session of a template, on a day (1 to 7) of a week.
+-- A template cannot be deleted while a program uses it.
+CREATE TABLE IF NOT EXISTS program_days (
+    id SERIAL PRIMARY KEY,
+    program_id INTEGER NOT NULL REFERENCES programs(id) ON DELETE CASCADE,
+    week SMALLINT NOT NULL,
+    day SMALLINT NOT NULL,
+    template_id INTEGER NOT NULL REFERENCES workout_templates(id),
+    CONSTRAINT day_of_week CHECK (day BETWEEN 1 AND 7),
+    CONSTRAINT program_days_program_id_week_day_key UNIQUE (program_id, week, day)
+);
+
+CREATE INDEX program_days_template_id_idx ON program_days (template_id);
+
+CREATE TABLE IF NOT EXISTS enrollments (
+    id SERIAL PRIMARY KEY,
+    program_id INTEGER NOT NULL REFERENCES programs(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    start_date DATE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX enrollments_program_id_idx ON enrollments (program_id);
+CREATE INDEX enrollments_user_id_idx ON enrollments (user_id);
+
+-- the workouts that completed the planned sessions of an enrollment
+CREATE TABLE IF NOT EXISTS enrollment_sessions (
+    enrollment_id INTEGER NOT NULL REFERENCES enrollments(id) ON DELETE CASCADE,
+    program_day_id INTEGER NOT NULL REFERENCES program_days(id) ON DELETE CASCADE,
+    workout_id INTEGER NOT NULL UNIQUE REFERENCES workouts(id) ON DELETE CASCADE,
+    PRIMARY KEY (enrollment_id, program_day_id)
+);
+
+CREATE INDEX enrollment_sessions_program_day_id_idx ON enrollment_sessions (program_day_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE enrollment_sessions;
+DROP TABLE enrollments;
+DROP TABLE program_days;
+DROP TABLE programs;
+-- +goose StatementEnd
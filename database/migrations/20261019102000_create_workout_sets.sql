@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+-- the sets of the workout exercises logged set by set, numbered from 1. The
+-- aggregate columns of workout_exercises are derived from them.
+CREATE TABLE IF NOT EXISTS workout_sets (
+    workout_exercise_id INTEGER NOT NULL REFERENCES workout_exercises(id) ON DELETE CASCADE,
+    set_number SMALLINT NOT NULL,
+    set_type VARCHAR(10) NOT NULL DEFAULT 'working',
+    reps SMALLINT DEFAULT NULL,
+    weight DECIMAL(5,2) DEFAULT NULL,
+    duration_seconds SMALLINT DEFAULT NULL,
+    distance_meters DECIMAL(8,2) DEFAULT NULL,
+    rpe DECIMAL(3,1) DEFAULT NULL,
+    rir SMALLINT DEFAULT NULL,
+    rest_seconds SMALLINT DEFAULT NULL,
+    completed BOOLEAN NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (workout_exercise_id, set_number),
+    CONSTRAINT set_type_known CHECK (set_type IN ('warmup', 'working', 'drop', 'failure')),
+    CONSTRAINT no_set_reps_and_duration_together CHECK (
+        (reps IS NOT NULL OR duration_seconds IS NOT NULL) AND (reps IS NULL OR duration_seconds IS NULL)
+    ),
+    CONSTRAINT rpe_between_1_and_10 CHECK (rpe BETWEEN 1 AND 10)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE workout_sets;
+-- +goose StatementEnd
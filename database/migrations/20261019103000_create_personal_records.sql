@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+-- the personal records of the users, each kept with the workout that set it,
+-- so that they make up the history of the records. Weight is the weight of
+-- the most reps records, which are kept per weight.
+CREATE TABLE IF NOT EXISTS personal_records (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    workout_id INTEGER NOT NULL REFERENCES workouts(id) ON DELETE CASCADE,
+    exercise_id INTEGER REFERENCES exercises(id) ON DELETE SET NULL,
+    exercise_name VARCHAR(100) NOT NULL,
+    record_type VARCHAR(20) NOT NULL,
+    weight DECIMAL(5,2) DEFAULT NULL,
+    value DECIMAL(10,2) NOT NULL,
+    previous_value DECIMAL(10,2) DEFAULT NULL,
+    achieved_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT record_type_known CHECK (
+        record_type IN ('max_weight', 'max_reps', 'estimated_1rm', 'max_duration', 'max_volume')
+    )
+);
+
+CREATE INDEX personal_records_user_id_idx ON personal_records (user_id);
+CREATE INDEX personal_records_workout_id_idx ON personal_records (workout_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE personal_records;
+-- +goose StatementEnd
@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+-- the body weight of a user is what calories are estimated from, and
+-- calories_estimated tells the calories of a workout were estimated rather
+-- than measured
+ALTER TABLE users
+ADD COLUMN body_weight_kg DECIMAL(5,2) DEFAULT NULL,
+ADD CONSTRAINT body_weight_kg_positive CHECK (body_weight_kg > 0);
+
+ALTER TABLE workouts
+ADD COLUMN calories_estimated BOOLEAN NOT NULL DEFAULT FALSE;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE workouts
+DROP COLUMN calories_estimated;
+
+ALTER TABLE users
+DROP COLUMN body_weight_kg;
+-- +goose StatementEnd
@@ -0,0 +1,39 @@
+-- +goose Up
+-- +goose StatementBegin
+-- the body measurements of the users, in kilograms and centimeters whatever
+-- the unit they were entered in. Every value is optional, but a measurement
+-- has at least one.
+CREATE TABLE IF NOT EXISTS body_measurements (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    measured_on DATE NOT NULL,
+    weight_kg DECIMAL(5,2) DEFAULT NULL,
+    body_fat_percent DECIMAL(4,1) DEFAULT NULL,
+    neck_cm DECIMAL(5,1) DEFAULT NULL,
+    chest_cm DECIMAL(5,1) DEFAULT NULL,
+    waist_cm DECIMAL(5,1) DEFAULT NULL,
+    hips_cm DECIMAL(5,1) DEFAULT NULL,
+    arm_cm DECIMAL(5,1) DEFAULT NULL,
+    thigh_cm DECIMAL(5,1) DEFAULT NULL,
+    calf_cm DECIMAL(5,1) DEFAULT NULL,
+    notes TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT weight_kg_positive CHECK (weight_kg > 0),
+    CONSTRAINT body_fat_percent_range CHECK (body_fat_percent > 0 AND body_fat_percent < 100),
+    CONSTRAINT circumferences_positive CHECK (
+        neck_cm > 0 AND chest_cm > 0 AND waist_cm > 0 AND hips_cm > 0 AND
+        arm_cm > 0 AND thigh_cm > 0 AND calf_cm > 0
+    ),
+    CONSTRAINT measurement_not_empty CHECK (
+        num_nonnulls(weight_kg, body_fat_percent, neck_cm, chest_cm, waist_cm, hips_cm, arm_cm, thigh_cm, calf_cm) > 0
+    )
+);
+
+CREATE INDEX body_measurements_user_id_measured_on_idx ON body_measurements (user_id, measured_on);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE body_measurements;
+-- +goose StatementEnd
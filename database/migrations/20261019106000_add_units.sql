@@ -0,0 +1,45 @@
+-- +goose Up
+-- +goose StatementBegin
+-- weights are kept in kilograms, with the precision of a conversion from
+-- pounds and room for heavy loads. Users pick the unit system they read.
+ALTER TABLE workout_exercises ALTER COLUMN weight TYPE DECIMAL(8,3);
+ALTER TABLE workout_sets ALTER COLUMN weight TYPE DECIMAL(8,3);
+ALTER TABLE workout_template_exercises ALTER COLUMN weight TYPE DECIMAL(8,3);
+ALTER TABLE personal_records ALTER COLUMN weight TYPE DECIMAL(8,3);
+ALTER TABLE body_measurements ALTER COLUMN weight_kg TYPE DECIMAL(6,3);
+
+ALTER TABLE users
+ADD COLUMN unit_system VARCHAR(10) NOT NULL DEFAULT 'metric',
+ADD CONSTRAINT unit_system_known CHECK (unit_system IN ('metric', 'imperial')),
+-- the weights recorded before units were in the unit the user had in mind,
+-- so the users who recorded some tell which one, and those in pounds get
+-- them converted, see UserStore.ResolveLegacyWeights
+ADD COLUMN legacy_weights_before TIMESTAMP WITH TIME ZONE DEFAULT NULL;
+
+UPDATE users u
+SET legacy_weights_before = CURRENT_TIMESTAMP
+WHERE EXISTS (
+    SELECT 1
+    FROM workouts w
+    JOIN workout_exercises we ON we.workout_id = w.id
+    WHERE w.user_id = u.id AND we.weight IS NOT NULL
+) OR EXISTS (
+    SELECT 1
+    FROM workout_templates t
+    JOIN workout_template_exercises te ON te.template_id = t.id
+    WHERE t.user_id = u.id AND te.weight IS NOT NULL
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users
+DROP COLUMN legacy_weights_before,
+DROP COLUMN unit_system;
+
+ALTER TABLE body_measurements ALTER COLUMN weight_kg TYPE DECIMAL(5,2);
+ALTER TABLE personal_records ALTER COLUMN weight TYPE DECIMAL(5,2);
+ALTER TABLE workout_template_exercises ALTER COLUMN weight TYPE DECIMAL(5,2);
+ALTER TABLE workout_sets ALTER COLUMN weight TYPE DECIMAL(5,2);
+ALTER TABLE workout_exercises ALTER COLUMN weight TYPE DECIMAL(5,2);
+-- +goose StatementEnd
@@ -0,0 +1,39 @@
+-- +goose Up
+-- +goose StatementBegin
+-- the goals the users set themselves. current_value and achieved_at are kept
+-- up to date as workouts and body measurements are recorded, weights are in
+-- kilograms and frequency targets in workouts per week.
+CREATE TABLE IF NOT EXISTS goals (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    kind VARCHAR(20) NOT NULL,
+    exercise_id INTEGER DEFAULT NULL REFERENCES exercises(id) ON DELETE SET NULL,
+    exercise_name VARCHAR(255) NOT NULL DEFAULT '',
+    weight DECIMAL(8,3) DEFAULT NULL,
+    target DECIMAL(10,3) NOT NULL,
+    start_value DECIMAL(8,3) DEFAULT NULL,
+    starts_on DATE NOT NULL DEFAULT CURRENT_DATE,
+    deadline DATE DEFAULT NULL,
+    current_value DECIMAL(12,3) NOT NULL DEFAULT 0,
+    achieved_at TIMESTAMP WITH TIME ZONE DEFAULT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT goal_kind_known CHECK (
+        kind IN ('exercise_weight', 'exercise_reps', 'frequency', 'total_duration', 'calories', 'body_weight')
+    ),
+    CONSTRAINT target_positive CHECK (target > 0),
+    CONSTRAINT deadline_after_start CHECK (deadline >= starts_on),
+    CONSTRAINT exercise_goal_named CHECK (kind NOT IN ('exercise_weight', 'exercise_reps') OR exercise_name <> ''),
+    -- a frequency is only a target over a number of weeks
+    CONSTRAINT frequency_goal_deadline CHECK (kind <> 'frequency' OR deadline IS NOT NULL),
+    -- body weight goals measure the way from the weight they started at
+    CONSTRAINT body_weight_goal_start CHECK ((kind = 'body_weight') = (start_value IS NOT NULL))
+);
+
+CREATE INDEX goals_user_id_idx ON goals (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE goals;
+-- +goose StatementEnd
@@ -0,0 +1,50 @@
+-- +goose Up
+-- +goose StatementBegin
+-- the day of a workout is the day it was created on in the time zone of its
+-- user, and a daily streak survives up to streak_rest_days days off in a row.
+ALTER TABLE users
+ADD COLUMN time_zone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+ADD COLUMN streak_rest_days INTEGER NOT NULL DEFAULT 0,
+ADD CONSTRAINT streak_rest_days_range CHECK (streak_rest_days BETWEEN 0 AND 6);
+
+-- the days the users trained on, with the workouts of each day, so that
+-- streaks are updated as days are added or removed rather than by reading
+-- every workout
+CREATE TABLE IF NOT EXISTS training_days (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    day DATE NOT NULL,
+    workouts INTEGER NOT NULL,
+    PRIMARY KEY (user_id, day),
+    CONSTRAINT workouts_positive CHECK (workouts > 0)
+);
+
+-- the streaks that end on the last training day of each user. Whether they
+-- are still going depends on the day they are read on.
+CREATE TABLE IF NOT EXISTS streaks (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    last_day DATE NOT NULL,
+    daily_run INTEGER NOT NULL,
+    daily_longest INTEGER NOT NULL,
+    weekly_run INTEGER NOT NULL,
+    weekly_longest INTEGER NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- the streaks themselves are built from the training days the first time
+-- they are read
+INSERT INTO training_days (user_id, day, workouts)
+SELECT user_id, (created_at AT TIME ZONE 'UTC')::date, count(*)
+FROM workouts
+WHERE deleted_at IS NULL
+GROUP BY 1, 2;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE streaks;
+DROP TABLE training_days;
+
+ALTER TABLE users
+DROP COLUMN streak_rest_days,
+DROP COLUMN time_zone;
+-- +goose StatementEnd
@@ -0,0 +1,37 @@
+-- +goose Up
+-- +goose StatementBegin
+-- a workout is performed from started_at to ended_at, which may be long before
+-- it is created. The workouts logged so far started when they were created.
+ALTER TABLE workouts
+ADD COLUMN started_at TIMESTAMP WITH TIME ZONE,
+ADD COLUMN ended_at TIMESTAMP WITH TIME ZONE;
+
+UPDATE workouts SET started_at = created_at;
+
+ALTER TABLE workouts
+ALTER COLUMN started_at SET NOT NULL,
+ALTER COLUMN started_at SET DEFAULT CURRENT_TIMESTAMP,
+ADD CONSTRAINT ended_after_started CHECK (ended_at >= started_at);
+
+CREATE INDEX workouts_started_at_idx ON workouts (user_id, started_at) WHERE deleted_at IS NULL;
+
+-- the training days are the days the workouts were performed on
+DELETE FROM training_days;
+INSERT INTO training_days (user_id, day, workouts)
+SELECT w.user_id, (w.started_at AT TIME ZONE u.time_zone)::date, count(*)
+FROM workouts w
+JOIN users u ON u.id = w.user_id
+WHERE w.deleted_at IS NULL
+GROUP BY 1, 2;
+DELETE FROM streaks;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX workouts_started_at_idx;
+
+ALTER TABLE workouts
+DROP CONSTRAINT ended_after_started,
+DROP COLUMN ended_at,
+DROP COLUMN started_at;
+-- +goose StatementEnd
@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+-- the exports of the data of users that were too large to be streamed, which
+-- are built in the background. The archive of a ready export is a file kept
+-- until expires_at.
+CREATE TABLE IF NOT EXISTS exports (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status VARCHAR(16) NOT NULL DEFAULT 'pending',
+    size_bytes BIGINT DEFAULT NULL,
+    error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMP WITH TIME ZONE DEFAULT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE DEFAULT NULL,
+    CONSTRAINT export_status CHECK (status IN ('pending', 'ready', 'failed'))
+);
+
+CREATE INDEX exports_expires_at_idx ON exports (expires_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE exports;
+-- +goose StatementEnd
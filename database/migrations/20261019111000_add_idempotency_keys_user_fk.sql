@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+-- the responses stored so far for requests made without authentication may
+-- hold bearer tokens, and those of deleted users outlived them
+DELETE FROM idempotency_keys
+WHERE user_id = 0 OR NOT EXISTS (SELECT 1 FROM users WHERE users.id = idempotency_keys.user_id);
+
+-- user_id is now NULL for requests made without authentication
+ALTER TABLE idempotency_keys DROP CONSTRAINT idempotency_keys_pkey;
+ALTER TABLE idempotency_keys ALTER COLUMN user_id DROP NOT NULL;
+ALTER TABLE idempotency_keys
+    ADD CONSTRAINT idempotency_keys_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    ADD CONSTRAINT idempotency_keys_user_id_key_key UNIQUE NULLS NOT DISTINCT (user_id, key);
+
+CREATE INDEX idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX idempotency_keys_expires_at_idx;
+
+ALTER TABLE idempotency_keys
+    DROP CONSTRAINT idempotency_keys_user_id_key_key,
+    DROP CONSTRAINT idempotency_keys_user_id_fkey;
+UPDATE idempotency_keys SET user_id = 0 WHERE user_id IS NULL;
+ALTER TABLE idempotency_keys ALTER COLUMN user_id SET NOT NULL;
+ALTER TABLE idempotency_keys ADD PRIMARY KEY (user_id, key);
+-- +goose StatementEnd
@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+-- a record is achieved when its workout started, not when it was detected
+UPDATE personal_records pr
+SET achieved_at = w.started_at
+FROM workouts w
+WHERE w.id = pr.workout_id;
+
+ALTER TABLE personal_records
+    ALTER COLUMN achieved_at DROP DEFAULT,
+    ALTER COLUMN achieved_at SET NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE personal_records
+    ALTER COLUMN achieved_at DROP NOT NULL,
+    ALTER COLUMN achieved_at SET DEFAULT CURRENT_TIMESTAMP;
+-- +goose StatementEnd
@@ -0,0 +1,47 @@
+-- +goose Up
+-- +goose StatementBegin
+-- the weights recorded before weights had units are flagged row by row, so
+-- that resolving them converts the rows still holding them and only those.
+-- The flag of a workout exercise covers the weights of its sets, and a
+-- revision lists the exercises of its snapshot that held legacy weights.
+ALTER TABLE workout_exercises ADD COLUMN legacy_weight BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE workout_template_exercises ADD COLUMN legacy_weight BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE workout_revisions ADD COLUMN legacy_exercise_ids INTEGER[] NOT NULL DEFAULT '{}';
+
+-- the weights of a workout exercise last changed before units are legacy
+UPDATE workout_exercises we
+SET legacy_weight = TRUE
+FROM workouts w
+JOIN users u ON u.id = w.user_id
+WHERE w.id = we.workout_id AND we.updated_at < u.legacy_weights_before AND (
+    we.weight IS NOT NULL OR EXISTS (
+        SELECT 1 FROM workout_sets ws WHERE ws.workout_exercise_id = we.id AND ws.weight IS NOT NULL
+    )
+);
+
+-- template exercises are rewritten with their template
+UPDATE workout_template_exercises te
+SET legacy_weight = TRUE
+FROM workout_templates t
+JOIN users u ON u.id = t.user_id
+WHERE t.id = te.template_id AND te.created_at < u.legacy_weights_before AND te.weight IS NOT NULL;
+
+UPDATE workout_revisions r
+SET legacy_exercise_ids = ARRAY(
+    SELECT (e.exercise->>'id')::int
+    FROM jsonb_array_elements(
+        CASE jsonb_typeof(r.snapshot->'exercises') WHEN 'array' THEN r.snapshot->'exercises' ELSE '[]' END
+    ) AS e(exercise)
+    WHERE r.created_at < u.legacy_weights_before
+        OR (e.exercise->>'updated_at')::timestamptz < u.legacy_weights_before
+)
+FROM users u
+WHERE u.id = r.user_id AND u.legacy_weights_before IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE workout_revisions DROP COLUMN legacy_exercise_ids;
+ALTER TABLE workout_template_exercises DROP COLUMN legacy_weight;
+ALTER TABLE workout_exercises DROP COLUMN legacy_weight;
+-- +goose StatementEnd
@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+-- the latest exports of a user are looked up to reuse one still current
+CREATE INDEX exports_user_id_created_at_idx ON exports (user_id, created_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX exports_user_id_created_at_idx;
+-- +goose StatementEnd
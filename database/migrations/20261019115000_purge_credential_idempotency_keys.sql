@@ -0,0 +1,9 @@
+-- +goose Up
+-- +goose StatementBegin
+-- the fingerprints of the requests made without authentication, which create
+-- users and tokens, were hashes of bodies holding a password
+DELETE FROM idempotency_keys WHERE user_id IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- the deleted keys expired within a day anyway, and are not restored
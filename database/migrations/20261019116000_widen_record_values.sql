@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+-- the volume of an exercise goes up to 32767 sets of 32767 reps of 99999.999
+-- kg, and the totals of the workouts of a goal add up durations of up to
+-- 2^31 minutes, past what the values could hold
+ALTER TABLE personal_records
+    ALTER COLUMN value TYPE NUMERIC(18,2),
+    ALTER COLUMN previous_value TYPE NUMERIC(18,2);
+ALTER TABLE goals ALTER COLUMN current_value TYPE NUMERIC(18,3);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE goals ALTER COLUMN current_value TYPE DECIMAL(12,3);
+ALTER TABLE personal_records
+    ALTER COLUMN previous_value TYPE DECIMAL(10,2),
+    ALTER COLUMN value TYPE DECIMAL(10,2);
+-- +goose StatementEnd
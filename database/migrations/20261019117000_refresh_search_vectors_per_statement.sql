@@ -0,0 +1,70 @@
+-- +goose Up
+-- +goose StatementBegin
+-- the search document of a workout is refreshed once per statement writing
+-- its exercises, rather than once per exercise. Transition tables cannot be
+-- declared for more than one event, hence a trigger per event.
+DROP TRIGGER workout_exercises_search_vector_trigger ON workout_exercises;
+DROP FUNCTION workout_exercises_update_search_vector();
+
+-- when the exercises are deleted along with their workout, there is no workout
+-- left to update
+CREATE FUNCTION workout_exercises_update_search_vectors() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        UPDATE workouts SET search_vector = workout_search_vector(id, name, description)
+        WHERE id IN (SELECT workout_id FROM new_exercises);
+    ELSIF TG_OP = 'DELETE' THEN
+        UPDATE workouts SET search_vector = workout_search_vector(id, name, description)
+        WHERE id IN (SELECT workout_id FROM old_exercises);
+    ELSE
+        UPDATE workouts SET search_vector = workout_search_vector(id, name, description)
+        WHERE id IN (
+            SELECT unnest(ARRAY[o.workout_id, n.workout_id])
+            FROM old_exercises o
+            JOIN new_exercises n ON n.id = o.id
+            WHERE (n.workout_id, n.name, n.notes) IS DISTINCT FROM (o.workout_id, o.name, o.notes)
+        );
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER workout_exercises_insert_search_vector_trigger
+AFTER INSERT ON workout_exercises
+REFERENCING NEW TABLE AS new_exercises
+FOR EACH STATEMENT EXECUTE FUNCTION workout_exercises_update_search_vectors();
+
+CREATE TRIGGER workout_exercises_update_search_vector_trigger
+AFTER UPDATE ON workout_exercises
+REFERENCING OLD TABLE AS old_exercises NEW TABLE AS new_exercises
+FOR EACH STATEMENT EXECUTE FUNCTION workout_exercises_update_search_vectors();
+
+CREATE TRIGGER workout_exercises_delete_search_vector_trigger
+AFTER DELETE ON workout_exercises
+REFERENCING OLD TABLE AS old_exercises
+FOR EACH STATEMENT EXECUTE FUNCTION workout_exercises_update_search_vectors();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER workout_exercises_delete_search_vector_trigger ON workout_exercises;
+DROP TRIGGER workout_exercises_update_search_vector_trigger ON workout_exercises;
+DROP TRIGGER workout_exercises_insert_search_vector_trigger ON workout_exercises;
+DROP FUNCTION workout_exercises_update_search_vectors();
+
+CREATE FUNCTION workout_exercises_update_search_vector() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP IN ('UPDATE', 'DELETE') THEN
+        UPDATE workouts SET search_vector = workout_search_vector(id, name, description) WHERE id = OLD.workout_id;
+    END IF;
+    IF TG_OP IN ('INSERT', 'UPDATE') AND (TG_OP = 'INSERT' OR NEW.workout_id <> OLD.workout_id) THEN
+        UPDATE workouts SET search_vector = workout_search_vector(id, name, description) WHERE id = NEW.workout_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER workout_exercises_search_vector_trigger
+AFTER INSERT OR UPDATE OF workout_id, name, notes OR DELETE ON workout_exercises
+FOR EACH ROW EXECUTE FUNCTION workout_exercises_update_search_vector();
+-- +goose StatementEnd
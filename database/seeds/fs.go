@@ -0,0 +1,6 @@
+package seeds
+
+import "embed"
+
+//go:embed *.json
+var FS embed.FS
@@ -0,0 +1,356 @@
+package api
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"fem-go-crud/internal/auth"
+	"fem-go-crud/internal/middleware"
+	"fem-go-crud/internal/store"
+	"fem-go-crud/internal/utils"
+	"github.com/go-chi/chi/v5"
+)
+
+// maxCalendarDays is the longest window, in days, of a calendar request.
+const maxCalendarDays = 366
+
+// calendarFeedMonths is how far back the workouts of a calendar feed go.
+const calendarFeedMonths = 12
+
+// BaseURL returns the URL the API is served at, which the links it hands out
+// start with: BASE_URL, or http://localhost:8080 if it is empty.
+func BaseURL() string {
+	return strings.TrimSuffix(cmp.Or(os.Getenv("BASE_URL"), "http://localhost:8080"), "/")
+}
+
+type CalendarHandler struct {
+	workoutStore    store.WorkoutStore
+	enrollmentStore store.EnrollmentStore
+	programStore    store.ProgramStore
+	userStore       store.UserStore
+	txManager       store.TxManager
+	baseURL         string
+	logger          *log.Logger
+}
+
+func NewCalendarHandler(ws store.WorkoutStore, es store.EnrollmentStore, ps store.ProgramStore, us store.UserStore, tm store.TxManager, baseURL string, l *log.Logger) *CalendarHandler {
+	return &CalendarHandler{
+		workoutStore:    ws,
+		enrollmentStore: es,
+		programStore:    ps,
+		userStore:       us,
+		txManager:       tm,
+		baseURL:         baseURL,
+		logger:          l,
+	}
+}
+
+// Calendar lists every day from From to To, included, in the time zone of
+// the user.
+type Calendar struct {
+	From     string        `json:"from"`
+	To       string        `json:"to"`
+	TimeZone string        `json:"time_zone"`
+	Days     []CalendarDay `json:"days"`
+}
+
+// CalendarDay holds the workouts started on a day and the sessions of the
+// programs the user is enrolled in planned on it.
+type CalendarDay struct {
+	Date     string            `json:"date"`
+	Workouts []store.Workout   `json:"workouts"`
+	Sessions []CalendarSession `json:"sessions"`
+}
+
+type CalendarSession struct {
+	EnrollmentID int    `json:"enrollment_id"`
+	ProgramID    int    `json:"program_id"`
+	ProgramName  string `json:"program_name"`
+	PlannedSession
+}
+
+// CalendarFeed is the URL of the iCalendar feed of a user, which is only
+// known when it is created.
+type CalendarFeed struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// GetCalendar returns the workouts and planned sessions of the current user
+// from from to to, the current month by default.
+func (ch *CalendarHandler) GetCalendar(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	location := store.Location(user.TimeZone)
+	now := time.Now().In(location)
+
+	from, to, err := parseCalendarWindow(r, now)
+	if err != nil {
+		ch.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	calendar := Calendar{
+		From:     from.Format(time.DateOnly),
+		To:       to.Format(time.DateOnly),
+		TimeZone: location.String(),
+		Days:     []CalendarDay{},
+	}
+	days := make(map[string]*CalendarDay)
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		calendar.Days = append(calendar.Days, CalendarDay{
+			Date:     day.Format(time.DateOnly),
+			Workouts: []store.Workout{},
+			Sessions: []CalendarSession{},
+		})
+	}
+	for i := range calendar.Days {
+		days[calendar.Days[i].Date] = &calendar.Days[i]
+	}
+
+	workouts, err := ch.workoutStore.ListWorkoutsStarted(user.ID, from, to.AddDate(0, 0, 1))
+	if err != nil {
+		ch.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	weightUnit := responseWeightUnit(w, r)
+	for _, workout := range workouts {
+		workoutInUnit(&workout, weightUnit)
+		day := days[workout.StartedAt.In(location).Format(time.DateOnly)]
+		day.Workouts = append(day.Workouts, workout)
+	}
+
+	sessions, err := ch.plannedSessions(user.ID, now)
+	if err != nil {
+		ch.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	for _, session := range sessions {
+		if day, ok := days[session.Date]; ok {
+			day.Sessions = append(day.Sessions, session)
+		}
+	}
+
+	_ = utils.WriteJSONResponse(w, http.StatusOK, utils.Envelope{"calendar": calendar, "weight_unit": weightUnit})
+}
+
+// plannedSessions returns the sessions of every enrollment of a user, missed
+// or not as of now.
+func (ch *CalendarHandler) plannedSessions(userID int, now time.Time) ([]CalendarSession, error) {
+	enrollments, err := ch.enrollmentStore.ListEnrollments(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []CalendarSession
+	for _, listed := range enrollments {
+		// only GetEnrollment loads the completed sessions
+		enrollment, err := ch.enrollmentStore.GetEnrollment(listed.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		program, err := ch.programStore.GetProgram(listed.ProgramID)
+		if err != nil {
+			return nil, err
+		}
+
+		if enrollment == nil || program == nil {
+			continue
+		}
+
+		schedule, _, err := scheduleEnrollment(enrollment, program, now)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, planned := range schedule {
+			sessions = append(sessions, CalendarSession{
+				EnrollmentID:   enrollment.ID,
+				ProgramID:      program.ID,
+				ProgramName:    program.Name,
+				PlannedSession: planned,
+			})
+		}
+	}
+
+	return sessions, nil
+}
+
+// parseCalendarWindow returns the first and last days of a calendar request,
+// at the start of the day in the location of now.
+func parseCalendarWindow(r *http.Request, now time.Time) (time.Time, time.Time, error) {
+	values := r.URL.Query()
+	firstOfMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+
+	from, err := parseStatsDate(values.Get("from"), firstOfMonth.Format(time.DateOnly), now.Location())
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.New("from must be a date")
+	}
+
+	to, err := parseStatsDate(values.Get("to"), firstOfMonth.AddDate(0, 1, -1).Format(time.DateOnly), now.Location())
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.New("to must be a date")
+	}
+
+	if from.After(to) {
+		return time.Time{}, time.Time{}, errors.New("from must not be after to")
+	}
+	if to.Sub(from) >= maxCalendarDays*24*time.Hour {
+		return time.Time{}, time.Time{}, fmt.Errorf("the window must not be longer than %d days", maxCalendarDays)
+	}
+
+	return from, to, nil
+}
+
+// CreateCalendarFeed creates the iCalendar feed of the current user, whose
+// URL holds a token that authenticates it. Creating the feed again revokes
+// the previous URL.
+func (ch *CalendarHandler) CreateCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+
+	token, err := auth.MakeToken(user.ID, auth.CalendarTokenTTL, auth.TokenScopeCalendar)
+	if err != nil {
+		ch.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	err = ch.txManager.WithinTx(func(stores *store.Stores) error {
+		err := stores.Tokens.RevokeTokensForUser(user.ID, auth.TokenScopeCalendar)
+		if err != nil {
+			return err
+		}
+
+		return stores.Tokens.PersistToken(token)
+	})
+	if err != nil {
+		ch.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	feed := CalendarFeed{
+		URL:       ch.baseURL + "/calendar/" + token.Plain + ".ics",
+		ExpiresAt: token.ExpiresAt,
+	}
+	_ = utils.WriteJSONResponse(w, http.StatusCreated, utils.Envelope{"feed": feed})
+}
+
+// DeleteCalendarFeed revokes the URL of the iCalendar feed of the current user.
+func (ch *CalendarHandler) DeleteCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	err := ch.txManager.WithinTx(func(stores *store.Stores) error {
+		return stores.Tokens.RevokeTokensForUser(middleware.GetUser(r).ID, auth.TokenScopeCalendar)
+	})
+	if err != nil {
+		ch.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetCalendarFeed returns the iCalendar feed that the token of the URL
+// authenticates, with the workouts of the last months. Every workout is an
+// event in the time zone of the user lasting its duration_minutes, whose
+// description lists its exercises.
+func (ch *CalendarHandler) GetCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	user, err := ch.userStore.GetUserFromToken(chi.URLParam(r, "token"), auth.TokenScopeCalendar)
+	if err != nil {
+		ch.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	if user == nil {
+		ch.logger.Printf("ERROR: calendar feed not found")
+		_ = utils.WriteJSONResponse(w, http.StatusNotFound, utils.Envelope{"error": "not found"})
+		return
+	}
+
+	location := store.Location(user.TimeZone)
+	now := time.Now().In(location)
+	from, to := now.AddDate(0, -calendarFeedMonths, 0), now.AddDate(0, 0, 1)
+
+	workouts, err := ch.workoutStore.ListWorkoutsStarted(user.ID, from, to)
+	if err != nil {
+		ch.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	weightUnit := weightUnitOf(user.UnitSystem)
+
+	var calendar utils.ICalendar
+	calendar.Property("BEGIN", "VCALENDAR")
+	calendar.Property("VERSION", "2.0")
+	calendar.Property("PRODID", "-//fem-go-crud//Workouts//EN")
+	calendar.Property("CALSCALE", "GREGORIAN")
+	calendar.Property("METHOD", "PUBLISH")
+	calendar.Text("X-WR-CALNAME", "Workouts")
+	calendar.Text("X-WR-TIMEZONE", location.String())
+	calendar.Property("REFRESH-INTERVAL;VALUE=DURATION", "PT1H")
+	calendar.Property("X-PUBLISHED-TTL", "PT1H")
+	calendar.TimeZone(location, from, to)
+
+	for _, workout := range workouts {
+		workoutInUnit(&workout, weightUnit)
+
+		calendar.Property("BEGIN", "VEVENT")
+		calendar.Text("UID", fmt.Sprintf("workout-%d@fem-go-crud", workout.ID))
+		calendar.Time("DTSTAMP", now.UTC())
+		calendar.Time("CREATED", workout.CreatedAt.UTC())
+		calendar.Time("DTSTART", workout.StartedAt.In(location))
+		if workout.DurationMinutes > 0 {
+			calendar.Property("DURATION", fmt.Sprintf("PT%dM", workout.DurationMinutes))
+		}
+		calendar.Text("SUMMARY", workout.Name)
+		calendar.Text("DESCRIPTION", workoutDescription(&workout, weightUnit))
+		calendar.Property("END", "VEVENT")
+	}
+
+	calendar.Property("END", "VCALENDAR")
+
+	w.Header().Set("Content-Type", utils.ICalendarContentType)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(calendar.String()))
+}
+
+// workoutDescription is the description of a workout followed by a line per
+// exercise, such as "Squat: 5 × 5 @ 100.5 kg" or "Plank: 3 × 60 s".
+func workoutDescription(workout *store.Workout, weightUnit string) string {
+	var lines []string
+	if workout.Description != "" {
+		lines = append(lines, workout.Description, "")
+	}
+
+	for _, exercise := range workout.Exercises {
+		line := exercise.Name
+		if exercise.Sets > 0 {
+			line += fmt.Sprintf(": %d", exercise.Sets)
+			if exercise.Reps != nil {
+				line += fmt.Sprintf(" × %d", *exercise.Reps)
+			} else if exercise.DurationSeconds != nil {
+				line += fmt.Sprintf(" × %d s", *exercise.DurationSeconds)
+			}
+			if exercise.Weight != nil {
+				line += " @ " + strconv.FormatFloat(*exercise.Weight, 'f', -1, 64) + " " + weightUnit
+			}
+		}
+		lines = append(lines, line)
+	}
+
+	return strings.Join(lines, "\n")
+}
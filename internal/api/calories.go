@@ -0,0 +1,144 @@
+package api
+
+import (
+	"math"
+
+	"fem-go-crud/internal/store"
+)
+
+// metByMovementType are the MET values of the exercises of the catalog by
+// movement type, after the Compendium of Physical Activities.
+var metByMovementType = map[string]float64{
+	"cardio":    7.0,
+	"compound":  6.0,
+	"isolation": 3.5,
+	"mobility":  2.3,
+}
+
+// defaultMET is the MET value of general resistance training, for the
+// exercises not linked to the catalog and workouts without exercises.
+const defaultMET = 5.0
+
+// estimateCalories fills in the calories of a workout that has none, if the
+// body weight of user is known, and flags them as estimated. Calories set by
+// the client are measured.
+func estimateCalories(exerciseStore store.ExerciseStore, measurementStore store.MeasurementStore, workout *store.Workout, user *store.User) error {
+	workout.CaloriesEstimated = false
+	if workout.CaloriesBurned != nil {
+		return nil
+	}
+
+	bodyWeightKg, err := bodyWeight(measurementStore, user)
+	if err != nil || bodyWeightKg == nil {
+		return err
+	}
+
+	var exerciseIDs []int
+	for _, exercise := range workout.Exercises {
+		if exercise.ExerciseID != nil {
+			exerciseIDs = append(exerciseIDs, *exercise.ExerciseID)
+		}
+	}
+
+	mets := make(map[int]float64, len(exerciseIDs))
+	if len(exerciseIDs) > 0 {
+		linkedExercises, err := exerciseStore.GetExercises(exerciseIDs)
+		if err != nil {
+			return err
+		}
+
+		for _, exercise := range linkedExercises {
+			if met, ok := metByMovementType[exercise.MovementType]; ok {
+				mets[exercise.ID] = met
+			}
+		}
+	}
+
+	calories := workoutCalories(workout, *bodyWeightKg, mets)
+	workout.CaloriesBurned = &calories
+	workout.CaloriesEstimated = true
+
+	return nil
+}
+
+// bodyWeight is the latest weight measured by user, or else the body weight
+// of their profile, if any.
+func bodyWeight(measurementStore store.MeasurementStore, user *store.User) (*float64, error) {
+	latest, err := measurementStore.GetLatestMeasurements(user.ID, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if weight, ok := latest["weight"]; ok {
+		return &weight.Value, nil
+	}
+
+	return user.BodyWeightKg, nil
+}
+
+// workoutCalories adds up MET × body weight × hours over the exercises of a
+// workout. The exercises in time last their sets, and the rest of the
+// duration of the workout is split between the exercises in reps, or all the
+// exercises if none is in reps. The estimate is capped at what calories_burned
+// can hold.
+func workoutCalories(workout *store.Workout, bodyWeightKg float64, mets map[int]float64) int {
+	metOf := func(exercise store.WorkoutExercise) float64 {
+		if exercise.ExerciseID != nil {
+			if met, ok := mets[*exercise.ExerciseID]; ok {
+				return met
+			}
+		}
+		return defaultMET
+	}
+
+	seconds := make([]float64, len(workout.Exercises))
+	timedSeconds := 0.0
+	var untimed []int
+	for i, exercise := range workout.Exercises {
+		seconds[i] = exerciseSeconds(exercise)
+		timedSeconds += seconds[i]
+		if exercise.DurationSeconds == nil {
+			untimed = append(untimed, i)
+		}
+	}
+
+	restSeconds := max(0, float64(workout.DurationMinutes*60)-timedSeconds)
+	metSeconds := 0.0
+	switch {
+	case len(workout.Exercises) == 0:
+		metSeconds = defaultMET * restSeconds
+	case len(untimed) == 0:
+		for i := range workout.Exercises {
+			seconds[i] += restSeconds / float64(len(workout.Exercises))
+		}
+	default:
+		for _, i := range untimed {
+			seconds[i] += restSeconds / float64(len(untimed))
+		}
+	}
+
+	for i, exercise := range workout.Exercises {
+		metSeconds += metOf(exercise) * seconds[i]
+	}
+
+	return int(min(math.Round(metSeconds*bodyWeightKg/3600), math.MaxInt32))
+}
+
+// exerciseSeconds is the time spent in the sets of an exercise in time.
+func exerciseSeconds(exercise store.WorkoutExercise) float64 {
+	if len(exercise.WorkoutSets) == 0 {
+		if exercise.DurationSeconds == nil {
+			return 0
+		}
+		return float64(exercise.Sets * *exercise.DurationSeconds)
+	}
+
+	seconds := 0
+	for _, set := range exercise.WorkoutSets {
+		if set.DurationSeconds != nil {
+			seconds += *set.DurationSeconds
+		}
+	}
+
+	return float64(seconds)
+}
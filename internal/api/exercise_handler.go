@@ -0,0 +1,268 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"fem-go-crud/internal/middleware"
+	"fem-go-crud/internal/store"
+	"fem-go-crud/internal/utils"
+)
+
+const (
+	defaultExerciseSearchLimit = 50
+	maxExerciseSearchLimit     = 100
+)
+
+type ExerciseHandler struct {
+	exerciseStore store.ExerciseStore
+	logger        *log.Logger
+}
+
+func NewExerciseHandler(es store.ExerciseStore, l *log.Logger) *ExerciseHandler {
+	return &ExerciseHandler{
+		exerciseStore: es,
+		logger:        l,
+	}
+}
+
+// SearchExercises searches the catalog and the custom exercises of the current
+// user by name or alias (q), muscle group, equipment, movement_type and
+// tracking. custom=true leaves out the catalog.
+func (eh *ExerciseHandler) SearchExercises(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := store.ExerciseFilter{
+		Query:        query.Get("q"),
+		Muscle:       query.Get("muscle"),
+		Equipment:    query.Get("equipment"),
+		MovementType: query.Get("movement_type"),
+		Tracking:     query.Get("tracking"),
+		Limit:        defaultExerciseSearchLimit,
+	}
+
+	var err error
+	if custom := query.Get("custom"); custom != "" {
+		filter.CustomOnly, err = strconv.ParseBool(custom)
+	}
+	if limit := query.Get("limit"); err == nil && limit != "" {
+		filter.Limit, err = strconv.Atoi(limit)
+		if err == nil && (filter.Limit <= 0 || filter.Limit > maxExerciseSearchLimit) {
+			err = fmt.Errorf("limit must be between 1 and %d", maxExerciseSearchLimit)
+		}
+	}
+	if err != nil {
+		eh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": "bad request"})
+		return
+	}
+
+	exercises, err := eh.exerciseStore.SearchExercises(middleware.GetUser(r).ID, filter)
+	if err != nil {
+		eh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	_ = utils.WriteJSONResponse(w, http.StatusOK, utils.Envelope{"exercises": exercises})
+}
+
+func (eh *ExerciseHandler) GetExercise(w http.ResponseWriter, r *http.Request) {
+	exercise, ok := eh.getVisibleExercise(w, r)
+	if !ok {
+		return
+	}
+
+	_ = utils.WriteJSONResponse(w, http.StatusOK, utils.Envelope{"exercise": exercise})
+}
+
+func (eh *ExerciseHandler) CreateExercise(w http.ResponseWriter, r *http.Request) {
+	var exercise store.Exercise
+
+	err := json.NewDecoder(r.Body).Decode(&exercise)
+	if err != nil {
+		eh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": "bad request"})
+		return
+	}
+
+	err = validateExercise(&exercise)
+	if err != nil {
+		eh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	exercise.UserID = &currentUser.ID
+
+	err = eh.exerciseStore.CreateExercise(&exercise)
+	if errors.Is(err, store.ErrDuplicateExerciseName) {
+		eh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusConflict, utils.Envelope{"error": "an exercise with this name already exists"})
+		return
+	}
+	if err != nil {
+		eh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	_ = utils.WriteJSONResponse(w, http.StatusCreated, utils.Envelope{"exercise": exercise})
+}
+
+func (eh *ExerciseHandler) UpdateExercise(w http.ResponseWriter, r *http.Request) {
+	existingExercise, ok := eh.getOwnExercise(w, r)
+	if !ok {
+		return
+	}
+
+	exercise := *existingExercise
+	err := json.NewDecoder(r.Body).Decode(&exercise)
+	if err != nil {
+		eh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": "bad request"})
+		return
+	}
+	exercise.ID = existingExercise.ID
+
+	err = validateExercise(&exercise)
+	if err != nil {
+		eh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	err = eh.exerciseStore.UpdateExercise(&exercise)
+	if errors.Is(err, store.ErrDuplicateExerciseName) {
+		eh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusConflict, utils.Envelope{"error": "an exercise with this name already exists"})
+		return
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		eh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusNotFound, utils.Envelope{"error": "not found"})
+		return
+	}
+	if err != nil {
+		eh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	_ = utils.WriteJSONResponse(w, http.StatusOK, utils.Envelope{"exercise": exercise})
+}
+
+// DeleteExercise deletes a custom exercise. The workout exercises that
+// referenced it keep their name and lose the reference.
+func (eh *ExerciseHandler) DeleteExercise(w http.ResponseWriter, r *http.Request) {
+	exercise, ok := eh.getOwnExercise(w, r)
+	if !ok {
+		return
+	}
+
+	err := eh.exerciseStore.DeleteExercise(exercise.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		eh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusNotFound, utils.Envelope{"error": "not found"})
+		return
+	}
+	if err != nil {
+		eh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getVisibleExercise loads the exercise of the exerciseId URL parameter, which
+// must be in the catalog or a custom exercise of the current user, writing the
+// error response if not.
+func (eh *ExerciseHandler) getVisibleExercise(w http.ResponseWriter, r *http.Request) (*store.Exercise, bool) {
+	exerciseID, err := utils.ParseIDParamFromURL(r, "exerciseId")
+	if err != nil {
+		eh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": "bad request"})
+		return nil, false
+	}
+
+	exercise, err := eh.exerciseStore.GetExercise(exerciseID)
+	if err != nil {
+		eh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return nil, false
+	}
+
+	if exercise == nil {
+		eh.logger.Printf("ERROR: exercise %d not found", exerciseID)
+		_ = utils.WriteJSONResponse(w, http.StatusNotFound, utils.Envelope{"error": "not found"})
+		return nil, false
+	}
+
+	currentUser := middleware.GetUser(r)
+	if exercise.UserID != nil && *exercise.UserID != currentUser.ID {
+		eh.logger.Printf("ERROR: user %d does not own exercise %d", currentUser.ID, exerciseID)
+		_ = utils.WriteJSONResponse(w, http.StatusForbidden, utils.Envelope{"error": "forbidden"})
+		return nil, false
+	}
+
+	return exercise, true
+}
+
+// getOwnExercise is getVisibleExercise for the custom exercises only: the
+// catalog cannot be changed.
+func (eh *ExerciseHandler) getOwnExercise(w http.ResponseWriter, r *http.Request) (*store.Exercise, bool) {
+	exercise, ok := eh.getVisibleExercise(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	if exercise.UserID == nil {
+		eh.logger.Printf("ERROR: exercise %d is in the catalog", exercise.ID)
+		_ = utils.WriteJSONResponse(w, http.StatusForbidden, utils.Envelope{"error": "forbidden"})
+		return nil, false
+	}
+
+	return exercise, true
+}
+
+// validateExercise checks a custom exercise against the vocabularies of the catalog.
+func validateExercise(exercise *store.Exercise) error {
+	if exercise.Name == "" {
+		return errors.New("name is required")
+	}
+
+	if len(exercise.Name) > 100 {
+		return errors.New("name must be at most 100 characters")
+	}
+
+	if len(exercise.PrimaryMuscles) == 0 {
+		return errors.New("primary_muscles is required")
+	}
+
+	for _, muscle := range slices.Concat(exercise.PrimaryMuscles, exercise.SecondaryMuscles) {
+		if !slices.Contains(store.MuscleGroups, muscle) {
+			return fmt.Errorf("unknown muscle group %q", muscle)
+		}
+	}
+
+	if !slices.Contains(store.ExerciseEquipment, exercise.Equipment) {
+		return fmt.Errorf("equipment must be one of %v", store.ExerciseEquipment)
+	}
+
+	if !slices.Contains(store.MovementTypes, exercise.MovementType) {
+		return fmt.Errorf("movement_type must be one of %v", store.MovementTypes)
+	}
+
+	if exercise.Tracking != store.ExerciseTrackingReps && exercise.Tracking != store.ExerciseTrackingTime {
+		return errors.New("tracking must be reps or time")
+	}
+
+	return nil
+}
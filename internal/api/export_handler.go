@@ -0,0 +1,156 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"fem-go-crud/internal/jobs"
+	"fem-go-crud/internal/middleware"
+	"fem-go-crud/internal/store"
+	"fem-go-crud/internal/utils"
+)
+
+// maxStreamedExportWorkouts is the most workouts of an export returned in the
+// response, the larger ones being built in the background.
+const maxStreamedExportWorkouts = 200
+
+type ExportHandler struct {
+	workoutStore store.WorkoutStore
+	exportStore  store.ExportStore
+	exporter     *jobs.Exporter
+	logger       *log.Logger
+}
+
+func NewExportHandler(ws store.WorkoutStore, es store.ExportStore, e *jobs.Exporter, l *log.Logger) *ExportHandler {
+	return &ExportHandler{
+		workoutStore: ws,
+		exportStore:  es,
+		exporter:     e,
+		logger:       l,
+	}
+}
+
+// ExportData returns the ZIP archive of the data of the current user. Large
+// exports, or any with async=true, are built in the background instead: the
+// response is then 202 Accepted, with the export to poll until it can be
+// downloaded, which is the export of the user started in the last hour if
+// it is still pending or ready.
+func (eh *ExportHandler) ExportData(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+
+	workouts, err := eh.workoutStore.CountWorkouts(user.ID)
+	if err != nil {
+		eh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	if workouts > maxStreamedExportWorkouts || r.URL.Query().Get("async") == "true" {
+		export, err := eh.exporter.Start(user.ID)
+		if err != nil {
+			eh.logger.Printf("ERROR: %v", err)
+			_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+			return
+		}
+
+		w.Header().Set("Location", fmt.Sprintf("/users/me/exports/%d", export.ID))
+		_ = utils.WriteJSONResponse(w, http.StatusAccepted, utils.Envelope{"export": export})
+		return
+	}
+
+	// the archive is buffered rather than streamed, so that a slow client
+	// does not hold the transaction it is read in
+	now := time.Now()
+	archive, err := eh.exporter.BufferArchive(user, now)
+	if err != nil {
+		eh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	defer func() {
+		_ = archive.Close()
+	}()
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", exportContentDisposition(now))
+	http.ServeContent(w, r, "", now, archive)
+}
+
+// GetExport returns an export of the current user.
+func (eh *ExportHandler) GetExport(w http.ResponseWriter, r *http.Request) {
+	export, ok := eh.getOwnExport(w, r)
+	if !ok {
+		return
+	}
+
+	_ = utils.WriteJSONResponse(w, http.StatusOK, utils.Envelope{"export": export})
+}
+
+// DownloadExport returns the archive of a ready export of the current user.
+func (eh *ExportHandler) DownloadExport(w http.ResponseWriter, r *http.Request) {
+	export, ok := eh.getOwnExport(w, r)
+	if !ok {
+		return
+	}
+
+	if export.Status != store.ExportReady {
+		eh.logger.Printf("ERROR: export %d is %s", export.ID, export.Status)
+		_ = utils.WriteJSONResponse(w, http.StatusConflict, utils.Envelope{"error": "export is not ready"})
+		return
+	}
+
+	archive, err := eh.exporter.Open(export)
+	if err != nil {
+		eh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	defer func() {
+		_ = archive.Close()
+	}()
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", exportContentDisposition(export.CreatedAt))
+	http.ServeContent(w, r, "", *export.CompletedAt, archive)
+}
+
+// getOwnExport loads the export the URL refers to and checks it belongs to
+// the current user, writing the error response if not.
+func (eh *ExportHandler) getOwnExport(w http.ResponseWriter, r *http.Request) (*store.Export, bool) {
+	exportID, err := utils.ParseIDParamFromURL(r, "exportId")
+	if err != nil {
+		eh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": "bad request"})
+		return nil, false
+	}
+
+	export, err := eh.exportStore.GetExport(exportID)
+	if err != nil {
+		eh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return nil, false
+	}
+
+	if export == nil {
+		eh.logger.Printf("ERROR: export %d not found", exportID)
+		_ = utils.WriteJSONResponse(w, http.StatusNotFound, utils.Envelope{"error": "not found"})
+		return nil, false
+	}
+
+	currentUser := middleware.GetUser(r)
+	if export.UserID != currentUser.ID {
+		eh.logger.Printf("ERROR: user %d does not own export %d", currentUser.ID, exportID)
+		_ = utils.WriteJSONResponse(w, http.StatusForbidden, utils.Envelope{"error": "forbidden"})
+		return nil, false
+	}
+
+	return export, true
+}
+
+func exportContentDisposition(exportedAt time.Time) string {
+	return fmt.Sprintf(`attachment; filename="training-data-%s.zip"`, exportedAt.UTC().Format(time.DateOnly))
+}
@@ -0,0 +1,328 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"fem-go-crud/internal/middleware"
+	"fem-go-crud/internal/store"
+	"fem-go-crud/internal/utils"
+)
+
+// goalPayload is a goal whose weights are in WeightUnit, or in kilograms.
+type goalPayload struct {
+	store.Goal
+	WeightUnit string `json:"weight_unit"`
+}
+
+type GoalHandler struct {
+	goalStore        store.GoalStore
+	exerciseStore    store.ExerciseStore
+	measurementStore store.MeasurementStore
+	logger           *log.Logger
+}
+
+func NewGoalHandler(gs store.GoalStore, es store.ExerciseStore, ms store.MeasurementStore, l *log.Logger) *GoalHandler {
+	return &GoalHandler{
+		goalStore:        gs,
+		exerciseStore:    es,
+		measurementStore: ms,
+		logger:           l,
+	}
+}
+
+// ListGoals returns the goals of the current user with their progress, only
+// those of the status query parameter if set.
+func (gh *GoalHandler) ListGoals(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status != "" && !slices.Contains(store.GoalStatuses, status) {
+		gh.logger.Printf("ERROR: unknown goal status %q", status)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": fmt.Sprintf("status must be one of %s", strings.Join(store.GoalStatuses, ", "))})
+		return
+	}
+
+	goals, err := gh.goalStore.ListGoals(middleware.GetUser(r).ID)
+	if err != nil {
+		gh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	if status != "" {
+		goals = slices.DeleteFunc(goals, func(goal store.Goal) bool {
+			return goal.Status != status
+		})
+	}
+
+	weightUnit := responseWeightUnit(w, r)
+	for i := range goals {
+		goalInUnit(&goals[i], weightUnit)
+	}
+
+	_ = utils.WriteJSONResponse(w, http.StatusOK, utils.Envelope{"goals": goals, "weight_unit": weightUnit})
+}
+
+func (gh *GoalHandler) GetGoal(w http.ResponseWriter, r *http.Request) {
+	goal, ok := gh.getOwnGoal(w, r)
+	if !ok {
+		return
+	}
+
+	weightUnit := responseWeightUnit(w, r)
+	goalInUnit(goal, weightUnit)
+	_ = utils.WriteJSONResponse(w, http.StatusOK, utils.Envelope{"goal": goal, "weight_unit": weightUnit})
+}
+
+// CreateGoal creates a goal of the current user, starting today in their time
+// zone unless it says.
+func (gh *GoalHandler) CreateGoal(w http.ResponseWriter, r *http.Request) {
+	goal, ok := gh.decodeGoal(w, r, userToday(middleware.GetUser(r)))
+	if !ok {
+		return
+	}
+
+	goal.ID = 0
+	goal.UserID = middleware.GetUser(r).ID
+	goal.StartValue = nil
+	gh.saveGoal(w, r, goal, http.StatusCreated)
+}
+
+// UpdateGoal replaces a goal of the current user, which keeps its starts_on
+// if left out. A body weight goal keeps the body weight it started at.
+func (gh *GoalHandler) UpdateGoal(w http.ResponseWriter, r *http.Request) {
+	existingGoal, ok := gh.getOwnGoal(w, r)
+	if !ok {
+		return
+	}
+
+	goal, ok := gh.decodeGoal(w, r, existingGoal.StartsOn)
+	if !ok {
+		return
+	}
+
+	goal.ID = existingGoal.ID
+	goal.UserID = existingGoal.UserID
+	goal.StartValue = existingGoal.StartValue
+	gh.saveGoal(w, r, goal, http.StatusOK)
+}
+
+func (gh *GoalHandler) DeleteGoal(w http.ResponseWriter, r *http.Request) {
+	goal, ok := gh.getOwnGoal(w, r)
+	if !ok {
+		return
+	}
+
+	err := gh.goalStore.DeleteGoal(goal.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		gh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusNotFound, utils.Envelope{"error": "not found"})
+		return
+	}
+	if err != nil {
+		gh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// decodeGoal decodes a goal payload converted to kilograms, starting on
+// startsOn if it does not say, writing the error response if it is invalid.
+func (gh *GoalHandler) decodeGoal(w http.ResponseWriter, r *http.Request, startsOn string) (*store.Goal, bool) {
+	payload := goalPayload{Goal: store.Goal{StartsOn: startsOn}}
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		gh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": "bad request"})
+		return nil, false
+	}
+
+	goal := &payload.Goal
+	err = goalToKilograms(goal, payload.WeightUnit)
+	if err == nil {
+		err = validateGoal(goal)
+	}
+	if err != nil {
+		gh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return nil, false
+	}
+
+	return goal, true
+}
+
+// saveGoal links the exercise of a goal, sets the body weight a body weight
+// goal starts at if it has none yet, and stores the goal, or updates it if it
+// has an id.
+func (gh *GoalHandler) saveGoal(w http.ResponseWriter, r *http.Request, goal *store.Goal, status int) {
+	if slices.Contains(store.ExerciseGoalKinds, goal.Kind) {
+		exercises := []store.WorkoutExercise{{ExerciseID: goal.ExerciseID, Name: goal.ExerciseName}}
+		err := linkExercises(gh.exerciseStore, goal.UserID, exercises)
+		if errors.Is(err, errUnknownExercise) {
+			gh.logger.Printf("ERROR: %v", err)
+			_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			gh.logger.Printf("ERROR: %v", err)
+			_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+			return
+		}
+		goal.ExerciseName = exercises[0].Name
+	}
+
+	if goal.Kind != store.GoalBodyWeight {
+		goal.StartValue = nil
+	} else if goal.StartValue == nil {
+		startValue, err := bodyWeight(gh.measurementStore, middleware.GetUser(r))
+		if err != nil {
+			gh.logger.Printf("ERROR: %v", err)
+			_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+			return
+		}
+
+		if startValue == nil {
+			gh.logger.Printf("ERROR: user %d has no body weight", goal.UserID)
+			_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": "body_weight goals need a body weight, in the profile or measured"})
+			return
+		}
+		goal.StartValue = startValue
+	}
+
+	var err error
+	if goal.ID == 0 {
+		err = gh.goalStore.CreateGoal(goal)
+	} else {
+		err = gh.goalStore.UpdateGoal(goal)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		gh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusNotFound, utils.Envelope{"error": "not found"})
+		return
+	}
+	if err != nil {
+		gh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	weightUnit := responseWeightUnit(w, r)
+	goalInUnit(goal, weightUnit)
+	_ = utils.WriteJSONResponse(w, status, utils.Envelope{"goal": goal, "weight_unit": weightUnit})
+}
+
+// getOwnGoal loads the goal of the goalId URL parameter, writing the error
+// response if it is not one of the current user. The goals of other users are
+// not found, as they are not under /users/me.
+func (gh *GoalHandler) getOwnGoal(w http.ResponseWriter, r *http.Request) (*store.Goal, bool) {
+	goalID, err := utils.ParseIDParamFromURL(r, "goalId")
+	if err != nil {
+		gh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": "bad request"})
+		return nil, false
+	}
+
+	goal, err := gh.goalStore.GetGoal(goalID)
+	if err != nil {
+		gh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return nil, false
+	}
+
+	if goal == nil || goal.UserID != middleware.GetUser(r).ID {
+		gh.logger.Printf("ERROR: goal %d not found", goalID)
+		_ = utils.WriteJSONResponse(w, http.StatusNotFound, utils.Envelope{"error": "not found"})
+		return nil, false
+	}
+
+	return goal, true
+}
+
+// goalToKilograms converts the weights of a goal from unit to kilograms: the
+// target of the weight goals and the weight of the reps goals.
+func goalToKilograms(goal *store.Goal, unit string) error {
+	weight, err := toCanonical(goal.Weight, unit, weightUnits, 3)
+	if err != nil {
+		return fmt.Errorf("weight_%w", err)
+	}
+	goal.Weight = weight
+
+	if goal.Kind == store.GoalExerciseWeight || goal.Kind == store.GoalBodyWeight {
+		target, _ := toCanonical(&goal.Target, unit, weightUnits, 3)
+		goal.Target = *target
+	}
+
+	return nil
+}
+
+// goalInUnit converts the weights of a goal from kilograms to unit.
+func goalInUnit(goal *store.Goal, unit string) {
+	goal.Weight = fromKilograms(goal.Weight, unit)
+
+	if goal.Kind == store.GoalExerciseWeight || goal.Kind == store.GoalBodyWeight {
+		goal.Target = weightInUnit(goal.Target, unit)
+		goal.CurrentValue = weightInUnit(goal.CurrentValue, unit)
+		goal.StartValue = fromKilograms(goal.StartValue, unit)
+	}
+}
+
+// validateGoal mirrors the checks of the goals table, and clears the fields
+// that do not apply to the kind of the goal.
+func validateGoal(goal *store.Goal) error {
+	if !slices.Contains(store.GoalKinds, goal.Kind) {
+		return fmt.Errorf("kind must be one of %s", strings.Join(store.GoalKinds, ", "))
+	}
+
+	if goal.Target <= 0 {
+		return errors.New("target must be positive")
+	}
+
+	if goal.Kind == store.GoalBodyWeight && goal.Target > maxBodyWeightKg {
+		return fmt.Errorf("target must be at most %d kg", maxBodyWeightKg)
+	}
+
+	goal.ExerciseName = strings.TrimSpace(goal.ExerciseName)
+	if slices.Contains(store.ExerciseGoalKinds, goal.Kind) {
+		if goal.ExerciseID == nil && goal.ExerciseName == "" {
+			return errors.New("exercise_id or exercise_name is required")
+		}
+	} else {
+		goal.ExerciseID = nil
+		goal.ExerciseName = ""
+	}
+
+	if goal.Kind != store.GoalExerciseReps {
+		goal.Weight = nil
+	} else if goal.Weight != nil && *goal.Weight < 0 {
+		return errors.New("weight cannot be negative")
+	}
+
+	startsOn := time.Now().UTC().Format(time.DateOnly)
+	if goal.StartsOn != "" {
+		if _, err := time.Parse(time.DateOnly, goal.StartsOn); err != nil {
+			return errors.New("starts_on must be a YYYY-MM-DD date")
+		}
+		startsOn = goal.StartsOn
+	}
+
+	if goal.Deadline != nil {
+		if _, err := time.Parse(time.DateOnly, *goal.Deadline); err != nil {
+			return errors.New("deadline must be a YYYY-MM-DD date")
+		}
+		if *goal.Deadline < startsOn {
+			return errors.New("deadline must not be before starts_on")
+		}
+	} else if goal.Kind == store.GoalFrequency {
+		return errors.New("frequency goals need a deadline")
+	}
+
+	return nil
+}
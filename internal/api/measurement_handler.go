@@ -0,0 +1,307 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"fem-go-crud/internal/middleware"
+	"fem-go-crud/internal/store"
+	"fem-go-crud/internal/utils"
+)
+
+const maxCircumferenceCm = 500
+
+// measurementPayload is a body measurement in weight_unit and length_unit,
+// which default to kilograms and centimeters.
+type measurementPayload struct {
+	store.BodyMeasurement
+	WeightUnit string `json:"weight_unit"`
+	LengthUnit string `json:"length_unit"`
+}
+
+// measurementResponse is a body measurement with the units of its values.
+type measurementResponse struct {
+	store.BodyMeasurement
+	WeightUnit string `json:"weight_unit"`
+	LengthUnit string `json:"length_unit"`
+}
+
+// newMeasurementResponse converts a measurement to the units of the response
+// to r, those of the unit system its weights are in.
+func newMeasurementResponse(w http.ResponseWriter, r *http.Request, measurement *store.BodyMeasurement) measurementResponse {
+	weightUnit := responseWeightUnit(w, r)
+	response := measurementResponse{BodyMeasurement: *measurement, WeightUnit: weightUnit, LengthUnit: responseLengthUnit(weightUnit)}
+
+	response.WeightKg = fromKilograms(response.WeightKg, response.WeightUnit)
+	for _, value := range response.Values()[2:] {
+		*value = fromCanonical(*value, response.LengthUnit, lengthUnits)
+	}
+
+	return response
+}
+
+type MeasurementHandler struct {
+	measurementStore store.MeasurementStore
+	logger           *log.Logger
+}
+
+func NewMeasurementHandler(ms store.MeasurementStore, l *log.Logger) *MeasurementHandler {
+	return &MeasurementHandler{
+		measurementStore: ms,
+		logger:           l,
+	}
+}
+
+// ListMeasurements returns the measurements of the current user from the from
+// date to the to date, both included and optional, most recent first.
+func (mh *MeasurementHandler) ListMeasurements(w http.ResponseWriter, r *http.Request) {
+	from, to := r.URL.Query().Get("from"), r.URL.Query().Get("to")
+	for _, date := range []string{from, to} {
+		if _, err := time.Parse(time.DateOnly, date); date != "" && err != nil {
+			mh.logger.Printf("ERROR: %v", err)
+			_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": "from and to must be YYYY-MM-DD dates"})
+			return
+		}
+	}
+	if from != "" && to != "" && from > to {
+		mh.logger.Printf("ERROR: from %s is after to %s", from, to)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": "from must not be after to"})
+		return
+	}
+
+	measurements, err := mh.measurementStore.ListMeasurements(middleware.GetUser(r).ID, from, to)
+	if err != nil {
+		mh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	response := make([]measurementResponse, len(measurements))
+	for i := range measurements {
+		response[i] = newMeasurementResponse(w, r, &measurements[i])
+	}
+
+	_ = utils.WriteJSONResponse(w, http.StatusOK, utils.Envelope{"measurements": response})
+}
+
+// GetLatestMeasurements returns the latest value of every field the current
+// user measured, as of the on date if set, in the units of the response.
+func (mh *MeasurementHandler) GetLatestMeasurements(w http.ResponseWriter, r *http.Request) {
+	on := r.URL.Query().Get("on")
+	if _, err := time.Parse(time.DateOnly, on); on != "" && err != nil {
+		mh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": "on must be a YYYY-MM-DD date"})
+		return
+	}
+
+	latest, err := mh.measurementStore.GetLatestMeasurements(middleware.GetUser(r).ID, on)
+	if err != nil {
+		mh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	weightUnit := responseWeightUnit(w, r)
+	lengthUnit := responseLengthUnit(weightUnit)
+	for field, value := range latest {
+		switch field {
+		case "weight":
+			value.Value = weightInUnit(value.Value, weightUnit)
+		case "body_fat_percent":
+		default:
+			value.Value = *fromCanonical(&value.Value, lengthUnit, lengthUnits)
+		}
+		latest[field] = value
+	}
+
+	_ = utils.WriteJSONResponse(w, http.StatusOK, utils.Envelope{"latest": latest, "weight_unit": weightUnit, "length_unit": lengthUnit})
+}
+
+func (mh *MeasurementHandler) GetMeasurement(w http.ResponseWriter, r *http.Request) {
+	measurement, ok := mh.getOwnMeasurement(w, r)
+	if !ok {
+		return
+	}
+
+	_ = utils.WriteJSONResponse(w, http.StatusOK, utils.Envelope{"measurement": newMeasurementResponse(w, r, measurement)})
+}
+
+func (mh *MeasurementHandler) CreateMeasurement(w http.ResponseWriter, r *http.Request) {
+	measurement, ok := mh.decodeMeasurement(w, r)
+	if !ok {
+		return
+	}
+
+	measurement.ID = 0
+	measurement.UserID = middleware.GetUser(r).ID
+	mh.saveMeasurement(w, r, measurement, http.StatusCreated)
+}
+
+// UpdateMeasurement replaces a measurement of the current user.
+func (mh *MeasurementHandler) UpdateMeasurement(w http.ResponseWriter, r *http.Request) {
+	existingMeasurement, ok := mh.getOwnMeasurement(w, r)
+	if !ok {
+		return
+	}
+
+	measurement, ok := mh.decodeMeasurement(w, r)
+	if !ok {
+		return
+	}
+
+	measurement.ID = existingMeasurement.ID
+	measurement.UserID = existingMeasurement.UserID
+	mh.saveMeasurement(w, r, measurement, http.StatusOK)
+}
+
+func (mh *MeasurementHandler) DeleteMeasurement(w http.ResponseWriter, r *http.Request) {
+	measurement, ok := mh.getOwnMeasurement(w, r)
+	if !ok {
+		return
+	}
+
+	err := mh.measurementStore.DeleteMeasurement(measurement.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		mh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusNotFound, utils.Envelope{"error": "not found"})
+		return
+	}
+	if err != nil {
+		mh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// decodeMeasurement decodes and validates a measurement payload, converted to
+// kilograms and centimeters, writing the error response if it is invalid.
+func (mh *MeasurementHandler) decodeMeasurement(w http.ResponseWriter, r *http.Request) (*store.BodyMeasurement, bool) {
+	var payload measurementPayload
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		mh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": "bad request"})
+		return nil, false
+	}
+
+	measurement := &payload.BodyMeasurement
+	err = convertMeasurement(measurement, payload.WeightUnit, payload.LengthUnit)
+	if err == nil {
+		err = validateMeasurement(measurement)
+	}
+	if err != nil {
+		mh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return nil, false
+	}
+
+	return measurement, true
+}
+
+func (mh *MeasurementHandler) saveMeasurement(w http.ResponseWriter, r *http.Request, measurement *store.BodyMeasurement, status int) {
+	var err error
+	if measurement.ID == 0 {
+		err = mh.measurementStore.CreateMeasurement(measurement)
+	} else {
+		err = mh.measurementStore.UpdateMeasurement(measurement)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		mh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusNotFound, utils.Envelope{"error": "not found"})
+		return
+	}
+	if err != nil {
+		mh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	_ = utils.WriteJSONResponse(w, status, utils.Envelope{"measurement": newMeasurementResponse(w, r, measurement)})
+}
+
+// getOwnMeasurement loads the measurement of the measurementId URL parameter,
+// writing the error response if it is not one of the current user. The
+// measurements of other users are not found, as they are not under /users/me.
+func (mh *MeasurementHandler) getOwnMeasurement(w http.ResponseWriter, r *http.Request) (*store.BodyMeasurement, bool) {
+	measurementID, err := utils.ParseIDParamFromURL(r, "measurementId")
+	if err != nil {
+		mh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": "bad request"})
+		return nil, false
+	}
+
+	measurement, err := mh.measurementStore.GetMeasurement(measurementID)
+	if err != nil {
+		mh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return nil, false
+	}
+
+	if measurement == nil || measurement.UserID != middleware.GetUser(r).ID {
+		mh.logger.Printf("ERROR: measurement %d not found", measurementID)
+		_ = utils.WriteJSONResponse(w, http.StatusNotFound, utils.Envelope{"error": "not found"})
+		return nil, false
+	}
+
+	return measurement, true
+}
+
+// convertMeasurement converts the weight and the circumferences of a
+// measurement to kilograms and centimeters, at the precision they are stored.
+func convertMeasurement(measurement *store.BodyMeasurement, weightUnit, lengthUnit string) error {
+	var err error
+	measurement.WeightKg, err = toCanonical(measurement.WeightKg, weightUnit, weightUnits, 3)
+	if err != nil {
+		return fmt.Errorf("weight_%w", err)
+	}
+
+	for _, value := range measurement.Values()[2:] {
+		*value, err = toCanonical(*value, lengthUnit, lengthUnits, 1)
+		if err != nil {
+			return fmt.Errorf("length_%w", err)
+		}
+	}
+
+	if measurement.BodyFatPercent != nil {
+		bodyFat := roundTo(*measurement.BodyFatPercent, 1)
+		measurement.BodyFatPercent = &bodyFat
+	}
+
+	return nil
+}
+
+func validateMeasurement(measurement *store.BodyMeasurement) error {
+	if _, err := time.Parse(time.DateOnly, measurement.MeasuredOn); err != nil {
+		return errors.New("measured_on must be a YYYY-MM-DD date")
+	}
+
+	if weight := measurement.WeightKg; weight != nil && (*weight <= 0 || *weight > maxBodyWeightKg) {
+		return fmt.Errorf("weight must be greater than 0 and at most %d kg", maxBodyWeightKg)
+	}
+	if fat := measurement.BodyFatPercent; fat != nil && (*fat <= 0 || *fat >= 100) {
+		return errors.New("body_fat_percent must be between 0 and 100")
+	}
+
+	measured := false
+	for i, value := range measurement.Values() {
+		if *value == nil {
+			continue
+		}
+		measured = true
+		if i >= 2 && (**value <= 0 || **value > maxCircumferenceCm) {
+			return fmt.Errorf("circumferences must be greater than 0 and at most %d cm", maxCircumferenceCm)
+		}
+	}
+	if !measured {
+		return errors.New("a measurement needs a weight, a body fat percentage or a circumference")
+	}
+
+	return nil
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"fem-go-crud/internal/middleware"
+	"fem-go-crud/internal/store"
+	"fem-go-crud/internal/utils"
+)
+
+type PersonalRecordHandler struct {
+	personalRecordStore store.PersonalRecordStore
+	logger              *log.Logger
+}
+
+func NewPersonalRecordHandler(prs store.PersonalRecordStore, l *log.Logger) *PersonalRecordHandler {
+	return &PersonalRecordHandler{
+		personalRecordStore: prs,
+		logger:              l,
+	}
+}
+
+// ListPersonalRecords returns the current records of the current user, or with
+// history=true every record they set, most recent first.
+func (ph *PersonalRecordHandler) ListPersonalRecords(w http.ResponseWriter, r *http.Request) {
+	var history bool
+	var err error
+	if value := r.URL.Query().Get("history"); value != "" {
+		history, err = strconv.ParseBool(value)
+	}
+	if err != nil {
+		ph.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": "bad request"})
+		return
+	}
+
+	records, err := ph.personalRecordStore.ListPersonalRecords(middleware.GetUser(r).ID, history)
+	if err != nil {
+		ph.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	weightUnit := responseWeightUnit(w, r)
+	recordsInUnit(records, weightUnit)
+	_ = utils.WriteJSONResponse(w, http.StatusOK, utils.Envelope{"records": records, "weight_unit": weightUnit})
+}
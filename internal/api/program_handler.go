@@ -0,0 +1,596 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"fem-go-crud/internal/middleware"
+	"fem-go-crud/internal/store"
+	"fem-go-crud/internal/utils"
+)
+
+const maxProgramWeeks = 52
+
+// statuses of the planned sessions of an enrollment
+const (
+	sessionCompleted = "completed"
+	sessionMissed    = "missed"
+	sessionPlanned   = "planned"
+)
+
+type ProgramHandler struct {
+	programStore    store.ProgramStore
+	enrollmentStore store.EnrollmentStore
+	templateStore   store.TemplateStore
+	workoutStore    store.WorkoutStore
+	logger          *log.Logger
+}
+
+func NewProgramHandler(ps store.ProgramStore, es store.EnrollmentStore, ts store.TemplateStore, ws store.WorkoutStore, l *log.Logger) *ProgramHandler {
+	return &ProgramHandler{
+		programStore:    ps,
+		enrollmentStore: es,
+		templateStore:   ts,
+		workoutStore:    ws,
+		logger:          l,
+	}
+}
+
+// PlannedSession is a day of a program on the calendar of an enrollment.
+type PlannedSession struct {
+	ProgramDayID int    `json:"program_day_id"`
+	Week         int    `json:"week"`
+	Day          int    `json:"day"`
+	TemplateID   int    `json:"template_id"`
+	Date         string `json:"date"`
+	Status       string `json:"status"`
+	WorkoutID    *int   `json:"workout_id"`
+}
+
+// Adherence counts the planned sessions of an enrollment. Due sessions are the
+// ones planned before today, and Rate is the share of them that were
+// completed, or null while none is due.
+type Adherence struct {
+	Planned   int      `json:"planned"`
+	Due       int      `json:"due"`
+	Completed int      `json:"completed"`
+	Missed    int      `json:"missed"`
+	Rate      *float64 `json:"rate"`
+}
+
+// ListPrograms returns every program without its days, as any user can enroll
+// in any program.
+func (ph *ProgramHandler) ListPrograms(w http.ResponseWriter, r *http.Request) {
+	programs, err := ph.programStore.ListPrograms()
+	if err != nil {
+		ph.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	_ = utils.WriteJSONResponse(w, http.StatusOK, utils.Envelope{"programs": programs})
+}
+
+func (ph *ProgramHandler) GetProgram(w http.ResponseWriter, r *http.Request) {
+	program, ok := ph.getProgram(w, r)
+	if !ok {
+		return
+	}
+
+	_ = utils.WriteJSONResponse(w, http.StatusOK, utils.Envelope{"program": program})
+}
+
+func (ph *ProgramHandler) CreateProgram(w http.ResponseWriter, r *http.Request) {
+	var program store.Program
+
+	err := json.NewDecoder(r.Body).Decode(&program)
+	if err != nil {
+		ph.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": "bad request"})
+		return
+	}
+
+	program.ID = 0
+	program.UserID = middleware.GetUser(r).ID
+	ph.saveProgram(w, &program, http.StatusCreated)
+}
+
+// UpdateProgram replaces a program and its days. The days kept, by week and
+// day, keep the sessions completed on them.
+func (ph *ProgramHandler) UpdateProgram(w http.ResponseWriter, r *http.Request) {
+	existingProgram, ok := ph.getOwnProgram(w, r)
+	if !ok {
+		return
+	}
+
+	var program store.Program
+	err := json.NewDecoder(r.Body).Decode(&program)
+	if err != nil {
+		ph.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": "bad request"})
+		return
+	}
+
+	program.ID = existingProgram.ID
+	program.UserID = existingProgram.UserID
+	ph.saveProgram(w, &program, http.StatusOK)
+}
+
+// DeleteProgram deletes the enrollments of the designer in the program too.
+// While other users are enrolled in it, it cannot be deleted.
+func (ph *ProgramHandler) DeleteProgram(w http.ResponseWriter, r *http.Request) {
+	program, ok := ph.getOwnProgram(w, r)
+	if !ok {
+		return
+	}
+
+	err := ph.programStore.DeleteProgram(program.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		ph.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusNotFound, utils.Envelope{"error": "not found"})
+		return
+	}
+	if errors.Is(err, store.ErrProgramInUse) {
+		ph.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusConflict, utils.Envelope{"error": "other users are enrolled in the program"})
+		return
+	}
+	if err != nil {
+		ph.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// EnrollInProgram enrolls the current user in a program from start_date, a
+// YYYY-MM-DD date, and returns the enrollment with its schedule.
+func (ph *ProgramHandler) EnrollInProgram(w http.ResponseWriter, r *http.Request) {
+	program, ok := ph.getProgram(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		StartDate string `json:"start_date"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		ph.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": "bad request"})
+		return
+	}
+
+	_, err = time.Parse(time.DateOnly, req.StartDate)
+	if err != nil {
+		ph.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": "start_date must be a YYYY-MM-DD date"})
+		return
+	}
+
+	enrollment := store.Enrollment{
+		ProgramID: program.ID,
+		UserID:    middleware.GetUser(r).ID,
+		StartDate: req.StartDate,
+	}
+
+	err = ph.enrollmentStore.CreateEnrollment(&enrollment)
+	if err != nil {
+		ph.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	ph.writeEnrollment(w, r, &enrollment, program, http.StatusCreated)
+}
+
+// ListEnrollments returns the enrollments of the current user, most recent
+// start first.
+func (ph *ProgramHandler) ListEnrollments(w http.ResponseWriter, r *http.Request) {
+	enrollments, err := ph.enrollmentStore.ListEnrollments(middleware.GetUser(r).ID)
+	if err != nil {
+		ph.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	_ = utils.WriteJSONResponse(w, http.StatusOK, utils.Envelope{"enrollments": enrollments})
+}
+
+// GetEnrollment returns an enrollment with its schedule and adherence.
+func (ph *ProgramHandler) GetEnrollment(w http.ResponseWriter, r *http.Request) {
+	enrollment, program, ok := ph.getOwnEnrollment(w, r)
+	if !ok {
+		return
+	}
+
+	ph.writeEnrollment(w, r, enrollment, program, http.StatusOK)
+}
+
+func (ph *ProgramHandler) DeleteEnrollment(w http.ResponseWriter, r *http.Request) {
+	enrollment, _, ok := ph.getOwnEnrollment(w, r)
+	if !ok {
+		return
+	}
+
+	err := ph.enrollmentStore.DeleteEnrollment(enrollment.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		ph.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusNotFound, utils.Envelope{"error": "not found"})
+		return
+	}
+	if err != nil {
+		ph.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CompleteSession links a workout of the current user to a planned session of
+// an enrollment, in place of the workout linked before, if any.
+func (ph *ProgramHandler) CompleteSession(w http.ResponseWriter, r *http.Request) {
+	enrollment, program, ok := ph.getOwnEnrollment(w, r)
+	if !ok {
+		return
+	}
+
+	programDayID, ok := ph.parseSessionID(w, r, program)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		WorkoutID int `json:"workout_id"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		ph.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": "bad request"})
+		return
+	}
+
+	// trashed workouts are not returned, so they cannot complete a session
+	workout, err := ph.workoutStore.GetWorkout(req.WorkoutID)
+	if err != nil {
+		ph.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	if workout == nil || workout.UserID != enrollment.UserID {
+		ph.logger.Printf("ERROR: workout %d is not a workout of user %d", req.WorkoutID, enrollment.UserID)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": "workout_id must be one of your workouts"})
+		return
+	}
+
+	err = ph.enrollmentStore.CompleteSession(enrollment.ID, programDayID, workout.ID)
+	if errors.Is(err, store.ErrWorkoutAlreadyLinked) {
+		ph.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusConflict, utils.Envelope{"error": "workout already completes another session"})
+		return
+	}
+	if err != nil {
+		ph.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	ph.writeUpdatedEnrollment(w, r, enrollment.ID, program)
+}
+
+// UncompleteSession unlinks the workout of a planned session of an enrollment.
+func (ph *ProgramHandler) UncompleteSession(w http.ResponseWriter, r *http.Request) {
+	enrollment, program, ok := ph.getOwnEnrollment(w, r)
+	if !ok {
+		return
+	}
+
+	programDayID, ok := ph.parseSessionID(w, r, program)
+	if !ok {
+		return
+	}
+
+	err := ph.enrollmentStore.UncompleteSession(enrollment.ID, programDayID)
+	if errors.Is(err, sql.ErrNoRows) {
+		ph.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusNotFound, utils.Envelope{"error": "not found"})
+		return
+	}
+	if err != nil {
+		ph.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	ph.writeUpdatedEnrollment(w, r, enrollment.ID, program)
+}
+
+// saveProgram validates and stores a new program, or an existing one if it
+// has an id, and writes it with status.
+func (ph *ProgramHandler) saveProgram(w http.ResponseWriter, program *store.Program, status int) {
+	err := validateProgram(program)
+	if err != nil {
+		ph.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	for i, day := range program.Days {
+		template, err := ph.templateStore.GetTemplate(day.TemplateID)
+		if err != nil {
+			ph.logger.Printf("ERROR: %v", err)
+			_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+			return
+		}
+
+		if template == nil || template.UserID != program.UserID {
+			ph.logger.Printf("ERROR: template %d is not a template of user %d", day.TemplateID, program.UserID)
+			_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": fmt.Sprintf("day %d: template_id must be one of your templates", i+1)})
+			return
+		}
+	}
+
+	if program.ID == 0 {
+		err = ph.programStore.CreateProgram(program)
+	} else {
+		err = ph.programStore.UpdateProgram(program)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		ph.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusNotFound, utils.Envelope{"error": "not found"})
+		return
+	}
+	if err != nil {
+		ph.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	_ = utils.WriteJSONResponse(w, status, utils.Envelope{"program": program})
+}
+
+// getProgram loads the program of the programId URL parameter, writing the
+// error response if it fails.
+func (ph *ProgramHandler) getProgram(w http.ResponseWriter, r *http.Request) (*store.Program, bool) {
+	programID, err := utils.ParseIDParamFromURL(r, "programId")
+	if err != nil {
+		ph.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": "bad request"})
+		return nil, false
+	}
+
+	program, err := ph.programStore.GetProgram(programID)
+	if err != nil {
+		ph.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return nil, false
+	}
+
+	if program == nil {
+		ph.logger.Printf("ERROR: program %d not found", programID)
+		_ = utils.WriteJSONResponse(w, http.StatusNotFound, utils.Envelope{"error": "not found"})
+		return nil, false
+	}
+
+	return program, true
+}
+
+// getOwnProgram is getProgram for the author of the program only.
+func (ph *ProgramHandler) getOwnProgram(w http.ResponseWriter, r *http.Request) (*store.Program, bool) {
+	program, ok := ph.getProgram(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	currentUser := middleware.GetUser(r)
+	if program.UserID != currentUser.ID {
+		ph.logger.Printf("ERROR: user %d does not own program %d", currentUser.ID, program.ID)
+		_ = utils.WriteJSONResponse(w, http.StatusForbidden, utils.Envelope{"error": "forbidden"})
+		return nil, false
+	}
+
+	return program, true
+}
+
+// getOwnEnrollment loads the enrollment of the enrollmentId URL parameter and
+// its program, and checks the current user owns it, writing the error
+// response if not.
+func (ph *ProgramHandler) getOwnEnrollment(w http.ResponseWriter, r *http.Request) (*store.Enrollment, *store.Program, bool) {
+	enrollmentID, err := utils.ParseIDParamFromURL(r, "enrollmentId")
+	if err != nil {
+		ph.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": "bad request"})
+		return nil, nil, false
+	}
+
+	enrollment, err := ph.enrollmentStore.GetEnrollment(enrollmentID)
+	if err != nil {
+		ph.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return nil, nil, false
+	}
+
+	if enrollment == nil {
+		ph.logger.Printf("ERROR: enrollment %d not found", enrollmentID)
+		_ = utils.WriteJSONResponse(w, http.StatusNotFound, utils.Envelope{"error": "not found"})
+		return nil, nil, false
+	}
+
+	currentUser := middleware.GetUser(r)
+	if enrollment.UserID != currentUser.ID {
+		ph.logger.Printf("ERROR: user %d does not own enrollment %d", currentUser.ID, enrollmentID)
+		_ = utils.WriteJSONResponse(w, http.StatusForbidden, utils.Envelope{"error": "forbidden"})
+		return nil, nil, false
+	}
+
+	program, err := ph.programStore.GetProgram(enrollment.ProgramID)
+	if err == nil && program == nil {
+		err = fmt.Errorf("program %d of enrollment %d not found", enrollment.ProgramID, enrollmentID)
+	}
+	if err != nil {
+		ph.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return nil, nil, false
+	}
+
+	return enrollment, program, true
+}
+
+// parseSessionID parses the sessionId URL parameter, the id of a day of the
+// program, writing the error response if the program has no such day.
+func (ph *ProgramHandler) parseSessionID(w http.ResponseWriter, r *http.Request, program *store.Program) (int, bool) {
+	programDayID, err := utils.ParseIDParamFromURL(r, "sessionId")
+	if err != nil {
+		ph.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": "bad request"})
+		return 0, false
+	}
+
+	for _, day := range program.Days {
+		if day.ID == programDayID {
+			return programDayID, true
+		}
+	}
+
+	ph.logger.Printf("ERROR: session %d not found in program %d", programDayID, program.ID)
+	_ = utils.WriteJSONResponse(w, http.StatusNotFound, utils.Envelope{"error": "not found"})
+	return 0, false
+}
+
+// writeUpdatedEnrollment reloads an enrollment after its sessions changed and
+// writes it.
+func (ph *ProgramHandler) writeUpdatedEnrollment(w http.ResponseWriter, r *http.Request, enrollmentID int, program *store.Program) {
+	enrollment, err := ph.enrollmentStore.GetEnrollment(enrollmentID)
+	if err == nil && enrollment == nil {
+		err = fmt.Errorf("enrollment %d not found", enrollmentID)
+	}
+	if err != nil {
+		ph.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	ph.writeEnrollment(w, r, enrollment, program, http.StatusOK)
+}
+
+// writeEnrollment writes an enrollment of the current user with its schedule,
+// the sessions of which are due as of today in the time zone of the user.
+func (ph *ProgramHandler) writeEnrollment(w http.ResponseWriter, r *http.Request, enrollment *store.Enrollment, program *store.Program, status int) {
+	now := time.Now().In(store.Location(middleware.GetUser(r).TimeZone))
+	schedule, adherence, err := scheduleEnrollment(enrollment, program, now)
+	if err != nil {
+		ph.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	_ = utils.WriteJSONResponse(w, status, utils.Envelope{
+		"enrollment": enrollment,
+		"schedule":   schedule,
+		"adherence":  adherence,
+	})
+}
+
+// scheduleEnrollment dates the days of the program from the start of the
+// enrollment, week 1 day 1 being the start date, and compares them with the
+// date of now to tell which sessions were missed.
+func scheduleEnrollment(enrollment *store.Enrollment, program *store.Program, now time.Time) ([]PlannedSession, Adherence, error) {
+	startDate, err := time.Parse(time.DateOnly, enrollment.StartDate)
+	if err != nil {
+		return nil, Adherence{}, err
+	}
+
+	today := now.Format(time.DateOnly)
+
+	workoutIDs := make(map[int]int, len(enrollment.CompletedSessions))
+	for _, session := range enrollment.CompletedSessions {
+		workoutIDs[session.ProgramDayID] = session.WorkoutID
+	}
+
+	schedule := make([]PlannedSession, len(program.Days))
+	adherence := Adherence{Planned: len(program.Days)}
+	completedDue := 0
+	for i, day := range program.Days {
+		session := PlannedSession{
+			ProgramDayID: day.ID,
+			Week:         day.Week,
+			Day:          day.Day,
+			TemplateID:   day.TemplateID,
+			Date:         startDate.AddDate(0, 0, (day.Week-1)*7+day.Day-1).Format(time.DateOnly),
+			Status:       sessionPlanned,
+		}
+
+		// dates in the YYYY-MM-DD format compare as strings
+		due := session.Date < today
+		if due {
+			adherence.Due++
+		}
+
+		if workoutID, ok := workoutIDs[day.ID]; ok {
+			session.Status = sessionCompleted
+			session.WorkoutID = &workoutID
+			adherence.Completed++
+			if due {
+				completedDue++
+			}
+		} else if due {
+			session.Status = sessionMissed
+			adherence.Missed++
+		}
+
+		schedule[i] = session
+	}
+
+	if adherence.Due > 0 {
+		rate := float64(completedDue) / float64(adherence.Due)
+		adherence.Rate = &rate
+	}
+
+	return schedule, adherence, nil
+}
+
+func validateProgram(program *store.Program) error {
+	if program.Name == "" {
+		return errors.New("name is required")
+	}
+
+	if len(program.Name) > 100 {
+		return errors.New("name must be at most 100 characters")
+	}
+
+	if program.Weeks < 1 || program.Weeks > maxProgramWeeks {
+		return fmt.Errorf("weeks must be between 1 and %d", maxProgramWeeks)
+	}
+
+	if program.Days == nil {
+		program.Days = []store.ProgramDay{}
+	}
+
+	seen := make(map[[2]int]bool, len(program.Days))
+	for i, day := range program.Days {
+		if day.Week < 1 || day.Week > program.Weeks {
+			return fmt.Errorf("day %d: week must be between 1 and %d", i+1, program.Weeks)
+		}
+
+		if day.Day < 1 || day.Day > 7 {
+			return fmt.Errorf("day %d: day must be between 1 and 7", i+1)
+		}
+
+		if seen[[2]int{day.Week, day.Day}] {
+			return fmt.Errorf("day %d: week %d day %d is planned twice", i+1, day.Week, day.Day)
+		}
+		seen[[2]int{day.Week, day.Day}] = true
+	}
+
+	return nil
+}
@@ -0,0 +1,323 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"fem-go-crud/internal/middleware"
+	"fem-go-crud/internal/store"
+	"fem-go-crud/internal/utils"
+	"github.com/go-chi/chi/v5"
+)
+
+// maxStatsWindowDays caps the window of the statistics, which is also the
+// number of daily buckets.
+const maxStatsWindowDays = 731
+
+const (
+	defaultMovingAverageWindow = 3
+	maxMovingAverageWindow     = 20
+)
+
+// stallingRate is the weekly change, relative to the average, under which a
+// trend is stalling.
+const stallingRate = 0.005
+
+const (
+	trendImproving        = "improving"
+	trendStalling         = "stalling"
+	trendDeclining        = "declining"
+	trendInsufficientData = "insufficient_data"
+)
+
+// ExerciseProgress is the time series of the sessions of an exercise, each
+// with the moving averages over the last Window sessions, and the trend of
+// the estimated 1RM, or of the top set duration for exercises tracked in time.
+type ExerciseProgress struct {
+	Exercise string          `json:"exercise"`
+	Formula  string          `json:"formula"`
+	Window   int             `json:"window"`
+	Sessions []ProgressPoint `json:"sessions"`
+	Trend    ProgressTrend   `json:"trend"`
+}
+
+type ProgressPoint struct {
+	store.ProgressPoint
+	Estimated1RMAverage *float64 `json:"estimated_1rm_average"`
+	VolumeLoadAverage   float64  `json:"volume_load_average"`
+}
+
+// ProgressTrend is the slope of the linear regression of Metric over time.
+type ProgressTrend struct {
+	Metric       *string  `json:"metric"`
+	SlopePerWeek *float64 `json:"slope_per_week"`
+	Direction    string   `json:"direction"`
+}
+
+type StatsHandler struct {
+	statsStore store.StatsStore
+	logger     *log.Logger
+}
+
+func NewStatsHandler(ss store.StatsStore, l *log.Logger) *StatsHandler {
+	return &StatsHandler{
+		statsStore: ss,
+		logger:     l,
+	}
+}
+
+// GetTrainingStats sums up the workouts of the current user from the from date
+// to the to date, both included, in buckets of a day, a week or a month. The
+// window defaults to the last 30 days, 12 weeks or 12 months to today. The
+// dates are those of the time zone of the user.
+func (sh *StatsHandler) GetTrainingStats(w http.ResponseWriter, r *http.Request) {
+	query, err := parseStatsQuery(r, time.Now(), middleware.GetUser(r).TimeZone)
+	if err != nil {
+		sh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	stats, err := sh.statsStore.GetTrainingStats(middleware.GetUser(r).ID, query)
+	if err != nil {
+		sh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	weightUnit := responseWeightUnit(w, r)
+	statsInUnit(stats, weightUnit)
+	_ = utils.WriteJSONResponse(w, http.StatusOK, utils.Envelope{"stats": stats, "weight_unit": weightUnit})
+}
+
+// statsInUnit converts the volume loads of stats to unit.
+func statsInUnit(stats *store.TrainingStats, unit string) {
+	stats.Totals.VolumeLoad = weightInUnit(stats.Totals.VolumeLoad, unit)
+	for i := range stats.Buckets {
+		stats.Buckets[i].VolumeLoad = weightInUnit(stats.Buckets[i].VolumeLoad, unit)
+	}
+	for i := range stats.Exercises {
+		stats.Exercises[i].VolumeLoad = weightInUnit(stats.Exercises[i].VolumeLoad, unit)
+	}
+	for i := range stats.MuscleGroups {
+		stats.MuscleGroups[i].VolumeLoad = weightInUnit(stats.MuscleGroups[i].VolumeLoad, unit)
+	}
+}
+
+// GetExerciseProgress charts the sessions of the exercise of the name URL
+// parameter. formula picks how 1RMs are estimated, and window the number of
+// sessions of the moving averages.
+func (sh *StatsHandler) GetExerciseProgress(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	formula := r.URL.Query().Get("formula")
+	if formula == "" {
+		formula = store.OneRepMaxEpley
+	}
+	if !slices.Contains(store.OneRepMaxFormulas, formula) {
+		err := fmt.Errorf("formula must be one of %v", store.OneRepMaxFormulas)
+		sh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	window := defaultMovingAverageWindow
+	if value := r.URL.Query().Get("window"); value != "" {
+		var err error
+		window, err = strconv.Atoi(value)
+		if err != nil || window < 1 || window > maxMovingAverageWindow {
+			err = fmt.Errorf("window must be between 1 and %d", maxMovingAverageWindow)
+			sh.logger.Printf("ERROR: %v", err)
+			_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+			return
+		}
+	}
+
+	points, err := sh.statsStore.GetExerciseProgress(middleware.GetUser(r).ID, name, formula)
+	if err != nil {
+		sh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	if len(points) == 0 {
+		sh.logger.Printf("ERROR: no sessions of exercise %q", name)
+		_ = utils.WriteJSONResponse(w, http.StatusNotFound, utils.Envelope{"error": "not found"})
+		return
+	}
+
+	// the averages and the trend are computed from the converted sessions
+	weightUnit := responseWeightUnit(w, r)
+	for i := range points {
+		points[i].TopSet.Weight = fromKilograms(points[i].TopSet.Weight, weightUnit)
+		points[i].Estimated1RM = fromKilograms(points[i].Estimated1RM, weightUnit)
+		points[i].VolumeLoad = weightInUnit(points[i].VolumeLoad, weightUnit)
+	}
+
+	_ = utils.WriteJSONResponse(w, http.StatusOK, utils.Envelope{"progress": exerciseProgress(name, formula, window, points), "weight_unit": weightUnit})
+}
+
+func exerciseProgress(name, formula string, window int, points []store.ProgressPoint) ExerciseProgress {
+	progress := ExerciseProgress{
+		Exercise: name,
+		Formula:  formula,
+		Window:   window,
+		Sessions: make([]ProgressPoint, len(points)),
+	}
+
+	for i, point := range points {
+		progress.Sessions[i].ProgressPoint = point
+
+		var oneRepMaxes, volumes []float64
+		for _, recent := range points[max(0, i-window+1) : i+1] {
+			if recent.Estimated1RM != nil {
+				oneRepMaxes = append(oneRepMaxes, *recent.Estimated1RM)
+			}
+			volumes = append(volumes, recent.VolumeLoad)
+		}
+
+		if len(oneRepMaxes) > 0 {
+			average := store.RoundStat(mean(oneRepMaxes))
+			progress.Sessions[i].Estimated1RMAverage = &average
+		}
+		progress.Sessions[i].VolumeLoadAverage = store.RoundStat(mean(volumes))
+	}
+
+	progress.Trend = progressTrend(points)
+
+	return progress
+}
+
+// progressTrend fits the estimated 1RMs, or the top set durations if there
+// are none, against the days since the first session.
+func progressTrend(points []store.ProgressPoint) ProgressTrend {
+	metric := "estimated_1rm"
+	value := func(point store.ProgressPoint) *float64 {
+		return point.Estimated1RM
+	}
+	if !slices.ContainsFunc(points, func(point store.ProgressPoint) bool { return point.Estimated1RM != nil }) {
+		metric = "duration_seconds"
+		value = func(point store.ProgressPoint) *float64 {
+			if point.TopSet.DurationSeconds == nil {
+				return nil
+			}
+			duration := float64(*point.TopSet.DurationSeconds)
+			return &duration
+		}
+	}
+
+	first, _ := time.Parse(time.DateOnly, points[0].Date)
+	var days, values []float64
+	for _, point := range points {
+		if v := value(point); v != nil {
+			date, _ := time.Parse(time.DateOnly, point.Date)
+			days = append(days, date.Sub(first).Hours()/24)
+			values = append(values, *v)
+		}
+	}
+
+	slope, ok := linearSlope(days, values)
+	if !ok {
+		return ProgressTrend{Direction: trendInsufficientData}
+	}
+
+	slopePerWeek := store.RoundStat(slope * 7)
+	trend := ProgressTrend{Metric: &metric, SlopePerWeek: &slopePerWeek, Direction: trendStalling}
+	if average := mean(values); average > 0 {
+		switch rate := slope * 7 / average; {
+		case rate > stallingRate:
+			trend.Direction = trendImproving
+		case rate < -stallingRate:
+			trend.Direction = trendDeclining
+		}
+	}
+
+	return trend
+}
+
+// linearSlope returns the slope of the least squares line through the points,
+// which needs two of them at different x.
+func linearSlope(xs, ys []float64) (float64, bool) {
+	if len(xs) < 2 {
+		return 0, false
+	}
+
+	meanX, meanY := mean(xs), mean(ys)
+	var covariance, variance float64
+	for i := range xs {
+		covariance += (xs[i] - meanX) * (ys[i] - meanY)
+		variance += (xs[i] - meanX) * (xs[i] - meanX)
+	}
+	if variance == 0 {
+		return 0, false
+	}
+
+	return covariance / variance, true
+}
+
+func mean(values []float64) float64 {
+	sum := 0.0
+	for _, value := range values {
+		sum += value
+	}
+
+	return sum / float64(len(values))
+}
+
+func parseStatsQuery(r *http.Request, now time.Time, timeZone string) (store.StatsQuery, error) {
+	location := store.Location(timeZone)
+
+	values := r.URL.Query()
+
+	bucket := values.Get("bucket")
+	if bucket == "" {
+		bucket = store.StatsBucketWeek
+	}
+	if !slices.Contains(store.StatsBuckets, bucket) {
+		return store.StatsQuery{}, fmt.Errorf("bucket must be one of %v", store.StatsBuckets)
+	}
+
+	to, err := parseStatsDate(values.Get("to"), now.In(location).Format(time.DateOnly), location)
+	if err != nil {
+		return store.StatsQuery{}, errors.New("to must be a date")
+	}
+
+	var defaultFrom time.Time
+	switch bucket {
+	case store.StatsBucketDay:
+		defaultFrom = to.AddDate(0, 0, -29)
+	case store.StatsBucketWeek:
+		defaultFrom = to.AddDate(0, 0, -12*7+1)
+	case store.StatsBucketMonth:
+		defaultFrom = to.AddDate(-1, 0, 1)
+	}
+
+	from, err := parseStatsDate(values.Get("from"), defaultFrom.Format(time.DateOnly), location)
+	if err != nil {
+		return store.StatsQuery{}, errors.New("from must be a date")
+	}
+
+	if from.After(to) {
+		return store.StatsQuery{}, errors.New("from must not be after to")
+	}
+	if to.Sub(from) >= maxStatsWindowDays*24*time.Hour {
+		return store.StatsQuery{}, fmt.Errorf("the window must not be longer than %d days", maxStatsWindowDays)
+	}
+
+	return store.StatsQuery{From: from, To: to.AddDate(0, 0, 1), Bucket: bucket, TimeZone: location.String()}, nil
+}
+
+// parseStatsDate returns the start of the day value, or defaultValue if empty,
+// in location.
+func parseStatsDate(value, defaultValue string, location *time.Location) (time.Time, error) {
+	if value == "" {
+		value = defaultValue
+	}
+
+	return time.ParseInLocation(time.DateOnly, value, location)
+}
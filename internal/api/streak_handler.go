@@ -0,0 +1,43 @@
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"fem-go-crud/internal/middleware"
+	"fem-go-crud/internal/store"
+	"fem-go-crud/internal/utils"
+)
+
+type StreakHandler struct {
+	streakStore store.StreakStore
+	logger      *log.Logger
+}
+
+func NewStreakHandler(ss store.StreakStore, l *log.Logger) *StreakHandler {
+	return &StreakHandler{
+		streakStore: ss,
+		logger:      l,
+	}
+}
+
+// GetStreaks returns the daily and weekly streaks of the current user, as of
+// today in their time zone.
+func (sh *StreakHandler) GetStreaks(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+
+	streaks, err := sh.streakStore.GetStreaks(user.ID)
+	if err != nil {
+		sh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	if streaks == nil {
+		sh.logger.Printf("ERROR: user %d not found", user.ID)
+		_ = utils.WriteJSONResponse(w, http.StatusNotFound, utils.Envelope{"error": "not found"})
+		return
+	}
+
+	_ = utils.WriteJSONResponse(w, http.StatusOK, utils.Envelope{"streaks": streaks})
+}
@@ -0,0 +1,393 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"fem-go-crud/internal/middleware"
+	"fem-go-crud/internal/store"
+	"fem-go-crud/internal/utils"
+)
+
+// templatePayload is a template whose weights are in WeightUnit, or in
+// kilograms.
+type templatePayload struct {
+	store.WorkoutTemplate
+	WeightUnit string `json:"weight_unit"`
+}
+
+type TemplateHandler struct {
+	templateStore   store.TemplateStore
+	workoutStore    store.WorkoutStore
+	exerciseStore   store.ExerciseStore
+	enrollmentStore store.EnrollmentStore
+	txManager       store.TxManager
+	logger          *log.Logger
+}
+
+func NewTemplateHandler(ts store.TemplateStore, ws store.WorkoutStore, es store.ExerciseStore, ens store.EnrollmentStore, tm store.TxManager, l *log.Logger) *TemplateHandler {
+	return &TemplateHandler{
+		templateStore:   ts,
+		workoutStore:    ws,
+		exerciseStore:   es,
+		enrollmentStore: ens,
+		txManager:       tm,
+		logger:          l,
+	}
+}
+
+// ListTemplates returns the templates of the current user without their exercises.
+func (th *TemplateHandler) ListTemplates(w http.ResponseWriter, r *http.Request) {
+	templates, err := th.templateStore.ListTemplates(middleware.GetUser(r).ID)
+	if err != nil {
+		th.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	_ = utils.WriteJSONResponse(w, http.StatusOK, utils.Envelope{"templates": templates})
+}
+
+// GetTemplate returns a template of the current user, or of a program they
+// are enrolled in.
+func (th *TemplateHandler) GetTemplate(w http.ResponseWriter, r *http.Request) {
+	template, ok := th.getTemplate(w, r)
+	if !ok {
+		return
+	}
+
+	weightUnit := responseWeightUnit(w, r)
+	exercisesInUnit(template.Exercises, weightUnit)
+	_ = utils.WriteJSONResponse(w, http.StatusOK, utils.Envelope{"template": template, "weight_unit": weightUnit})
+}
+
+func (th *TemplateHandler) CreateTemplate(w http.ResponseWriter, r *http.Request) {
+	var payload templatePayload
+
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		th.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": "bad request"})
+		return
+	}
+
+	err = exercisesToKilograms(payload.Exercises, payload.WeightUnit)
+	if err != nil {
+		th.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	template := payload.WorkoutTemplate
+	template.ID = 0
+	template.UserID = middleware.GetUser(r).ID
+	th.saveTemplate(w, r, &template, http.StatusCreated)
+}
+
+// CreateTemplateFromWorkout creates a template with the fields and the
+// exercises of a workout of the current user.
+func (th *TemplateHandler) CreateTemplateFromWorkout(w http.ResponseWriter, r *http.Request) {
+	workoutID, err := utils.ParseIDParamFromURL(r, "workoutId")
+	if err != nil {
+		th.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": "bad request"})
+		return
+	}
+
+	workout, err := th.workoutStore.GetWorkout(workoutID)
+	if err != nil {
+		th.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	if workout == nil {
+		th.logger.Printf("ERROR: workout %d not found", workoutID)
+		_ = utils.WriteJSONResponse(w, http.StatusNotFound, utils.Envelope{"error": "not found"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	if workout.UserID != currentUser.ID {
+		th.logger.Printf("ERROR: user %d does not own workout %d", currentUser.ID, workoutID)
+		_ = utils.WriteJSONResponse(w, http.StatusForbidden, utils.Envelope{"error": "forbidden"})
+		return
+	}
+
+	template := store.WorkoutTemplate{
+		UserID:          currentUser.ID,
+		Name:            workout.Name,
+		Description:     workout.Description,
+		DurationMinutes: workout.DurationMinutes,
+		CaloriesBurned:  workout.CaloriesBurned,
+		Exercises:       copyExercisesAsNew(workout.Exercises),
+	}
+
+	th.saveTemplate(w, r, &template, http.StatusCreated)
+}
+
+// UpdateTemplate takes a partial template: the fields left out are kept, and
+// exercises, if set, replace all the exercises of the template.
+func (th *TemplateHandler) UpdateTemplate(w http.ResponseWriter, r *http.Request) {
+	existingTemplate, ok := th.getOwnTemplate(w, r)
+	if !ok {
+		return
+	}
+
+	payload := templatePayload{WorkoutTemplate: *existingTemplate}
+	payload.Exercises = nil
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		th.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": "bad request"})
+		return
+	}
+
+	err = exercisesToKilograms(payload.Exercises, payload.WeightUnit)
+	if err != nil {
+		th.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	template := payload.WorkoutTemplate
+	template.ID = existingTemplate.ID
+	template.UserID = existingTemplate.UserID
+	if template.Exercises == nil {
+		template.Exercises = copyExercisesAsNew(existingTemplate.Exercises)
+	}
+
+	th.saveTemplate(w, r, &template, http.StatusOK)
+}
+
+func (th *TemplateHandler) DeleteTemplate(w http.ResponseWriter, r *http.Request) {
+	template, ok := th.getOwnTemplate(w, r)
+	if !ok {
+		return
+	}
+
+	err := th.templateStore.DeleteTemplate(template.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		th.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusNotFound, utils.Envelope{"error": "not found"})
+		return
+	}
+	if errors.Is(err, store.ErrTemplateInUse) {
+		th.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusConflict, utils.Envelope{"error": "template is used by a program"})
+		return
+	}
+	if err != nil {
+		th.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// StartTemplate creates a workout pre-filled from a template of the current
+// user, or of a program they are enrolled in, which the workout keeps as its
+// template_id.
+func (th *TemplateHandler) StartTemplate(w http.ResponseWriter, r *http.Request) {
+	template, ok := th.getTemplate(w, r)
+	if !ok {
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	if template.UserID != currentUser.ID {
+		err := unlinkCustomExercises(th.exerciseStore, currentUser.ID, template.Exercises)
+		if err != nil {
+			th.logger.Printf("ERROR: %v", err)
+			_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+			return
+		}
+	}
+
+	workout := store.Workout{
+		UserID:          currentUser.ID,
+		TemplateID:      &template.ID,
+		Name:            template.Name,
+		Description:     template.Description,
+		DurationMinutes: template.DurationMinutes,
+		CaloriesBurned:  template.CaloriesBurned,
+		Exercises:       copyExercisesAsNew(template.Exercises),
+	}
+
+	err := th.txManager.WithinTx(func(stores *store.Stores) error {
+		return persistWorkouts(stores, []*store.Workout{&workout}, currentUser.ID)
+	})
+	if err != nil {
+		th.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	weightUnit := responseWeightUnit(w, r)
+	w.Header().Set("ETag", workoutETag(&workout, weightUnit))
+	workoutInUnit(&workout, weightUnit)
+	_ = utils.WriteJSONResponse(w, http.StatusCreated, utils.Envelope{"workout": workout, "personal_records": workout.NewRecords, "weight_unit": weightUnit})
+}
+
+// saveTemplate validates and stores a new template, or an existing one if it
+// has an id, and writes it with status.
+func (th *TemplateHandler) saveTemplate(w http.ResponseWriter, r *http.Request, template *store.WorkoutTemplate, status int) {
+	err := linkExercises(th.exerciseStore, template.UserID, template.Exercises)
+	if errors.Is(err, errUnknownExercise) {
+		th.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		th.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	err = validateTemplate(template)
+	if err != nil {
+		th.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	if template.ID == 0 {
+		err = th.templateStore.CreateTemplate(template)
+	} else {
+		err = th.templateStore.UpdateTemplate(template)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		th.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusNotFound, utils.Envelope{"error": "not found"})
+		return
+	}
+	if err != nil {
+		th.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	weightUnit := responseWeightUnit(w, r)
+	exercisesInUnit(template.Exercises, weightUnit)
+	_ = utils.WriteJSONResponse(w, status, utils.Envelope{"template": template, "weight_unit": weightUnit})
+}
+
+// getOwnTemplate loads the template of the templateId URL parameter and checks
+// the current user owns it, writing the error response if not.
+func (th *TemplateHandler) getOwnTemplate(w http.ResponseWriter, r *http.Request) (*store.WorkoutTemplate, bool) {
+	return th.loadTemplate(w, r, false)
+}
+
+// getTemplate is getOwnTemplate that also accepts the templates of the
+// programs the current user is enrolled in.
+func (th *TemplateHandler) getTemplate(w http.ResponseWriter, r *http.Request) (*store.WorkoutTemplate, bool) {
+	return th.loadTemplate(w, r, true)
+}
+
+func (th *TemplateHandler) loadTemplate(w http.ResponseWriter, r *http.Request, allowEnrolled bool) (*store.WorkoutTemplate, bool) {
+	templateID, err := utils.ParseIDParamFromURL(r, "templateId")
+	if err != nil {
+		th.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": "bad request"})
+		return nil, false
+	}
+
+	template, err := th.templateStore.GetTemplate(templateID)
+	if err != nil {
+		th.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return nil, false
+	}
+
+	if template == nil {
+		th.logger.Printf("ERROR: template %d not found", templateID)
+		_ = utils.WriteJSONResponse(w, http.StatusNotFound, utils.Envelope{"error": "not found"})
+		return nil, false
+	}
+
+	currentUser := middleware.GetUser(r)
+	if template.UserID == currentUser.ID {
+		return template, true
+	}
+
+	enrolled := false
+	if allowEnrolled {
+		enrolled, err = th.enrollmentStore.IsEnrolledWithTemplate(currentUser.ID, templateID)
+		if err != nil {
+			th.logger.Printf("ERROR: %v", err)
+			_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+			return nil, false
+		}
+	}
+
+	if !enrolled {
+		th.logger.Printf("ERROR: user %d cannot access template %d", currentUser.ID, templateID)
+		_ = utils.WriteJSONResponse(w, http.StatusForbidden, utils.Envelope{"error": "forbidden"})
+		return nil, false
+	}
+
+	return template, true
+}
+
+// validateTemplate checks a template like the workouts started from it would be.
+func validateTemplate(template *store.WorkoutTemplate) error {
+	return validateWorkout(&store.Workout{
+		Name:            template.Name,
+		Description:     template.Description,
+		DurationMinutes: template.DurationMinutes,
+		CaloriesBurned:  template.CaloriesBurned,
+		Exercises:       template.Exercises,
+	})
+}
+
+// copyExercisesAsNew copies exercises without their ids and timestamps, so that
+// they can be stored in another workout or template.
+// unlinkCustomExercises unlinks the exercises linked to the custom exercises
+// of other users than userID, which keep their name.
+func unlinkCustomExercises(exerciseStore store.ExerciseStore, userID int, exercises []store.WorkoutExercise) error {
+	var exerciseIDs []int
+	for _, exercise := range exercises {
+		if exercise.ExerciseID != nil {
+			exerciseIDs = append(exerciseIDs, *exercise.ExerciseID)
+		}
+	}
+
+	if len(exerciseIDs) == 0 {
+		return nil
+	}
+
+	linkedExercises, err := exerciseStore.GetExercises(exerciseIDs)
+	if err != nil {
+		return err
+	}
+
+	private := make(map[int]bool, len(linkedExercises))
+	for _, exercise := range linkedExercises {
+		private[exercise.ID] = exercise.UserID != nil && *exercise.UserID != userID
+	}
+
+	for i := range exercises {
+		if exercises[i].ExerciseID != nil && private[*exercises[i].ExerciseID] {
+			exercises[i].ExerciseID = nil
+		}
+	}
+
+	return nil
+}
+
+func copyExercisesAsNew(exercises []store.WorkoutExercise) []store.WorkoutExercise {
+	exercisesCopy := make([]store.WorkoutExercise, len(exercises))
+	for i, exercise := range exercises {
+		exercise.ID = 0
+		exercise.CreatedAt = time.Time{}
+		exercise.UpdatedAt = time.Time{}
+		exercisesCopy[i] = exercise
+	}
+
+	return exercisesCopy
+}
@@ -0,0 +1,166 @@
+package api
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"net/http"
+	"slices"
+
+	"fem-go-crud/internal/middleware"
+	"fem-go-crud/internal/store"
+)
+
+// Weights are stored in kilograms and lengths in centimeters.
+const (
+	unitKilogram   = "kg"
+	unitPound      = "lb"
+	unitCentimeter = "cm"
+	unitInch       = "in"
+)
+
+// acceptUnitsHeader picks the unit system of the weights of a response, over
+// the preference of the current user.
+const acceptUnitsHeader = "Accept-Units"
+
+// weightUnits and lengthUnits hold the canonical amount of a unit.
+var (
+	weightUnits = map[string]float64{unitKilogram: 1, unitPound: 0.45359237}
+	lengthUnits = map[string]float64{unitCentimeter: 1, unitInch: 2.54}
+)
+
+// toCanonical converts value from unit, one of units, to the canonical unit,
+// rounded to places decimals like the column that stores it. An empty unit is
+// the canonical one.
+func toCanonical(value *float64, unit string, units map[string]float64, places int) (*float64, error) {
+	factor, err := unitFactor(unit, units)
+	if err != nil || value == nil {
+		return nil, err
+	}
+
+	canonical := roundTo(*value*factor, places)
+	return &canonical, nil
+}
+
+func unitFactor(unit string, units map[string]float64) (float64, error) {
+	if unit == "" {
+		return 1, nil
+	}
+
+	factor, ok := units[unit]
+	if !ok {
+		return 0, fmt.Errorf("unit must be one of %v", slices.Sorted(maps.Keys(units)))
+	}
+
+	return factor, nil
+}
+
+func roundTo(value float64, places int) float64 {
+	scale := math.Pow(10, float64(places))
+	return math.Round(value*scale) / scale
+}
+
+// weightUnitOf returns the unit of the weights of a unit system.
+func weightUnitOf(unitSystem string) string {
+	if unitSystem == store.UnitSystemImperial {
+		return unitPound
+	}
+
+	return unitKilogram
+}
+
+// responseLengthUnit returns the unit of the lengths of a response whose
+// weights are in weightUnit.
+func responseLengthUnit(weightUnit string) string {
+	if weightUnit == unitPound {
+		return unitInch
+	}
+
+	return unitCentimeter
+}
+
+// responseWeightUnit returns the unit of the weights of the response to r,
+// which responses state in their weight_unit field.
+func responseWeightUnit(w http.ResponseWriter, r *http.Request) string {
+	if !slices.Contains(w.Header().Values("Vary"), acceptUnitsHeader) {
+		w.Header().Add("Vary", acceptUnitsHeader)
+	}
+
+	unitSystem := r.Header.Get(acceptUnitsHeader)
+	if !slices.Contains(store.UnitSystems, unitSystem) {
+		unitSystem = middleware.GetUser(r).UnitSystem
+	}
+
+	return weightUnitOf(unitSystem)
+}
+
+// fromCanonical converts value from the canonical unit to unit, one of units,
+// to the hundredth.
+func fromCanonical(value *float64, unit string, units map[string]float64) *float64 {
+	if value == nil || units[unit] == 1 {
+		return value
+	}
+
+	converted := roundTo(*value/units[unit], 2)
+	return &converted
+}
+
+// fromKilograms converts a weight to unit, to the hundredth of a pound.
+func fromKilograms(weight *float64, unit string) *float64 {
+	return fromCanonical(weight, unit, weightUnits)
+}
+
+// weightInUnit converts a weight, or a volume load, to unit.
+func weightInUnit(weight float64, unit string) float64 {
+	return *fromKilograms(&weight, unit)
+}
+
+// exercisesToKilograms converts the weights of exercises, and of their sets,
+// from unit, the weight_unit of a payload, to kilograms.
+func exercisesToKilograms(exercises []store.WorkoutExercise, unit string) error {
+	for i := range exercises {
+		exercise := &exercises[i]
+
+		var err error
+		exercise.Weight, err = toCanonical(exercise.Weight, unit, weightUnits, 3)
+		if err != nil {
+			return fmt.Errorf("weight_%w", err)
+		}
+
+		for j := range exercise.WorkoutSets {
+			exercise.WorkoutSets[j].Weight, _ = toCanonical(exercise.WorkoutSets[j].Weight, unit, weightUnits, 3)
+		}
+	}
+
+	return nil
+}
+
+// exerciseInUnit converts the weights of an exercise, and of its sets, to unit.
+func exerciseInUnit(exercise *store.WorkoutExercise, unit string) {
+	exercise.Weight = fromKilograms(exercise.Weight, unit)
+	for i := range exercise.WorkoutSets {
+		exercise.WorkoutSets[i].Weight = fromKilograms(exercise.WorkoutSets[i].Weight, unit)
+	}
+}
+
+func exercisesInUnit(exercises []store.WorkoutExercise, unit string) {
+	for i := range exercises {
+		exerciseInUnit(&exercises[i], unit)
+	}
+}
+
+func workoutInUnit(workout *store.Workout, unit string) {
+	exercisesInUnit(workout.Exercises, unit)
+	recordsInUnit(workout.NewRecords, unit)
+}
+
+func recordsInUnit(records []store.PersonalRecord, unit string) {
+	for i := range records {
+		record := &records[i]
+		record.Weight = fromKilograms(record.Weight, unit)
+		if slices.Contains(store.WeightRecordTypes, record.RecordType) {
+			record.Value = *fromKilograms(&record.Value, unit)
+			record.PreviousValue = fromKilograms(record.PreviousValue, unit)
+		}
+	}
+}
@@ -3,30 +3,44 @@ package api
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"regexp"
+	"slices"
+	"time"
 
+	"fem-go-crud/internal/auth"
+	"fem-go-crud/internal/middleware"
 	"fem-go-crud/internal/store"
 	"fem-go-crud/internal/utils"
 )
 
 type UserHandler struct {
 	userStore store.UserStore
+	txManager store.TxManager
 	logger    *log.Logger
 }
 
-func NewUserHandler(us store.UserStore, l *log.Logger) *UserHandler {
+func NewUserHandler(us store.UserStore, tm store.TxManager, l *log.Logger) *UserHandler {
 	return &UserHandler{
 		userStore: us,
+		txManager: tm,
 		logger:    l,
 	}
 }
 
+// maxBodyWeightKg bounds the body weight of the profiles.
+const maxBodyWeightKg = 500
+
 type registerUserPayload struct {
-	Username string `json:"username"`
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Username       string   `json:"username"`
+	Email          string   `json:"email"`
+	Password       string   `json:"password"`
+	BodyWeightKg   *float64 `json:"body_weight_kg"`
+	UnitSystem     string   `json:"unit_system"`
+	TimeZone       string   `json:"time_zone"`
+	StreakRestDays int      `json:"streak_rest_days"`
 }
 
 func (uh *UserHandler) validateRegisterUserPayload(payload *registerUserPayload) error {
@@ -49,16 +63,84 @@ func (uh *UserHandler) validateRegisterUserPayload(payload *registerUserPayload)
 		return errors.New("invalid email")
 	}
 
-	if payload.Password == "" {
+	err := validateBodyWeight(payload.BodyWeightKg)
+	if err != nil {
+		return err
+	}
+
+	if payload.UnitSystem != "" {
+		err = validateUnitSystem(payload.UnitSystem)
+		if err != nil {
+			return err
+		}
+	}
+
+	if payload.TimeZone != "" {
+		err = validateTimeZone(payload.TimeZone)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = validateStreakRestDays(payload.StreakRestDays)
+	if err != nil {
+		return err
+	}
+
+	return validatePassword(payload.Password)
+}
+
+func validateUnitSystem(unitSystem string) error {
+	if !slices.Contains(store.UnitSystems, unitSystem) {
+		return fmt.Errorf("unit_system must be one of %v", store.UnitSystems)
+	}
+
+	return nil
+}
+
+// validateTimeZone accepts the IANA time zones, but not Local, which is the
+// zone of the server rather than of the user.
+func validateTimeZone(timeZone string) error {
+	_, err := time.LoadLocation(timeZone)
+	if timeZone == "" || timeZone == "Local" || err != nil {
+		return errors.New("time_zone must be an IANA time zone, such as Europe/Paris")
+	}
+
+	return nil
+}
+
+// userToday returns the date it is in the time zone of a user.
+func userToday(user *store.User) string {
+	return time.Now().In(store.Location(user.TimeZone)).Format(time.DateOnly)
+}
+
+func validateStreakRestDays(restDays int) error {
+	if restDays < 0 || restDays > store.MaxStreakRestDays {
+		return fmt.Errorf("streak_rest_days must be between 0 and %d", store.MaxStreakRestDays)
+	}
+
+	return nil
+}
+
+func validateBodyWeight(bodyWeightKg *float64) error {
+	if bodyWeightKg != nil && (*bodyWeightKg <= 0 || *bodyWeightKg > maxBodyWeightKg) {
+		return fmt.Errorf("body_weight_kg must be greater than 0 and at most %d", maxBodyWeightKg)
+	}
+
+	return nil
+}
+
+func validatePassword(password string) error {
+	if password == "" {
 		return errors.New("missing password")
 	}
-	if len(payload.Password) < 8 || len(payload.Password) > 100 {
+	if len(password) < 8 || len(password) > 100 {
 		return errors.New("invalid password length")
 	}
 	// simple password validation, for demo purposes only
 	passwordRegex := `^(.*[0-9])`
 	passwordRegexCheck := regexp.MustCompile(passwordRegex)
-	if !passwordRegexCheck.MatchString(payload.Password) {
+	if !passwordRegexCheck.MatchString(password) {
 		return errors.New("invalid password")
 	}
 
@@ -79,11 +161,16 @@ func (uh *UserHandler) RegisterUser(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		uh.logger.Printf("ERROR: %v", err)
 		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
 	}
 
 	user := store.User{
-		Username: payload.Username,
-		Email:    payload.Email,
+		Username:       payload.Username,
+		Email:          payload.Email,
+		BodyWeightKg:   payload.BodyWeightKg,
+		UnitSystem:     payload.UnitSystem,
+		TimeZone:       payload.TimeZone,
+		StreakRestDays: payload.StreakRestDays,
 	}
 
 	err = user.Password.Set(payload.Password)
@@ -108,6 +195,7 @@ func (uh *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		uh.logger.Printf("ERROR: %v", err)
 		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": "bad request"})
+		return
 	}
 
 	user, err := uh.userStore.GetUserByIdOrUsername(userID, "")
@@ -123,5 +211,212 @@ func (uh *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// the profile is private
+	if user.ID != middleware.GetUser(r).ID {
+		user.BodyWeightKg = nil
+		user.LegacyWeightsBefore = nil
+		user.TimeZone = ""
+	}
+
+	_ = utils.WriteJSONResponse(w, http.StatusOK, utils.Envelope{"user": user})
+}
+
+type updateProfilePayload struct {
+	BodyWeightKg   *float64 `json:"body_weight_kg"`
+	UnitSystem     string   `json:"unit_system"`
+	TimeZone       string   `json:"time_zone"`
+	StreakRestDays int      `json:"streak_rest_days"`
+}
+
+// UpdateCurrentUser sets the profile of the current user. The fields left out
+// are kept, and a null body_weight_kg clears the body weight, which stops the
+// estimation of calories. unit_system picks the units of the responses, and
+// time_zone the days the streaks count workouts in.
+func (uh *UserHandler) UpdateCurrentUser(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+	user, err := uh.userStore.GetUserByIdOrUsername(currentUser.ID, "")
+	if err != nil || user == nil {
+		uh.logger.Printf("ERROR: failed to load user %d: %v", currentUser.ID, err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	payload := updateProfilePayload{
+		BodyWeightKg:   user.BodyWeightKg,
+		UnitSystem:     user.UnitSystem,
+		TimeZone:       user.TimeZone,
+		StreakRestDays: user.StreakRestDays,
+	}
+	err = json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		uh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": "bad request"})
+		return
+	}
+
+	err = validateBodyWeight(payload.BodyWeightKg)
+	if err == nil {
+		err = validateUnitSystem(payload.UnitSystem)
+	}
+	if err == nil {
+		err = validateTimeZone(payload.TimeZone)
+	}
+	if err == nil {
+		err = validateStreakRestDays(payload.StreakRestDays)
+	}
+	if err != nil {
+		uh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	user.BodyWeightKg = payload.BodyWeightKg
+	user.UnitSystem = payload.UnitSystem
+	user.TimeZone = payload.TimeZone
+	user.StreakRestDays = payload.StreakRestDays
+	err = uh.userStore.UpdateUser(user)
+	if err != nil {
+		uh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
 	_ = utils.WriteJSONResponse(w, http.StatusOK, utils.Envelope{"user": user})
 }
+
+// ResolveLegacyWeights takes the unit the current user recorded their weights
+// in before weights had units, and converts those weights to kilograms.
+func (uh *UserHandler) ResolveLegacyWeights(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Unit string `json:"unit"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		uh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": "bad request"})
+		return
+	}
+
+	kgPerUnit, err := unitFactor(payload.Unit, weightUnits)
+	if err == nil && payload.Unit == "" {
+		err = errors.New("unit is required")
+	}
+	if err != nil {
+		uh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	err = uh.userStore.ResolveLegacyWeights(middleware.GetUser(r).ID, kgPerUnit)
+	if errors.Is(err, store.ErrNoLegacyWeights) {
+		uh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusConflict, utils.Envelope{"error": "no legacy weights to resolve"})
+		return
+	}
+	if err != nil {
+		uh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type changePasswordPayload struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// ChangePassword sets a new password and revokes every authentication token of
+// the current user, and the URL of their calendar feed, in a single
+// transaction, so no session outlives the old password.
+func (uh *UserHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	var payload changePasswordPayload
+
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		uh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": "bad request"})
+		return
+	}
+
+	err = validatePassword(payload.NewPassword)
+	if err != nil {
+		uh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	user, err := uh.userStore.GetUserByIdOrUsername(currentUser.ID, "")
+	if err != nil || user == nil {
+		uh.logger.Printf("ERROR: failed to load user %d: %v", currentUser.ID, err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	passwordMatches, err := user.Password.Matches(payload.CurrentPassword)
+	if err != nil {
+		uh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	if !passwordMatches {
+		uh.logger.Printf("ERROR: invalid current password for user %d", user.ID)
+		_ = utils.WriteJSONResponse(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
+		return
+	}
+
+	err = user.Password.Set(payload.NewPassword)
+	if err != nil {
+		uh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	err = uh.txManager.WithinTx(func(stores *store.Stores) error {
+		err := stores.Users.UpdatePassword(user)
+		if err != nil {
+			return err
+		}
+
+		err = stores.Tokens.RevokeTokensForUser(user.ID, auth.TokenScopeAuth)
+		if err != nil {
+			return err
+		}
+
+		// the calendar feed goes too, in case the password leaked
+		return stores.Tokens.RevokeTokensForUser(user.ID, auth.TokenScopeCalendar)
+	})
+	if err != nil {
+		uh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteCurrentUser removes the current user together with their tokens and data.
+func (uh *UserHandler) DeleteCurrentUser(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	err := uh.txManager.WithinTx(func(stores *store.Stores) error {
+		err := stores.Tokens.RevokeTokensForUser(currentUser.ID, auth.TokenScopeAuth)
+		if err != nil {
+			return err
+		}
+
+		// workouts and any other user data are removed by the users foreign keys
+		return stores.Users.DeleteUser(currentUser.ID)
+	})
+	if err != nil {
+		uh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,440 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"fem-go-crud/internal/middleware"
+	"fem-go-crud/internal/store"
+	"fem-go-crud/internal/utils"
+)
+
+const maxBatchOperations = 500
+
+const (
+	// in atomic mode the whole batch is applied in one transaction, or not at all
+	batchModeAtomic = "atomic"
+	// in best effort mode every operation is applied on its own
+	batchModeBestEffort = "best_effort"
+)
+
+const (
+	batchOpCreate = "create"
+	batchOpUpdate = "update"
+	batchOpDelete = "delete"
+)
+
+// batchOperation creates a workout, or updates or deletes the workout ID. An
+// update takes the same partial workout as PUT, and Version, if set, is
+// checked like an If-Match header would be. Workouts take their weights in
+// their weight_unit, like the workouts of POST and PUT.
+type batchOperation struct {
+	Op      string          `json:"op"`
+	ID      int             `json:"id"`
+	Version int             `json:"version"`
+	Workout json.RawMessage `json:"workout"`
+
+	create *store.Workout
+	update *workoutUpdate
+}
+
+type batchResult struct {
+	Index           int                    `json:"index"`
+	Op              string                 `json:"op"`
+	Status          int                    `json:"status"`
+	Workout         *store.Workout         `json:"workout,omitempty"`
+	PersonalRecords []store.PersonalRecord `json:"personal_records,omitempty"`
+	Error           string                 `json:"error,omitempty"`
+}
+
+// batchError is the outcome of an operation that failed.
+type batchError struct {
+	status  int
+	message string
+}
+
+func (be *batchError) Error() string {
+	return be.message
+}
+
+// BatchWorkouts applies up to maxBatchOperations create, update and delete
+// operations. All the creations are inserted together, then the other
+// operations are applied in order. Every operation gets a result.
+func (wh *WorkoutHandler) BatchWorkouts(w http.ResponseWriter, r *http.Request) {
+	var batchPayload struct {
+		Mode       string           `json:"mode"`
+		Operations []batchOperation `json:"operations"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&batchPayload)
+	if err != nil {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": "bad request"})
+		return
+	}
+
+	if batchPayload.Mode == "" {
+		batchPayload.Mode = batchModeAtomic
+	}
+	if batchPayload.Mode != batchModeAtomic && batchPayload.Mode != batchModeBestEffort {
+		wh.logger.Printf("ERROR: unknown batch mode %q", batchPayload.Mode)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": "mode must be atomic or best_effort"})
+		return
+	}
+
+	operations := batchPayload.Operations
+	if len(operations) == 0 || len(operations) > maxBatchOperations {
+		wh.logger.Printf("ERROR: batch of %d operations", len(operations))
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": fmt.Sprintf("a batch takes 1 to %d operations", maxBatchOperations)})
+		return
+	}
+
+	results := make([]batchResult, len(operations))
+	failed := false
+	for i := range operations {
+		results[i] = batchResult{Index: i, Op: operations[i].Op}
+
+		err = wh.prepareBatchOperation(&operations[i], middleware.GetUser(r))
+		var operationErr *batchError
+		if errors.As(err, &operationErr) {
+			wh.logger.Printf("ERROR: %v", err)
+			results[i].Status = operationErr.status
+			results[i].Error = "failed"
+			failed = true
+		} else if err != nil {
+			results[i].Status = http.StatusBadRequest
+			results[i].Error = err.Error()
+			failed = true
+		}
+	}
+
+	if batchPayload.Mode == batchModeAtomic {
+		if !failed {
+			failed = wh.applyBatchAtomically(operations, results, middleware.GetUser(r).ID)
+		}
+
+		if failed {
+			_ = utils.WriteJSONResponse(w, batchFailureStatus(results), utils.Envelope{"error": "batch failed", "results": notAppliedResults(results)})
+			return
+		}
+
+		weightUnit := responseWeightUnit(w, r)
+		batchResultsInUnit(results, weightUnit)
+		_ = utils.WriteJSONResponse(w, http.StatusOK, utils.Envelope{"results": results, "weight_unit": weightUnit})
+		return
+	}
+
+	wh.applyBatchBestEffort(operations, results, middleware.GetUser(r).ID)
+	weightUnit := responseWeightUnit(w, r)
+	batchResultsInUnit(results, weightUnit)
+	_ = utils.WriteJSONResponse(w, http.StatusOK, utils.Envelope{"results": results, "weight_unit": weightUnit})
+}
+
+// batchResultsInUnit converts the workouts of results, and the records they
+// set, to unit.
+func batchResultsInUnit(results []batchResult, unit string) {
+	for i := range results {
+		if results[i].Workout != nil {
+			// the personal records of a result are the new records of its workout
+			workoutInUnit(results[i].Workout, unit)
+		}
+	}
+}
+
+// applyBatchAtomically applies every operation in one transaction and reports
+// whether it failed, in which case nothing was applied.
+func (wh *WorkoutHandler) applyBatchAtomically(operations []batchOperation, results []batchResult, actorID int) bool {
+	err := wh.txManager.WithinTx(func(stores *store.Stores) error {
+		// the transaction can be retried, so results are only kept from the last attempt
+		for i := range results {
+			results[i] = batchResult{Index: i, Op: operations[i].Op}
+		}
+
+		err := applyBatchCreates(stores, operations, results, actorID)
+		if err != nil {
+			return err
+		}
+
+		for i := range operations {
+			if operations[i].Op == batchOpCreate {
+				continue
+			}
+
+			err = applyBatchOperation(stores, &operations[i], &results[i], actorID)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		wh.recordBatchError(err, operations, results)
+		return true
+	}
+
+	return false
+}
+
+// applyBatchBestEffort inserts the creations together, then applies every
+// other operation in its own transaction. If the creations fail together,
+// each is inserted again in its own transaction, so that one that the
+// database rejects does not fail the others.
+func (wh *WorkoutHandler) applyBatchBestEffort(operations []batchOperation, results []batchResult, actorID int) {
+	err := wh.txManager.WithinTx(func(stores *store.Stores) error {
+		return applyBatchCreates(stores, operations, results, actorID)
+	})
+	if err != nil {
+		wh.logger.Printf("ERROR: %v", err)
+
+		for i := range operations {
+			if operations[i].Op == batchOpCreate && results[i].Status < http.StatusBadRequest {
+				results[i] = batchResult{Index: i, Op: operations[i].Op}
+			}
+		}
+
+		for i := range operations {
+			if operations[i].Op != batchOpCreate || results[i].Status != 0 {
+				continue
+			}
+
+			err = wh.txManager.WithinTx(func(stores *store.Stores) error {
+				return applyBatchCreates(stores, operations[i:i+1], results[i:i+1], actorID)
+			})
+			if err != nil {
+				wh.recordBatchError(err, operations[i:i+1], results[i:i+1])
+			}
+		}
+	}
+
+	for i := range operations {
+		if operations[i].Op == batchOpCreate || results[i].Status != 0 {
+			continue
+		}
+
+		err = wh.txManager.WithinTx(func(stores *store.Stores) error {
+			return applyBatchOperation(stores, &operations[i], &results[i], actorID)
+		})
+		if err != nil {
+			wh.recordBatchError(err, operations[i:i+1], results[i:i+1])
+		}
+	}
+}
+
+// recordBatchError sets the result of the operation that failed with err. An
+// unexpected error fails every operation that has no result yet.
+func (wh *WorkoutHandler) recordBatchError(err error, operations []batchOperation, results []batchResult) {
+	var operationErr *batchError
+	if errors.As(err, &operationErr) {
+		return
+	}
+
+	wh.logger.Printf("ERROR: %v", err)
+	for i := range results {
+		if results[i].Status == 0 || results[i].Status < http.StatusBadRequest && operations[i].Op == batchOpCreate {
+			results[i] = batchResult{Index: results[i].Index, Op: operations[i].Op, Status: http.StatusInternalServerError, Error: "failed"}
+		}
+	}
+}
+
+// prepareBatchOperation decodes and validates an operation. It returns a
+// *batchError if the operation could not be checked.
+func (wh *WorkoutHandler) prepareBatchOperation(operation *batchOperation, user *store.User) error {
+	userID := user.ID
+	switch operation.Op {
+	case batchOpCreate:
+		var payload workoutPayload
+		err := json.Unmarshal(operation.Workout, &payload)
+		if err != nil {
+			return errors.New("invalid workout")
+		}
+
+		workout := payload.Workout
+		err = exercisesToKilograms(workout.Exercises, payload.WeightUnit)
+		if err != nil {
+			return err
+		}
+
+		err = wh.prepareBatchExercises(workout.Exercises, userID)
+		if err != nil {
+			return err
+		}
+
+		err = validateWorkout(&workout)
+		if err != nil {
+			return err
+		}
+
+		workout.UserID = userID
+		workout.TemplateID = nil
+
+		err = estimateCalories(wh.exerciseStore, wh.measurementStore, &workout, user)
+		if err != nil {
+			return &batchError{status: http.StatusInternalServerError, message: err.Error()}
+		}
+
+		operation.create = &workout
+		return nil
+
+	case batchOpUpdate:
+		if operation.ID <= 0 {
+			return errors.New("id is required")
+		}
+
+		var update workoutUpdate
+		err := json.Unmarshal(operation.Workout, &update)
+		if err != nil {
+			return errors.New("invalid workout")
+		}
+
+		err = exercisesToKilograms(update.Exercises, update.WeightUnit)
+		if err != nil {
+			return err
+		}
+
+		err = wh.prepareBatchExercises(update.Exercises, userID)
+		if err != nil {
+			return err
+		}
+
+		operation.update = &update
+		return nil
+
+	case batchOpDelete:
+		if operation.ID <= 0 {
+			return errors.New("id is required")
+		}
+		return nil
+
+	default:
+		return errors.New("op must be create, update or delete")
+	}
+}
+
+// prepareBatchExercises links the exercises of an operation, telling a failed
+// lookup apart from an invalid exercise_id.
+func (wh *WorkoutHandler) prepareBatchExercises(exercises []store.WorkoutExercise, userID int) error {
+	err := linkExercises(wh.exerciseStore, userID, exercises)
+	if err != nil && !errors.Is(err, errUnknownExercise) {
+		return &batchError{status: http.StatusInternalServerError, message: err.Error()}
+	}
+
+	return err
+}
+
+func applyBatchCreates(stores *store.Stores, operations []batchOperation, results []batchResult, actorID int) error {
+	var workouts []*store.Workout
+	var created []int
+	for i := range operations {
+		if operations[i].Op == batchOpCreate && results[i].Status == 0 {
+			// a copy, so that a retried transaction starts from the payload again
+			workout := *operations[i].create
+			workout.Exercises = append([]store.WorkoutExercise(nil), workout.Exercises...)
+
+			workouts = append(workouts, &workout)
+			created = append(created, i)
+		}
+	}
+
+	if len(workouts) == 0 {
+		return nil
+	}
+
+	err := persistWorkouts(stores, workouts, actorID)
+	if err != nil {
+		return err
+	}
+
+	for j, i := range created {
+		results[i].Status = http.StatusCreated
+		results[i].Workout = workouts[j]
+		results[i].PersonalRecords = workouts[j].NewRecords
+	}
+
+	return nil
+}
+
+// applyBatchOperation applies an update or a delete. A failure sets the result
+// and is returned as a *batchError.
+func applyBatchOperation(stores *store.Stores, operation *batchOperation, result *batchResult, actorID int) error {
+	fail := func(status int, message string) error {
+		result.Status = status
+		result.Error = message
+		return &batchError{status: status, message: fmt.Sprintf("operation %d: %s", result.Index, message)}
+	}
+
+	workout, err := stores.Workouts.GetWorkout(operation.ID)
+	if err != nil {
+		return err
+	}
+	if workout == nil {
+		return fail(http.StatusNotFound, "not found")
+	}
+	if workout.UserID != actorID {
+		return fail(http.StatusForbidden, "forbidden")
+	}
+	if operation.Version != 0 && operation.Version != workout.Version {
+		return fail(http.StatusConflict, "conflict")
+	}
+
+	if operation.Op == batchOpDelete {
+		err = deleteWorkout(stores, operation.ID, workout.Version, actorID)
+		if err != nil {
+			return err
+		}
+
+		result.Status = http.StatusNoContent
+		return nil
+	}
+
+	operation.update.apply(workout)
+	err = validateWorkout(workout)
+	if err != nil {
+		return fail(http.StatusBadRequest, err.Error())
+	}
+
+	err = stores.Workouts.UpdateWorkout(workout)
+	if errors.Is(err, store.ErrVersionConflict) || errors.Is(err, sql.ErrNoRows) {
+		return fail(http.StatusConflict, "conflict")
+	}
+	if err != nil {
+		return err
+	}
+
+	err = recordWorkoutRevision(stores, workout.ID, actorID, store.WorkoutRevisionUpdate)
+	if err != nil {
+		return err
+	}
+
+	result.Status = http.StatusOK
+	result.Workout = workout
+	result.PersonalRecords = workout.NewRecords
+	return nil
+}
+
+// notAppliedResults marks the operations of a failed atomic batch that did not
+// fail themselves as not applied.
+func notAppliedResults(results []batchResult) []batchResult {
+	for i := range results {
+		if results[i].Status < http.StatusBadRequest {
+			results[i] = batchResult{Index: results[i].Index, Op: results[i].Op, Status: http.StatusFailedDependency, Error: "not applied"}
+		}
+	}
+
+	return results
+}
+
+// batchFailureStatus is the status of a failed atomic batch: a server error if
+// one of the operations hit one, unprocessable otherwise.
+func batchFailureStatus(results []batchResult) int {
+	for _, result := range results {
+		if result.Status >= http.StatusInternalServerError {
+			return http.StatusInternalServerError
+		}
+	}
+
+	return http.StatusUnprocessableEntity
+}
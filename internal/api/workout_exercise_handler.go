@@ -0,0 +1,389 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+
+	"fem-go-crud/internal/middleware"
+	"fem-go-crud/internal/store"
+	"fem-go-crud/internal/utils"
+)
+
+func (wh *WorkoutHandler) AddWorkoutExercise(w http.ResponseWriter, r *http.Request) {
+	workoutID, ok := wh.authorizeWorkout(w, r)
+	if !ok {
+		return
+	}
+
+	exercise, ok := wh.decodeWorkoutExercise(w, r)
+	if !ok {
+		return
+	}
+
+	exercises := []store.WorkoutExercise{exercise}
+	err := linkExercises(wh.exerciseStore, middleware.GetUser(r).ID, exercises)
+	if errors.Is(err, errUnknownExercise) {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+	exercise = exercises[0]
+
+	err = validateWorkoutExercise(&exercise)
+	if err != nil {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	version, ok := wh.workoutPrecondition(w, r, workoutID)
+	if !ok {
+		return
+	}
+
+	workout, err := wh.changeWorkoutExercises(workoutID, middleware.GetUser(r).ID, version, func(workouts store.WorkoutStore) error {
+		return workouts.AddWorkoutExercise(workoutID, &exercise)
+	})
+	if errors.Is(err, store.ErrVersionConflict) {
+		wh.logger.Printf("ERROR: %v", err)
+		writeVersionConflict(w, r.Header.Get("If-Match"))
+		return
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusNotFound, utils.Envelope{"error": "not found"})
+		return
+	}
+	if err != nil {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	weightUnit := responseWeightUnit(w, r)
+	w.Header().Set("ETag", workoutETag(workout, weightUnit))
+	exerciseInUnit(&exercise, weightUnit)
+	_ = utils.WriteJSONResponse(w, http.StatusCreated, utils.Envelope{"exercise": exercise, "weight_unit": weightUnit})
+}
+
+func (wh *WorkoutHandler) UpdateWorkoutExercise(w http.ResponseWriter, r *http.Request) {
+	workoutID, ok := wh.authorizeWorkout(w, r)
+	if !ok {
+		return
+	}
+
+	exerciseID, err := utils.ParseIDParamFromURL(r, "exerciseId")
+	if err != nil {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": "bad request"})
+		return
+	}
+
+	exercise, ok := wh.decodeWorkoutExercise(w, r)
+	if !ok {
+		return
+	}
+	exercise.ID = exerciseID
+
+	exercises := []store.WorkoutExercise{exercise}
+	err = linkExercises(wh.exerciseStore, middleware.GetUser(r).ID, exercises)
+	if errors.Is(err, errUnknownExercise) {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+	exercise = exercises[0]
+
+	err = validateWorkoutExercise(&exercise)
+	if err != nil {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	version, ok := wh.workoutPrecondition(w, r, workoutID)
+	if !ok {
+		return
+	}
+
+	workout, err := wh.changeWorkoutExercises(workoutID, middleware.GetUser(r).ID, version, func(workouts store.WorkoutStore) error {
+		return workouts.UpdateWorkoutExercise(workoutID, &exercise)
+	})
+	if errors.Is(err, store.ErrVersionConflict) {
+		wh.logger.Printf("ERROR: %v", err)
+		writeVersionConflict(w, r.Header.Get("If-Match"))
+		return
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusNotFound, utils.Envelope{"error": "not found"})
+		return
+	}
+	if err != nil {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	weightUnit := responseWeightUnit(w, r)
+	w.Header().Set("ETag", workoutETag(workout, weightUnit))
+	exerciseInUnit(&exercise, weightUnit)
+	_ = utils.WriteJSONResponse(w, http.StatusOK, utils.Envelope{"exercise": exercise, "weight_unit": weightUnit})
+}
+
+func (wh *WorkoutHandler) DeleteWorkoutExercise(w http.ResponseWriter, r *http.Request) {
+	workoutID, ok := wh.authorizeWorkout(w, r)
+	if !ok {
+		return
+	}
+
+	exerciseID, err := utils.ParseIDParamFromURL(r, "exerciseId")
+	if err != nil {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": "bad request"})
+		return
+	}
+
+	version, ok := wh.workoutPrecondition(w, r, workoutID)
+	if !ok {
+		return
+	}
+
+	workout, err := wh.changeWorkoutExercises(workoutID, middleware.GetUser(r).ID, version, func(workouts store.WorkoutStore) error {
+		return workouts.DeleteWorkoutExercise(workoutID, exerciseID)
+	})
+	if errors.Is(err, store.ErrVersionConflict) {
+		wh.logger.Printf("ERROR: %v", err)
+		writeVersionConflict(w, r.Header.Get("If-Match"))
+		return
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusNotFound, utils.Envelope{"error": "not found"})
+		return
+	}
+	if err != nil {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	w.Header().Set("ETag", workoutETag(workout, responseWeightUnit(w, r)))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (wh *WorkoutHandler) ReorderWorkoutExercises(w http.ResponseWriter, r *http.Request) {
+	workoutID, ok := wh.authorizeWorkout(w, r)
+	if !ok {
+		return
+	}
+
+	var reorderPayload struct {
+		ExerciseIDs []int `json:"exercise_ids"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&reorderPayload)
+	if err != nil {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": "bad request"})
+		return
+	}
+
+	version, ok := wh.workoutPrecondition(w, r, workoutID)
+	if !ok {
+		return
+	}
+
+	var exercises []store.WorkoutExercise
+	workout, err := wh.changeWorkoutExercises(workoutID, middleware.GetUser(r).ID, version, func(workouts store.WorkoutStore) error {
+		var err error
+		exercises, err = workouts.ReorderWorkoutExercises(workoutID, reorderPayload.ExerciseIDs)
+		return err
+	})
+	if errors.Is(err, store.ErrVersionConflict) {
+		wh.logger.Printf("ERROR: %v", err)
+		writeVersionConflict(w, r.Header.Get("If-Match"))
+		return
+	}
+	if errors.Is(err, store.ErrInvalidExerciseOrder) {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": "exercise_ids must list every exercise of the workout once"})
+		return
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusNotFound, utils.Envelope{"error": "not found"})
+		return
+	}
+	if err != nil {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	weightUnit := responseWeightUnit(w, r)
+	w.Header().Set("ETag", workoutETag(workout, weightUnit))
+	exercisesInUnit(exercises, weightUnit)
+	_ = utils.WriteJSONResponse(w, http.StatusOK, utils.Envelope{"exercises": exercises, "weight_unit": weightUnit})
+}
+
+// changeWorkoutExercises runs change like changeWorkout and returns the changed
+// workout. Unless version is 0, it fails with store.ErrVersionConflict if the
+// workout was at another version when change bumped and locked it.
+func (wh *WorkoutHandler) changeWorkoutExercises(workoutID, actorID, version int, change func(workouts store.WorkoutStore) error) (*store.Workout, error) {
+	var workout *store.Workout
+	err := wh.changeWorkout(workoutID, actorID, store.WorkoutRevisionUpdate, func(workouts store.WorkoutStore) error {
+		err := change(workouts)
+		if err != nil {
+			return err
+		}
+
+		workout, err = workouts.GetWorkout(workoutID)
+		if err != nil {
+			return err
+		}
+		if workout == nil {
+			return sql.ErrNoRows
+		}
+
+		if version != 0 && workout.Version != version+1 {
+			return fmt.Errorf("%w: workout %d is at version %d", store.ErrVersionConflict, workoutID, workout.Version-1)
+		}
+
+		return nil
+	})
+
+	return workout, err
+}
+
+// decodeWorkoutExercise decodes an exercise whose weights are in its
+// weight_unit, or in kilograms, converted to kilograms, writing the error
+// response if it is invalid.
+func (wh *WorkoutHandler) decodeWorkoutExercise(w http.ResponseWriter, r *http.Request) (store.WorkoutExercise, bool) {
+	var payload struct {
+		store.WorkoutExercise
+		WeightUnit string `json:"weight_unit"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": "bad request"})
+		return store.WorkoutExercise{}, false
+	}
+
+	exercises := []store.WorkoutExercise{payload.WorkoutExercise}
+	err = exercisesToKilograms(exercises, payload.WeightUnit)
+	if err != nil {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return store.WorkoutExercise{}, false
+	}
+
+	return exercises[0], true
+}
+
+// the largest values the columns of workout_exercises and workout_sets hold,
+// the weights in kilograms
+const (
+	maxSmallint       = math.MaxInt16
+	maxWeight         = 99999.999
+	maxDistanceMeters = 999999.99
+)
+
+// validateWorkoutExercise mirrors the checks of the workout_exercises and
+// workout_sets tables, so that invalid input is reported as a bad request
+// rather than a failed insert. An exercise logged set by set gets its
+// aggregate fields derived from its sets.
+func validateWorkoutExercise(exercise *store.WorkoutExercise) error {
+	if exercise.Name == "" {
+		return errors.New("name is required")
+	}
+
+	for i := range exercise.WorkoutSets {
+		err := validateWorkoutSet(&exercise.WorkoutSets[i])
+		if err != nil {
+			return fmt.Errorf("set %d: %w", i+1, err)
+		}
+
+		if (exercise.WorkoutSets[i].Reps == nil) != (exercise.WorkoutSets[0].Reps == nil) {
+			return fmt.Errorf("set %d: sets must all have reps or all have duration_seconds", i+1)
+		}
+	}
+	exercise.DeriveFromSets()
+
+	if exercise.Sets <= 0 {
+		return errors.New("sets must be positive")
+	}
+
+	if (exercise.Reps == nil) == (exercise.DurationSeconds == nil) {
+		return errors.New("exactly one of reps or duration_seconds is required")
+	}
+
+	if exercise.Sets > maxSmallint || (exercise.Reps != nil && *exercise.Reps > maxSmallint) ||
+		(exercise.DurationSeconds != nil && *exercise.DurationSeconds > maxSmallint) {
+		return fmt.Errorf("sets, reps and duration_seconds must be at most %d", maxSmallint)
+	}
+
+	if exercise.Weight != nil && *exercise.Weight > maxWeight {
+		return fmt.Errorf("weight must be at most %g kg", maxWeight)
+	}
+
+	return nil
+}
+
+// validateWorkoutSet defaults the type of a set to working.
+func validateWorkoutSet(set *store.WorkoutSet) error {
+	if set.SetType == "" {
+		set.SetType = store.WorkoutSetWorking
+	}
+
+	if !slices.Contains(store.WorkoutSetTypes, set.SetType) {
+		return fmt.Errorf("set_type must be one of %s", strings.Join(store.WorkoutSetTypes, ", "))
+	}
+
+	if (set.Reps == nil) == (set.DurationSeconds == nil) {
+		return errors.New("exactly one of reps or duration_seconds is required")
+	}
+
+	if (set.Reps != nil && *set.Reps < 0) || (set.DurationSeconds != nil && *set.DurationSeconds < 0) ||
+		(set.Weight != nil && *set.Weight < 0) || (set.DistanceMeters != nil && *set.DistanceMeters < 0) ||
+		(set.RIR != nil && *set.RIR < 0) || (set.RestSeconds != nil && *set.RestSeconds < 0) {
+		return errors.New("reps, weight, duration_seconds, distance_meters, rir and rest_seconds cannot be negative")
+	}
+
+	if (set.Reps != nil && *set.Reps > maxSmallint) || (set.DurationSeconds != nil && *set.DurationSeconds > maxSmallint) ||
+		(set.RIR != nil && *set.RIR > maxSmallint) || (set.RestSeconds != nil && *set.RestSeconds > maxSmallint) {
+		return fmt.Errorf("reps, duration_seconds, rir and rest_seconds must be at most %d", maxSmallint)
+	}
+
+	if set.Weight != nil && *set.Weight > maxWeight {
+		return fmt.Errorf("weight must be at most %g kg", maxWeight)
+	}
+
+	if set.DistanceMeters != nil && *set.DistanceMeters > maxDistanceMeters {
+		return fmt.Errorf("distance_meters must be at most %g", maxDistanceMeters)
+	}
+
+	if set.RPE != nil && (*set.RPE < 1 || *set.RPE > 10) {
+		return errors.New("rpe must be between 1 and 10")
+	}
+
+	return nil
+}
@@ -1,25 +1,41 @@
 package api
 
 import (
+	"bytes"
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"log"
+	"math"
+	"mime"
 	"net/http"
+	"time"
 
+	"fem-go-crud/internal/jsonpatch"
+	"fem-go-crud/internal/middleware"
 	"fem-go-crud/internal/store"
 	"fem-go-crud/internal/utils"
 )
 
 type WorkoutHandler struct {
-	workoutStore store.WorkoutStore
-	logger       *log.Logger
+	workoutStore         store.WorkoutStore
+	workoutRevisionStore store.WorkoutRevisionStore
+	exerciseStore        store.ExerciseStore
+	measurementStore     store.MeasurementStore
+	txManager            store.TxManager
+	logger               *log.Logger
 }
 
-func NewWorkoutHandler(ws store.WorkoutStore, l *log.Logger) *WorkoutHandler {
+func NewWorkoutHandler(ws store.WorkoutStore, rs store.WorkoutRevisionStore, es store.ExerciseStore, ms store.MeasurementStore, tm store.TxManager, l *log.Logger) *WorkoutHandler {
 	return &WorkoutHandler{
-		workoutStore: ws,
-		logger:       l,
+		workoutStore:         ws,
+		workoutRevisionStore: rs,
+		exerciseStore:        es,
+		measurementStore:     ms,
+		txManager:            tm,
+		logger:               l,
 	}
 }
 
@@ -44,30 +60,83 @@ func (wh *WorkoutHandler) GetWorkout(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_ = utils.WriteJSONResponse(w, http.StatusOK, utils.Envelope{"workout": workout})
+	weightUnit := responseWeightUnit(w, r)
+	etag := workoutETag(workout, weightUnit)
+	w.Header().Set("ETag", etag)
+
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" && utils.MatchesETag(ifNoneMatch, etag, true) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	workoutInUnit(workout, weightUnit)
+	_ = utils.WriteJSONResponse(w, http.StatusOK, utils.Envelope{"workout": workout, "weight_unit": weightUnit})
 }
 
+// CreateWorkout takes the weights of the workout in its weight_unit, or in
+// kilograms.
 func (wh *WorkoutHandler) CreateWorkout(w http.ResponseWriter, r *http.Request) {
-	var workout store.Workout
+	var payload workoutPayload
 
-	err := json.NewDecoder(r.Body).Decode(&workout)
+	err := json.NewDecoder(r.Body).Decode(&payload)
 	if err != nil {
 		wh.logger.Printf("ERROR: %v", err)
 		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": "bad request"})
 		return
 	}
 
-	currentUser := r.Context().Value("user").(store.User)
+	workout := payload.Workout
+	err = exercisesToKilograms(workout.Exercises, payload.WeightUnit)
+	if err != nil {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	err = linkExercises(wh.exerciseStore, currentUser.ID, workout.Exercises)
+	if errors.Is(err, errUnknownExercise) {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	err = validateWorkout(&workout)
+	if err != nil {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
 	workout.UserID = currentUser.ID
+	// only the workouts started from a template come from one
+	workout.TemplateID = nil
 
-	err = wh.workoutStore.PersistWorkout(&workout)
+	err = estimateCalories(wh.exerciseStore, wh.measurementStore, &workout, currentUser)
 	if err != nil {
 		wh.logger.Printf("ERROR: %v", err)
 		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
 		return
 	}
 
-	_ = utils.WriteJSONResponse(w, http.StatusCreated, utils.Envelope{"workout": workout})
+	err = wh.txManager.WithinTx(func(stores *store.Stores) error {
+		return persistWorkouts(stores, []*store.Workout{&workout}, currentUser.ID)
+	})
+	if err != nil {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	weightUnit := responseWeightUnit(w, r)
+	w.Header().Set("ETag", workoutETag(&workout, weightUnit))
+	workoutInUnit(&workout, weightUnit)
+	_ = utils.WriteJSONResponse(w, http.StatusCreated, utils.Envelope{"workout": workout, "personal_records": workout.NewRecords, "weight_unit": weightUnit})
 }
 
 func (wh *WorkoutHandler) UpdateWorkout(w http.ResponseWriter, r *http.Request) {
@@ -91,13 +160,7 @@ func (wh *WorkoutHandler) UpdateWorkout(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	var updateWorkoutPayload struct {
-		Name            *string                 `json:"name"`
-		Description     *string                 `json:"description"`
-		DurationMinutes *int                    `json:"duration_minutes"`
-		CaloriesBurned  *int                    `json:"calories_burned"`
-		Exercises       []store.WorkoutExercise `json:"exercises"`
-	}
+	var updateWorkoutPayload workoutUpdate
 
 	err = json.NewDecoder(r.Body).Decode(&updateWorkoutPayload)
 	if err != nil {
@@ -106,23 +169,35 @@ func (wh *WorkoutHandler) UpdateWorkout(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if updateWorkoutPayload.Name != nil {
-		existingWorkout.Name = *updateWorkoutPayload.Name
-	}
-	if updateWorkoutPayload.Description != nil {
-		existingWorkout.Description = *updateWorkoutPayload.Description
+	err = exercisesToKilograms(updateWorkoutPayload.Exercises, updateWorkoutPayload.WeightUnit)
+	if err != nil {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
 	}
-	if updateWorkoutPayload.DurationMinutes != nil {
-		existingWorkout.DurationMinutes = *updateWorkoutPayload.DurationMinutes
+
+	updateWorkoutPayload.apply(existingWorkout)
+
+	currentUser := middleware.GetUser(r)
+	err = linkExercises(wh.exerciseStore, currentUser.ID, existingWorkout.Exercises)
+	if errors.Is(err, errUnknownExercise) {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
 	}
-	if updateWorkoutPayload.CaloriesBurned != nil {
-		existingWorkout.CaloriesBurned = *updateWorkoutPayload.CaloriesBurned
+	if err != nil {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
 	}
-	if updateWorkoutPayload.Exercises != nil {
-		existingWorkout.Exercises = updateWorkoutPayload.Exercises
+
+	err = validateWorkout(existingWorkout)
+	if err != nil {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
 	}
 
-	currentUser := r.Context().Value("user").(store.User)
 	workoutOwner, err := wh.workoutStore.GetWorkoutOwner(workoutID)
 	if errors.Is(err, sql.ErrNoRows) {
 		wh.logger.Printf("ERROR: %v", err)
@@ -135,19 +210,206 @@ func (wh *WorkoutHandler) UpdateWorkout(w http.ResponseWriter, r *http.Request)
 		return
 	}
 	if workoutOwner != currentUser.ID {
-		wh.logger.Printf("ERROR: %v", err)
+		wh.logger.Printf("ERROR: user %d does not own workout %d", currentUser.ID, workoutID)
 		_ = utils.WriteJSONResponse(w, http.StatusForbidden, utils.Envelope{"error": "forbidden"})
 		return
 	}
 
-	err = wh.workoutStore.UpdateWorkout(existingWorkout)
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch != "" && !utils.MatchesETag(ifMatch, workoutETag(existingWorkout, responseWeightUnit(w, r)), false) {
+		wh.logger.Printf("ERROR: workout %d does not match %s", workoutID, ifMatch)
+		_ = utils.WriteJSONResponse(w, http.StatusPreconditionFailed, utils.Envelope{"error": "precondition failed"})
+		return
+	}
+
+	err = wh.changeWorkout(workoutID, currentUser.ID, store.WorkoutRevisionUpdate, func(workouts store.WorkoutStore) error {
+		return workouts.UpdateWorkout(existingWorkout)
+	})
+	if errors.Is(err, store.ErrVersionConflict) {
+		wh.logger.Printf("ERROR: %v", err)
+		writeVersionConflict(w, ifMatch)
+		return
+	}
+	if err != nil {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	weightUnit := responseWeightUnit(w, r)
+	w.Header().Set("ETag", workoutETag(existingWorkout, weightUnit))
+	workoutInUnit(existingWorkout, weightUnit)
+	_ = utils.WriteJSONResponse(w, http.StatusOK, utils.Envelope{"workout": existingWorkout, "personal_records": existingWorkout.NewRecords, "weight_unit": weightUnit})
+}
+
+// PatchWorkout applies a JSON Merge Patch or a JSON Patch to the workout
+// document, exercises included, whose weights are in kilograms. The position
+// of an exercise in the patched exercises array is its order.
+func (wh *WorkoutHandler) PatchWorkout(w http.ResponseWriter, r *http.Request) {
+	var applyPatch func(document, patch []byte) ([]byte, error)
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case jsonpatch.MergePatchMediaType:
+		applyPatch = jsonpatch.MergePatch
+	case jsonpatch.JSONPatchMediaType:
+		applyPatch = jsonpatch.Apply
+	default:
+		wh.logger.Printf("ERROR: unsupported patch media type %q", mediaType)
+		w.Header().Set("Accept-Patch", jsonpatch.MergePatchMediaType+", "+jsonpatch.JSONPatchMediaType)
+		_ = utils.WriteJSONResponse(w, http.StatusUnsupportedMediaType, utils.Envelope{"error": "unsupported media type"})
+		return
+	}
+
+	workoutID, ok := wh.authorizeWorkout(w, r)
+	if !ok {
+		return
+	}
+
+	existingWorkout, err := wh.workoutStore.GetWorkout(workoutID)
+	if err != nil {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	if existingWorkout == nil {
+		wh.logger.Printf("ERROR: workout %d not found", workoutID)
+		_ = utils.WriteJSONResponse(w, http.StatusNotFound, utils.Envelope{"error": "not found"})
+		return
+	}
+
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch != "" && !utils.MatchesETag(ifMatch, workoutETag(existingWorkout, responseWeightUnit(w, r)), false) {
+		wh.logger.Printf("ERROR: workout %d does not match %s", workoutID, ifMatch)
+		_ = utils.WriteJSONResponse(w, http.StatusPreconditionFailed, utils.Envelope{"error": "precondition failed"})
+		return
+	}
+
+	patch, err := io.ReadAll(r.Body)
+	if err != nil {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": "bad request"})
+		return
+	}
+
+	document, err := json.Marshal(existingWorkout)
 	if err != nil {
 		wh.logger.Printf("ERROR: %v", err)
 		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
 		return
 	}
 
-	_ = utils.WriteJSONResponse(w, http.StatusOK, utils.Envelope{"workout": existingWorkout})
+	patchedDocument, err := applyPatch(document, patch)
+	if errors.Is(err, jsonpatch.ErrInvalidPatch) {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusUnprocessableEntity, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	patchedWorkout, err := decodePatchedWorkout(patchedDocument, existingWorkout)
+	if err == nil {
+		err = linkExercises(wh.exerciseStore, middleware.GetUser(r).ID, patchedWorkout.Exercises)
+		if err != nil && !errors.Is(err, errUnknownExercise) {
+			wh.logger.Printf("ERROR: %v", err)
+			_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+			return
+		}
+	}
+	if err == nil {
+		err = validateWorkout(patchedWorkout)
+	}
+	if err != nil {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusUnprocessableEntity, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	// a patch that changes nothing does not create a new version
+	patchedJSON, err := json.Marshal(patchedWorkout)
+	if err != nil {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+	if bytes.Equal(patchedJSON, document) {
+		weightUnit := responseWeightUnit(w, r)
+		w.Header().Set("ETag", workoutETag(existingWorkout, weightUnit))
+		workoutInUnit(existingWorkout, weightUnit)
+		_ = utils.WriteJSONResponse(w, http.StatusOK, utils.Envelope{"workout": existingWorkout, "personal_records": []store.PersonalRecord{}, "weight_unit": weightUnit})
+		return
+	}
+
+	err = wh.changeWorkout(workoutID, middleware.GetUser(r).ID, store.WorkoutRevisionUpdate, func(workouts store.WorkoutStore) error {
+		return workouts.UpdateWorkout(patchedWorkout)
+	})
+	if errors.Is(err, store.ErrVersionConflict) {
+		wh.logger.Printf("ERROR: %v", err)
+		writeVersionConflict(w, ifMatch)
+		return
+	}
+	if err != nil {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	weightUnit := responseWeightUnit(w, r)
+	w.Header().Set("ETag", workoutETag(patchedWorkout, weightUnit))
+	workoutInUnit(patchedWorkout, weightUnit)
+	_ = utils.WriteJSONResponse(w, http.StatusOK, utils.Envelope{"workout": patchedWorkout, "personal_records": patchedWorkout.NewRecords, "weight_unit": weightUnit})
+}
+
+// decodePatchedWorkout decodes a patched workout document, rejecting changes to
+// read-only fields. Exercises are renumbered from their position in the array
+// and keep the timestamps of the exercise they patch.
+func decodePatchedWorkout(document []byte, existingWorkout *store.Workout) (*store.Workout, error) {
+	decoder := json.NewDecoder(bytes.NewReader(document))
+	decoder.DisallowUnknownFields()
+
+	var patchedWorkout store.Workout
+	err := decoder.Decode(&patchedWorkout)
+	if err != nil {
+		return nil, err
+	}
+
+	sameTemplate := (patchedWorkout.TemplateID == nil) == (existingWorkout.TemplateID == nil) &&
+		(patchedWorkout.TemplateID == nil || *patchedWorkout.TemplateID == *existingWorkout.TemplateID)
+	if patchedWorkout.ID != existingWorkout.ID || patchedWorkout.UserID != existingWorkout.UserID || patchedWorkout.Version != existingWorkout.Version ||
+		!patchedWorkout.CreatedAt.Equal(existingWorkout.CreatedAt) || !sameTemplate {
+		return nil, errors.New("id, user_id, template_id, version and created_at are read-only")
+	}
+
+	// calories set by the client are measured
+	patchedWorkout.CaloriesEstimated = existingWorkout.CaloriesEstimated &&
+		(patchedWorkout.CaloriesBurned == nil) == (existingWorkout.CaloriesBurned == nil) &&
+		(patchedWorkout.CaloriesBurned == nil || *patchedWorkout.CaloriesBurned == *existingWorkout.CaloriesBurned)
+
+	existingExercises := make(map[int]store.WorkoutExercise, len(existingWorkout.Exercises))
+	for _, exercise := range existingWorkout.Exercises {
+		existingExercises[exercise.ID] = exercise
+	}
+
+	for i := range patchedWorkout.Exercises {
+		exercise := &patchedWorkout.Exercises[i]
+		exercise.OrderIndex = i + 1
+
+		existingExercise, ok := existingExercises[exercise.ID]
+		if !ok {
+			// an unknown id is a new exercise
+			exercise.ID = 0
+			existingExercise = store.WorkoutExercise{}
+		}
+		exercise.CreatedAt = existingExercise.CreatedAt
+		exercise.UpdatedAt = existingExercise.UpdatedAt
+	}
+
+	return &patchedWorkout, nil
 }
 
 func (wh *WorkoutHandler) DeleteWorkout(w http.ResponseWriter, r *http.Request) {
@@ -158,7 +420,7 @@ func (wh *WorkoutHandler) DeleteWorkout(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	currentUser := r.Context().Value("user").(store.User)
+	currentUser := middleware.GetUser(r)
 	workoutOwner, err := wh.workoutStore.GetWorkoutOwner(workoutID)
 	if errors.Is(err, sql.ErrNoRows) {
 		wh.logger.Printf("ERROR: %v", err)
@@ -171,13 +433,27 @@ func (wh *WorkoutHandler) DeleteWorkout(w http.ResponseWriter, r *http.Request)
 		return
 	}
 	if workoutOwner != currentUser.ID {
-		wh.logger.Printf("ERROR: %v", err)
+		wh.logger.Printf("ERROR: user %d does not own workout %d", currentUser.ID, workoutID)
 		_ = utils.WriteJSONResponse(w, http.StatusForbidden, utils.Envelope{"error": "forbidden"})
 		return
 	}
 
-	err = wh.workoutStore.DeleteWorkout(workoutID)
+	// without If-Match the delete is unconditional
+	version, ok := wh.workoutPrecondition(w, r, workoutID)
+	if !ok {
+		return
+	}
+	ifMatch := r.Header.Get("If-Match")
+
+	err = wh.txManager.WithinTx(func(stores *store.Stores) error {
+		return deleteWorkout(stores, workoutID, version, currentUser.ID)
+	})
 	// Question: Idempotency?
+	if errors.Is(err, store.ErrVersionConflict) {
+		wh.logger.Printf("ERROR: %v", err)
+		writeVersionConflict(w, ifMatch)
+		return
+	}
 	if errors.Is(err, sql.ErrNoRows) {
 		wh.logger.Printf("ERROR: %v", err)
 		_ = utils.WriteJSONResponse(w, http.StatusNotFound, utils.Envelope{"error": "not found"})
@@ -189,5 +465,316 @@ func (wh *WorkoutHandler) DeleteWorkout(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	_ = utils.WriteJSONResponse(w, http.StatusNoContent, utils.Envelope{})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// changeWorkout runs change in a transaction and records the resulting state of
+// the workout as a new revision.
+func (wh *WorkoutHandler) changeWorkout(workoutID, actorID int, action string, change func(workouts store.WorkoutStore) error) error {
+	return wh.txManager.WithinTx(func(stores *store.Stores) error {
+		err := change(stores.Workouts)
+		if err != nil {
+			return err
+		}
+
+		return recordWorkoutRevision(stores, workoutID, actorID, action)
+	})
+}
+
+// persistWorkouts creates workouts together with their first revision.
+func persistWorkouts(stores *store.Stores, workouts []*store.Workout, actorID int) error {
+	err := stores.Workouts.PersistWorkouts(workouts)
+	if err != nil {
+		return err
+	}
+
+	revisions := make([]*store.WorkoutRevision, 0, len(workouts))
+	for _, workout := range workouts {
+		revision, err := newWorkoutRevision(workout, actorID, store.WorkoutRevisionCreate)
+		if err != nil {
+			return err
+		}
+
+		revisions = append(revisions, revision)
+	}
+
+	return stores.WorkoutRevisions.CreateWorkoutRevisions(revisions)
+}
+
+// deleteWorkout moves a workout to the trash and records the deletion.
+func deleteWorkout(stores *store.Stores, workoutID, version, actorID int) error {
+	err := stores.Workouts.DeleteWorkout(workoutID, version)
+	if err != nil {
+		return err
+	}
+
+	workout, err := stores.Workouts.GetTrashedWorkout(workoutID)
+	if err != nil {
+		return err
+	}
+
+	return createWorkoutRevision(stores, workout, actorID, store.WorkoutRevisionDelete)
+}
+
+func recordWorkoutRevision(stores *store.Stores, workoutID, actorID int, action string) error {
+	workout, err := stores.Workouts.GetWorkout(workoutID)
+	if err != nil {
+		return err
+	}
+	if workout == nil {
+		return sql.ErrNoRows
+	}
+
+	return createWorkoutRevision(stores, workout, actorID, action)
+}
+
+func createWorkoutRevision(stores *store.Stores, workout *store.Workout, actorID int, action string) error {
+	revision, err := newWorkoutRevision(workout, actorID, action)
+	if err != nil {
+		return err
+	}
+
+	return stores.WorkoutRevisions.CreateWorkoutRevision(revision)
+}
+
+func newWorkoutRevision(workout *store.Workout, actorID int, action string) (*store.WorkoutRevision, error) {
+	snapshot, err := json.Marshal(workout)
+	if err != nil {
+		return nil, err
+	}
+
+	return &store.WorkoutRevision{
+		WorkoutID: workout.ID,
+		UserID:    workout.UserID,
+		ActorID:   actorID,
+		Action:    action,
+		Snapshot:  snapshot,
+	}, nil
+}
+
+// workoutUpdate is a partial update of a workout: the fields left out are kept.
+// workoutPayload is a workout whose weights are in WeightUnit, or in kilograms.
+type workoutPayload struct {
+	store.Workout
+	WeightUnit string `json:"weight_unit"`
+}
+
+type workoutUpdate struct {
+	Name            *string                 `json:"name"`
+	Description     *string                 `json:"description"`
+	StartedAt       *time.Time              `json:"started_at"`
+	EndedAt         *time.Time              `json:"ended_at"`
+	DurationMinutes *int                    `json:"duration_minutes"`
+	CaloriesBurned  *int                    `json:"calories_burned"`
+	Exercises       []store.WorkoutExercise `json:"exercises"`
+	WeightUnit      string                  `json:"weight_unit"`
+}
+
+func (wu *workoutUpdate) apply(workout *store.Workout) {
+	if wu.Name != nil {
+		workout.Name = *wu.Name
+	}
+	if wu.Description != nil {
+		workout.Description = *wu.Description
+	}
+	if wu.StartedAt != nil {
+		workout.StartedAt = *wu.StartedAt
+	}
+	if wu.EndedAt != nil {
+		workout.EndedAt = wu.EndedAt
+	}
+	if wu.DurationMinutes != nil {
+		workout.DurationMinutes = *wu.DurationMinutes
+	}
+	if wu.CaloriesBurned != nil {
+		workout.CaloriesBurned = wu.CaloriesBurned
+		workout.CaloriesEstimated = false
+	}
+	if wu.Exercises != nil {
+		workout.Exercises = wu.Exercises
+	}
+}
+
+// errUnknownExercise is returned by linkExercises for an exercise_id that is
+// neither in the catalog nor a custom exercise of the user.
+var errUnknownExercise = errors.New("unknown exercise_id")
+
+// linkExercises checks the exercise_id of the given exercises refer to the
+// catalog or to custom exercises of userID, and names the exercises left
+// without a name after the exercise they refer to.
+func linkExercises(exerciseStore store.ExerciseStore, userID int, exercises []store.WorkoutExercise) error {
+	var exerciseIDs []int
+	for _, exercise := range exercises {
+		if exercise.ExerciseID != nil {
+			exerciseIDs = append(exerciseIDs, *exercise.ExerciseID)
+		}
+	}
+
+	if len(exerciseIDs) == 0 {
+		return nil
+	}
+
+	linkedExercises, err := exerciseStore.GetExercises(exerciseIDs)
+	if err != nil {
+		return err
+	}
+
+	visibleExercises := make(map[int]store.Exercise, len(linkedExercises))
+	for _, exercise := range linkedExercises {
+		if exercise.UserID == nil || *exercise.UserID == userID {
+			visibleExercises[exercise.ID] = exercise
+		}
+	}
+
+	for i := range exercises {
+		exercise := &exercises[i]
+		if exercise.ExerciseID == nil {
+			continue
+		}
+
+		linkedExercise, ok := visibleExercises[*exercise.ExerciseID]
+		if !ok {
+			return fmt.Errorf("%w %d", errUnknownExercise, *exercise.ExerciseID)
+		}
+
+		if exercise.Name == "" {
+			exercise.Name = linkedExercise.Name
+		}
+	}
+
+	return nil
+}
+
+// maxClockSkew is how far ahead of the server the clocks of the clients that
+// log workouts as they start may be.
+const maxClockSkew = 5 * time.Minute
+
+// validateWorkout checks what the workouts and workout_exercises tables would
+// otherwise reject, or store without meaning. A workout that ended and says
+// no duration lasts from started_at to ended_at.
+func validateWorkout(workout *store.Workout) error {
+	if workout.Name == "" {
+		return errors.New("name is required")
+	}
+
+	if len(workout.Name) > 100 {
+		return errors.New("name must be at most 100 characters")
+	}
+
+	// the times are given in any offset, and stored and returned in UTC
+	workout.StartedAt = workout.StartedAt.UTC()
+	if workout.EndedAt != nil {
+		endedAt := workout.EndedAt.UTC()
+		workout.EndedAt = &endedAt
+	}
+
+	if workout.StartedAt.After(time.Now().Add(maxClockSkew)) {
+		return errors.New("started_at cannot be in the future")
+	}
+
+	if workout.EndedAt != nil {
+		if workout.StartedAt.IsZero() {
+			return errors.New("ended_at needs a started_at")
+		}
+		if workout.EndedAt.Before(workout.StartedAt) {
+			return errors.New("ended_at must not be before started_at")
+		}
+		if workout.DurationMinutes == 0 {
+			workout.DurationMinutes = max(int(math.Ceil(workout.EndedAt.Sub(workout.StartedAt).Minutes())), 1)
+		}
+	}
+
+	if workout.DurationMinutes <= 0 {
+		return errors.New("duration_minutes must be positive")
+	}
+
+	if workout.CaloriesBurned != nil && *workout.CaloriesBurned < 0 {
+		return errors.New("calories_burned cannot be negative")
+	}
+
+	if workout.DurationMinutes > math.MaxInt32 || (workout.CaloriesBurned != nil && *workout.CaloriesBurned > math.MaxInt32) {
+		return fmt.Errorf("duration_minutes and calories_burned must be at most %d", math.MaxInt32)
+	}
+
+	for i := range workout.Exercises {
+		err := validateWorkoutExercise(&workout.Exercises[i])
+		if err != nil {
+			return fmt.Errorf("exercise %d: %w", i+1, err)
+		}
+	}
+
+	return nil
+}
+
+// authorizeWorkout parses the workoutId URL parameter and checks the current
+// user owns that workout, writing the error response if not.
+func (wh *WorkoutHandler) authorizeWorkout(w http.ResponseWriter, r *http.Request) (int, bool) {
+	workoutID, err := utils.ParseIDParamFromURL(r, "workoutId")
+	if err != nil {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": "bad request"})
+		return 0, false
+	}
+
+	currentUser := middleware.GetUser(r)
+	workoutOwner, err := wh.workoutStore.GetWorkoutOwner(workoutID)
+	if errors.Is(err, sql.ErrNoRows) {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusNotFound, utils.Envelope{"error": "not found"})
+		return 0, false
+	}
+	if err != nil {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return 0, false
+	}
+	if workoutOwner != currentUser.ID {
+		wh.logger.Printf("ERROR: user %d does not own workout %d", currentUser.ID, workoutID)
+		_ = utils.WriteJSONResponse(w, http.StatusForbidden, utils.Envelope{"error": "forbidden"})
+		return 0, false
+	}
+
+	return workoutID, true
+}
+
+// workoutETag derives the entity tag of a workout in weightUnit from its
+// version, which the store increments on every change to the workout or its
+// exercises, and from the unit, which changes the weights of the body.
+func workoutETag(workout *store.Workout, weightUnit string) string {
+	return fmt.Sprintf(`"%d-%s"`, workout.Version, weightUnit)
+}
+
+// workoutPrecondition checks the workout against the If-Match header of r and
+// returns the version it matched, or 0 without the header, writing the error
+// response if it does not match.
+func (wh *WorkoutHandler) workoutPrecondition(w http.ResponseWriter, r *http.Request, workoutID int) (int, bool) {
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		return 0, true
+	}
+
+	existingWorkout, err := wh.workoutStore.GetWorkout(workoutID)
+	if err != nil {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return 0, false
+	}
+	if existingWorkout == nil || !utils.MatchesETag(ifMatch, workoutETag(existingWorkout, responseWeightUnit(w, r)), false) {
+		wh.logger.Printf("ERROR: workout %d does not match %s", workoutID, ifMatch)
+		_ = utils.WriteJSONResponse(w, http.StatusPreconditionFailed, utils.Envelope{"error": "precondition failed"})
+		return 0, false
+	}
+
+	return existingWorkout.Version, true
+}
+
+// writeVersionConflict reports a workout changed concurrently between the read
+// and the write: a failed precondition if the client sent one, a conflict otherwise.
+func writeVersionConflict(w http.ResponseWriter, ifMatch string) {
+	if ifMatch != "" {
+		_ = utils.WriteJSONResponse(w, http.StatusPreconditionFailed, utils.Envelope{"error": "precondition failed"})
+		return
+	}
+
+	_ = utils.WriteJSONResponse(w, http.StatusConflict, utils.Envelope{"error": "conflict"})
 }
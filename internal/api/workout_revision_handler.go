@@ -0,0 +1,172 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"fem-go-crud/internal/middleware"
+	"fem-go-crud/internal/store"
+	"fem-go-crud/internal/utils"
+)
+
+// ListWorkoutRevisions returns the history of a workout, which stays available
+// after the workout is deleted.
+func (wh *WorkoutHandler) ListWorkoutRevisions(w http.ResponseWriter, r *http.Request) {
+	workoutID, err := utils.ParseIDParamFromURL(r, "workoutId")
+	if err != nil {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": "bad request"})
+		return
+	}
+
+	revisions, err := wh.workoutRevisionStore.ListWorkoutRevisions(workoutID)
+	if err != nil {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	// workouts created before revisions were recorded have none yet
+	if len(revisions) == 0 {
+		_, ok := wh.authorizeWorkout(w, r)
+		if !ok {
+			return
+		}
+
+		_ = utils.WriteJSONResponse(w, http.StatusOK, utils.Envelope{"revisions": revisions})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	if revisions[0].UserID != currentUser.ID {
+		wh.logger.Printf("ERROR: user %d does not own workout %d", currentUser.ID, workoutID)
+		_ = utils.WriteJSONResponse(w, http.StatusForbidden, utils.Envelope{"error": "forbidden"})
+		return
+	}
+
+	_ = utils.WriteJSONResponse(w, http.StatusOK, utils.Envelope{"revisions": revisions})
+}
+
+// GetWorkoutRevision returns a revision, whose snapshot keeps the weights in
+// kilograms as they were stored.
+func (wh *WorkoutHandler) GetWorkoutRevision(w http.ResponseWriter, r *http.Request) {
+	revision, ok := wh.getWorkoutRevision(w, r)
+	if !ok {
+		return
+	}
+
+	_ = utils.WriteJSONResponse(w, http.StatusOK, utils.Envelope{"revision": revision})
+}
+
+// RestoreWorkoutRevision brings a workout back to the state of one of its
+// revisions, which is recorded as a new revision.
+func (wh *WorkoutHandler) RestoreWorkoutRevision(w http.ResponseWriter, r *http.Request) {
+	workoutID, ok := wh.authorizeWorkout(w, r)
+	if !ok {
+		return
+	}
+
+	revision, ok := wh.getWorkoutRevision(w, r)
+	if !ok {
+		return
+	}
+
+	var restoredWorkout store.Workout
+	err := json.Unmarshal(revision.Snapshot, &restoredWorkout)
+	if err != nil {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	existingWorkout, err := wh.workoutStore.GetWorkout(workoutID)
+	if err != nil {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	if existingWorkout == nil {
+		wh.logger.Printf("ERROR: workout %d not found", workoutID)
+		_ = utils.WriteJSONResponse(w, http.StatusNotFound, utils.Envelope{"error": "not found"})
+		return
+	}
+
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch != "" && !utils.MatchesETag(ifMatch, workoutETag(existingWorkout, responseWeightUnit(w, r)), false) {
+		wh.logger.Printf("ERROR: workout %d does not match %s", workoutID, ifMatch)
+		_ = utils.WriteJSONResponse(w, http.StatusPreconditionFailed, utils.Envelope{"error": "precondition failed"})
+		return
+	}
+
+	// exercises deleted since the revision are added back with new ids
+	restoredWorkout.ID = existingWorkout.ID
+	restoredWorkout.UserID = existingWorkout.UserID
+	restoredWorkout.TemplateID = existingWorkout.TemplateID
+	restoredWorkout.Version = existingWorkout.Version
+	restoredWorkout.DeletedAt = nil
+	// the revisions from before workouts had a start started when created
+	if restoredWorkout.StartedAt.IsZero() {
+		restoredWorkout.StartedAt = restoredWorkout.CreatedAt
+	}
+
+	err = wh.changeWorkout(workoutID, middleware.GetUser(r).ID, store.WorkoutRevisionRestore, func(workouts store.WorkoutStore) error {
+		return workouts.UpdateWorkout(&restoredWorkout)
+	})
+	if errors.Is(err, store.ErrVersionConflict) {
+		wh.logger.Printf("ERROR: %v", err)
+		writeVersionConflict(w, ifMatch)
+		return
+	}
+	if err != nil {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	weightUnit := responseWeightUnit(w, r)
+	w.Header().Set("ETag", workoutETag(&restoredWorkout, weightUnit))
+	workoutInUnit(&restoredWorkout, weightUnit)
+	_ = utils.WriteJSONResponse(w, http.StatusOK, utils.Envelope{"workout": restoredWorkout, "weight_unit": weightUnit})
+}
+
+// getWorkoutRevision loads the revision the URL refers to and checks the current
+// user owns its workout, writing the error response if not.
+func (wh *WorkoutHandler) getWorkoutRevision(w http.ResponseWriter, r *http.Request) (*store.WorkoutRevision, bool) {
+	workoutID, err := utils.ParseIDParamFromURL(r, "workoutId")
+	if err != nil {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": "bad request"})
+		return nil, false
+	}
+
+	revisionNumber, err := utils.ParseIDParamFromURL(r, "revision")
+	if err != nil {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": "bad request"})
+		return nil, false
+	}
+
+	revision, err := wh.workoutRevisionStore.GetWorkoutRevision(workoutID, revisionNumber)
+	if err != nil {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return nil, false
+	}
+
+	if revision == nil {
+		wh.logger.Printf("ERROR: revision %d of workout %d not found", revisionNumber, workoutID)
+		_ = utils.WriteJSONResponse(w, http.StatusNotFound, utils.Envelope{"error": "not found"})
+		return nil, false
+	}
+
+	currentUser := middleware.GetUser(r)
+	if revision.UserID != currentUser.ID {
+		wh.logger.Printf("ERROR: user %d does not own workout %d", currentUser.ID, workoutID)
+		_ = utils.WriteJSONResponse(w, http.StatusForbidden, utils.Envelope{"error": "forbidden"})
+		return nil, false
+	}
+
+	return revision, true
+}
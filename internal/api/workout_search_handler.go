@@ -0,0 +1,62 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"fem-go-crud/internal/middleware"
+	"fem-go-crud/internal/utils"
+)
+
+const (
+	defaultWorkoutSearchLimit = 20
+	maxWorkoutSearchLimit     = 100
+)
+
+// SearchWorkouts searches the workouts of the current user, including the
+// names and notes of their exercises, for words starting with every word of q.
+// The snippets mark the matching words with <mark> tags and are not escaped.
+func (wh *WorkoutHandler) SearchWorkouts(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	q := strings.TrimSpace(query.Get("q"))
+	limit := defaultWorkoutSearchLimit
+	offset := 0
+
+	var err error
+	if q == "" {
+		err = errors.New("q is required")
+	}
+	if value := query.Get("limit"); err == nil && value != "" {
+		limit, err = strconv.Atoi(value)
+		if err == nil && (limit <= 0 || limit > maxWorkoutSearchLimit) {
+			err = fmt.Errorf("limit must be between 1 and %d", maxWorkoutSearchLimit)
+		}
+	}
+	if value := query.Get("offset"); err == nil && value != "" {
+		offset, err = strconv.Atoi(value)
+		if err == nil && offset < 0 {
+			err = errors.New("offset must not be negative")
+		}
+	}
+	if err != nil {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": "bad request"})
+		return
+	}
+
+	results, err := wh.workoutStore.SearchWorkouts(middleware.GetUser(r).ID, q, limit, offset)
+	if err != nil {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	weightUnit := responseWeightUnit(w, r)
+	for i := range results {
+		workoutInUnit(&results[i].Workout, weightUnit)
+	}
+	_ = utils.WriteJSONResponse(w, http.StatusOK, utils.Envelope{"results": results, "weight_unit": weightUnit})
+}
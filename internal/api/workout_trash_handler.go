@@ -0,0 +1,122 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"fem-go-crud/internal/middleware"
+	"fem-go-crud/internal/store"
+	"fem-go-crud/internal/utils"
+)
+
+func (wh *WorkoutHandler) ListTrashedWorkouts(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	workouts, err := wh.workoutStore.ListTrashedWorkouts(currentUser.ID)
+	if err != nil {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	weightUnit := responseWeightUnit(w, r)
+	for i := range workouts {
+		workoutInUnit(&workouts[i], weightUnit)
+	}
+	_ = utils.WriteJSONResponse(w, http.StatusOK, utils.Envelope{"workouts": workouts, "weight_unit": weightUnit})
+}
+
+// RestoreTrashedWorkout takes a workout out of the trash.
+func (wh *WorkoutHandler) RestoreTrashedWorkout(w http.ResponseWriter, r *http.Request) {
+	workout, ok := wh.authorizeTrashedWorkout(w, r)
+	if !ok {
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	err := wh.txManager.WithinTx(func(stores *store.Stores) error {
+		err := stores.Workouts.RestoreWorkout(workout.ID)
+		if err != nil {
+			return err
+		}
+
+		workout, err = stores.Workouts.GetWorkout(workout.ID)
+		if err != nil {
+			return err
+		}
+
+		return createWorkoutRevision(stores, workout, currentUser.ID, store.WorkoutRevisionRestore)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusNotFound, utils.Envelope{"error": "not found"})
+		return
+	}
+	if err != nil {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	weightUnit := responseWeightUnit(w, r)
+	w.Header().Set("ETag", workoutETag(workout, weightUnit))
+	workoutInUnit(workout, weightUnit)
+	_ = utils.WriteJSONResponse(w, http.StatusOK, utils.Envelope{"workout": workout, "weight_unit": weightUnit})
+}
+
+// PurgeTrashedWorkout permanently deletes a workout from the trash, and its
+// revisions with it.
+func (wh *WorkoutHandler) PurgeTrashedWorkout(w http.ResponseWriter, r *http.Request) {
+	workout, ok := wh.authorizeTrashedWorkout(w, r)
+	if !ok {
+		return
+	}
+
+	err := wh.workoutStore.PurgeWorkout(workout.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusNotFound, utils.Envelope{"error": "not found"})
+		return
+	}
+	if err != nil {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// authorizeTrashedWorkout loads the trashed workout the URL refers to and checks
+// the current user owns it, writing the error response if not.
+func (wh *WorkoutHandler) authorizeTrashedWorkout(w http.ResponseWriter, r *http.Request) (*store.Workout, bool) {
+	workoutID, err := utils.ParseIDParamFromURL(r, "workoutId")
+	if err != nil {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": "bad request"})
+		return nil, false
+	}
+
+	workout, err := wh.workoutStore.GetTrashedWorkout(workoutID)
+	if err != nil {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+		return nil, false
+	}
+
+	if workout == nil {
+		wh.logger.Printf("ERROR: workout %d not found in trash", workoutID)
+		_ = utils.WriteJSONResponse(w, http.StatusNotFound, utils.Envelope{"error": "not found"})
+		return nil, false
+	}
+
+	currentUser := middleware.GetUser(r)
+	if workout.UserID != currentUser.ID {
+		wh.logger.Printf("ERROR: user %d does not own workout %d", currentUser.ID, workoutID)
+		_ = utils.WriteJSONResponse(w, http.StatusForbidden, utils.Envelope{"error": "forbidden"})
+		return nil, false
+	}
+
+	return workout, true
+}
@@ -9,17 +9,33 @@ import (
 	"fem-go-crud/internal/middleware"
 
 	"fem-go-crud/database/migrations"
+	"fem-go-crud/database/seeds"
 	"fem-go-crud/internal/api"
+	"fem-go-crud/internal/jobs"
 	"fem-go-crud/internal/store"
 )
 
 type App struct {
-	Logger         *log.Logger
-	DB             *sql.DB
-	UserHandler    *api.UserHandler
-	UserMiddleware *middleware.UserMiddleware
-	TokenHandler   *api.TokenHandler
-	WorkoutHandler *api.WorkoutHandler
+	Logger             *log.Logger
+	DB                 *sql.DB
+	UserHandler        *api.UserHandler
+	UserMiddleware     *middleware.UserMiddleware
+	Idempotency        *middleware.IdempotencyMiddleware
+	TokenHandler       *api.TokenHandler
+	WorkoutHandler     *api.WorkoutHandler
+	ExerciseHandler    *api.ExerciseHandler
+	TemplateHandler    *api.TemplateHandler
+	ProgramHandler     *api.ProgramHandler
+	RecordHandler      *api.PersonalRecordHandler
+	StatsHandler       *api.StatsHandler
+	MeasurementHandler *api.MeasurementHandler
+	GoalHandler        *api.GoalHandler
+	StreakHandler      *api.StreakHandler
+	CalendarHandler    *api.CalendarHandler
+	ExportHandler      *api.ExportHandler
+	TrashPurger        *jobs.TrashPurger
+	IdempotencyPurger  *jobs.IdempotencyPurger
+	Exporter           *jobs.Exporter
 }
 
 func New() (*App, error) {
@@ -35,28 +51,67 @@ func New() (*App, error) {
 		return nil, err
 	}
 
-	userStore := store.NewPostgresUserStore(db)
-	userHandler := api.NewUserHandler(userStore, logger)
-	userMiddleware := middleware.NewUserMiddleware(userStore)
-
-	tokenStore := store.NewPostgresTokenStore(db)
-	tokenHandler := api.NewTokenHandler(tokenStore, userStore, logger)
+	trashRetention, err := jobs.ParseTrashRetention(os.Getenv("TRASH_RETENTION"))
+	if err != nil {
+		return nil, err
+	}
 
-	workoutStore := store.NewPostgresWorkoutStore(db)
-	workoutHandler := api.NewWorkoutHandler(workoutStore, logger)
+	stores := store.NewPostgresStores(db)
 
-	app := &App{
-		Logger:         logger,
-		DB:             db,
-		UserHandler:    userHandler,
-		UserMiddleware: userMiddleware,
-		TokenHandler:   tokenHandler,
-		WorkoutHandler: workoutHandler,
+	err = store.SeedExerciseCatalog(stores.Exercises, seeds.FS, "exercises.json")
+	if err != nil {
+		return nil, err
 	}
 
+	app := NewWithStores(logger, db, stores)
+	app.TrashPurger = jobs.NewTrashPurger(stores.Workouts, trashRetention, logger)
+	app.IdempotencyPurger = jobs.NewIdempotencyPurger(stores.Idempotency, logger)
+
 	return app, nil
 }
 
+// NewWithStores wires the handlers on top of the given stores, which lets tests
+// run the whole app against the in-memory stores.
+func NewWithStores(logger *log.Logger, db *sql.DB, stores *store.Stores) *App {
+	userHandler := api.NewUserHandler(stores.Users, stores.Tx, logger)
+	userMiddleware := middleware.NewUserMiddleware(stores.Users)
+	idempotencyMiddleware := middleware.NewIdempotencyMiddleware(stores.Idempotency, logger)
+	tokenHandler := api.NewTokenHandler(stores.Tokens, stores.Users, logger)
+	workoutHandler := api.NewWorkoutHandler(stores.Workouts, stores.WorkoutRevisions, stores.Exercises, stores.Measurements, stores.Tx, logger)
+	exerciseHandler := api.NewExerciseHandler(stores.Exercises, logger)
+	templateHandler := api.NewTemplateHandler(stores.Templates, stores.Workouts, stores.Exercises, stores.Enrollments, stores.Tx, logger)
+	programHandler := api.NewProgramHandler(stores.Programs, stores.Enrollments, stores.Templates, stores.Workouts, logger)
+	recordHandler := api.NewPersonalRecordHandler(stores.PersonalRecords, logger)
+	statsHandler := api.NewStatsHandler(stores.Stats, logger)
+	measurementHandler := api.NewMeasurementHandler(stores.Measurements, logger)
+	goalHandler := api.NewGoalHandler(stores.Goals, stores.Exercises, stores.Measurements, logger)
+	streakHandler := api.NewStreakHandler(stores.Streaks, logger)
+	calendarHandler := api.NewCalendarHandler(stores.Workouts, stores.Enrollments, stores.Programs, stores.Users, stores.Tx, api.BaseURL(), logger)
+	exporter := jobs.NewExporter(stores.Users, stores.Exports, stores.Tx, jobs.ExportDir(), logger)
+	exportHandler := api.NewExportHandler(stores.Workouts, stores.Exports, exporter, logger)
+
+	return &App{
+		Logger:             logger,
+		DB:                 db,
+		UserHandler:        userHandler,
+		UserMiddleware:     userMiddleware,
+		Idempotency:        idempotencyMiddleware,
+		TokenHandler:       tokenHandler,
+		WorkoutHandler:     workoutHandler,
+		ExerciseHandler:    exerciseHandler,
+		TemplateHandler:    templateHandler,
+		ProgramHandler:     programHandler,
+		RecordHandler:      recordHandler,
+		StatsHandler:       statsHandler,
+		MeasurementHandler: measurementHandler,
+		GoalHandler:        goalHandler,
+		StreakHandler:      streakHandler,
+		CalendarHandler:    calendarHandler,
+		ExportHandler:      exportHandler,
+		Exporter:           exporter,
+	}
+}
+
 func (a *App) HealthCheck(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	_, err := w.Write([]byte("I'm alive!"))
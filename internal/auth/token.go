@@ -10,6 +10,10 @@ import (
 const (
 	TokenTTL       = 24 * time.Hour
 	TokenScopeAuth = "authentication"
+	// calendar feed tokens are revoked by rotating the feed rather than
+	// expiring, which calendar apps subscribed to it would not notice
+	CalendarTokenTTL   = 10 * 365 * 24 * time.Hour
+	TokenScopeCalendar = "calendar"
 )
 
 type Token struct {
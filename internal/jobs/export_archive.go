@@ -0,0 +1,343 @@
+package jobs
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+
+	"fem-go-crud/internal/store"
+)
+
+// exportPageSize is how many workouts an export reads at a time.
+const exportPageSize = 100
+
+// exportReadme documents the files of an export archive.
+const exportReadme = `Training data export
+====================
+
+This archive holds the training data of one user, as of the time it was
+exported. Weights are in kilograms, lengths in centimeters and durations in
+minutes or seconds as their names tell, whatever the unit system of the user.
+Times are in RFC 3339 format, in UTC. Empty values are unknown.
+
+profile.json
+    The profile of the user, as "user", and the time of the export, as
+    "exported_at".
+
+workouts.json
+    A JSON array of the workouts of the user, oldest first, with their
+    exercises and, for the exercises logged set by set, their sets. Workouts
+    in the trash are in trash.json.
+
+exercises.csv
+    One row per exercise of a workout:
+    workout_id, workout_name, started_at, ended_at, duration_minutes,
+    calories_burned, exercise_id (the exercise within the workout),
+    catalog_exercise_id (the exercise of the catalog it is linked to),
+    order_index, name, sets, reps, duration_seconds, weight_kg, notes.
+    For the exercises logged set by set, sets counts the sets other than
+    warm-ups and reps, duration_seconds and weight_kg are those of the top set.
+
+sets.csv
+    One row per set of the exercises logged set by set:
+    workout_id, exercise_id, exercise_name, set_number, set_type (warmup,
+    working, drop or failure), reps, weight_kg, duration_seconds,
+    distance_meters, rpe, rir, rest_seconds, completed (true or false).
+
+trash.json
+    The workouts in the trash, in the format of workouts.json, with the time
+    they were deleted as "deleted_at". They are purged some time after.
+
+templates.json
+    A JSON array of the workout templates of the user, by name, with their
+    exercises.
+
+measurements.json
+    A JSON array of the body measurements of the user, most recent first.
+
+goals.json
+    A JSON array of the goals of the user, by deadline, with their progress
+    as of the export.
+
+personal_records.json
+    A JSON array of every personal record the workouts of the user set, the
+    ones since beaten included, most recent first.
+`
+
+var (
+	exportExerciseColumns = []string{
+		"workout_id", "workout_name", "started_at", "ended_at", "duration_minutes", "calories_burned",
+		"exercise_id", "catalog_exercise_id", "order_index", "name", "sets", "reps", "duration_seconds", "weight_kg", "notes",
+	}
+	exportSetColumns = []string{
+		"workout_id", "exercise_id", "exercise_name", "set_number", "set_type", "reps", "weight_kg",
+		"duration_seconds", "distance_meters", "rpe", "rir", "rest_seconds", "completed",
+	}
+)
+
+// WriteArchive writes the ZIP archive of the data of user to w, in the
+// format its README.txt documents. Every file is read in one read-only
+// transaction, so that they all hold the data as of the same time, and the
+// workouts a page at a time, once per file, so that they are never all held
+// in memory.
+func (e *Exporter) WriteArchive(w io.Writer, user *store.User, now time.Time) error {
+	archive := zip.NewWriter(w)
+
+	file, err := archive.Create("README.txt")
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(file, exportReadme)
+	if err != nil {
+		return err
+	}
+
+	err = writeJSONFile(archive, "profile.json", map[string]any{"user": user, "exported_at": now.UTC()})
+	if err != nil {
+		return err
+	}
+
+	err = e.txManager.WithinReadTx(func(stores *store.Stores) error {
+		return writeUserData(archive, stores, user.ID)
+	})
+	if err != nil {
+		return err
+	}
+
+	return archive.Close()
+}
+
+func writeUserData(archive *zip.Writer, stores *store.Stores, userID int) error {
+	err := writeWorkoutsJSON(archive, "workouts.json", stores.Workouts, userID, false)
+	if err != nil {
+		return err
+	}
+
+	err = writeWorkoutsCSV(archive, "exercises.csv", stores.Workouts, userID, exportExerciseColumns, exerciseRows)
+	if err != nil {
+		return err
+	}
+
+	err = writeWorkoutsCSV(archive, "sets.csv", stores.Workouts, userID, exportSetColumns, setRows)
+	if err != nil {
+		return err
+	}
+
+	err = writeWorkoutsJSON(archive, "trash.json", stores.Workouts, userID, true)
+	if err != nil {
+		return err
+	}
+
+	// templates are listed without their exercises
+	templates, err := stores.Templates.ListTemplates(userID)
+	if err != nil {
+		return err
+	}
+	for i := range templates {
+		template, err := stores.Templates.GetTemplate(templates[i].ID)
+		if err != nil {
+			return err
+		}
+		if template != nil {
+			templates[i] = *template
+		}
+	}
+	err = writeJSONFile(archive, "templates.json", templates)
+	if err != nil {
+		return err
+	}
+
+	measurements, err := stores.Measurements.ListMeasurements(userID, "", "")
+	if err != nil {
+		return err
+	}
+	err = writeJSONFile(archive, "measurements.json", measurements)
+	if err != nil {
+		return err
+	}
+
+	goals, err := stores.Goals.ListGoals(userID)
+	if err != nil {
+		return err
+	}
+	err = writeJSONFile(archive, "goals.json", goals)
+	if err != nil {
+		return err
+	}
+
+	records, err := stores.PersonalRecords.ListPersonalRecords(userID, true)
+	if err != nil {
+		return err
+	}
+	return writeJSONFile(archive, "personal_records.json", records)
+}
+
+func writeJSONFile(archive *zip.Writer, name string, value any) error {
+	file, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+// eachWorkout calls fn with every workout of a user, or of their trash if
+// trashed, by id.
+func eachWorkout(workoutStore store.WorkoutStore, userID int, trashed bool, fn func(workout *store.Workout) error) error {
+	afterID := 0
+	for {
+		workouts, err := workoutStore.ListWorkoutsAfter(userID, afterID, exportPageSize, trashed)
+		if err != nil {
+			return err
+		}
+
+		for i := range workouts {
+			err = fn(&workouts[i])
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(workouts) < exportPageSize {
+			return nil
+		}
+		afterID = workouts[len(workouts)-1].ID
+	}
+}
+
+func writeWorkoutsJSON(archive *zip.Writer, name string, workoutStore store.WorkoutStore, userID int, trashed bool) error {
+	file, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+
+	separator := "[\n"
+	err = eachWorkout(workoutStore, userID, trashed, func(workout *store.Workout) error {
+		encoded, err := json.Marshal(workout)
+		if err != nil {
+			return err
+		}
+
+		_, err = io.WriteString(file, separator)
+		if err != nil {
+			return err
+		}
+		separator = ",\n"
+
+		_, err = file.Write(encoded)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if separator == "[\n" {
+		_, err = io.WriteString(file, "[]\n")
+		return err
+	}
+
+	_, err = io.WriteString(file, "\n]\n")
+	return err
+}
+
+func writeWorkoutsCSV(archive *zip.Writer, name string, workoutStore store.WorkoutStore, userID int, header []string, rows func(workout *store.Workout) [][]string) error {
+	file, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+
+	writer := csv.NewWriter(file)
+	err = writer.Write(header)
+	if err != nil {
+		return err
+	}
+
+	err = eachWorkout(workoutStore, userID, false, func(workout *store.Workout) error {
+		return writer.WriteAll(rows(workout))
+	})
+	if err != nil {
+		return err
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func exerciseRows(workout *store.Workout) [][]string {
+	rows := make([][]string, 0, len(workout.Exercises))
+	for _, exercise := range workout.Exercises {
+		rows = append(rows, []string{
+			strconv.Itoa(workout.ID),
+			workout.Name,
+			formatExportTime(&workout.StartedAt),
+			formatExportTime(workout.EndedAt),
+			strconv.Itoa(workout.DurationMinutes),
+			formatExportInt(workout.CaloriesBurned),
+			strconv.Itoa(exercise.ID),
+			formatExportInt(exercise.ExerciseID),
+			strconv.Itoa(exercise.OrderIndex),
+			exercise.Name,
+			strconv.Itoa(exercise.Sets),
+			formatExportInt(exercise.Reps),
+			formatExportInt(exercise.DurationSeconds),
+			formatExportFloat(exercise.Weight),
+			exercise.Notes,
+		})
+	}
+
+	return rows
+}
+
+func setRows(workout *store.Workout) [][]string {
+	var rows [][]string
+	for _, exercise := range workout.Exercises {
+		for _, set := range exercise.WorkoutSets {
+			rows = append(rows, []string{
+				strconv.Itoa(workout.ID),
+				strconv.Itoa(exercise.ID),
+				exercise.Name,
+				strconv.Itoa(set.SetNumber),
+				set.SetType,
+				formatExportInt(set.Reps),
+				formatExportFloat(set.Weight),
+				formatExportInt(set.DurationSeconds),
+				formatExportFloat(set.DistanceMeters),
+				formatExportFloat(set.RPE),
+				formatExportInt(set.RIR),
+				formatExportInt(set.RestSeconds),
+				strconv.FormatBool(set.Completed),
+			})
+		}
+	}
+
+	return rows
+}
+
+func formatExportTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+
+	return t.UTC().Format(time.RFC3339)
+}
+
+func formatExportInt(value *int) string {
+	if value == nil {
+		return ""
+	}
+
+	return strconv.Itoa(*value)
+}
+
+func formatExportFloat(value *float64) string {
+	if value == nil {
+		return ""
+	}
+
+	return strconv.FormatFloat(*value, 'f', -1, 64)
+}
@@ -0,0 +1,267 @@
+package jobs
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"fem-go-crud/internal/store"
+)
+
+const (
+	// ExportRetention is how long the archive of an export can be downloaded.
+	ExportRetention = 7 * 24 * time.Hour
+	// exportTimeout is how long an export can stay pending, after which it is
+	// taken for one interrupted by a restart.
+	exportTimeout         = time.Hour
+	exportCleanupInterval = time.Hour
+	// bufferedArchivePrefix starts the names of the files of BufferArchive.
+	bufferedArchivePrefix = "buffered-"
+)
+
+// Exporter builds the archives of the data of users, either for a response,
+// buffered to a temporary file of dir, or, for large exports, in the
+// background to a file of dir.
+type Exporter struct {
+	userStore   store.UserStore
+	exportStore store.ExportStore
+	txManager   store.TxManager
+	dir         string
+	logger      *log.Logger
+}
+
+func NewExporter(us store.UserStore, es store.ExportStore, tm store.TxManager, dir string, l *log.Logger) *Exporter {
+	return &Exporter{
+		userStore:   us,
+		exportStore: es,
+		txManager:   tm,
+		dir:         dir,
+		logger:      l,
+	}
+}
+
+// ExportDir returns the directory the archives of exports are written to,
+// EXPORT_DIR or a directory of the temporary directory if it is empty.
+func ExportDir() string {
+	return cmp.Or(os.Getenv("EXPORT_DIR"), filepath.Join(os.TempDir(), "fem-go-crud-exports"))
+}
+
+// Start creates a pending export of the data of a user and builds its archive
+// in the background. An export of the user created within exportTimeout that
+// is still pending or ready is returned instead, so that a user builds one
+// archive at a time however often they ask.
+func (e *Exporter) Start(userID int) (*store.Export, error) {
+	var export *store.Export
+	created := false
+	err := e.txManager.WithinTx(func(stores *store.Stores) error {
+		var err error
+		export, err = stores.Exports.GetCurrentExport(userID, time.Now().Add(-exportTimeout))
+		if err != nil || export != nil {
+			created = false
+			return err
+		}
+
+		export = &store.Export{UserID: userID}
+		created = true
+		return stores.Exports.CreateExport(export)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if created {
+		go e.build(*export)
+	}
+
+	return export, nil
+}
+
+func (e *Exporter) build(export store.Export) {
+	size, err := e.writeArchiveFile(export)
+	if err != nil {
+		e.logger.Printf("ERROR: building export %d: %v", export.ID, err)
+		export.Status = store.ExportFailed
+		export.Error = "the export could not be built"
+	} else {
+		export.Status = store.ExportReady
+		export.SizeBytes = &size
+	}
+
+	expiresAt := time.Now().Add(ExportRetention)
+	export.ExpiresAt = &expiresAt
+
+	err = e.exportStore.FinishExport(&export)
+	if err != nil {
+		e.logger.Printf("ERROR: finishing export %d: %v", export.ID, err)
+	}
+}
+
+// writeArchiveFile writes the archive of an export to a temporary file that
+// only takes its final name once complete, and returns its size.
+func (e *Exporter) writeArchiveFile(export store.Export) (int64, error) {
+	user, err := e.userStore.GetUserByIdOrUsername(export.UserID, "")
+	if err != nil {
+		return 0, err
+	}
+	if user == nil {
+		return 0, fmt.Errorf("user %d not found", export.UserID)
+	}
+
+	err = os.MkdirAll(e.dir, 0o700)
+	if err != nil {
+		return 0, err
+	}
+
+	path := e.archivePath(export.ID)
+	file, err := os.OpenFile(path+".tmp", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return 0, err
+	}
+
+	err = e.WriteArchive(file, user, time.Now())
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(path+".tmp", path)
+	}
+	if err != nil {
+		_ = os.Remove(path + ".tmp")
+		return 0, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+
+	return info.Size(), nil
+}
+
+// BufferArchive writes the archive of the data of user to a temporary file of
+// dir and returns it rewound, so that it is sent to a client, however slow,
+// once the transaction it is read in is over. The file is removed when it is
+// closed.
+func (e *Exporter) BufferArchive(user *store.User, now time.Time) (*BufferedArchive, error) {
+	err := os.MkdirAll(e.dir, 0o700)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.CreateTemp(e.dir, bufferedArchivePrefix+"*.zip")
+	if err != nil {
+		return nil, err
+	}
+	archive := &BufferedArchive{file}
+
+	err = e.WriteArchive(file, user, now)
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		_ = archive.Close()
+		return nil, err
+	}
+
+	return archive, nil
+}
+
+// BufferedArchive is an archive written to a temporary file by BufferArchive.
+type BufferedArchive struct {
+	*os.File
+}
+
+// Close closes and removes the file of the archive.
+func (a *BufferedArchive) Close() error {
+	return errors.Join(a.File.Close(), os.Remove(a.Name()))
+}
+
+// Open opens the archive of a ready export.
+func (e *Exporter) Open(export *store.Export) (*os.File, error) {
+	return os.Open(e.archivePath(export.ID))
+}
+
+func (e *Exporter) archivePath(exportID int) string {
+	return filepath.Join(e.dir, fmt.Sprintf("export-%d.zip", exportID))
+}
+
+// Run cleans up the exports right away, then every hour until ctx is done.
+func (e *Exporter) Run(ctx context.Context) {
+	ticker := time.NewTicker(exportCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		deleted, err := e.Clean(time.Now())
+		if err != nil {
+			e.logger.Printf("ERROR: cleaning up exports: %v", err)
+		} else if deleted > 0 {
+			e.logger.Printf("deleted %d expired exports", deleted)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Clean deletes the exports that expired or were interrupted as of now, the
+// archives whose export is gone, such as the ones of deleted users, and the
+// buffered archives left over by a restart, and returns how many exports it
+// deleted.
+func (e *Exporter) Clean(now time.Time) (int, error) {
+	deleted, err := e.exportStore.DeleteExpiredExports(now, now.Add(-exportTimeout))
+	if err != nil {
+		return 0, err
+	}
+
+	entries, err := os.ReadDir(e.dir)
+	if os.IsNotExist(err) {
+		return deleted, nil
+	}
+	if err != nil {
+		return deleted, err
+	}
+
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), bufferedArchivePrefix) {
+			info, err := entry.Info()
+			if err == nil && info.ModTime().Before(now.Add(-exportTimeout)) {
+				err = os.Remove(filepath.Join(e.dir, entry.Name()))
+			}
+			if err != nil && !os.IsNotExist(err) {
+				return deleted, err
+			}
+			continue
+		}
+
+		name := strings.TrimSuffix(strings.TrimSuffix(entry.Name(), ".tmp"), ".zip")
+		exportID, err := strconv.Atoi(strings.TrimPrefix(name, "export-"))
+		if err != nil || !strings.HasPrefix(name, "export-") {
+			continue
+		}
+
+		export, err := e.exportStore.GetExport(exportID)
+		if err != nil {
+			return deleted, err
+		}
+
+		if export == nil {
+			err = os.Remove(filepath.Join(e.dir, entry.Name()))
+			if err != nil {
+				return deleted, err
+			}
+		}
+	}
+
+	return deleted, nil
+}
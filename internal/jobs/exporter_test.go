@@ -0,0 +1,212 @@
+package jobs
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"fem-go-crud/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestExporter(t *testing.T) (*Exporter, *store.Stores, *store.User) {
+	stores := store.NewInMemoryStores(store.NewMemoryDB())
+
+	user := &store.User{Username: "alice", Email: "alice@example.com"}
+	require.NoError(t, user.Password.Set("password123"))
+	require.NoError(t, stores.Users.PersistUser(user))
+
+	exporter := NewExporter(stores.Users, stores.Exports, stores.Tx, t.TempDir(), log.New(io.Discard, "", 0))
+
+	return exporter, stores, user
+}
+
+func readArchiveFile(t *testing.T, archive *zip.Reader, name string) []byte {
+	t.Helper()
+
+	file, err := archive.Open(name)
+	require.NoError(t, err)
+	defer func() {
+		_ = file.Close()
+	}()
+
+	content, err := io.ReadAll(file)
+	require.NoError(t, err)
+
+	return content
+}
+
+func TestExporterWriteArchive(t *testing.T) {
+	exporter, stores, user := newTestExporter(t)
+
+	reps, seconds, weight := 5, 60, 100.5
+	// more workouts than fit in a page
+	for i := range exportPageSize + 1 {
+		workout := &store.Workout{UserID: user.ID, Name: "Leg Day", DurationMinutes: 60, Exercises: []store.WorkoutExercise{
+			{Name: "Squat, back", Sets: 1, Reps: &reps, Weight: &weight, OrderIndex: 1, WorkoutSets: []store.WorkoutSet{
+				{SetType: store.WorkoutSetWarmup, Reps: &reps, Completed: true},
+				{SetType: store.WorkoutSetWorking, Reps: &reps, Weight: &weight, Completed: true},
+			}},
+		}}
+		if i > 0 {
+			workout.Exercises = []store.WorkoutExercise{{Name: "Plank", Sets: 3, DurationSeconds: &seconds, OrderIndex: 1}}
+		}
+		require.NoError(t, stores.Workouts.PersistWorkout(workout))
+	}
+
+	trashed := &store.Workout{UserID: user.ID, Name: "Arm Day", DurationMinutes: 30, Exercises: []store.WorkoutExercise{
+		{Name: "Curl", Sets: 3, Reps: &reps, OrderIndex: 1},
+	}}
+	require.NoError(t, stores.Workouts.PersistWorkout(trashed))
+	require.NoError(t, stores.Workouts.DeleteWorkout(trashed.ID, 0))
+	require.NoError(t, stores.Templates.CreateTemplate(&store.WorkoutTemplate{UserID: user.ID, Name: "Legs", DurationMinutes: 60, Exercises: []store.WorkoutExercise{
+		{Name: "Squat", Sets: 5, Reps: &reps, Weight: &weight, OrderIndex: 1},
+	}}))
+	bodyWeight := 80.5
+	require.NoError(t, stores.Measurements.CreateMeasurement(&store.BodyMeasurement{UserID: user.ID, MeasuredOn: "2024-03-01", WeightKg: &bodyWeight}))
+
+	var buffer bytes.Buffer
+	require.NoError(t, exporter.WriteArchive(&buffer, user, time.Now()))
+
+	archive, err := zip.NewReader(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+	require.NoError(t, err)
+	var names []string
+	for _, file := range archive.File {
+		names = append(names, file.Name)
+	}
+	assert.Equal(t, []string{
+		"README.txt", "profile.json", "workouts.json", "exercises.csv", "sets.csv",
+		"trash.json", "templates.json", "measurements.json", "goals.json", "personal_records.json",
+	}, names)
+
+	var profile struct {
+		User store.User `json:"user"`
+	}
+	require.NoError(t, json.Unmarshal(readArchiveFile(t, archive, "profile.json"), &profile))
+	assert.Equal(t, "alice", profile.User.Username)
+	assert.NotContains(t, string(readArchiveFile(t, archive, "profile.json")), "password")
+
+	var workouts []store.Workout
+	require.NoError(t, json.Unmarshal(readArchiveFile(t, archive, "workouts.json"), &workouts))
+	require.Len(t, workouts, exportPageSize+1)
+	assert.Less(t, workouts[0].ID, workouts[1].ID)
+	require.Len(t, workouts[0].Exercises, 1)
+	assert.Len(t, workouts[0].Exercises[0].WorkoutSets, 2)
+
+	exercises, err := csv.NewReader(bytes.NewReader(readArchiveFile(t, archive, "exercises.csv"))).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, exercises, exportPageSize+2)
+	assert.Equal(t, exportExerciseColumns, exercises[0])
+	assert.Equal(t, "Squat, back", exercises[1][9])
+	assert.Equal(t, "100.5", exercises[1][13])
+
+	sets, err := csv.NewReader(bytes.NewReader(readArchiveFile(t, archive, "sets.csv"))).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, sets, 3)
+	assert.Equal(t, exportSetColumns, sets[0])
+	assert.Equal(t, []string{"1", store.WorkoutSetWarmup, "5", ""}, sets[1][3:7])
+	assert.Equal(t, []string{"2", store.WorkoutSetWorking, "5", "100.5"}, sets[2][3:7])
+
+	var trash []store.Workout
+	require.NoError(t, json.Unmarshal(readArchiveFile(t, archive, "trash.json"), &trash))
+	require.Len(t, trash, 1)
+	assert.Equal(t, trashed.ID, trash[0].ID)
+	assert.NotNil(t, trash[0].DeletedAt)
+	require.Len(t, trash[0].Exercises, 1)
+
+	var templates []store.WorkoutTemplate
+	require.NoError(t, json.Unmarshal(readArchiveFile(t, archive, "templates.json"), &templates))
+	require.Len(t, templates, 1)
+	require.Len(t, templates[0].Exercises, 1, "templates are exported with their exercises")
+
+	var measurements []store.BodyMeasurement
+	require.NoError(t, json.Unmarshal(readArchiveFile(t, archive, "measurements.json"), &measurements))
+	require.Len(t, measurements, 1)
+	assert.Equal(t, 80.5, *measurements[0].WeightKg)
+
+	var records []store.PersonalRecord
+	require.NoError(t, json.Unmarshal(readArchiveFile(t, archive, "personal_records.json"), &records))
+	assert.NotEmpty(t, records)
+	assert.JSONEq(t, "[]", string(readArchiveFile(t, archive, "goals.json")))
+}
+
+func TestExporterInBackground(t *testing.T) {
+	exporter, stores, user := newTestExporter(t)
+	require.NoError(t, stores.Workouts.PersistWorkout(&store.Workout{UserID: user.ID, Name: "Leg Day", DurationMinutes: 60}))
+
+	export, err := exporter.Start(user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, store.ExportPending, export.Status)
+
+	again, err := exporter.Start(user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, export.ID, again.ID, "the pending export is reused")
+
+	require.Eventually(t, func() bool {
+		export, err = stores.Exports.GetExport(export.ID)
+		return err == nil && export.Status != store.ExportPending
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, store.ExportReady, export.Status)
+
+	again, err = exporter.Start(user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, export.ID, again.ID, "the ready export is reused")
+
+	archive, err := exporter.Open(export)
+	require.NoError(t, err)
+	info, err := archive.Stat()
+	require.NoError(t, err)
+	assert.Equal(t, *export.SizeBytes, info.Size())
+	require.NoError(t, archive.Close())
+
+	// a file left by an export that is gone
+	orphan := filepath.Join(exporter.dir, "export-999.zip.tmp")
+	require.NoError(t, os.WriteFile(orphan, nil, 0o600))
+
+	deleted, err := exporter.Clean(time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 0, deleted)
+	assert.NoFileExists(t, orphan)
+	assert.FileExists(t, exporter.archivePath(export.ID))
+
+	deleted, err = exporter.Clean(time.Now().Add(ExportRetention + time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+	assert.NoFileExists(t, exporter.archivePath(export.ID))
+}
+
+func TestExporterBufferArchive(t *testing.T) {
+	exporter, stores, user := newTestExporter(t)
+	require.NoError(t, stores.Workouts.PersistWorkout(&store.Workout{UserID: user.ID, Name: "Leg Day", DurationMinutes: 60}))
+
+	archive, err := exporter.BufferArchive(user, time.Now())
+	require.NoError(t, err)
+	info, err := archive.Stat()
+	require.NoError(t, err)
+	reader, err := zip.NewReader(archive, info.Size())
+	require.NoError(t, err)
+	assert.Contains(t, string(readArchiveFile(t, reader, "workouts.json")), "Leg Day")
+
+	require.NoError(t, archive.Close())
+	assert.NoFileExists(t, archive.Name(), "the archive is removed once sent")
+
+	// a buffered archive left by a restart
+	leftover := filepath.Join(exporter.dir, bufferedArchivePrefix+"1.zip")
+	require.NoError(t, os.WriteFile(leftover, nil, 0o600))
+
+	_, err = exporter.Clean(time.Now())
+	require.NoError(t, err)
+	assert.FileExists(t, leftover, "an archive being sent is kept")
+
+	_, err = exporter.Clean(time.Now().Add(exportTimeout + time.Minute))
+	require.NoError(t, err)
+	assert.NoFileExists(t, leftover)
+}
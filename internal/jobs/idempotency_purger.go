@@ -0,0 +1,51 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"fem-go-crud/internal/store"
+)
+
+const idempotencyPurgeInterval = time.Hour
+
+// IdempotencyPurger deletes the idempotency keys that expired, so that the
+// responses they store are not kept longer than they can be replayed.
+type IdempotencyPurger struct {
+	idempotencyStore store.IdempotencyStore
+	logger           *log.Logger
+}
+
+func NewIdempotencyPurger(is store.IdempotencyStore, l *log.Logger) *IdempotencyPurger {
+	return &IdempotencyPurger{
+		idempotencyStore: is,
+		logger:           l,
+	}
+}
+
+// Run purges the expired keys right away, then every hour until ctx is done.
+func (ip *IdempotencyPurger) Run(ctx context.Context) {
+	ticker := time.NewTicker(idempotencyPurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := ip.Purge(time.Now())
+		if err != nil {
+			ip.logger.Printf("ERROR: purging idempotency keys: %v", err)
+		} else if purged > 0 {
+			ip.logger.Printf("purged %d expired idempotency keys", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Purge deletes the keys that expired as of now and returns how many there were.
+func (ip *IdempotencyPurger) Purge(now time.Time) (int, error) {
+	return ip.idempotencyStore.DeleteExpiredIdempotencyKeys(now)
+}
@@ -0,0 +1,31 @@
+package jobs
+
+import (
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"fem-go-crud/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdempotencyPurger(t *testing.T) {
+	stores := store.NewInMemoryStores(store.NewMemoryDB())
+
+	record := &store.IdempotencyRecord{Key: "key", Fingerprint: []byte("fingerprint"), ExpiresAt: time.Now().Add(time.Hour)}
+	existingRecord, err := stores.Idempotency.ReserveIdempotencyKey(record)
+	require.NoError(t, err)
+	require.Nil(t, existingRecord)
+
+	purger := NewIdempotencyPurger(stores.Idempotency, log.New(io.Discard, "", 0))
+
+	purged, err := purger.Purge(time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 0, purged, "the key has not expired yet")
+
+	purged, err = purger.Purge(time.Now().Add(2 * time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+}
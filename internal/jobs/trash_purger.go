@@ -0,0 +1,89 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"fem-go-crud/internal/store"
+)
+
+const (
+	DefaultTrashRetention = 30 * 24 * time.Hour
+	trashPurgeInterval    = time.Hour
+)
+
+// TrashPurger permanently deletes the workouts that have been in the trash for
+// longer than the retention period.
+type TrashPurger struct {
+	workoutStore store.WorkoutStore
+	retention    time.Duration
+	logger       *log.Logger
+}
+
+func NewTrashPurger(ws store.WorkoutStore, retention time.Duration, l *log.Logger) *TrashPurger {
+	return &TrashPurger{
+		workoutStore: ws,
+		retention:    retention,
+		logger:       l,
+	}
+}
+
+// Run purges the trash right away, then every hour until ctx is done.
+func (tp *TrashPurger) Run(ctx context.Context) {
+	ticker := time.NewTicker(trashPurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := tp.Purge(time.Now())
+		if err != nil {
+			tp.logger.Printf("ERROR: purging trash: %v", err)
+		} else if purged > 0 {
+			tp.logger.Printf("purged %d workouts from the trash", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Purge deletes the workouts trashed before now minus the retention period and
+// returns how many there were.
+func (tp *TrashPurger) Purge(now time.Time) (int, error) {
+	return tp.workoutStore.PurgeTrashedWorkouts(now.Add(-tp.retention))
+}
+
+// ParseTrashRetention parses a retention period such as "720h" or "30d". An
+// empty value is the default retention.
+func ParseTrashRetention(value string) (time.Duration, error) {
+	if value == "" {
+		return DefaultTrashRetention, nil
+	}
+
+	var retention time.Duration
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid trash retention %q", value)
+		}
+		retention = time.Duration(n) * 24 * time.Hour
+	} else {
+		var err error
+		retention, err = time.ParseDuration(value)
+		if err != nil {
+			return 0, fmt.Errorf("invalid trash retention %q", value)
+		}
+	}
+
+	if retention <= 0 {
+		return 0, fmt.Errorf("trash retention must be positive, got %q", value)
+	}
+
+	return retention, nil
+}
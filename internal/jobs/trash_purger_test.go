@@ -0,0 +1,66 @@
+package jobs
+
+import (
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"fem-go-crud/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrashPurger(t *testing.T) {
+	stores := store.NewInMemoryStores(store.NewMemoryDB())
+
+	user := &store.User{Username: "alice", Email: "alice@example.com"}
+	require.NoError(t, user.Password.Set("password123"))
+	require.NoError(t, stores.Users.PersistUser(user))
+
+	workout := &store.Workout{UserID: user.ID, Name: "Leg Day", DurationMinutes: 60}
+	require.NoError(t, stores.Workouts.PersistWorkout(workout))
+	require.NoError(t, stores.Workouts.DeleteWorkout(workout.ID, 0))
+
+	purger := NewTrashPurger(stores.Workouts, 24*time.Hour, log.New(io.Discard, "", 0))
+
+	purged, err := purger.Purge(time.Now().Add(23 * time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 0, purged, "the workout is still within the retention period")
+
+	purged, err = purger.Purge(time.Now().Add(25 * time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+
+	trashedWorkout, err := stores.Workouts.GetTrashedWorkout(workout.ID)
+	require.NoError(t, err)
+	assert.Nil(t, trashedWorkout)
+}
+
+func TestParseTrashRetention(t *testing.T) {
+	testCases := []struct {
+		value    string
+		expected time.Duration
+		wantErr  bool
+	}{
+		{value: "", expected: DefaultTrashRetention},
+		{value: "7d", expected: 7 * 24 * time.Hour},
+		{value: "36h", expected: 36 * time.Hour},
+		{value: "0d", wantErr: true},
+		{value: "-1h", wantErr: true},
+		{value: "week", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.value, func(t *testing.T) {
+			retention, err := ParseTrashRetention(tc.value)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, retention)
+		})
+	}
+}
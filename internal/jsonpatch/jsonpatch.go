@@ -0,0 +1,566 @@
+// Package jsonpatch applies JSON Merge Patch (RFC 7396) and JSON Patch
+// (RFC 6902) documents to JSON documents.
+package jsonpatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	MergePatchMediaType = "application/merge-patch+json"
+	JSONPatchMediaType  = "application/json-patch+json"
+)
+
+var (
+	// ErrInvalidPatch is returned for a patch that is not well-formed.
+	ErrInvalidPatch = errors.New("invalid patch")
+	// ErrPathNotFound is returned when an operation refers to a missing location.
+	ErrPathNotFound = errors.New("path not found")
+	// ErrTestFailed is returned when a test operation does not match.
+	ErrTestFailed = errors.New("test operation failed")
+)
+
+// MergePatch applies an RFC 7396 merge patch to document: objects are merged
+// recursively, null removes a member and any other value replaces the target.
+func MergePatch(document, patch []byte) ([]byte, error) {
+	target, err := decode(document)
+	if err != nil {
+		return nil, err
+	}
+
+	patchValue, err := decode(patch)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+
+	return json.Marshal(mergePatch(target, patchValue))
+}
+
+func mergePatch(target, patch any) any {
+	patchObject, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]any)
+	if !ok {
+		targetObject = make(map[string]any, len(patchObject))
+	}
+
+	for name, value := range patchObject {
+		if value == nil {
+			delete(targetObject, name)
+			continue
+		}
+
+		targetObject[name] = mergePatch(targetObject[name], value)
+	}
+
+	return targetObject
+}
+
+type operation struct {
+	Op    string          `json:"op"`
+	Path  *string         `json:"path"`
+	From  *string         `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// Apply applies an RFC 6902 JSON patch to document. The operations are applied
+// in order and if any of them fails, the whole patch fails.
+func Apply(document, patch []byte) ([]byte, error) {
+	target, err := decode(document)
+	if err != nil {
+		return nil, err
+	}
+
+	var operations []operation
+	err = json.Unmarshal(patch, &operations)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+
+	for i, op := range operations {
+		target, err = op.apply(target)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d (%s): %w", i, op.Op, err)
+		}
+	}
+
+	return json.Marshal(target)
+}
+
+func (op operation) apply(target any) (any, error) {
+	if op.Path == nil {
+		return nil, fmt.Errorf("%w: missing path", ErrInvalidPatch)
+	}
+
+	path, err := parsePointer(*op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return nil, fmt.Errorf("%w: missing value", ErrInvalidPatch)
+		}
+
+		value, err := decode(op.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+		}
+
+		switch op.Op {
+		case "add":
+			return add(target, path, value)
+		case "replace":
+			return replace(target, path, value)
+		default:
+			current, err := get(target, path)
+			if err != nil {
+				return nil, err
+			}
+			if !equal(current, value) {
+				return nil, fmt.Errorf("%w: %s", ErrTestFailed, *op.Path)
+			}
+			return target, nil
+		}
+
+	case "remove":
+		return remove(target, path)
+
+	case "move", "copy":
+		if op.From == nil {
+			return nil, fmt.Errorf("%w: missing from", ErrInvalidPatch)
+		}
+
+		from, err := parsePointer(*op.From)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := get(target, from)
+		if err != nil {
+			return nil, err
+		}
+
+		if op.Op == "copy" {
+			return add(target, path, deepCopy(value))
+		}
+
+		if *op.Path == *op.From {
+			return target, nil
+		}
+		if strings.HasPrefix(*op.Path, *op.From+"/") {
+			return nil, fmt.Errorf("%w: cannot move %s into itself", ErrInvalidPatch, *op.From)
+		}
+
+		target, err = remove(target, from)
+		if err != nil {
+			return nil, err
+		}
+		return add(target, path, value)
+
+	default:
+		return nil, fmt.Errorf("%w: unknown op %q", ErrInvalidPatch, op.Op)
+	}
+}
+
+// Diff returns a JSON patch that turns document a into document b. Objects and
+// arrays are compared member by member, so a change deep in a document makes a
+// single small operation.
+func Diff(a, b []byte) ([]byte, error) {
+	from, err := decode(a)
+	if err != nil {
+		return nil, err
+	}
+
+	to, err := decode(b)
+	if err != nil {
+		return nil, err
+	}
+
+	operations, err := diff("", from, to, []operation{})
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(operations)
+}
+
+func diff(path string, from, to any, operations []operation) ([]operation, error) {
+	if equal(from, to) {
+		return operations, nil
+	}
+
+	switch from := from.(type) {
+	case map[string]any:
+		to, ok := to.(map[string]any)
+		if !ok {
+			break
+		}
+
+		for _, name := range sortedKeys(from) {
+			if _, ok := to[name]; !ok {
+				operations = append(operations, newOperation("remove", path+"/"+escapeToken(name), nil))
+			}
+		}
+
+		var err error
+		for _, name := range sortedKeys(to) {
+			memberPath := path + "/" + escapeToken(name)
+			if fromMember, ok := from[name]; ok {
+				operations, err = diff(memberPath, fromMember, to[name], operations)
+				if err != nil {
+					return nil, err
+				}
+				continue
+			}
+
+			operation, err := newValueOperation("add", memberPath, to[name])
+			if err != nil {
+				return nil, err
+			}
+			operations = append(operations, operation)
+		}
+
+		return operations, nil
+
+	case []any:
+		to, ok := to.([]any)
+		if !ok {
+			break
+		}
+
+		common := min(len(from), len(to))
+
+		var err error
+		for i := 0; i < common; i++ {
+			operations, err = diff(path+"/"+strconv.Itoa(i), from[i], to[i], operations)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		// removing from the end keeps the indexes of the remaining elements
+		for i := len(from) - 1; i >= common; i-- {
+			operations = append(operations, newOperation("remove", path+"/"+strconv.Itoa(i), nil))
+		}
+
+		for i := common; i < len(to); i++ {
+			operation, err := newValueOperation("add", path+"/"+strconv.Itoa(i), to[i])
+			if err != nil {
+				return nil, err
+			}
+			operations = append(operations, operation)
+		}
+
+		return operations, nil
+	}
+
+	operation, err := newValueOperation("replace", path, to)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(operations, operation), nil
+}
+
+func newOperation(op, path string, value json.RawMessage) operation {
+	return operation{Op: op, Path: &path, Value: value}
+}
+
+func newValueOperation(op, path string, value any) (operation, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return operation{}, err
+	}
+
+	return newOperation(op, path, encoded), nil
+}
+
+func sortedKeys(object map[string]any) []string {
+	keys := make([]string, 0, len(object))
+	for name := range object {
+		keys = append(keys, name)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func escapeToken(token string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(token)
+}
+
+// parsePointer splits an RFC 6901 JSON pointer into unescaped reference tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("%w: invalid pointer %q", ErrInvalidPatch, pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+
+	return tokens, nil
+}
+
+func get(node any, path []string) (any, error) {
+	for _, token := range path {
+		var err error
+		node, err = child(node, token)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return node, nil
+}
+
+func add(node any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	return update(node, path, func(parent any, token string) (any, error) {
+		switch parent := parent.(type) {
+		case map[string]any:
+			parent[token] = value
+			return parent, nil
+
+		case []any:
+			index := len(parent)
+			if token != "-" {
+				var err error
+				index, err = arrayIndex(token, len(parent)+1)
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			parent = append(parent, nil)
+			copy(parent[index+1:], parent[index:])
+			parent[index] = value
+			return parent, nil
+
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrPathNotFound, token)
+		}
+	})
+}
+
+func remove(node any, path []string) (any, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("%w: cannot remove the whole document", ErrInvalidPatch)
+	}
+
+	return update(node, path, func(parent any, token string) (any, error) {
+		switch parent := parent.(type) {
+		case map[string]any:
+			if _, ok := parent[token]; !ok {
+				return nil, fmt.Errorf("%w: %s", ErrPathNotFound, token)
+			}
+			delete(parent, token)
+			return parent, nil
+
+		case []any:
+			index, err := arrayIndex(token, len(parent))
+			if err != nil {
+				return nil, err
+			}
+			return append(parent[:index], parent[index+1:]...), nil
+
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrPathNotFound, token)
+		}
+	})
+}
+
+func replace(node any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	return update(node, path, func(parent any, token string) (any, error) {
+		_, err := child(parent, token)
+		if err != nil {
+			return nil, err
+		}
+
+		return setChild(parent, token, value)
+	})
+}
+
+// update calls fn with the parent of the location path refers to and the last
+// reference token, and replaces the parent with what fn returns, which lets fn
+// grow or shrink arrays.
+func update(node any, path []string, fn func(parent any, token string) (any, error)) (any, error) {
+	if len(path) == 1 {
+		return fn(node, path[0])
+	}
+
+	next, err := child(node, path[0])
+	if err != nil {
+		return nil, err
+	}
+
+	next, err = update(next, path[1:], fn)
+	if err != nil {
+		return nil, err
+	}
+
+	return setChild(node, path[0], next)
+}
+
+func child(node any, token string) (any, error) {
+	switch node := node.(type) {
+	case map[string]any:
+		value, ok := node[token]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrPathNotFound, token)
+		}
+		return value, nil
+
+	case []any:
+		index, err := arrayIndex(token, len(node))
+		if err != nil {
+			return nil, err
+		}
+		return node[index], nil
+
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrPathNotFound, token)
+	}
+}
+
+func setChild(node any, token string, value any) (any, error) {
+	switch node := node.(type) {
+	case map[string]any:
+		node[token] = value
+		return node, nil
+
+	case []any:
+		index, err := arrayIndex(token, len(node))
+		if err != nil {
+			return nil, err
+		}
+		node[index] = value
+		return node, nil
+
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrPathNotFound, token)
+	}
+}
+
+// arrayIndex parses an array index token, which must be below limit.
+func arrayIndex(token string, limit int) (int, error) {
+	if token == "" || (len(token) > 1 && token[0] == '0') || strings.TrimLeft(token, "0123456789") != "" {
+		return 0, fmt.Errorf("%w: invalid array index %q", ErrInvalidPatch, token)
+	}
+
+	index, err := strconv.Atoi(token)
+	if err != nil || index >= limit {
+		return 0, fmt.Errorf("%w: array index %s", ErrPathNotFound, token)
+	}
+
+	return index, nil
+}
+
+// decode unmarshals a JSON value, keeping numbers as json.Number so that
+// integers survive a round trip unchanged.
+func decode(data []byte) (any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value any
+	err := decoder.Decode(&value)
+	if err != nil {
+		return nil, err
+	}
+
+	if decoder.More() {
+		return nil, errors.New("unexpected data after JSON value")
+	}
+
+	return value, nil
+}
+
+func deepCopy(value any) any {
+	switch value := value.(type) {
+	case map[string]any:
+		valueCopy := make(map[string]any, len(value))
+		for name, member := range value {
+			valueCopy[name] = deepCopy(member)
+		}
+		return valueCopy
+
+	case []any:
+		valueCopy := make([]any, len(value))
+		for i, element := range value {
+			valueCopy[i] = deepCopy(element)
+		}
+		return valueCopy
+
+	default:
+		return value
+	}
+}
+
+// equal compares JSON values as RFC 6902 requires for the test operation:
+// numbers by value, objects regardless of member order.
+func equal(a, b any) bool {
+	switch a := a.(type) {
+	case map[string]any:
+		b, ok := b.(map[string]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for name, member := range a {
+			other, ok := b[name]
+			if !ok || !equal(member, other) {
+				return false
+			}
+		}
+		return true
+
+	case []any:
+		b, ok := b.([]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !equal(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+
+	case json.Number:
+		b, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		if a == b {
+			return true
+		}
+		af, aErr := a.Float64()
+		bf, bErr := b.Float64()
+		return aErr == nil && bErr == nil && af == bf
+
+	default:
+		return a == b
+	}
+}
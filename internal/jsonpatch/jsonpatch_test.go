@@ -0,0 +1,114 @@
+package jsonpatch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergePatch(t *testing.T) {
+	// examples from RFC 7396, appendix A
+	testCases := []struct {
+		name     string
+		document string
+		patch    string
+		expected string
+	}{
+		{name: "replace member", document: `{"a":"b"}`, patch: `{"a":"c"}`, expected: `{"a":"c"}`},
+		{name: "add member", document: `{"a":"b"}`, patch: `{"b":"c"}`, expected: `{"a":"b","b":"c"}`},
+		{name: "remove member", document: `{"a":"b"}`, patch: `{"a":null}`, expected: `{}`},
+		{name: "nested remove", document: `{"a":{"b":"c","d":1}}`, patch: `{"a":{"b":null}}`, expected: `{"a":{"d":1}}`},
+		{name: "arrays are replaced", document: `{"a":[{"b":"c"}]}`, patch: `{"a":[1]}`, expected: `{"a":[1]}`},
+		{name: "non-object patch", document: `{"a":"foo"}`, patch: `"bar"`, expected: `"bar"`},
+		{name: "non-object target", document: `{"e":null}`, patch: `{"a":{"bb":{"ccc":null}}}`, expected: `{"a":{"bb":{}},"e":null}`},
+		{name: "large integers", document: `{"a":9007199254740993}`, patch: `{"b":1}`, expected: `{"a":9007199254740993,"b":1}`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := MergePatch([]byte(tc.document), []byte(tc.patch))
+			require.NoError(t, err)
+			assert.JSONEq(t, tc.expected, string(result))
+		})
+	}
+
+	_, err := MergePatch([]byte(`{}`), []byte(`{`))
+	assert.ErrorIs(t, err, ErrInvalidPatch)
+}
+
+func TestApply(t *testing.T) {
+	// mostly examples from RFC 6902, appendix A
+	testCases := []struct {
+		name        string
+		document    string
+		patch       string
+		expected    string
+		expectedErr error
+	}{
+		{name: "add member", document: `{"foo":"bar"}`, patch: `[{"op":"add","path":"/baz","value":"qux"}]`, expected: `{"baz":"qux","foo":"bar"}`},
+		{name: "add array element", document: `{"foo":["bar","baz"]}`, patch: `[{"op":"add","path":"/foo/1","value":"qux"}]`, expected: `{"foo":["bar","qux","baz"]}`},
+		{name: "append array element", document: `{"foo":[1]}`, patch: `[{"op":"add","path":"/foo/-","value":2}]`, expected: `{"foo":[1,2]}`},
+		{name: "remove member", document: `{"baz":"qux","foo":"bar"}`, patch: `[{"op":"remove","path":"/baz"}]`, expected: `{"foo":"bar"}`},
+		{name: "remove array element", document: `{"foo":["bar","qux","baz"]}`, patch: `[{"op":"remove","path":"/foo/1"}]`, expected: `{"foo":["bar","baz"]}`},
+		{name: "replace", document: `{"baz":"qux","foo":"bar"}`, patch: `[{"op":"replace","path":"/baz","value":"boo"}]`, expected: `{"baz":"boo","foo":"bar"}`},
+		{name: "replace with null", document: `{"baz":"qux"}`, patch: `[{"op":"replace","path":"/baz","value":null}]`, expected: `{"baz":null}`},
+		{name: "move member", document: `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`, patch: `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`, expected: `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`},
+		{name: "move array element", document: `{"foo":["all","grass","cows","eat"]}`, patch: `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`, expected: `{"foo":["all","cows","eat","grass"]}`},
+		{name: "copy", document: `{"foo":{"bar":1}}`, patch: `[{"op":"copy","from":"/foo","path":"/baz"},{"op":"replace","path":"/baz/bar","value":2}]`, expected: `{"foo":{"bar":1},"baz":{"bar":2}}`},
+		{name: "test success", document: `{"baz":"qux","foo":["a",2,"c"]}`, patch: `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2.0}]`, expected: `{"baz":"qux","foo":["a",2,"c"]}`},
+		{name: "escaped pointer", document: `{"/":9,"~1":10}`, patch: `[{"op":"test","path":"/~01","value":10},{"op":"remove","path":"/~1"}]`, expected: `{"~1":10}`},
+		{name: "replace whole document", document: `{"foo":1}`, patch: `[{"op":"replace","path":"","value":[1]}]`, expected: `[1]`},
+		{name: "test failure", document: `{"baz":"qux"}`, patch: `[{"op":"test","path":"/baz","value":"bar"}]`, expectedErr: ErrTestFailed},
+		{name: "add to missing parent", document: `{"foo":"bar"}`, patch: `[{"op":"add","path":"/baz/bat","value":"qux"}]`, expectedErr: ErrPathNotFound},
+		{name: "replace missing member", document: `{"foo":"bar"}`, patch: `[{"op":"replace","path":"/baz","value":"qux"}]`, expectedErr: ErrPathNotFound},
+		{name: "array index out of bounds", document: `{"foo":[1]}`, patch: `[{"op":"add","path":"/foo/2","value":3}]`, expectedErr: ErrPathNotFound},
+		{name: "invalid array index", document: `{"foo":[1]}`, patch: `[{"op":"remove","path":"/foo/01"}]`, expectedErr: ErrInvalidPatch},
+		{name: "move into itself", document: `{"foo":{"bar":1}}`, patch: `[{"op":"move","from":"/foo","path":"/foo/bar/baz"}]`, expectedErr: ErrInvalidPatch},
+		{name: "missing value", document: `{"foo":1}`, patch: `[{"op":"add","path":"/bar"}]`, expectedErr: ErrInvalidPatch},
+		{name: "unknown op", document: `{"foo":1}`, patch: `[{"op":"merge","path":"/foo","value":1}]`, expectedErr: ErrInvalidPatch},
+		{name: "not an array", document: `{"foo":1}`, patch: `{"op":"add","path":"/foo","value":1}`, expectedErr: ErrInvalidPatch},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := Apply([]byte(tc.document), []byte(tc.patch))
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, err, tc.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.JSONEq(t, tc.expected, string(result))
+		})
+	}
+}
+
+func TestDiff(t *testing.T) {
+	testCases := []struct {
+		name     string
+		from     string
+		to       string
+		expected string
+	}{
+		{name: "equal", from: `{"a":1,"b":[1,2]}`, to: `{"b":[1,2],"a":1.0}`, expected: `[]`},
+		{name: "nested member", from: `{"a":{"b":1,"c":2}}`, to: `{"a":{"b":1,"c":3}}`, expected: `[{"op":"replace","path":"/a/c","value":3}]`},
+		{name: "add and remove members", from: `{"a":1,"b/c":2}`, to: `{"a":1,"d":null}`, expected: `[{"op":"remove","path":"/b~1c"},{"op":"add","path":"/d","value":null}]`},
+		{name: "grow array", from: `{"a":[1]}`, to: `{"a":[1,2,3]}`, expected: `[{"op":"add","path":"/a/1","value":2},{"op":"add","path":"/a/2","value":3}]`},
+		{name: "shrink array", from: `{"a":[1,2,3]}`, to: `{"a":[0]}`, expected: `[{"op":"replace","path":"/a/0","value":0},{"op":"remove","path":"/a/2"},{"op":"remove","path":"/a/1"}]`},
+		{name: "type change", from: `{"a":{"b":1}}`, to: `{"a":[1]}`, expected: `[{"op":"replace","path":"/a","value":[1]}]`},
+		{name: "whole document", from: `null`, to: `{"a":1}`, expected: `[{"op":"replace","path":"","value":{"a":1}}]`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			patch, err := Diff([]byte(tc.from), []byte(tc.to))
+			require.NoError(t, err)
+			assert.JSONEq(t, tc.expected, string(patch))
+
+			result, err := Apply([]byte(tc.from), patch)
+			require.NoError(t, err)
+			assert.JSONEq(t, tc.to, string(result))
+		})
+	}
+}
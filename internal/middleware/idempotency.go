@@ -0,0 +1,244 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"fem-go-crud/internal/store"
+	"fem-go-crud/internal/utils"
+)
+
+const (
+	IdempotencyKeyHeader  = "Idempotency-Key"
+	IdempotencyKeyTTL     = 24 * time.Hour
+	idempotencyKeyMaxLen  = 255
+	idempotencyWait       = 5 * time.Second
+	idempotencyPollPeriod = 50 * time.Millisecond
+)
+
+type IdempotencyMiddleware struct {
+	IdempotencyStore store.IdempotencyStore
+	Logger           *log.Logger
+}
+
+func NewIdempotencyMiddleware(is store.IdempotencyStore, l *log.Logger) *IdempotencyMiddleware {
+	return &IdempotencyMiddleware{
+		IdempotencyStore: is,
+		Logger:           l,
+	}
+}
+
+// Idempotent makes a request carrying an Idempotency-Key header safe to retry:
+// the first response is stored per user and key, and replayed for repeats of
+// the same request. A repeat with a different payload, passwords aside, is
+// rejected, and a repeat of a request still in progress waits for it, then
+// gets a 409.
+func (im *IdempotencyMiddleware) Idempotent(next http.Handler) http.Handler {
+	return im.idempotent(next, true)
+}
+
+// IdempotentReissue is Idempotent for the responses holding secrets, such as
+// bearer tokens, which must not be stored: only their status is, and a repeat
+// of a completed request is served again, issuing a new secret, rather than
+// replayed.
+func (im *IdempotencyMiddleware) IdempotentReissue(next http.Handler) http.Handler {
+	return im.idempotent(next, false)
+}
+
+func (im *IdempotencyMiddleware) idempotent(next http.Handler, replay bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyKeyHeader)
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if len(key) > idempotencyKeyMaxLen {
+			_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": "invalid idempotency key"})
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			im.Logger.Printf("ERROR: %v", err)
+			_ = utils.WriteJSONResponse(w, http.StatusBadRequest, utils.Envelope{"error": "bad request"})
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		record := &store.IdempotencyRecord{
+			UserID:      idempotencyUserID(r),
+			Key:         key,
+			Fingerprint: requestFingerprint(r, body),
+			ExpiresAt:   time.Now().Add(IdempotencyKeyTTL),
+		}
+
+		deadline := time.Now().Add(idempotencyWait)
+		for {
+			existingRecord, err := im.IdempotencyStore.ReserveIdempotencyKey(record)
+			if err != nil {
+				im.Logger.Printf("ERROR: %v", err)
+				_ = utils.WriteJSONResponse(w, http.StatusInternalServerError, utils.Envelope{"error": "failed"})
+				return
+			}
+
+			if existingRecord == nil {
+				break
+			}
+
+			if !bytes.Equal(existingRecord.Fingerprint, record.Fingerprint) {
+				im.Logger.Printf("ERROR: idempotency key %q reused with a different request", key)
+				_ = utils.WriteJSONResponse(w, http.StatusUnprocessableEntity, utils.Envelope{"error": "idempotency key reused with a different request"})
+				return
+			}
+
+			if existingRecord.IsComplete() {
+				if replay {
+					replayResponse(w, existingRecord)
+				} else {
+					next.ServeHTTP(w, r)
+				}
+				return
+			}
+
+			if time.Now().After(deadline) {
+				im.Logger.Printf("ERROR: idempotency key %q still in progress", key)
+				_ = utils.WriteJSONResponse(w, http.StatusConflict, utils.Envelope{"error": "a request with this idempotency key is in progress"})
+				return
+			}
+
+			time.Sleep(idempotencyPollPeriod)
+		}
+
+		stored := false
+		defer func() {
+			// a panicking handler must not leave the key reserved until it expires
+			if !stored {
+				_ = im.IdempotencyStore.ReleaseIdempotencyKey(record.UserID, record.Key)
+			}
+		}()
+
+		recorder := newResponseRecorder()
+		next.ServeHTTP(recorder, r)
+
+		// server errors are not stored, so the client can retry with the same key
+		if recorder.status >= http.StatusInternalServerError {
+			err = im.IdempotencyStore.ReleaseIdempotencyKey(record.UserID, record.Key)
+		} else {
+			record.ResponseStatus = recorder.status
+			if replay {
+				record.ResponseHeaders = recorder.header
+				record.ResponseBody = recorder.body.Bytes()
+			}
+			err = im.IdempotencyStore.CompleteIdempotencyKey(record)
+		}
+		stored = true
+		if err != nil {
+			im.Logger.Printf("ERROR: %v", err)
+		}
+
+		recorder.writeTo(w)
+	})
+}
+
+// idempotencyUserID scopes keys to the current user, or to 0 on public routes.
+func idempotencyUserID(r *http.Request) int {
+	user, ok := r.Context().Value(UserContextKey).(*store.User)
+	if !ok || user.IsAnonymous() {
+		return 0
+	}
+
+	return user.ID
+}
+
+// secretFields are the fields of a JSON body left out of its fingerprint, so
+// that the stored fingerprints never hold a fast hash of a password.
+var secretFields = []string{"password", "current_password", "new_password"}
+
+func requestFingerprint(r *http.Request, body []byte) []byte {
+	hash := sha256.New()
+	hash.Write([]byte(r.Method + " " + r.URL.RequestURI() + "\n"))
+	hash.Write(withoutSecretFields(body))
+
+	return hash.Sum(nil)
+}
+
+// withoutSecretFields returns body without its secretFields, if it is a JSON
+// object that has any, and body itself otherwise.
+func withoutSecretFields(body []byte) []byte {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(body, &fields) != nil {
+		return body
+	}
+
+	found := false
+	for _, name := range secretFields {
+		if _, ok := fields[name]; ok {
+			delete(fields, name)
+			found = true
+		}
+	}
+	if !found {
+		return body
+	}
+
+	// the keys of a map are marshaled in order
+	stripped, err := json.Marshal(fields)
+	if err != nil {
+		return body
+	}
+
+	return stripped
+}
+
+func replayResponse(w http.ResponseWriter, record *store.IdempotencyRecord) {
+	for name, values := range record.ResponseHeaders {
+		w.Header()[name] = values
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(record.ResponseStatus)
+	_, _ = w.Write(record.ResponseBody)
+}
+
+// responseRecorder buffers a response so it can be stored before being sent.
+type responseRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newResponseRecorder() *responseRecorder {
+	return &responseRecorder{
+		header: make(http.Header),
+	}
+}
+
+func (rr *responseRecorder) Header() http.Header {
+	return rr.header
+}
+
+func (rr *responseRecorder) WriteHeader(status int) {
+	if rr.status == 0 {
+		rr.status = status
+	}
+}
+
+func (rr *responseRecorder) Write(data []byte) (int, error) {
+	rr.WriteHeader(http.StatusOK)
+	return rr.body.Write(data)
+}
+
+func (rr *responseRecorder) writeTo(w http.ResponseWriter) {
+	rr.WriteHeader(http.StatusOK)
+
+	for name, values := range rr.header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(rr.status)
+	_, _ = w.Write(rr.body.Bytes())
+}
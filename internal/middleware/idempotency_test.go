@@ -0,0 +1,140 @@
+package middleware
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"fem-go-crud/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdempotentConcurrentDuplicates(t *testing.T) {
+	idempotencyMiddleware := NewIdempotencyMiddleware(
+		store.NewInMemoryIdempotencyStore(store.NewMemoryDB()),
+		log.New(io.Discard, "", 0),
+	)
+
+	var calls atomic.Int32
+	release := make(chan struct{})
+	handler := idempotencyMiddleware.Idempotent(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		<-release
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("created"))
+	}))
+
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/workouts", strings.NewReader(`{"name":"Leg Day"}`))
+		req.Header.Set(IdempotencyKeyHeader, "key")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	first := make(chan *httptest.ResponseRecorder)
+	go func() {
+		first <- send()
+	}()
+	require.Eventually(t, func() bool { return calls.Load() == 1 }, time.Second, time.Millisecond)
+
+	duplicate := make(chan *httptest.ResponseRecorder)
+	go func() {
+		duplicate <- send()
+	}()
+
+	// the duplicate waits for the first request instead of running the handler
+	time.Sleep(2 * idempotencyPollPeriod)
+	close(release)
+
+	firstRes := <-first
+	duplicateRes := <-duplicate
+
+	assert.Equal(t, int32(1), calls.Load())
+	assert.Equal(t, http.StatusCreated, firstRes.Code)
+	assert.Equal(t, http.StatusCreated, duplicateRes.Code)
+	assert.Equal(t, "created", duplicateRes.Body.String())
+	assert.Equal(t, "true", duplicateRes.Header().Get("Idempotent-Replayed"))
+}
+
+func TestIdempotentServerErrorReleasesKey(t *testing.T) {
+	idempotencyMiddleware := NewIdempotencyMiddleware(
+		store.NewInMemoryIdempotencyStore(store.NewMemoryDB()),
+		log.New(io.Discard, "", 0),
+	)
+
+	var calls atomic.Int32
+	handler := idempotencyMiddleware.Idempotent(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	for _, expectedStatus := range []int{http.StatusInternalServerError, http.StatusCreated} {
+		req := httptest.NewRequest(http.MethodPost, "/workouts", strings.NewReader(`{}`))
+		req.Header.Set(IdempotencyKeyHeader, "key")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, expectedStatus, rec.Code)
+	}
+
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestIdempotentReissueStoresNoSecret(t *testing.T) {
+	idempotencyStore := store.NewInMemoryIdempotencyStore(store.NewMemoryDB())
+	idempotencyMiddleware := NewIdempotencyMiddleware(idempotencyStore, log.New(io.Discard, "", 0))
+
+	var calls atomic.Int32
+	handler := idempotencyMiddleware.IdempotentReissue(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		_, _ = fmt.Fprintf(w, "token-%d", calls.Add(1))
+	}))
+
+	send := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/tokens/authenticate", strings.NewReader(body))
+		req.Header.Set(IdempotencyKeyHeader, "key")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	first := send(`{"username":"alice"}`)
+	assert.Equal(t, http.StatusCreated, first.Code)
+	assert.Equal(t, "token-1", first.Body.String())
+
+	// a repeat issues a new token, as the first one was not stored
+	retry := send(`{"username":"alice"}`)
+	assert.Equal(t, http.StatusCreated, retry.Code)
+	assert.Equal(t, "token-2", retry.Body.String())
+	assert.Empty(t, retry.Header().Get("Idempotent-Replayed"))
+
+	assert.Equal(t, http.StatusUnprocessableEntity, send(`{"username":"bob"}`).Code)
+
+	record, err := idempotencyStore.ReserveIdempotencyKey(&store.IdempotencyRecord{Key: "key", ExpiresAt: time.Now().Add(time.Hour)})
+	require.NoError(t, err)
+	require.NotNil(t, record)
+	assert.Equal(t, http.StatusCreated, record.ResponseStatus)
+	assert.Empty(t, record.ResponseBody)
+}
+
+func TestRequestFingerprintLeavesOutPasswords(t *testing.T) {
+	fingerprint := func(body string) []byte {
+		return requestFingerprint(httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(body)), []byte(body))
+	}
+
+	withPassword := fingerprint(`{"username":"alice","password":"password123"}`)
+	assert.Equal(t, fingerprint(`{"password":"another one","username":"alice"}`), withPassword)
+	assert.Equal(t, fingerprint(`{"username":"alice"}`), withPassword)
+	assert.NotEqual(t, fingerprint(`{"username":"bob","password":"password123"}`), withPassword)
+	assert.NotEqual(t, fingerprint(`not json`), fingerprint(`not json!`))
+}
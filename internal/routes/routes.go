@@ -10,18 +10,81 @@ func MakeRouter(app *app.App) (r *chi.Mux) {
 
 	// public routes
 	r.Get("/poke", app.HealthCheck)
-	r.Post("/users", app.UserHandler.RegisterUser)
-	r.Post("/tokens/authenticate", app.TokenHandler.CreateToken)
+	r.With(app.Idempotency.Idempotent).Post("/users", app.UserHandler.RegisterUser)
+	r.With(app.Idempotency.IdempotentReissue).Post("/tokens/authenticate", app.TokenHandler.CreateToken)
+	// calendar apps authenticate with the token of the feed URL
+	r.Get("/calendar/{token}.ics", app.CalendarHandler.GetCalendarFeed)
 
 	// protected routes
 	r.Group(func(r chi.Router) {
 		// Question: Can't we just merge the two middlewares into one? (set user in context + check if valid/authorized)
 		r.Use(app.UserMiddleware.Authenticate, app.UserMiddleware.RequireUser)
 		r.Get("/users/{userId}", app.UserHandler.GetUser)
+		r.Put("/users/me/password", app.UserHandler.ChangePassword)
+		r.Patch("/users/me", app.UserHandler.UpdateCurrentUser)
+		r.Delete("/users/me", app.UserHandler.DeleteCurrentUser)
+		r.Post("/users/me/legacy-weights", app.UserHandler.ResolveLegacyWeights)
+		r.Get("/users/me/records", app.RecordHandler.ListPersonalRecords)
+		r.Get("/users/me/stats", app.StatsHandler.GetTrainingStats)
+		r.Get("/users/me/exercises/{name}/progress", app.StatsHandler.GetExerciseProgress)
+		r.Get("/users/me/measurements", app.MeasurementHandler.ListMeasurements)
+		r.Get("/users/me/measurements/latest", app.MeasurementHandler.GetLatestMeasurements)
+		r.Get("/users/me/measurements/{measurementId}", app.MeasurementHandler.GetMeasurement)
+		r.With(app.Idempotency.Idempotent).Post("/users/me/measurements", app.MeasurementHandler.CreateMeasurement)
+		r.Put("/users/me/measurements/{measurementId}", app.MeasurementHandler.UpdateMeasurement)
+		r.Delete("/users/me/measurements/{measurementId}", app.MeasurementHandler.DeleteMeasurement)
+		r.Get("/users/me/goals", app.GoalHandler.ListGoals)
+		r.Get("/users/me/goals/{goalId}", app.GoalHandler.GetGoal)
+		r.With(app.Idempotency.Idempotent).Post("/users/me/goals", app.GoalHandler.CreateGoal)
+		r.Put("/users/me/goals/{goalId}", app.GoalHandler.UpdateGoal)
+		r.Delete("/users/me/goals/{goalId}", app.GoalHandler.DeleteGoal)
+		r.Get("/users/me/streaks", app.StreakHandler.GetStreaks)
+		r.Get("/users/me/calendar", app.CalendarHandler.GetCalendar)
+		r.Post("/users/me/calendar/feed", app.CalendarHandler.CreateCalendarFeed)
+		r.Delete("/users/me/calendar/feed", app.CalendarHandler.DeleteCalendarFeed)
+		r.Get("/users/me/export", app.ExportHandler.ExportData)
+		r.Get("/users/me/exports/{exportId}", app.ExportHandler.GetExport)
+		r.Get("/users/me/exports/{exportId}/download", app.ExportHandler.DownloadExport)
+		r.Get("/exercises", app.ExerciseHandler.SearchExercises)
+		r.Get("/exercises/{exerciseId}", app.ExerciseHandler.GetExercise)
+		r.With(app.Idempotency.Idempotent).Post("/exercises", app.ExerciseHandler.CreateExercise)
+		r.Put("/exercises/{exerciseId}", app.ExerciseHandler.UpdateExercise)
+		r.Delete("/exercises/{exerciseId}", app.ExerciseHandler.DeleteExercise)
+		r.Get("/templates", app.TemplateHandler.ListTemplates)
+		r.Get("/templates/{templateId}", app.TemplateHandler.GetTemplate)
+		r.With(app.Idempotency.Idempotent).Post("/templates", app.TemplateHandler.CreateTemplate)
+		r.Put("/templates/{templateId}", app.TemplateHandler.UpdateTemplate)
+		r.Delete("/templates/{templateId}", app.TemplateHandler.DeleteTemplate)
+		r.With(app.Idempotency.Idempotent).Post("/templates/{templateId}/start", app.TemplateHandler.StartTemplate)
+		r.With(app.Idempotency.Idempotent).Post("/workouts/{workoutId}/template", app.TemplateHandler.CreateTemplateFromWorkout)
+		r.Get("/programs", app.ProgramHandler.ListPrograms)
+		r.Get("/programs/{programId}", app.ProgramHandler.GetProgram)
+		r.With(app.Idempotency.Idempotent).Post("/programs", app.ProgramHandler.CreateProgram)
+		r.Put("/programs/{programId}", app.ProgramHandler.UpdateProgram)
+		r.Delete("/programs/{programId}", app.ProgramHandler.DeleteProgram)
+		r.With(app.Idempotency.Idempotent).Post("/programs/{programId}/enrollments", app.ProgramHandler.EnrollInProgram)
+		r.Get("/enrollments", app.ProgramHandler.ListEnrollments)
+		r.Get("/enrollments/{enrollmentId}", app.ProgramHandler.GetEnrollment)
+		r.Delete("/enrollments/{enrollmentId}", app.ProgramHandler.DeleteEnrollment)
+		r.Put("/enrollments/{enrollmentId}/sessions/{sessionId}/workout", app.ProgramHandler.CompleteSession)
+		r.Delete("/enrollments/{enrollmentId}/sessions/{sessionId}/workout", app.ProgramHandler.UncompleteSession)
+		r.Get("/workouts/search", app.WorkoutHandler.SearchWorkouts)
+		r.Get("/workouts/trash", app.WorkoutHandler.ListTrashedWorkouts)
+		r.Delete("/workouts/trash/{workoutId}", app.WorkoutHandler.PurgeTrashedWorkout)
+		r.Post("/workouts/{workoutId}/restore", app.WorkoutHandler.RestoreTrashedWorkout)
 		r.Get("/workouts/{workoutId}", app.WorkoutHandler.GetWorkout)
-		r.Post("/workouts", app.WorkoutHandler.CreateWorkout)
+		r.With(app.Idempotency.Idempotent).Post("/workouts", app.WorkoutHandler.CreateWorkout)
+		r.With(app.Idempotency.Idempotent).Post("/workouts/batch", app.WorkoutHandler.BatchWorkouts)
 		r.Put("/workouts/{workoutId}", app.WorkoutHandler.UpdateWorkout)
+		r.Patch("/workouts/{workoutId}", app.WorkoutHandler.PatchWorkout)
 		r.Delete("/workouts/{workoutId}", app.WorkoutHandler.DeleteWorkout)
+		r.With(app.Idempotency.Idempotent).Post("/workouts/{workoutId}/exercises", app.WorkoutHandler.AddWorkoutExercise)
+		r.Put("/workouts/{workoutId}/exercises/order", app.WorkoutHandler.ReorderWorkoutExercises)
+		r.Put("/workouts/{workoutId}/exercises/{exerciseId}", app.WorkoutHandler.UpdateWorkoutExercise)
+		r.Delete("/workouts/{workoutId}/exercises/{exerciseId}", app.WorkoutHandler.DeleteWorkoutExercise)
+		r.Get("/workouts/{workoutId}/revisions", app.WorkoutHandler.ListWorkoutRevisions)
+		r.Get("/workouts/{workoutId}/revisions/{revision}", app.WorkoutHandler.GetWorkoutRevision)
+		r.Post("/workouts/{workoutId}/revisions/{revision}/restore", app.WorkoutHandler.RestoreWorkoutRevision)
 	})
 
 	return
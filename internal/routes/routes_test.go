@@ -0,0 +1,2349 @@
+package routes
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"fem-go-crud/database/seeds"
+	"fem-go-crud/internal/app"
+	"fem-go-crud/internal/store"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testServer struct {
+	t      *testing.T
+	router *chi.Mux
+}
+
+func newTestServer(t *testing.T) *testServer {
+	logger := log.New(io.Discard, "", 0)
+	stores := store.NewInMemoryStores(store.NewMemoryDB())
+	require.NoError(t, store.SeedExerciseCatalog(stores.Exercises, seeds.FS, "exercises.json"))
+
+	return &testServer{
+		t:      t,
+		router: MakeRouter(app.NewWithStores(logger, nil, stores)),
+	}
+}
+
+type testResponse struct {
+	status int
+	header http.Header
+	body   map[string]any
+	raw    []byte
+}
+
+func (ts *testServer) do(method, path, token string, payload any) *testResponse {
+	ts.t.Helper()
+
+	return ts.doWithHeaders(method, path, token, payload, nil)
+}
+
+func (ts *testServer) doWithHeaders(method, path, token string, payload any, headers map[string]string) *testResponse {
+	ts.t.Helper()
+
+	var body io.Reader
+	switch p := payload.(type) {
+	case nil:
+	case string:
+		body = bytes.NewBufferString(p)
+	default:
+		encoded, err := json.Marshal(p)
+		require.NoError(ts.t, err)
+		body = bytes.NewBuffer(encoded)
+	}
+
+	req := httptest.NewRequest(method, path, body)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	rec := httptest.NewRecorder()
+	ts.router.ServeHTTP(rec, req)
+
+	res := &testResponse{
+		status: rec.Code,
+		header: rec.Header(),
+		raw:    rec.Body.Bytes(),
+	}
+	if rec.Header().Get("Content-Type") == "application/json" {
+		require.NoError(ts.t, json.Unmarshal(res.raw, &res.body))
+	}
+
+	return res
+}
+
+// registerAndLogin creates a user and returns its id and an authentication token.
+func (ts *testServer) registerAndLogin(username string) (int, string) {
+	ts.t.Helper()
+
+	res := ts.do(http.MethodPost, "/users", "", map[string]string{
+		"username": username,
+		"email":    username + "@example.com",
+		"password": "password123",
+	})
+	require.Equal(ts.t, http.StatusCreated, res.status)
+	userID := int(res.body["user"].(map[string]any)["id"].(float64))
+
+	res = ts.do(http.MethodPost, "/tokens/authenticate", "", map[string]string{
+		"username": username,
+		"password": "password123",
+	})
+	require.Equal(ts.t, http.StatusCreated, res.status)
+	token := res.body["token"].(map[string]any)["token"].(string)
+
+	return userID, token
+}
+
+func (ts *testServer) createWorkout(token string) int {
+	ts.t.Helper()
+
+	res := ts.do(http.MethodPost, "/workouts", token, testWorkoutPayload())
+	require.Equal(ts.t, http.StatusCreated, res.status)
+
+	return int(res.body["workout"].(map[string]any)["id"].(float64))
+}
+
+func testWorkoutPayload() map[string]any {
+	return map[string]any{
+		"name":             "Leg Day",
+		"description":      "Squats and core",
+		"duration_minutes": 60,
+		"calories_burned":  400,
+		"exercises": []map[string]any{
+			{"name": "Squat", "sets": 5, "reps": 5, "weight": 100, "order_index": 1},
+			{"name": "Plank", "sets": 3, "duration_seconds": 60, "order_index": 2},
+		},
+	}
+}
+
+func TestHealthCheck(t *testing.T) {
+	ts := newTestServer(t)
+
+	res := ts.do(http.MethodGet, "/poke", "", nil)
+	assert.Equal(t, http.StatusOK, res.status)
+	assert.Equal(t, "I'm alive!", string(res.raw))
+}
+
+func TestRegisterUser(t *testing.T) {
+	ts := newTestServer(t)
+
+	testCases := []struct {
+		name           string
+		payload        any
+		expectedStatus int
+	}{
+		{
+			name:           "valid user",
+			payload:        map[string]string{"username": "alice", "email": "alice@example.com", "password": "password123"},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "malformed json",
+			payload:        "{",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "missing username",
+			payload:        map[string]string{"email": "bob@example.com", "password": "password123"},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid email",
+			payload:        map[string]string{"username": "bob", "email": "not-an-email", "password": "password123"},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "password without digit",
+			payload:        map[string]string{"username": "bob", "email": "bob@example.com", "password": "password"},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "duplicate username",
+			payload:        map[string]string{"username": "alice", "email": "alice2@example.com", "password": "password123"},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res := ts.do(http.MethodPost, "/users", "", tc.payload)
+			assert.Equal(t, tc.expectedStatus, res.status)
+		})
+	}
+
+	res := ts.do(http.MethodPost, "/users", "", map[string]string{"username": "carol", "email": "carol@example.com", "password": "password123"})
+	require.Equal(t, http.StatusCreated, res.status)
+	user := res.body["user"].(map[string]any)
+	assert.Equal(t, "carol", user["username"])
+	assert.NotContains(t, user, "password")
+}
+
+func TestCreateToken(t *testing.T) {
+	ts := newTestServer(t)
+	ts.registerAndLogin("alice")
+
+	testCases := []struct {
+		name           string
+		payload        any
+		expectedStatus int
+	}{
+		{
+			name:           "valid credentials",
+			payload:        map[string]string{"username": "alice", "password": "password123"},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "malformed json",
+			payload:        "{",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "unknown user",
+			payload:        map[string]string{"username": "nobody", "password": "password123"},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "wrong password",
+			payload:        map[string]string{"username": "alice", "password": "wrong-password1"},
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res := ts.do(http.MethodPost, "/tokens/authenticate", "", tc.payload)
+			assert.Equal(t, tc.expectedStatus, res.status)
+		})
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	ts := newTestServer(t)
+	userID, _ := ts.registerAndLogin("alice")
+	path := fmt.Sprintf("/users/%d", userID)
+
+	res := ts.do(http.MethodGet, path, "", nil)
+	assert.Equal(t, http.StatusUnauthorized, res.status)
+
+	res = ts.do(http.MethodGet, path, "invalid-token", nil)
+	assert.Equal(t, http.StatusUnauthorized, res.status)
+
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("Authorization", "Basic abc")
+	rec := httptest.NewRecorder()
+	ts.router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestGetUser(t *testing.T) {
+	ts := newTestServer(t)
+	userID, token := ts.registerAndLogin("alice")
+
+	res := ts.do(http.MethodGet, fmt.Sprintf("/users/%d", userID), token, nil)
+	require.Equal(t, http.StatusOK, res.status)
+	assert.Equal(t, "alice", res.body["user"].(map[string]any)["username"])
+
+	res = ts.do(http.MethodGet, fmt.Sprintf("/users/%d", userID+1000), token, nil)
+	assert.Equal(t, http.StatusNotFound, res.status)
+
+	res = ts.do(http.MethodGet, "/users/abc", token, nil)
+	assert.Equal(t, http.StatusBadRequest, res.status)
+}
+
+func TestChangePassword(t *testing.T) {
+	ts := newTestServer(t)
+	_, token := ts.registerAndLogin("alice")
+
+	res := ts.do(http.MethodPut, "/users/me/password", token, map[string]string{"current_password": "wrong-password1", "new_password": "new-password456"})
+	assert.Equal(t, http.StatusUnauthorized, res.status)
+
+	res = ts.do(http.MethodPut, "/users/me/password", token, map[string]string{"current_password": "password123", "new_password": "short"})
+	assert.Equal(t, http.StatusBadRequest, res.status)
+
+	res = ts.do(http.MethodPut, "/users/me/password", token, "{")
+	assert.Equal(t, http.StatusBadRequest, res.status)
+
+	res = ts.do(http.MethodPut, "/users/me/password", token, map[string]string{"current_password": "password123", "new_password": "new-password456"})
+	require.Equal(t, http.StatusNoContent, res.status)
+
+	// every existing token was revoked along with the password change
+	res = ts.do(http.MethodPut, "/users/me/password", token, map[string]string{"current_password": "new-password456", "new_password": "password123"})
+	assert.Equal(t, http.StatusUnauthorized, res.status)
+
+	res = ts.do(http.MethodPost, "/tokens/authenticate", "", map[string]string{"username": "alice", "password": "password123"})
+	assert.Equal(t, http.StatusUnauthorized, res.status)
+
+	res = ts.do(http.MethodPost, "/tokens/authenticate", "", map[string]string{"username": "alice", "password": "new-password456"})
+	assert.Equal(t, http.StatusCreated, res.status)
+}
+
+func TestDeleteCurrentUser(t *testing.T) {
+	ts := newTestServer(t)
+	userID, token := ts.registerAndLogin("alice")
+	_, otherToken := ts.registerAndLogin("bob")
+	workoutID := ts.createWorkout(token)
+
+	res := ts.do(http.MethodDelete, "/users/me", "", nil)
+	assert.Equal(t, http.StatusUnauthorized, res.status)
+
+	res = ts.do(http.MethodDelete, "/users/me", token, nil)
+	require.Equal(t, http.StatusNoContent, res.status)
+
+	res = ts.do(http.MethodGet, fmt.Sprintf("/users/%d", userID), token, nil)
+	assert.Equal(t, http.StatusUnauthorized, res.status)
+
+	res = ts.do(http.MethodGet, fmt.Sprintf("/users/%d", userID), otherToken, nil)
+	assert.Equal(t, http.StatusNotFound, res.status)
+
+	res = ts.do(http.MethodGet, fmt.Sprintf("/workouts/%d", workoutID), otherToken, nil)
+	assert.Equal(t, http.StatusNotFound, res.status)
+}
+
+func TestCreateWorkout(t *testing.T) {
+	ts := newTestServer(t)
+	userID, token := ts.registerAndLogin("alice")
+
+	res := ts.do(http.MethodPost, "/workouts", token, testWorkoutPayload())
+	require.Equal(t, http.StatusCreated, res.status)
+	workout := res.body["workout"].(map[string]any)
+	assert.Equal(t, float64(userID), workout["user_id"])
+	assert.Len(t, workout["exercises"], 2)
+
+	res = ts.do(http.MethodPost, "/workouts", token, "{")
+	assert.Equal(t, http.StatusBadRequest, res.status)
+
+	res = ts.do(http.MethodPost, "/workouts", "", testWorkoutPayload())
+	assert.Equal(t, http.StatusUnauthorized, res.status)
+}
+
+func TestGetWorkout(t *testing.T) {
+	ts := newTestServer(t)
+	_, token := ts.registerAndLogin("alice")
+	workoutID := ts.createWorkout(token)
+
+	res := ts.do(http.MethodGet, fmt.Sprintf("/workouts/%d", workoutID), token, nil)
+	require.Equal(t, http.StatusOK, res.status)
+	workout := res.body["workout"].(map[string]any)
+	assert.Equal(t, "Leg Day", workout["name"])
+	assert.Len(t, workout["exercises"], 2)
+
+	res = ts.do(http.MethodGet, fmt.Sprintf("/workouts/%d", workoutID+1000), token, nil)
+	assert.Equal(t, http.StatusNotFound, res.status)
+
+	res = ts.do(http.MethodGet, "/workouts/abc", token, nil)
+	assert.Equal(t, http.StatusBadRequest, res.status)
+}
+
+func TestUpdateWorkout(t *testing.T) {
+	ts := newTestServer(t)
+	_, token := ts.registerAndLogin("alice")
+	_, otherToken := ts.registerAndLogin("bob")
+	workoutID := ts.createWorkout(token)
+	path := fmt.Sprintf("/workouts/%d", workoutID)
+
+	res := ts.do(http.MethodPut, path, token, map[string]any{"name": "Heavy Leg Day"})
+	require.Equal(t, http.StatusOK, res.status)
+	workout := res.body["workout"].(map[string]any)
+	assert.Equal(t, "Heavy Leg Day", workout["name"])
+	assert.Equal(t, "Squats and core", workout["description"])
+	assert.Len(t, workout["exercises"], 2)
+
+	res = ts.do(http.MethodPut, path, otherToken, map[string]any{"name": "Hijacked"})
+	assert.Equal(t, http.StatusForbidden, res.status)
+
+	res = ts.do(http.MethodPut, path, token, "{")
+	assert.Equal(t, http.StatusBadRequest, res.status)
+
+	res = ts.do(http.MethodPut, fmt.Sprintf("/workouts/%d", workoutID+1000), token, map[string]any{"name": "Ghost"})
+	assert.Equal(t, http.StatusNotFound, res.status)
+
+	res = ts.do(http.MethodGet, path, token, nil)
+	require.Equal(t, http.StatusOK, res.status)
+	assert.Equal(t, "Heavy Leg Day", res.body["workout"].(map[string]any)["name"])
+}
+
+func TestPatchWorkout(t *testing.T) {
+	ts := newTestServer(t)
+	_, token := ts.registerAndLogin("alice")
+	_, otherToken := ts.registerAndLogin("bob")
+	workoutID := ts.createWorkout(token)
+	path := fmt.Sprintf("/workouts/%d", workoutID)
+	mergePatch := map[string]string{"Content-Type": "application/merge-patch+json"}
+	jsonPatch := map[string]string{"Content-Type": "application/json-patch+json"}
+
+	res := ts.do(http.MethodGet, path, token, nil)
+	require.Equal(t, http.StatusOK, res.status)
+	exercises := res.body["workout"].(map[string]any)["exercises"].([]any)
+	squatID := exercises[0].(map[string]any)["id"]
+	plankID := exercises[1].(map[string]any)["id"]
+
+	res = ts.doWithHeaders(http.MethodPatch, path, token, `{"description": null, "calories_burned": null}`, mergePatch)
+	require.Equal(t, http.StatusOK, res.status)
+	workout := res.body["workout"].(map[string]any)
+	assert.Equal(t, "", workout["description"])
+	assert.Nil(t, workout["calories_burned"])
+	assert.Equal(t, "Leg Day", workout["name"])
+	assert.Equal(t, `"2-kg"`, res.header.Get("ETag"))
+
+	res = ts.doWithHeaders(http.MethodPatch, path, token, `[
+		{"op": "test", "path": "/exercises/0/name", "value": "Squat"},
+		{"op": "replace", "path": "/exercises/0/weight", "value": 110},
+		{"op": "move", "from": "/exercises/1", "path": "/exercises/0"},
+		{"op": "add", "path": "/exercises/-", "value": {"name": "Lunge", "sets": 3, "reps": 12}}
+	]`, jsonPatch)
+	require.Equal(t, http.StatusOK, res.status)
+	exercises = res.body["workout"].(map[string]any)["exercises"].([]any)
+	require.Len(t, exercises, 3)
+	assert.Equal(t, plankID, exercises[0].(map[string]any)["id"])
+	assert.Equal(t, squatID, exercises[1].(map[string]any)["id"])
+	assert.Equal(t, float64(110), exercises[1].(map[string]any)["weight"])
+	assert.Equal(t, float64(2), exercises[1].(map[string]any)["order_index"])
+	assert.Equal(t, "Lunge", exercises[2].(map[string]any)["name"])
+
+	// a patch that changes nothing keeps the version
+	res = ts.doWithHeaders(http.MethodPatch, path, token, `{"name": "Leg Day"}`, mergePatch)
+	require.Equal(t, http.StatusOK, res.status)
+	assert.Equal(t, `"3-kg"`, res.header.Get("ETag"))
+
+	res = ts.doWithHeaders(http.MethodPatch, path, token, `[{"op": "test", "path": "/name", "value": "Arm Day"}]`, jsonPatch)
+	assert.Equal(t, http.StatusUnprocessableEntity, res.status)
+
+	res = ts.doWithHeaders(http.MethodPatch, path, token, `{"name": null}`, mergePatch)
+	assert.Equal(t, http.StatusUnprocessableEntity, res.status)
+
+	res = ts.doWithHeaders(http.MethodPatch, path, token, `{"user_id": 999}`, mergePatch)
+	assert.Equal(t, http.StatusUnprocessableEntity, res.status)
+
+	res = ts.doWithHeaders(http.MethodPatch, path, token, `{"exercises": [{"name": "Plank", "sets": 3, "reps": 5, "duration_seconds": 60}]}`, mergePatch)
+	assert.Equal(t, http.StatusUnprocessableEntity, res.status)
+
+	res = ts.doWithHeaders(http.MethodPatch, path, token, `[{"op": "jump", "path": "/name"}]`, jsonPatch)
+	assert.Equal(t, http.StatusBadRequest, res.status)
+
+	res = ts.do(http.MethodPatch, path, token, map[string]any{"name": "Plain JSON"})
+	assert.Equal(t, http.StatusUnsupportedMediaType, res.status)
+	assert.Contains(t, res.header.Get("Accept-Patch"), "application/merge-patch+json")
+
+	res = ts.doWithHeaders(http.MethodPatch, path, token, `{"name": "Stale"}`, map[string]string{
+		"Content-Type": "application/merge-patch+json",
+		"If-Match":     `"1-kg"`,
+	})
+	assert.Equal(t, http.StatusPreconditionFailed, res.status)
+
+	res = ts.doWithHeaders(http.MethodPatch, path, otherToken, `{"name": "Hijacked"}`, mergePatch)
+	assert.Equal(t, http.StatusForbidden, res.status)
+
+	res = ts.doWithHeaders(http.MethodPatch, fmt.Sprintf("/workouts/%d", workoutID+1000), token, `{"name": "Ghost"}`, mergePatch)
+	assert.Equal(t, http.StatusNotFound, res.status)
+}
+
+func TestDeleteWorkout(t *testing.T) {
+	ts := newTestServer(t)
+	_, token := ts.registerAndLogin("alice")
+	_, otherToken := ts.registerAndLogin("bob")
+	workoutID := ts.createWorkout(token)
+	path := fmt.Sprintf("/workouts/%d", workoutID)
+
+	res := ts.do(http.MethodDelete, path, otherToken, nil)
+	assert.Equal(t, http.StatusForbidden, res.status)
+
+	res = ts.do(http.MethodDelete, path, token, nil)
+	assert.Equal(t, http.StatusNoContent, res.status)
+
+	res = ts.do(http.MethodGet, path, token, nil)
+	assert.Equal(t, http.StatusNotFound, res.status)
+
+	res = ts.do(http.MethodDelete, path, token, nil)
+	assert.Equal(t, http.StatusNotFound, res.status)
+
+	res = ts.do(http.MethodDelete, "/workouts/abc", token, nil)
+	assert.Equal(t, http.StatusBadRequest, res.status)
+}
+
+func TestWorkoutExercises(t *testing.T) {
+	ts := newTestServer(t)
+	_, token := ts.registerAndLogin("alice")
+	_, otherToken := ts.registerAndLogin("bob")
+	workoutID := ts.createWorkout(token)
+	path := fmt.Sprintf("/workouts/%d/exercises", workoutID)
+
+	exerciseIDs := func() []int {
+		res := ts.do(http.MethodGet, fmt.Sprintf("/workouts/%d", workoutID), token, nil)
+		require.Equal(t, http.StatusOK, res.status)
+
+		var ids []int
+		for i, exercise := range res.body["workout"].(map[string]any)["exercises"].([]any) {
+			exercise := exercise.(map[string]any)
+			assert.Equal(t, float64(i+1), exercise["order_index"])
+			ids = append(ids, int(exercise["id"].(float64)))
+		}
+		return ids
+	}
+	originalIDs := exerciseIDs()
+
+	res := ts.do(http.MethodPost, path, token, map[string]any{"name": "Lunge", "sets": 3, "reps": 12, "order_index": 1})
+	require.Equal(t, http.StatusCreated, res.status)
+	lungeID := int(res.body["exercise"].(map[string]any)["id"].(float64))
+	assert.Equal(t, []int{lungeID, originalIDs[0], originalIDs[1]}, exerciseIDs())
+
+	res = ts.do(http.MethodPost, path, token, map[string]any{"name": "Lunge", "sets": 3})
+	assert.Equal(t, http.StatusBadRequest, res.status)
+
+	res = ts.do(http.MethodPost, path, otherToken, map[string]any{"name": "Lunge", "sets": 3, "reps": 12})
+	assert.Equal(t, http.StatusForbidden, res.status)
+
+	res = ts.do(http.MethodPost, fmt.Sprintf("/workouts/%d/exercises", workoutID+1000), token, map[string]any{"name": "Lunge", "sets": 3, "reps": 12})
+	assert.Equal(t, http.StatusNotFound, res.status)
+
+	res = ts.do(http.MethodPut, fmt.Sprintf("%s/%d", path, lungeID), token, map[string]any{"name": "Walking Lunge", "sets": 3, "reps": 10, "order_index": 3})
+	require.Equal(t, http.StatusOK, res.status)
+	assert.Equal(t, "Walking Lunge", res.body["exercise"].(map[string]any)["name"])
+	assert.Equal(t, []int{originalIDs[0], originalIDs[1], lungeID}, exerciseIDs())
+
+	res = ts.do(http.MethodPut, fmt.Sprintf("%s/%d", path, lungeID+1000), token, map[string]any{"name": "Ghost", "sets": 1, "reps": 1})
+	assert.Equal(t, http.StatusNotFound, res.status)
+
+	res = ts.do(http.MethodPut, path+"/order", token, map[string]any{"exercise_ids": []int{lungeID, originalIDs[1], originalIDs[0]}})
+	require.Equal(t, http.StatusOK, res.status)
+	assert.Len(t, res.body["exercises"], 3)
+	assert.Equal(t, []int{lungeID, originalIDs[1], originalIDs[0]}, exerciseIDs())
+
+	res = ts.do(http.MethodPut, path+"/order", token, map[string]any{"exercise_ids": []int{lungeID}})
+	assert.Equal(t, http.StatusBadRequest, res.status)
+
+	res = ts.do(http.MethodDelete, fmt.Sprintf("%s/%d", path, originalIDs[1]), token, nil)
+	assert.Equal(t, http.StatusNoContent, res.status)
+	assert.Equal(t, []int{lungeID, originalIDs[0]}, exerciseIDs())
+
+	res = ts.do(http.MethodDelete, fmt.Sprintf("%s/%d", path, originalIDs[1]), token, nil)
+	assert.Equal(t, http.StatusNotFound, res.status)
+
+	res = ts.do(http.MethodDelete, path+"/abc", token, nil)
+	assert.Equal(t, http.StatusBadRequest, res.status)
+}
+
+func TestWorkoutRevisions(t *testing.T) {
+	ts := newTestServer(t)
+	userID, token := ts.registerAndLogin("alice")
+	_, otherToken := ts.registerAndLogin("bob")
+	workoutID := ts.createWorkout(token)
+	path := fmt.Sprintf("/workouts/%d", workoutID)
+
+	res := ts.do(http.MethodPut, path, token, map[string]any{"name": "Heavy Leg Day", "duration_minutes": 75})
+	require.Equal(t, http.StatusOK, res.status)
+
+	res = ts.do(http.MethodPost, path+"/exercises", token, map[string]any{"name": "Lunge", "sets": 3, "reps": 12})
+	require.Equal(t, http.StatusCreated, res.status)
+
+	res = ts.do(http.MethodGet, path+"/revisions", token, nil)
+	require.Equal(t, http.StatusOK, res.status)
+	revisions := res.body["revisions"].([]any)
+	require.Len(t, revisions, 3)
+	actions := []any{}
+	for _, revision := range revisions {
+		actions = append(actions, revision.(map[string]any)["action"])
+	}
+	assert.Equal(t, []any{"create", "update", "update"}, actions)
+	second := revisions[1].(map[string]any)
+	assert.Equal(t, float64(userID), second["actor_id"])
+	assert.Contains(t, second["diff"], map[string]any{"op": "replace", "path": "/name", "value": "Heavy Leg Day"})
+
+	res = ts.do(http.MethodGet, path+"/revisions/1", token, nil)
+	require.Equal(t, http.StatusOK, res.status)
+	snapshot := res.body["revision"].(map[string]any)["snapshot"].(map[string]any)
+	assert.Equal(t, "Leg Day", snapshot["name"])
+	assert.Nil(t, res.body["revision"].(map[string]any)["diff"])
+
+	res = ts.do(http.MethodGet, path+"/revisions/1", otherToken, nil)
+	assert.Equal(t, http.StatusForbidden, res.status)
+
+	res = ts.do(http.MethodGet, path+"/revisions", otherToken, nil)
+	assert.Equal(t, http.StatusForbidden, res.status)
+
+	res = ts.do(http.MethodGet, path+"/revisions/9", token, nil)
+	assert.Equal(t, http.StatusNotFound, res.status)
+
+	res = ts.do(http.MethodPost, path+"/revisions/1/restore", token, nil)
+	require.Equal(t, http.StatusOK, res.status)
+	workout := res.body["workout"].(map[string]any)
+	assert.Equal(t, "Leg Day", workout["name"])
+	assert.Equal(t, float64(60), workout["duration_minutes"])
+	assert.Len(t, workout["exercises"], 2)
+	assert.Equal(t, `"4-kg"`, res.header.Get("ETag"))
+
+	res = ts.do(http.MethodPost, path+"/revisions/1/restore", otherToken, nil)
+	assert.Equal(t, http.StatusForbidden, res.status)
+
+	res = ts.doWithHeaders(http.MethodPost, path+"/revisions/2/restore", token, nil, map[string]string{"If-Match": `"1-kg"`})
+	assert.Equal(t, http.StatusPreconditionFailed, res.status)
+
+	// the history survives the workout, but it can no longer be restored
+	res = ts.do(http.MethodDelete, path, token, nil)
+	require.Equal(t, http.StatusNoContent, res.status)
+
+	res = ts.do(http.MethodGet, path+"/revisions", token, nil)
+	require.Equal(t, http.StatusOK, res.status)
+	revisions = res.body["revisions"].([]any)
+	require.Len(t, revisions, 5)
+	assert.Equal(t, "restore", revisions[3].(map[string]any)["action"])
+	assert.Equal(t, "delete", revisions[4].(map[string]any)["action"])
+
+	res = ts.do(http.MethodPost, path+"/revisions/1/restore", token, nil)
+	assert.Equal(t, http.StatusNotFound, res.status)
+
+	res = ts.do(http.MethodGet, fmt.Sprintf("/workouts/%d/revisions", workoutID+1000), token, nil)
+	assert.Equal(t, http.StatusNotFound, res.status)
+}
+
+func TestWorkoutTrash(t *testing.T) {
+	ts := newTestServer(t)
+	_, token := ts.registerAndLogin("alice")
+	_, otherToken := ts.registerAndLogin("bob")
+	workoutID := ts.createWorkout(token)
+	otherWorkoutID := ts.createWorkout(token)
+	path := fmt.Sprintf("/workouts/%d", workoutID)
+
+	res := ts.do(http.MethodGet, "/workouts/trash", token, nil)
+	require.Equal(t, http.StatusOK, res.status)
+	assert.Empty(t, res.body["workouts"])
+
+	res = ts.do(http.MethodDelete, path, token, nil)
+	require.Equal(t, http.StatusNoContent, res.status)
+	res = ts.do(http.MethodDelete, fmt.Sprintf("/workouts/%d", otherWorkoutID), token, nil)
+	require.Equal(t, http.StatusNoContent, res.status)
+
+	res = ts.do(http.MethodGet, path, token, nil)
+	assert.Equal(t, http.StatusNotFound, res.status)
+
+	res = ts.do(http.MethodGet, "/workouts/trash", token, nil)
+	require.Equal(t, http.StatusOK, res.status)
+	trash := res.body["workouts"].([]any)
+	require.Len(t, trash, 2)
+	assert.NotNil(t, trash[0].(map[string]any)["deleted_at"])
+
+	res = ts.do(http.MethodGet, "/workouts/trash", otherToken, nil)
+	require.Equal(t, http.StatusOK, res.status)
+	assert.Empty(t, res.body["workouts"])
+
+	res = ts.do(http.MethodPost, path+"/restore", otherToken, nil)
+	assert.Equal(t, http.StatusForbidden, res.status)
+
+	res = ts.do(http.MethodPost, path+"/restore", token, nil)
+	require.Equal(t, http.StatusOK, res.status)
+	workout := res.body["workout"].(map[string]any)
+	assert.Nil(t, workout["deleted_at"])
+	assert.Len(t, workout["exercises"], 2)
+	assert.Equal(t, `"3-kg"`, res.header.Get("ETag"))
+
+	res = ts.do(http.MethodPost, path+"/restore", token, nil)
+	assert.Equal(t, http.StatusNotFound, res.status)
+
+	res = ts.do(http.MethodGet, path, token, nil)
+	assert.Equal(t, http.StatusOK, res.status)
+
+	res = ts.do(http.MethodGet, path+"/revisions", token, nil)
+	require.Equal(t, http.StatusOK, res.status)
+	assert.Len(t, res.body["revisions"], 3)
+
+	res = ts.do(http.MethodDelete, fmt.Sprintf("/workouts/trash/%d", workoutID), token, nil)
+	assert.Equal(t, http.StatusNotFound, res.status, "only trashed workouts can be purged")
+
+	res = ts.do(http.MethodDelete, fmt.Sprintf("/workouts/trash/%d", otherWorkoutID), otherToken, nil)
+	assert.Equal(t, http.StatusForbidden, res.status)
+
+	res = ts.do(http.MethodDelete, fmt.Sprintf("/workouts/trash/%d", otherWorkoutID), token, nil)
+	assert.Equal(t, http.StatusNoContent, res.status)
+
+	res = ts.do(http.MethodPost, fmt.Sprintf("/workouts/%d/restore", otherWorkoutID), token, nil)
+	assert.Equal(t, http.StatusNotFound, res.status)
+
+	// nothing of a purged workout can be read back
+	res = ts.do(http.MethodGet, fmt.Sprintf("/workouts/%d/revisions", otherWorkoutID), token, nil)
+	assert.Equal(t, http.StatusNotFound, res.status)
+
+	res = ts.do(http.MethodGet, "/workouts/trash", token, nil)
+	require.Equal(t, http.StatusOK, res.status)
+	assert.Empty(t, res.body["workouts"])
+}
+
+func TestSearchWorkouts(t *testing.T) {
+	ts := newTestServer(t)
+	_, token := ts.registerAndLogin("alice")
+	_, otherToken := ts.registerAndLogin("bob")
+	workoutID := ts.createWorkout(token)
+
+	payload := testWorkoutPayload()
+	payload["exercises"] = []map[string]any{
+		{"name": "Bulgarian Split Squat", "sets": 3, "reps": 8, "notes": "Slow eccentric", "order_index": 1},
+	}
+	res := ts.do(http.MethodPost, "/workouts", token, payload)
+	require.Equal(t, http.StatusCreated, res.status)
+	splitSquatID := res.body["workout"].(map[string]any)["id"].(float64)
+
+	res = ts.do(http.MethodGet, "/workouts/search?q=leg+day+with+the+bulgarian+split", token, nil)
+	require.Equal(t, http.StatusOK, res.status)
+	results := res.body["results"].([]any)
+	require.Len(t, results, 1)
+	result := results[0].(map[string]any)
+	assert.Equal(t, splitSquatID, result["workout"].(map[string]any)["id"])
+	assert.Contains(t, result["snippet"], "<mark>Bulgarian</mark>")
+	assert.Positive(t, result["rank"])
+
+	res = ts.do(http.MethodGet, "/workouts/search?q=squa", token, nil)
+	require.Equal(t, http.StatusOK, res.status)
+	assert.Len(t, res.body["results"], 2)
+
+	res = ts.do(http.MethodGet, "/workouts/search?q=squa&limit=1&offset=1", token, nil)
+	require.Equal(t, http.StatusOK, res.status)
+	assert.Len(t, res.body["results"], 1)
+
+	res = ts.do(http.MethodGet, "/workouts/search?q=squat", otherToken, nil)
+	require.Equal(t, http.StatusOK, res.status)
+	assert.Empty(t, res.body["results"])
+
+	res = ts.do(http.MethodDelete, fmt.Sprintf("/workouts/%d", workoutID), token, nil)
+	require.Equal(t, http.StatusNoContent, res.status)
+
+	res = ts.do(http.MethodGet, "/workouts/search?q=squa", token, nil)
+	require.Equal(t, http.StatusOK, res.status)
+	assert.Len(t, res.body["results"], 1)
+
+	for _, query := range []string{"", "?q=+", "?q=squat&limit=0", "?q=squat&limit=101", "?q=squat&offset=-1"} {
+		res = ts.do(http.MethodGet, "/workouts/search"+query, token, nil)
+		assert.Equal(t, http.StatusBadRequest, res.status, query)
+	}
+}
+
+func TestWorkoutTemplates(t *testing.T) {
+	ts := newTestServer(t)
+	_, token := ts.registerAndLogin("alice")
+	_, otherToken := ts.registerAndLogin("bob")
+	workoutID := ts.createWorkout(token)
+
+	res := ts.do(http.MethodPost, "/templates", token, map[string]any{
+		"name":             "Push Day",
+		"duration_minutes": 45,
+		"exercises": []map[string]any{
+			{"name": "Bench Press", "sets": 5, "reps": 5, "weight": 80, "order_index": 1},
+		},
+	})
+	require.Equal(t, http.StatusCreated, res.status)
+	pushDayID := int(res.body["template"].(map[string]any)["id"].(float64))
+
+	res = ts.do(http.MethodPost, "/templates", token, map[string]any{"name": "No duration"})
+	assert.Equal(t, http.StatusBadRequest, res.status)
+
+	res = ts.do(http.MethodPost, fmt.Sprintf("/workouts/%d/template", workoutID), otherToken, nil)
+	assert.Equal(t, http.StatusForbidden, res.status)
+
+	res = ts.do(http.MethodPost, fmt.Sprintf("/workouts/%d/template", workoutID), token, nil)
+	require.Equal(t, http.StatusCreated, res.status)
+	template := res.body["template"].(map[string]any)
+	legDayPath := fmt.Sprintf("/templates/%d", int(template["id"].(float64)))
+	assert.Equal(t, "Leg Day", template["name"])
+	assert.Len(t, template["exercises"], 2)
+
+	res = ts.do(http.MethodGet, "/templates", token, nil)
+	require.Equal(t, http.StatusOK, res.status)
+	templates := res.body["templates"].([]any)
+	require.Len(t, templates, 2)
+	assert.Equal(t, "Leg Day", templates[0].(map[string]any)["name"])
+
+	res = ts.do(http.MethodGet, "/templates", otherToken, nil)
+	require.Equal(t, http.StatusOK, res.status)
+	assert.Empty(t, res.body["templates"])
+
+	res = ts.do(http.MethodGet, legDayPath, otherToken, nil)
+	assert.Equal(t, http.StatusForbidden, res.status)
+
+	res = ts.do(http.MethodPut, legDayPath, token, map[string]any{"name": "Lower Body"})
+	require.Equal(t, http.StatusOK, res.status)
+	template = res.body["template"].(map[string]any)
+	assert.Equal(t, "Lower Body", template["name"])
+	assert.Len(t, template["exercises"], 2, "exercises left out are kept")
+
+	res = ts.do(http.MethodGet, legDayPath, token, nil)
+	require.Equal(t, http.StatusOK, res.status)
+	assert.Equal(t, "Lower Body", res.body["template"].(map[string]any)["name"])
+
+	res = ts.do(http.MethodPost, legDayPath+"/start", otherToken, nil)
+	assert.Equal(t, http.StatusForbidden, res.status)
+
+	res = ts.do(http.MethodPost, legDayPath+"/start", token, nil)
+	require.Equal(t, http.StatusCreated, res.status)
+	workout := res.body["workout"].(map[string]any)
+	assert.Equal(t, template["id"], workout["template_id"])
+	assert.Equal(t, "Lower Body", workout["name"])
+	assert.Len(t, workout["exercises"], 2)
+	startedPath := fmt.Sprintf("/workouts/%d", int(workout["id"].(float64)))
+
+	res = ts.do(http.MethodGet, startedPath, token, nil)
+	require.Equal(t, http.StatusOK, res.status)
+	assert.Equal(t, template["id"], res.body["workout"].(map[string]any)["template_id"])
+
+	res = ts.do(http.MethodDelete, fmt.Sprintf("/templates/%d", pushDayID), otherToken, nil)
+	assert.Equal(t, http.StatusForbidden, res.status)
+
+	res = ts.do(http.MethodDelete, legDayPath, token, nil)
+	require.Equal(t, http.StatusNoContent, res.status)
+
+	res = ts.do(http.MethodGet, legDayPath, token, nil)
+	assert.Equal(t, http.StatusNotFound, res.status)
+
+	res = ts.do(http.MethodGet, startedPath, token, nil)
+	require.Equal(t, http.StatusOK, res.status)
+	assert.Nil(t, res.body["workout"].(map[string]any)["template_id"])
+}
+
+func TestTrainingPrograms(t *testing.T) {
+	ts := newTestServer(t)
+	_, coachToken := ts.registerAndLogin("coach")
+	_, athleteToken := ts.registerAndLogin("athlete")
+
+	res := ts.do(http.MethodPost, "/templates", coachToken, map[string]any{"name": "Leg Day", "duration_minutes": 60})
+	require.Equal(t, http.StatusCreated, res.status)
+	templateID := res.body["template"].(map[string]any)["id"]
+	templatePath := fmt.Sprintf("/templates/%d", int(templateID.(float64)))
+
+	program := map[string]any{
+		"name":  "Strength",
+		"weeks": 2,
+		"days": []map[string]any{
+			{"week": 1, "day": 1, "template_id": templateID},
+			{"week": 1, "day": 3, "template_id": templateID},
+			{"week": 2, "day": 1, "template_id": templateID},
+		},
+	}
+
+	res = ts.do(http.MethodPost, "/programs", athleteToken, program)
+	assert.Equal(t, http.StatusBadRequest, res.status, "templates must be the author's")
+
+	res = ts.do(http.MethodPost, "/programs", coachToken, map[string]any{
+		"name":  "Too long",
+		"weeks": 1,
+		"days":  []map[string]any{{"week": 2, "day": 1, "template_id": templateID}},
+	})
+	assert.Equal(t, http.StatusBadRequest, res.status)
+
+	res = ts.do(http.MethodPost, "/programs", coachToken, program)
+	require.Equal(t, http.StatusCreated, res.status)
+	programPath := fmt.Sprintf("/programs/%d", int(res.body["program"].(map[string]any)["id"].(float64)))
+
+	res = ts.do(http.MethodGet, "/programs", athleteToken, nil)
+	require.Equal(t, http.StatusOK, res.status)
+	assert.Len(t, res.body["programs"], 1)
+
+	res = ts.do(http.MethodGet, programPath, athleteToken, nil)
+	require.Equal(t, http.StatusOK, res.status)
+	days := res.body["program"].(map[string]any)["days"].([]any)
+	require.Len(t, days, 3)
+
+	res = ts.do(http.MethodPut, programPath, athleteToken, program)
+	assert.Equal(t, http.StatusForbidden, res.status)
+
+	res = ts.do(http.MethodDelete, templatePath, coachToken, nil)
+	assert.Equal(t, http.StatusConflict, res.status, "the program uses the template")
+
+	res = ts.do(http.MethodGet, templatePath, athleteToken, nil)
+	assert.Equal(t, http.StatusForbidden, res.status, "the athlete is not enrolled yet")
+
+	res = ts.do(http.MethodPost, programPath+"/enrollments", athleteToken, map[string]any{"start_date": "January 5th"})
+	assert.Equal(t, http.StatusBadRequest, res.status)
+
+	res = ts.do(http.MethodPost, programPath+"/enrollments", athleteToken, map[string]any{"start_date": "2099-01-05"})
+	require.Equal(t, http.StatusCreated, res.status)
+	schedule := res.body["schedule"].([]any)
+	require.Len(t, schedule, 3)
+	assert.Equal(t, "2099-01-07", schedule[1].(map[string]any)["date"])
+	assert.Equal(t, "planned", schedule[1].(map[string]any)["status"])
+	assert.Nil(t, res.body["adherence"].(map[string]any)["rate"], "no session is due yet")
+
+	// the athlete can read and start the templates of the sessions
+	res = ts.do(http.MethodGet, templatePath, athleteToken, nil)
+	require.Equal(t, http.StatusOK, res.status)
+	assert.Equal(t, "Leg Day", res.body["template"].(map[string]any)["name"])
+
+	res = ts.do(http.MethodPost, templatePath+"/start", athleteToken, nil)
+	require.Equal(t, http.StatusCreated, res.status)
+	startedID := int(res.body["workout"].(map[string]any)["id"].(float64))
+	res = ts.do(http.MethodGet, fmt.Sprintf("/workouts/%d", startedID), athleteToken, nil)
+	assert.Equal(t, http.StatusOK, res.status, "the workout is the athlete's")
+
+	res = ts.do(http.MethodPut, templatePath, athleteToken, map[string]any{"name": "Arm Day"})
+	assert.Equal(t, http.StatusForbidden, res.status)
+
+	res = ts.do(http.MethodPost, programPath+"/enrollments", athleteToken, map[string]any{"start_date": "2026-01-05"})
+	require.Equal(t, http.StatusCreated, res.status)
+	enrollmentPath := fmt.Sprintf("/enrollments/%d", int(res.body["enrollment"].(map[string]any)["id"].(float64)))
+	sessionPath := fmt.Sprintf("%s/sessions/%d/workout", enrollmentPath, int(days[0].(map[string]any)["id"].(float64)))
+
+	res = ts.do(http.MethodGet, "/enrollments", athleteToken, nil)
+	require.Equal(t, http.StatusOK, res.status)
+	assert.Len(t, res.body["enrollments"], 2)
+
+	res = ts.do(http.MethodGet, enrollmentPath, coachToken, nil)
+	assert.Equal(t, http.StatusForbidden, res.status)
+
+	workoutID := ts.createWorkout(athleteToken)
+	res = ts.do(http.MethodPut, sessionPath, athleteToken, map[string]any{"workout_id": ts.createWorkout(coachToken)})
+	assert.Equal(t, http.StatusBadRequest, res.status, "workouts must be the athlete's")
+
+	res = ts.do(http.MethodPut, fmt.Sprintf("%s/sessions/12345/workout", enrollmentPath), athleteToken, map[string]any{"workout_id": workoutID})
+	assert.Equal(t, http.StatusNotFound, res.status)
+
+	res = ts.do(http.MethodPut, sessionPath, athleteToken, map[string]any{"workout_id": workoutID})
+	require.Equal(t, http.StatusOK, res.status)
+	schedule = res.body["schedule"].([]any)
+	assert.Equal(t, "2026-01-05", schedule[0].(map[string]any)["date"])
+	assert.Equal(t, "completed", schedule[0].(map[string]any)["status"])
+	assert.Equal(t, float64(workoutID), schedule[0].(map[string]any)["workout_id"])
+	assert.Equal(t, "missed", schedule[2].(map[string]any)["status"])
+	assert.Equal(t, map[string]any{
+		"planned":   float64(3),
+		"due":       float64(3),
+		"completed": float64(1),
+		"missed":    float64(2),
+		"rate":      float64(1) / 3,
+	}, res.body["adherence"])
+
+	res = ts.do(http.MethodDelete, sessionPath, athleteToken, nil)
+	require.Equal(t, http.StatusOK, res.status)
+	assert.Equal(t, float64(0), res.body["adherence"].(map[string]any)["completed"])
+
+	res = ts.do(http.MethodDelete, sessionPath, athleteToken, nil)
+	assert.Equal(t, http.StatusNotFound, res.status)
+
+	res = ts.do(http.MethodDelete, enrollmentPath, athleteToken, nil)
+	require.Equal(t, http.StatusNoContent, res.status)
+
+	res = ts.do(http.MethodGet, enrollmentPath, athleteToken, nil)
+	assert.Equal(t, http.StatusNotFound, res.status)
+
+	res = ts.do(http.MethodDelete, programPath, athleteToken, nil)
+	assert.Equal(t, http.StatusForbidden, res.status)
+
+	program["name"] = "Strength II"
+	program["days"] = []map[string]any{{"week": 1, "day": 1, "template_id": templateID}}
+	res = ts.do(http.MethodPut, programPath, coachToken, program)
+	require.Equal(t, http.StatusOK, res.status)
+	assert.Len(t, res.body["program"].(map[string]any)["days"], 1)
+
+	res = ts.do(http.MethodDelete, programPath, coachToken, nil)
+	assert.Equal(t, http.StatusConflict, res.status, "the athlete is still enrolled")
+
+	res = ts.do(http.MethodGet, "/enrollments", athleteToken, nil)
+	require.Equal(t, http.StatusOK, res.status)
+	enrollments := res.body["enrollments"].([]any)
+	require.Len(t, enrollments, 1)
+	res = ts.do(http.MethodDelete, fmt.Sprintf("/enrollments/%d", int(enrollments[0].(map[string]any)["id"].(float64))), athleteToken, nil)
+	require.Equal(t, http.StatusNoContent, res.status)
+
+	res = ts.do(http.MethodPost, programPath+"/enrollments", coachToken, map[string]any{"start_date": "2026-01-05"})
+	require.Equal(t, http.StatusCreated, res.status)
+
+	res = ts.do(http.MethodDelete, programPath, coachToken, nil)
+	require.Equal(t, http.StatusNoContent, res.status)
+
+	res = ts.do(http.MethodGet, "/enrollments", coachToken, nil)
+	require.Equal(t, http.StatusOK, res.status)
+	assert.Empty(t, res.body["enrollments"], "deleting the program deletes the enrollments of its designer")
+
+	res = ts.do(http.MethodGet, templatePath, athleteToken, nil)
+	assert.Equal(t, http.StatusForbidden, res.status)
+
+	res = ts.do(http.MethodDelete, templatePath, coachToken, nil)
+	assert.Equal(t, http.StatusNoContent, res.status)
+}
+
+func TestWorkoutSets(t *testing.T) {
+	ts := newTestServer(t)
+	_, token := ts.registerAndLogin("alice")
+
+	res := ts.do(http.MethodPost, "/workouts", token, map[string]any{
+		"name":             "Heavy Squats",
+		"duration_minutes": 45,
+		"exercises": []map[string]any{
+			{
+				"name":        "Squat",
+				"order_index": 1,
+				"workout_sets": []map[string]any{
+					{"set_type": "warmup", "reps": 8, "weight": 60, "completed": true},
+					{"reps": 5, "weight": 100, "rpe": 7, "rest_seconds": 180, "completed": true},
+					{"reps": 4, "weight": 105, "rpe": 8, "completed": true},
+					{"reps": 3, "weight": 110, "rpe": 9.5, "rir": 0, "completed": true},
+				},
+			},
+		},
+	})
+	require.Equal(t, http.StatusCreated, res.status)
+	workout := res.body["workout"].(map[string]any)
+	workoutPath := fmt.Sprintf("/workouts/%d", int(workout["id"].(float64)))
+	squat := workout["exercises"].([]any)[0].(map[string]any)
+	assert.Equal(t, float64(3), squat["sets"], "warm-ups are not counted")
+	assert.Equal(t, float64(3), squat["reps"], "the top set is the heaviest")
+	assert.Equal(t, float64(110), squat["weight"])
+
+	res = ts.do(http.MethodGet, workoutPath, token, nil)
+	require.Equal(t, http.StatusOK, res.status)
+	sets := res.body["workout"].(map[string]any)["exercises"].([]any)[0].(map[string]any)["workout_sets"].([]any)
+	require.Len(t, sets, 4)
+	assert.Equal(t, map[string]any{
+		"set_number":       float64(2),
+		"set_type":         "working",
+		"reps":             float64(5),
+		"weight":           float64(100),
+		"duration_seconds": nil,
+		"distance_meters":  nil,
+		"rpe":              float64(7),
+		"rir":              nil,
+		"rest_seconds":     float64(180),
+		"completed":        true,
+	}, sets[1])
+
+	res = ts.do(http.MethodPost, workoutPath+"/exercises", token, map[string]any{
+		"name":         "Plank",
+		"workout_sets": []map[string]any{{"set_type": "cluster", "duration_seconds": 60}},
+	})
+	assert.Equal(t, http.StatusBadRequest, res.status)
+
+	res = ts.do(http.MethodPost, workoutPath+"/exercises", token, map[string]any{
+		"name":         "Plank",
+		"workout_sets": []map[string]any{{"duration_seconds": 60}, {"reps": 10}},
+	})
+	assert.Equal(t, http.StatusBadRequest, res.status, "sets mix reps and durations")
+
+	res = ts.do(http.MethodPost, workoutPath+"/exercises", token, map[string]any{
+		"name":         "Plank",
+		"workout_sets": []map[string]any{{"duration_seconds": 60}, {"duration_seconds": 90}},
+	})
+	require.Equal(t, http.StatusCreated, res.status)
+	plank := res.body["exercise"].(map[string]any)
+	assert.Equal(t, float64(2), plank["sets"])
+	assert.Equal(t, float64(90), plank["duration_seconds"])
+	assert.Len(t, plank["workout_sets"], 2)
+
+	res = ts.do(http.MethodPost, workoutPath+"/template", token, nil)
+	require.Equal(t, http.StatusCreated, res.status)
+	templateSquat := res.body["template"].(map[string]any)["exercises"].([]any)[0].(map[string]any)
+	assert.Nil(t, templateSquat["workout_sets"], "templates keep the aggregates only")
+	assert.Equal(t, float64(110), templateSquat["weight"])
+
+	res = ts.do(http.MethodGet, fmt.Sprintf("/workouts/%d", ts.createWorkout(token)), token, nil)
+	require.Equal(t, http.StatusOK, res.status)
+	assert.NotContains(t, res.body["workout"].(map[string]any)["exercises"].([]any)[0], "workout_sets",
+		"exercises logged without sets are unchanged")
+}
+
+func TestPersonalRecords(t *testing.T) {
+	ts := newTestServer(t)
+	_, token := ts.registerAndLogin("alice")
+	_, otherToken := ts.registerAndLogin("bob")
+
+	res := ts.do(http.MethodPost, "/workouts", token, testWorkoutPayload())
+	require.Equal(t, http.StatusCreated, res.status)
+	assert.Len(t, res.body["personal_records"], 5, "every record of a first workout is new")
+
+	res = ts.do(http.MethodPost, "/workouts", token, testWorkoutPayload())
+	require.Equal(t, http.StatusCreated, res.status)
+	assert.Equal(t, []any{}, res.body["personal_records"], "equalling a record does not beat it")
+	workoutPath := fmt.Sprintf("/workouts/%d", int(res.body["workout"].(map[string]any)["id"].(float64)))
+
+	res = ts.do(http.MethodPut, workoutPath, token, map[string]any{
+		"exercises": []map[string]any{
+			{"name": "Squat", "sets": 5, "reps": 5, "weight": 120, "order_index": 1},
+		},
+	})
+	require.Equal(t, http.StatusOK, res.status)
+	newRecords := res.body["personal_records"].([]any)
+	require.Len(t, newRecords, 4)
+	maxWeight := newRecords[0].(map[string]any)
+	assert.Equal(t, "max_weight", maxWeight["record_type"])
+	assert.Equal(t, float64(120), maxWeight["value"])
+	assert.Equal(t, float64(100), maxWeight["previous_value"])
+
+	res = ts.do(http.MethodGet, "/users/me/records", token, nil)
+	require.Equal(t, http.StatusOK, res.status)
+	records := res.body["records"].([]any)
+	require.Len(t, records, 6)
+	assert.Equal(t, "Plank", records[0].(map[string]any)["exercise_name"])
+	assert.Equal(t, float64(120), records[1].(map[string]any)["value"])
+
+	res = ts.do(http.MethodGet, "/users/me/records?history=true", token, nil)
+	require.Equal(t, http.StatusOK, res.status)
+	assert.Len(t, res.body["records"], 9)
+
+	res = ts.do(http.MethodGet, "/users/me/records?history=maybe", token, nil)
+	assert.Equal(t, http.StatusBadRequest, res.status)
+
+	res = ts.do(http.MethodGet, "/users/me/records", otherToken, nil)
+	require.Equal(t, http.StatusOK, res.status)
+	assert.Equal(t, []any{}, res.body["records"])
+}
+
+func TestTrainingStats(t *testing.T) {
+	ts := newTestServer(t)
+	_, token := ts.registerAndLogin("alice")
+	ts.createWorkout(token)
+	ts.createWorkout(token)
+
+	res := ts.do(http.MethodGet, "/users/me/stats?bucket=day", token, nil)
+	require.Equal(t, http.StatusOK, res.status)
+	stats := res.body["stats"].(map[string]any)
+	assert.Equal(t, "day", stats["bucket"])
+	assert.Len(t, stats["buckets"], 30)
+	assert.Equal(t, map[string]any{
+		"workouts":         float64(2),
+		"duration_minutes": float64(120),
+		"calories_burned":  float64(800),
+		"volume_load":      float64(5000),
+	}, stats["totals"])
+	today := stats["buckets"].([]any)[29].(map[string]any)
+	assert.Equal(t, time.Now().UTC().Format(time.DateOnly), today["start"])
+	assert.Equal(t, float64(2), today["workouts"])
+	squat := stats["exercises"].([]any)[0].(map[string]any)
+	assert.Equal(t, "Squat", squat["name"])
+	assert.Equal(t, float64(10), squat["sets"])
+
+	res = ts.do(http.MethodGet, "/users/me/stats?from=2020-01-01&to=2020-12-31&bucket=month", token, nil)
+	require.Equal(t, http.StatusOK, res.status)
+	stats = res.body["stats"].(map[string]any)
+	assert.Len(t, stats["buckets"], 12)
+	assert.Equal(t, float64(0), stats["totals"].(map[string]any)["workouts"])
+
+	for _, query := range []string{"bucket=year", "from=yesterday", "from=2020-02-01&to=2020-01-01", "from=2020-01-01&to=2023-01-01"} {
+		res = ts.do(http.MethodGet, "/users/me/stats?"+query, token, nil)
+		assert.Equal(t, http.StatusBadRequest, res.status, query)
+	}
+}
+
+func TestExerciseProgress(t *testing.T) {
+	ts := newTestServer(t)
+	_, token := ts.registerAndLogin("alice")
+	ts.createWorkout(token)
+	heavier := testWorkoutPayload()
+	heavier["exercises"] = []map[string]any{
+		{"name": "Squat", "order_index": 1, "workout_sets": []map[string]any{
+			{"reps": 3, "weight": 110, "completed": true},
+			{"reps": 3, "weight": 110, "completed": true},
+		}},
+	}
+	res := ts.do(http.MethodPost, "/workouts", token, heavier)
+	require.Equal(t, http.StatusCreated, res.status)
+
+	res = ts.do(http.MethodGet, "/users/me/exercises/squat/progress?formula=brzycki&window=2", token, nil)
+	require.Equal(t, http.StatusOK, res.status)
+	progress := res.body["progress"].(map[string]any)
+	assert.Equal(t, "brzycki", progress["formula"])
+	sessions := progress["sessions"].([]any)
+	require.Len(t, sessions, 2)
+	first, second := sessions[0].(map[string]any), sessions[1].(map[string]any)
+	assert.Equal(t, float64(112.5), first["estimated_1rm"])
+	assert.Equal(t, float64(2500), first["volume_load"])
+	assert.Equal(t, float64(2500), first["volume_load_average"])
+	assert.Equal(t, map[string]any{"weight": float64(110), "reps": float64(3), "duration_seconds": nil}, second["top_set"])
+	assert.Equal(t, float64(116.47), second["estimated_1rm"])
+	assert.Equal(t, float64(114.49), second["estimated_1rm_average"])
+	assert.Equal(t, float64(1580), second["volume_load_average"])
+	assert.Equal(t, map[string]any{"metric": nil, "slope_per_week": nil, "direction": "insufficient_data"}, progress["trend"],
+		"sessions on the same day make no trend")
+
+	res = ts.do(http.MethodGet, "/users/me/exercises/Deadlift/progress", token, nil)
+	assert.Equal(t, http.StatusNotFound, res.status)
+
+	for _, query := range []string{"formula=wathan", "window=0", "window=21"} {
+		res = ts.do(http.MethodGet, "/users/me/exercises/squat/progress?"+query, token, nil)
+		assert.Equal(t, http.StatusBadRequest, res.status, query)
+	}
+}
+
+func TestEstimatedCalories(t *testing.T) {
+	ts := newTestServer(t)
+	userID, token := ts.registerAndLogin("alice")
+	_, otherToken := ts.registerAndLogin("bob")
+
+	estimatedPayload := testWorkoutPayload()
+	delete(estimatedPayload, "calories_burned")
+
+	res := ts.do(http.MethodPost, "/workouts", token, estimatedPayload)
+	require.Equal(t, http.StatusCreated, res.status)
+	workout := res.body["workout"].(map[string]any)
+	assert.Nil(t, workout["calories_burned"], "nothing is estimated without a body weight")
+	assert.Equal(t, false, workout["calories_estimated"])
+
+	res = ts.do(http.MethodPatch, "/users/me", token, map[string]any{"body_weight_kg": 0})
+	assert.Equal(t, http.StatusBadRequest, res.status)
+
+	res = ts.do(http.MethodPatch, "/users/me", token, map[string]any{"body_weight_kg": 70})
+	require.Equal(t, http.StatusOK, res.status)
+	assert.Equal(t, float64(70), res.body["user"].(map[string]any)["body_weight_kg"])
+
+	// 60 minutes at the default MET of 5 for 70 kg
+	res = ts.do(http.MethodPost, "/workouts", token, estimatedPayload)
+	require.Equal(t, http.StatusCreated, res.status)
+	workout = res.body["workout"].(map[string]any)
+	assert.Equal(t, float64(350), workout["calories_burned"])
+	assert.Equal(t, true, workout["calories_estimated"])
+	workoutPath := fmt.Sprintf("/workouts/%d", int(workout["id"].(float64)))
+
+	longest := testWorkoutPayload()
+	delete(longest, "calories_burned")
+	longest["duration_minutes"] = math.MaxInt32
+	res = ts.do(http.MethodPost, "/workouts", token, longest)
+	require.Equal(t, http.StatusCreated, res.status)
+	assert.Equal(t, float64(math.MaxInt32), res.body["workout"].(map[string]any)["calories_burned"], "the estimate is capped")
+
+	res = ts.do(http.MethodPost, "/workouts", token, testWorkoutPayload())
+	require.Equal(t, http.StatusCreated, res.status)
+	workout = res.body["workout"].(map[string]any)
+	assert.Equal(t, float64(400), workout["calories_burned"])
+	assert.Equal(t, false, workout["calories_estimated"], "the calories sent are measured")
+
+	res = ts.doWithHeaders(http.MethodPatch, workoutPath, token, `{"name": "Legs"}`, map[string]string{"Content-Type": "application/merge-patch+json"})
+	require.Equal(t, http.StatusOK, res.status)
+	assert.Equal(t, true, res.body["workout"].(map[string]any)["calories_estimated"])
+
+	res = ts.do(http.MethodPut, workoutPath, token, map[string]any{"calories_burned": 420})
+	require.Equal(t, http.StatusOK, res.status)
+	workout = res.body["workout"].(map[string]any)
+	assert.Equal(t, float64(420), workout["calories_burned"])
+	assert.Equal(t, false, workout["calories_estimated"])
+
+	res = ts.do(http.MethodPost, "/workouts/batch", token, map[string]any{
+		"operations": []map[string]any{{"op": "create", "workout": estimatedPayload}},
+	})
+	require.Equal(t, http.StatusOK, res.status)
+	created := res.body["results"].([]any)[0].(map[string]any)["workout"].(map[string]any)
+	assert.Equal(t, float64(350), created["calories_burned"])
+	assert.Equal(t, true, created["calories_estimated"])
+
+	res = ts.do(http.MethodGet, fmt.Sprintf("/users/%d", userID), otherToken, nil)
+	require.Equal(t, http.StatusOK, res.status)
+	assert.NotContains(t, res.body["user"], "body_weight_kg", "the body weight is private")
+}
+
+func TestBodyMeasurements(t *testing.T) {
+	ts := newTestServer(t)
+	_, token := ts.registerAndLogin("alice")
+	_, otherToken := ts.registerAndLogin("bob")
+
+	res := ts.do(http.MethodPost, "/users/me/measurements", token, map[string]any{
+		"measured_on":    "2024-03-01",
+		"weight":         180,
+		"weight_unit":    "lb",
+		"circumferences": map[string]any{"waist": 34},
+		"length_unit":    "in",
+	})
+	require.Equal(t, http.StatusCreated, res.status)
+	measurement := res.body["measurement"].(map[string]any)
+	assert.Equal(t, 81.647, measurement["weight"])
+	assert.Equal(t, 86.4, measurement["circumferences"].(map[string]any)["waist"])
+	assert.Equal(t, "kg", measurement["weight_unit"])
+	assert.Equal(t, "cm", measurement["length_unit"])
+	measurementPath := fmt.Sprintf("/users/me/measurements/%d", int(measurement["id"].(float64)))
+
+	res = ts.do(http.MethodPost, "/users/me/measurements", token, map[string]any{
+		"measured_on": "2024-04-01", "weight": 70, "body_fat_percent": 18.25,
+	})
+	require.Equal(t, http.StatusCreated, res.status)
+	assert.Equal(t, 18.3, res.body["measurement"].(map[string]any)["body_fat_percent"])
+
+	for _, payload := range []map[string]any{
+		{"measured_on": "2024-04-01"},
+		{"measured_on": "April", "weight": 70},
+		{"measured_on": "2024-04-01", "weight": 70, "weight_unit": "stone"},
+		{"measured_on": "2024-04-01", "body_fat_percent": 120},
+	} {
+		res = ts.do(http.MethodPost, "/users/me/measurements", token, payload)
+		assert.Equal(t, http.StatusBadRequest, res.status, "%v", payload)
+	}
+
+	res = ts.do(http.MethodGet, "/users/me/measurements?from=2024-03-01&to=2024-03-31", token, nil)
+	require.Equal(t, http.StatusOK, res.status)
+	assert.Len(t, res.body["measurements"], 1)
+
+	res = ts.do(http.MethodGet, "/users/me/measurements?from=2024-04-01&to=2024-03-01", token, nil)
+	assert.Equal(t, http.StatusBadRequest, res.status)
+
+	res = ts.do(http.MethodGet, "/users/me/measurements/latest", token, nil)
+	require.Equal(t, http.StatusOK, res.status)
+	latest := res.body["latest"].(map[string]any)
+	assert.Equal(t, float64(70), latest["weight"].(map[string]any)["value"])
+	assert.Equal(t, 86.4, latest["waist"].(map[string]any)["value"])
+
+	res = ts.do(http.MethodGet, "/users/me/measurements/latest?on=2024-03-31", token, nil)
+	require.Equal(t, http.StatusOK, res.status)
+	assert.Equal(t, 81.647, res.body["latest"].(map[string]any)["weight"].(map[string]any)["value"])
+
+	// the latest measured weight estimates calories: 60 minutes at a MET of 5
+	workoutPayload := testWorkoutPayload()
+	delete(workoutPayload, "calories_burned")
+	res = ts.do(http.MethodPost, "/workouts", token, workoutPayload)
+	require.Equal(t, http.StatusCreated, res.status)
+	assert.Equal(t, float64(350), res.body["workout"].(map[string]any)["calories_burned"])
+
+	res = ts.do(http.MethodPut, measurementPath, token, map[string]any{"measured_on": "2024-03-02", "weight": 81, "notes": "fasted"})
+	require.Equal(t, http.StatusOK, res.status)
+	measurement = res.body["measurement"].(map[string]any)
+	assert.Equal(t, "fasted", measurement["notes"])
+	assert.Nil(t, measurement["circumferences"].(map[string]any)["waist"], "an update replaces the measurement")
+
+	res = ts.do(http.MethodGet, measurementPath, otherToken, nil)
+	assert.Equal(t, http.StatusNotFound, res.status)
+
+	res = ts.do(http.MethodDelete, measurementPath, otherToken, nil)
+	assert.Equal(t, http.StatusNotFound, res.status)
+
+	res = ts.do(http.MethodDelete, measurementPath, token, nil)
+	assert.Equal(t, http.StatusNoContent, res.status)
+
+	res = ts.do(http.MethodGet, measurementPath, token, nil)
+	assert.Equal(t, http.StatusNotFound, res.status)
+}
+
+func TestWeightUnits(t *testing.T) {
+	ts := newTestServer(t)
+	_, token := ts.registerAndLogin("alice")
+
+	payload := testWorkoutPayload()
+	payload["weight_unit"] = "lb"
+	payload["exercises"].([]map[string]any)[0]["weight"] = 225
+	res := ts.do(http.MethodPost, "/workouts", token, payload)
+	require.Equal(t, http.StatusCreated, res.status)
+	assert.Equal(t, "kg", res.body["weight_unit"])
+	workout := res.body["workout"].(map[string]any)
+	assert.Equal(t, 102.058, workout["exercises"].([]any)[0].(map[string]any)["weight"], "weights are stored in kilograms")
+	workoutPath := fmt.Sprintf("/workouts/%d", int(workout["id"].(float64)))
+
+	payload["weight_unit"] = "stone"
+	res = ts.do(http.MethodPost, "/workouts", token, payload)
+	assert.Equal(t, http.StatusBadRequest, res.status)
+
+	res = ts.doWithHeaders(http.MethodGet, workoutPath, token, nil, map[string]string{"Accept-Units": "imperial"})
+	require.Equal(t, http.StatusOK, res.status)
+	assert.Equal(t, "lb", res.body["weight_unit"])
+	assert.Equal(t, float64(225), res.body["workout"].(map[string]any)["exercises"].([]any)[0].(map[string]any)["weight"])
+	assert.Contains(t, res.header.Values("Vary"), "Accept-Units")
+
+	res = ts.do(http.MethodPatch, "/users/me", token, map[string]any{"body_weight_kg": 70})
+	require.Equal(t, http.StatusOK, res.status)
+	res = ts.do(http.MethodPatch, "/users/me", token, map[string]any{"unit_system": "imperial"})
+	require.Equal(t, http.StatusOK, res.status)
+	user := res.body["user"].(map[string]any)
+	assert.Equal(t, "imperial", user["unit_system"])
+	assert.Equal(t, float64(70), user["body_weight_kg"], "the fields left out are kept")
+
+	res = ts.do(http.MethodPatch, "/users/me", token, map[string]any{"unit_system": "nautical"})
+	assert.Equal(t, http.StatusBadRequest, res.status)
+
+	res = ts.do(http.MethodGet, "/users/me/records", token, nil)
+	require.Equal(t, http.StatusOK, res.status)
+	assert.Equal(t, "lb", res.body["weight_unit"])
+	for _, record := range res.body["records"].([]any) {
+		if record := record.(map[string]any); record["record_type"] == "max_weight" {
+			assert.Equal(t, float64(225), record["value"])
+		}
+	}
+
+	res = ts.doWithHeaders(http.MethodGet, workoutPath, token, nil, map[string]string{"Accept-Units": "metric"})
+	require.Equal(t, http.StatusOK, res.status)
+	assert.Equal(t, "kg", res.body["weight_unit"], "Accept-Units overrides the preference of the user")
+
+	res = ts.do(http.MethodPost, "/users/me/measurements", token, map[string]any{
+		"measured_on": "2024-03-01", "weight": 180, "weight_unit": "lb",
+	})
+	require.Equal(t, http.StatusCreated, res.status)
+	measurement := res.body["measurement"].(map[string]any)
+	assert.Equal(t, float64(180), measurement["weight"])
+	assert.Equal(t, "lb", measurement["weight_unit"])
+	assert.Equal(t, "in", measurement["length_unit"])
+
+	res = ts.do(http.MethodPost, "/users/me/legacy-weights", token, map[string]any{"unit": "stone"})
+	assert.Equal(t, http.StatusBadRequest, res.status)
+
+	res = ts.do(http.MethodPost, "/users/me/legacy-weights", token, map[string]any{"unit": "lb"})
+	assert.Equal(t, http.StatusConflict, res.status, "users who registered with units have no legacy weights")
+}
+
+func TestGoals(t *testing.T) {
+	ts := newTestServer(t)
+	_, token := ts.registerAndLogin("alice")
+	_, otherToken := ts.registerAndLogin("bob")
+
+	today := time.Now().UTC()
+	inTwoWeeks := today.AddDate(0, 0, 13).Format(time.DateOnly)
+
+	createGoal := func(payload map[string]any) map[string]any {
+		t.Helper()
+
+		res := ts.do(http.MethodPost, "/users/me/goals", token, payload)
+		require.Equal(t, http.StatusCreated, res.status, "%v", res.body)
+		return res.body["goal"].(map[string]any)
+	}
+	goalPath := func(goal map[string]any) string {
+		return fmt.Sprintf("/users/me/goals/%d", int(goal["id"].(float64)))
+	}
+	getGoal := func(goal map[string]any) map[string]any {
+		t.Helper()
+
+		res := ts.do(http.MethodGet, goalPath(goal), token, nil)
+		require.Equal(t, http.StatusOK, res.status)
+		return res.body["goal"].(map[string]any)
+	}
+
+	squat := createGoal(map[string]any{"kind": "exercise_weight", "exercise_name": "Squat", "target": 225, "weight_unit": "lb"})
+	assert.Equal(t, 102.058, squat["target"])
+	assert.Equal(t, today.Format(time.DateOnly), squat["starts_on"])
+	assert.Equal(t, "in_progress", squat["status"])
+	assert.Equal(t, float64(0), squat["percent_complete"])
+
+	// twice a week over two weeks
+	frequency := createGoal(map[string]any{"kind": "frequency", "target": 2, "deadline": inTwoWeeks})
+	calories := createGoal(map[string]any{"kind": "calories", "target": 800})
+	missed := createGoal(map[string]any{"kind": "total_duration", "target": 100, "starts_on": "2024-01-01", "deadline": "2024-01-31"})
+	assert.Equal(t, "missed", missed["status"])
+
+	for _, payload := range []map[string]any{
+		{"kind": "streak", "target": 1},
+		{"kind": "calories", "target": 0},
+		{"kind": "frequency", "target": 2},
+		{"kind": "exercise_reps", "target": 10},
+		{"kind": "exercise_weight", "exercise_id": 999999, "target": 100},
+		{"kind": "calories", "target": 800, "starts_on": "2024-02-01", "deadline": "2024-01-01"},
+		{"kind": "exercise_weight", "exercise_name": "Squat", "target": 100, "weight_unit": "stone"},
+		{"kind": "body_weight", "target": 75},
+	} {
+		res := ts.do(http.MethodPost, "/users/me/goals", token, payload)
+		assert.Equal(t, http.StatusBadRequest, res.status, "%v", payload)
+	}
+
+	ts.createWorkout(token)
+
+	squat = getGoal(squat)
+	assert.Equal(t, float64(100), squat["current_value"])
+	assert.Equal(t, 98.0, squat["percent_complete"])
+	frequency = getGoal(frequency)
+	assert.Equal(t, float64(1), frequency["current_value"])
+	assert.Equal(t, 25.0, frequency["percent_complete"])
+	assert.Equal(t, 50.0, getGoal(calories)["percent_complete"])
+
+	workoutPayload := testWorkoutPayload()
+	workoutPayload["exercises"] = []map[string]any{{"name": "squat", "sets": 1, "reps": 3, "weight": 105}}
+	res := ts.do(http.MethodPost, "/workouts", token, workoutPayload)
+	require.Equal(t, http.StatusCreated, res.status)
+	workoutID := int(res.body["workout"].(map[string]any)["id"].(float64))
+
+	res = ts.do(http.MethodGet, "/users/me/goals?status=achieved", token, nil)
+	require.Equal(t, http.StatusOK, res.status)
+	goals := res.body["goals"].([]any)
+	require.Len(t, goals, 2)
+	for _, goal := range goals {
+		assert.Equal(t, float64(100), goal.(map[string]any)["percent_complete"])
+		assert.NotNil(t, goal.(map[string]any)["achieved_at"])
+	}
+
+	res = ts.do(http.MethodGet, "/users/me/goals?status=done", token, nil)
+	assert.Equal(t, http.StatusBadRequest, res.status)
+
+	// a workout moved to the trash no longer counts
+	res = ts.do(http.MethodDelete, fmt.Sprintf("/workouts/%d", workoutID), token, nil)
+	require.Equal(t, http.StatusNoContent, res.status)
+	calories = getGoal(calories)
+	assert.Equal(t, "in_progress", calories["status"])
+	assert.Nil(t, calories["achieved_at"])
+	assert.Equal(t, float64(100), getGoal(squat)["current_value"])
+
+	res = ts.do(http.MethodPatch, "/users/me", token, map[string]any{"body_weight_kg": 80})
+	require.Equal(t, http.StatusOK, res.status)
+	bodyWeight := createGoal(map[string]any{"kind": "body_weight", "target": 75})
+	assert.Equal(t, float64(80), bodyWeight["start_value"])
+	assert.Equal(t, float64(0), bodyWeight["percent_complete"])
+
+	res = ts.do(http.MethodPost, "/users/me/measurements", token, map[string]any{"measured_on": today.Format(time.DateOnly), "weight": 77.5})
+	require.Equal(t, http.StatusCreated, res.status)
+	assert.Equal(t, 50.0, getGoal(bodyWeight)["percent_complete"])
+
+	res = ts.doWithHeaders(http.MethodGet, goalPath(bodyWeight), token, nil, map[string]string{"Accept-Units": "imperial"})
+	require.Equal(t, http.StatusOK, res.status)
+	assert.Equal(t, "lb", res.body["weight_unit"])
+	assert.Equal(t, 165.35, res.body["goal"].(map[string]any)["target"])
+	assert.Equal(t, 170.86, res.body["goal"].(map[string]any)["current_value"])
+
+	res = ts.do(http.MethodPut, goalPath(squat), token, map[string]any{"kind": "exercise_reps", "exercise_name": "Squat", "weight": 100, "target": 5})
+	require.Equal(t, http.StatusOK, res.status)
+	squat = res.body["goal"].(map[string]any)
+	assert.Equal(t, today.Format(time.DateOnly), squat["starts_on"])
+	assert.Equal(t, float64(5), squat["current_value"])
+	assert.Equal(t, "achieved", squat["status"])
+
+	res = ts.do(http.MethodGet, goalPath(squat), otherToken, nil)
+	assert.Equal(t, http.StatusNotFound, res.status)
+
+	res = ts.do(http.MethodGet, "/users/me/goals", otherToken, nil)
+	require.Equal(t, http.StatusOK, res.status)
+	assert.Empty(t, res.body["goals"])
+
+	res = ts.do(http.MethodDelete, goalPath(squat), otherToken, nil)
+	assert.Equal(t, http.StatusNotFound, res.status)
+
+	res = ts.do(http.MethodDelete, goalPath(squat), token, nil)
+	assert.Equal(t, http.StatusNoContent, res.status)
+
+	res = ts.do(http.MethodGet, goalPath(squat), token, nil)
+	assert.Equal(t, http.StatusNotFound, res.status)
+}
+
+func TestStreaks(t *testing.T) {
+	ts := newTestServer(t)
+	_, token := ts.registerAndLogin("alice")
+	_, otherToken := ts.registerAndLogin("bob")
+
+	getStreaks := func(token string) map[string]any {
+		t.Helper()
+
+		res := ts.do(http.MethodGet, "/users/me/streaks", token, nil)
+		require.Equal(t, http.StatusOK, res.status)
+		return res.body["streaks"].(map[string]any)
+	}
+
+	streaks := getStreaks(token)
+	assert.Equal(t, "UTC", streaks["time_zone"])
+	assert.Equal(t, time.Now().UTC().Format(time.DateOnly), streaks["today"])
+	assert.Nil(t, streaks["last_workout_on"])
+	assert.Equal(t, map[string]any{"current": float64(0), "longest": float64(0)}, streaks["daily"])
+
+	firstID := ts.createWorkout(token)
+	secondID := ts.createWorkout(token)
+
+	streaks = getStreaks(token)
+	assert.Equal(t, streaks["today"], streaks["last_workout_on"])
+	assert.Equal(t, map[string]any{"current": float64(1), "longest": float64(1)}, streaks["daily"])
+	assert.Equal(t, map[string]any{"current": float64(1), "longest": float64(1)}, streaks["weekly"])
+
+	for _, payload := range []map[string]any{
+		{"time_zone": "Mars/Olympus_Mons"},
+		{"time_zone": "Local"},
+		{"streak_rest_days": 7},
+		{"streak_rest_days": -1},
+	} {
+		res := ts.do(http.MethodPatch, "/users/me", token, payload)
+		assert.Equal(t, http.StatusBadRequest, res.status, "%v", payload)
+	}
+
+	res := ts.do(http.MethodPatch, "/users/me", token, map[string]any{"time_zone": "Pacific/Kiritimati", "streak_rest_days": 1})
+	require.Equal(t, http.StatusOK, res.status)
+	assert.Equal(t, "Pacific/Kiritimati", res.body["user"].(map[string]any)["time_zone"])
+
+	kiritimati, err := time.LoadLocation("Pacific/Kiritimati")
+	require.NoError(t, err)
+	streaks = getStreaks(token)
+	assert.Equal(t, time.Now().In(kiritimati).Format(time.DateOnly), streaks["today"])
+	assert.Equal(t, streaks["today"], streaks["last_workout_on"])
+	assert.Equal(t, float64(1), streaks["rest_days"])
+	assert.Equal(t, float64(1), streaks["daily"].(map[string]any)["current"])
+
+	// the time zone of a user is part of their private profile
+	aliceID := int(res.body["user"].(map[string]any)["id"].(float64))
+	res = ts.do(http.MethodGet, fmt.Sprintf("/users/%d", aliceID), otherToken, nil)
+	require.Equal(t, http.StatusOK, res.status)
+	assert.NotContains(t, res.body["user"], "time_zone")
+
+	assert.Nil(t, getStreaks(otherToken)["last_workout_on"])
+
+	// the day ends its streaks only once its last workout is gone
+	res = ts.do(http.MethodDelete, fmt.Sprintf("/workouts/%d", firstID), token, nil)
+	require.Equal(t, http.StatusNoContent, res.status)
+	assert.Equal(t, float64(1), getStreaks(token)["daily"].(map[string]any)["longest"])
+
+	res = ts.do(http.MethodDelete, fmt.Sprintf("/workouts/%d", secondID), token, nil)
+	require.Equal(t, http.StatusNoContent, res.status)
+
+	streaks = getStreaks(token)
+	assert.Nil(t, streaks["last_workout_on"])
+	assert.Equal(t, map[string]any{"current": float64(0), "longest": float64(0)}, streaks["weekly"])
+
+	res = ts.do(http.MethodPost, fmt.Sprintf("/workouts/%d/restore", firstID), token, nil)
+	require.Equal(t, http.StatusOK, res.status, "%v", res.body)
+	assert.Equal(t, float64(1), getStreaks(token)["daily"].(map[string]any)["current"])
+}
+
+func TestWorkoutTimes(t *testing.T) {
+	ts := newTestServer(t)
+	_, token := ts.registerAndLogin("alice")
+
+	res := ts.do(http.MethodPatch, "/users/me", token, map[string]any{"time_zone": "America/New_York"})
+	require.Equal(t, http.StatusOK, res.status)
+
+	// a Sunday evening in New York, logged the next day
+	payload := testWorkoutPayload()
+	delete(payload, "duration_minutes")
+	payload["started_at"] = "2024-03-03T20:00:00-05:00"
+	payload["ended_at"] = "2024-03-03T21:15:00-05:00"
+	res = ts.do(http.MethodPost, "/workouts", token, payload)
+	require.Equal(t, http.StatusCreated, res.status, "%v", res.body)
+	workout := res.body["workout"].(map[string]any)
+	assert.Equal(t, "2024-03-04T01:00:00Z", workout["started_at"])
+	assert.Equal(t, float64(75), workout["duration_minutes"], "the duration is the time from start to end")
+	workoutPath := fmt.Sprintf("/workouts/%d", int(workout["id"].(float64)))
+
+	for _, times := range []map[string]any{
+		{"started_at": time.Now().Add(time.Hour).Format(time.RFC3339)},
+		{"ended_at": "2024-03-03T21:15:00Z"},
+		{"started_at": "2024-03-03T20:00:00Z", "ended_at": "2024-03-03T19:00:00Z"},
+		{"started_at": "Sunday evening"},
+	} {
+		payload := testWorkoutPayload()
+		maps.Copy(payload, times)
+		res = ts.do(http.MethodPost, "/workouts", token, payload)
+		assert.Equal(t, http.StatusBadRequest, res.status, "%v", times)
+	}
+
+	res = ts.do(http.MethodGet, "/users/me/stats?from=2024-03-03&to=2024-03-04&bucket=day", token, nil)
+	require.Equal(t, http.StatusOK, res.status)
+	buckets := res.body["stats"].(map[string]any)["buckets"].([]any)
+	require.Len(t, buckets, 2)
+	assert.Equal(t, float64(1), buckets[0].(map[string]any)["workouts"], "the workout is on the Sunday of the user")
+	assert.Equal(t, float64(0), buckets[1].(map[string]any)["workouts"])
+
+	res = ts.do(http.MethodPut, workoutPath, token, map[string]any{"started_at": "2024-03-04T18:00:00-05:00", "ended_at": "2024-03-04T19:00:00-05:00"})
+	require.Equal(t, http.StatusOK, res.status, "%v", res.body)
+
+	res = ts.do(http.MethodGet, "/users/me/stats?from=2024-03-03&to=2024-03-04&bucket=day", token, nil)
+	require.Equal(t, http.StatusOK, res.status)
+	buckets = res.body["stats"].(map[string]any)["buckets"].([]any)
+	assert.Equal(t, float64(0), buckets[0].(map[string]any)["workouts"])
+	assert.Equal(t, float64(1), buckets[1].(map[string]any)["workouts"])
+
+	res = ts.do(http.MethodGet, "/users/me/streaks", token, nil)
+	require.Equal(t, http.StatusOK, res.status)
+	assert.Equal(t, "2024-03-04", res.body["streaks"].(map[string]any)["last_workout_on"])
+
+	res = ts.do(http.MethodPut, workoutPath, token, map[string]any{"ended_at": "2024-03-04T17:00:00-05:00"})
+	assert.Equal(t, http.StatusBadRequest, res.status)
+}
+
+func TestCalendar(t *testing.T) {
+	t.Setenv("BASE_URL", "https://api.example.com/")
+	ts := newTestServer(t)
+	_, token := ts.registerAndLogin("alice")
+	_, otherToken := ts.registerAndLogin("bob")
+
+	res := ts.do(http.MethodPatch, "/users/me", token, map[string]any{"time_zone": "America/New_York"})
+	require.Equal(t, http.StatusOK, res.status)
+
+	res = ts.do(http.MethodPost, "/templates", token, map[string]any{"name": "Leg Day", "duration_minutes": 60})
+	require.Equal(t, http.StatusCreated, res.status)
+	templateID := res.body["template"].(map[string]any)["id"]
+
+	res = ts.do(http.MethodPost, "/programs", token, map[string]any{
+		"name":  "Strength",
+		"weeks": 1,
+		"days": []map[string]any{
+			{"week": 1, "day": 1, "template_id": templateID},
+			{"week": 1, "day": 3, "template_id": templateID},
+		},
+	})
+	require.Equal(t, http.StatusCreated, res.status)
+	programPath := fmt.Sprintf("/programs/%d", int(res.body["program"].(map[string]any)["id"].(float64)))
+
+	res = ts.do(http.MethodPost, programPath+"/enrollments", token, map[string]any{"start_date": "2024-03-04"})
+	require.Equal(t, http.StatusCreated, res.status)
+
+	// a Sunday evening in New York, which is already Monday in UTC
+	payload := testWorkoutPayload()
+	payload["started_at"] = "2024-03-03T20:00:00-05:00"
+	res = ts.do(http.MethodPost, "/workouts", token, payload)
+	require.Equal(t, http.StatusCreated, res.status)
+	workoutID := res.body["workout"].(map[string]any)["id"]
+
+	res = ts.do(http.MethodGet, "/users/me/calendar?from=2024-03-03&to=2024-03-06", token, nil)
+	require.Equal(t, http.StatusOK, res.status)
+	calendar := res.body["calendar"].(map[string]any)
+	assert.Equal(t, "America/New_York", calendar["time_zone"])
+	days := calendar["days"].([]any)
+	require.Len(t, days, 4)
+
+	sunday := days[0].(map[string]any)
+	assert.Equal(t, "2024-03-03", sunday["date"])
+	require.Len(t, sunday["workouts"], 1)
+	assert.Equal(t, workoutID, sunday["workouts"].([]any)[0].(map[string]any)["id"])
+	assert.Empty(t, sunday["sessions"])
+
+	monday := days[1].(map[string]any)
+	assert.Empty(t, monday["workouts"])
+	require.Len(t, monday["sessions"], 1)
+	session := monday["sessions"].([]any)[0].(map[string]any)
+	assert.Equal(t, "Strength", session["program_name"])
+	assert.Equal(t, "missed", session["status"])
+	assert.Len(t, days[3].(map[string]any)["sessions"], 1)
+
+	res = ts.doWithHeaders(http.MethodGet, "/users/me/calendar?from=2024-03-03&to=2024-03-03", token, nil, map[string]string{"Accept-Units": "imperial"})
+	require.Equal(t, http.StatusOK, res.status)
+	assert.Equal(t, "lb", res.body["weight_unit"])
+
+	for _, query := range []string{"from=March", "from=2024-03-06&to=2024-03-03", "from=2024-01-01&to=2025-12-31"} {
+		res = ts.do(http.MethodGet, "/users/me/calendar?"+query, token, nil)
+		assert.Equal(t, http.StatusBadRequest, res.status, query)
+	}
+
+	res = ts.do(http.MethodGet, "/users/me/calendar?from=2024-03-03&to=2024-03-03", otherToken, nil)
+	require.Equal(t, http.StatusOK, res.status)
+	assert.Empty(t, res.body["calendar"].(map[string]any)["days"].([]any)[0].(map[string]any)["workouts"])
+
+	// the feed holds the workouts of the last months
+	payload = testWorkoutPayload()
+	payload["name"] = "Legs, then core"
+	payload["started_at"] = time.Now().Add(-24 * time.Hour).Truncate(time.Minute).Format(time.RFC3339)
+	res = ts.do(http.MethodPost, "/workouts", token, payload)
+	require.Equal(t, http.StatusCreated, res.status)
+	recentID := int(res.body["workout"].(map[string]any)["id"].(float64))
+
+	// the URL starts with the configured one, whatever the Host of the request
+	res = ts.doWithHeaders(http.MethodPost, "/users/me/calendar/feed", token, nil, map[string]string{"X-Forwarded-Proto": "http"})
+	require.Equal(t, http.StatusCreated, res.status)
+	feedURL, err := url.Parse(res.body["feed"].(map[string]any)["url"].(string))
+	require.NoError(t, err)
+	assert.Equal(t, "https", feedURL.Scheme)
+	assert.Equal(t, "api.example.com", feedURL.Host)
+	assert.True(t, strings.HasSuffix(feedURL.Path, ".ics"))
+
+	res = ts.do(http.MethodGet, feedURL.Path, "", nil)
+	require.Equal(t, http.StatusOK, res.status)
+	assert.Equal(t, "text/calendar; charset=utf-8", res.header.Get("Content-Type"))
+	feed := string(res.raw)
+	assert.True(t, strings.HasPrefix(feed, "BEGIN:VCALENDAR\r\n"))
+	assert.Contains(t, feed, "TZID:America/New_York\r\n")
+	assert.Contains(t, feed, fmt.Sprintf("UID:workout-%d@fem-go-crud\r\n", recentID))
+	assert.Contains(t, feed, "DTSTART;TZID=America/New_York:")
+	assert.Contains(t, feed, "DURATION:PT60M\r\n")
+	assert.Contains(t, feed, "SUMMARY:Legs\\, then core\r\n")
+	assert.Contains(t, feed, "DESCRIPTION:Squats and core\\n\\nSquat: 5 × 5 @ 100 kg\\nPlank: 3 × 60 s\r\n")
+	assert.NotContains(t, feed, fmt.Sprintf("UID:workout-%d@", int(workoutID.(float64))), "the workout is older than the feed")
+	for _, line := range strings.Split(feed, "\r\n") {
+		assert.LessOrEqual(t, len(line), 75)
+	}
+
+	// creating the feed again revokes its previous URL
+	res = ts.do(http.MethodPost, "/users/me/calendar/feed", token, nil)
+	require.Equal(t, http.StatusCreated, res.status)
+	rotatedURL, err := url.Parse(res.body["feed"].(map[string]any)["url"].(string))
+	require.NoError(t, err)
+
+	res = ts.do(http.MethodGet, feedURL.Path, "", nil)
+	assert.Equal(t, http.StatusNotFound, res.status)
+	res = ts.do(http.MethodGet, rotatedURL.Path, "", nil)
+	assert.Equal(t, http.StatusOK, res.status)
+
+	// the feed token does not authenticate API requests
+	res = ts.do(http.MethodGet, "/users/me/streaks", strings.TrimSuffix(path.Base(rotatedURL.Path), ".ics"), nil)
+	assert.Equal(t, http.StatusUnauthorized, res.status)
+
+	res = ts.do(http.MethodDelete, "/users/me/calendar/feed", token, nil)
+	require.Equal(t, http.StatusNoContent, res.status)
+	res = ts.do(http.MethodGet, rotatedURL.Path, "", nil)
+	assert.Equal(t, http.StatusNotFound, res.status)
+
+	// changing the password revokes the feed
+	res = ts.do(http.MethodPost, "/users/me/calendar/feed", token, nil)
+	require.Equal(t, http.StatusCreated, res.status)
+	feedURL, err = url.Parse(res.body["feed"].(map[string]any)["url"].(string))
+	require.NoError(t, err)
+
+	res = ts.do(http.MethodPut, "/users/me/password", token, map[string]string{"current_password": "password123", "new_password": "new-password456"})
+	require.Equal(t, http.StatusNoContent, res.status)
+	res = ts.do(http.MethodGet, feedURL.Path, "", nil)
+	assert.Equal(t, http.StatusNotFound, res.status)
+}
+
+func TestDataExport(t *testing.T) {
+	t.Setenv("EXPORT_DIR", t.TempDir())
+	ts := newTestServer(t)
+	_, token := ts.registerAndLogin("alice")
+	_, otherToken := ts.registerAndLogin("bob")
+	workoutID := ts.createWorkout(token)
+
+	readArchive := func(res *testResponse) map[string][]byte {
+		t.Helper()
+
+		archive, err := zip.NewReader(bytes.NewReader(res.raw), int64(len(res.raw)))
+		require.NoError(t, err)
+		files := make(map[string][]byte)
+		for _, file := range archive.File {
+			reader, err := file.Open()
+			require.NoError(t, err)
+			files[file.Name], err = io.ReadAll(reader)
+			require.NoError(t, err)
+		}
+		return files
+	}
+
+	res := ts.do(http.MethodGet, "/users/me/export", token, nil)
+	require.Equal(t, http.StatusOK, res.status)
+	assert.Equal(t, "application/zip", res.header.Get("Content-Type"))
+	assert.Contains(t, res.header.Get("Content-Disposition"), "attachment")
+	files := readArchive(res)
+	assert.Contains(t, string(files["README.txt"]), "exercises.csv")
+	assert.Contains(t, string(files["profile.json"]), `"username": "alice"`)
+	var workouts []map[string]any
+	require.NoError(t, json.Unmarshal(files["workouts.json"], &workouts))
+	require.Len(t, workouts, 1)
+	assert.Equal(t, float64(workoutID), workouts[0]["id"])
+	assert.Len(t, strings.Split(strings.TrimSpace(string(files["exercises.csv"])), "\n"), 3)
+
+	res = ts.do(http.MethodGet, "/users/me/export?async=true", token, nil)
+	require.Equal(t, http.StatusAccepted, res.status)
+	exportPath := res.header.Get("Location")
+	require.NotEmpty(t, exportPath)
+	assert.Equal(t, "pending", res.body["export"].(map[string]any)["status"])
+
+	require.Eventually(t, func() bool {
+		res = ts.do(http.MethodGet, exportPath, token, nil)
+		return res.status == http.StatusOK && res.body["export"].(map[string]any)["status"] != "pending"
+	}, 5*time.Second, 10*time.Millisecond)
+	export := res.body["export"].(map[string]any)
+	require.Equal(t, "ready", export["status"])
+	assert.NotNil(t, export["expires_at"])
+
+	res = ts.do(http.MethodGet, exportPath, otherToken, nil)
+	assert.Equal(t, http.StatusForbidden, res.status)
+	res = ts.do(http.MethodGet, exportPath+"/download", otherToken, nil)
+	assert.Equal(t, http.StatusForbidden, res.status)
+	res = ts.do(http.MethodGet, "/users/me/exports/999", token, nil)
+	assert.Equal(t, http.StatusNotFound, res.status)
+
+	res = ts.do(http.MethodGet, exportPath+"/download", token, nil)
+	require.Equal(t, http.StatusOK, res.status)
+	assert.Equal(t, "application/zip", res.header.Get("Content-Type"))
+	assert.Equal(t, export["size_bytes"], float64(len(res.raw)))
+	assert.Equal(t, files["workouts.json"], readArchive(res)["workouts.json"])
+
+	res = ts.do(http.MethodGet, "/users/me/export?async=true", token, nil)
+	require.Equal(t, http.StatusAccepted, res.status)
+	assert.Equal(t, exportPath, res.header.Get("Location"), "the ready export is reused")
+}
+
+func TestBatchWorkouts(t *testing.T) {
+	ts := newTestServer(t)
+	_, token := ts.registerAndLogin("alice")
+	_, otherToken := ts.registerAndLogin("bob")
+	workoutID := ts.createWorkout(token)
+	deletedID := ts.createWorkout(token)
+	otherWorkoutID := ts.createWorkout(otherToken)
+
+	results := func(res *testResponse) []map[string]any {
+		t.Helper()
+
+		var items []map[string]any
+		for _, item := range res.body["results"].([]any) {
+			items = append(items, item.(map[string]any))
+		}
+		return items
+	}
+
+	res := ts.do(http.MethodPost, "/workouts/batch", token, map[string]any{
+		"operations": []map[string]any{
+			{"op": "create", "workout": testWorkoutPayload()},
+			{"op": "update", "id": workoutID, "version": 1, "workout": map[string]any{"name": "Upper Body"}},
+			{"op": "delete", "id": deletedID},
+			{"op": "create", "workout": testWorkoutPayload()},
+		},
+	})
+	require.Equal(t, http.StatusOK, res.status)
+	items := results(res)
+	require.Len(t, items, 4)
+	assert.Equal(t, float64(http.StatusCreated), items[0]["status"])
+	assert.Equal(t, float64(http.StatusOK), items[1]["status"])
+	assert.Equal(t, "Upper Body", items[1]["workout"].(map[string]any)["name"])
+	assert.Equal(t, float64(http.StatusNoContent), items[2]["status"])
+	assert.Equal(t, float64(http.StatusCreated), items[3]["status"])
+	createdID := int(items[3]["workout"].(map[string]any)["id"].(float64))
+	assert.Len(t, items[3]["workout"].(map[string]any)["exercises"], 2)
+
+	res = ts.do(http.MethodGet, fmt.Sprintf("/workouts/%d", createdID), token, nil)
+	assert.Equal(t, http.StatusOK, res.status)
+	res = ts.do(http.MethodGet, fmt.Sprintf("/workouts/%d/revisions", createdID), token, nil)
+	require.Equal(t, http.StatusOK, res.status)
+	assert.Len(t, res.body["revisions"], 1)
+	res = ts.do(http.MethodGet, fmt.Sprintf("/workouts/%d", deletedID), token, nil)
+	assert.Equal(t, http.StatusNotFound, res.status)
+
+	// an atomic batch is rolled back as a whole
+	res = ts.do(http.MethodPost, "/workouts/batch", token, map[string]any{
+		"operations": []map[string]any{
+			{"op": "create", "workout": testWorkoutPayload()},
+			{"op": "update", "id": workoutID, "workout": map[string]any{"name": "Rolled Back"}},
+			{"op": "delete", "id": otherWorkoutID},
+		},
+	})
+	require.Equal(t, http.StatusUnprocessableEntity, res.status)
+	items = results(res)
+	assert.Equal(t, float64(http.StatusFailedDependency), items[0]["status"])
+	assert.Nil(t, items[0]["workout"])
+	assert.Equal(t, float64(http.StatusFailedDependency), items[1]["status"])
+	assert.Equal(t, float64(http.StatusForbidden), items[2]["status"])
+
+	res = ts.do(http.MethodGet, fmt.Sprintf("/workouts/%d", workoutID), token, nil)
+	require.Equal(t, http.StatusOK, res.status)
+	assert.Equal(t, "Upper Body", res.body["workout"].(map[string]any)["name"])
+	res = ts.do(http.MethodGet, fmt.Sprintf("/workouts/%d", createdID+1), token, nil)
+	assert.Equal(t, http.StatusNotFound, res.status)
+
+	res = ts.do(http.MethodPost, "/workouts/batch", token, map[string]any{
+		"operations": []map[string]any{
+			{"op": "create", "workout": map[string]any{"name": ""}},
+			{"op": "delete", "id": workoutID},
+		},
+	})
+	require.Equal(t, http.StatusUnprocessableEntity, res.status)
+	items = results(res)
+	assert.Equal(t, float64(http.StatusBadRequest), items[0]["status"])
+	assert.Equal(t, float64(http.StatusFailedDependency), items[1]["status"])
+
+	// a best effort batch reports every operation on its own
+	res = ts.do(http.MethodPost, "/workouts/batch", token, map[string]any{
+		"mode": "best_effort",
+		"operations": []map[string]any{
+			{"op": "create", "workout": testWorkoutPayload()},
+			{"op": "create", "workout": map[string]any{"name": ""}},
+			{"op": "update", "id": workoutID, "version": 1, "workout": map[string]any{"name": "Stale"}},
+			{"op": "update", "id": workoutID, "workout": map[string]any{"name": "Full Body"}},
+			{"op": "delete", "id": otherWorkoutID},
+			{"op": "delete", "id": deletedID},
+			{"op": "rename", "id": workoutID},
+		},
+	})
+	require.Equal(t, http.StatusOK, res.status)
+	items = results(res)
+	require.Len(t, items, 7)
+	assert.Equal(t, float64(http.StatusCreated), items[0]["status"])
+	assert.Equal(t, float64(http.StatusBadRequest), items[1]["status"])
+	assert.Equal(t, float64(http.StatusConflict), items[2]["status"])
+	assert.Equal(t, float64(http.StatusOK), items[3]["status"])
+	assert.Equal(t, float64(http.StatusForbidden), items[4]["status"])
+	assert.Equal(t, float64(http.StatusNotFound), items[5]["status"])
+	assert.Equal(t, float64(http.StatusBadRequest), items[6]["status"])
+
+	res = ts.do(http.MethodGet, fmt.Sprintf("/workouts/%d", otherWorkoutID), otherToken, nil)
+	assert.Equal(t, http.StatusOK, res.status)
+
+	// a value the columns cannot hold fails its own creation only
+	overflowing := testWorkoutPayload()
+	overflowing["exercises"] = []map[string]any{{"name": "Squat", "sets": 5, "reps": 40000, "weight": 100, "order_index": 1}}
+	heavy := testWorkoutPayload()
+	heavy["exercises"] = []map[string]any{{"name": "Squat", "sets": 1, "reps": 1, "weight": 100000, "order_index": 1}}
+	res = ts.do(http.MethodPost, "/workouts/batch", token, map[string]any{
+		"mode": "best_effort",
+		"operations": []map[string]any{
+			{"op": "create", "workout": testWorkoutPayload()},
+			{"op": "create", "workout": overflowing},
+			{"op": "create", "workout": heavy},
+			{"op": "create", "workout": testWorkoutPayload()},
+		},
+	})
+	require.Equal(t, http.StatusOK, res.status)
+	items = results(res)
+	require.Len(t, items, 4)
+	assert.Equal(t, float64(http.StatusCreated), items[0]["status"])
+	assert.Equal(t, float64(http.StatusBadRequest), items[1]["status"])
+	assert.Contains(t, items[1]["error"], "at most 32767")
+	assert.Equal(t, float64(http.StatusBadRequest), items[2]["status"])
+	assert.Equal(t, float64(http.StatusCreated), items[3]["status"])
+
+	res = ts.do(http.MethodPost, "/workouts/batch", token, map[string]any{"mode": "eventually", "operations": []map[string]any{{"op": "delete", "id": workoutID}}})
+	assert.Equal(t, http.StatusBadRequest, res.status)
+
+	res = ts.do(http.MethodPost, "/workouts/batch", token, map[string]any{"operations": []map[string]any{}})
+	assert.Equal(t, http.StatusBadRequest, res.status)
+
+	operations := make([]map[string]any, 501)
+	for i := range operations {
+		operations[i] = map[string]any{"op": "delete", "id": workoutID}
+	}
+	res = ts.do(http.MethodPost, "/workouts/batch", token, map[string]any{"operations": operations})
+	assert.Equal(t, http.StatusBadRequest, res.status)
+
+	res = ts.do(http.MethodPost, "/workouts/batch", "", map[string]any{"operations": operations[:1]})
+	assert.Equal(t, http.StatusUnauthorized, res.status)
+}
+
+func TestExercises(t *testing.T) {
+	ts := newTestServer(t)
+	_, token := ts.registerAndLogin("alice")
+	_, otherToken := ts.registerAndLogin("bob")
+
+	names := func(res *testResponse) []string {
+		t.Helper()
+
+		require.Equal(t, http.StatusOK, res.status)
+		names := []string{}
+		for _, exercise := range res.body["exercises"].([]any) {
+			names = append(names, exercise.(map[string]any)["name"].(string))
+		}
+		return names
+	}
+
+	res := ts.do(http.MethodGet, "/exercises?q=bench", token, nil)
+	assert.Equal(t, "Barbell Bench Press", names(res)[0], "the alias Bench is an exact match")
+
+	res = ts.do(http.MethodGet, "/exercises?muscle=triceps&equipment=cable", token, nil)
+	assert.Equal(t, []string{"Triceps Pushdown"}, names(res))
+
+	res = ts.do(http.MethodGet, "/exercises?tracking=time&movement_type=cardio&limit=2", token, nil)
+	assert.Len(t, names(res), 2)
+
+	for _, query := range []string{"limit=0", "limit=101", "limit=ten", "custom=maybe"} {
+		res = ts.do(http.MethodGet, "/exercises?"+query, token, nil)
+		assert.Equal(t, http.StatusBadRequest, res.status, query)
+	}
+
+	customExercise := map[string]any{
+		"name":            "Zercher Squat",
+		"aliases":         []string{"Zercher"},
+		"primary_muscles": []string{"quadriceps", "glutes"},
+		"equipment":       "barbell",
+		"movement_type":   "compound",
+		"tracking":        "reps",
+	}
+	res = ts.do(http.MethodPost, "/exercises", token, customExercise)
+	require.Equal(t, http.StatusCreated, res.status)
+	exercise := res.body["exercise"].(map[string]any)
+	exerciseID := int(exercise["id"].(float64))
+	assert.NotNil(t, exercise["user_id"])
+	assert.Equal(t, []any{}, exercise["secondary_muscles"])
+	path := fmt.Sprintf("/exercises/%d", exerciseID)
+
+	res = ts.do(http.MethodPost, "/exercises", token, customExercise)
+	assert.Equal(t, http.StatusConflict, res.status)
+
+	res = ts.do(http.MethodPost, "/exercises", otherToken, customExercise)
+	assert.Equal(t, http.StatusCreated, res.status, "custom exercise names are unique per user")
+
+	for field, value := range map[string]any{"name": "", "primary_muscles": []string{"wings"}, "equipment": "rock", "movement_type": "dance", "tracking": "distance"} {
+		invalidExercise := maps.Clone(customExercise)
+		invalidExercise["name"] = "Invalid"
+		invalidExercise[field] = value
+		res = ts.do(http.MethodPost, "/exercises", token, invalidExercise)
+		assert.Equal(t, http.StatusBadRequest, res.status, field)
+	}
+
+	res = ts.do(http.MethodGet, "/exercises?q=zercher", token, nil)
+	assert.Equal(t, []string{"Zercher Squat"}, names(res))
+	res = ts.do(http.MethodGet, "/exercises?custom=true", token, nil)
+	assert.Equal(t, []string{"Zercher Squat"}, names(res))
+
+	res = ts.do(http.MethodGet, path, token, nil)
+	require.Equal(t, http.StatusOK, res.status)
+	assert.Equal(t, "Zercher Squat", res.body["exercise"].(map[string]any)["name"])
+
+	res = ts.do(http.MethodGet, path, otherToken, nil)
+	assert.Equal(t, http.StatusForbidden, res.status)
+
+	res = ts.do(http.MethodGet, "/exercises/12345", token, nil)
+	assert.Equal(t, http.StatusNotFound, res.status)
+
+	res = ts.do(http.MethodPut, path, token, map[string]any{"equipment": "other"})
+	require.Equal(t, http.StatusOK, res.status)
+	assert.Equal(t, "other", res.body["exercise"].(map[string]any)["equipment"])
+	assert.Equal(t, "Zercher Squat", res.body["exercise"].(map[string]any)["name"])
+
+	res = ts.do(http.MethodPut, path, otherToken, map[string]any{"equipment": "other"})
+	assert.Equal(t, http.StatusForbidden, res.status)
+
+	res = ts.do(http.MethodGet, "/exercises?q=plank", token, nil)
+	require.Equal(t, http.StatusOK, res.status)
+	plank := res.body["exercises"].([]any)[0].(map[string]any)
+	assert.Nil(t, plank["user_id"])
+	plankID := int(plank["id"].(float64))
+
+	res = ts.do(http.MethodPut, fmt.Sprintf("/exercises/%d", plankID), token, map[string]any{"name": "My Plank"})
+	assert.Equal(t, http.StatusForbidden, res.status, "the catalog cannot be changed")
+	res = ts.do(http.MethodDelete, fmt.Sprintf("/exercises/%d", plankID), token, nil)
+	assert.Equal(t, http.StatusForbidden, res.status)
+
+	// workout exercises can reference the catalog and custom exercises
+	workoutPayload := testWorkoutPayload()
+	workoutPayload["exercises"] = []map[string]any{
+		{"exercise_id": exerciseID, "sets": 5, "reps": 5, "weight": 80, "order_index": 1},
+		{"exercise_id": plankID, "name": "Plank on knees", "sets": 3, "duration_seconds": 60, "order_index": 2},
+	}
+	res = ts.do(http.MethodPost, "/workouts", token, workoutPayload)
+	require.Equal(t, http.StatusCreated, res.status)
+	workout := res.body["workout"].(map[string]any)
+	workoutID := int(workout["id"].(float64))
+	exercises := workout["exercises"].([]any)
+	assert.Equal(t, "Zercher Squat", exercises[0].(map[string]any)["name"], "the name defaults to the exercise's")
+	assert.Equal(t, float64(exerciseID), exercises[0].(map[string]any)["exercise_id"])
+	assert.Equal(t, "Plank on knees", exercises[1].(map[string]any)["name"])
+
+	res = ts.do(http.MethodPost, "/workouts", otherToken, workoutPayload)
+	assert.Equal(t, http.StatusBadRequest, res.status, "custom exercises of other users cannot be referenced")
+
+	res = ts.do(http.MethodPost, fmt.Sprintf("/workouts/%d/exercises", workoutID), token, map[string]any{"exercise_id": 12345, "sets": 3, "reps": 10})
+	assert.Equal(t, http.StatusBadRequest, res.status)
+
+	res = ts.do(http.MethodPost, fmt.Sprintf("/workouts/%d/exercises", workoutID), token, map[string]any{"exercise_id": plankID, "sets": 1, "duration_seconds": 30})
+	require.Equal(t, http.StatusCreated, res.status)
+	assert.Equal(t, "Plank", res.body["exercise"].(map[string]any)["name"])
+
+	res = ts.do(http.MethodDelete, path, otherToken, nil)
+	assert.Equal(t, http.StatusForbidden, res.status)
+
+	res = ts.do(http.MethodDelete, path, token, nil)
+	assert.Equal(t, http.StatusNoContent, res.status)
+
+	res = ts.do(http.MethodGet, path, token, nil)
+	assert.Equal(t, http.StatusNotFound, res.status)
+
+	res = ts.do(http.MethodGet, fmt.Sprintf("/workouts/%d", workoutID), token, nil)
+	require.Equal(t, http.StatusOK, res.status)
+	exercise = res.body["workout"].(map[string]any)["exercises"].([]any)[0].(map[string]any)
+	assert.Nil(t, exercise["exercise_id"], "deleting the exercise unlinks it")
+	assert.Equal(t, "Zercher Squat", exercise["name"])
+}
+
+func TestWorkoutConditionalRequests(t *testing.T) {
+	ts := newTestServer(t)
+	_, token := ts.registerAndLogin("alice")
+	workoutID := ts.createWorkout(token)
+	path := fmt.Sprintf("/workouts/%d", workoutID)
+
+	res := ts.do(http.MethodGet, path, token, nil)
+	require.Equal(t, http.StatusOK, res.status)
+	etag := res.header.Get("ETag")
+	assert.Equal(t, `"1-kg"`, etag)
+
+	res = ts.doWithHeaders(http.MethodGet, path, token, nil, map[string]string{"If-None-Match": etag})
+	assert.Equal(t, http.StatusNotModified, res.status)
+	assert.Empty(t, res.raw)
+
+	res = ts.doWithHeaders(http.MethodPut, path, token, map[string]any{"name": "Edited"}, map[string]string{"If-Match": etag})
+	require.Equal(t, http.StatusOK, res.status)
+	newETag := res.header.Get("ETag")
+	assert.Equal(t, `"2-kg"`, newETag)
+
+	// a second device still holding the first version
+	res = ts.doWithHeaders(http.MethodPut, path, token, map[string]any{"name": "Stale edit"}, map[string]string{"If-Match": etag})
+	assert.Equal(t, http.StatusPreconditionFailed, res.status)
+
+	res = ts.doWithHeaders(http.MethodGet, path, token, nil, map[string]string{"If-None-Match": etag})
+	require.Equal(t, http.StatusOK, res.status)
+	assert.Equal(t, "Edited", res.body["workout"].(map[string]any)["name"])
+
+	// the weights of the body change with the unit system, the version does not
+	res = ts.do(http.MethodPatch, "/users/me", token, map[string]any{"unit_system": "imperial"})
+	require.Equal(t, http.StatusOK, res.status)
+
+	res = ts.doWithHeaders(http.MethodGet, path, token, nil, map[string]string{"If-None-Match": newETag})
+	require.Equal(t, http.StatusOK, res.status)
+	assert.Equal(t, `"2-lb"`, res.header.Get("ETag"))
+	assert.Equal(t, "lb", res.body["weight_unit"])
+
+	res = ts.doWithHeaders(http.MethodGet, path, token, nil, map[string]string{"If-None-Match": newETag, "Accept-Units": "metric"})
+	assert.Equal(t, http.StatusNotModified, res.status)
+
+	// the exercises are part of the workout and change its version
+	lunge := map[string]any{"name": "Lunge", "sets": 3, "reps": 12}
+	res = ts.doWithHeaders(http.MethodPost, path+"/exercises", token, lunge, map[string]string{"If-Match": newETag})
+	assert.Equal(t, http.StatusPreconditionFailed, res.status)
+
+	res = ts.doWithHeaders(http.MethodPost, path+"/exercises", token, lunge, map[string]string{"If-Match": `"2-lb"`})
+	require.Equal(t, http.StatusCreated, res.status)
+	assert.Equal(t, `"3-lb"`, res.header.Get("ETag"))
+	exerciseID := int(res.body["exercise"].(map[string]any)["id"].(float64))
+	exercisePath := fmt.Sprintf("%s/exercises/%d", path, exerciseID)
+
+	res = ts.doWithHeaders(http.MethodPut, exercisePath, token, lunge, map[string]string{"If-Match": `"2-lb"`})
+	assert.Equal(t, http.StatusPreconditionFailed, res.status)
+
+	res = ts.doWithHeaders(http.MethodPut, exercisePath, token, lunge, map[string]string{"If-Match": `"3-lb"`})
+	require.Equal(t, http.StatusOK, res.status)
+	assert.Equal(t, `"4-lb"`, res.header.Get("ETag"))
+
+	res = ts.doWithHeaders(http.MethodDelete, exercisePath, token, nil, map[string]string{"If-Match": `"3-lb"`})
+	assert.Equal(t, http.StatusPreconditionFailed, res.status)
+
+	res = ts.doWithHeaders(http.MethodDelete, exercisePath, token, nil, map[string]string{"If-Match": `"4-lb"`})
+	require.Equal(t, http.StatusNoContent, res.status)
+	assert.Equal(t, `"5-lb"`, res.header.Get("ETag"))
+
+	res = ts.do(http.MethodGet, path, token, nil)
+	require.Equal(t, http.StatusOK, res.status)
+	var exerciseIDs []int
+	for _, exercise := range res.body["workout"].(map[string]any)["exercises"].([]any) {
+		exerciseIDs = append([]int{int(exercise.(map[string]any)["id"].(float64))}, exerciseIDs...)
+	}
+
+	res = ts.doWithHeaders(http.MethodPut, path+"/exercises/order", token, map[string]any{"exercise_ids": exerciseIDs}, map[string]string{"If-Match": `"4-lb"`})
+	assert.Equal(t, http.StatusPreconditionFailed, res.status)
+
+	res = ts.doWithHeaders(http.MethodPut, path+"/exercises/order", token, map[string]any{"exercise_ids": exerciseIDs}, map[string]string{"If-Match": `"5-lb"`})
+	require.Equal(t, http.StatusOK, res.status)
+	assert.Equal(t, `"6-lb"`, res.header.Get("ETag"))
+
+	res = ts.doWithHeaders(http.MethodDelete, path, token, nil, map[string]string{"If-Match": etag})
+	assert.Equal(t, http.StatusPreconditionFailed, res.status)
+
+	res = ts.doWithHeaders(http.MethodDelete, path, token, nil, map[string]string{"If-Match": `"6-lb"`})
+	assert.Equal(t, http.StatusNoContent, res.status)
+}
+
+func TestIdempotencyKeys(t *testing.T) {
+	ts := newTestServer(t)
+	_, token := ts.registerAndLogin("alice")
+	_, otherToken := ts.registerAndLogin("bob")
+	headers := map[string]string{"Idempotency-Key": "create-leg-day"}
+
+	first := ts.doWithHeaders(http.MethodPost, "/workouts", token, testWorkoutPayload(), headers)
+	require.Equal(t, http.StatusCreated, first.status)
+
+	retry := ts.doWithHeaders(http.MethodPost, "/workouts", token, testWorkoutPayload(), headers)
+	require.Equal(t, http.StatusCreated, retry.status)
+	assert.Equal(t, "true", retry.header.Get("Idempotent-Replayed"))
+	assert.Equal(t, first.body, retry.body)
+
+	// the retry did not create a second workout
+	workoutID := int(first.body["workout"].(map[string]any)["id"].(float64))
+	res := ts.do(http.MethodGet, fmt.Sprintf("/workouts/%d", workoutID+1), token, nil)
+	assert.Equal(t, http.StatusNotFound, res.status)
+
+	changedPayload := testWorkoutPayload()
+	changedPayload["name"] = "Arm Day"
+	res = ts.doWithHeaders(http.MethodPost, "/workouts", token, changedPayload, headers)
+	assert.Equal(t, http.StatusUnprocessableEntity, res.status)
+
+	// keys are scoped per user
+	res = ts.doWithHeaders(http.MethodPost, "/workouts", otherToken, testWorkoutPayload(), headers)
+	require.Equal(t, http.StatusCreated, res.status)
+	assert.Empty(t, res.header.Get("Idempotent-Replayed"))
+
+	exercisePath := fmt.Sprintf("/workouts/%d/exercises", workoutID)
+	lunge := map[string]any{"name": "Lunge", "sets": 3, "reps": 12}
+	first = ts.doWithHeaders(http.MethodPost, exercisePath, token, lunge, map[string]string{"Idempotency-Key": "add-lunge"})
+	require.Equal(t, http.StatusCreated, first.status)
+	retry = ts.doWithHeaders(http.MethodPost, exercisePath, token, lunge, map[string]string{"Idempotency-Key": "add-lunge"})
+	require.Equal(t, http.StatusCreated, retry.status)
+	assert.Equal(t, "true", retry.header.Get("Idempotent-Replayed"))
+	res = ts.do(http.MethodGet, fmt.Sprintf("/workouts/%d", workoutID), token, nil)
+	require.Equal(t, http.StatusOK, res.status)
+	assert.Len(t, res.body["workout"].(map[string]any)["exercises"], len(testWorkoutPayload()["exercises"].([]map[string]any))+1)
+
+	registerPayload := map[string]string{"username": "carol", "email": "carol@example.com", "password": "password123"}
+	res = ts.doWithHeaders(http.MethodPost, "/users", "", registerPayload, map[string]string{"Idempotency-Key": "register-carol"})
+	require.Equal(t, http.StatusCreated, res.status)
+	res = ts.doWithHeaders(http.MethodPost, "/users", "", registerPayload, map[string]string{"Idempotency-Key": "register-carol"})
+	require.Equal(t, http.StatusCreated, res.status)
+	assert.Equal(t, "true", res.header.Get("Idempotent-Replayed"))
+
+	loginPayload := map[string]string{"username": "carol", "password": "password123"}
+	first = ts.doWithHeaders(http.MethodPost, "/tokens/authenticate", "", loginPayload, map[string]string{"Idempotency-Key": "login-carol"})
+	require.Equal(t, http.StatusCreated, first.status)
+	retry = ts.doWithHeaders(http.MethodPost, "/tokens/authenticate", "", loginPayload, map[string]string{"Idempotency-Key": "login-carol"})
+	require.Equal(t, http.StatusCreated, retry.status)
+	assert.Empty(t, retry.header.Get("Idempotent-Replayed"), "tokens are never stored to be replayed")
+	assert.NotEqual(t, first.body["token"], retry.body["token"])
+}
+
+// TestAllRoutesCovered fails when a route is added to MakeRouter without a
+// matching end-to-end test above.
+func TestAllRoutesCovered(t *testing.T) {
+	testedRoutes := map[string]bool{
+		"GET /poke":                                     true,
+		"POST /users":                                   true,
+		"POST /tokens/authenticate":                     true,
+		"GET /users/{userId}":                           true,
+		"PUT /users/me/password":                        true,
+		"PATCH /users/me":                               true,
+		"DELETE /users/me":                              true,
+		"POST /users/me/legacy-weights":                 true,
+		"GET /users/me/records":                         true,
+		"GET /users/me/stats":                           true,
+		"GET /users/me/measurements":                    true,
+		"GET /users/me/measurements/latest":             true,
+		"GET /users/me/measurements/{measurementId}":    true,
+		"POST /users/me/measurements":                   true,
+		"PUT /users/me/measurements/{measurementId}":    true,
+		"DELETE /users/me/measurements/{measurementId}": true,
+		"GET /users/me/goals":                           true,
+		"GET /users/me/goals/{goalId}":                  true,
+		"POST /users/me/goals":                          true,
+		"PUT /users/me/goals/{goalId}":                  true,
+		"DELETE /users/me/goals/{goalId}":               true,
+		"GET /users/me/streaks":                         true,
+		"GET /users/me/calendar":                        true,
+		"POST /users/me/calendar/feed":                  true,
+		"DELETE /users/me/calendar/feed":                true,
+		"GET /calendar/{token}.ics":                     true,
+		"GET /users/me/export":                          true,
+		"GET /users/me/exports/{exportId}":              true,
+		"GET /users/me/exports/{exportId}/download":     true,
+
+		"GET /users/me/exercises/{name}/progress": true,
+		"GET /workouts/{workoutId}":               true,
+		"POST /workouts":                          true,
+		"PUT /workouts/{workoutId}":               true,
+		"PATCH /workouts/{workoutId}":             true,
+		"DELETE /workouts/{workoutId}":            true,
+
+		"POST /workouts/{workoutId}/exercises":                true,
+		"PUT /workouts/{workoutId}/exercises/order":           true,
+		"PUT /workouts/{workoutId}/exercises/{exerciseId}":    true,
+		"DELETE /workouts/{workoutId}/exercises/{exerciseId}": true,
+
+		"POST /workouts/batch":                                            true,
+		"GET /exercises":                                                  true,
+		"GET /exercises/{exerciseId}":                                     true,
+		"POST /exercises":                                                 true,
+		"PUT /exercises/{exerciseId}":                                     true,
+		"DELETE /exercises/{exerciseId}":                                  true,
+		"GET /templates":                                                  true,
+		"GET /templates/{templateId}":                                     true,
+		"POST /templates":                                                 true,
+		"PUT /templates/{templateId}":                                     true,
+		"DELETE /templates/{templateId}":                                  true,
+		"POST /templates/{templateId}/start":                              true,
+		"POST /workouts/{workoutId}/template":                             true,
+		"GET /programs":                                                   true,
+		"GET /programs/{programId}":                                       true,
+		"POST /programs":                                                  true,
+		"PUT /programs/{programId}":                                       true,
+		"DELETE /programs/{programId}":                                    true,
+		"POST /programs/{programId}/enrollments":                          true,
+		"GET /enrollments":                                                true,
+		"GET /enrollments/{enrollmentId}":                                 true,
+		"DELETE /enrollments/{enrollmentId}":                              true,
+		"PUT /enrollments/{enrollmentId}/sessions/{sessionId}/workout":    true,
+		"DELETE /enrollments/{enrollmentId}/sessions/{sessionId}/workout": true,
+		"GET /workouts/search":                                            true,
+		"GET /workouts/trash":                                             true,
+		"DELETE /workouts/trash/{workoutId}":                              true,
+		"POST /workouts/{workoutId}/restore":                              true,
+		"GET /workouts/{workoutId}/revisions":                             true,
+		"GET /workouts/{workoutId}/revisions/{revision}":                  true,
+		"POST /workouts/{workoutId}/revisions/{revision}/restore":         true,
+	}
+
+	ts := newTestServer(t)
+	err := chi.Walk(ts.router, func(method string, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		assert.True(t, testedRoutes[method+" "+route], "route %s %s has no end-to-end test", method, route)
+		return nil
+	})
+	require.NoError(t, err)
+}
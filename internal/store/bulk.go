@@ -0,0 +1,116 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Postgres accepts at most 65535 parameters in a statement.
+const maxStatementParams = 65535
+
+// nextIDs allocates n ids from the serial id column of table, so that rows can
+// be inserted together and still be told apart.
+func nextIDs(db DBTX, table string, n int) ([]int, error) {
+	if n == 0 {
+		return nil, nil
+	}
+
+	query := `SELECT nextval(pg_get_serial_sequence($1, 'id')) FROM generate_series(1, $2)`
+
+	rows, err := db.Query(query, table, n)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	ids := make([]int, 0, n)
+	for rows.Next() {
+		var id int
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// insertRows inserts rows with as few multi-row INSERT statements as the
+// parameter limit allows. insert is the statement up to VALUES, and scan, if
+// set, is called for every row the RETURNING clause returns.
+func insertRows(db DBTX, insert string, rows [][]any, returning string, scan func(rows *sql.Rows) error) error {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	chunkSize := maxStatementParams / len(rows[0])
+	for start := 0; start < len(rows); start += chunkSize {
+		chunk := rows[start:min(start+chunkSize, len(rows))]
+
+		var query strings.Builder
+		args := make([]any, 0, len(chunk)*len(chunk[0]))
+
+		query.WriteString(insert)
+		query.WriteString(" VALUES ")
+		for i, row := range chunk {
+			if i > 0 {
+				query.WriteString(", ")
+			}
+
+			query.WriteString("(")
+			for j, value := range row {
+				if j > 0 {
+					query.WriteString(", ")
+				}
+
+				args = append(args, value)
+				fmt.Fprintf(&query, "$%d", len(args))
+			}
+			query.WriteString(")")
+		}
+
+		if returning == "" {
+			_, err := db.Exec(query.String(), args...)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		query.WriteString(" RETURNING ")
+		query.WriteString(returning)
+
+		err := queryRows(db, query.String(), args, scan)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func queryRows(db DBTX, query string, args []any, scan func(rows *sql.Rows) error) error {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	for rows.Next() {
+		err = scan(rows)
+		if err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
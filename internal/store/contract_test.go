@@ -0,0 +1,3064 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"fem-go-crud/internal/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// storesFactory returns a fresh, empty set of stores. Every implementation of
+// the store interfaces must pass the contract tests below.
+type storesFactory func(t *testing.T) *Stores
+
+func runStoreContracts(t *testing.T, newStores storesFactory) {
+	t.Run("UserStore", func(t *testing.T) {
+		testUserStoreContract(t, newStores)
+	})
+	t.Run("TokenStore", func(t *testing.T) {
+		testTokenStoreContract(t, newStores)
+	})
+	t.Run("WorkoutStore", func(t *testing.T) {
+		testWorkoutStoreContract(t, newStores)
+	})
+	t.Run("TxManager", func(t *testing.T) {
+		testTxManagerContract(t, newStores)
+	})
+	t.Run("IdempotencyStore", func(t *testing.T) {
+		testIdempotencyStoreContract(t, newStores)
+	})
+	t.Run("WorkoutRevisionStore", func(t *testing.T) {
+		testWorkoutRevisionStoreContract(t, newStores)
+	})
+	t.Run("ExerciseStore", func(t *testing.T) {
+		testExerciseStoreContract(t, newStores)
+	})
+	t.Run("TemplateStore", func(t *testing.T) {
+		testTemplateStoreContract(t, newStores)
+	})
+	t.Run("ProgramStore", func(t *testing.T) {
+		testProgramStoreContract(t, newStores)
+	})
+	t.Run("EnrollmentStore", func(t *testing.T) {
+		testEnrollmentStoreContract(t, newStores)
+	})
+	t.Run("PersonalRecordStore", func(t *testing.T) {
+		testPersonalRecordStoreContract(t, newStores)
+	})
+	t.Run("StatsStore", func(t *testing.T) {
+		testStatsStoreContract(t, newStores)
+	})
+	t.Run("MeasurementStore", func(t *testing.T) {
+		testMeasurementStoreContract(t, newStores)
+	})
+	t.Run("GoalStore", func(t *testing.T) {
+		testGoalStoreContract(t, newStores)
+	})
+	t.Run("StreakStore", func(t *testing.T) {
+		testStreakStoreContract(t, newStores)
+	})
+	t.Run("ExportStore", func(t *testing.T) {
+		testExportStoreContract(t, newStores)
+	})
+}
+
+func testUserStoreContract(t *testing.T, newStores storesFactory) {
+	t.Run("persist and get by id or username", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+
+		assert.NotZero(t, user.ID)
+		assert.NotEmpty(t, user.CreatedAt)
+
+		byID, err := stores.Users.GetUserByIdOrUsername(user.ID, "")
+		require.NoError(t, err)
+		require.NotNil(t, byID)
+		assert.Equal(t, "alice", byID.Username)
+		assert.Equal(t, "alice@example.com", byID.Email)
+
+		byUsername, err := stores.Users.GetUserByIdOrUsername(0, "alice")
+		require.NoError(t, err)
+		require.NotNil(t, byUsername)
+		assert.Equal(t, user.ID, byUsername.ID)
+
+		matches, err := byUsername.Password.Matches("password123")
+		require.NoError(t, err)
+		assert.True(t, matches)
+	})
+
+	t.Run("get unknown user", func(t *testing.T) {
+		stores := newStores(t)
+
+		user, err := stores.Users.GetUserByIdOrUsername(0, "nobody")
+		require.NoError(t, err)
+		assert.Nil(t, user)
+
+		user, err = stores.Users.GetUserByIdOrUsername(12345, "")
+		require.NoError(t, err)
+		assert.Nil(t, user)
+
+		_, err = stores.Users.GetUserByIdOrUsername(0, "")
+		assert.Error(t, err)
+	})
+
+	t.Run("duplicate username or email", func(t *testing.T) {
+		stores := newStores(t)
+		createTestUser(t, stores, "alice")
+
+		duplicateUsername := &User{Username: "alice", Email: "other@example.com"}
+		require.NoError(t, duplicateUsername.Password.Set("password123"))
+		assert.Error(t, stores.Users.PersistUser(duplicateUsername))
+
+		duplicateEmail := &User{Username: "other", Email: "alice@example.com"}
+		require.NoError(t, duplicateEmail.Password.Set("password123"))
+		assert.Error(t, stores.Users.PersistUser(duplicateEmail))
+	})
+
+	t.Run("update user", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+
+		user.Username = "alicia"
+		user.Email = "alicia@example.com"
+		user.BodyWeightKg = floatPtr(72.5)
+		require.NoError(t, stores.Users.UpdateUser(user))
+
+		updatedUser, err := stores.Users.GetUserByIdOrUsername(user.ID, "")
+		require.NoError(t, err)
+		require.NotNil(t, updatedUser)
+		assert.Equal(t, "alicia", updatedUser.Username)
+		assert.Equal(t, "alicia@example.com", updatedUser.Email)
+		require.NotNil(t, updatedUser.BodyWeightKg)
+		assert.Equal(t, 72.5, *updatedUser.BodyWeightKg)
+
+		user.BodyWeightKg = floatPtr(-1)
+		assert.Error(t, stores.Users.UpdateUser(user), "body weights are positive")
+
+		err = stores.Users.UpdateUser(&User{ID: user.ID + 1000, Username: "ghost", Email: "ghost@example.com"})
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+	})
+
+	t.Run("unit system", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+		assert.Equal(t, UnitSystemMetric, user.UnitSystem, "users read metric units by default")
+		assert.Nil(t, user.LegacyWeightsBefore)
+
+		user.UnitSystem = UnitSystemImperial
+		require.NoError(t, stores.Users.UpdateUser(user))
+
+		updatedUser, err := stores.Users.GetUserByIdOrUsername(user.ID, "")
+		require.NoError(t, err)
+		require.NotNil(t, updatedUser)
+		assert.Equal(t, UnitSystemImperial, updatedUser.UnitSystem)
+
+		user.UnitSystem = "nautical"
+		assert.Error(t, stores.Users.UpdateUser(user), "unit systems are known")
+	})
+
+	t.Run("resolve legacy weights", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+		assert.ErrorIs(t, stores.Users.ResolveLegacyWeights(user.ID, 1), ErrNoLegacyWeights)
+
+		legacyWorkout := newTestWorkout(user.ID)
+		require.NoError(t, stores.Workouts.PersistWorkout(legacyWorkout))
+		legacySnapshot, err := json.Marshal(legacyWorkout)
+		require.NoError(t, err)
+		require.NoError(t, stores.WorkoutRevisions.CreateWorkoutRevision(&WorkoutRevision{
+			WorkoutID: legacyWorkout.ID, UserID: user.ID, ActorID: user.ID, Action: WorkoutRevisionCreate, Snapshot: legacySnapshot,
+		}))
+		rewrittenWorkout := newTestWorkout(user.ID)
+		require.NoError(t, stores.Workouts.PersistWorkout(rewrittenWorkout))
+		legacyTemplate := newTestTemplate(user.ID, "Legs")
+		require.NoError(t, stores.Templates.CreateTemplate(legacyTemplate))
+		markLegacyWeights(t, stores, user.ID)
+
+		workout := newTestWorkout(user.ID)
+		require.NoError(t, stores.Workouts.PersistWorkout(workout))
+
+		// changed since, but for its weights
+		legacyWorkout.Name = "Leg Day, renamed"
+		legacyWorkout.Exercises[0].Notes = "No belt"
+		require.NoError(t, stores.Workouts.UpdateWorkout(legacyWorkout))
+		legacySnapshot, err = json.Marshal(legacyWorkout)
+		require.NoError(t, err)
+		require.NoError(t, stores.WorkoutRevisions.CreateWorkoutRevision(&WorkoutRevision{
+			WorkoutID: legacyWorkout.ID, UserID: user.ID, ActorID: user.ID, Action: WorkoutRevisionUpdate, Snapshot: legacySnapshot,
+		}))
+		rewrittenWorkout.Exercises[0].Weight = floatPtr(80)
+		require.NoError(t, stores.Workouts.UpdateWorkout(rewrittenWorkout))
+
+		markedUser, err := stores.Users.GetUserByIdOrUsername(user.ID, "")
+		require.NoError(t, err)
+		require.NotNil(t, markedUser)
+		assert.NotNil(t, markedUser.LegacyWeightsBefore)
+
+		require.NoError(t, stores.Users.ResolveLegacyWeights(user.ID, 0.45359237))
+
+		convertedWorkout, err := stores.Workouts.GetWorkout(legacyWorkout.ID)
+		require.NoError(t, err)
+		assert.Equal(t, floatPtr(45.586), convertedWorkout.Exercises[1].Weight, "the weights left as they were are converted")
+		assert.Equal(t, legacyWorkout.Version+1, convertedWorkout.Version)
+
+		keptWorkout, err := stores.Workouts.GetWorkout(workout.ID)
+		require.NoError(t, err)
+		assert.Equal(t, floatPtr(100.5), keptWorkout.Exercises[1].Weight, "workouts recorded since are in kilograms")
+		assert.Equal(t, workout.Version, keptWorkout.Version)
+
+		keptWorkout, err = stores.Workouts.GetWorkout(rewrittenWorkout.ID)
+		require.NoError(t, err)
+		assert.Equal(t, floatPtr(80.0), keptWorkout.Exercises[1].Weight, "weights rewritten since are in kilograms")
+		assert.Equal(t, rewrittenWorkout.Version, keptWorkout.Version)
+
+		for _, number := range []int{1, 2} {
+			revision, err := stores.WorkoutRevisions.GetWorkoutRevision(legacyWorkout.ID, number)
+			require.NoError(t, err)
+			require.NotNil(t, revision)
+			var snapshot Workout
+			require.NoError(t, json.Unmarshal(revision.Snapshot, &snapshot))
+			squat := slices.IndexFunc(snapshot.Exercises, func(exercise WorkoutExercise) bool { return exercise.Name == "Squat" })
+			require.NotEqual(t, -1, squat)
+			assert.Equal(t, floatPtr(45.586), snapshot.Exercises[squat].Weight, "the snapshots are converted too")
+		}
+
+		convertedTemplate, err := stores.Templates.GetTemplate(legacyTemplate.ID)
+		require.NoError(t, err)
+		assert.Equal(t, floatPtr(45.586), convertedTemplate.Exercises[1].Weight)
+
+		history, err := stores.PersonalRecords.ListPersonalRecords(user.ID, true)
+		require.NoError(t, err)
+		values := map[string]float64{}
+		for _, record := range history {
+			if record.WorkoutID == legacyWorkout.ID {
+				values[record.RecordType] = record.Value
+			}
+		}
+		assert.Equal(t, map[string]float64{
+			RecordMaxDuration:  60,
+			RecordMaxWeight:    45.59,
+			RecordMaxReps:      5,
+			RecordEstimated1RM: 53.18,
+			RecordMaxVolume:    1139.65,
+		}, values)
+
+		resolvedUser, err := stores.Users.GetUserByIdOrUsername(user.ID, "")
+		require.NoError(t, err)
+		require.NotNil(t, resolvedUser)
+		assert.Nil(t, resolvedUser.LegacyWeightsBefore)
+		assert.ErrorIs(t, stores.Users.ResolveLegacyWeights(user.ID, 0.45359237), ErrNoLegacyWeights)
+	})
+
+	t.Run("update password", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+
+		require.NoError(t, user.Password.Set("new-password456"))
+		require.NoError(t, stores.Users.UpdatePassword(user))
+
+		updatedUser, err := stores.Users.GetUserByIdOrUsername(user.ID, "")
+		require.NoError(t, err)
+		require.NotNil(t, updatedUser)
+
+		matches, err := updatedUser.Password.Matches("new-password456")
+		require.NoError(t, err)
+		assert.True(t, matches)
+
+		assert.ErrorIs(t, stores.Users.UpdatePassword(&User{ID: user.ID + 1000}), sql.ErrNoRows)
+	})
+
+	t.Run("delete user cascades", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+		token := createTestToken(t, stores, user.ID)
+		workout := newTestWorkout(user.ID)
+		require.NoError(t, stores.Workouts.PersistWorkout(workout))
+
+		require.NoError(t, stores.Users.DeleteUser(user.ID))
+
+		deletedUser, err := stores.Users.GetUserByIdOrUsername(user.ID, "")
+		require.NoError(t, err)
+		assert.Nil(t, deletedUser)
+
+		tokenUser, err := stores.Users.GetUserFromToken(token.Plain, auth.TokenScopeAuth)
+		require.NoError(t, err)
+		assert.Nil(t, tokenUser)
+
+		deletedWorkout, err := stores.Workouts.GetWorkout(workout.ID)
+		require.NoError(t, err)
+		assert.Nil(t, deletedWorkout)
+
+		assert.ErrorIs(t, stores.Users.DeleteUser(user.ID), sql.ErrNoRows)
+	})
+
+	t.Run("get user from token", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+
+		token, err := auth.MakeToken(user.ID, time.Hour, auth.TokenScopeAuth)
+		require.NoError(t, err)
+		require.NoError(t, stores.Tokens.PersistToken(token))
+
+		tokenUser, err := stores.Users.GetUserFromToken(token.Plain, auth.TokenScopeAuth)
+		require.NoError(t, err)
+		require.NotNil(t, tokenUser)
+		assert.Equal(t, user.ID, tokenUser.ID)
+
+		tokenUser, err = stores.Users.GetUserFromToken(token.Plain, "other-scope")
+		require.NoError(t, err)
+		assert.Nil(t, tokenUser)
+
+		tokenUser, err = stores.Users.GetUserFromToken("not-a-token", auth.TokenScopeAuth)
+		require.NoError(t, err)
+		assert.Nil(t, tokenUser)
+	})
+
+	t.Run("get user from expired token", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+
+		token, err := auth.MakeToken(user.ID, -time.Hour, auth.TokenScopeAuth)
+		require.NoError(t, err)
+		require.NoError(t, stores.Tokens.PersistToken(token))
+
+		tokenUser, err := stores.Users.GetUserFromToken(token.Plain, auth.TokenScopeAuth)
+		require.NoError(t, err)
+		assert.Nil(t, tokenUser)
+	})
+}
+
+func testTokenStoreContract(t *testing.T, newStores storesFactory) {
+	t.Run("persist token for unknown user", func(t *testing.T) {
+		stores := newStores(t)
+
+		token, err := auth.MakeToken(12345, time.Hour, auth.TokenScopeAuth)
+		require.NoError(t, err)
+		assert.Error(t, stores.Tokens.PersistToken(token))
+	})
+
+	t.Run("revoke tokens for user", func(t *testing.T) {
+		stores := newStores(t)
+		alice := createTestUser(t, stores, "alice")
+		bob := createTestUser(t, stores, "bob")
+
+		aliceToken := createTestToken(t, stores, alice.ID)
+		bobToken := createTestToken(t, stores, bob.ID)
+
+		require.NoError(t, stores.Tokens.RevokeTokensForUser(alice.ID, auth.TokenScopeAuth))
+
+		tokenUser, err := stores.Users.GetUserFromToken(aliceToken.Plain, auth.TokenScopeAuth)
+		require.NoError(t, err)
+		assert.Nil(t, tokenUser)
+
+		tokenUser, err = stores.Users.GetUserFromToken(bobToken.Plain, auth.TokenScopeAuth)
+		require.NoError(t, err)
+		assert.NotNil(t, tokenUser)
+	})
+}
+
+func testWorkoutStoreContract(t *testing.T, newStores storesFactory) {
+	t.Run("persist and get", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+
+		workout := newTestWorkout(user.ID)
+		require.NoError(t, stores.Workouts.PersistWorkout(workout))
+		assert.NotZero(t, workout.ID)
+		for _, exercise := range workout.Exercises {
+			assert.NotZero(t, exercise.ID)
+		}
+
+		retrievedWorkout, err := stores.Workouts.GetWorkout(workout.ID)
+		require.NoError(t, err)
+		require.NotNil(t, retrievedWorkout)
+
+		assert.Equal(t, workout.ID, retrievedWorkout.ID)
+		assert.Equal(t, user.ID, retrievedWorkout.UserID)
+		assert.Equal(t, workout.Name, retrievedWorkout.Name)
+		assert.Equal(t, workout.Description, retrievedWorkout.Description)
+		assert.Equal(t, workout.DurationMinutes, retrievedWorkout.DurationMinutes)
+		assert.Equal(t, workout.CaloriesBurned, retrievedWorkout.CaloriesBurned)
+		require.Len(t, retrievedWorkout.Exercises, 2)
+		// exercises come back sorted by order_index
+		assert.Equal(t, "Plank", retrievedWorkout.Exercises[0].Name)
+		assert.Equal(t, intPtr(60), retrievedWorkout.Exercises[0].DurationSeconds)
+		assert.Nil(t, retrievedWorkout.Exercises[0].Reps)
+		assert.Equal(t, "Squat", retrievedWorkout.Exercises[1].Name)
+		assert.Equal(t, intPtr(5), retrievedWorkout.Exercises[1].Reps)
+		assert.Equal(t, floatPtr(100.5), retrievedWorkout.Exercises[1].Weight)
+	})
+
+	t.Run("persist several", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+
+		workouts := []*Workout{newTestWorkout(user.ID), newTestWorkout(user.ID), {UserID: user.ID, Name: "Rest", DurationMinutes: 10}}
+		workouts[1].Name = "Arm Day"
+		require.NoError(t, stores.Workouts.PersistWorkouts(workouts))
+
+		seenExerciseIDs := map[int]bool{}
+		for _, workout := range workouts {
+			assert.NotZero(t, workout.ID)
+			assert.Equal(t, 1, workout.Version)
+			for _, exercise := range workout.Exercises {
+				assert.NotZero(t, exercise.ID)
+				assert.False(t, seenExerciseIDs[exercise.ID])
+				assert.False(t, exercise.CreatedAt.IsZero())
+				seenExerciseIDs[exercise.ID] = true
+			}
+
+			retrieved, err := stores.Workouts.GetWorkout(workout.ID)
+			require.NoError(t, err)
+			require.NotNil(t, retrieved)
+			assert.Equal(t, workout.Name, retrieved.Name)
+			assert.Len(t, retrieved.Exercises, len(workout.Exercises))
+		}
+		assert.Len(t, seenExerciseIDs, 4)
+		assert.Equal(t, "Arm Day", workouts[1].Name)
+
+		require.NoError(t, stores.Workouts.PersistWorkouts(nil))
+	})
+
+	t.Run("persist several is all or nothing", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+
+		invalidWorkout := newTestWorkout(user.ID)
+		invalidWorkout.Exercises[0].DurationSeconds = intPtr(30)
+		assert.Error(t, stores.Workouts.PersistWorkouts([]*Workout{newTestWorkout(user.ID), invalidWorkout}))
+
+		workout := newTestWorkout(user.ID)
+		require.NoError(t, stores.Workouts.PersistWorkout(workout))
+		for id := 1; id < workout.ID; id++ {
+			retrieved, err := stores.Workouts.GetWorkout(id)
+			require.NoError(t, err)
+			assert.Nil(t, retrieved)
+		}
+	})
+
+	t.Run("persist invalid exercise", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+
+		workout := newTestWorkout(user.ID)
+		workout.Exercises[0].DurationSeconds = intPtr(30)
+		assert.Error(t, stores.Workouts.PersistWorkout(workout))
+
+		workout = newTestWorkout(user.ID)
+		workout.Exercises[0].Reps = nil
+		assert.Error(t, stores.Workouts.PersistWorkout(workout))
+	})
+
+	t.Run("persist for unknown user", func(t *testing.T) {
+		stores := newStores(t)
+
+		assert.Error(t, stores.Workouts.PersistWorkout(newTestWorkout(12345)))
+	})
+
+	t.Run("get unknown workout", func(t *testing.T) {
+		stores := newStores(t)
+
+		workout, err := stores.Workouts.GetWorkout(12345)
+		require.NoError(t, err)
+		assert.Nil(t, workout)
+	})
+
+	t.Run("update", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+
+		workout := newTestWorkout(user.ID)
+		require.NoError(t, stores.Workouts.PersistWorkout(workout))
+
+		workout.Name = "Updated"
+		workout.DurationMinutes = 90
+		workout.CaloriesEstimated = true
+		workout.Exercises = []WorkoutExercise{
+			{Name: "Deadlift", Sets: 1, Reps: intPtr(1), Weight: floatPtr(200), OrderIndex: 1},
+		}
+		require.NoError(t, stores.Workouts.UpdateWorkout(workout))
+
+		updatedWorkout, err := stores.Workouts.GetWorkout(workout.ID)
+		require.NoError(t, err)
+		require.NotNil(t, updatedWorkout)
+		assert.Equal(t, "Updated", updatedWorkout.Name)
+		assert.Equal(t, 90, updatedWorkout.DurationMinutes)
+		assert.True(t, updatedWorkout.CaloriesEstimated)
+		assert.Equal(t, user.ID, updatedWorkout.UserID)
+		require.Len(t, updatedWorkout.Exercises, 1)
+		assert.Equal(t, "Deadlift", updatedWorkout.Exercises[0].Name)
+		assert.Equal(t, workout.Exercises[0].ID, updatedWorkout.Exercises[0].ID)
+	})
+
+	t.Run("started and ended at", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+
+		now := newTestWorkout(user.ID)
+		require.NoError(t, stores.Workouts.PersistWorkout(now))
+		assert.False(t, now.StartedAt.IsZero(), "a workout without a start starts when persisted")
+		assert.Nil(t, now.EndedAt)
+
+		startedAt := time.Date(2024, time.March, 4, 6, 30, 0, 0, time.UTC)
+		endedAt := startedAt.Add(75 * time.Minute)
+		backdated := newTestWorkout(user.ID)
+		backdated.StartedAt = startedAt
+		backdated.EndedAt = &endedAt
+		require.NoError(t, stores.Workouts.PersistWorkout(backdated))
+
+		storedWorkout, err := stores.Workouts.GetWorkout(backdated.ID)
+		require.NoError(t, err)
+		assert.True(t, startedAt.Equal(storedWorkout.StartedAt))
+		require.NotNil(t, storedWorkout.EndedAt)
+		assert.True(t, endedAt.Equal(*storedWorkout.EndedAt))
+		assert.True(t, storedWorkout.CreatedAt.After(startedAt))
+
+		storedWorkout.StartedAt = startedAt.AddDate(0, 0, 1)
+		assert.Error(t, stores.Workouts.UpdateWorkout(storedWorkout), "workouts do not end before they start")
+
+		storedWorkout.EndedAt = nil
+		require.NoError(t, stores.Workouts.UpdateWorkout(storedWorkout))
+		storedWorkout, err = stores.Workouts.GetWorkout(backdated.ID)
+		require.NoError(t, err)
+		assert.True(t, startedAt.AddDate(0, 0, 1).Equal(storedWorkout.StartedAt))
+		assert.Nil(t, storedWorkout.EndedAt)
+	})
+
+	t.Run("list workouts started in a window", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+		other := createTestUser(t, stores, "bob")
+
+		from := time.Date(2024, time.March, 4, 0, 0, 0, 0, time.UTC)
+		var ids []int
+		for _, startedAt := range []time.Time{from.Add(-time.Second), from.Add(2 * time.Hour), from, from.AddDate(0, 0, 7)} {
+			workout := newTestWorkout(user.ID)
+			workout.StartedAt = startedAt
+			require.NoError(t, stores.Workouts.PersistWorkout(workout))
+			ids = append(ids, workout.ID)
+		}
+		othersWorkout := newTestWorkout(other.ID)
+		othersWorkout.StartedAt = from
+		require.NoError(t, stores.Workouts.PersistWorkout(othersWorkout))
+
+		workouts, err := stores.Workouts.ListWorkoutsStarted(user.ID, from, from.AddDate(0, 0, 7))
+		require.NoError(t, err)
+		require.Len(t, workouts, 2)
+		assert.Equal(t, ids[2], workouts[0].ID, "earliest first")
+		assert.Equal(t, ids[1], workouts[1].ID)
+		assert.Len(t, workouts[0].Exercises, 2)
+
+		require.NoError(t, stores.Workouts.DeleteWorkout(ids[1], 0))
+		workouts, err = stores.Workouts.ListWorkoutsStarted(user.ID, from, from.AddDate(0, 0, 7))
+		require.NoError(t, err)
+		require.Len(t, workouts, 1)
+		assert.Equal(t, ids[2], workouts[0].ID)
+
+		workouts, err = stores.Workouts.ListWorkoutsStarted(user.ID, from.AddDate(1, 0, 0), from.AddDate(2, 0, 0))
+		require.NoError(t, err)
+		assert.Empty(t, workouts)
+	})
+
+	t.Run("list workouts after an id and count them", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+		other := createTestUser(t, stores, "bob")
+
+		var ids []int
+		for range 5 {
+			workout := newTestWorkout(user.ID)
+			require.NoError(t, stores.Workouts.PersistWorkout(workout))
+			ids = append(ids, workout.ID)
+		}
+		require.NoError(t, stores.Workouts.PersistWorkout(newTestWorkout(other.ID)))
+		require.NoError(t, stores.Workouts.DeleteWorkout(ids[3], 0))
+
+		count, err := stores.Workouts.CountWorkouts(user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 4, count, "trashed workouts are left out")
+
+		page, err := stores.Workouts.ListWorkoutsAfter(user.ID, 0, 2, false)
+		require.NoError(t, err)
+		require.Len(t, page, 2)
+		assert.Equal(t, ids[0], page[0].ID)
+		assert.Equal(t, ids[1], page[1].ID)
+		assert.Len(t, page[0].Exercises, 2)
+
+		page, err = stores.Workouts.ListWorkoutsAfter(user.ID, page[1].ID, 2, false)
+		require.NoError(t, err)
+		require.Len(t, page, 2)
+		assert.Equal(t, ids[2], page[0].ID)
+		assert.Equal(t, ids[4], page[1].ID)
+
+		page, err = stores.Workouts.ListWorkoutsAfter(user.ID, page[1].ID, 2, false)
+		require.NoError(t, err)
+		assert.Empty(t, page)
+
+		page, err = stores.Workouts.ListWorkoutsAfter(user.ID, 0, 2, true)
+		require.NoError(t, err)
+		require.Len(t, page, 1)
+		assert.Equal(t, ids[3], page[0].ID)
+		assert.Len(t, page[0].Exercises, 2)
+	})
+
+	t.Run("update preserves exercises", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+
+		workout := newTestWorkout(user.ID)
+		require.NoError(t, stores.Workouts.PersistWorkout(workout))
+		original, err := stores.Workouts.GetWorkout(workout.ID)
+		require.NoError(t, err)
+		require.Len(t, original.Exercises, 2)
+		plank, squat := original.Exercises[0], original.Exercises[1]
+
+		updated := *original
+		updated.Exercises = []WorkoutExercise{plank, squat, {Name: "Lunge", Sets: 3, Reps: intPtr(12), OrderIndex: 3}}
+		updated.Exercises[1].Weight = floatPtr(110)
+		require.NoError(t, stores.Workouts.UpdateWorkout(&updated))
+
+		retrieved, err := stores.Workouts.GetWorkout(workout.ID)
+		require.NoError(t, err)
+		require.Len(t, retrieved.Exercises, 3)
+
+		assert.Equal(t, plank.ID, retrieved.Exercises[0].ID)
+		assert.True(t, plank.UpdatedAt.Equal(retrieved.Exercises[0].UpdatedAt), "unchanged exercise keeps its updated_at")
+		assert.Equal(t, squat.ID, retrieved.Exercises[1].ID)
+		assert.True(t, squat.CreatedAt.Equal(retrieved.Exercises[1].CreatedAt))
+		assert.Equal(t, floatPtr(110), retrieved.Exercises[1].Weight)
+		assert.NotZero(t, retrieved.Exercises[2].ID)
+		assert.Equal(t, "Lunge", retrieved.Exercises[2].Name)
+
+		// exercises left out are deleted
+		updated = *retrieved
+		updated.Exercises = []WorkoutExercise{retrieved.Exercises[2]}
+		require.NoError(t, stores.Workouts.UpdateWorkout(&updated))
+
+		retrieved, err = stores.Workouts.GetWorkout(workout.ID)
+		require.NoError(t, err)
+		require.Len(t, retrieved.Exercises, 1)
+		assert.Equal(t, "Lunge", retrieved.Exercises[0].Name)
+	})
+
+	t.Run("exercise operations", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+
+		workout := newTestWorkout(user.ID)
+		require.NoError(t, stores.Workouts.PersistWorkout(workout))
+		original, err := stores.Workouts.GetWorkout(workout.ID)
+		require.NoError(t, err)
+		plank, squat := original.Exercises[0], original.Exercises[1]
+
+		exerciseOrder := func() []string {
+			retrieved, err := stores.Workouts.GetWorkout(workout.ID)
+			require.NoError(t, err)
+
+			var names []string
+			for i, exercise := range retrieved.Exercises {
+				assert.Equal(t, i+1, exercise.OrderIndex)
+				names = append(names, exercise.Name)
+			}
+			return names
+		}
+
+		lunge := &WorkoutExercise{Name: "Lunge", Sets: 3, Reps: intPtr(12)}
+		require.NoError(t, stores.Workouts.AddWorkoutExercise(workout.ID, lunge))
+		assert.NotZero(t, lunge.ID)
+		assert.Equal(t, 3, lunge.OrderIndex)
+		assert.False(t, lunge.CreatedAt.IsZero())
+		assert.Equal(t, []string{"Plank", "Squat", "Lunge"}, exerciseOrder())
+
+		warmup := &WorkoutExercise{Name: "Jumping Jacks", Sets: 1, DurationSeconds: intPtr(120), OrderIndex: 1}
+		require.NoError(t, stores.Workouts.AddWorkoutExercise(workout.ID, warmup))
+		assert.Equal(t, 1, warmup.OrderIndex)
+		assert.Equal(t, []string{"Jumping Jacks", "Plank", "Squat", "Lunge"}, exerciseOrder())
+
+		squat.Notes = "No belt"
+		squat.OrderIndex = 0
+		require.NoError(t, stores.Workouts.UpdateWorkoutExercise(workout.ID, &squat))
+		assert.Equal(t, 3, squat.OrderIndex)
+		assert.Equal(t, "No belt", squat.Notes)
+		assert.True(t, original.Exercises[1].CreatedAt.Equal(squat.CreatedAt))
+
+		squat.OrderIndex = 99
+		require.NoError(t, stores.Workouts.UpdateWorkoutExercise(workout.ID, &squat))
+		assert.Equal(t, 4, squat.OrderIndex)
+		assert.Equal(t, []string{"Jumping Jacks", "Plank", "Lunge", "Squat"}, exerciseOrder())
+
+		require.NoError(t, stores.Workouts.DeleteWorkoutExercise(workout.ID, plank.ID))
+		assert.Equal(t, []string{"Jumping Jacks", "Lunge", "Squat"}, exerciseOrder())
+
+		exercises, err := stores.Workouts.ReorderWorkoutExercises(workout.ID, []int{squat.ID, lunge.ID, warmup.ID})
+		require.NoError(t, err)
+		require.Len(t, exercises, 3)
+		assert.Equal(t, squat.ID, exercises[0].ID)
+		assert.Equal(t, []string{"Squat", "Lunge", "Jumping Jacks"}, exerciseOrder())
+
+		_, err = stores.Workouts.ReorderWorkoutExercises(workout.ID, []int{squat.ID, lunge.ID})
+		assert.ErrorIs(t, err, ErrInvalidExerciseOrder)
+		_, err = stores.Workouts.ReorderWorkoutExercises(workout.ID, []int{squat.ID, squat.ID, lunge.ID})
+		assert.ErrorIs(t, err, ErrInvalidExerciseOrder)
+
+		retrieved, err := stores.Workouts.GetWorkout(workout.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 7, retrieved.Version, "every exercise change bumps the workout version")
+	})
+
+	t.Run("exercise operations on unknown rows", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+
+		workout := newTestWorkout(user.ID)
+		require.NoError(t, stores.Workouts.PersistWorkout(workout))
+		otherWorkout := newTestWorkout(user.ID)
+		require.NoError(t, stores.Workouts.PersistWorkout(otherWorkout))
+
+		exercise := &WorkoutExercise{Name: "Lunge", Sets: 3, Reps: intPtr(12)}
+		assert.ErrorIs(t, stores.Workouts.AddWorkoutExercise(12345, exercise), sql.ErrNoRows)
+
+		// an exercise of another workout is unknown to this one
+		foreignExercise := otherWorkout.Exercises[0]
+		assert.ErrorIs(t, stores.Workouts.UpdateWorkoutExercise(workout.ID, &foreignExercise), sql.ErrNoRows)
+		assert.ErrorIs(t, stores.Workouts.DeleteWorkoutExercise(workout.ID, foreignExercise.ID), sql.ErrNoRows)
+
+		invalidExercise := &WorkoutExercise{Name: "Lunge", Sets: 3, Reps: intPtr(12), DurationSeconds: intPtr(30)}
+		assert.Error(t, stores.Workouts.AddWorkoutExercise(workout.ID, invalidExercise))
+	})
+
+	t.Run("update unknown workout", func(t *testing.T) {
+		stores := newStores(t)
+
+		workout := newTestWorkout(0)
+		workout.ID = 12345
+		assert.ErrorIs(t, stores.Workouts.UpdateWorkout(workout), sql.ErrNoRows)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+
+		workout := newTestWorkout(user.ID)
+		require.NoError(t, stores.Workouts.PersistWorkout(workout))
+
+		require.NoError(t, stores.Workouts.DeleteWorkout(workout.ID, 0))
+
+		deletedWorkout, err := stores.Workouts.GetWorkout(workout.ID)
+		require.NoError(t, err)
+		assert.Nil(t, deletedWorkout)
+
+		assert.ErrorIs(t, stores.Workouts.DeleteWorkout(workout.ID, 0), sql.ErrNoRows)
+	})
+
+	t.Run("trash", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+		otherUser := createTestUser(t, stores, "bob")
+
+		workout := newTestWorkout(user.ID)
+		require.NoError(t, stores.Workouts.PersistWorkout(workout))
+		otherWorkout := newTestWorkout(user.ID)
+		require.NoError(t, stores.Workouts.PersistWorkout(otherWorkout))
+		require.NoError(t, stores.Workouts.PersistWorkout(newTestWorkout(otherUser.ID)))
+
+		trash, err := stores.Workouts.ListTrashedWorkouts(user.ID)
+		require.NoError(t, err)
+		assert.Empty(t, trash)
+
+		require.NoError(t, stores.Workouts.DeleteWorkout(workout.ID, 1))
+		require.NoError(t, stores.Workouts.DeleteWorkout(otherWorkout.ID, 0))
+
+		// trashed workouts are out of reach of the other methods
+		_, err = stores.Workouts.GetWorkoutOwner(workout.ID)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+		workout.Version = 2
+		assert.ErrorIs(t, stores.Workouts.UpdateWorkout(workout), sql.ErrNoRows)
+		assert.ErrorIs(t, stores.Workouts.AddWorkoutExercise(workout.ID, &WorkoutExercise{Name: "Lunge", Sets: 3, Reps: intPtr(12)}), sql.ErrNoRows)
+
+		trash, err = stores.Workouts.ListTrashedWorkouts(user.ID)
+		require.NoError(t, err)
+		require.Len(t, trash, 2)
+		assert.Equal(t, []int{otherWorkout.ID, workout.ID}, []int{trash[0].ID, trash[1].ID})
+		assert.NotNil(t, trash[0].DeletedAt)
+		assert.Empty(t, trash[0].Exercises)
+
+		trashedWorkout, err := stores.Workouts.GetTrashedWorkout(workout.ID)
+		require.NoError(t, err)
+		require.NotNil(t, trashedWorkout)
+		assert.Equal(t, 2, trashedWorkout.Version, "deleting bumps the version")
+		assert.Len(t, trashedWorkout.Exercises, 2)
+
+		require.NoError(t, stores.Workouts.RestoreWorkout(workout.ID))
+		assert.ErrorIs(t, stores.Workouts.RestoreWorkout(workout.ID), sql.ErrNoRows)
+
+		restoredWorkout, err := stores.Workouts.GetWorkout(workout.ID)
+		require.NoError(t, err)
+		require.NotNil(t, restoredWorkout)
+		assert.Nil(t, restoredWorkout.DeletedAt)
+		assert.Equal(t, 3, restoredWorkout.Version)
+		assert.Len(t, restoredWorkout.Exercises, 2)
+
+		trashedWorkout, err = stores.Workouts.GetTrashedWorkout(workout.ID)
+		require.NoError(t, err)
+		assert.Nil(t, trashedWorkout)
+
+		assert.ErrorIs(t, stores.Workouts.PurgeWorkout(workout.ID), sql.ErrNoRows, "only trashed workouts can be purged")
+		require.NoError(t, stores.Workouts.PurgeWorkout(otherWorkout.ID))
+		assert.ErrorIs(t, stores.Workouts.RestoreWorkout(otherWorkout.ID), sql.ErrNoRows)
+
+		trash, err = stores.Workouts.ListTrashedWorkouts(user.ID)
+		require.NoError(t, err)
+		assert.Empty(t, trash)
+	})
+
+	t.Run("purge trashed workouts", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+
+		workout := newTestWorkout(user.ID)
+		require.NoError(t, stores.Workouts.PersistWorkout(workout))
+		activeWorkout := newTestWorkout(user.ID)
+		require.NoError(t, stores.Workouts.PersistWorkout(activeWorkout))
+		require.NoError(t, stores.Workouts.DeleteWorkout(workout.ID, 0))
+		for _, workoutID := range []int{workout.ID, activeWorkout.ID} {
+			revision := &WorkoutRevision{WorkoutID: workoutID, UserID: user.ID, ActorID: user.ID, Action: WorkoutRevisionCreate, Snapshot: json.RawMessage(`{"name":"Leg Day"}`)}
+			require.NoError(t, stores.WorkoutRevisions.CreateWorkoutRevision(revision))
+		}
+
+		purged, err := stores.Workouts.PurgeTrashedWorkouts(time.Now().Add(-time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, 0, purged)
+
+		purged, err = stores.Workouts.PurgeTrashedWorkouts(time.Now().Add(time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, 1, purged)
+
+		revisions, err := stores.WorkoutRevisions.ListWorkoutRevisions(workout.ID)
+		require.NoError(t, err)
+		assert.Empty(t, revisions, "the revisions go with the workout")
+		revisions, err = stores.WorkoutRevisions.ListWorkoutRevisions(activeWorkout.ID)
+		require.NoError(t, err)
+		assert.Len(t, revisions, 1)
+
+		trashedWorkout, err := stores.Workouts.GetTrashedWorkout(workout.ID)
+		require.NoError(t, err)
+		assert.Nil(t, trashedWorkout)
+
+		retrievedWorkout, err := stores.Workouts.GetWorkout(activeWorkout.ID)
+		require.NoError(t, err)
+		assert.NotNil(t, retrievedWorkout)
+	})
+
+	t.Run("versioning", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+
+		workout := newTestWorkout(user.ID)
+		require.NoError(t, stores.Workouts.PersistWorkout(workout))
+		assert.Equal(t, 1, workout.Version)
+
+		staleWorkout, err := stores.Workouts.GetWorkout(workout.ID)
+		require.NoError(t, err)
+		require.NotNil(t, staleWorkout)
+
+		workout.Name = "First edit"
+		require.NoError(t, stores.Workouts.UpdateWorkout(workout))
+		assert.Equal(t, 2, workout.Version)
+
+		staleWorkout.Name = "Concurrent edit"
+		assert.ErrorIs(t, stores.Workouts.UpdateWorkout(staleWorkout), ErrVersionConflict)
+
+		storedWorkout, err := stores.Workouts.GetWorkout(workout.ID)
+		require.NoError(t, err)
+		require.NotNil(t, storedWorkout)
+		assert.Equal(t, "First edit", storedWorkout.Name)
+		assert.Equal(t, 2, storedWorkout.Version)
+
+		assert.ErrorIs(t, stores.Workouts.DeleteWorkout(workout.ID, 1), ErrVersionConflict)
+		require.NoError(t, stores.Workouts.DeleteWorkout(workout.ID, 2))
+		assert.ErrorIs(t, stores.Workouts.DeleteWorkout(workout.ID, 2), sql.ErrNoRows)
+	})
+
+	t.Run("get workout owner", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+
+		workout := newTestWorkout(user.ID)
+		require.NoError(t, stores.Workouts.PersistWorkout(workout))
+
+		owner, err := stores.Workouts.GetWorkoutOwner(workout.ID)
+		require.NoError(t, err)
+		assert.Equal(t, user.ID, owner)
+
+		_, err = stores.Workouts.GetWorkoutOwner(12345)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+	})
+
+	t.Run("search", func(t *testing.T) {
+		stores := newStores(t)
+		alice := createTestUser(t, stores, "alice")
+		bob := createTestUser(t, stores, "bob")
+
+		legDay := newTestWorkout(alice.ID)
+		legDay.Exercises[0].Name = "Bulgarian Split Squat"
+		legDay.Exercises[0].Notes = "Slow eccentric"
+		pushDay := newTestWorkout(alice.ID)
+		pushDay.Name = "Push Day"
+		pushDay.Description = "Chest & <b>shoulders</b>"
+		pushDay.Exercises[0].Name = "Bench Press"
+		pushDay.Exercises[0].Notes = "Try bulgarian bags next time"
+		bobsWorkout := newTestWorkout(bob.ID)
+		bobsWorkout.Exercises[0].Name = "Bulgarian Split Squat"
+		require.NoError(t, stores.Workouts.PersistWorkouts([]*Workout{legDay, pushDay, bobsWorkout}))
+
+		searchIDs := func(query string, limit, offset int) []int {
+			results, err := stores.Workouts.SearchWorkouts(alice.ID, query, limit, offset)
+			require.NoError(t, err)
+
+			ids := []int{}
+			for _, result := range results {
+				assert.Positive(t, result.Rank)
+				assert.Nil(t, result.Workout.Exercises)
+				ids = append(ids, result.Workout.ID)
+			}
+			return ids
+		}
+
+		// an exercise name outranks exercise notes
+		assert.Equal(t, []int{legDay.ID, pushDay.ID}, searchIDs("bulgarian", 10, 0))
+		assert.Equal(t, []int{pushDay.ID}, searchIDs("bulgarian", 10, 1))
+		assert.Equal(t, []int{legDay.ID}, searchIDs("bulgarian", 1, 0))
+		assert.Equal(t, []int{legDay.ID}, searchIDs("leg day with the bulg split", 10, 0))
+		assert.Equal(t, []int{pushDay.ID}, searchIDs("SHOULDER", 10, 0))
+		assert.Empty(t, searchIDs("the", 10, 0))
+		assert.Empty(t, searchIDs("&|!:*", 10, 0))
+		assert.Empty(t, searchIDs("deadlift", 10, 0))
+
+		results, err := stores.Workouts.SearchWorkouts(alice.ID, "split squat", 10, 0)
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		assert.Equal(t, legDay.Name, results[0].Workout.Name)
+		assert.Contains(t, results[0].Snippet, SearchMatchStart+"Split"+SearchMatchEnd)
+
+		results, err = stores.Workouts.SearchWorkouts(alice.ID, "shoulders", 10, 0)
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		assert.Contains(t, results[0].Snippet, "&amp; &lt;b&gt;"+SearchMatchStart+"shoulders"+SearchMatchEnd+"&lt;/b&gt;", "the text around the marks is escaped")
+
+		deadlift := &WorkoutExercise{Name: "Deadlift", Sets: 3, Reps: intPtr(5)}
+		require.NoError(t, stores.Workouts.AddWorkoutExercise(pushDay.ID, deadlift))
+		assert.Equal(t, []int{pushDay.ID}, searchIDs("deadlift", 10, 0))
+
+		deadlift.Name = "Romanian Deadlift"
+		require.NoError(t, stores.Workouts.UpdateWorkoutExercise(pushDay.ID, deadlift))
+		assert.Equal(t, []int{pushDay.ID}, searchIDs("romanian", 10, 0))
+
+		require.NoError(t, stores.Workouts.DeleteWorkoutExercise(pushDay.ID, deadlift.ID))
+		assert.Empty(t, searchIDs("romanian", 10, 0))
+
+		legDay.Name = "Lower Body"
+		require.NoError(t, stores.Workouts.UpdateWorkout(legDay))
+		assert.Equal(t, []int{legDay.ID}, searchIDs("lower", 10, 0))
+
+		require.NoError(t, stores.Workouts.DeleteWorkout(legDay.ID, 0))
+		assert.Equal(t, []int{pushDay.ID}, searchIDs("bulgarian", 10, 0))
+	})
+
+	t.Run("sets", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+
+		workout := newTestWorkout(user.ID)
+		workout.Exercises[0].WorkoutSets = []WorkoutSet{
+			{SetType: WorkoutSetWarmup, Reps: intPtr(8), Weight: floatPtr(60), Completed: true},
+			{SetType: WorkoutSetWorking, Reps: intPtr(5), Weight: floatPtr(100.5), RPE: floatPtr(8.5), RestSeconds: intPtr(180), Completed: true},
+		}
+		require.NoError(t, stores.Workouts.PersistWorkout(workout))
+		assert.Equal(t, 2, workout.Exercises[0].WorkoutSets[1].SetNumber)
+
+		fetched, err := stores.Workouts.GetWorkout(workout.ID)
+		require.NoError(t, err)
+		assert.Empty(t, fetched.Exercises[0].WorkoutSets, "the plank has no sets")
+		squat := fetched.Exercises[1]
+		require.Len(t, squat.WorkoutSets, 2)
+		assert.Equal(t, WorkoutSet{
+			SetNumber:   2,
+			SetType:     WorkoutSetWorking,
+			Reps:        intPtr(5),
+			Weight:      floatPtr(100.5),
+			RPE:         floatPtr(8.5),
+			RestSeconds: intPtr(180),
+			Completed:   true,
+		}, squat.WorkoutSets[1])
+
+		fetched.Exercises[1].WorkoutSets = []WorkoutSet{{SetType: WorkoutSetFailure, Reps: intPtr(3), Weight: floatPtr(110)}}
+		require.NoError(t, stores.Workouts.UpdateWorkout(fetched))
+		fetched, err = stores.Workouts.GetWorkout(workout.ID)
+		require.NoError(t, err)
+		require.Len(t, fetched.Exercises[1].WorkoutSets, 1)
+		assert.Equal(t, 1, fetched.Exercises[1].WorkoutSets[0].SetNumber)
+		assert.Equal(t, WorkoutSetFailure, fetched.Exercises[1].WorkoutSets[0].SetType)
+
+		lunge := &WorkoutExercise{Name: "Lunge", Sets: 1, Reps: intPtr(10), WorkoutSets: []WorkoutSet{{SetType: WorkoutSetWorking, Reps: intPtr(10)}}}
+		require.NoError(t, stores.Workouts.AddWorkoutExercise(workout.ID, lunge))
+		require.Len(t, lunge.WorkoutSets, 1)
+
+		lunge.WorkoutSets = append(lunge.WorkoutSets, WorkoutSet{SetType: WorkoutSetDrop, Reps: intPtr(8)})
+		require.NoError(t, stores.Workouts.UpdateWorkoutExercise(workout.ID, lunge))
+		assert.Len(t, lunge.WorkoutSets, 2)
+
+		reordered, err := stores.Workouts.ReorderWorkoutExercises(workout.ID, []int{lunge.ID, fetched.Exercises[1].ID, fetched.Exercises[0].ID})
+		require.NoError(t, err)
+		assert.Len(t, reordered[0].WorkoutSets, 2)
+
+		invalid := &WorkoutExercise{Name: "Lunge", Sets: 1, Reps: intPtr(10), WorkoutSets: []WorkoutSet{{SetType: "cluster", Reps: intPtr(10)}}}
+		assert.Error(t, stores.Workouts.AddWorkoutExercise(workout.ID, invalid))
+		invalid.WorkoutSets = []WorkoutSet{{SetType: WorkoutSetWorking, Reps: intPtr(10), DurationSeconds: intPtr(30)}}
+		assert.Error(t, stores.Workouts.AddWorkoutExercise(workout.ID, invalid))
+	})
+
+	t.Run("concurrent writes", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+
+		var wg sync.WaitGroup
+		errs := make(chan error, 20)
+		for range 20 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs <- stores.Workouts.PersistWorkout(newTestWorkout(user.ID))
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			assert.NoError(t, err)
+		}
+	})
+}
+
+func testTxManagerContract(t *testing.T, newStores storesFactory) {
+	t.Run("commit", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+		workout := newTestWorkout(user.ID)
+
+		err := stores.Tx.WithinTx(func(txStores *Stores) error {
+			err := txStores.Workouts.PersistWorkout(workout)
+			if err != nil {
+				return err
+			}
+
+			return txStores.Tokens.PersistToken(mustMakeToken(t, user.ID))
+		})
+		require.NoError(t, err)
+
+		committedWorkout, err := stores.Workouts.GetWorkout(workout.ID)
+		require.NoError(t, err)
+		assert.NotNil(t, committedWorkout)
+	})
+
+	t.Run("rollback spans stores", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+		token := createTestToken(t, stores, user.ID)
+		errRollback := errors.New("rollback")
+
+		err := stores.Tx.WithinTx(func(txStores *Stores) error {
+			err := txStores.Tokens.RevokeTokensForUser(user.ID, auth.TokenScopeAuth)
+			if err != nil {
+				return err
+			}
+
+			user.Username = "renamed"
+			err = txStores.Users.UpdateUser(user)
+			if err != nil {
+				return err
+			}
+
+			return errRollback
+		})
+		assert.ErrorIs(t, err, errRollback)
+
+		tokenUser, err := stores.Users.GetUserFromToken(token.Plain, auth.TokenScopeAuth)
+		require.NoError(t, err)
+		require.NotNil(t, tokenUser)
+		assert.Equal(t, "alice", tokenUser.Username)
+	})
+
+	t.Run("nested savepoint", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+		outerWorkout := newTestWorkout(user.ID)
+		innerWorkout := newTestWorkout(user.ID)
+		errInner := errors.New("inner")
+
+		err := stores.Tx.WithinTx(func(txStores *Stores) error {
+			err := txStores.Workouts.PersistWorkout(outerWorkout)
+			if err != nil {
+				return err
+			}
+
+			err = txStores.Tx.WithinTx(func(nestedStores *Stores) error {
+				err := nestedStores.Workouts.PersistWorkout(innerWorkout)
+				if err != nil {
+					return err
+				}
+
+				return errInner
+			})
+			assert.ErrorIs(t, err, errInner)
+
+			// the transaction is still usable after rolling back to the savepoint
+			_, err = txStores.Workouts.GetWorkout(outerWorkout.ID)
+
+			return err
+		})
+		require.NoError(t, err)
+
+		workout, err := stores.Workouts.GetWorkout(outerWorkout.ID)
+		require.NoError(t, err)
+		assert.NotNil(t, workout)
+
+		workout, err = stores.Workouts.GetWorkout(innerWorkout.ID)
+		require.NoError(t, err)
+		assert.Nil(t, workout)
+	})
+
+	t.Run("failed statement rolls back the store call", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+		workout := newTestWorkout(user.ID)
+		workout.Exercises[1].Reps = intPtr(10)
+
+		err := stores.Tx.WithinTx(func(txStores *Stores) error {
+			assert.Error(t, txStores.Workouts.PersistWorkout(workout))
+
+			return nil
+		})
+		require.NoError(t, err)
+
+		persistedWorkout, err := stores.Workouts.GetWorkout(workout.ID)
+		require.NoError(t, err)
+		assert.Nil(t, persistedWorkout)
+	})
+}
+
+func testIdempotencyStoreContract(t *testing.T, newStores storesFactory) {
+	newRecord := func(userID int, key string) *IdempotencyRecord {
+		return &IdempotencyRecord{
+			UserID:      userID,
+			Key:         key,
+			Fingerprint: []byte("fingerprint"),
+			ExpiresAt:   time.Now().Add(time.Hour),
+		}
+	}
+
+	t.Run("reserve, complete and replay", func(t *testing.T) {
+		stores := newStores(t)
+		alice := createTestUser(t, stores, "alice")
+		record := newRecord(alice.ID, "key")
+
+		existingRecord, err := stores.Idempotency.ReserveIdempotencyKey(record)
+		require.NoError(t, err)
+		assert.Nil(t, existingRecord)
+
+		existingRecord, err = stores.Idempotency.ReserveIdempotencyKey(record)
+		require.NoError(t, err)
+		require.NotNil(t, existingRecord)
+		assert.False(t, existingRecord.IsComplete())
+		assert.Equal(t, []byte("fingerprint"), existingRecord.Fingerprint)
+
+		record.ResponseStatus = 201
+		record.ResponseHeaders = map[string][]string{"Content-Type": {"application/json"}}
+		record.ResponseBody = []byte(`{"id":1}`)
+		require.NoError(t, stores.Idempotency.CompleteIdempotencyKey(record))
+
+		existingRecord, err = stores.Idempotency.ReserveIdempotencyKey(newRecord(alice.ID, "key"))
+		require.NoError(t, err)
+		require.NotNil(t, existingRecord)
+		assert.True(t, existingRecord.IsComplete())
+		assert.Equal(t, 201, existingRecord.ResponseStatus)
+		assert.Equal(t, "application/json", existingRecord.ResponseHeaders.Get("Content-Type"))
+		assert.Equal(t, []byte(`{"id":1}`), existingRecord.ResponseBody)
+	})
+
+	t.Run("keys are scoped per user", func(t *testing.T) {
+		stores := newStores(t)
+		alice := createTestUser(t, stores, "alice")
+
+		existingRecord, err := stores.Idempotency.ReserveIdempotencyKey(newRecord(alice.ID, "key"))
+		require.NoError(t, err)
+		assert.Nil(t, existingRecord)
+
+		existingRecord, err = stores.Idempotency.ReserveIdempotencyKey(newRecord(createTestUser(t, stores, "bob").ID, "key"))
+		require.NoError(t, err)
+		assert.Nil(t, existingRecord)
+
+		// requests made without authentication share the user 0
+		existingRecord, err = stores.Idempotency.ReserveIdempotencyKey(newRecord(0, "key"))
+		require.NoError(t, err)
+		assert.Nil(t, existingRecord)
+		existingRecord, err = stores.Idempotency.ReserveIdempotencyKey(newRecord(0, "key"))
+		require.NoError(t, err)
+		require.NotNil(t, existingRecord)
+		assert.Equal(t, 0, existingRecord.UserID)
+		require.NoError(t, stores.Idempotency.ReleaseIdempotencyKey(0, "key"))
+		existingRecord, err = stores.Idempotency.ReserveIdempotencyKey(newRecord(0, "key"))
+		require.NoError(t, err)
+		assert.Nil(t, existingRecord)
+	})
+
+	t.Run("release", func(t *testing.T) {
+		stores := newStores(t)
+		alice := createTestUser(t, stores, "alice")
+
+		_, err := stores.Idempotency.ReserveIdempotencyKey(newRecord(alice.ID, "key"))
+		require.NoError(t, err)
+		require.NoError(t, stores.Idempotency.ReleaseIdempotencyKey(alice.ID, "key"))
+
+		existingRecord, err := stores.Idempotency.ReserveIdempotencyKey(newRecord(alice.ID, "key"))
+		require.NoError(t, err)
+		assert.Nil(t, existingRecord)
+
+		assert.ErrorIs(t, stores.Idempotency.CompleteIdempotencyKey(newRecord(alice.ID, "unknown")), sql.ErrNoRows)
+	})
+
+	t.Run("expired keys are reserved again", func(t *testing.T) {
+		stores := newStores(t)
+		alice := createTestUser(t, stores, "alice")
+		expiredRecord := newRecord(alice.ID, "key")
+		expiredRecord.ExpiresAt = time.Now().Add(-time.Minute)
+
+		_, err := stores.Idempotency.ReserveIdempotencyKey(expiredRecord)
+		require.NoError(t, err)
+
+		existingRecord, err := stores.Idempotency.ReserveIdempotencyKey(newRecord(alice.ID, "key"))
+		require.NoError(t, err)
+		assert.Nil(t, existingRecord)
+	})
+
+	t.Run("expired keys and the keys of deleted users are deleted", func(t *testing.T) {
+		stores := newStores(t)
+		alice := createTestUser(t, stores, "alice")
+		expiredRecord := newRecord(0, "expired")
+		expiredRecord.ExpiresAt = time.Now().Add(-time.Minute)
+
+		_, err := stores.Idempotency.ReserveIdempotencyKey(expiredRecord)
+		require.NoError(t, err)
+		_, err = stores.Idempotency.ReserveIdempotencyKey(newRecord(0, "key"))
+		require.NoError(t, err)
+		_, err = stores.Idempotency.ReserveIdempotencyKey(newRecord(alice.ID, "key"))
+		require.NoError(t, err)
+
+		deleted, err := stores.Idempotency.DeleteExpiredIdempotencyKeys(time.Now())
+		require.NoError(t, err)
+		assert.Equal(t, 1, deleted)
+
+		existingRecord, err := stores.Idempotency.ReserveIdempotencyKey(newRecord(0, "key"))
+		require.NoError(t, err)
+		assert.NotNil(t, existingRecord)
+
+		require.NoError(t, stores.Users.DeleteUser(alice.ID))
+		deleted, err = stores.Idempotency.DeleteExpiredIdempotencyKeys(time.Now().Add(2 * time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, 1, deleted, "the key of alice went with her")
+
+		_, err = stores.Idempotency.ReserveIdempotencyKey(newRecord(alice.ID, "key"))
+		assert.Error(t, err, "keys belong to users")
+	})
+}
+
+func testWorkoutRevisionStoreContract(t *testing.T, newStores storesFactory) {
+	t.Run("create, list and get", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+
+		first := &WorkoutRevision{WorkoutID: 7, UserID: user.ID, ActorID: user.ID, Action: WorkoutRevisionCreate, Snapshot: json.RawMessage(`{"name":"Leg Day","duration_minutes":60}`)}
+		require.NoError(t, stores.WorkoutRevisions.CreateWorkoutRevision(first))
+		assert.Equal(t, 1, first.Revision)
+		assert.Nil(t, first.Diff)
+		assert.False(t, first.CreatedAt.IsZero())
+
+		second := &WorkoutRevision{WorkoutID: 7, UserID: user.ID, ActorID: user.ID, Action: WorkoutRevisionUpdate, Snapshot: json.RawMessage(`{"name":"Leg Day","duration_minutes":45}`)}
+		require.NoError(t, stores.WorkoutRevisions.CreateWorkoutRevision(second))
+		assert.Equal(t, 2, second.Revision)
+		assert.JSONEq(t, `[{"op":"replace","path":"/duration_minutes","value":45}]`, string(second.Diff))
+
+		deletion := &WorkoutRevision{WorkoutID: 7, UserID: user.ID, ActorID: user.ID, Action: WorkoutRevisionDelete, Snapshot: second.Snapshot}
+		require.NoError(t, stores.WorkoutRevisions.CreateWorkoutRevision(deletion))
+		assert.Equal(t, 3, deletion.Revision)
+		assert.Nil(t, deletion.Diff)
+
+		// revisions are numbered per workout
+		other := &WorkoutRevision{WorkoutID: 8, UserID: user.ID, ActorID: user.ID, Action: WorkoutRevisionCreate, Snapshot: json.RawMessage(`{}`)}
+		require.NoError(t, stores.WorkoutRevisions.CreateWorkoutRevision(other))
+		assert.Equal(t, 1, other.Revision)
+
+		revisions, err := stores.WorkoutRevisions.ListWorkoutRevisions(7)
+		require.NoError(t, err)
+		require.Len(t, revisions, 3)
+		assert.Equal(t, []string{WorkoutRevisionCreate, WorkoutRevisionUpdate, WorkoutRevisionDelete},
+			[]string{revisions[0].Action, revisions[1].Action, revisions[2].Action})
+		assert.Nil(t, revisions[1].Snapshot)
+		assert.JSONEq(t, string(second.Diff), string(revisions[1].Diff))
+
+		revision, err := stores.WorkoutRevisions.GetWorkoutRevision(7, 2)
+		require.NoError(t, err)
+		require.NotNil(t, revision)
+		assert.Equal(t, user.ID, revision.UserID)
+		assert.Equal(t, WorkoutRevisionUpdate, revision.Action)
+		assert.JSONEq(t, string(second.Snapshot), string(revision.Snapshot))
+		assert.JSONEq(t, string(second.Diff), string(revision.Diff))
+	})
+
+	t.Run("create several", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+
+		existing := &WorkoutRevision{WorkoutID: 7, UserID: user.ID, ActorID: user.ID, Action: WorkoutRevisionCreate, Snapshot: json.RawMessage(`{"name":"a"}`)}
+		require.NoError(t, stores.WorkoutRevisions.CreateWorkoutRevision(existing))
+
+		revisions := []*WorkoutRevision{
+			{WorkoutID: 7, UserID: user.ID, ActorID: user.ID, Action: WorkoutRevisionUpdate, Snapshot: json.RawMessage(`{"name":"b"}`)},
+			{WorkoutID: 8, UserID: user.ID, ActorID: user.ID, Action: WorkoutRevisionCreate, Snapshot: json.RawMessage(`{"name":"x"}`)},
+			{WorkoutID: 7, UserID: user.ID, ActorID: user.ID, Action: WorkoutRevisionUpdate, Snapshot: json.RawMessage(`{"name":"c"}`)},
+		}
+		require.NoError(t, stores.WorkoutRevisions.CreateWorkoutRevisions(revisions))
+
+		assert.Equal(t, []int{2, 1, 3}, []int{revisions[0].Revision, revisions[1].Revision, revisions[2].Revision})
+		assert.JSONEq(t, `[{"op":"replace","path":"/name","value":"b"}]`, string(revisions[0].Diff))
+		assert.Nil(t, revisions[1].Diff)
+		assert.JSONEq(t, `[{"op":"replace","path":"/name","value":"c"}]`, string(revisions[2].Diff))
+		assert.False(t, revisions[2].CreatedAt.IsZero())
+
+		stored, err := stores.WorkoutRevisions.ListWorkoutRevisions(7)
+		require.NoError(t, err)
+		assert.Len(t, stored, 3)
+	})
+
+	t.Run("get unknown revision", func(t *testing.T) {
+		stores := newStores(t)
+
+		revision, err := stores.WorkoutRevisions.GetWorkoutRevision(7, 1)
+		require.NoError(t, err)
+		assert.Nil(t, revision)
+
+		revisions, err := stores.WorkoutRevisions.ListWorkoutRevisions(7)
+		require.NoError(t, err)
+		assert.Empty(t, revisions)
+	})
+
+	t.Run("revisions outlive the workout but not the user", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+
+		workout := newTestWorkout(user.ID)
+		require.NoError(t, stores.Workouts.PersistWorkout(workout))
+		revision := &WorkoutRevision{WorkoutID: workout.ID, UserID: user.ID, ActorID: user.ID, Action: WorkoutRevisionCreate, Snapshot: json.RawMessage(`{}`)}
+		require.NoError(t, stores.WorkoutRevisions.CreateWorkoutRevision(revision))
+
+		require.NoError(t, stores.Workouts.DeleteWorkout(workout.ID, 0))
+		revisions, err := stores.WorkoutRevisions.ListWorkoutRevisions(workout.ID)
+		require.NoError(t, err)
+		assert.Len(t, revisions, 1)
+
+		require.NoError(t, stores.Users.DeleteUser(user.ID))
+		revisions, err = stores.WorkoutRevisions.ListWorkoutRevisions(workout.ID)
+		require.NoError(t, err)
+		assert.Empty(t, revisions)
+	})
+
+	t.Run("create for unknown user", func(t *testing.T) {
+		stores := newStores(t)
+
+		revision := &WorkoutRevision{WorkoutID: 7, UserID: 12345, ActorID: 12345, Action: WorkoutRevisionCreate, Snapshot: json.RawMessage(`{}`)}
+		assert.Error(t, stores.WorkoutRevisions.CreateWorkoutRevision(revision))
+	})
+}
+
+func testExerciseStoreContract(t *testing.T, newStores storesFactory) {
+	t.Run("seed", func(t *testing.T) {
+		stores := newStores(t)
+
+		catalog := []Exercise{*newTestExercise(nil, "Barbell Back Squat"), *newTestExercise(nil, "Plank")}
+		catalog[1].Tracking = ExerciseTrackingTime
+		require.NoError(t, stores.Exercises.SeedExercises(catalog))
+
+		catalog[0].Aliases = []string{"Squat", "Back Squat"}
+		require.NoError(t, stores.Exercises.SeedExercises(catalog))
+
+		exercises, err := stores.Exercises.SearchExercises(0, ExerciseFilter{})
+		require.NoError(t, err)
+		require.Len(t, exercises, 2, "seeding again updates the catalog")
+		assert.Equal(t, "Barbell Back Squat", exercises[0].Name)
+		assert.Nil(t, exercises[0].UserID)
+		assert.Equal(t, []string{"Squat", "Back Squat"}, exercises[0].Aliases)
+		assert.Equal(t, []string{"quadriceps", "glutes"}, exercises[0].PrimaryMuscles)
+		assert.Equal(t, []string{}, exercises[0].SecondaryMuscles)
+		assert.NotZero(t, exercises[0].CreatedAt)
+
+		catalog[0].Tracking = "distance"
+		assert.Error(t, stores.Exercises.SeedExercises(catalog))
+	})
+
+	t.Run("custom exercises", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+		otherUser := createTestUser(t, stores, "bob")
+		require.NoError(t, stores.Exercises.SeedExercises([]Exercise{*newTestExercise(nil, "Barbell Back Squat")}))
+
+		exercise := newTestExercise(&user.ID, "Barbell Back Squat")
+		require.NoError(t, stores.Exercises.CreateExercise(exercise), "a custom exercise can share a catalog name")
+		assert.NotZero(t, exercise.ID)
+
+		assert.ErrorIs(t, stores.Exercises.CreateExercise(newTestExercise(&user.ID, "barbell back squat")), ErrDuplicateExerciseName)
+		require.NoError(t, stores.Exercises.CreateExercise(newTestExercise(&otherUser.ID, "Barbell Back Squat")))
+		assert.Error(t, stores.Exercises.CreateExercise(newTestExercise(intPtr(12345), "Zercher Squat")))
+
+		otherExercise := newTestExercise(&user.ID, "Zercher Squat")
+		require.NoError(t, stores.Exercises.CreateExercise(otherExercise))
+		otherExercise.Name = "BARBELL BACK SQUAT"
+		assert.ErrorIs(t, stores.Exercises.UpdateExercise(otherExercise), ErrDuplicateExerciseName)
+		require.NoError(t, stores.Exercises.DeleteExercise(otherExercise.ID))
+
+		exercise.Name = "Zercher Squat"
+		exercise.Equipment = "other"
+		require.NoError(t, stores.Exercises.UpdateExercise(exercise))
+
+		fetched, err := stores.Exercises.GetExercise(exercise.ID)
+		require.NoError(t, err)
+		require.NotNil(t, fetched)
+		assert.Equal(t, "Zercher Squat", fetched.Name)
+		assert.Equal(t, "other", fetched.Equipment)
+		assert.Equal(t, user.ID, *fetched.UserID)
+
+		catalogExercises, err := stores.Exercises.SearchExercises(user.ID, ExerciseFilter{Query: "Barbell Back Squat"})
+		require.NoError(t, err)
+		require.Len(t, catalogExercises, 1)
+		catalogExercise := catalogExercises[0]
+		assert.Nil(t, catalogExercise.UserID)
+
+		catalogExercise.Name = "Squat"
+		assert.ErrorIs(t, stores.Exercises.UpdateExercise(&catalogExercise), sql.ErrNoRows)
+		assert.ErrorIs(t, stores.Exercises.DeleteExercise(catalogExercise.ID), sql.ErrNoRows)
+
+		exercises, err := stores.Exercises.GetExercises([]int{exercise.ID, catalogExercise.ID, 12345})
+		require.NoError(t, err)
+		assert.Len(t, exercises, 2)
+
+		require.NoError(t, stores.Exercises.DeleteExercise(exercise.ID))
+		deleted, err := stores.Exercises.GetExercise(exercise.ID)
+		require.NoError(t, err)
+		assert.Nil(t, deleted)
+		assert.ErrorIs(t, stores.Exercises.DeleteExercise(exercise.ID), sql.ErrNoRows)
+	})
+
+	t.Run("search", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+		otherUser := createTestUser(t, stores, "bob")
+
+		benchPress := newTestExercise(nil, "Barbell Bench Press")
+		benchPress.Aliases = []string{"Bench Press", "Bench"}
+		benchPress.PrimaryMuscles = []string{"chest"}
+		benchPress.SecondaryMuscles = []string{"triceps"}
+		benchPress.Equipment = "barbell"
+		dip := newTestExercise(nil, "Dip")
+		dip.PrimaryMuscles = []string{"triceps", "chest"}
+		dip.Equipment = "bodyweight"
+		plank := newTestExercise(nil, "Plank")
+		plank.PrimaryMuscles = []string{"abdominals"}
+		plank.Tracking = ExerciseTrackingTime
+		require.NoError(t, stores.Exercises.SeedExercises([]Exercise{*benchPress, *dip, *plank}))
+
+		benchDip := newTestExercise(&user.ID, "Bench Dip")
+		benchDip.MovementType = "isolation"
+		require.NoError(t, stores.Exercises.CreateExercise(benchDip))
+		require.NoError(t, stores.Exercises.CreateExercise(newTestExercise(&user.ID, "100% Effort Sprint")))
+		require.NoError(t, stores.Exercises.CreateExercise(newTestExercise(&otherUser.ID, "Bench Jump")))
+
+		names := func(filter ExerciseFilter) []string {
+			t.Helper()
+
+			exercises, err := stores.Exercises.SearchExercises(user.ID, filter)
+			require.NoError(t, err)
+
+			names := []string{}
+			for _, exercise := range exercises {
+				names = append(names, exercise.Name)
+			}
+			return names
+		}
+
+		assert.Equal(t, []string{"100% Effort Sprint", "Barbell Bench Press", "Bench Dip", "Dip", "Plank"}, names(ExerciseFilter{}))
+		assert.Equal(t, []string{"Barbell Bench Press", "Bench Dip"}, names(ExerciseFilter{Query: "BENCH"}), "exact alias matches come first")
+		assert.Equal(t, []string{"Dip", "Bench Dip"}, names(ExerciseFilter{Query: "dip"}))
+		assert.Equal(t, []string{"100% Effort Sprint"}, names(ExerciseFilter{Query: "0%"}))
+		assert.Equal(t, []string{}, names(ExerciseFilter{Query: "_"}))
+		assert.Equal(t, []string{"Barbell Bench Press", "Dip"}, names(ExerciseFilter{Muscle: "triceps"}))
+		assert.Equal(t, []string{"Dip"}, names(ExerciseFilter{Muscle: "chest", Equipment: "bodyweight"}))
+		assert.Equal(t, []string{"Plank"}, names(ExerciseFilter{Tracking: ExerciseTrackingTime}))
+		assert.Equal(t, []string{"100% Effort Sprint", "Bench Dip"}, names(ExerciseFilter{CustomOnly: true}))
+		assert.Equal(t, []string{"Barbell Bench Press"}, names(ExerciseFilter{Query: "bench", Limit: 1}))
+		assert.Equal(t, []string{"Bench Dip"}, names(ExerciseFilter{Query: "bench", MovementType: "isolation"}))
+	})
+
+	t.Run("workout exercises reference exercises", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+		exercise := newTestExercise(&user.ID, "Zercher Squat")
+		require.NoError(t, stores.Exercises.CreateExercise(exercise))
+
+		workout := newTestWorkout(user.ID)
+		workout.Exercises[0].ExerciseID = intPtr(12345)
+		assert.Error(t, stores.Workouts.PersistWorkout(workout))
+
+		workout = newTestWorkout(user.ID)
+		workout.Exercises[0].ExerciseID = &exercise.ID
+		require.NoError(t, stores.Workouts.PersistWorkout(workout))
+
+		fetched, err := stores.Workouts.GetWorkout(workout.ID)
+		require.NoError(t, err)
+		require.Len(t, fetched.Exercises, 2)
+		assert.Equal(t, exercise.ID, *fetched.Exercises[1].ExerciseID)
+		assert.Nil(t, fetched.Exercises[0].ExerciseID)
+
+		require.NoError(t, stores.Exercises.DeleteExercise(exercise.ID))
+
+		fetched, err = stores.Workouts.GetWorkout(workout.ID)
+		require.NoError(t, err)
+		assert.Nil(t, fetched.Exercises[1].ExerciseID, "deleting the exercise unlinks it")
+		assert.Equal(t, "Squat", fetched.Exercises[1].Name)
+	})
+
+	t.Run("delete user cascades to custom exercises", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+		exercise := newTestExercise(&user.ID, "Zercher Squat")
+		require.NoError(t, stores.Exercises.CreateExercise(exercise))
+
+		require.NoError(t, stores.Users.DeleteUser(user.ID))
+
+		deleted, err := stores.Exercises.GetExercise(exercise.ID)
+		require.NoError(t, err)
+		assert.Nil(t, deleted)
+	})
+}
+
+func testTemplateStoreContract(t *testing.T, newStores storesFactory) {
+	t.Run("create, get, list, update and delete", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+		other := createTestUser(t, stores, "bob")
+
+		template := newTestTemplate(user.ID, "Leg Day")
+		require.NoError(t, stores.Templates.CreateTemplate(template))
+		assert.NotZero(t, template.ID)
+		require.Len(t, template.Exercises, 2)
+		assert.NotZero(t, template.Exercises[0].ID)
+		require.NoError(t, stores.Templates.CreateTemplate(newTestTemplate(user.ID, "arms")))
+		require.NoError(t, stores.Templates.CreateTemplate(newTestTemplate(other.ID, "Back")))
+
+		fetched, err := stores.Templates.GetTemplate(template.ID)
+		require.NoError(t, err)
+		require.NotNil(t, fetched)
+		assert.Equal(t, "Leg Day", fetched.Name)
+		assert.Equal(t, 400, *fetched.CaloriesBurned)
+		require.Len(t, fetched.Exercises, 2)
+		assert.Equal(t, "Plank", fetched.Exercises[0].Name, "exercises are in order")
+		assert.Equal(t, 100.5, *fetched.Exercises[1].Weight)
+
+		templates, err := stores.Templates.ListTemplates(user.ID)
+		require.NoError(t, err)
+		require.Len(t, templates, 2)
+		assert.Equal(t, "arms", templates[0].Name)
+		assert.Equal(t, "Leg Day", templates[1].Name)
+		assert.Nil(t, templates[1].Exercises)
+
+		template.Name = "Lower Body"
+		template.Exercises = template.Exercises[:1]
+		require.NoError(t, stores.Templates.UpdateTemplate(template))
+		assert.Equal(t, user.ID, template.UserID)
+
+		fetched, err = stores.Templates.GetTemplate(template.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "Lower Body", fetched.Name)
+		require.Len(t, fetched.Exercises, 1)
+		assert.Equal(t, "Squat", fetched.Exercises[0].Name)
+
+		require.NoError(t, stores.Templates.DeleteTemplate(template.ID))
+		fetched, err = stores.Templates.GetTemplate(template.ID)
+		require.NoError(t, err)
+		assert.Nil(t, fetched)
+	})
+
+	t.Run("unknown templates", func(t *testing.T) {
+		stores := newStores(t)
+		createTestUser(t, stores, "alice")
+
+		fetched, err := stores.Templates.GetTemplate(12345)
+		require.NoError(t, err)
+		assert.Nil(t, fetched)
+
+		template := newTestTemplate(12345, "Leg Day")
+		assert.Error(t, stores.Templates.CreateTemplate(template))
+
+		template.ID = 12345
+		assert.ErrorIs(t, stores.Templates.UpdateTemplate(template), sql.ErrNoRows)
+		assert.ErrorIs(t, stores.Templates.DeleteTemplate(12345), sql.ErrNoRows)
+	})
+
+	t.Run("invalid exercise", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+
+		template := newTestTemplate(user.ID, "Leg Day")
+		template.Exercises[0].DurationSeconds = intPtr(30)
+		assert.Error(t, stores.Templates.CreateTemplate(template))
+
+		templates, err := stores.Templates.ListTemplates(user.ID)
+		require.NoError(t, err)
+		assert.Empty(t, templates)
+	})
+
+	t.Run("workouts started from a template", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+		exercise := newTestExercise(&user.ID, "Zercher Squat")
+		require.NoError(t, stores.Exercises.CreateExercise(exercise))
+
+		template := newTestTemplate(user.ID, "Leg Day")
+		template.Exercises[0].ExerciseID = &exercise.ID
+		require.NoError(t, stores.Templates.CreateTemplate(template))
+
+		workout := newTestWorkout(user.ID)
+		workout.TemplateID = intPtr(12345)
+		assert.Error(t, stores.Workouts.PersistWorkout(workout))
+
+		workout.TemplateID = &template.ID
+		require.NoError(t, stores.Workouts.PersistWorkout(workout))
+
+		workout.Name = "Edited"
+		require.NoError(t, stores.Workouts.UpdateWorkout(workout))
+
+		fetched, err := stores.Workouts.GetWorkout(workout.ID)
+		require.NoError(t, err)
+		assert.Equal(t, template.ID, *fetched.TemplateID)
+
+		require.NoError(t, stores.Exercises.DeleteExercise(exercise.ID))
+		fetchedTemplate, err := stores.Templates.GetTemplate(template.ID)
+		require.NoError(t, err)
+		assert.Nil(t, fetchedTemplate.Exercises[1].ExerciseID, "deleting the exercise unlinks it")
+
+		require.NoError(t, stores.Templates.DeleteTemplate(template.ID))
+		fetched, err = stores.Workouts.GetWorkout(workout.ID)
+		require.NoError(t, err)
+		assert.Nil(t, fetched.TemplateID, "deleting the template keeps the workout")
+	})
+
+	t.Run("delete user cascades to templates", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+		template := newTestTemplate(user.ID, "Leg Day")
+		require.NoError(t, stores.Templates.CreateTemplate(template))
+
+		require.NoError(t, stores.Users.DeleteUser(user.ID))
+
+		deleted, err := stores.Templates.GetTemplate(template.ID)
+		require.NoError(t, err)
+		assert.Nil(t, deleted)
+	})
+}
+
+func testProgramStoreContract(t *testing.T, newStores storesFactory) {
+	t.Run("create, get, list, update and delete", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "coach")
+		legDay := newTestTemplate(user.ID, "Leg Day")
+		require.NoError(t, stores.Templates.CreateTemplate(legDay))
+		pushDay := newTestTemplate(user.ID, "Push Day")
+		require.NoError(t, stores.Templates.CreateTemplate(pushDay))
+
+		program := newTestProgram(user.ID, "Strength", legDay.ID, pushDay.ID)
+		require.NoError(t, stores.Programs.CreateProgram(program))
+		assert.NotZero(t, program.ID)
+		require.Len(t, program.Days, 3)
+		for _, day := range program.Days {
+			assert.NotZero(t, day.ID)
+		}
+		require.NoError(t, stores.Programs.CreateProgram(newTestProgram(user.ID, "base", legDay.ID)))
+
+		fetched, err := stores.Programs.GetProgram(program.ID)
+		require.NoError(t, err)
+		require.NotNil(t, fetched)
+		assert.Equal(t, "Strength", fetched.Name)
+		assert.Equal(t, 2, fetched.Weeks)
+		require.Len(t, fetched.Days, 3)
+		assert.Equal(t, ProgramDay{ID: fetched.Days[0].ID, Week: 1, Day: 1, TemplateID: legDay.ID}, fetched.Days[0])
+		assert.Equal(t, 2, fetched.Days[2].Week, "days are in order")
+
+		programs, err := stores.Programs.ListPrograms()
+		require.NoError(t, err)
+		require.Len(t, programs, 2)
+		assert.Equal(t, "base", programs[0].Name)
+		assert.Nil(t, programs[1].Days)
+
+		keptDayID := fetched.Days[0].ID
+		program.Name = "Strength II"
+		program.Days = []ProgramDay{
+			{Week: 1, Day: 1, TemplateID: pushDay.ID},
+			{Week: 2, Day: 5, TemplateID: legDay.ID},
+		}
+		require.NoError(t, stores.Programs.UpdateProgram(program))
+		assert.Equal(t, user.ID, program.UserID)
+		assert.Equal(t, keptDayID, program.Days[0].ID, "days kept keep their id")
+
+		fetched, err = stores.Programs.GetProgram(program.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "Strength II", fetched.Name)
+		require.Len(t, fetched.Days, 2)
+		assert.Equal(t, ProgramDay{ID: keptDayID, Week: 1, Day: 1, TemplateID: pushDay.ID}, fetched.Days[0])
+		assert.Equal(t, program.Days[1].ID, fetched.Days[1].ID)
+
+		require.NoError(t, stores.Programs.DeleteProgram(program.ID))
+		fetched, err = stores.Programs.GetProgram(program.ID)
+		require.NoError(t, err)
+		assert.Nil(t, fetched)
+	})
+
+	t.Run("unknown programs", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "coach")
+
+		fetched, err := stores.Programs.GetProgram(12345)
+		require.NoError(t, err)
+		assert.Nil(t, fetched)
+
+		program := newTestProgram(12345, "Strength")
+		assert.Error(t, stores.Programs.CreateProgram(program))
+
+		program = newTestProgram(user.ID, "Strength", 12345)
+		assert.Error(t, stores.Programs.CreateProgram(program), "unknown template")
+
+		program.ID = 12345
+		program.Days = nil
+		assert.ErrorIs(t, stores.Programs.UpdateProgram(program), sql.ErrNoRows)
+		assert.ErrorIs(t, stores.Programs.DeleteProgram(12345), sql.ErrNoRows)
+	})
+
+	t.Run("invalid days", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "coach")
+		template := newTestTemplate(user.ID, "Leg Day")
+		require.NoError(t, stores.Templates.CreateTemplate(template))
+
+		program := newTestProgram(user.ID, "Strength", template.ID)
+		program.Days[0].Day = 8
+		assert.Error(t, stores.Programs.CreateProgram(program))
+
+		program = newTestProgram(user.ID, "Strength", template.ID)
+		program.Days = append(program.Days, program.Days[0])
+		assert.Error(t, stores.Programs.CreateProgram(program), "a day planned twice")
+
+		programs, err := stores.Programs.ListPrograms()
+		require.NoError(t, err)
+		assert.Empty(t, programs)
+	})
+
+	t.Run("templates used by a program", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "coach")
+		template := newTestTemplate(user.ID, "Leg Day")
+		require.NoError(t, stores.Templates.CreateTemplate(template))
+		program := newTestProgram(user.ID, "Strength", template.ID)
+		require.NoError(t, stores.Programs.CreateProgram(program))
+
+		assert.ErrorIs(t, stores.Templates.DeleteTemplate(template.ID), ErrTemplateInUse)
+
+		require.NoError(t, stores.Programs.DeleteProgram(program.ID))
+		require.NoError(t, stores.Templates.DeleteTemplate(template.ID))
+	})
+
+	t.Run("delete user cascades to programs", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "coach")
+		template := newTestTemplate(user.ID, "Leg Day")
+		require.NoError(t, stores.Templates.CreateTemplate(template))
+		program := newTestProgram(user.ID, "Strength", template.ID)
+		require.NoError(t, stores.Programs.CreateProgram(program))
+
+		require.NoError(t, stores.Users.DeleteUser(user.ID))
+
+		deleted, err := stores.Programs.GetProgram(program.ID)
+		require.NoError(t, err)
+		assert.Nil(t, deleted)
+	})
+}
+
+func testEnrollmentStoreContract(t *testing.T, newStores storesFactory) {
+	// setup creates a program of a coach and an athlete with a workout
+	setup := func(t *testing.T, stores *Stores) (*Program, *User, *Workout) {
+		coach := createTestUser(t, stores, "coach")
+		template := newTestTemplate(coach.ID, "Leg Day")
+		require.NoError(t, stores.Templates.CreateTemplate(template))
+		program := newTestProgram(coach.ID, "Strength", template.ID)
+		require.NoError(t, stores.Programs.CreateProgram(program))
+
+		athlete := createTestUser(t, stores, "athlete")
+		workout := newTestWorkout(athlete.ID)
+		require.NoError(t, stores.Workouts.PersistWorkout(workout))
+
+		return program, athlete, workout
+	}
+
+	t.Run("create, get, list and delete", func(t *testing.T) {
+		stores := newStores(t)
+		program, athlete, _ := setup(t, stores)
+
+		enrollment := &Enrollment{ProgramID: program.ID, UserID: athlete.ID, StartDate: "2026-01-05"}
+		require.NoError(t, stores.Enrollments.CreateEnrollment(enrollment))
+		assert.NotZero(t, enrollment.ID)
+		assert.Equal(t, "2026-01-05", enrollment.StartDate)
+		later := &Enrollment{ProgramID: program.ID, UserID: athlete.ID, StartDate: "2026-03-02"}
+		require.NoError(t, stores.Enrollments.CreateEnrollment(later))
+
+		fetched, err := stores.Enrollments.GetEnrollment(enrollment.ID)
+		require.NoError(t, err)
+		require.NotNil(t, fetched)
+		assert.Equal(t, program.ID, fetched.ProgramID)
+		assert.Equal(t, athlete.ID, fetched.UserID)
+		assert.Equal(t, "2026-01-05", fetched.StartDate)
+		assert.Empty(t, fetched.CompletedSessions)
+
+		enrollments, err := stores.Enrollments.ListEnrollments(athlete.ID)
+		require.NoError(t, err)
+		require.Len(t, enrollments, 2)
+		assert.Equal(t, later.ID, enrollments[0].ID, "most recent start first")
+
+		enrollments, err = stores.Enrollments.ListEnrollments(program.UserID)
+		require.NoError(t, err)
+		assert.Empty(t, enrollments)
+
+		require.NoError(t, stores.Enrollments.DeleteEnrollment(enrollment.ID))
+		fetched, err = stores.Enrollments.GetEnrollment(enrollment.ID)
+		require.NoError(t, err)
+		assert.Nil(t, fetched)
+		assert.ErrorIs(t, stores.Enrollments.DeleteEnrollment(enrollment.ID), sql.ErrNoRows)
+	})
+
+	t.Run("unknown program or user", func(t *testing.T) {
+		stores := newStores(t)
+		program, athlete, _ := setup(t, stores)
+
+		assert.Error(t, stores.Enrollments.CreateEnrollment(&Enrollment{ProgramID: 12345, UserID: athlete.ID, StartDate: "2026-01-05"}))
+		assert.Error(t, stores.Enrollments.CreateEnrollment(&Enrollment{ProgramID: program.ID, UserID: 12345, StartDate: "2026-01-05"}))
+	})
+
+	t.Run("complete and uncomplete sessions", func(t *testing.T) {
+		stores := newStores(t)
+		program, athlete, workout := setup(t, stores)
+		enrollment := &Enrollment{ProgramID: program.ID, UserID: athlete.ID, StartDate: "2026-01-05"}
+		require.NoError(t, stores.Enrollments.CreateEnrollment(enrollment))
+		firstDayID, secondDayID := program.Days[0].ID, program.Days[1].ID
+
+		require.NoError(t, stores.Enrollments.CompleteSession(enrollment.ID, firstDayID, workout.ID))
+		assert.ErrorIs(t, stores.Enrollments.CompleteSession(enrollment.ID, secondDayID, workout.ID), ErrWorkoutAlreadyLinked)
+		assert.Error(t, stores.Enrollments.CompleteSession(enrollment.ID, 12345, workout.ID))
+		assert.Error(t, stores.Enrollments.CompleteSession(enrollment.ID, secondDayID, 12345))
+
+		other := newTestWorkout(athlete.ID)
+		require.NoError(t, stores.Workouts.PersistWorkout(other))
+		require.NoError(t, stores.Enrollments.CompleteSession(enrollment.ID, secondDayID, other.ID))
+		// completing a session again replaces its workout
+		require.NoError(t, stores.Enrollments.CompleteSession(enrollment.ID, firstDayID, workout.ID))
+
+		fetched, err := stores.Enrollments.GetEnrollment(enrollment.ID)
+		require.NoError(t, err)
+		assert.Equal(t, []CompletedSession{
+			{ProgramDayID: firstDayID, WorkoutID: workout.ID},
+			{ProgramDayID: secondDayID, WorkoutID: other.ID},
+		}, fetched.CompletedSessions)
+
+		require.NoError(t, stores.Workouts.DeleteWorkout(other.ID, other.Version))
+		fetched, err = stores.Enrollments.GetEnrollment(enrollment.ID)
+		require.NoError(t, err)
+		assert.Len(t, fetched.CompletedSessions, 1, "sessions of trashed workouts are left out")
+
+		require.NoError(t, stores.Enrollments.UncompleteSession(enrollment.ID, firstDayID))
+		assert.ErrorIs(t, stores.Enrollments.UncompleteSession(enrollment.ID, firstDayID), sql.ErrNoRows)
+
+		require.NoError(t, stores.Workouts.PurgeWorkout(other.ID))
+		assert.ErrorIs(t, stores.Enrollments.UncompleteSession(enrollment.ID, secondDayID), sql.ErrNoRows, "purging the workout uncompletes its session")
+	})
+
+	t.Run("removing a day of the program uncompletes its sessions", func(t *testing.T) {
+		stores := newStores(t)
+		program, athlete, workout := setup(t, stores)
+		enrollment := &Enrollment{ProgramID: program.ID, UserID: athlete.ID, StartDate: "2026-01-05"}
+		require.NoError(t, stores.Enrollments.CreateEnrollment(enrollment))
+		require.NoError(t, stores.Enrollments.CompleteSession(enrollment.ID, program.Days[0].ID, workout.ID))
+
+		program.Days = program.Days[1:]
+		require.NoError(t, stores.Programs.UpdateProgram(program))
+
+		fetched, err := stores.Enrollments.GetEnrollment(enrollment.ID)
+		require.NoError(t, err)
+		assert.Empty(t, fetched.CompletedSessions)
+	})
+
+	t.Run("enrollments give access to the templates of the program", func(t *testing.T) {
+		stores := newStores(t)
+		program, athlete, _ := setup(t, stores)
+		templateID := program.Days[0].TemplateID
+
+		enrolled, err := stores.Enrollments.IsEnrolledWithTemplate(athlete.ID, templateID)
+		require.NoError(t, err)
+		assert.False(t, enrolled)
+
+		enrollment := &Enrollment{ProgramID: program.ID, UserID: athlete.ID, StartDate: "2026-01-05"}
+		require.NoError(t, stores.Enrollments.CreateEnrollment(enrollment))
+
+		enrolled, err = stores.Enrollments.IsEnrolledWithTemplate(athlete.ID, templateID)
+		require.NoError(t, err)
+		assert.True(t, enrolled)
+
+		enrolled, err = stores.Enrollments.IsEnrolledWithTemplate(athlete.ID, templateID+1)
+		require.NoError(t, err)
+		assert.False(t, enrolled)
+	})
+
+	t.Run("delete program or user cascades to enrollments", func(t *testing.T) {
+		stores := newStores(t)
+		program, athlete, _ := setup(t, stores)
+		enrollment := &Enrollment{ProgramID: program.ID, UserID: athlete.ID, StartDate: "2026-01-05"}
+		require.NoError(t, stores.Enrollments.CreateEnrollment(enrollment))
+		own := &Enrollment{ProgramID: program.ID, UserID: program.UserID, StartDate: "2026-01-05"}
+		require.NoError(t, stores.Enrollments.CreateEnrollment(own))
+
+		assert.ErrorIs(t, stores.Programs.DeleteProgram(program.ID), ErrProgramInUse, "the athlete is enrolled")
+		require.NoError(t, stores.Enrollments.DeleteEnrollment(enrollment.ID))
+
+		require.NoError(t, stores.Programs.DeleteProgram(program.ID))
+		deleted, err := stores.Enrollments.GetEnrollment(own.ID)
+		require.NoError(t, err)
+		assert.Nil(t, deleted)
+		assert.ErrorIs(t, stores.Programs.DeleteProgram(program.ID), sql.ErrNoRows)
+
+		program.Days = nil
+		require.NoError(t, stores.Programs.CreateProgram(program))
+		enrollment = &Enrollment{ProgramID: program.ID, UserID: athlete.ID, StartDate: "2026-01-05"}
+		require.NoError(t, stores.Enrollments.CreateEnrollment(enrollment))
+
+		require.NoError(t, stores.Users.DeleteUser(athlete.ID))
+		deleted, err = stores.Enrollments.GetEnrollment(enrollment.ID)
+		require.NoError(t, err)
+		assert.Nil(t, deleted)
+	})
+}
+
+func testPersonalRecordStoreContract(t *testing.T, newStores storesFactory) {
+	t.Run("records are set, beaten and refreshed by workouts", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+		other := createTestUser(t, stores, "bob")
+		require.NoError(t, stores.Workouts.PersistWorkout(newTestWorkout(other.ID)))
+
+		workout := newTestWorkout(user.ID)
+		require.NoError(t, stores.Workouts.PersistWorkout(workout))
+		assert.Len(t, workout.NewRecords, 5, "every record of a first workout is new")
+
+		records, err := stores.PersonalRecords.ListPersonalRecords(user.ID, false)
+		require.NoError(t, err)
+		require.Len(t, records, 5)
+		assert.Equal(t, "Plank", records[0].ExerciseName)
+		assert.Equal(t, RecordMaxDuration, records[0].RecordType)
+		assert.Equal(t, 60.0, records[0].Value)
+		assert.Equal(t, workout.ID, records[0].WorkoutID)
+		assert.NotZero(t, records[0].AchievedAt)
+		assert.Equal(t, RecordMaxWeight, records[1].RecordType)
+		assert.Equal(t, 100.5, records[1].Value)
+		assert.Equal(t, RecordMaxReps, records[2].RecordType)
+		assert.Equal(t, floatPtr(100.5), records[2].Weight)
+		assert.Equal(t, 5.0, records[2].Value)
+		assert.Equal(t, RecordEstimated1RM, records[3].RecordType)
+		assert.Equal(t, 117.25, records[3].Value)
+		assert.Equal(t, RecordMaxVolume, records[4].RecordType)
+		assert.Equal(t, 2512.5, records[4].Value)
+		assert.Nil(t, records[4].PreviousValue)
+
+		heavier := newTestWorkout(user.ID)
+		heavier.Exercises = []WorkoutExercise{
+			{Name: "squat", Sets: 5, Reps: intPtr(3), Weight: floatPtr(110), OrderIndex: 1},
+		}
+		require.NoError(t, stores.Workouts.PersistWorkout(heavier))
+		require.Len(t, heavier.NewRecords, 3)
+		assert.Equal(t, RecordMaxWeight, heavier.NewRecords[0].RecordType)
+		assert.Equal(t, floatPtr(100.5), heavier.NewRecords[0].PreviousValue)
+		assert.Equal(t, RecordMaxReps, heavier.NewRecords[1].RecordType)
+		assert.Nil(t, heavier.NewRecords[1].PreviousValue, "reps are a record at a new weight")
+		assert.Equal(t, RecordEstimated1RM, heavier.NewRecords[2].RecordType)
+		assert.Equal(t, 121.0, heavier.NewRecords[2].Value)
+
+		records, err = stores.PersonalRecords.ListPersonalRecords(user.ID, false)
+		require.NoError(t, err)
+		require.Len(t, records, 6)
+		assert.Equal(t, 110.0, records[1].Value)
+		assert.Equal(t, heavier.ID, records[1].WorkoutID)
+
+		history, err := stores.PersonalRecords.ListPersonalRecords(user.ID, true)
+		require.NoError(t, err)
+		assert.Len(t, history, 8)
+
+		heavier.Exercises[0].Weight = floatPtr(90)
+		require.NoError(t, stores.Workouts.UpdateWorkout(heavier))
+		require.Len(t, heavier.NewRecords, 1)
+		assert.Equal(t, RecordMaxReps, heavier.NewRecords[0].RecordType)
+
+		records, err = stores.PersonalRecords.ListPersonalRecords(user.ID, false)
+		require.NoError(t, err)
+		require.Len(t, records, 6)
+		assert.Equal(t, 100.5, records[1].Value, "an updated workout no longer holds the records it lost")
+
+		require.NoError(t, stores.Workouts.DeleteWorkout(heavier.ID, 0))
+		history, err = stores.PersonalRecords.ListPersonalRecords(user.ID, true)
+		require.NoError(t, err)
+		assert.Len(t, history, 5, "the records of trashed workouts are left out")
+	})
+
+	t.Run("records and goals hold the largest workouts", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+		goal := &Goal{UserID: user.ID, Kind: GoalTotalDuration, Target: 1000}
+		require.NoError(t, stores.Goals.CreateGoal(goal))
+
+		workout := newTestWorkout(user.ID)
+		workout.DurationMinutes = math.MaxInt32
+		workout.Exercises = []WorkoutExercise{
+			{Name: "Squat", Sets: math.MaxInt16, Reps: intPtr(math.MaxInt16), Weight: floatPtr(99999.999), OrderIndex: 1},
+		}
+		require.NoError(t, stores.Workouts.PersistWorkout(workout))
+
+		records, err := stores.PersonalRecords.ListPersonalRecords(user.ID, false)
+		require.NoError(t, err)
+		require.Len(t, records, 4)
+		assert.Equal(t, RecordEstimated1RM, records[2].RecordType)
+		assert.InEpsilon(t, 99999.999*(1+math.MaxInt16/30.0), records[2].Value, 1e-9)
+		assert.Equal(t, RecordMaxVolume, records[3].RecordType)
+		assert.InEpsilon(t, 99999.999*math.MaxInt16*math.MaxInt16, records[3].Value, 1e-9)
+
+		storedGoal, err := stores.Goals.GetGoal(goal.ID)
+		require.NoError(t, err)
+		assert.Equal(t, float64(math.MaxInt32), storedGoal.CurrentValue)
+	})
+
+	t.Run("records follow the order workouts started in", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+
+		now := time.Now().Truncate(time.Second)
+		squatWorkout := func(daysAgo int, weight float64) *Workout {
+			workout := newTestWorkout(user.ID)
+			workout.StartedAt = now.AddDate(0, 0, -daysAgo)
+			workout.Exercises = []WorkoutExercise{{Name: "Squat", Sets: 1, Reps: intPtr(5), Weight: floatPtr(weight), OrderIndex: 1}}
+			return workout
+		}
+		// the max weight records in the history, by workout
+		maxWeights := func() map[int]PersonalRecord {
+			history, err := stores.PersonalRecords.ListPersonalRecords(user.ID, true)
+			require.NoError(t, err)
+			records := make(map[int]PersonalRecord)
+			for _, record := range history {
+				if record.RecordType == RecordMaxWeight {
+					records[record.WorkoutID] = record
+				}
+			}
+			return records
+		}
+
+		earlier := squatWorkout(2, 100)
+		later := squatWorkout(1, 110)
+		require.NoError(t, stores.Workouts.PersistWorkouts([]*Workout{later, earlier}))
+		records := maxWeights()
+		require.Len(t, records, 2)
+		assert.True(t, records[earlier.ID].AchievedAt.Equal(earlier.StartedAt), "a record is achieved when its workout started")
+		assert.Nil(t, records[earlier.ID].PreviousValue)
+		assert.Equal(t, floatPtr(100), records[later.ID].PreviousValue)
+
+		later.Name = "Heavy Leg Day"
+		require.NoError(t, stores.Workouts.UpdateWorkout(later))
+		assert.Empty(t, later.NewRecords, "a workout changed without beating anything sets no new records")
+		assert.True(t, maxWeights()[later.ID].AchievedAt.Equal(later.StartedAt))
+
+		earlier.Exercises[0].Weight = floatPtr(120)
+		require.NoError(t, stores.Workouts.UpdateWorkout(earlier))
+		records = maxWeights()
+		assert.Len(t, records, 1, "the later workout no longer beats the earlier one")
+		assert.Contains(t, records, earlier.ID)
+
+		earlier.Exercises[0].Weight = floatPtr(105)
+		require.NoError(t, stores.Workouts.UpdateWorkout(earlier))
+		assert.Equal(t, floatPtr(105), maxWeights()[later.ID].PreviousValue)
+
+		require.NoError(t, stores.Workouts.DeleteWorkout(earlier.ID, 0))
+		assert.Nil(t, maxWeights()[later.ID].PreviousValue, "the later workout holds the first record once the earlier one is trashed")
+
+		require.NoError(t, stores.Workouts.RestoreWorkout(earlier.ID))
+		assert.Equal(t, floatPtr(105), maxWeights()[later.ID].PreviousValue)
+
+		earlier, err := stores.Workouts.GetWorkout(earlier.ID)
+		require.NoError(t, err)
+		earlier.StartedAt = now
+		require.NoError(t, stores.Workouts.UpdateWorkout(earlier))
+		records = maxWeights()
+		assert.Nil(t, records[later.ID].PreviousValue, "a workout moved later no longer precedes the ones it started before")
+		assert.NotContains(t, records, earlier.ID)
+
+		earliest := squatWorkout(3, 115)
+		require.NoError(t, stores.Workouts.PersistWorkout(earliest))
+		assert.Len(t, earliest.NewRecords, 4)
+		records = maxWeights()
+		assert.Len(t, records, 1, "a workout logged late takes the records it beat from the workouts after it")
+		assert.Contains(t, records, earliest.ID)
+	})
+
+	t.Run("only completed sets other than warm-ups count", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+
+		workout := newTestWorkout(user.ID)
+		workout.Exercises = []WorkoutExercise{{
+			Name: "Bench Press", Sets: 1, Reps: intPtr(5), Weight: floatPtr(80), OrderIndex: 1,
+			WorkoutSets: []WorkoutSet{
+				{SetType: WorkoutSetWarmup, Reps: intPtr(1), Weight: floatPtr(140), Completed: true},
+				{SetType: WorkoutSetWorking, Reps: intPtr(5), Weight: floatPtr(80), Completed: true},
+				{SetType: WorkoutSetWorking, Reps: intPtr(1), Weight: floatPtr(120)},
+			},
+		}}
+		require.NoError(t, stores.Workouts.PersistWorkout(workout))
+
+		records, err := stores.PersonalRecords.ListPersonalRecords(user.ID, false)
+		require.NoError(t, err)
+		require.Len(t, records, 4)
+		assert.Equal(t, RecordMaxWeight, records[0].RecordType)
+		assert.Equal(t, 80.0, records[0].Value)
+		assert.Equal(t, RecordMaxVolume, records[3].RecordType)
+		assert.Equal(t, 400.0, records[3].Value)
+	})
+}
+
+func testStatsStoreContract(t *testing.T, newStores storesFactory) {
+	t.Run("sum up workouts by bucket, exercise and muscle group", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+		other := createTestUser(t, stores, "bob")
+		require.NoError(t, stores.Workouts.PersistWorkout(newTestWorkout(other.ID)))
+
+		backSquat := newTestExercise(&user.ID, "Back Squat")
+		require.NoError(t, stores.Exercises.CreateExercise(backSquat))
+
+		legDay := newTestWorkout(user.ID)
+		legDay.Exercises[0].ExerciseID = &backSquat.ID
+		benchDay := newTestWorkout(user.ID)
+		benchDay.CaloriesBurned = nil
+		benchDay.Exercises = []WorkoutExercise{{
+			Name: "Bench Press", Sets: 2, Reps: intPtr(5), Weight: floatPtr(80), OrderIndex: 1,
+			WorkoutSets: []WorkoutSet{
+				{SetType: WorkoutSetWarmup, Reps: intPtr(10), Weight: floatPtr(40), Completed: true},
+				{SetType: WorkoutSetWorking, Reps: intPtr(5), Weight: floatPtr(80), Completed: true},
+				{SetType: WorkoutSetWorking, Reps: intPtr(5), Weight: floatPtr(80)},
+			},
+		}}
+		trashed := newTestWorkout(user.ID)
+		require.NoError(t, stores.Workouts.PersistWorkouts([]*Workout{legDay, benchDay, trashed}))
+		require.NoError(t, stores.Workouts.DeleteWorkout(trashed.ID, 0))
+
+		today := truncateToBucket(time.Now(), StatsBucketDay)
+		stats, err := stores.Stats.GetTrainingStats(user.ID, StatsQuery{From: today, To: today.AddDate(0, 0, 1), Bucket: StatsBucketDay})
+		require.NoError(t, err)
+
+		assert.Equal(t, today.Format(time.DateOnly), stats.From)
+		assert.Equal(t, today.Format(time.DateOnly), stats.To)
+		assert.Equal(t, StatsTotals{Workouts: 2, DurationMinutes: 120, CaloriesBurned: 400, VolumeLoad: 2912.5}, stats.Totals)
+		assert.Equal(t, []StatsBucket{{Start: today.Format(time.DateOnly), StatsTotals: stats.Totals}}, stats.Buckets)
+		assert.Equal(t, []ExerciseStats{
+			{ExerciseID: &backSquat.ID, Name: "Back Squat", Workouts: 1, Sets: 5, Reps: 25, VolumeLoad: 2512.5},
+			{Name: "Bench Press", Workouts: 1, Sets: 1, Reps: 5, VolumeLoad: 400},
+			{Name: "Plank", Workouts: 1, Sets: 3},
+		}, stats.Exercises)
+		assert.Equal(t, []MuscleGroupStats{
+			{MuscleGroup: "glutes", Sets: 5, VolumeLoad: 2512.5},
+			{MuscleGroup: "quadriceps", Sets: 5, VolumeLoad: 2512.5},
+		}, stats.MuscleGroups)
+		assert.Equal(t, TrainingFrequency{ActiveDays: 1, WorkoutsPerWeek: 14}, stats.Frequency)
+	})
+
+	t.Run("exercise progress by session", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+		other := createTestUser(t, stores, "bob")
+		require.NoError(t, stores.Workouts.PersistWorkout(newTestWorkout(other.ID)))
+
+		legDay := newTestWorkout(user.ID)
+		heavyDay := newTestWorkout(user.ID)
+		heavyDay.Exercises = []WorkoutExercise{{
+			Name: "squat", Sets: 1, Reps: intPtr(3), Weight: floatPtr(110), OrderIndex: 1,
+			WorkoutSets: []WorkoutSet{
+				{SetType: WorkoutSetWarmup, Reps: intPtr(5), Weight: floatPtr(60), Completed: true},
+				{SetType: WorkoutSetWorking, Reps: intPtr(3), Weight: floatPtr(110), Completed: true},
+				{SetType: WorkoutSetWorking, Reps: intPtr(1), Weight: floatPtr(120)},
+			},
+		}}
+		trashed := newTestWorkout(user.ID)
+		require.NoError(t, stores.Workouts.PersistWorkouts([]*Workout{legDay, heavyDay, trashed}))
+		require.NoError(t, stores.Workouts.DeleteWorkout(trashed.ID, 0))
+
+		points, err := stores.Stats.GetExerciseProgress(user.ID, " SQUAT", OneRepMaxEpley)
+		require.NoError(t, err)
+		require.Len(t, points, 2)
+		assert.Equal(t, legDay.ID, points[0].WorkoutID)
+		assert.Equal(t, legDay.StartedAt.UTC().Format(time.DateOnly), points[0].Date)
+		assert.Equal(t, TopSet{Weight: floatPtr(100.5), Reps: intPtr(5)}, points[0].TopSet)
+		assert.Equal(t, floatPtr(117.25), points[0].Estimated1RM)
+		assert.Equal(t, 2512.5, points[0].VolumeLoad)
+		assert.Equal(t, heavyDay.ID, points[1].WorkoutID)
+		assert.Equal(t, TopSet{Weight: floatPtr(110), Reps: intPtr(3)}, points[1].TopSet, "warm-ups and sets not completed do not count")
+		assert.Equal(t, floatPtr(121), points[1].Estimated1RM)
+		assert.Equal(t, 330.0, points[1].VolumeLoad)
+
+		points, err = stores.Stats.GetExerciseProgress(user.ID, "squat", OneRepMaxBrzycki)
+		require.NoError(t, err)
+		require.Len(t, points, 2)
+		assert.Equal(t, floatPtr(113.06), points[0].Estimated1RM)
+		assert.Equal(t, floatPtr(116.47), points[1].Estimated1RM)
+
+		points, err = stores.Stats.GetExerciseProgress(user.ID, "plank", OneRepMaxEpley)
+		require.NoError(t, err)
+		require.Len(t, points, 1)
+		assert.Equal(t, TopSet{DurationSeconds: intPtr(60)}, points[0].TopSet)
+		assert.Nil(t, points[0].Estimated1RM)
+
+		points, err = stores.Stats.GetExerciseProgress(user.ID, "deadlift", OneRepMaxEpley)
+		require.NoError(t, err)
+		assert.Empty(t, points)
+	})
+
+	t.Run("workouts by the day they started on in a time zone", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+
+		newYork, err := time.LoadLocation("America/New_York")
+		require.NoError(t, err)
+
+		// a Sunday evening and a Monday morning in New York, both on Monday in UTC
+		sunday := newTestWorkout(user.ID)
+		sunday.StartedAt = time.Date(2024, time.March, 4, 1, 0, 0, 0, time.UTC)
+		monday := newTestWorkout(user.ID)
+		monday.StartedAt = time.Date(2024, time.March, 4, 15, 0, 0, 0, time.UTC)
+		require.NoError(t, stores.Workouts.PersistWorkouts([]*Workout{sunday, monday}))
+
+		from := time.Date(2024, time.March, 3, 0, 0, 0, 0, newYork)
+		stats, err := stores.Stats.GetTrainingStats(user.ID, StatsQuery{From: from, To: from.AddDate(0, 0, 2), Bucket: StatsBucketWeek, TimeZone: "America/New_York"})
+		require.NoError(t, err)
+		assert.Equal(t, "2024-03-03", stats.From)
+		assert.Equal(t, "2024-03-04", stats.To)
+		require.Len(t, stats.Buckets, 2)
+		assert.Equal(t, "2024-02-26", stats.Buckets[0].Start)
+		assert.Equal(t, 1, stats.Buckets[0].Workouts)
+		assert.Equal(t, "2024-03-04", stats.Buckets[1].Start)
+		assert.Equal(t, 1, stats.Buckets[1].Workouts)
+		assert.Equal(t, 2, stats.Frequency.ActiveDays)
+
+		utc := time.Date(2024, time.March, 4, 0, 0, 0, 0, time.UTC)
+		stats, err = stores.Stats.GetTrainingStats(user.ID, StatsQuery{From: utc, To: utc.AddDate(0, 0, 1), Bucket: StatsBucketDay})
+		require.NoError(t, err)
+		assert.Equal(t, 2, stats.Totals.Workouts)
+		assert.Equal(t, 1, stats.Frequency.ActiveDays)
+
+		user.TimeZone = "America/New_York"
+		require.NoError(t, stores.Users.UpdateUser(user))
+		points, err := stores.Stats.GetExerciseProgress(user.ID, "squat", OneRepMaxEpley)
+		require.NoError(t, err)
+		require.Len(t, points, 2)
+		assert.Equal(t, "2024-03-03", points[0].Date)
+		assert.Equal(t, "2024-03-04", points[1].Date)
+	})
+
+	t.Run("every bucket of the window is listed", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+		require.NoError(t, stores.Workouts.PersistWorkout(newTestWorkout(user.ID)))
+
+		today := truncateToBucket(time.Now(), StatsBucketDay)
+		stats, err := stores.Stats.GetTrainingStats(user.ID, StatsQuery{From: today.AddDate(0, 0, -20), To: today.AddDate(0, 0, 1), Bucket: StatsBucketWeek})
+		require.NoError(t, err)
+
+		require.GreaterOrEqual(t, len(stats.Buckets), 3)
+		for _, bucket := range stats.Buckets {
+			start, err := time.Parse(time.DateOnly, bucket.Start)
+			require.NoError(t, err)
+			assert.Equal(t, time.Monday, start.Weekday())
+		}
+		last := stats.Buckets[len(stats.Buckets)-1]
+		assert.Equal(t, 1, last.Workouts)
+		assert.Equal(t, 1, stats.Totals.Workouts)
+
+		from := time.Date(2020, time.January, 15, 0, 0, 0, 0, time.UTC)
+		stats, err = stores.Stats.GetTrainingStats(user.ID, StatsQuery{From: from, To: from.AddDate(0, 2, 0), Bucket: StatsBucketMonth})
+		require.NoError(t, err)
+		assert.Len(t, stats.Buckets, 3, "the months the window starts and ends in are included")
+		assert.Zero(t, stats.Totals)
+		assert.Equal(t, []ExerciseStats{}, stats.Exercises)
+	})
+}
+
+func testMeasurementStoreContract(t *testing.T, newStores storesFactory) {
+	t.Run("create, get, update and delete", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+
+		measurement := &BodyMeasurement{
+			UserID:         user.ID,
+			MeasuredOn:     "2024-03-01",
+			WeightKg:       floatPtr(80.5),
+			Circumferences: Circumferences{WaistCm: floatPtr(85)},
+			Notes:          "morning",
+		}
+		require.NoError(t, stores.Measurements.CreateMeasurement(measurement))
+		assert.NotZero(t, measurement.ID)
+		assert.False(t, measurement.CreatedAt.IsZero())
+
+		storedMeasurement, err := stores.Measurements.GetMeasurement(measurement.ID)
+		require.NoError(t, err)
+		require.NotNil(t, storedMeasurement)
+		assert.Equal(t, "2024-03-01", storedMeasurement.MeasuredOn)
+		assert.Equal(t, 80.5, *storedMeasurement.WeightKg)
+		assert.Nil(t, storedMeasurement.BodyFatPercent)
+		assert.Equal(t, float64(85), *storedMeasurement.Circumferences.WaistCm)
+		assert.Equal(t, "morning", storedMeasurement.Notes)
+
+		measurement.WeightKg = nil
+		measurement.BodyFatPercent = floatPtr(18.5)
+		require.NoError(t, stores.Measurements.UpdateMeasurement(measurement))
+		assert.Equal(t, user.ID, measurement.UserID)
+
+		storedMeasurement, err = stores.Measurements.GetMeasurement(measurement.ID)
+		require.NoError(t, err)
+		require.NotNil(t, storedMeasurement)
+		assert.Nil(t, storedMeasurement.WeightKg)
+		assert.Equal(t, 18.5, *storedMeasurement.BodyFatPercent)
+
+		require.NoError(t, stores.Measurements.DeleteMeasurement(measurement.ID))
+		storedMeasurement, err = stores.Measurements.GetMeasurement(measurement.ID)
+		require.NoError(t, err)
+		assert.Nil(t, storedMeasurement)
+
+		assert.ErrorIs(t, stores.Measurements.DeleteMeasurement(measurement.ID), sql.ErrNoRows)
+		assert.ErrorIs(t, stores.Measurements.UpdateMeasurement(measurement), sql.ErrNoRows)
+	})
+
+	t.Run("constraints", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+
+		assert.Error(t, stores.Measurements.CreateMeasurement(&BodyMeasurement{UserID: user.ID, MeasuredOn: "2024-03-01"}),
+			"a measurement has a value")
+		assert.Error(t, stores.Measurements.CreateMeasurement(&BodyMeasurement{UserID: user.ID, MeasuredOn: "2024-03-01", BodyFatPercent: floatPtr(100)}))
+		assert.Error(t, stores.Measurements.CreateMeasurement(&BodyMeasurement{
+			UserID: user.ID, MeasuredOn: "2024-03-01", Circumferences: Circumferences{ArmCm: floatPtr(-1)},
+		}))
+		assert.Error(t, stores.Measurements.CreateMeasurement(&BodyMeasurement{UserID: user.ID + 1000, MeasuredOn: "2024-03-01", WeightKg: floatPtr(80)}))
+	})
+
+	t.Run("list and latest values", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+		otherUser := createTestUser(t, stores, "bob")
+
+		for _, measurement := range []*BodyMeasurement{
+			{UserID: user.ID, MeasuredOn: "2024-03-01", WeightKg: floatPtr(82), BodyFatPercent: floatPtr(20)},
+			{UserID: user.ID, MeasuredOn: "2024-03-15", WeightKg: floatPtr(81)},
+			{UserID: user.ID, MeasuredOn: "2024-04-01", Circumferences: Circumferences{WaistCm: floatPtr(84)}},
+			{UserID: otherUser.ID, MeasuredOn: "2024-03-20", WeightKg: floatPtr(60)},
+		} {
+			require.NoError(t, stores.Measurements.CreateMeasurement(measurement))
+		}
+
+		measurements, err := stores.Measurements.ListMeasurements(user.ID, "", "")
+		require.NoError(t, err)
+		require.Len(t, measurements, 3)
+		assert.Equal(t, "2024-04-01", measurements[0].MeasuredOn, "most recent first")
+
+		measurements, err = stores.Measurements.ListMeasurements(user.ID, "2024-03-15", "2024-03-31")
+		require.NoError(t, err)
+		require.Len(t, measurements, 1)
+		assert.Equal(t, float64(81), *measurements[0].WeightKg)
+
+		latest, err := stores.Measurements.GetLatestMeasurements(user.ID, "")
+		require.NoError(t, err)
+		assert.Len(t, latest, 3)
+		assert.Equal(t, MeasuredValue{Value: 81, MeasuredOn: "2024-03-15", MeasurementID: measurements[0].ID}, latest["weight"])
+		assert.Equal(t, float64(20), latest["body_fat_percent"].Value)
+		assert.Equal(t, "2024-04-01", latest["waist"].MeasuredOn)
+
+		latest, err = stores.Measurements.GetLatestMeasurements(user.ID, "2024-03-10")
+		require.NoError(t, err)
+		assert.Len(t, latest, 2)
+		assert.Equal(t, float64(82), latest["weight"].Value)
+
+		latest, err = stores.Measurements.GetLatestMeasurements(user.ID+1000, "")
+		require.NoError(t, err)
+		assert.Empty(t, latest)
+	})
+
+	t.Run("measurements are deleted with the user", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+
+		measurement := &BodyMeasurement{UserID: user.ID, MeasuredOn: "2024-03-01", WeightKg: floatPtr(80)}
+		require.NoError(t, stores.Measurements.CreateMeasurement(measurement))
+		require.NoError(t, stores.Users.DeleteUser(user.ID))
+
+		storedMeasurement, err := stores.Measurements.GetMeasurement(measurement.ID)
+		require.NoError(t, err)
+		assert.Nil(t, storedMeasurement)
+	})
+}
+
+func testGoalStoreContract(t *testing.T, newStores storesFactory) {
+	today := time.Now().UTC().Format(time.DateOnly)
+	inAWeek := time.Now().UTC().AddDate(0, 0, 6).Format(time.DateOnly)
+	endOfJanuary, newYear := "2024-01-31", "2024-01-01"
+
+	t.Run("create, get, list, update and delete", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+
+		goal := &Goal{UserID: user.ID, Kind: GoalExerciseWeight, ExerciseName: "Squat", Target: 110, Deadline: &inAWeek}
+		require.NoError(t, stores.Goals.CreateGoal(goal))
+		assert.NotZero(t, goal.ID)
+		assert.Equal(t, today, goal.StartsOn)
+		assert.Equal(t, GoalInProgress, goal.Status)
+		assert.False(t, goal.CreatedAt.IsZero())
+
+		otherGoal := &Goal{UserID: user.ID, Kind: GoalCalories, Target: 1000}
+		require.NoError(t, stores.Goals.CreateGoal(otherGoal))
+
+		require.NoError(t, stores.Workouts.PersistWorkout(newTestWorkout(user.ID)))
+
+		storedGoal, err := stores.Goals.GetGoal(goal.ID)
+		require.NoError(t, err)
+		require.NotNil(t, storedGoal)
+		assert.Equal(t, 100.5, storedGoal.CurrentValue)
+		assert.Equal(t, 91.4, storedGoal.PercentComplete)
+		assert.Nil(t, storedGoal.AchievedAt)
+
+		goals, err := stores.Goals.ListGoals(user.ID)
+		require.NoError(t, err)
+		require.Len(t, goals, 2)
+		assert.Equal(t, goal.ID, goals[0].ID, "the goals without a deadline come last")
+		assert.Equal(t, float64(400), goals[1].CurrentValue)
+		assert.Equal(t, 40.0, goals[1].PercentComplete)
+
+		goal.Target = 100
+		require.NoError(t, stores.Goals.UpdateGoal(goal))
+		assert.Equal(t, GoalAchieved, goal.Status)
+		assert.Equal(t, 100.0, goal.PercentComplete)
+		assert.NotNil(t, goal.AchievedAt)
+
+		require.NoError(t, stores.Goals.DeleteGoal(goal.ID))
+		storedGoal, err = stores.Goals.GetGoal(goal.ID)
+		require.NoError(t, err)
+		assert.Nil(t, storedGoal)
+
+		assert.ErrorIs(t, stores.Goals.DeleteGoal(goal.ID), sql.ErrNoRows)
+		assert.ErrorIs(t, stores.Goals.UpdateGoal(goal), sql.ErrNoRows)
+	})
+
+	t.Run("dates in the time zone of the user", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+		user.TimeZone = "Pacific/Kiritimati"
+		require.NoError(t, stores.Users.UpdateUser(user))
+
+		// always today or tomorrow in UTC
+		localToday := localDay(time.Now(), user.TimeZone)
+		goal := &Goal{UserID: user.ID, Kind: GoalCalories, Target: 1000}
+		require.NoError(t, stores.Goals.CreateGoal(goal))
+		assert.Equal(t, localToday, goal.StartsOn)
+
+		todayDate, err := time.Parse(time.DateOnly, localToday)
+		require.NoError(t, err)
+		yesterday := todayDate.AddDate(0, 0, -1).Format(time.DateOnly)
+		missed := &Goal{UserID: user.ID, Kind: GoalCalories, Target: 1000, StartsOn: yesterday, Deadline: &yesterday}
+		require.NoError(t, stores.Goals.CreateGoal(missed))
+		assert.Equal(t, GoalMissed, missed.Status)
+
+		// the evening of the deadline in New York is the next day in UTC
+		user.TimeZone = "America/New_York"
+		require.NoError(t, stores.Users.UpdateUser(user))
+		deadline := "2024-03-04"
+		squat := &Goal{UserID: user.ID, Kind: GoalExerciseWeight, ExerciseName: "Squat", Target: 200, StartsOn: "2024-03-01", Deadline: &deadline}
+		require.NoError(t, stores.Goals.CreateGoal(squat))
+
+		evening := newTestWorkout(user.ID)
+		evening.StartedAt = time.Date(2024, time.March, 5, 3, 0, 0, 0, time.UTC)
+		nextMorning := newTestWorkout(user.ID)
+		nextMorning.StartedAt = time.Date(2024, time.March, 5, 12, 0, 0, 0, time.UTC)
+		nextMorning.Exercises[0].Weight = floatPtr(150)
+		require.NoError(t, stores.Workouts.PersistWorkouts([]*Workout{evening, nextMorning}))
+
+		storedGoal, err := stores.Goals.GetGoal(squat.ID)
+		require.NoError(t, err)
+		require.NotNil(t, storedGoal)
+		assert.Equal(t, 100.5, storedGoal.CurrentValue, "the workout of the next morning is past the deadline")
+	})
+
+	t.Run("workouts are evaluated as they change", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+
+		frequency := &Goal{UserID: user.ID, Kind: GoalFrequency, Target: 2, Deadline: &inAWeek}
+		reps := &Goal{UserID: user.ID, Kind: GoalExerciseReps, ExerciseName: "squat", Weight: floatPtr(100), Target: 8}
+		missed := &Goal{UserID: user.ID, Kind: GoalTotalDuration, Target: 60, StartsOn: "2024-01-01", Deadline: &endOfJanuary}
+		for _, goal := range []*Goal{frequency, reps, missed} {
+			require.NoError(t, stores.Goals.CreateGoal(goal))
+		}
+		assert.Equal(t, GoalMissed, missed.Status)
+
+		workout := newTestWorkout(user.ID)
+		require.NoError(t, stores.Workouts.PersistWorkout(workout))
+		require.NoError(t, stores.Workouts.PersistWorkout(newTestWorkout(user.ID)))
+
+		storedGoal, err := stores.Goals.GetGoal(frequency.ID)
+		require.NoError(t, err)
+		assert.Equal(t, GoalAchieved, storedGoal.Status)
+
+		storedGoal, err = stores.Goals.GetGoal(reps.ID)
+		require.NoError(t, err)
+		assert.Equal(t, float64(5), storedGoal.CurrentValue)
+		assert.Equal(t, 62.5, storedGoal.PercentComplete)
+
+		for i := range workout.Exercises {
+			if workout.Exercises[i].Name == "Squat" {
+				workout.Exercises[i].Reps = intPtr(8)
+			}
+		}
+		require.NoError(t, stores.Workouts.UpdateWorkout(workout))
+		storedGoal, err = stores.Goals.GetGoal(reps.ID)
+		require.NoError(t, err)
+		assert.Equal(t, GoalAchieved, storedGoal.Status)
+
+		require.NoError(t, stores.Workouts.DeleteWorkout(workout.ID, 0))
+		for _, goal := range []*Goal{frequency, reps} {
+			storedGoal, err = stores.Goals.GetGoal(goal.ID)
+			require.NoError(t, err)
+			assert.Equal(t, GoalInProgress, storedGoal.Status, "a goal is not achieved by a workout in the trash")
+		}
+
+		require.NoError(t, stores.Workouts.RestoreWorkout(workout.ID))
+		storedGoal, err = stores.Goals.GetGoal(frequency.ID)
+		require.NoError(t, err)
+		assert.Equal(t, GoalAchieved, storedGoal.Status)
+
+		storedGoal, err = stores.Goals.GetGoal(missed.ID)
+		require.NoError(t, err)
+		assert.Equal(t, float64(0), storedGoal.CurrentValue, "workouts before starts_on do not count")
+	})
+
+	t.Run("body weight", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+
+		goal := &Goal{UserID: user.ID, Kind: GoalBodyWeight, Target: 75, StartValue: floatPtr(80)}
+		require.NoError(t, stores.Goals.CreateGoal(goal))
+		assert.Equal(t, float64(80), goal.CurrentValue, "without a body weight, the goal is where it started")
+
+		user.BodyWeightKg = floatPtr(79)
+		require.NoError(t, stores.Users.UpdateUser(user))
+
+		storedGoal, err := stores.Goals.GetGoal(goal.ID)
+		require.NoError(t, err)
+		assert.Equal(t, float64(79), storedGoal.CurrentValue)
+		assert.Equal(t, 20.0, storedGoal.PercentComplete)
+
+		measurement := &BodyMeasurement{UserID: user.ID, MeasuredOn: today, WeightKg: floatPtr(74.5)}
+		require.NoError(t, stores.Measurements.CreateMeasurement(measurement))
+
+		storedGoal, err = stores.Goals.GetGoal(goal.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 74.5, storedGoal.CurrentValue)
+		assert.Equal(t, GoalAchieved, storedGoal.Status)
+
+		require.NoError(t, stores.Measurements.DeleteMeasurement(measurement.ID))
+		storedGoal, err = stores.Goals.GetGoal(goal.ID)
+		require.NoError(t, err)
+		assert.Equal(t, float64(79), storedGoal.CurrentValue)
+		assert.Equal(t, GoalInProgress, storedGoal.Status)
+	})
+
+	t.Run("constraints", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+
+		for _, goal := range []*Goal{
+			{UserID: user.ID, Kind: "streak", Target: 1},
+			{UserID: user.ID, Kind: GoalCalories, Target: 0},
+			{UserID: user.ID, Kind: GoalExerciseWeight, Target: 100},
+			{UserID: user.ID, Kind: GoalFrequency, Target: 2},
+			{UserID: user.ID, Kind: GoalBodyWeight, Target: 75},
+			{UserID: user.ID, Kind: GoalCalories, Target: 800, StartsOn: "2024-02-01", Deadline: &newYear},
+			{UserID: user.ID + 1000, Kind: GoalCalories, Target: 800},
+		} {
+			assert.Error(t, stores.Goals.CreateGoal(goal), "%+v", goal)
+		}
+	})
+
+	t.Run("goals are deleted with the user and unlinked from exercises", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+
+		exercise := newTestExercise(&user.ID, "Zercher Squat")
+		require.NoError(t, stores.Exercises.CreateExercise(exercise))
+
+		goal := &Goal{UserID: user.ID, Kind: GoalExerciseWeight, ExerciseID: &exercise.ID, ExerciseName: exercise.Name, Target: 100}
+		require.NoError(t, stores.Goals.CreateGoal(goal))
+
+		require.NoError(t, stores.Exercises.DeleteExercise(exercise.ID))
+		storedGoal, err := stores.Goals.GetGoal(goal.ID)
+		require.NoError(t, err)
+		assert.Nil(t, storedGoal.ExerciseID)
+		assert.Equal(t, "Zercher Squat", storedGoal.ExerciseName)
+
+		require.NoError(t, stores.Users.DeleteUser(user.ID))
+		storedGoal, err = stores.Goals.GetGoal(goal.ID)
+		require.NoError(t, err)
+		assert.Nil(t, storedGoal)
+	})
+}
+
+func testStreakStoreContract(t *testing.T, newStores storesFactory) {
+	t.Run("maintained as workouts come and go", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+		assert.Equal(t, "UTC", user.TimeZone)
+
+		streaks, err := stores.Streaks.GetStreaks(user.ID)
+		require.NoError(t, err)
+		require.NotNil(t, streaks)
+		assert.Nil(t, streaks.LastWorkoutOn)
+		assert.Equal(t, time.Now().UTC().Format(time.DateOnly), streaks.Today)
+
+		first := newTestWorkout(user.ID)
+		second := newTestWorkout(user.ID)
+		require.NoError(t, stores.Workouts.PersistWorkouts([]*Workout{first, second}))
+
+		streaks, err = stores.Streaks.GetStreaks(user.ID)
+		require.NoError(t, err)
+		require.NotNil(t, streaks.LastWorkoutOn)
+		assert.Equal(t, streaks.Today, *streaks.LastWorkoutOn)
+		assert.Equal(t, Streak{Current: 1, Longest: 1}, streaks.Daily)
+		assert.Equal(t, Streak{Current: 1, Longest: 1}, streaks.Weekly)
+
+		require.NoError(t, stores.Workouts.DeleteWorkout(first.ID, 0))
+		streaks, err = stores.Streaks.GetStreaks(user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 1, streaks.Daily.Current, "the day still has a workout")
+
+		require.NoError(t, stores.Workouts.DeleteWorkout(second.ID, 0))
+		streaks, err = stores.Streaks.GetStreaks(user.ID)
+		require.NoError(t, err)
+		assert.Nil(t, streaks.LastWorkoutOn)
+		assert.Equal(t, Streak{}, streaks.Daily)
+
+		require.NoError(t, stores.Workouts.RestoreWorkout(second.ID))
+		streaks, err = stores.Streaks.GetStreaks(user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, Streak{Current: 1, Longest: 1}, streaks.Daily)
+	})
+
+	t.Run("backdated and moved workouts", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+
+		monday := time.Date(2024, time.March, 4, 18, 0, 0, 0, time.UTC)
+		var workouts []*Workout
+		for _, day := range []int{0, 1, 3} {
+			workout := newTestWorkout(user.ID)
+			workout.StartedAt = monday.AddDate(0, 0, day)
+			workouts = append(workouts, workout)
+		}
+		require.NoError(t, stores.Workouts.PersistWorkouts(workouts))
+
+		streaks, err := stores.Streaks.GetStreaks(user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "2024-03-07", *streaks.LastWorkoutOn)
+		assert.Equal(t, Streak{Longest: 2}, streaks.Daily)
+		assert.Equal(t, Streak{Longest: 1}, streaks.Weekly)
+
+		// a workout moved to the day off joins the two runs
+		workouts[2].StartedAt = monday.AddDate(0, 0, 2)
+		require.NoError(t, stores.Workouts.UpdateWorkout(workouts[2]))
+		streaks, err = stores.Streaks.GetStreaks(user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "2024-03-06", *streaks.LastWorkoutOn)
+		assert.Equal(t, 3, streaks.Daily.Longest)
+
+		// the new days of a batch extend the runs in order, whatever the order of the batch
+		saturday := newTestWorkout(user.ID)
+		saturday.StartedAt = monday.AddDate(0, 0, 5)
+		friday := newTestWorkout(user.ID)
+		friday.StartedAt = monday.AddDate(0, 0, 4)
+		thursday := newTestWorkout(user.ID)
+		thursday.StartedAt = monday.AddDate(0, 0, 3)
+		require.NoError(t, stores.Workouts.PersistWorkouts([]*Workout{saturday, friday, thursday, newTestWorkout(user.ID)}))
+		streaks, err = stores.Streaks.GetStreaks(user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 6, streaks.Daily.Longest)
+	})
+
+	t.Run("time zone and rest days of the user", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+		require.NoError(t, stores.Workouts.PersistWorkout(newTestWorkout(user.ID)))
+
+		user.TimeZone = "Pacific/Kiritimati"
+		user.StreakRestDays = 2
+		require.NoError(t, stores.Users.UpdateUser(user))
+
+		storedUser, err := stores.Users.GetUserByIdOrUsername(user.ID, "")
+		require.NoError(t, err)
+		assert.Equal(t, "Pacific/Kiritimati", storedUser.TimeZone)
+		assert.Equal(t, 2, storedUser.StreakRestDays)
+
+		kiritimati, err := time.LoadLocation("Pacific/Kiritimati")
+		require.NoError(t, err)
+		streaks, err := stores.Streaks.GetStreaks(user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "Pacific/Kiritimati", streaks.TimeZone)
+		assert.Equal(t, 2, streaks.RestDays)
+		assert.Equal(t, time.Now().In(kiritimati).Format(time.DateOnly), streaks.Today)
+		require.NotNil(t, streaks.LastWorkoutOn)
+		assert.Equal(t, streaks.Today, *streaks.LastWorkoutOn, "the days are counted again in the new zone")
+
+		user.StreakRestDays = MaxStreakRestDays + 1
+		assert.Error(t, stores.Users.UpdateUser(user), "rest days are bounded")
+	})
+
+	t.Run("unknown user", func(t *testing.T) {
+		stores := newStores(t)
+
+		streaks, err := stores.Streaks.GetStreaks(1000)
+		require.NoError(t, err)
+		assert.Nil(t, streaks)
+	})
+}
+
+func testExportStoreContract(t *testing.T, newStores storesFactory) {
+	t.Run("create, finish and get", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+
+		export := &Export{UserID: user.ID}
+		require.NoError(t, stores.Exports.CreateExport(export))
+		assert.NotZero(t, export.ID)
+		assert.Equal(t, ExportPending, export.Status)
+		assert.Nil(t, export.CompletedAt)
+		assert.Nil(t, export.ExpiresAt)
+
+		size := int64(2048)
+		expiresAt := time.Now().Add(time.Hour).Truncate(time.Microsecond)
+		export.Status = ExportReady
+		export.SizeBytes = &size
+		export.ExpiresAt = &expiresAt
+		require.NoError(t, stores.Exports.FinishExport(export))
+		assert.NotNil(t, export.CompletedAt)
+
+		storedExport, err := stores.Exports.GetExport(export.ID)
+		require.NoError(t, err)
+		require.NotNil(t, storedExport)
+		assert.Equal(t, user.ID, storedExport.UserID)
+		assert.Equal(t, ExportReady, storedExport.Status)
+		assert.Equal(t, &size, storedExport.SizeBytes)
+		require.NotNil(t, storedExport.ExpiresAt)
+		assert.True(t, expiresAt.Equal(*storedExport.ExpiresAt))
+
+		storedExport.Status = "lost"
+		assert.Error(t, stores.Exports.FinishExport(storedExport))
+	})
+
+	t.Run("unknown rows", func(t *testing.T) {
+		stores := newStores(t)
+
+		export, err := stores.Exports.GetExport(1)
+		require.NoError(t, err)
+		assert.Nil(t, export)
+
+		assert.ErrorIs(t, stores.Exports.FinishExport(&Export{ID: 1, Status: ExportFailed}), sql.ErrNoRows)
+		assert.Error(t, stores.Exports.CreateExport(&Export{UserID: 1}), "the user does not exist")
+	})
+
+	t.Run("delete expired and interrupted exports", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+
+		var exports []*Export
+		for range 3 {
+			export := &Export{UserID: user.ID}
+			require.NoError(t, stores.Exports.CreateExport(export))
+			exports = append(exports, export)
+		}
+		expiresAt := time.Now().Add(time.Hour)
+		exports[0].Status = ExportReady
+		exports[0].ExpiresAt = &expiresAt
+		require.NoError(t, stores.Exports.FinishExport(exports[0]))
+		exports[1].Status = ExportFailed
+		exports[1].ExpiresAt = &expiresAt
+		require.NoError(t, stores.Exports.FinishExport(exports[1]))
+
+		deleted, err := stores.Exports.DeleteExpiredExports(time.Now(), time.Now().Add(-time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, 0, deleted)
+
+		deleted, err = stores.Exports.DeleteExpiredExports(expiresAt.Add(time.Second), time.Now().Add(-time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, 2, deleted)
+
+		deleted, err = stores.Exports.DeleteExpiredExports(time.Now(), time.Now().Add(time.Second))
+		require.NoError(t, err)
+		assert.Equal(t, 1, deleted, "the pending export was interrupted")
+
+		export, err := stores.Exports.GetExport(exports[2].ID)
+		require.NoError(t, err)
+		assert.Nil(t, export)
+	})
+
+	t.Run("current export of a user", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+		other := createTestUser(t, stores, "bob")
+
+		hourAgo := time.Now().Add(-time.Hour)
+		export, err := stores.Exports.GetCurrentExport(user.ID, hourAgo)
+		require.NoError(t, err)
+		assert.Nil(t, export)
+
+		ready := &Export{UserID: user.ID}
+		require.NoError(t, stores.Exports.CreateExport(ready))
+		expiresAt := time.Now().Add(time.Hour)
+		ready.Status = ExportReady
+		ready.ExpiresAt = &expiresAt
+		require.NoError(t, stores.Exports.FinishExport(ready))
+		require.NoError(t, stores.Exports.CreateExport(&Export{UserID: other.ID}))
+
+		export, err = stores.Exports.GetCurrentExport(user.ID, hourAgo)
+		require.NoError(t, err)
+		require.NotNil(t, export)
+		assert.Equal(t, ready.ID, export.ID)
+
+		pending := &Export{UserID: user.ID}
+		require.NoError(t, stores.Exports.CreateExport(pending))
+		export, err = stores.Exports.GetCurrentExport(user.ID, hourAgo)
+		require.NoError(t, err)
+		require.NotNil(t, export)
+		assert.Equal(t, pending.ID, export.ID, "the latest one")
+
+		pending.Status = ExportFailed
+		pending.ExpiresAt = &expiresAt
+		require.NoError(t, stores.Exports.FinishExport(pending))
+		export, err = stores.Exports.GetCurrentExport(user.ID, hourAgo)
+		require.NoError(t, err)
+		require.NotNil(t, export)
+		assert.Equal(t, ready.ID, export.ID, "failed exports are not current")
+
+		export, err = stores.Exports.GetCurrentExport(user.ID, time.Now().Add(time.Second))
+		require.NoError(t, err)
+		assert.Nil(t, export, "the exports are too old")
+	})
+
+	t.Run("deleted with their user", func(t *testing.T) {
+		stores := newStores(t)
+		user := createTestUser(t, stores, "alice")
+
+		export := &Export{UserID: user.ID}
+		require.NoError(t, stores.Exports.CreateExport(export))
+		require.NoError(t, stores.Users.DeleteUser(user.ID))
+
+		storedExport, err := stores.Exports.GetExport(export.ID)
+		require.NoError(t, err)
+		assert.Nil(t, storedExport)
+	})
+}
+
+// markLegacyWeights marks the weights a user recorded so far as recorded
+// before weights had units, like the migration that added them did.
+func markLegacyWeights(t *testing.T, stores *Stores, userID int) {
+	t.Helper()
+
+	switch users := stores.Users.(type) {
+	case *PostgresUserStore:
+		for _, query := range []string{
+			`UPDATE users SET legacy_weights_before = CURRENT_TIMESTAMP WHERE id = $1`,
+			`UPDATE workout_exercises we
+			SET legacy_weight = TRUE
+			FROM workouts w
+			WHERE w.id = we.workout_id AND w.user_id = $1 AND (
+				we.weight IS NOT NULL OR EXISTS (SELECT 1 FROM workout_sets ws WHERE ws.workout_exercise_id = we.id AND ws.weight IS NOT NULL)
+			)`,
+			`UPDATE workout_template_exercises te
+			SET legacy_weight = TRUE
+			FROM workout_templates t
+			WHERE t.id = te.template_id AND t.user_id = $1 AND te.weight IS NOT NULL`,
+			`UPDATE workout_revisions r
+			SET legacy_exercise_ids = ARRAY(SELECT (e->>'id')::int FROM jsonb_array_elements(r.snapshot->'exercises') e)
+			WHERE r.user_id = $1 AND jsonb_typeof(r.snapshot->'exercises') = 'array'`,
+		} {
+			_, err := users.db.Exec(query, userID)
+			require.NoError(t, err)
+		}
+	case *InMemoryUserStore:
+		unlock := users.db.lock()
+		defer unlock()
+		before := time.Now().Add(time.Millisecond)
+		users.db.users[userID].LegacyWeightsBefore = &before
+
+		for _, workout := range users.db.workouts {
+			for _, exercise := range workout.Exercises {
+				setWeights := slices.ContainsFunc(exercise.WorkoutSets, func(set WorkoutSet) bool { return set.Weight != nil })
+				if workout.UserID == userID && (exercise.Weight != nil || setWeights) {
+					users.db.legacyWorkoutExercises[exercise.ID] = true
+				}
+			}
+		}
+		for _, template := range users.db.templates {
+			for _, exercise := range template.Exercises {
+				if template.UserID == userID && exercise.Weight != nil {
+					users.db.legacyTemplateExercises[exercise.ID] = true
+				}
+			}
+		}
+		for _, revisions := range users.db.workoutRevisions {
+			for i, revision := range revisions {
+				var snapshot Workout
+				require.NoError(t, json.Unmarshal(revision.Snapshot, &snapshot))
+				if revision.UserID != userID {
+					continue
+				}
+
+				revisions[i] = copyWorkoutRevision(revision)
+				for _, exercise := range snapshot.Exercises {
+					revisions[i].legacyExerciseIDs = append(revisions[i].legacyExerciseIDs, exercise.ID)
+				}
+			}
+		}
+	default:
+		t.Fatalf("cannot mark the legacy weights of %T", users)
+	}
+
+	// the workouts recorded next are recorded after the mark
+	time.Sleep(2 * time.Millisecond)
+}
+
+func createTestUser(t *testing.T, stores *Stores, username string) *User {
+	t.Helper()
+
+	user := &User{
+		Username: username,
+		Email:    fmt.Sprintf("%s@example.com", username),
+	}
+	require.NoError(t, user.Password.Set("password123"))
+	require.NoError(t, stores.Users.PersistUser(user))
+
+	return user
+}
+
+func createTestToken(t *testing.T, stores *Stores, userID int) *auth.Token {
+	t.Helper()
+
+	token := mustMakeToken(t, userID)
+	require.NoError(t, stores.Tokens.PersistToken(token))
+
+	return token
+}
+
+func mustMakeToken(t *testing.T, userID int) *auth.Token {
+	t.Helper()
+
+	token, err := auth.MakeToken(userID, time.Hour, auth.TokenScopeAuth)
+	require.NoError(t, err)
+
+	return token
+}
+
+func newTestWorkout(userID int) *Workout {
+	return &Workout{
+		UserID:          userID,
+		Name:            "Leg Day",
+		Description:     "Squats and core",
+		DurationMinutes: 60,
+		CaloriesBurned:  intPtr(400),
+		Exercises: []WorkoutExercise{
+			{Name: "Squat", Sets: 5, Reps: intPtr(5), Weight: floatPtr(100.5), Notes: "Belt on", OrderIndex: 2},
+			{Name: "Plank", Sets: 3, DurationSeconds: intPtr(60), OrderIndex: 1},
+		},
+	}
+}
+
+func newTestTemplate(userID int, name string) *WorkoutTemplate {
+	workout := newTestWorkout(userID)
+
+	return &WorkoutTemplate{
+		UserID:          userID,
+		Name:            name,
+		Description:     workout.Description,
+		DurationMinutes: workout.DurationMinutes,
+		CaloriesBurned:  workout.CaloriesBurned,
+		Exercises:       workout.Exercises,
+	}
+}
+
+// newTestProgram plans the templates, in turn, on days 1 and 3 of week 1 and
+// day 1 of week 2.
+func newTestProgram(userID int, name string, templateIDs ...int) *Program {
+	program := &Program{
+		UserID:      userID,
+		Name:        name,
+		Description: "Two weeks of strength",
+		Weeks:       2,
+		Days:        []ProgramDay{},
+	}
+
+	if len(templateIDs) > 0 {
+		for i, weekDay := range [][2]int{{1, 1}, {1, 3}, {2, 1}} {
+			program.Days = append(program.Days, ProgramDay{
+				Week:       weekDay[0],
+				Day:        weekDay[1],
+				TemplateID: templateIDs[i%len(templateIDs)],
+			})
+		}
+	}
+
+	return program
+}
+
+func newTestExercise(userID *int, name string) *Exercise {
+	return &Exercise{
+		UserID:         userID,
+		Name:           name,
+		PrimaryMuscles: []string{"quadriceps", "glutes"},
+		Equipment:      "barbell",
+		MovementType:   "compound",
+		Tracking:       ExerciseTrackingReps,
+	}
+}
@@ -2,6 +2,7 @@ package store
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"io/fs"
 	"os"
@@ -44,3 +45,25 @@ func Migrate(db *sql.DB, migrationsFS fs.FS, migrationsDir string) error {
 
 	return nil
 }
+
+// SeedExerciseCatalog adds the exercises listed in the JSON file at path to the
+// exercise catalog, and updates the ones it already has.
+func SeedExerciseCatalog(exercises ExerciseStore, seedsFS fs.FS, path string) error {
+	data, err := fs.ReadFile(seedsFS, path)
+	if err != nil {
+		return fmt.Errorf("failed to read exercise catalog: %w", err)
+	}
+
+	var catalog []Exercise
+	err = json.Unmarshal(data, &catalog)
+	if err != nil {
+		return fmt.Errorf("failed to decode exercise catalog: %w", err)
+	}
+
+	err = exercises.SeedExercises(catalog)
+	if err != nil {
+		return fmt.Errorf("failed to seed exercise catalog: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,186 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Enrollment is a user following a program from StartDate, a YYYY-MM-DD date.
+// CompletedSessions are the days of the program that a workout completed.
+type Enrollment struct {
+	ID                int                `json:"id"`
+	ProgramID         int                `json:"program_id"`
+	UserID            int                `json:"user_id"`
+	StartDate         string             `json:"start_date"`
+	CompletedSessions []CompletedSession `json:"completed_sessions"`
+	CreatedAt         time.Time          `json:"created_at"`
+}
+
+type CompletedSession struct {
+	ProgramDayID int `json:"program_day_id"`
+	WorkoutID    int `json:"workout_id"`
+}
+
+// ErrWorkoutAlreadyLinked is returned when a workout already completes another
+// planned session.
+var ErrWorkoutAlreadyLinked = errors.New("workout already completes a session")
+
+type EnrollmentStore interface {
+	CreateEnrollment(enrollment *Enrollment) error
+	// GetEnrollment only returns the sessions completed by workouts that are
+	// not in the trash.
+	GetEnrollment(id int) (*Enrollment, error)
+	// ListEnrollments returns the enrollments of a user without their completed
+	// sessions, most recent start first.
+	ListEnrollments(userID int) ([]Enrollment, error)
+	DeleteEnrollment(id int) error
+	// IsEnrolledWithTemplate tells whether a user is enrolled in a program with
+	// a day of the template.
+	IsEnrolledWithTemplate(userID, templateID int) (bool, error)
+	// CompleteSession records that a workout completed a day of the program of
+	// an enrollment, in place of the workout that completed it before, if any.
+	CompleteSession(enrollmentID, programDayID, workoutID int) error
+	UncompleteSession(enrollmentID, programDayID int) error
+}
+
+var _ EnrollmentStore = (*PostgresEnrollmentStore)(nil)
+
+type PostgresEnrollmentStore struct {
+	db DBTX
+}
+
+func NewPostgresEnrollmentStore(db DBTX) *PostgresEnrollmentStore {
+	return &PostgresEnrollmentStore{
+		db: db,
+	}
+}
+
+func (es *PostgresEnrollmentStore) CreateEnrollment(enrollment *Enrollment) error {
+	query := `
+		INSERT INTO enrollments (program_id, user_id, start_date)
+		VALUES ($1, $2, $3)
+		RETURNING id, start_date::text, created_at
+	`
+
+	return es.db.QueryRow(query, enrollment.ProgramID, enrollment.UserID, enrollment.StartDate).
+		Scan(&enrollment.ID, &enrollment.StartDate, &enrollment.CreatedAt)
+}
+
+// the date is read as text, as database/sql would format it as a timestamp
+const enrollmentColumns = `id, program_id, user_id, start_date::text, created_at`
+
+func scanEnrollment(row interface{ Scan(dest ...any) error }, enrollment *Enrollment) error {
+	return row.Scan(
+		&enrollment.ID,
+		&enrollment.ProgramID,
+		&enrollment.UserID,
+		&enrollment.StartDate,
+		&enrollment.CreatedAt,
+	)
+}
+
+func (es *PostgresEnrollmentStore) GetEnrollment(id int) (*Enrollment, error) {
+	enrollment := &Enrollment{}
+
+	query := `SELECT ` + enrollmentColumns + ` FROM enrollments WHERE id = $1`
+
+	err := scanEnrollment(es.db.QueryRow(query, id), enrollment)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sessionsQuery := `
+		SELECT es.program_day_id, es.workout_id
+		FROM enrollment_sessions es
+		JOIN workouts w ON w.id = es.workout_id
+		WHERE es.enrollment_id = $1 AND w.deleted_at IS NULL
+		ORDER BY es.program_day_id
+	`
+
+	enrollment.CompletedSessions = []CompletedSession{}
+	err = queryRows(es.db, sessionsQuery, []any{id}, func(rows *sql.Rows) error {
+		var session CompletedSession
+		err := rows.Scan(&session.ProgramDayID, &session.WorkoutID)
+		enrollment.CompletedSessions = append(enrollment.CompletedSessions, session)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return enrollment, nil
+}
+
+func (es *PostgresEnrollmentStore) ListEnrollments(userID int) ([]Enrollment, error) {
+	query := `
+		SELECT ` + enrollmentColumns + `
+		FROM enrollments
+		WHERE user_id = $1
+		ORDER BY start_date DESC, id DESC
+	`
+
+	enrollments := []Enrollment{}
+	err := queryRows(es.db, query, []any{userID}, func(rows *sql.Rows) error {
+		var enrollment Enrollment
+		err := scanEnrollment(rows, &enrollment)
+		enrollments = append(enrollments, enrollment)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return enrollments, nil
+}
+
+func (es *PostgresEnrollmentStore) DeleteEnrollment(id int) error {
+	query := `DELETE FROM enrollments WHERE id = $1`
+
+	return execAffectingRow(es.db, query, id)
+}
+
+func (es *PostgresEnrollmentStore) IsEnrolledWithTemplate(userID, templateID int) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1
+			FROM enrollments e
+			JOIN program_days pd ON pd.program_id = e.program_id
+			WHERE e.user_id = $1 AND pd.template_id = $2
+		)
+	`
+
+	var enrolled bool
+	err := es.db.QueryRow(query, userID, templateID).Scan(&enrolled)
+
+	return enrolled, err
+}
+
+func (es *PostgresEnrollmentStore) CompleteSession(enrollmentID, programDayID, workoutID int) error {
+	query := `
+		INSERT INTO enrollment_sessions (enrollment_id, program_day_id, workout_id)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (enrollment_id, program_day_id) DO UPDATE SET workout_id = EXCLUDED.workout_id
+	`
+
+	_, err := es.db.Exec(query, enrollmentID, programDayID, workoutID)
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return fmt.Errorf("%w: %s", ErrWorkoutAlreadyLinked, pgErr.ConstraintName)
+	}
+
+	return err
+}
+
+func (es *PostgresEnrollmentStore) UncompleteSession(enrollmentID, programDayID int) error {
+	query := `DELETE FROM enrollment_sessions WHERE enrollment_id = $1 AND program_day_id = $2`
+
+	return execAffectingRow(es.db, query, enrollmentID, programDayID)
+}
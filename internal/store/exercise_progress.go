@@ -0,0 +1,157 @@
+package store
+
+import (
+	"database/sql"
+	"math"
+	"time"
+)
+
+// The formulas that estimate a one-rep max from a set of several reps.
+const (
+	OneRepMaxEpley    = "epley"
+	OneRepMaxBrzycki  = "brzycki"
+	OneRepMaxLombardi = "lombardi"
+)
+
+var OneRepMaxFormulas = []string{OneRepMaxEpley, OneRepMaxBrzycki, OneRepMaxLombardi}
+
+// ProgressPoint sums up a session of an exercise, that is the sets of the
+// exercise in a workout that count: the completed sets other than warm-ups,
+// or all the sets of exercises logged without sets. Estimated1RM is the best
+// estimate among the sets with weight and reps, if any.
+type ProgressPoint struct {
+	WorkoutID    int      `json:"workout_id"`
+	Date         string   `json:"date"`
+	TopSet       TopSet   `json:"top_set"`
+	Estimated1RM *float64 `json:"estimated_1rm"`
+	VolumeLoad   float64  `json:"volume_load"`
+}
+
+// TopSet is the heaviest set of a session, then the one with the most reps or
+// the longest.
+type TopSet struct {
+	Weight          *float64 `json:"weight"`
+	Reps            *int     `json:"reps"`
+	DurationSeconds *int     `json:"duration_seconds"`
+}
+
+// exerciseSession holds the workout exercises of a workout with the same name.
+// date is the time the workout started at, as read in the time zone of its
+// user.
+type exerciseSession struct {
+	workoutID int
+	date      time.Time
+	exercises []WorkoutExercise
+}
+
+func (ss *PostgresStatsStore) GetExerciseProgress(userID int, name string, formula string) ([]ProgressPoint, error) {
+	query := `
+		SELECT ` + workoutExerciseColumns + `, workout_id, workout_started_at AT TIME ZONE time_zone
+		FROM (
+			SELECT we.*, w.started_at AS workout_started_at, u.time_zone
+			FROM workout_exercises we
+			JOIN workouts w ON w.id = we.workout_id
+			JOIN users u ON u.id = w.user_id
+			WHERE w.user_id = $1 AND w.deleted_at IS NULL AND lower(trim(we.name)) = lower(trim($2))
+		) matches
+		ORDER BY workout_started_at, workout_id, order_index, id
+	`
+
+	var exercises []WorkoutExercise
+	var sessions []exerciseSession
+	sessionSizes := make(map[int]int)
+	err := queryRows(ss.db, query, []any{userID, name}, func(rows *sql.Rows) error {
+		var exercise WorkoutExercise
+		var workoutID int
+		var date time.Time
+		err := rows.Scan(append(workoutExerciseFields(&exercise), &workoutID, &date)...)
+		if len(sessions) == 0 || sessions[len(sessions)-1].workoutID != workoutID {
+			sessions = append(sessions, exerciseSession{workoutID: workoutID, date: date})
+		}
+		sessionSizes[workoutID]++
+		exercises = append(exercises, exercise)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = loadWorkoutSets(ss.db, exercises)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range sessions {
+		size := sessionSizes[sessions[i].workoutID]
+		sessions[i].exercises, exercises = exercises[:size], exercises[size:]
+	}
+
+	return progressPoints(sessions, formula), nil
+}
+
+// progressPoints returns the points of the sessions in which sets counted.
+func progressPoints(sessions []exerciseSession, formula string) []ProgressPoint {
+	points := []ProgressPoint{}
+	for _, session := range sessions {
+		var sets []WorkoutSet
+		for _, exercise := range session.exercises {
+			sets = append(sets, performedSets(exercise)...)
+		}
+		if len(sets) == 0 {
+			continue
+		}
+
+		top := sets[0]
+		for _, set := range sets[1:] {
+			if isHeavierSet(set, top) {
+				top = set
+			}
+		}
+
+		point := ProgressPoint{
+			WorkoutID: session.workoutID,
+			Date:      session.date.UTC().Format(time.DateOnly),
+			TopSet:    TopSet{Weight: top.Weight, Reps: top.Reps, DurationSeconds: top.DurationSeconds},
+		}
+		for _, set := range sets {
+			weight, reps := valueOrZero(set.Weight), float64(valueOrZero(set.Reps))
+			point.VolumeLoad += weight * reps
+			if weight == 0 || reps == 0 {
+				continue
+			}
+
+			oneRepMax, ok := estimateOneRepMax(formula, weight, reps)
+			if ok && (point.Estimated1RM == nil || oneRepMax > *point.Estimated1RM) {
+				point.Estimated1RM = &oneRepMax
+			}
+		}
+
+		point.VolumeLoad = RoundStat(point.VolumeLoad)
+		if point.Estimated1RM != nil {
+			*point.Estimated1RM = RoundStat(*point.Estimated1RM)
+		}
+		points = append(points, point)
+	}
+
+	return points
+}
+
+// estimateOneRepMax returns the weight that could be lifted once, given reps
+// at weight. Brzycki does not apply from 37 reps.
+func estimateOneRepMax(formula string, weight, reps float64) (float64, bool) {
+	if reps == 1 {
+		return weight, true
+	}
+
+	switch formula {
+	case OneRepMaxBrzycki:
+		if reps >= 37 {
+			return 0, false
+		}
+		return weight * 36 / (37 - reps), true
+	case OneRepMaxLombardi:
+		return weight * math.Pow(reps, 0.1), true
+	default:
+		return weight * (1 + reps/30), true
+	}
+}
@@ -0,0 +1,280 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Exercise is an entry of the exercise catalog, or a custom exercise of the
+// user UserID, which is nil for the catalog.
+type Exercise struct {
+	ID               int       `json:"id"`
+	UserID           *int      `json:"user_id"`
+	Name             string    `json:"name"`
+	Aliases          []string  `json:"aliases"`
+	PrimaryMuscles   []string  `json:"primary_muscles"`
+	SecondaryMuscles []string  `json:"secondary_muscles"`
+	Equipment        string    `json:"equipment"`
+	MovementType     string    `json:"movement_type"`
+	Tracking         string    `json:"tracking"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// An exercise is tracked either in reps or in time, which tells whether its
+// workout exercises have reps or duration_seconds.
+const (
+	ExerciseTrackingReps = "reps"
+	ExerciseTrackingTime = "time"
+)
+
+// ErrDuplicateExerciseName is returned when a user already has a custom
+// exercise with the same name, case insensitively.
+var ErrDuplicateExerciseName = errors.New("duplicate exercise name")
+
+// The vocabularies of the exercise catalog, which custom exercises share.
+var (
+	MuscleGroups = []string{
+		"abdominals", "abductors", "adductors", "biceps", "calves", "chest", "forearms", "glutes", "hamstrings",
+		"hip_flexors", "lats", "lower_back", "obliques", "quadriceps", "shoulders", "traps", "triceps", "upper_back",
+	}
+	ExerciseEquipment = []string{"band", "barbell", "bodyweight", "cable", "cardio_machine", "dumbbell", "kettlebell", "machine", "other"}
+	MovementTypes     = []string{"cardio", "compound", "isolation", "mobility"}
+)
+
+// ExerciseFilter narrows a search of the exercises. Zero fields match everything.
+type ExerciseFilter struct {
+	// Query matches the name or an alias, case insensitively.
+	Query        string
+	Muscle       string
+	Equipment    string
+	MovementType string
+	Tracking     string
+	// CustomOnly leaves out the catalog.
+	CustomOnly bool
+	// Limit caps the number of results, unless it is 0.
+	Limit int
+}
+
+type ExerciseStore interface {
+	// SeedExercises adds the given exercises to the catalog, updating the
+	// catalog exercises that have the same name.
+	SeedExercises(exercises []Exercise) error
+	CreateExercise(exercise *Exercise) error
+	GetExercise(id int) (*Exercise, error)
+	// GetExercises returns the exercises among ids that exist, in no particular order.
+	GetExercises(ids []int) ([]Exercise, error)
+	// UpdateExercise and DeleteExercise only apply to custom exercises, and
+	// return sql.ErrNoRows for the catalog. Deleting an exercise unlinks the
+	// workout exercises that referenced it.
+	UpdateExercise(exercise *Exercise) error
+	DeleteExercise(id int) error
+	// SearchExercises returns the catalog and the custom exercises of userID
+	// that match filter: exact matches of the query first, then names starting
+	// with it, then the others, by name.
+	SearchExercises(userID int, filter ExerciseFilter) ([]Exercise, error)
+}
+
+var _ ExerciseStore = (*PostgresExerciseStore)(nil)
+
+type PostgresExerciseStore struct {
+	db DBTX
+}
+
+func NewPostgresExerciseStore(db DBTX) *PostgresExerciseStore {
+	return &PostgresExerciseStore{
+		db: db,
+	}
+}
+
+func (es *PostgresExerciseStore) SeedExercises(exercises []Exercise) error {
+	return runInTx(es.db, func(tx DBTX) error {
+		query := `
+			INSERT INTO exercises (name, aliases, primary_muscles, secondary_muscles, equipment, movement_type, tracking)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			ON CONFLICT (lower(name)) WHERE user_id IS NULL DO UPDATE
+			SET name = EXCLUDED.name, aliases = EXCLUDED.aliases, primary_muscles = EXCLUDED.primary_muscles,
+				secondary_muscles = EXCLUDED.secondary_muscles, equipment = EXCLUDED.equipment,
+				movement_type = EXCLUDED.movement_type, tracking = EXCLUDED.tracking, updated_at = CURRENT_TIMESTAMP
+			WHERE (exercises.name, exercises.aliases, exercises.primary_muscles, exercises.secondary_muscles,
+				exercises.equipment, exercises.movement_type, exercises.tracking)
+				IS DISTINCT FROM (EXCLUDED.name, EXCLUDED.aliases, EXCLUDED.primary_muscles, EXCLUDED.secondary_muscles,
+				EXCLUDED.equipment, EXCLUDED.movement_type, EXCLUDED.tracking)
+		`
+
+		for _, exercise := range exercises {
+			_, err := tx.Exec(query, exercise.Name, textArray(exercise.Aliases), textArray(exercise.PrimaryMuscles),
+				textArray(exercise.SecondaryMuscles), exercise.Equipment, exercise.MovementType, exercise.Tracking)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (es *PostgresExerciseStore) CreateExercise(exercise *Exercise) error {
+	query := `
+		INSERT INTO exercises (user_id, name, aliases, primary_muscles, secondary_muscles, equipment, movement_type, tracking)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at, updated_at
+	`
+
+	err := es.db.QueryRow(query, exercise.UserID, exercise.Name, textArray(exercise.Aliases), textArray(exercise.PrimaryMuscles),
+		textArray(exercise.SecondaryMuscles), exercise.Equipment, exercise.MovementType, exercise.Tracking,
+	).Scan(&exercise.ID, &exercise.CreatedAt, &exercise.UpdatedAt)
+
+	return duplicateExerciseName(err)
+}
+
+// the arrays are read as JSON, which database/sql can scan
+const exerciseColumns = `id, user_id, name, to_jsonb(aliases), to_jsonb(primary_muscles), to_jsonb(secondary_muscles),
+	equipment, movement_type, tracking, created_at, updated_at`
+
+func scanExercise(row interface{ Scan(dest ...any) error }, exercise *Exercise) error {
+	var aliases, primaryMuscles, secondaryMuscles []byte
+
+	err := row.Scan(
+		&exercise.ID,
+		&exercise.UserID,
+		&exercise.Name,
+		&aliases,
+		&primaryMuscles,
+		&secondaryMuscles,
+		&exercise.Equipment,
+		&exercise.MovementType,
+		&exercise.Tracking,
+		&exercise.CreatedAt,
+		&exercise.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	err = json.Unmarshal(aliases, &exercise.Aliases)
+	if err != nil {
+		return err
+	}
+
+	err = json.Unmarshal(primaryMuscles, &exercise.PrimaryMuscles)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(secondaryMuscles, &exercise.SecondaryMuscles)
+}
+
+func (es *PostgresExerciseStore) GetExercise(id int) (*Exercise, error) {
+	exercise := &Exercise{}
+
+	query := `SELECT ` + exerciseColumns + ` FROM exercises WHERE id = $1`
+
+	err := scanExercise(es.db.QueryRow(query, id), exercise)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return exercise, nil
+}
+
+func (es *PostgresExerciseStore) GetExercises(ids []int) ([]Exercise, error) {
+	query := `SELECT ` + exerciseColumns + ` FROM exercises WHERE id = ANY($1)`
+
+	return queryExercises(es.db, query, ids)
+}
+
+func (es *PostgresExerciseStore) UpdateExercise(exercise *Exercise) error {
+	query := `
+		UPDATE exercises
+		SET name = $1, aliases = $2, primary_muscles = $3, secondary_muscles = $4, equipment = $5,
+			movement_type = $6, tracking = $7, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $8 AND user_id IS NOT NULL
+		RETURNING user_id, created_at, updated_at
+	`
+
+	err := es.db.QueryRow(query, exercise.Name, textArray(exercise.Aliases), textArray(exercise.PrimaryMuscles),
+		textArray(exercise.SecondaryMuscles), exercise.Equipment, exercise.MovementType, exercise.Tracking, exercise.ID,
+	).Scan(&exercise.UserID, &exercise.CreatedAt, &exercise.UpdatedAt)
+
+	return duplicateExerciseName(err)
+}
+
+func (es *PostgresExerciseStore) DeleteExercise(id int) error {
+	query := `DELETE FROM exercises WHERE id = $1 AND user_id IS NOT NULL`
+
+	return execAffectingRow(es.db, query, id)
+}
+
+func (es *PostgresExerciseStore) SearchExercises(userID int, filter ExerciseFilter) ([]Exercise, error) {
+	pattern := "%" + escapeLike(filter.Query) + "%"
+	prefix := escapeLike(filter.Query) + "%"
+
+	query := `
+		SELECT ` + exerciseColumns + `
+		FROM exercises
+		WHERE (user_id = $1 OR (user_id IS NULL AND NOT $2))
+		AND ($3 = '' OR name ILIKE $4 OR EXISTS (SELECT 1 FROM unnest(aliases) AS alias WHERE alias ILIKE $4))
+		AND ($5 = '' OR $5 = ANY(primary_muscles) OR $5 = ANY(secondary_muscles))
+		AND ($6 = '' OR equipment = $6)
+		AND ($7 = '' OR movement_type = $7)
+		AND ($8 = '' OR tracking = $8)
+		ORDER BY
+			(lower(name) = lower($3) OR EXISTS (SELECT 1 FROM unnest(aliases) AS alias WHERE lower(alias) = lower($3))) DESC,
+			name ILIKE $9 DESC,
+			lower(name) COLLATE "C", id
+		LIMIT NULLIF($10, 0)
+	`
+
+	return queryExercises(es.db, query, userID, filter.CustomOnly, filter.Query, pattern, filter.Muscle,
+		filter.Equipment, filter.MovementType, filter.Tracking, prefix, filter.Limit)
+}
+
+func queryExercises(db DBTX, query string, args ...any) ([]Exercise, error) {
+	exercises := []Exercise{}
+
+	err := queryRows(db, query, args, func(rows *sql.Rows) error {
+		var exercise Exercise
+		err := scanExercise(rows, &exercise)
+		exercises = append(exercises, exercise)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return exercises, nil
+}
+
+// duplicateExerciseName translates the violation of a unique name index.
+func duplicateExerciseName(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return fmt.Errorf("%w: %s", ErrDuplicateExerciseName, pgErr.ConstraintName)
+	}
+
+	return err
+}
+
+// textArray keeps nil slices from being stored as NULL.
+func textArray(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+
+	return values
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern.
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
@@ -0,0 +1,37 @@
+package store
+
+import (
+	"slices"
+	"testing"
+
+	"fem-go-crud/database/seeds"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeedExerciseCatalog(t *testing.T) {
+	exerciseStore := NewInMemoryExerciseStore(NewMemoryDB())
+
+	require.NoError(t, SeedExerciseCatalog(exerciseStore, seeds.FS, "exercises.json"))
+	require.NoError(t, SeedExerciseCatalog(exerciseStore, seeds.FS, "exercises.json"), "seeding is idempotent")
+
+	catalog, err := exerciseStore.SearchExercises(0, ExerciseFilter{})
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, len(catalog), 40)
+
+	for _, exercise := range catalog {
+		assert.NotEmpty(t, exercise.PrimaryMuscles, exercise.Name)
+		for _, muscle := range slices.Concat(exercise.PrimaryMuscles, exercise.SecondaryMuscles) {
+			assert.Contains(t, MuscleGroups, muscle, exercise.Name)
+		}
+		assert.Contains(t, ExerciseEquipment, exercise.Equipment, exercise.Name)
+		assert.Contains(t, MovementTypes, exercise.MovementType, exercise.Name)
+	}
+
+	squats, err := exerciseStore.SearchExercises(0, ExerciseFilter{Query: "squat"})
+	require.NoError(t, err)
+	require.NotEmpty(t, squats)
+	assert.Equal(t, "Barbell Back Squat", squats[0].Name, "the alias Squat is an exact match")
+
+	assert.Error(t, SeedExerciseCatalog(exerciseStore, seeds.FS, "missing.json"))
+}
@@ -0,0 +1,141 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Export is an export of the data of a user built in the background. Its
+// archive can be downloaded once it is ready, until ExpiresAt.
+type Export struct {
+	ID          int        `json:"id"`
+	UserID      int        `json:"user_id"`
+	Status      string     `json:"status"`
+	SizeBytes   *int64     `json:"size_bytes"`
+	Error       string     `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+}
+
+const (
+	ExportPending = "pending"
+	ExportReady   = "ready"
+	ExportFailed  = "failed"
+)
+
+var ExportStatuses = []string{ExportPending, ExportReady, ExportFailed}
+
+type ExportStore interface {
+	// CreateExport stores a pending export.
+	CreateExport(export *Export) error
+	GetExport(id int) (*Export, error)
+	// GetCurrentExport returns the latest export of a user created since
+	// since that is pending or ready, or nil if there is none.
+	GetCurrentExport(userID int, since time.Time) (*Export, error)
+	// FinishExport stores the status, size, error and expiry of an export that
+	// is no longer pending, and completes it now.
+	FinishExport(export *Export) error
+	// DeleteExpiredExports deletes the exports that expired before
+	// expiredBefore, and the ones still pending since before pendingBefore,
+	// whose archive was never finished, and returns how many there were.
+	DeleteExpiredExports(expiredBefore, pendingBefore time.Time) (int, error)
+}
+
+var _ ExportStore = (*PostgresExportStore)(nil)
+
+type PostgresExportStore struct {
+	db DBTX
+}
+
+func NewPostgresExportStore(db DBTX) *PostgresExportStore {
+	return &PostgresExportStore{
+		db: db,
+	}
+}
+
+const exportColumns = `id, user_id, status, size_bytes, error, created_at, completed_at, expires_at`
+
+func scanExport(row interface{ Scan(dest ...any) error }, export *Export) error {
+	return row.Scan(
+		&export.ID,
+		&export.UserID,
+		&export.Status,
+		&export.SizeBytes,
+		&export.Error,
+		&export.CreatedAt,
+		&export.CompletedAt,
+		&export.ExpiresAt,
+	)
+}
+
+func (es *PostgresExportStore) CreateExport(export *Export) error {
+	query := `
+		INSERT INTO exports (user_id)
+		VALUES ($1)
+		RETURNING ` + exportColumns
+
+	return scanExport(es.db.QueryRow(query, export.UserID), export)
+}
+
+func (es *PostgresExportStore) GetExport(id int) (*Export, error) {
+	export := &Export{}
+
+	err := scanExport(es.db.QueryRow(`SELECT `+exportColumns+` FROM exports WHERE id = $1`, id), export)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return export, nil
+}
+
+func (es *PostgresExportStore) GetCurrentExport(userID int, since time.Time) (*Export, error) {
+	query := `
+		SELECT ` + exportColumns + `
+		FROM exports
+		WHERE user_id = $1 AND created_at >= $2 AND status IN ('pending', 'ready')
+		ORDER BY created_at DESC, id DESC
+		LIMIT 1
+	`
+
+	export := &Export{}
+	err := scanExport(es.db.QueryRow(query, userID, since), export)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return export, nil
+}
+
+func (es *PostgresExportStore) FinishExport(export *Export) error {
+	query := `
+		UPDATE exports
+		SET status = $2, size_bytes = $3, error = $4, completed_at = CURRENT_TIMESTAMP, expires_at = $5
+		WHERE id = $1
+		RETURNING ` + exportColumns
+
+	return scanExport(es.db.QueryRow(query, export.ID, export.Status, export.SizeBytes, export.Error, export.ExpiresAt), export)
+}
+
+func (es *PostgresExportStore) DeleteExpiredExports(expiredBefore, pendingBefore time.Time) (int, error) {
+	query := `DELETE FROM exports WHERE expires_at < $1 OR (status = 'pending' AND created_at < $2)`
+
+	result, err := es.db.Exec(query, expiredBefore, pendingBefore)
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(rowsAffected), nil
+}
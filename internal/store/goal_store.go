@@ -0,0 +1,447 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"strings"
+	"time"
+)
+
+// Goal is a target a user sets themselves from StartsOn, a YYYY-MM-DD date,
+// to Deadline, if set. Kind picks what is measured:
+//
+//   - exercise_weight, the heaviest weight lifted on an exercise;
+//   - exercise_reps, the most reps of a set of an exercise, at Weight or more;
+//   - frequency, the workouts per week, Target times the weeks to Deadline;
+//   - total_duration and calories, the minutes and calories of the workouts;
+//   - body_weight, the latest body weight measured, from StartValue.
+//
+// Exercise goals count every performance up to Deadline, the others only the
+// workouts from StartsOn. CurrentValue and AchievedAt are kept up to date as
+// workouts and measurements are recorded, and PercentComplete and Status are
+// set as of the day the goal is read. Days are those of the time zone of the
+// user. Weights are in kilograms.
+type Goal struct {
+	ID              int        `json:"id"`
+	UserID          int        `json:"user_id"`
+	Kind            string     `json:"kind"`
+	ExerciseID      *int       `json:"exercise_id"`
+	ExerciseName    string     `json:"exercise_name"`
+	Weight          *float64   `json:"weight"`
+	Target          float64    `json:"target"`
+	StartValue      *float64   `json:"start_value"`
+	StartsOn        string     `json:"starts_on"`
+	Deadline        *string    `json:"deadline"`
+	CurrentValue    float64    `json:"current_value"`
+	PercentComplete float64    `json:"percent_complete"`
+	Status          string     `json:"status"`
+	AchievedAt      *time.Time `json:"achieved_at"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+const (
+	GoalExerciseWeight = "exercise_weight"
+	GoalExerciseReps   = "exercise_reps"
+	GoalFrequency      = "frequency"
+	GoalTotalDuration  = "total_duration"
+	GoalCalories       = "calories"
+	GoalBodyWeight     = "body_weight"
+)
+
+var GoalKinds = []string{GoalExerciseWeight, GoalExerciseReps, GoalFrequency, GoalTotalDuration, GoalCalories, GoalBodyWeight}
+
+// ExerciseGoalKinds are the goal kinds of an exercise.
+var ExerciseGoalKinds = []string{GoalExerciseWeight, GoalExerciseReps}
+
+const (
+	GoalInProgress = "in_progress"
+	GoalAchieved   = "achieved"
+	// a goal is missed once its deadline is past
+	GoalMissed = "missed"
+)
+
+var GoalStatuses = []string{GoalInProgress, GoalAchieved, GoalMissed}
+
+type GoalStore interface {
+	// CreateGoal and UpdateGoal evaluate the goal they store.
+	CreateGoal(goal *Goal) error
+	GetGoal(id int) (*Goal, error)
+	// ListGoals returns the goals of a user, by deadline, the ones without a
+	// deadline last.
+	ListGoals(userID int) ([]Goal, error)
+	UpdateGoal(goal *Goal) error
+	DeleteGoal(id int) error
+}
+
+var _ GoalStore = (*PostgresGoalStore)(nil)
+
+type PostgresGoalStore struct {
+	db DBTX
+}
+
+func NewPostgresGoalStore(db DBTX) *PostgresGoalStore {
+	return &PostgresGoalStore{
+		db: db,
+	}
+}
+
+const goalColumns = `id, user_id, kind, exercise_id, exercise_name, weight, target, start_value, ` +
+	`starts_on::text, deadline::text, current_value, achieved_at, created_at, updated_at`
+
+func scanGoal(row interface{ Scan(dest ...any) error }, goal *Goal) error {
+	return row.Scan(
+		&goal.ID,
+		&goal.UserID,
+		&goal.Kind,
+		&goal.ExerciseID,
+		&goal.ExerciseName,
+		&goal.Weight,
+		&goal.Target,
+		&goal.StartValue,
+		&goal.StartsOn,
+		&goal.Deadline,
+		&goal.CurrentValue,
+		&goal.AchievedAt,
+		&goal.CreatedAt,
+		&goal.UpdatedAt,
+	)
+}
+
+func (gs *PostgresGoalStore) CreateGoal(goal *Goal) error {
+	return runInTx(gs.db, func(tx DBTX) error {
+		query := `
+			INSERT INTO goals (user_id, kind, exercise_id, exercise_name, weight, target, start_value, starts_on, deadline)
+			VALUES ($1, $2, $3, $4, $5, $6, $7,
+				COALESCE($8::date, (CURRENT_TIMESTAMP AT TIME ZONE (SELECT time_zone FROM users WHERE id = $1))::date), $9)
+			RETURNING id
+		`
+
+		err := tx.QueryRow(query, goal.UserID, goal.Kind, goal.ExerciseID, goal.ExerciseName, goal.Weight, goal.Target,
+			goal.StartValue, nullableDate(goal.StartsOn), goal.Deadline).Scan(&goal.ID)
+		if err != nil {
+			return err
+		}
+
+		return reloadGoal(tx, goal)
+	})
+}
+
+func (gs *PostgresGoalStore) GetGoal(id int) (*Goal, error) {
+	goal := &Goal{}
+
+	err := scanGoal(gs.db.QueryRow(`SELECT `+goalColumns+` FROM goals WHERE id = $1`, id), goal)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	today, err := userToday(gs.db, goal.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	goal.Evaluate(today)
+
+	return goal, nil
+}
+
+func (gs *PostgresGoalStore) ListGoals(userID int) ([]Goal, error) {
+	goals, err := listGoals(gs.db, userID)
+	if err != nil || len(goals) == 0 {
+		return goals, err
+	}
+
+	today, err := userToday(gs.db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range goals {
+		goals[i].Evaluate(today)
+	}
+
+	return goals, nil
+}
+
+func listGoals(db DBTX, userID int) ([]Goal, error) {
+	query := `
+		SELECT ` + goalColumns + `
+		FROM goals
+		WHERE user_id = $1
+		ORDER BY deadline NULLS LAST, id
+	`
+
+	goals := []Goal{}
+	err := queryRows(db, query, []any{userID}, func(rows *sql.Rows) error {
+		var goal Goal
+		err := scanGoal(rows, &goal)
+		goals = append(goals, goal)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return goals, nil
+}
+
+func (gs *PostgresGoalStore) UpdateGoal(goal *Goal) error {
+	return runInTx(gs.db, func(tx DBTX) error {
+		query := `
+			UPDATE goals
+			SET kind = $1, exercise_id = $2, exercise_name = $3, weight = $4, target = $5, start_value = $6,
+				starts_on = COALESCE($7::date, starts_on), deadline = $8, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $9
+		`
+
+		err := execAffectingRow(tx, query, goal.Kind, goal.ExerciseID, goal.ExerciseName, goal.Weight, goal.Target,
+			goal.StartValue, nullableDate(goal.StartsOn), goal.Deadline, goal.ID)
+		if err != nil {
+			return err
+		}
+
+		return reloadGoal(tx, goal)
+	})
+}
+
+// reloadGoal evaluates the goals of the user of goal, then reads goal back.
+func reloadGoal(tx DBTX, goal *Goal) error {
+	err := tx.QueryRow(`SELECT user_id FROM goals WHERE id = $1`, goal.ID).Scan(&goal.UserID)
+	if err != nil {
+		return err
+	}
+
+	err = refreshGoals(tx, goal.UserID)
+	if err != nil {
+		return err
+	}
+
+	err = scanGoal(tx.QueryRow(`SELECT `+goalColumns+` FROM goals WHERE id = $1`, goal.ID), goal)
+	if err != nil {
+		return err
+	}
+
+	today, err := userToday(tx, goal.UserID)
+	if err != nil {
+		return err
+	}
+
+	goal.Evaluate(today)
+
+	return nil
+}
+
+func (gs *PostgresGoalStore) DeleteGoal(id int) error {
+	return execAffectingRow(gs.db, `DELETE FROM goals WHERE id = $1`, id)
+}
+
+// refreshGoals evaluates the goals of a user, setting their current value and
+// when they were achieved.
+func refreshGoals(tx DBTX, userID int) error {
+	goals, err := listGoals(tx, userID)
+	if err != nil || len(goals) == 0 {
+		return err
+	}
+
+	records, err := getPersonalRecords(tx, userID)
+	if err != nil {
+		return err
+	}
+
+	timeZone, err := userTimeZone(tx, userID)
+	if err != nil {
+		return err
+	}
+
+	for i := range goals {
+		goal := &goals[i]
+
+		var totals workoutTotals
+		if goal.countsWorkouts() {
+			query := `
+				SELECT count(*), COALESCE(sum(w.duration_minutes), 0), COALESCE(sum(w.calories_burned), 0)
+				FROM workouts w
+				JOIN users u ON u.id = w.user_id
+				WHERE w.user_id = $1 AND w.deleted_at IS NULL
+					AND (w.started_at AT TIME ZONE u.time_zone)::date >= $2::date
+					AND ($3::date IS NULL OR (w.started_at AT TIME ZONE u.time_zone)::date <= $3::date)
+			`
+
+			err = tx.QueryRow(query, userID, goal.StartsOn, goal.Deadline).
+				Scan(&totals.workouts, &totals.durationMinutes, &totals.caloriesBurned)
+			if err != nil {
+				return err
+			}
+		}
+
+		var bodyWeight *float64
+		if goal.Kind == GoalBodyWeight {
+			query := `
+				SELECT COALESCE((
+					SELECT weight_kg
+					FROM body_measurements
+					WHERE user_id = $1 AND weight_kg IS NOT NULL AND ($2::date IS NULL OR measured_on <= $2::date)
+					ORDER BY measured_on DESC, id DESC
+					LIMIT 1
+				), body_weight_kg)
+				FROM users
+				WHERE id = $1
+			`
+
+			err = tx.QueryRow(query, userID, goal.Deadline).Scan(&bodyWeight)
+			if err != nil {
+				return err
+			}
+		}
+
+		value := goal.value(records, totals, bodyWeight, timeZone)
+		query := `
+			UPDATE goals
+			SET current_value = $1, achieved_at = CASE WHEN $2::boolean THEN COALESCE(achieved_at, CURRENT_TIMESTAMP) END
+			WHERE id = $3
+		`
+
+		_, err = tx.Exec(query, value, goal.reached(value), goal.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// workoutTotals sum up the workouts of the window of a goal.
+type workoutTotals struct {
+	workouts        int
+	durationMinutes int
+	caloriesBurned  int
+}
+
+func (g *Goal) countsWorkouts() bool {
+	return g.Kind == GoalFrequency || g.Kind == GoalTotalDuration || g.Kind == GoalCalories
+}
+
+// value returns the current value of the goal given the personal records of
+// its user, the totals of the workouts of its window, the latest body weight
+// and the time zone of its user.
+func (g *Goal) value(records []PersonalRecord, totals workoutTotals, bodyWeight *float64, timeZone string) float64 {
+	switch g.Kind {
+	case GoalExerciseWeight, GoalExerciseReps:
+		best := 0.0
+		for _, record := range records {
+			if g.counts(record, timeZone) {
+				best = max(best, record.Value)
+			}
+		}
+		return best
+	case GoalFrequency:
+		return float64(totals.workouts)
+	case GoalTotalDuration:
+		return float64(totals.durationMinutes)
+	case GoalCalories:
+		return float64(totals.caloriesBurned)
+	case GoalBodyWeight:
+		if bodyWeight == nil {
+			return valueOrZero(g.StartValue)
+		}
+		return *bodyWeight
+	default:
+		return 0
+	}
+}
+
+// counts reports whether a personal record is a performance of the exercise
+// of the goal that counts towards it. A record is achieved when its workout
+// started, which counts up to the end of the deadline in timeZone.
+func (g *Goal) counts(record PersonalRecord, timeZone string) bool {
+	if g.ExerciseID != nil {
+		if record.ExerciseID == nil || *record.ExerciseID != *g.ExerciseID {
+			return false
+		}
+	} else if !strings.EqualFold(strings.TrimSpace(record.ExerciseName), strings.TrimSpace(g.ExerciseName)) {
+		return false
+	}
+
+	if g.Deadline != nil && localDay(record.AchievedAt, timeZone) > *g.Deadline {
+		return false
+	}
+
+	if g.Kind == GoalExerciseReps {
+		return record.RecordType == RecordMaxReps && valueOrZero(record.Weight) >= valueOrZero(g.Weight)
+	}
+
+	return record.RecordType == RecordMaxWeight
+}
+
+// required returns the value that achieves the goal.
+func (g *Goal) required() float64 {
+	if g.Kind != GoalFrequency || g.Deadline == nil {
+		return g.Target
+	}
+
+	startsOn, _ := time.Parse(time.DateOnly, g.StartsOn)
+	deadline, _ := time.Parse(time.DateOnly, *g.Deadline)
+	weeks := (deadline.Sub(startsOn).Hours()/24 + 1) / 7
+
+	return math.Ceil(g.Target * weeks)
+}
+
+// reached reports whether value achieves the goal. Body weight goals are
+// reached going from StartValue down, or up, to Target.
+func (g *Goal) reached(value float64) bool {
+	if g.Kind == GoalBodyWeight {
+		if valueOrZero(g.StartValue) > g.Target {
+			return value <= g.Target
+		}
+		return value >= g.Target
+	}
+
+	return value >= g.required()
+}
+
+// Evaluate sets the percent complete and the status of the goal as of today,
+// a YYYY-MM-DD date.
+func (g *Goal) Evaluate(today string) {
+	var percent float64
+	switch {
+	case g.reached(g.CurrentValue):
+		percent = 100
+	case g.Kind == GoalBodyWeight:
+		start := valueOrZero(g.StartValue)
+		percent = (g.CurrentValue - start) / (g.Target - start) * 100
+	default:
+		percent = g.CurrentValue / g.required() * 100
+	}
+	g.PercentComplete = math.Round(min(max(percent, 0), 100)*10) / 10
+
+	switch {
+	case g.AchievedAt != nil:
+		g.Status = GoalAchieved
+	case g.Deadline != nil && today > *g.Deadline:
+		g.Status = GoalMissed
+	default:
+		g.Status = GoalInProgress
+	}
+}
+
+// userTimeZone returns the time zone of a user.
+func userTimeZone(db DBTX, userID int) (string, error) {
+	var timeZone string
+	err := db.QueryRow(`SELECT time_zone FROM users WHERE id = $1`, userID).Scan(&timeZone)
+
+	return timeZone, err
+}
+
+// userToday returns the day it is for a user, in their time zone.
+func userToday(db DBTX, userID int) (string, error) {
+	timeZone, err := userTimeZone(db, userID)
+	if err != nil {
+		return "", err
+	}
+
+	return localDay(time.Now(), timeZone), nil
+}
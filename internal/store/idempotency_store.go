@@ -0,0 +1,168 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// IdempotencyRecord is the stored outcome of a request made with an
+// Idempotency-Key header. A zero ResponseStatus means the request is in
+// progress. UserID is 0 for requests made without authentication.
+type IdempotencyRecord struct {
+	UserID          int
+	Key             string
+	Fingerprint     []byte
+	ResponseStatus  int
+	ResponseHeaders http.Header
+	ResponseBody    []byte
+	ExpiresAt       time.Time
+}
+
+func (ir *IdempotencyRecord) IsComplete() bool {
+	return ir.ResponseStatus != 0
+}
+
+type IdempotencyStore interface {
+	// ReserveIdempotencyKey claims record.Key for record.UserID. If the key is
+	// already claimed by a record that has not expired, that record is returned
+	// and nothing is reserved.
+	ReserveIdempotencyKey(record *IdempotencyRecord) (*IdempotencyRecord, error)
+	// CompleteIdempotencyKey stores the response of a reserved key.
+	CompleteIdempotencyKey(record *IdempotencyRecord) error
+	// ReleaseIdempotencyKey drops a reserved key so the request can be retried.
+	ReleaseIdempotencyKey(userID int, key string) error
+	// DeleteExpiredIdempotencyKeys deletes the keys that expired as of now and
+	// returns how many there were.
+	DeleteExpiredIdempotencyKeys(now time.Time) (int, error)
+}
+
+var _ IdempotencyStore = (*PostgresIdempotencyStore)(nil)
+
+type PostgresIdempotencyStore struct {
+	db DBTX
+}
+
+func NewPostgresIdempotencyStore(db DBTX) *PostgresIdempotencyStore {
+	return &PostgresIdempotencyStore{
+		db: db,
+	}
+}
+
+func (is *PostgresIdempotencyStore) ReserveIdempotencyKey(record *IdempotencyRecord) (*IdempotencyRecord, error) {
+	// an expired record is taken over as if it did not exist
+	query := `
+		INSERT INTO idempotency_keys (user_id, key, fingerprint, expires_at)
+		VALUES (NULLIF($1, 0), $2, $3, $4)
+		ON CONFLICT (user_id, key) DO UPDATE
+		SET fingerprint = EXCLUDED.fingerprint, response_status = NULL, response_headers = NULL,
+			response_body = NULL, created_at = CURRENT_TIMESTAMP, expires_at = EXCLUDED.expires_at
+		WHERE idempotency_keys.expires_at <= CURRENT_TIMESTAMP
+		RETURNING key
+	`
+
+	var key string
+	err := is.db.QueryRow(query, record.UserID, record.Key, record.Fingerprint, record.ExpiresAt).Scan(&key)
+	if err == nil {
+		return nil, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	existingRecord := &IdempotencyRecord{}
+	var responseStatus sql.NullInt32
+	var responseHeaders []byte
+
+	query = `
+		SELECT COALESCE(user_id, 0), key, fingerprint, response_status, response_headers, response_body, expires_at
+		FROM idempotency_keys
+		WHERE user_id IS NOT DISTINCT FROM NULLIF($1, 0) AND key = $2
+	`
+
+	err = is.db.QueryRow(query, record.UserID, record.Key).Scan(
+		&existingRecord.UserID,
+		&existingRecord.Key,
+		&existingRecord.Fingerprint,
+		&responseStatus,
+		&responseHeaders,
+		&existingRecord.ResponseBody,
+		&existingRecord.ExpiresAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		// released in the meantime
+		return is.ReserveIdempotencyKey(record)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	existingRecord.ResponseStatus = int(responseStatus.Int32)
+	if responseHeaders != nil {
+		err = json.Unmarshal(responseHeaders, &existingRecord.ResponseHeaders)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return existingRecord, nil
+}
+
+func (is *PostgresIdempotencyStore) CompleteIdempotencyKey(record *IdempotencyRecord) error {
+	responseHeaders, err := json.Marshal(record.ResponseHeaders)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE idempotency_keys
+		SET response_status = $1, response_headers = $2, response_body = $3
+		WHERE user_id IS NOT DISTINCT FROM NULLIF($4, 0) AND key = $5
+	`
+
+	result, err := is.db.Exec(query, record.ResponseStatus, responseHeaders, record.ResponseBody, record.UserID, record.Key)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (is *PostgresIdempotencyStore) ReleaseIdempotencyKey(userID int, key string) error {
+	query := `
+		DELETE FROM idempotency_keys
+		WHERE user_id IS NOT DISTINCT FROM NULLIF($1, 0) AND key = $2
+	`
+
+	_, err := is.db.Exec(query, userID, key)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (is *PostgresIdempotencyStore) DeleteExpiredIdempotencyKeys(now time.Time) (int, error) {
+	result, err := is.db.Exec(`DELETE FROM idempotency_keys WHERE expires_at <= $1`, now)
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(rowsAffected), nil
+}
@@ -0,0 +1,249 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// BodyMeasurement is a measurement of the body of a user on MeasuredOn, a
+// YYYY-MM-DD date. Weights are in kilograms and circumferences in centimeters.
+type BodyMeasurement struct {
+	ID             int            `json:"id"`
+	UserID         int            `json:"user_id"`
+	MeasuredOn     string         `json:"measured_on"`
+	WeightKg       *float64       `json:"weight"`
+	BodyFatPercent *float64       `json:"body_fat_percent"`
+	Circumferences Circumferences `json:"circumferences"`
+	Notes          string         `json:"notes"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+}
+
+type Circumferences struct {
+	NeckCm  *float64 `json:"neck"`
+	ChestCm *float64 `json:"chest"`
+	WaistCm *float64 `json:"waist"`
+	HipsCm  *float64 `json:"hips"`
+	ArmCm   *float64 `json:"arm"`
+	ThighCm *float64 `json:"thigh"`
+	CalfCm  *float64 `json:"calf"`
+}
+
+// MeasurementFields name the values of a measurement, in the order of
+// BodyMeasurement.Values.
+var MeasurementFields = []string{
+	"weight", "body_fat_percent",
+	"neck", "chest", "waist", "hips", "arm", "thigh", "calf",
+}
+
+// measurementValueColumns are the columns of the values of a measurement, in
+// the order of BodyMeasurement.Values.
+var measurementValueColumns = []string{
+	"weight_kg", "body_fat_percent",
+	"neck_cm", "chest_cm", "waist_cm", "hips_cm", "arm_cm", "thigh_cm", "calf_cm",
+}
+
+// Values returns the fields of the values of the measurement, in the order of
+// MeasurementFields.
+func (m *BodyMeasurement) Values() []**float64 {
+	return []**float64{
+		&m.WeightKg, &m.BodyFatPercent,
+		&m.Circumferences.NeckCm, &m.Circumferences.ChestCm, &m.Circumferences.WaistCm, &m.Circumferences.HipsCm,
+		&m.Circumferences.ArmCm, &m.Circumferences.ThighCm, &m.Circumferences.CalfCm,
+	}
+}
+
+// MeasuredValue is the latest value of a measurement field, and the
+// measurement it was taken from.
+type MeasuredValue struct {
+	Value         float64 `json:"value"`
+	MeasuredOn    string  `json:"measured_on"`
+	MeasurementID int     `json:"measurement_id"`
+}
+
+// LatestMeasurements holds the latest value of the measurement fields of a
+// user, by field. The fields never measured are missing.
+type LatestMeasurements map[string]MeasuredValue
+
+type MeasurementStore interface {
+	CreateMeasurement(measurement *BodyMeasurement) error
+	GetMeasurement(id int) (*BodyMeasurement, error)
+	// ListMeasurements returns the measurements of a user from the from date
+	// to the to date, both included and either empty for no bound, most recent
+	// first.
+	ListMeasurements(userID int, from, to string) ([]BodyMeasurement, error)
+	UpdateMeasurement(measurement *BodyMeasurement) error
+	DeleteMeasurement(id int) error
+	// GetLatestMeasurements returns the latest value of every field measured
+	// on or before the onOrBefore date, or ever if it is empty.
+	GetLatestMeasurements(userID int, onOrBefore string) (LatestMeasurements, error)
+}
+
+var _ MeasurementStore = (*PostgresMeasurementStore)(nil)
+
+type PostgresMeasurementStore struct {
+	db DBTX
+}
+
+func NewPostgresMeasurementStore(db DBTX) *PostgresMeasurementStore {
+	return &PostgresMeasurementStore{
+		db: db,
+	}
+}
+
+const measurementColumns = `id, user_id, measured_on::text, weight_kg, body_fat_percent, ` +
+	`neck_cm, chest_cm, waist_cm, hips_cm, arm_cm, thigh_cm, calf_cm, notes, created_at, updated_at`
+
+func scanMeasurement(row interface{ Scan(dest ...any) error }, measurement *BodyMeasurement) error {
+	fields := []any{&measurement.ID, &measurement.UserID, &measurement.MeasuredOn}
+	for _, value := range measurement.Values() {
+		fields = append(fields, value)
+	}
+	fields = append(fields, &measurement.Notes, &measurement.CreatedAt, &measurement.UpdatedAt)
+
+	return row.Scan(fields...)
+}
+
+func measurementArgs(measurement *BodyMeasurement) []any {
+	args := []any{measurement.MeasuredOn}
+	for _, value := range measurement.Values() {
+		args = append(args, *value)
+	}
+
+	return append(args, measurement.Notes)
+}
+
+func (ms *PostgresMeasurementStore) CreateMeasurement(measurement *BodyMeasurement) error {
+	query := `
+		INSERT INTO body_measurements (user_id, measured_on, ` + strings.Join(measurementValueColumns, ", ") + `, notes)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		RETURNING id, measured_on::text, created_at, updated_at
+	`
+
+	args := append([]any{measurement.UserID}, measurementArgs(measurement)...)
+
+	return runInTx(ms.db, func(tx DBTX) error {
+		err := tx.QueryRow(query, args...).
+			Scan(&measurement.ID, &measurement.MeasuredOn, &measurement.CreatedAt, &measurement.UpdatedAt)
+		if err != nil {
+			return err
+		}
+
+		return refreshGoals(tx, measurement.UserID)
+	})
+}
+
+func (ms *PostgresMeasurementStore) GetMeasurement(id int) (*BodyMeasurement, error) {
+	measurement := &BodyMeasurement{}
+
+	query := `SELECT ` + measurementColumns + ` FROM body_measurements WHERE id = $1`
+
+	err := scanMeasurement(ms.db.QueryRow(query, id), measurement)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return measurement, nil
+}
+
+func (ms *PostgresMeasurementStore) ListMeasurements(userID int, from, to string) ([]BodyMeasurement, error) {
+	query := `
+		SELECT ` + measurementColumns + `
+		FROM body_measurements
+		WHERE user_id = $1
+			AND ($2::date IS NULL OR measured_on >= $2::date)
+			AND ($3::date IS NULL OR measured_on <= $3::date)
+		ORDER BY measured_on DESC, id DESC
+	`
+
+	measurements := []BodyMeasurement{}
+	err := queryRows(ms.db, query, []any{userID, nullableDate(from), nullableDate(to)}, func(rows *sql.Rows) error {
+		var measurement BodyMeasurement
+		err := scanMeasurement(rows, &measurement)
+		measurements = append(measurements, measurement)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return measurements, nil
+}
+
+func (ms *PostgresMeasurementStore) UpdateMeasurement(measurement *BodyMeasurement) error {
+	query := `
+		UPDATE body_measurements
+		SET measured_on = $1, weight_kg = $2, body_fat_percent = $3,
+			neck_cm = $4, chest_cm = $5, waist_cm = $6, hips_cm = $7, arm_cm = $8, thigh_cm = $9, calf_cm = $10,
+			notes = $11, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $12
+		RETURNING user_id, measured_on::text, created_at, updated_at
+	`
+
+	args := append(measurementArgs(measurement), measurement.ID)
+
+	return runInTx(ms.db, func(tx DBTX) error {
+		err := tx.QueryRow(query, args...).
+			Scan(&measurement.UserID, &measurement.MeasuredOn, &measurement.CreatedAt, &measurement.UpdatedAt)
+		if err != nil {
+			return err
+		}
+
+		return refreshGoals(tx, measurement.UserID)
+	})
+}
+
+func (ms *PostgresMeasurementStore) DeleteMeasurement(id int) error {
+	return runInTx(ms.db, func(tx DBTX) error {
+		var userID int
+		err := tx.QueryRow(`DELETE FROM body_measurements WHERE id = $1 RETURNING user_id`, id).Scan(&userID)
+		if err != nil {
+			return err
+		}
+
+		return refreshGoals(tx, userID)
+	})
+}
+
+func (ms *PostgresMeasurementStore) GetLatestMeasurements(userID int, onOrBefore string) (LatestMeasurements, error) {
+	values := make([]string, len(MeasurementFields))
+	for i, field := range MeasurementFields {
+		values[i] = "('" + field + "', m." + measurementValueColumns[i] + ")"
+	}
+
+	query := `
+		SELECT DISTINCT ON (v.field) v.field, v.value, m.measured_on::text, m.id
+		FROM body_measurements m
+		CROSS JOIN LATERAL (VALUES ` + strings.Join(values, ", ") + `) AS v(field, value)
+		WHERE m.user_id = $1 AND ($2::date IS NULL OR m.measured_on <= $2::date) AND v.value IS NOT NULL
+		ORDER BY v.field, m.measured_on DESC, m.id DESC
+	`
+
+	latest := LatestMeasurements{}
+	err := queryRows(ms.db, query, []any{userID, nullableDate(onOrBefore)}, func(rows *sql.Rows) error {
+		var field string
+		var value MeasuredValue
+		err := rows.Scan(&field, &value.Value, &value.MeasuredOn, &value.MeasurementID)
+		latest[field] = value
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return latest, nil
+}
+
+// nullableDate passes an empty date as NULL.
+func nullableDate(date string) any {
+	if date == "" {
+		return nil
+	}
+
+	return date
+}
@@ -0,0 +1,222 @@
+package store
+
+import (
+	"errors"
+	"maps"
+	"sync"
+
+	"fem-go-crud/internal/auth"
+)
+
+// MemoryDB is a thread-safe in-memory database shared by the in-memory stores.
+// It mirrors the constraints enforced by the Postgres schema (unique columns,
+// foreign keys, check constraints) so that both implementations behave the same.
+type MemoryDB struct {
+	mu sync.RWMutex
+
+	*memoryTables
+
+	// like Postgres sequences, ids are not reused after a rollback
+	lastUserID            int
+	lastWorkoutID         int
+	lastWorkoutExerciseID int
+	lastExerciseID        int
+
+	lastTemplateID         int
+	lastTemplateExerciseID int
+
+	lastProgramID    int
+	lastProgramDayID int
+	lastEnrollmentID int
+
+	lastPersonalRecordID int
+	lastMeasurementID    int
+	lastGoalID           int
+	lastExportID         int
+}
+
+type memoryTables struct {
+	users    map[int]*User
+	tokens   map[string]*auth.Token
+	workouts map[int]*Workout
+
+	exercises map[int]*Exercise
+	templates map[int]*WorkoutTemplate
+
+	// the ids of the workout and template exercises flagged as holding legacy
+	// weights, like their legacy_weight columns
+	legacyWorkoutExercises  map[int]bool
+	legacyTemplateExercises map[int]bool
+
+	// enrollments hold the sessions they completed
+	programs    map[int]*Program
+	enrollments map[int]*Enrollment
+
+	personalRecords map[int]*PersonalRecord
+	measurements    map[int]*BodyMeasurement
+	goals           map[int]*Goal
+
+	// workouts by day, by user id, and the streaks they make
+	trainingDays map[int]map[string]int
+	streaks      map[int]streakRuns
+
+	// revisions of a workout, by workout id, in order
+	workoutRevisions map[int][]*WorkoutRevision
+
+	idempotencyKeys map[string]*IdempotencyRecord
+
+	exports map[int]*Export
+}
+
+func NewMemoryDB() *MemoryDB {
+	return &MemoryDB{
+		memoryTables: &memoryTables{
+			users:    make(map[int]*User),
+			tokens:   make(map[string]*auth.Token),
+			workouts: make(map[int]*Workout),
+
+			exercises: make(map[int]*Exercise),
+			templates: make(map[int]*WorkoutTemplate),
+
+			legacyWorkoutExercises:  make(map[int]bool),
+			legacyTemplateExercises: make(map[int]bool),
+
+			programs:    make(map[int]*Program),
+			enrollments: make(map[int]*Enrollment),
+
+			personalRecords: make(map[int]*PersonalRecord),
+			measurements:    make(map[int]*BodyMeasurement),
+			goals:           make(map[int]*Goal),
+
+			trainingDays: make(map[int]map[string]int),
+			streaks:      make(map[int]streakRuns),
+
+			workoutRevisions: make(map[int][]*WorkoutRevision),
+
+			idempotencyKeys: make(map[string]*IdempotencyRecord),
+
+			exports: make(map[int]*Export),
+		},
+	}
+}
+
+// savepoint runs fn and restores the tables to their previous state if it fails.
+// It must be called with the write lock held.
+func (db *MemoryDB) savepoint(fn func() error) error {
+	snapshot := db.memoryTables.clone()
+
+	err := fn()
+	if err != nil {
+		db.memoryTables = snapshot
+	}
+
+	return err
+}
+
+func (t *memoryTables) clone() *memoryTables {
+	tablesCopy := &memoryTables{
+		users:    make(map[int]*User, len(t.users)),
+		tokens:   make(map[string]*auth.Token, len(t.tokens)),
+		workouts: make(map[int]*Workout, len(t.workouts)),
+
+		exercises: make(map[int]*Exercise, len(t.exercises)),
+		templates: make(map[int]*WorkoutTemplate, len(t.templates)),
+
+		legacyWorkoutExercises:  maps.Clone(t.legacyWorkoutExercises),
+		legacyTemplateExercises: maps.Clone(t.legacyTemplateExercises),
+
+		programs:    make(map[int]*Program, len(t.programs)),
+		enrollments: make(map[int]*Enrollment, len(t.enrollments)),
+
+		personalRecords: make(map[int]*PersonalRecord, len(t.personalRecords)),
+		measurements:    make(map[int]*BodyMeasurement, len(t.measurements)),
+		goals:           make(map[int]*Goal, len(t.goals)),
+
+		trainingDays: make(map[int]map[string]int, len(t.trainingDays)),
+		streaks:      maps.Clone(t.streaks),
+
+		workoutRevisions: make(map[int][]*WorkoutRevision, len(t.workoutRevisions)),
+
+		idempotencyKeys: make(map[string]*IdempotencyRecord, len(t.idempotencyKeys)),
+
+		exports: make(map[int]*Export, len(t.exports)),
+	}
+
+	for id, user := range t.users {
+		tablesCopy.users[id] = copyUser(user)
+	}
+	for hash, token := range t.tokens {
+		tokenCopy := *token
+		tablesCopy.tokens[hash] = &tokenCopy
+	}
+	for id, workout := range t.workouts {
+		tablesCopy.workouts[id] = copyWorkout(workout)
+	}
+	for id, exercise := range t.exercises {
+		tablesCopy.exercises[id] = copyExercise(exercise)
+	}
+	for id, template := range t.templates {
+		tablesCopy.templates[id] = copyTemplate(template)
+	}
+	for id, program := range t.programs {
+		tablesCopy.programs[id] = copyProgram(program)
+	}
+	for id, enrollment := range t.enrollments {
+		tablesCopy.enrollments[id] = copyEnrollment(enrollment)
+	}
+	for id, record := range t.personalRecords {
+		tablesCopy.personalRecords[id] = copyPersonalRecord(record)
+	}
+	for id, measurement := range t.measurements {
+		tablesCopy.measurements[id] = copyMeasurement(measurement)
+	}
+	for id, goal := range t.goals {
+		tablesCopy.goals[id] = copyGoal(goal)
+	}
+	for userID, days := range t.trainingDays {
+		tablesCopy.trainingDays[userID] = maps.Clone(days)
+	}
+	for workoutID, revisions := range t.workoutRevisions {
+		// revisions are immutable, so they can be shared
+		tablesCopy.workoutRevisions[workoutID] = append([]*WorkoutRevision(nil), revisions...)
+	}
+	for key, record := range t.idempotencyKeys {
+		tablesCopy.idempotencyKeys[key] = copyIdempotencyRecord(record)
+	}
+	for id, export := range t.exports {
+		tablesCopy.exports[id] = copyExport(export)
+	}
+
+	return tablesCopy
+}
+
+// memoryConn is the in-memory counterpart of DBTX: outside a transaction every
+// store call takes the database lock, inside one the transaction already holds it.
+type memoryConn struct {
+	*MemoryDB
+	inTx bool
+}
+
+func (c memoryConn) lock() (unlock func()) {
+	if c.inTx {
+		return func() {}
+	}
+
+	c.mu.Lock()
+	return c.mu.Unlock
+}
+
+func (c memoryConn) rlock() (unlock func()) {
+	if c.inTx {
+		return func() {}
+	}
+
+	c.mu.RLock()
+	return c.mu.RUnlock
+}
+
+var (
+	errUniqueViolation     = errors.New("unique constraint violation")
+	errForeignKeyViolation = errors.New("foreign key constraint violation")
+	errCheckViolation      = errors.New("check constraint violation")
+)
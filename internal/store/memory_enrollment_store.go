@@ -0,0 +1,205 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+)
+
+var _ EnrollmentStore = (*InMemoryEnrollmentStore)(nil)
+
+type InMemoryEnrollmentStore struct {
+	db memoryConn
+}
+
+func NewInMemoryEnrollmentStore(db *MemoryDB) *InMemoryEnrollmentStore {
+	return &InMemoryEnrollmentStore{
+		db: memoryConn{MemoryDB: db},
+	}
+}
+
+func (es *InMemoryEnrollmentStore) CreateEnrollment(enrollment *Enrollment) error {
+	unlock := es.db.lock()
+	defer unlock()
+
+	if _, ok := es.db.programs[enrollment.ProgramID]; !ok {
+		return fmt.Errorf("%w: enrollments.program_id", errForeignKeyViolation)
+	}
+	if _, ok := es.db.users[enrollment.UserID]; !ok {
+		return fmt.Errorf("%w: enrollments.user_id", errForeignKeyViolation)
+	}
+
+	startDate, err := time.Parse(time.DateOnly, enrollment.StartDate)
+	if err != nil {
+		return err
+	}
+
+	es.db.lastEnrollmentID++
+	enrollment.ID = es.db.lastEnrollmentID
+	enrollment.StartDate = startDate.Format(time.DateOnly)
+	enrollment.CompletedSessions = nil
+	enrollment.CreatedAt = time.Now()
+
+	es.db.enrollments[enrollment.ID] = copyEnrollment(enrollment)
+
+	return nil
+}
+
+func (es *InMemoryEnrollmentStore) GetEnrollment(id int) (*Enrollment, error) {
+	unlock := es.db.rlock()
+	defer unlock()
+
+	enrollment, ok := es.db.enrollments[id]
+	if !ok {
+		return nil, nil
+	}
+
+	enrollmentCopy := copyEnrollment(enrollment)
+	enrollmentCopy.CompletedSessions = slices.DeleteFunc(enrollmentCopy.CompletedSessions, func(session CompletedSession) bool {
+		_, ok := es.db.activeWorkout(session.WorkoutID)
+		return !ok
+	})
+
+	return enrollmentCopy, nil
+}
+
+func (es *InMemoryEnrollmentStore) ListEnrollments(userID int) ([]Enrollment, error) {
+	unlock := es.db.rlock()
+	defer unlock()
+
+	enrollments := []Enrollment{}
+	for _, enrollment := range es.db.enrollments {
+		if enrollment.UserID == userID {
+			enrollmentCopy := copyEnrollment(enrollment)
+			enrollmentCopy.CompletedSessions = nil
+			enrollments = append(enrollments, *enrollmentCopy)
+		}
+	}
+
+	sort.Slice(enrollments, func(i, j int) bool {
+		if enrollments[i].StartDate != enrollments[j].StartDate {
+			return enrollments[i].StartDate > enrollments[j].StartDate
+		}
+		return enrollments[i].ID > enrollments[j].ID
+	})
+
+	return enrollments, nil
+}
+
+func (es *InMemoryEnrollmentStore) DeleteEnrollment(id int) error {
+	unlock := es.db.lock()
+	defer unlock()
+
+	if _, ok := es.db.enrollments[id]; !ok {
+		return sql.ErrNoRows
+	}
+
+	delete(es.db.enrollments, id)
+
+	return nil
+}
+
+func (es *InMemoryEnrollmentStore) IsEnrolledWithTemplate(userID, templateID int) (bool, error) {
+	unlock := es.db.rlock()
+	defer unlock()
+
+	for _, enrollment := range es.db.enrollments {
+		if enrollment.UserID != userID {
+			continue
+		}
+
+		if slices.ContainsFunc(es.db.programs[enrollment.ProgramID].Days, func(day ProgramDay) bool {
+			return day.TemplateID == templateID
+		}) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (es *InMemoryEnrollmentStore) CompleteSession(enrollmentID, programDayID, workoutID int) error {
+	unlock := es.db.lock()
+	defer unlock()
+
+	enrollment, ok := es.db.enrollments[enrollmentID]
+	if !ok {
+		return fmt.Errorf("%w: enrollment_sessions.enrollment_id", errForeignKeyViolation)
+	}
+	if !es.db.programDayExists(programDayID) {
+		return fmt.Errorf("%w: enrollment_sessions.program_day_id", errForeignKeyViolation)
+	}
+	if _, ok := es.db.workouts[workoutID]; !ok {
+		return fmt.Errorf("%w: enrollment_sessions.workout_id", errForeignKeyViolation)
+	}
+
+	for _, otherEnrollment := range es.db.enrollments {
+		if slices.ContainsFunc(otherEnrollment.CompletedSessions, func(session CompletedSession) bool {
+			return session.WorkoutID == workoutID && (otherEnrollment.ID != enrollmentID || session.ProgramDayID != programDayID)
+		}) {
+			return fmt.Errorf("%w: enrollment_sessions_workout_id_key", ErrWorkoutAlreadyLinked)
+		}
+	}
+
+	enrollment.CompletedSessions = slices.DeleteFunc(enrollment.CompletedSessions, func(session CompletedSession) bool {
+		return session.ProgramDayID == programDayID
+	})
+	enrollment.CompletedSessions = append(enrollment.CompletedSessions, CompletedSession{ProgramDayID: programDayID, WorkoutID: workoutID})
+
+	return nil
+}
+
+func (es *InMemoryEnrollmentStore) UncompleteSession(enrollmentID, programDayID int) error {
+	unlock := es.db.lock()
+	defer unlock()
+
+	enrollment, ok := es.db.enrollments[enrollmentID]
+	if !ok || !slices.ContainsFunc(enrollment.CompletedSessions, func(session CompletedSession) bool {
+		return session.ProgramDayID == programDayID
+	}) {
+		return sql.ErrNoRows
+	}
+
+	enrollment.CompletedSessions = slices.DeleteFunc(enrollment.CompletedSessions, func(session CompletedSession) bool {
+		return session.ProgramDayID == programDayID
+	})
+
+	return nil
+}
+
+// programDayExists must be called with the lock held.
+func (db *MemoryDB) programDayExists(id int) bool {
+	for _, program := range db.programs {
+		if slices.ContainsFunc(program.Days, func(day ProgramDay) bool {
+			return day.ID == id
+		}) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// uncompleteSessions deletes the completed sessions that match, like the
+// ON DELETE CASCADE of enrollment_sessions. It must be called with the lock held.
+func (db *MemoryDB) uncompleteSessions(match func(session CompletedSession) bool) {
+	for _, enrollment := range db.enrollments {
+		enrollment.CompletedSessions = slices.DeleteFunc(enrollment.CompletedSessions, match)
+	}
+}
+
+func copyEnrollment(enrollment *Enrollment) *Enrollment {
+	enrollmentCopy := *enrollment
+	enrollmentCopy.CompletedSessions = slices.Clone(enrollment.CompletedSessions)
+	if enrollmentCopy.CompletedSessions == nil {
+		enrollmentCopy.CompletedSessions = []CompletedSession{}
+	}
+
+	sort.Slice(enrollmentCopy.CompletedSessions, func(i, j int) bool {
+		return enrollmentCopy.CompletedSessions[i].ProgramDayID < enrollmentCopy.CompletedSessions[j].ProgramDayID
+	})
+
+	return &enrollmentCopy
+}
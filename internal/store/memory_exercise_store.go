@@ -0,0 +1,304 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+var _ ExerciseStore = (*InMemoryExerciseStore)(nil)
+
+type InMemoryExerciseStore struct {
+	db memoryConn
+}
+
+func NewInMemoryExerciseStore(db *MemoryDB) *InMemoryExerciseStore {
+	return &InMemoryExerciseStore{
+		db: memoryConn{MemoryDB: db},
+	}
+}
+
+func (es *InMemoryExerciseStore) SeedExercises(exercises []Exercise) error {
+	unlock := es.db.lock()
+	defer unlock()
+
+	for _, exercise := range exercises {
+		err := checkExercise(&exercise)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, exercise := range exercises {
+		existingExercise := es.db.exerciseNamed(nil, exercise.Name)
+		if existingExercise == nil {
+			es.db.insertExercise(&exercise)
+			continue
+		}
+
+		if !sameExerciseDefinition(*existingExercise, exercise) {
+			setExerciseDefinition(existingExercise, exercise)
+			existingExercise.UpdatedAt = time.Now()
+		}
+	}
+
+	return nil
+}
+
+func (es *InMemoryExerciseStore) CreateExercise(exercise *Exercise) error {
+	unlock := es.db.lock()
+	defer unlock()
+
+	if exercise.UserID != nil {
+		if _, ok := es.db.users[*exercise.UserID]; !ok {
+			return fmt.Errorf("%w: exercises.user_id", errForeignKeyViolation)
+		}
+	}
+
+	err := checkExercise(exercise)
+	if err != nil {
+		return err
+	}
+
+	if es.db.exerciseNamed(exercise.UserID, exercise.Name) != nil {
+		return fmt.Errorf("%w: exercises_custom_name_idx", ErrDuplicateExerciseName)
+	}
+
+	es.db.insertExercise(exercise)
+
+	return nil
+}
+
+func (es *InMemoryExerciseStore) GetExercise(id int) (*Exercise, error) {
+	unlock := es.db.rlock()
+	defer unlock()
+
+	exercise, ok := es.db.exercises[id]
+	if !ok {
+		return nil, nil
+	}
+
+	return copyExercise(exercise), nil
+}
+
+func (es *InMemoryExerciseStore) GetExercises(ids []int) ([]Exercise, error) {
+	unlock := es.db.rlock()
+	defer unlock()
+
+	exercises := []Exercise{}
+	for _, id := range slices.Compact(slices.Sorted(slices.Values(ids))) {
+		if exercise, ok := es.db.exercises[id]; ok {
+			exercises = append(exercises, *copyExercise(exercise))
+		}
+	}
+
+	return exercises, nil
+}
+
+func (es *InMemoryExerciseStore) UpdateExercise(exercise *Exercise) error {
+	unlock := es.db.lock()
+	defer unlock()
+
+	existingExercise, ok := es.db.exercises[exercise.ID]
+	if !ok || existingExercise.UserID == nil {
+		return sql.ErrNoRows
+	}
+
+	err := checkExercise(exercise)
+	if err != nil {
+		return err
+	}
+
+	namesake := es.db.exerciseNamed(existingExercise.UserID, exercise.Name)
+	if namesake != nil && namesake.ID != exercise.ID {
+		return fmt.Errorf("%w: exercises_custom_name_idx", ErrDuplicateExerciseName)
+	}
+
+	setExerciseDefinition(existingExercise, *exercise)
+	existingExercise.UpdatedAt = time.Now()
+	*exercise = *copyExercise(existingExercise)
+
+	return nil
+}
+
+func (es *InMemoryExerciseStore) DeleteExercise(id int) error {
+	unlock := es.db.lock()
+	defer unlock()
+
+	exercise, ok := es.db.exercises[id]
+	if !ok || exercise.UserID == nil {
+		return sql.ErrNoRows
+	}
+
+	es.db.deleteExercise(id)
+
+	return nil
+}
+
+func (es *InMemoryExerciseStore) SearchExercises(userID int, filter ExerciseFilter) ([]Exercise, error) {
+	unlock := es.db.rlock()
+	defer unlock()
+
+	query := strings.ToLower(filter.Query)
+	exercises := []Exercise{}
+	for _, exercise := range es.db.exercises {
+		if (exercise.UserID == nil && filter.CustomOnly) || (exercise.UserID != nil && *exercise.UserID != userID) {
+			continue
+		}
+		if query != "" && !slices.ContainsFunc(exerciseNames(exercise), func(name string) bool {
+			return strings.Contains(name, query)
+		}) {
+			continue
+		}
+		if filter.Muscle != "" && !slices.Contains(exercise.PrimaryMuscles, filter.Muscle) && !slices.Contains(exercise.SecondaryMuscles, filter.Muscle) {
+			continue
+		}
+		if (filter.Equipment != "" && exercise.Equipment != filter.Equipment) ||
+			(filter.MovementType != "" && exercise.MovementType != filter.MovementType) ||
+			(filter.Tracking != "" && exercise.Tracking != filter.Tracking) {
+			continue
+		}
+
+		exercises = append(exercises, *copyExercise(exercise))
+	}
+
+	rank := func(exercise Exercise) int {
+		switch {
+		case slices.Contains(exerciseNames(&exercise), query):
+			return 0
+		case strings.HasPrefix(strings.ToLower(exercise.Name), query):
+			return 1
+		default:
+			return 2
+		}
+	}
+
+	sort.Slice(exercises, func(i, j int) bool {
+		if rankI, rankJ := rank(exercises[i]), rank(exercises[j]); rankI != rankJ {
+			return rankI < rankJ
+		}
+		if nameI, nameJ := strings.ToLower(exercises[i].Name), strings.ToLower(exercises[j].Name); nameI != nameJ {
+			return nameI < nameJ
+		}
+		return exercises[i].ID < exercises[j].ID
+	})
+
+	if filter.Limit > 0 && len(exercises) > filter.Limit {
+		exercises = exercises[:filter.Limit]
+	}
+
+	return exercises, nil
+}
+
+// exerciseNamed returns the catalog exercise, or the custom exercise of userID,
+// with the given name. Like insertExercise and deleteExercise, it must be
+// called with the lock held.
+func (db *MemoryDB) exerciseNamed(userID *int, name string) *Exercise {
+	for _, exercise := range db.exercises {
+		if equalPtr(exercise.UserID, userID) && strings.EqualFold(exercise.Name, name) {
+			return exercise
+		}
+	}
+
+	return nil
+}
+
+func (db *MemoryDB) insertExercise(exercise *Exercise) {
+	db.lastExerciseID++
+	exercise.ID = db.lastExerciseID
+	exercise.Aliases = textArray(exercise.Aliases)
+	exercise.PrimaryMuscles = textArray(exercise.PrimaryMuscles)
+	exercise.SecondaryMuscles = textArray(exercise.SecondaryMuscles)
+	exercise.CreatedAt = time.Now()
+	exercise.UpdatedAt = exercise.CreatedAt
+
+	db.exercises[exercise.ID] = copyExercise(exercise)
+}
+
+// deleteExercise unlinks the workout and template exercises, the personal
+// records and the goals that referenced the exercise, like the ON DELETE SET NULL of their
+// exercise_id.
+func (db *MemoryDB) deleteExercise(id int) {
+	for _, workout := range db.workouts {
+		unlinkExercise(workout.Exercises, id)
+	}
+	for _, template := range db.templates {
+		unlinkExercise(template.Exercises, id)
+	}
+	for _, record := range db.personalRecords {
+		if equalPtr(record.ExerciseID, &id) {
+			record.ExerciseID = nil
+		}
+	}
+	for _, goal := range db.goals {
+		if equalPtr(goal.ExerciseID, &id) {
+			goal.ExerciseID = nil
+		}
+	}
+
+	delete(db.exercises, id)
+}
+
+func unlinkExercise(exercises []WorkoutExercise, id int) {
+	for i := range exercises {
+		if equalPtr(exercises[i].ExerciseID, &id) {
+			exercises[i].ExerciseID = nil
+		}
+	}
+}
+
+func checkExercise(exercise *Exercise) error {
+	if exercise.Tracking != ExerciseTrackingReps && exercise.Tracking != ExerciseTrackingTime {
+		return fmt.Errorf("%w: exercises.tracking_in_reps_or_time", errCheckViolation)
+	}
+
+	return nil
+}
+
+// exerciseNames returns the lowercased name and aliases of an exercise.
+func exerciseNames(exercise *Exercise) []string {
+	names := []string{strings.ToLower(exercise.Name)}
+	for _, alias := range exercise.Aliases {
+		names = append(names, strings.ToLower(alias))
+	}
+
+	return names
+}
+
+func sameExerciseDefinition(a, b Exercise) bool {
+	return a.Name == b.Name &&
+		slices.Equal(a.Aliases, textArray(b.Aliases)) &&
+		slices.Equal(a.PrimaryMuscles, textArray(b.PrimaryMuscles)) &&
+		slices.Equal(a.SecondaryMuscles, textArray(b.SecondaryMuscles)) &&
+		a.Equipment == b.Equipment &&
+		a.MovementType == b.MovementType &&
+		a.Tracking == b.Tracking
+}
+
+func setExerciseDefinition(exercise *Exercise, definition Exercise) {
+	exercise.Name = definition.Name
+	exercise.Aliases = slices.Clone(textArray(definition.Aliases))
+	exercise.PrimaryMuscles = slices.Clone(textArray(definition.PrimaryMuscles))
+	exercise.SecondaryMuscles = slices.Clone(textArray(definition.SecondaryMuscles))
+	exercise.Equipment = definition.Equipment
+	exercise.MovementType = definition.MovementType
+	exercise.Tracking = definition.Tracking
+}
+
+func copyExercise(exercise *Exercise) *Exercise {
+	exerciseCopy := *exercise
+
+	if exercise.UserID != nil {
+		userID := *exercise.UserID
+		exerciseCopy.UserID = &userID
+	}
+
+	exerciseCopy.Aliases = slices.Clone(exercise.Aliases)
+	exerciseCopy.PrimaryMuscles = slices.Clone(exercise.PrimaryMuscles)
+	exerciseCopy.SecondaryMuscles = slices.Clone(exercise.SecondaryMuscles)
+
+	return &exerciseCopy
+}
@@ -0,0 +1,136 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"time"
+)
+
+var _ ExportStore = (*InMemoryExportStore)(nil)
+
+type InMemoryExportStore struct {
+	db memoryConn
+}
+
+func NewInMemoryExportStore(db *MemoryDB) *InMemoryExportStore {
+	return &InMemoryExportStore{
+		db: memoryConn{MemoryDB: db},
+	}
+}
+
+func (es *InMemoryExportStore) CreateExport(export *Export) error {
+	unlock := es.db.lock()
+	defer unlock()
+
+	if _, ok := es.db.users[export.UserID]; !ok {
+		return fmt.Errorf("%w: exports.user_id", errForeignKeyViolation)
+	}
+
+	es.db.lastExportID++
+	*export = Export{
+		ID:        es.db.lastExportID,
+		UserID:    export.UserID,
+		Status:    ExportPending,
+		CreatedAt: time.Now(),
+	}
+
+	es.db.exports[export.ID] = copyExport(export)
+
+	return nil
+}
+
+func (es *InMemoryExportStore) GetExport(id int) (*Export, error) {
+	unlock := es.db.rlock()
+	defer unlock()
+
+	export, ok := es.db.exports[id]
+	if !ok {
+		return nil, nil
+	}
+
+	return copyExport(export), nil
+}
+
+func (es *InMemoryExportStore) GetCurrentExport(userID int, since time.Time) (*Export, error) {
+	unlock := es.db.rlock()
+	defer unlock()
+
+	var current *Export
+	for _, export := range es.db.exports {
+		if export.UserID != userID || export.CreatedAt.Before(since) || export.Status == ExportFailed {
+			continue
+		}
+
+		if current == nil || export.CreatedAt.After(current.CreatedAt) ||
+			export.CreatedAt.Equal(current.CreatedAt) && export.ID > current.ID {
+			current = export
+		}
+	}
+
+	if current == nil {
+		return nil, nil
+	}
+
+	return copyExport(current), nil
+}
+
+func (es *InMemoryExportStore) FinishExport(export *Export) error {
+	unlock := es.db.lock()
+	defer unlock()
+
+	storedExport, ok := es.db.exports[export.ID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	if !slices.Contains(ExportStatuses, export.Status) {
+		return fmt.Errorf("%w: exports.export_status", errCheckViolation)
+	}
+
+	completedAt := time.Now()
+	finishedExport := copyExport(export)
+	finishedExport.UserID = storedExport.UserID
+	finishedExport.CreatedAt = storedExport.CreatedAt
+	finishedExport.CompletedAt = &completedAt
+	es.db.exports[export.ID] = finishedExport
+
+	*export = *copyExport(finishedExport)
+
+	return nil
+}
+
+func (es *InMemoryExportStore) DeleteExpiredExports(expiredBefore, pendingBefore time.Time) (int, error) {
+	unlock := es.db.lock()
+	defer unlock()
+
+	deleted := 0
+	for id, export := range es.db.exports {
+		if export.ExpiresAt != nil && export.ExpiresAt.Before(expiredBefore) ||
+			export.Status == ExportPending && export.CreatedAt.Before(pendingBefore) {
+			delete(es.db.exports, id)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+func copyExport(export *Export) *Export {
+	exportCopy := *export
+
+	if export.SizeBytes != nil {
+		sizeBytes := *export.SizeBytes
+		exportCopy.SizeBytes = &sizeBytes
+	}
+	if export.CompletedAt != nil {
+		completedAt := *export.CompletedAt
+		exportCopy.CompletedAt = &completedAt
+	}
+	if export.ExpiresAt != nil {
+		expiresAt := *export.ExpiresAt
+		exportCopy.ExpiresAt = &expiresAt
+	}
+
+	return &exportCopy
+}
@@ -0,0 +1,295 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+)
+
+var _ GoalStore = (*InMemoryGoalStore)(nil)
+
+type InMemoryGoalStore struct {
+	db memoryConn
+}
+
+func NewInMemoryGoalStore(db *MemoryDB) *InMemoryGoalStore {
+	return &InMemoryGoalStore{
+		db: memoryConn{MemoryDB: db},
+	}
+}
+
+func (gs *InMemoryGoalStore) CreateGoal(goal *Goal) error {
+	unlock := gs.db.lock()
+	defer unlock()
+
+	if _, ok := gs.db.users[goal.UserID]; !ok {
+		return fmt.Errorf("%w: goals.user_id", errForeignKeyViolation)
+	}
+	if goal.ExerciseID != nil {
+		if _, ok := gs.db.exercises[*goal.ExerciseID]; !ok {
+			return fmt.Errorf("%w: goals.exercise_id", errForeignKeyViolation)
+		}
+	}
+
+	if goal.StartsOn == "" {
+		goal.StartsOn = gs.db.userToday(goal.UserID)
+	}
+	err := checkGoal(goal)
+	if err != nil {
+		return err
+	}
+
+	gs.db.lastGoalID++
+	goal.ID = gs.db.lastGoalID
+	goal.CurrentValue = 0
+	goal.AchievedAt = nil
+	goal.CreatedAt = time.Now()
+	goal.UpdatedAt = goal.CreatedAt
+
+	gs.db.goals[goal.ID] = copyGoal(goal)
+	gs.db.refreshGoals(goal.UserID)
+
+	*goal = *copyGoal(gs.db.goals[goal.ID])
+	goal.Evaluate(gs.db.userToday(goal.UserID))
+
+	return nil
+}
+
+func (gs *InMemoryGoalStore) GetGoal(id int) (*Goal, error) {
+	unlock := gs.db.rlock()
+	defer unlock()
+
+	goal, ok := gs.db.goals[id]
+	if !ok {
+		return nil, nil
+	}
+
+	goalCopy := copyGoal(goal)
+	goalCopy.Evaluate(gs.db.userToday(goal.UserID))
+
+	return goalCopy, nil
+}
+
+func (gs *InMemoryGoalStore) ListGoals(userID int) ([]Goal, error) {
+	unlock := gs.db.rlock()
+	defer unlock()
+
+	goals := []Goal{}
+	today := gs.db.userToday(userID)
+	for _, goal := range gs.db.userGoals(userID) {
+		goalCopy := copyGoal(goal)
+		goalCopy.Evaluate(today)
+		goals = append(goals, *goalCopy)
+	}
+
+	return goals, nil
+}
+
+func (gs *InMemoryGoalStore) UpdateGoal(goal *Goal) error {
+	unlock := gs.db.lock()
+	defer unlock()
+
+	existingGoal, ok := gs.db.goals[goal.ID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if goal.ExerciseID != nil {
+		if _, ok := gs.db.exercises[*goal.ExerciseID]; !ok {
+			return fmt.Errorf("%w: goals.exercise_id", errForeignKeyViolation)
+		}
+	}
+
+	if goal.StartsOn == "" {
+		goal.StartsOn = existingGoal.StartsOn
+	}
+	err := checkGoal(goal)
+	if err != nil {
+		return err
+	}
+
+	goal.UserID = existingGoal.UserID
+	goal.CurrentValue = existingGoal.CurrentValue
+	goal.AchievedAt = existingGoal.AchievedAt
+	goal.CreatedAt = existingGoal.CreatedAt
+	goal.UpdatedAt = time.Now()
+
+	gs.db.goals[goal.ID] = copyGoal(goal)
+	gs.db.refreshGoals(goal.UserID)
+
+	*goal = *copyGoal(gs.db.goals[goal.ID])
+	goal.Evaluate(gs.db.userToday(goal.UserID))
+
+	return nil
+}
+
+func (gs *InMemoryGoalStore) DeleteGoal(id int) error {
+	unlock := gs.db.lock()
+	defer unlock()
+
+	if _, ok := gs.db.goals[id]; !ok {
+		return sql.ErrNoRows
+	}
+
+	delete(gs.db.goals, id)
+
+	return nil
+}
+
+// userGoals returns the goals of a user in the order of listGoals. It must be
+// called with the lock held.
+func (db *MemoryDB) userGoals(userID int) []*Goal {
+	var goals []*Goal
+	for _, goal := range db.goals {
+		if goal.UserID == userID {
+			goals = append(goals, goal)
+		}
+	}
+
+	sort.Slice(goals, func(i, j int) bool {
+		if (goals[i].Deadline == nil) != (goals[j].Deadline == nil) {
+			return goals[j].Deadline == nil
+		}
+		if goals[i].Deadline != nil && *goals[i].Deadline != *goals[j].Deadline {
+			return *goals[i].Deadline < *goals[j].Deadline
+		}
+		return goals[i].ID < goals[j].ID
+	})
+
+	return goals
+}
+
+// refreshGoals mirrors refreshGoals. It must be called with the write lock
+// held.
+func (db *MemoryDB) refreshGoals(userID int) {
+	goals := db.userGoals(userID)
+	if len(goals) == 0 {
+		return
+	}
+
+	records := db.personalRecordsOf(userID)
+
+	for _, goal := range goals {
+		var totals workoutTotals
+		if goal.countsWorkouts() {
+			for _, workout := range db.workouts {
+				if workout.UserID != userID || workout.DeletedAt != nil {
+					continue
+				}
+
+				startedOn := localDay(workout.StartedAt, db.users[userID].TimeZone)
+				if startedOn < goal.StartsOn || (goal.Deadline != nil && startedOn > *goal.Deadline) {
+					continue
+				}
+
+				totals.workouts++
+				totals.durationMinutes += workout.DurationMinutes
+				totals.caloriesBurned += valueOrZero(workout.CaloriesBurned)
+			}
+		}
+
+		var bodyWeight *float64
+		if goal.Kind == GoalBodyWeight {
+			if user, ok := db.users[userID]; ok {
+				bodyWeight = user.BodyWeightKg
+			}
+			var deadline string
+			if goal.Deadline != nil {
+				deadline = *goal.Deadline
+			}
+			for _, measurement := range db.userMeasurements(userID, deadline) {
+				if measurement.WeightKg != nil {
+					bodyWeight = measurement.WeightKg
+					break
+				}
+			}
+		}
+
+		goal.CurrentValue = goal.value(records, totals, bodyWeight, db.users[userID].TimeZone)
+		if !goal.reached(goal.CurrentValue) {
+			goal.AchievedAt = nil
+		} else if goal.AchievedAt == nil {
+			achievedAt := time.Now()
+			goal.AchievedAt = &achievedAt
+		}
+	}
+}
+
+// userToday mirrors userToday. It must be called with the lock held.
+func (db *MemoryDB) userToday(userID int) string {
+	var timeZone string
+	if user, ok := db.users[userID]; ok {
+		timeZone = user.TimeZone
+	}
+
+	return localDay(time.Now(), timeZone)
+}
+
+// checkGoal mirrors the check constraints of goals, and normalizes the dates
+// like DATE columns.
+func checkGoal(goal *Goal) error {
+	startsOn, err := time.Parse(time.DateOnly, goal.StartsOn)
+	if err != nil {
+		return err
+	}
+	goal.StartsOn = startsOn.Format(time.DateOnly)
+
+	if goal.Deadline != nil {
+		deadline, err := time.Parse(time.DateOnly, *goal.Deadline)
+		if err != nil {
+			return err
+		}
+		formatted := deadline.Format(time.DateOnly)
+		goal.Deadline = &formatted
+
+		if deadline.Before(startsOn) {
+			return fmt.Errorf("%w: goals.deadline_after_start", errCheckViolation)
+		}
+	}
+
+	if !slices.Contains(GoalKinds, goal.Kind) {
+		return fmt.Errorf("%w: goals.goal_kind_known", errCheckViolation)
+	}
+	if goal.Target <= 0 {
+		return fmt.Errorf("%w: goals.target_positive", errCheckViolation)
+	}
+	if slices.Contains(ExerciseGoalKinds, goal.Kind) && goal.ExerciseName == "" {
+		return fmt.Errorf("%w: goals.exercise_goal_named", errCheckViolation)
+	}
+	if goal.Kind == GoalFrequency && goal.Deadline == nil {
+		return fmt.Errorf("%w: goals.frequency_goal_deadline", errCheckViolation)
+	}
+	if (goal.Kind == GoalBodyWeight) != (goal.StartValue != nil) {
+		return fmt.Errorf("%w: goals.body_weight_goal_start", errCheckViolation)
+	}
+
+	return nil
+}
+
+func copyGoal(goal *Goal) *Goal {
+	goalCopy := *goal
+
+	if goal.ExerciseID != nil {
+		exerciseID := *goal.ExerciseID
+		goalCopy.ExerciseID = &exerciseID
+	}
+	if goal.Weight != nil {
+		weight := *goal.Weight
+		goalCopy.Weight = &weight
+	}
+	if goal.StartValue != nil {
+		startValue := *goal.StartValue
+		goalCopy.StartValue = &startValue
+	}
+	if goal.Deadline != nil {
+		deadline := *goal.Deadline
+		goalCopy.Deadline = &deadline
+	}
+	if goal.AchievedAt != nil {
+		achievedAt := *goal.AchievedAt
+		goalCopy.AchievedAt = &achievedAt
+	}
+
+	return &goalCopy
+}
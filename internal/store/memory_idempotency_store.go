@@ -0,0 +1,97 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+var _ IdempotencyStore = (*InMemoryIdempotencyStore)(nil)
+
+type InMemoryIdempotencyStore struct {
+	db memoryConn
+}
+
+func NewInMemoryIdempotencyStore(db *MemoryDB) *InMemoryIdempotencyStore {
+	return &InMemoryIdempotencyStore{
+		db: memoryConn{MemoryDB: db},
+	}
+}
+
+func (is *InMemoryIdempotencyStore) ReserveIdempotencyKey(record *IdempotencyRecord) (*IdempotencyRecord, error) {
+	unlock := is.db.lock()
+	defer unlock()
+
+	if _, ok := is.db.users[record.UserID]; !ok && record.UserID != 0 {
+		return nil, fmt.Errorf("%w: idempotency_keys.user_id", errForeignKeyViolation)
+	}
+
+	key := idempotencyRecordKey(record.UserID, record.Key)
+
+	existingRecord, ok := is.db.idempotencyKeys[key]
+	if ok && existingRecord.ExpiresAt.After(time.Now()) {
+		return copyIdempotencyRecord(existingRecord), nil
+	}
+
+	is.db.idempotencyKeys[key] = &IdempotencyRecord{
+		UserID:      record.UserID,
+		Key:         record.Key,
+		Fingerprint: append([]byte(nil), record.Fingerprint...),
+		ExpiresAt:   record.ExpiresAt,
+	}
+
+	return nil, nil
+}
+
+func (is *InMemoryIdempotencyStore) CompleteIdempotencyKey(record *IdempotencyRecord) error {
+	unlock := is.db.lock()
+	defer unlock()
+
+	existingRecord, ok := is.db.idempotencyKeys[idempotencyRecordKey(record.UserID, record.Key)]
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	existingRecord.ResponseStatus = record.ResponseStatus
+	existingRecord.ResponseHeaders = record.ResponseHeaders.Clone()
+	existingRecord.ResponseBody = append([]byte(nil), record.ResponseBody...)
+
+	return nil
+}
+
+func (is *InMemoryIdempotencyStore) ReleaseIdempotencyKey(userID int, key string) error {
+	unlock := is.db.lock()
+	defer unlock()
+
+	delete(is.db.idempotencyKeys, idempotencyRecordKey(userID, key))
+
+	return nil
+}
+
+func (is *InMemoryIdempotencyStore) DeleteExpiredIdempotencyKeys(now time.Time) (int, error) {
+	unlock := is.db.lock()
+	defer unlock()
+
+	deleted := 0
+	for key, record := range is.db.idempotencyKeys {
+		if !record.ExpiresAt.After(now) {
+			delete(is.db.idempotencyKeys, key)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+func idempotencyRecordKey(userID int, key string) string {
+	return fmt.Sprintf("%d:%s", userID, key)
+}
+
+func copyIdempotencyRecord(record *IdempotencyRecord) *IdempotencyRecord {
+	recordCopy := *record
+	recordCopy.Fingerprint = append([]byte(nil), record.Fingerprint...)
+	recordCopy.ResponseHeaders = record.ResponseHeaders.Clone()
+	recordCopy.ResponseBody = append([]byte(nil), record.ResponseBody...)
+
+	return &recordCopy
+}
@@ -0,0 +1,195 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+)
+
+var _ MeasurementStore = (*InMemoryMeasurementStore)(nil)
+
+type InMemoryMeasurementStore struct {
+	db memoryConn
+}
+
+func NewInMemoryMeasurementStore(db *MemoryDB) *InMemoryMeasurementStore {
+	return &InMemoryMeasurementStore{
+		db: memoryConn{MemoryDB: db},
+	}
+}
+
+func (ms *InMemoryMeasurementStore) CreateMeasurement(measurement *BodyMeasurement) error {
+	unlock := ms.db.lock()
+	defer unlock()
+
+	if _, ok := ms.db.users[measurement.UserID]; !ok {
+		return fmt.Errorf("%w: body_measurements.user_id", errForeignKeyViolation)
+	}
+
+	err := checkMeasurement(measurement)
+	if err != nil {
+		return err
+	}
+
+	ms.db.lastMeasurementID++
+	measurement.ID = ms.db.lastMeasurementID
+	measurement.CreatedAt = time.Now()
+	measurement.UpdatedAt = measurement.CreatedAt
+
+	ms.db.measurements[measurement.ID] = copyMeasurement(measurement)
+	ms.db.refreshGoals(measurement.UserID)
+
+	return nil
+}
+
+func (ms *InMemoryMeasurementStore) GetMeasurement(id int) (*BodyMeasurement, error) {
+	unlock := ms.db.rlock()
+	defer unlock()
+
+	measurement, ok := ms.db.measurements[id]
+	if !ok {
+		return nil, nil
+	}
+
+	return copyMeasurement(measurement), nil
+}
+
+func (ms *InMemoryMeasurementStore) ListMeasurements(userID int, from, to string) ([]BodyMeasurement, error) {
+	unlock := ms.db.rlock()
+	defer unlock()
+
+	measurements := []BodyMeasurement{}
+	for _, measurement := range ms.db.userMeasurements(userID, to) {
+		if from == "" || measurement.MeasuredOn >= from {
+			measurements = append(measurements, *copyMeasurement(measurement))
+		}
+	}
+
+	return measurements, nil
+}
+
+func (ms *InMemoryMeasurementStore) UpdateMeasurement(measurement *BodyMeasurement) error {
+	unlock := ms.db.lock()
+	defer unlock()
+
+	existingMeasurement, ok := ms.db.measurements[measurement.ID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	err := checkMeasurement(measurement)
+	if err != nil {
+		return err
+	}
+
+	measurement.UserID = existingMeasurement.UserID
+	measurement.CreatedAt = existingMeasurement.CreatedAt
+	measurement.UpdatedAt = time.Now()
+
+	ms.db.measurements[measurement.ID] = copyMeasurement(measurement)
+	ms.db.refreshGoals(measurement.UserID)
+
+	return nil
+}
+
+func (ms *InMemoryMeasurementStore) DeleteMeasurement(id int) error {
+	unlock := ms.db.lock()
+	defer unlock()
+
+	measurement, ok := ms.db.measurements[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	delete(ms.db.measurements, id)
+	ms.db.refreshGoals(measurement.UserID)
+
+	return nil
+}
+
+func (ms *InMemoryMeasurementStore) GetLatestMeasurements(userID int, onOrBefore string) (LatestMeasurements, error) {
+	unlock := ms.db.rlock()
+	defer unlock()
+
+	latest := LatestMeasurements{}
+	for _, measurement := range ms.db.userMeasurements(userID, onOrBefore) {
+		for i, value := range measurement.Values() {
+			if _, ok := latest[MeasurementFields[i]]; !ok && *value != nil {
+				latest[MeasurementFields[i]] = MeasuredValue{
+					Value:         **value,
+					MeasuredOn:    measurement.MeasuredOn,
+					MeasurementID: measurement.ID,
+				}
+			}
+		}
+	}
+
+	return latest, nil
+}
+
+// userMeasurements returns the measurements of a user up to the to date, if
+// any, most recent first. It must be called with the lock held.
+func (db *MemoryDB) userMeasurements(userID int, to string) []*BodyMeasurement {
+	var measurements []*BodyMeasurement
+	for _, measurement := range db.measurements {
+		if measurement.UserID == userID && (to == "" || measurement.MeasuredOn <= to) {
+			measurements = append(measurements, measurement)
+		}
+	}
+
+	sort.Slice(measurements, func(i, j int) bool {
+		if measurements[i].MeasuredOn != measurements[j].MeasuredOn {
+			return measurements[i].MeasuredOn > measurements[j].MeasuredOn
+		}
+		return measurements[i].ID > measurements[j].ID
+	})
+
+	return measurements
+}
+
+// checkMeasurement mirrors the check constraints of body_measurements, and
+// normalizes MeasuredOn like a DATE column.
+func checkMeasurement(measurement *BodyMeasurement) error {
+	measuredOn, err := time.Parse(time.DateOnly, measurement.MeasuredOn)
+	if err != nil {
+		return err
+	}
+	measurement.MeasuredOn = measuredOn.Format(time.DateOnly)
+
+	if measurement.WeightKg != nil && *measurement.WeightKg <= 0 {
+		return fmt.Errorf("%w: body_measurements.weight_kg_positive", errCheckViolation)
+	}
+	if fat := measurement.BodyFatPercent; fat != nil && (*fat <= 0 || *fat >= 100) {
+		return fmt.Errorf("%w: body_measurements.body_fat_percent_range", errCheckViolation)
+	}
+
+	measured := 0
+	for i, value := range measurement.Values() {
+		if *value == nil {
+			continue
+		}
+		measured++
+		if i >= 2 && **value <= 0 {
+			return fmt.Errorf("%w: body_measurements.circumferences_positive", errCheckViolation)
+		}
+	}
+	if measured == 0 {
+		return fmt.Errorf("%w: body_measurements.measurement_not_empty", errCheckViolation)
+	}
+
+	return nil
+}
+
+func copyMeasurement(measurement *BodyMeasurement) *BodyMeasurement {
+	measurementCopy := *measurement
+
+	for _, value := range measurementCopy.Values() {
+		if *value != nil {
+			valueCopy := **value
+			*value = &valueCopy
+		}
+	}
+
+	return &measurementCopy
+}
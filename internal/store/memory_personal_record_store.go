@@ -0,0 +1,140 @@
+package store
+
+import (
+	"sort"
+	"time"
+)
+
+var _ PersonalRecordStore = (*InMemoryPersonalRecordStore)(nil)
+
+type InMemoryPersonalRecordStore struct {
+	db memoryConn
+}
+
+func NewInMemoryPersonalRecordStore(db *MemoryDB) *InMemoryPersonalRecordStore {
+	return &InMemoryPersonalRecordStore{
+		db: memoryConn{MemoryDB: db},
+	}
+}
+
+func (rs *InMemoryPersonalRecordStore) ListPersonalRecords(userID int, history bool) ([]PersonalRecord, error) {
+	unlock := rs.db.rlock()
+	defer unlock()
+
+	records := rs.db.personalRecordsOf(userID)
+	if history {
+		return records, nil
+	}
+
+	return currentRecords(records), nil
+}
+
+// personalRecordsOf mirrors getPersonalRecords. It must be called with the
+// lock held.
+func (db *MemoryDB) personalRecordsOf(userID int) []PersonalRecord {
+	records := []PersonalRecord{}
+	for _, record := range db.personalRecords {
+		if _, ok := db.activeWorkout(record.WorkoutID); ok && record.UserID == userID {
+			records = append(records, *copyPersonalRecord(record))
+		}
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		if !records[i].AchievedAt.Equal(records[j].AchievedAt) {
+			return records[i].AchievedAt.After(records[j].AchievedAt)
+		}
+		return records[i].ID > records[j].ID
+	})
+
+	return records
+}
+
+// refreshPersonalRecords mirrors refreshPersonalRecords. It must be called
+// with the write lock held.
+func (db *MemoryDB) refreshPersonalRecords(userID int, from time.Time, workouts ...*Workout) {
+	heldRecords := make(map[int][]PersonalRecord, len(workouts))
+	for _, workout := range workouts {
+		heldRecords[workout.ID] = nil
+	}
+	for id, record := range db.personalRecords {
+		if _, ok := heldRecords[record.WorkoutID]; ok {
+			heldRecords[record.WorkoutID] = append(heldRecords[record.WorkoutID], *copyPersonalRecord(record))
+		}
+
+		if workout, ok := db.workouts[record.WorkoutID]; ok && record.UserID == userID && !workout.StartedAt.Before(from) {
+			delete(db.personalRecords, id)
+		}
+	}
+
+	existingRecords := db.personalRecordsOf(userID)
+	setRecords := make(map[int][]PersonalRecord)
+	for _, workout := range db.workoutsStartedFrom(userID, from) {
+		beaten := beatenRecords(workout, existingRecords)
+		for i := range beaten {
+			record := &beaten[i]
+			db.lastPersonalRecordID++
+			record.ID = db.lastPersonalRecordID
+			record.AchievedAt = workout.StartedAt
+
+			db.personalRecords[record.ID] = copyPersonalRecord(record)
+		}
+
+		existingRecords = append(existingRecords, beaten...)
+		setRecords[workout.ID] = beaten
+	}
+
+	for _, workout := range workouts {
+		workout.NewRecords = unheldRecords(setRecords[workout.ID], heldRecords[workout.ID])
+	}
+
+	db.refreshGoals(userID)
+}
+
+// workoutsStartedFrom returns the workouts of userID started from from on, in
+// the order they started. It must be called with the lock held.
+func (db *MemoryDB) workoutsStartedFrom(userID int, from time.Time) []*Workout {
+	var workouts []*Workout
+	for _, workout := range db.workouts {
+		if workout.UserID == userID && workout.DeletedAt == nil && !workout.StartedAt.Before(from) {
+			workouts = append(workouts, workout)
+		}
+	}
+
+	sort.Slice(workouts, func(i, j int) bool {
+		if !workouts[i].StartedAt.Equal(workouts[j].StartedAt) {
+			return workouts[i].StartedAt.Before(workouts[j].StartedAt)
+		}
+		return workouts[i].ID < workouts[j].ID
+	})
+
+	return workouts
+}
+
+// deletePersonalRecords deletes the records set by a workout. It must be
+// called with the write lock held.
+func (db *MemoryDB) deletePersonalRecords(workoutID int) {
+	for id, record := range db.personalRecords {
+		if record.WorkoutID == workoutID {
+			delete(db.personalRecords, id)
+		}
+	}
+}
+
+func copyPersonalRecord(record *PersonalRecord) *PersonalRecord {
+	recordCopy := *record
+
+	if record.ExerciseID != nil {
+		exerciseID := *record.ExerciseID
+		recordCopy.ExerciseID = &exerciseID
+	}
+	if record.Weight != nil {
+		weight := *record.Weight
+		recordCopy.Weight = &weight
+	}
+	if record.PreviousValue != nil {
+		previousValue := *record.PreviousValue
+		recordCopy.PreviousValue = &previousValue
+	}
+
+	return &recordCopy
+}
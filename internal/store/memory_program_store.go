@@ -0,0 +1,217 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+var _ ProgramStore = (*InMemoryProgramStore)(nil)
+
+type InMemoryProgramStore struct {
+	db memoryConn
+}
+
+func NewInMemoryProgramStore(db *MemoryDB) *InMemoryProgramStore {
+	return &InMemoryProgramStore{
+		db: memoryConn{MemoryDB: db},
+	}
+}
+
+func (ps *InMemoryProgramStore) CreateProgram(program *Program) error {
+	unlock := ps.db.lock()
+	defer unlock()
+
+	if _, ok := ps.db.users[program.UserID]; !ok {
+		return fmt.Errorf("%w: programs.user_id", errForeignKeyViolation)
+	}
+
+	err := ps.db.checkProgramDays(program.Days)
+	if err != nil {
+		return err
+	}
+
+	ps.db.lastProgramID++
+	program.ID = ps.db.lastProgramID
+	program.CreatedAt = time.Now()
+	program.UpdatedAt = program.CreatedAt
+	ps.setProgramDayIDs(program, nil)
+
+	ps.db.programs[program.ID] = copyProgram(program)
+
+	return nil
+}
+
+func (ps *InMemoryProgramStore) GetProgram(id int) (*Program, error) {
+	unlock := ps.db.rlock()
+	defer unlock()
+
+	program, ok := ps.db.programs[id]
+	if !ok {
+		return nil, nil
+	}
+
+	return copyProgram(program), nil
+}
+
+func (ps *InMemoryProgramStore) ListPrograms() ([]Program, error) {
+	unlock := ps.db.rlock()
+	defer unlock()
+
+	programs := []Program{}
+	for _, program := range ps.db.programs {
+		programCopy := copyProgram(program)
+		programCopy.Days = nil
+		programs = append(programs, *programCopy)
+	}
+
+	sort.Slice(programs, func(i, j int) bool {
+		if nameI, nameJ := strings.ToLower(programs[i].Name), strings.ToLower(programs[j].Name); nameI != nameJ {
+			return nameI < nameJ
+		}
+		return programs[i].ID < programs[j].ID
+	})
+
+	return programs, nil
+}
+
+func (ps *InMemoryProgramStore) UpdateProgram(program *Program) error {
+	unlock := ps.db.lock()
+	defer unlock()
+
+	existingProgram, ok := ps.db.programs[program.ID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	err := ps.db.checkProgramDays(program.Days)
+	if err != nil {
+		return err
+	}
+
+	// the completed sessions of the days left out are deleted with them
+	for _, existingDay := range existingProgram.Days {
+		if !slices.ContainsFunc(program.Days, func(day ProgramDay) bool {
+			return day.Week == existingDay.Week && day.Day == existingDay.Day
+		}) {
+			ps.db.uncompleteSessions(func(session CompletedSession) bool {
+				return session.ProgramDayID == existingDay.ID
+			})
+		}
+	}
+
+	program.UserID = existingProgram.UserID
+	program.CreatedAt = existingProgram.CreatedAt
+	program.UpdatedAt = time.Now()
+	ps.setProgramDayIDs(program, existingProgram.Days)
+
+	ps.db.programs[program.ID] = copyProgram(program)
+
+	return nil
+}
+
+func (ps *InMemoryProgramStore) DeleteProgram(id int) error {
+	unlock := ps.db.lock()
+	defer unlock()
+
+	program, ok := ps.db.programs[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	for _, enrollment := range ps.db.enrollments {
+		if enrollment.ProgramID == id && enrollment.UserID != program.UserID {
+			return fmt.Errorf("%w: program %d", ErrProgramInUse, id)
+		}
+	}
+
+	ps.db.deleteProgram(id)
+
+	return nil
+}
+
+// setProgramDayIDs gives the days of a program the id of the existing day with
+// the same week and day, or a new one. It must be called with the write lock held.
+func (ps *InMemoryProgramStore) setProgramDayIDs(program *Program, existingDays []ProgramDay) {
+	for i := range program.Days {
+		day := &program.Days[i]
+
+		existingIndex := slices.IndexFunc(existingDays, func(existingDay ProgramDay) bool {
+			return existingDay.Week == day.Week && existingDay.Day == day.Day
+		})
+		if existingIndex >= 0 {
+			day.ID = existingDays[existingIndex].ID
+			continue
+		}
+
+		ps.db.lastProgramDayID++
+		day.ID = ps.db.lastProgramDayID
+	}
+}
+
+// checkProgramDays mirrors the constraints of program_days. It must be called
+// with the lock held.
+func (db *MemoryDB) checkProgramDays(days []ProgramDay) error {
+	seen := make(map[[2]int]bool, len(days))
+	for _, day := range days {
+		if day.Day < 1 || day.Day > 7 {
+			return fmt.Errorf("%w: program_days.day_of_week", errCheckViolation)
+		}
+		if seen[[2]int{day.Week, day.Day}] {
+			return fmt.Errorf("%w: program_days_program_id_week_day_key", errUniqueViolation)
+		}
+		seen[[2]int{day.Week, day.Day}] = true
+
+		if _, ok := db.templates[day.TemplateID]; !ok {
+			return fmt.Errorf("%w: program_days.template_id", errForeignKeyViolation)
+		}
+	}
+
+	return nil
+}
+
+// deleteProgram deletes the enrollments in the program too. It must be called
+// with the lock held.
+func (db *MemoryDB) deleteProgram(id int) {
+	for enrollmentID, enrollment := range db.enrollments {
+		if enrollment.ProgramID == id {
+			delete(db.enrollments, enrollmentID)
+		}
+	}
+
+	delete(db.programs, id)
+}
+
+// programUsesTemplate tells whether a program has a day of the template. It
+// must be called with the lock held.
+func (db *MemoryDB) programUsesTemplate(templateID int) bool {
+	for _, program := range db.programs {
+		if slices.ContainsFunc(program.Days, func(day ProgramDay) bool {
+			return day.TemplateID == templateID
+		}) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func copyProgram(program *Program) *Program {
+	programCopy := *program
+	programCopy.Days = slices.Clone(program.Days)
+	if programCopy.Days == nil {
+		programCopy.Days = []ProgramDay{}
+	}
+
+	sort.Slice(programCopy.Days, func(i, j int) bool {
+		if programCopy.Days[i].Week != programCopy.Days[j].Week {
+			return programCopy.Days[i].Week < programCopy.Days[j].Week
+		}
+		return programCopy.Days[i].Day < programCopy.Days[j].Day
+	})
+
+	return &programCopy
+}
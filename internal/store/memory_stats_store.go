@@ -0,0 +1,146 @@
+package store
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var _ StatsStore = (*InMemoryStatsStore)(nil)
+
+type InMemoryStatsStore struct {
+	db memoryConn
+}
+
+func NewInMemoryStatsStore(db *MemoryDB) *InMemoryStatsStore {
+	return &InMemoryStatsStore{
+		db: memoryConn{MemoryDB: db},
+	}
+}
+
+func (ss *InMemoryStatsStore) GetTrainingStats(userID int, query StatsQuery) (*TrainingStats, error) {
+	unlock := ss.db.rlock()
+	defer unlock()
+
+	stats := newTrainingStats(query)
+	buckets := make(map[int64]StatsTotals)
+	activeDays := make(map[string]bool)
+	exercises := make(map[string]*ExerciseStats)
+	exerciseWorkouts := make(map[string]map[int]bool)
+	muscleGroups := make(map[string]*MuscleGroupStats)
+
+	for _, workout := range ss.db.workouts {
+		if workout.UserID != userID || workout.DeletedAt != nil ||
+			workout.StartedAt.Before(query.From) || !workout.StartedAt.Before(query.To) {
+			continue
+		}
+
+		start := truncateToBucket(wallClock(workout.StartedAt, query.TimeZone), query.Bucket).Unix()
+		totals := buckets[start]
+		totals.Workouts++
+		totals.DurationMinutes += workout.DurationMinutes
+		totals.CaloriesBurned += valueOrZero(workout.CaloriesBurned)
+		activeDays[localDay(workout.StartedAt, query.TimeZone)] = true
+
+		for _, workoutExercise := range workout.Exercises {
+			sets, reps, volume := exerciseVolume(workoutExercise)
+			totals.VolumeLoad += volume
+
+			key := "name:" + strings.ToLower(strings.TrimSpace(workoutExercise.Name))
+			var linkedExercise *Exercise
+			if workoutExercise.ExerciseID != nil {
+				key = fmt.Sprintf("id:%d", *workoutExercise.ExerciseID)
+				linkedExercise = ss.db.exercises[*workoutExercise.ExerciseID]
+			}
+
+			exercise, ok := exercises[key]
+			if !ok {
+				exercise = &ExerciseStats{ExerciseID: workoutExercise.ExerciseID, Name: workoutExercise.Name}
+				exercises[key] = exercise
+				exerciseWorkouts[key] = make(map[int]bool)
+			}
+			if linkedExercise != nil {
+				exercise.Name = linkedExercise.Name
+			} else if workoutExercise.Name < exercise.Name {
+				exercise.Name = workoutExercise.Name
+			}
+			exerciseWorkouts[key][workout.ID] = true
+			exercise.Workouts = len(exerciseWorkouts[key])
+			exercise.Sets += sets
+			exercise.Reps += reps
+			exercise.VolumeLoad += volume
+
+			if linkedExercise == nil {
+				continue
+			}
+			for _, muscle := range linkedExercise.PrimaryMuscles {
+				muscleGroup, ok := muscleGroups[muscle]
+				if !ok {
+					muscleGroup = &MuscleGroupStats{MuscleGroup: muscle}
+					muscleGroups[muscle] = muscleGroup
+				}
+				muscleGroup.Sets += sets
+				muscleGroup.VolumeLoad += volume
+			}
+		}
+
+		buckets[start] = totals
+	}
+
+	stats.Frequency.ActiveDays = len(activeDays)
+	for _, exercise := range exercises {
+		stats.Exercises = append(stats.Exercises, *exercise)
+	}
+	for _, muscleGroup := range muscleGroups {
+		stats.MuscleGroups = append(stats.MuscleGroups, *muscleGroup)
+	}
+
+	finishTrainingStats(stats, query, buckets)
+
+	return stats, nil
+}
+
+func (ss *InMemoryStatsStore) GetExerciseProgress(userID int, name string, formula string) ([]ProgressPoint, error) {
+	unlock := ss.db.rlock()
+	defer unlock()
+
+	name = strings.ToLower(strings.TrimSpace(name))
+
+	var sessions []exerciseSession
+	for _, workout := range ss.db.workouts {
+		if workout.UserID != userID || workout.DeletedAt != nil {
+			continue
+		}
+
+		session := exerciseSession{workoutID: workout.ID, date: wallClock(workout.StartedAt, ss.db.users[userID].TimeZone)}
+		for _, exercise := range copyWorkout(workout).Exercises {
+			if strings.ToLower(strings.TrimSpace(exercise.Name)) == name {
+				session.exercises = append(session.exercises, exercise)
+			}
+		}
+		if len(session.exercises) > 0 {
+			sessions = append(sessions, session)
+		}
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		if !sessions[i].date.Equal(sessions[j].date) {
+			return sessions[i].date.Before(sessions[j].date)
+		}
+		return sessions[i].workoutID < sessions[j].workoutID
+	})
+
+	return progressPoints(sessions, formula), nil
+}
+
+// exerciseVolume mirrors the stats_exercises CTE: the sets, reps and volume
+// load of the sets of an exercise that count.
+func exerciseVolume(exercise WorkoutExercise) (sets, reps int, volume float64) {
+	for _, set := range performedSets(exercise) {
+		sets++
+		reps += valueOrZero(set.Reps)
+		volume += float64(valueOrZero(set.Reps)) * valueOrZero(set.Weight)
+	}
+
+	return sets, reps, volume
+}
@@ -0,0 +1,117 @@
+package store
+
+import (
+	"maps"
+	"slices"
+	"time"
+)
+
+var _ StreakStore = (*InMemoryStreakStore)(nil)
+
+type InMemoryStreakStore struct {
+	db memoryConn
+}
+
+func NewInMemoryStreakStore(db *MemoryDB) *InMemoryStreakStore {
+	return &InMemoryStreakStore{
+		db: memoryConn{MemoryDB: db},
+	}
+}
+
+func (ss *InMemoryStreakStore) GetStreaks(userID int) (*Streaks, error) {
+	// the streaks not built yet are built on read
+	unlock := ss.db.lock()
+	defer unlock()
+
+	user, ok := ss.db.users[userID]
+	if !ok {
+		return nil, nil
+	}
+
+	runs, ok := ss.db.streaks[userID]
+	if !ok {
+		runs = ss.db.rebuildStreaks(userID)
+	}
+
+	return runs.streaks(localDay(time.Now(), user.TimeZone), user.TimeZone, user.StreakRestDays), nil
+}
+
+// addWorkoutDay mirrors addWorkoutDay. Like the other functions of the
+// training days, it must be called with the write lock held.
+func (db *MemoryDB) addWorkoutDay(userID int, performedAt time.Time) {
+	db.addWorkoutDays(userID, []time.Time{performedAt})
+}
+
+func (db *MemoryDB) addWorkoutDays(userID int, performedAt []time.Time) {
+	user := db.users[userID]
+
+	if db.trainingDays[userID] == nil {
+		db.trainingDays[userID] = map[string]int{}
+	}
+
+	var newDays []string
+	for _, at := range performedAt {
+		day := localDay(at, user.TimeZone)
+		db.trainingDays[userID][day]++
+		if db.trainingDays[userID][day] == 1 {
+			newDays = append(newDays, day)
+		}
+	}
+	if len(newDays) == 0 {
+		return
+	}
+	slices.Sort(newDays)
+
+	runs, ok := db.streaks[userID]
+	if !ok || newDays[0] < runs.lastDay {
+		db.rebuildStreaks(userID)
+		return
+	}
+
+	for _, day := range newDays {
+		runs.add(day, user.StreakRestDays)
+	}
+	db.streaks[userID] = runs
+}
+
+func (db *MemoryDB) removeWorkoutDay(userID int, performedAt time.Time) {
+	day := localDay(performedAt, db.users[userID].TimeZone)
+
+	days := db.trainingDays[userID]
+	if days[day] == 0 {
+		return
+	}
+
+	days[day]--
+	if days[day] == 0 {
+		delete(days, day)
+		db.rebuildStreaks(userID)
+	}
+}
+
+func (db *MemoryDB) rebuildTrainingDays(userID int) {
+	timeZone := db.users[userID].TimeZone
+
+	days := map[string]int{}
+	for _, workout := range db.workouts {
+		if workout.UserID == userID && workout.DeletedAt == nil {
+			days[localDay(workout.StartedAt, timeZone)]++
+		}
+	}
+	db.trainingDays[userID] = days
+
+	db.rebuildStreaks(userID)
+}
+
+func (db *MemoryDB) rebuildStreaks(userID int) streakRuns {
+	days := slices.Sorted(maps.Keys(db.trainingDays[userID]))
+
+	runs := buildStreakRuns(days, db.users[userID].StreakRestDays)
+	if len(days) == 0 {
+		delete(db.streaks, userID)
+	} else {
+		db.streaks[userID] = runs
+	}
+
+	return runs
+}
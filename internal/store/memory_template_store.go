@@ -0,0 +1,179 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+var _ TemplateStore = (*InMemoryTemplateStore)(nil)
+
+type InMemoryTemplateStore struct {
+	db memoryConn
+}
+
+func NewInMemoryTemplateStore(db *MemoryDB) *InMemoryTemplateStore {
+	return &InMemoryTemplateStore{
+		db: memoryConn{MemoryDB: db},
+	}
+}
+
+func (ts *InMemoryTemplateStore) CreateTemplate(template *WorkoutTemplate) error {
+	unlock := ts.db.lock()
+	defer unlock()
+
+	if _, ok := ts.db.users[template.UserID]; !ok {
+		return fmt.Errorf("%w: workout_templates.user_id", errForeignKeyViolation)
+	}
+
+	err := ts.db.checkWorkoutExercises(template.Exercises)
+	if err != nil {
+		return err
+	}
+
+	ts.db.lastTemplateID++
+	template.ID = ts.db.lastTemplateID
+	template.CreatedAt = time.Now()
+	template.UpdatedAt = template.CreatedAt
+	ts.initTemplateExercises(template)
+
+	ts.db.templates[template.ID] = copyTemplate(template)
+
+	return nil
+}
+
+func (ts *InMemoryTemplateStore) GetTemplate(id int) (*WorkoutTemplate, error) {
+	unlock := ts.db.rlock()
+	defer unlock()
+
+	template, ok := ts.db.templates[id]
+	if !ok {
+		return nil, nil
+	}
+
+	return copyTemplate(template), nil
+}
+
+func (ts *InMemoryTemplateStore) ListTemplates(userID int) ([]WorkoutTemplate, error) {
+	unlock := ts.db.rlock()
+	defer unlock()
+
+	templates := []WorkoutTemplate{}
+	for _, template := range ts.db.templates {
+		if template.UserID == userID {
+			templateCopy := copyTemplate(template)
+			templateCopy.Exercises = nil
+			templates = append(templates, *templateCopy)
+		}
+	}
+
+	sort.Slice(templates, func(i, j int) bool {
+		if nameI, nameJ := strings.ToLower(templates[i].Name), strings.ToLower(templates[j].Name); nameI != nameJ {
+			return nameI < nameJ
+		}
+		return templates[i].ID < templates[j].ID
+	})
+
+	return templates, nil
+}
+
+func (ts *InMemoryTemplateStore) UpdateTemplate(template *WorkoutTemplate) error {
+	unlock := ts.db.lock()
+	defer unlock()
+
+	existingTemplate, ok := ts.db.templates[template.ID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	err := ts.db.checkWorkoutExercises(template.Exercises)
+	if err != nil {
+		return err
+	}
+
+	template.UserID = existingTemplate.UserID
+	template.CreatedAt = existingTemplate.CreatedAt
+	template.UpdatedAt = time.Now()
+	ts.initTemplateExercises(template)
+
+	// like UpdateTemplate, an exercise rewritten with the legacy weight it had
+	// at its position keeps it
+	legacyWeights := make(map[int]*float64)
+	for _, exercise := range existingTemplate.Exercises {
+		if ts.db.legacyTemplateExercises[exercise.ID] {
+			legacyWeights[exercise.OrderIndex] = exercise.Weight
+			delete(ts.db.legacyTemplateExercises, exercise.ID)
+		}
+	}
+	for _, exercise := range template.Exercises {
+		if legacyWeight, ok := legacyWeights[exercise.OrderIndex]; ok && exercise.Weight != nil && equalPtr(exercise.Weight, legacyWeight) {
+			ts.db.legacyTemplateExercises[exercise.ID] = true
+		}
+	}
+
+	ts.db.templates[template.ID] = copyTemplate(template)
+
+	return nil
+}
+
+func (ts *InMemoryTemplateStore) DeleteTemplate(id int) error {
+	unlock := ts.db.lock()
+	defer unlock()
+
+	if _, ok := ts.db.templates[id]; !ok {
+		return sql.ErrNoRows
+	}
+	if ts.db.programUsesTemplate(id) {
+		return fmt.Errorf("%w: program_days.template_id", ErrTemplateInUse)
+	}
+
+	ts.db.deleteTemplate(id)
+
+	return nil
+}
+
+// initTemplateExercises must be called with the write lock held.
+func (ts *InMemoryTemplateStore) initTemplateExercises(template *WorkoutTemplate) {
+	for i := range template.Exercises {
+		exercise := &template.Exercises[i]
+		ts.db.lastTemplateExerciseID++
+		exercise.ID = ts.db.lastTemplateExerciseID
+		exercise.WorkoutSets = nil
+		exercise.CreatedAt = template.UpdatedAt
+		exercise.UpdatedAt = template.UpdatedAt
+	}
+}
+
+// deleteTemplate unlinks the workouts started from the template, like the ON
+// DELETE SET NULL of workouts.template_id. It must be called with the lock held.
+func (db *MemoryDB) deleteTemplate(id int) {
+	for _, workout := range db.workouts {
+		if equalPtr(workout.TemplateID, &id) {
+			workout.TemplateID = nil
+		}
+	}
+
+	delete(db.templates, id)
+}
+
+func copyTemplate(template *WorkoutTemplate) *WorkoutTemplate {
+	templateCopy := *template
+	templateCopy.Exercises = nil
+
+	if template.CaloriesBurned != nil {
+		caloriesBurned := *template.CaloriesBurned
+		templateCopy.CaloriesBurned = &caloriesBurned
+	}
+
+	for _, exercise := range template.Exercises {
+		templateCopy.Exercises = append(templateCopy.Exercises, copyWorkoutExercise(exercise))
+	}
+
+	sort.SliceStable(templateCopy.Exercises, func(i, j int) bool {
+		return templateCopy.Exercises[i].OrderIndex < templateCopy.Exercises[j].OrderIndex
+	})
+
+	return &templateCopy
+}
@@ -0,0 +1,11 @@
+package store
+
+import (
+	"testing"
+)
+
+func TestInMemoryStores(t *testing.T) {
+	runStoreContracts(t, func(t *testing.T) *Stores {
+		return NewInMemoryStores(NewMemoryDB())
+	})
+}
@@ -0,0 +1,55 @@
+package store
+
+import (
+	"fmt"
+
+	"fem-go-crud/internal/auth"
+)
+
+var _ TokenStore = (*InMemoryTokenStore)(nil)
+
+type InMemoryTokenStore struct {
+	db memoryConn
+}
+
+func NewInMemoryTokenStore(db *MemoryDB) *InMemoryTokenStore {
+	return &InMemoryTokenStore{
+		db: memoryConn{MemoryDB: db},
+	}
+}
+
+func (ts *InMemoryTokenStore) PersistToken(token *auth.Token) error {
+	unlock := ts.db.lock()
+	defer unlock()
+
+	if _, ok := ts.db.users[token.UserID]; !ok {
+		return fmt.Errorf("%w: tokens.user_id", errForeignKeyViolation)
+	}
+
+	key := string(token.Hash)
+	if _, ok := ts.db.tokens[key]; ok {
+		return fmt.Errorf("%w: tokens.hash", errUniqueViolation)
+	}
+
+	ts.db.tokens[key] = &auth.Token{
+		Hash:      append([]byte(nil), token.Hash...),
+		UserID:    token.UserID,
+		ExpiresAt: token.ExpiresAt,
+		Scope:     token.Scope,
+	}
+
+	return nil
+}
+
+func (ts *InMemoryTokenStore) RevokeTokensForUser(userID int, scope string) error {
+	unlock := ts.db.lock()
+	defer unlock()
+
+	for key, token := range ts.db.tokens {
+		if token.UserID == userID && token.Scope == scope {
+			delete(ts.db.tokens, key)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,335 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"fem-go-crud/internal/auth"
+)
+
+var _ UserStore = (*InMemoryUserStore)(nil)
+
+type InMemoryUserStore struct {
+	db memoryConn
+}
+
+func NewInMemoryUserStore(db *MemoryDB) *InMemoryUserStore {
+	return &InMemoryUserStore{
+		db: memoryConn{MemoryDB: db},
+	}
+}
+
+func (us *InMemoryUserStore) PersistUser(user *User) error {
+	unlock := us.db.lock()
+	defer unlock()
+
+	err := us.checkUser(user)
+	if err != nil {
+		return err
+	}
+
+	if user.UnitSystem == "" {
+		user.UnitSystem = UnitSystemMetric
+	}
+	if user.TimeZone == "" {
+		user.TimeZone = "UTC"
+	}
+
+	us.db.lastUserID++
+	user.ID = us.db.lastUserID
+	user.CreatedAt = time.Now()
+	user.UpdatedAt = user.CreatedAt
+
+	us.db.users[user.ID] = copyUser(user)
+
+	return nil
+}
+
+func (us *InMemoryUserStore) GetUserByIdOrUsername(id int, username string) (*User, error) {
+	if id == 0 && username == "" {
+		return nil, errors.New("missing id or username")
+	}
+
+	unlock := us.db.rlock()
+	defer unlock()
+
+	for _, user := range us.db.users {
+		if (id != 0 && user.ID == id) || (id == 0 && user.Username == username) {
+			return copyUser(user), nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (us *InMemoryUserStore) UpdateUser(user *User) error {
+	unlock := us.db.lock()
+	defer unlock()
+
+	existingUser, ok := us.db.users[user.ID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	err := us.checkUser(user)
+	if err != nil {
+		return err
+	}
+
+	timeZoneChanged := existingUser.TimeZone != user.TimeZone
+	restDaysChanged := existingUser.StreakRestDays != user.StreakRestDays
+
+	existingUser.Username = user.Username
+	existingUser.Email = user.Email
+	existingUser.BodyWeightKg = copyUser(user).BodyWeightKg
+	existingUser.UnitSystem = user.UnitSystem
+	existingUser.TimeZone = user.TimeZone
+	existingUser.StreakRestDays = user.StreakRestDays
+	existingUser.UpdatedAt = time.Now()
+	us.db.refreshGoals(user.ID)
+
+	if timeZoneChanged {
+		us.db.rebuildTrainingDays(user.ID)
+	} else if restDaysChanged {
+		us.db.rebuildStreaks(user.ID)
+	}
+
+	return nil
+}
+
+func (us *InMemoryUserStore) UpdatePassword(user *User) error {
+	unlock := us.db.lock()
+	defer unlock()
+
+	existingUser, ok := us.db.users[user.ID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	existingUser.Password = auth.Password{
+		Hash: append([]byte(nil), user.Password.Hash...),
+	}
+	existingUser.UpdatedAt = time.Now()
+
+	return nil
+}
+
+// DeleteUser cascades to the user's tokens, idempotency keys, workouts,
+// workout revisions, custom exercises, templates, programs, enrollments, body
+// measurements, goals and streaks like the Postgres foreign keys.
+func (us *InMemoryUserStore) DeleteUser(id int) error {
+	unlock := us.db.lock()
+	defer unlock()
+
+	if _, ok := us.db.users[id]; !ok {
+		return sql.ErrNoRows
+	}
+
+	for key, token := range us.db.tokens {
+		if token.UserID == id {
+			delete(us.db.tokens, key)
+		}
+	}
+	for key, record := range us.db.idempotencyKeys {
+		if record.UserID == id {
+			delete(us.db.idempotencyKeys, key)
+		}
+	}
+	for workoutID, workout := range us.db.workouts {
+		if workout.UserID == id {
+			us.db.deleteWorkout(workoutID)
+		}
+	}
+	for programID, program := range us.db.programs {
+		if program.UserID == id {
+			us.db.deleteProgram(programID)
+		}
+	}
+	for enrollmentID, enrollment := range us.db.enrollments {
+		if enrollment.UserID == id {
+			delete(us.db.enrollments, enrollmentID)
+		}
+	}
+	for exerciseID, exercise := range us.db.exercises {
+		if equalPtr(exercise.UserID, &id) {
+			us.db.deleteExercise(exerciseID)
+		}
+	}
+	for templateID, template := range us.db.templates {
+		if template.UserID == id {
+			us.db.deleteTemplate(templateID)
+		}
+	}
+	for measurementID, measurement := range us.db.measurements {
+		if measurement.UserID == id {
+			delete(us.db.measurements, measurementID)
+		}
+	}
+	for goalID, goal := range us.db.goals {
+		if goal.UserID == id {
+			delete(us.db.goals, goalID)
+		}
+	}
+	delete(us.db.trainingDays, id)
+	delete(us.db.streaks, id)
+	for exportID, export := range us.db.exports {
+		if export.UserID == id {
+			delete(us.db.exports, exportID)
+		}
+	}
+	for workoutID, revisions := range us.db.workoutRevisions {
+		if len(revisions) > 0 && revisions[0].UserID == id {
+			delete(us.db.workoutRevisions, workoutID)
+		}
+	}
+	delete(us.db.users, id)
+
+	return nil
+}
+
+func (us *InMemoryUserStore) GetUserFromToken(plainToken, scope string) (*User, error) {
+	tokenHash := auth.MakeTokenHash(plainToken)
+
+	unlock := us.db.rlock()
+	defer unlock()
+
+	token, ok := us.db.tokens[string(tokenHash)]
+	if !ok || token.Scope != scope || !token.ExpiresAt.After(time.Now()) {
+		return nil, nil
+	}
+
+	user, ok := us.db.users[token.UserID]
+	if !ok {
+		return nil, nil
+	}
+
+	// mirror the Postgres store, which does not load the password hash here
+	user = copyUser(user)
+	user.Password = auth.Password{}
+
+	return user, nil
+}
+
+func (us *InMemoryUserStore) ResolveLegacyWeights(userID int, kgPerUnit float64) error {
+	unlock := us.db.lock()
+	defer unlock()
+
+	user, ok := us.db.users[userID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if user.LegacyWeightsBefore == nil {
+		return ErrNoLegacyWeights
+	}
+
+	// the revisions are converted first, as that can fail
+	convertedRevisions := make(map[int][]*WorkoutRevision)
+	for workoutID, revisions := range us.db.workoutRevisions {
+		if len(revisions) == 0 || revisions[0].UserID != userID ||
+			!slices.ContainsFunc(revisions, func(revision *WorkoutRevision) bool { return len(revision.legacyExerciseIDs) > 0 }) {
+			continue
+		}
+
+		revisionsCopy := make([]*WorkoutRevision, len(revisions))
+		for i, revision := range revisions {
+			revisionsCopy[i] = copyWorkoutRevision(revision)
+		}
+		err := convertRevisionWeights(revisionsCopy, kgPerUnit)
+		if err != nil {
+			return err
+		}
+		convertedRevisions[workoutID] = revisionsCopy
+	}
+	maps.Copy(us.db.workoutRevisions, convertedRevisions)
+
+	for _, workout := range us.db.workouts {
+		if workout.UserID != userID {
+			continue
+		}
+
+		converted := false
+		for i := range workout.Exercises {
+			exercise := &workout.Exercises[i]
+			if !us.db.legacyWorkoutExercises[exercise.ID] {
+				continue
+			}
+
+			exercise.Weight = convertWeight(exercise.Weight, kgPerUnit)
+			for j := range exercise.WorkoutSets {
+				exercise.WorkoutSets[j].Weight = convertWeight(exercise.WorkoutSets[j].Weight, kgPerUnit)
+			}
+			delete(us.db.legacyWorkoutExercises, exercise.ID)
+			converted = true
+		}
+		if converted {
+			workout.Version++
+		}
+	}
+	for _, template := range us.db.templates {
+		if template.UserID != userID {
+			continue
+		}
+
+		for i := range template.Exercises {
+			exercise := &template.Exercises[i]
+			if us.db.legacyTemplateExercises[exercise.ID] {
+				exercise.Weight = convertWeight(exercise.Weight, kgPerUnit)
+				delete(us.db.legacyTemplateExercises, exercise.ID)
+			}
+		}
+	}
+	us.db.refreshPersonalRecords(userID, time.Time{})
+
+	user.LegacyWeightsBefore = nil
+
+	return nil
+}
+
+// checkUser mirrors the unique and check constraints of users. It must be
+// called with the write lock held.
+func (us *InMemoryUserStore) checkUser(user *User) error {
+	if user.BodyWeightKg != nil && *user.BodyWeightKg <= 0 {
+		return fmt.Errorf("%w: users.body_weight_kg_positive", errCheckViolation)
+	}
+	if user.UnitSystem != "" && !slices.Contains(UnitSystems, user.UnitSystem) {
+		return fmt.Errorf("%w: users.unit_system_known", errCheckViolation)
+	}
+	if user.StreakRestDays < 0 || user.StreakRestDays > MaxStreakRestDays {
+		return fmt.Errorf("%w: users.streak_rest_days_range", errCheckViolation)
+	}
+
+	for _, existingUser := range us.db.users {
+		if existingUser.ID == user.ID {
+			continue
+		}
+		if existingUser.Username == user.Username {
+			return fmt.Errorf("%w: users.username", errUniqueViolation)
+		}
+		if existingUser.Email == user.Email {
+			return fmt.Errorf("%w: users.email", errUniqueViolation)
+		}
+	}
+
+	return nil
+}
+
+func copyUser(user *User) *User {
+	userCopy := *user
+	userCopy.Password = auth.Password{
+		Hash: append([]byte(nil), user.Password.Hash...),
+	}
+	if user.BodyWeightKg != nil {
+		bodyWeightKg := *user.BodyWeightKg
+		userCopy.BodyWeightKg = &bodyWeightKg
+	}
+	if user.LegacyWeightsBefore != nil {
+		legacyWeightsBefore := *user.LegacyWeightsBefore
+		userCopy.LegacyWeightsBefore = &legacyWeightsBefore
+	}
+
+	return &userCopy
+}
@@ -0,0 +1,107 @@
+package store
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+var _ WorkoutRevisionStore = (*InMemoryWorkoutRevisionStore)(nil)
+
+type InMemoryWorkoutRevisionStore struct {
+	db memoryConn
+}
+
+func NewInMemoryWorkoutRevisionStore(db *MemoryDB) *InMemoryWorkoutRevisionStore {
+	return &InMemoryWorkoutRevisionStore{
+		db: memoryConn{MemoryDB: db},
+	}
+}
+
+func (rs *InMemoryWorkoutRevisionStore) CreateWorkoutRevision(revision *WorkoutRevision) error {
+	return rs.CreateWorkoutRevisions([]*WorkoutRevision{revision})
+}
+
+func (rs *InMemoryWorkoutRevisionStore) CreateWorkoutRevisions(revisions []*WorkoutRevision) error {
+	unlock := rs.db.lock()
+	defer unlock()
+
+	latest := make(map[int]*WorkoutRevision, len(revisions))
+	for _, revision := range revisions {
+		if _, ok := rs.db.users[revision.UserID]; !ok {
+			return fmt.Errorf("%w: workout_revisions.user_id", errForeignKeyViolation)
+		}
+
+		if stored := rs.db.workoutRevisions[revision.WorkoutID]; len(stored) > 0 {
+			latest[revision.WorkoutID] = stored[len(stored)-1]
+		}
+	}
+
+	now := time.Now()
+	for _, revision := range revisions {
+		err := nextWorkoutRevision(revision, latest)
+		if err != nil {
+			return err
+		}
+		revision.CreatedAt = now
+		revision.legacyExerciseIDs = rs.db.legacyExerciseIDs(revision.WorkoutID)
+	}
+
+	for _, revision := range revisions {
+		rs.db.workoutRevisions[revision.WorkoutID] = append(rs.db.workoutRevisions[revision.WorkoutID], copyWorkoutRevision(revision))
+	}
+
+	return nil
+}
+
+func (rs *InMemoryWorkoutRevisionStore) ListWorkoutRevisions(workoutID int) ([]WorkoutRevision, error) {
+	unlock := rs.db.rlock()
+	defer unlock()
+
+	revisions := []WorkoutRevision{}
+	for _, revision := range rs.db.workoutRevisions[workoutID] {
+		revisionCopy := copyWorkoutRevision(revision)
+		revisionCopy.Snapshot = nil
+		revisions = append(revisions, *revisionCopy)
+	}
+
+	return revisions, nil
+}
+
+func (rs *InMemoryWorkoutRevisionStore) GetWorkoutRevision(workoutID, revisionNumber int) (*WorkoutRevision, error) {
+	unlock := rs.db.rlock()
+	defer unlock()
+
+	revisions := rs.db.workoutRevisions[workoutID]
+	if revisionNumber < 1 || revisionNumber > len(revisions) {
+		return nil, nil
+	}
+
+	return copyWorkoutRevision(revisions[revisionNumber-1]), nil
+}
+
+// legacyExerciseIDs returns the ids of the exercises of a workout that hold
+// legacy weights, in order. It must be called with the lock held.
+func (db *MemoryDB) legacyExerciseIDs(workoutID int) []int {
+	var exerciseIDs []int
+	if workout, ok := db.workouts[workoutID]; ok {
+		for _, exercise := range workout.Exercises {
+			if db.legacyWorkoutExercises[exercise.ID] {
+				exerciseIDs = append(exerciseIDs, exercise.ID)
+			}
+		}
+	}
+
+	slices.Sort(exerciseIDs)
+	return exerciseIDs
+}
+
+func copyWorkoutRevision(revision *WorkoutRevision) *WorkoutRevision {
+	revisionCopy := *revision
+	revisionCopy.Snapshot = append([]byte(nil), revision.Snapshot...)
+	if revision.Diff != nil {
+		revisionCopy.Diff = append([]byte(nil), revision.Diff...)
+	}
+
+	return &revisionCopy
+}
@@ -0,0 +1,152 @@
+package store
+
+import (
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// searchStopWords are the most common of the english stop words that Postgres
+// leaves out of a search. Unlike Postgres, the memory store does not stem words.
+var searchStopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true, "by": true, "for": true,
+	"from": true, "in": true, "is": true, "it": true, "my": true, "of": true, "on": true, "or": true, "that": true,
+	"the": true, "this": true, "to": true, "was": true, "with": true,
+}
+
+// searchField is a part of the search document of a workout, weighted like
+// the parts of workouts.search_vector are by ts_rank.
+type searchField struct {
+	text   string
+	weight float64
+}
+
+func (ws *InMemoryWorkoutStore) SearchWorkouts(userID int, query string, limit, offset int) ([]WorkoutSearchResult, error) {
+	unlock := ws.db.rlock()
+	defer unlock()
+
+	terms := slices.DeleteFunc(searchTerms(query), func(term string) bool {
+		return searchStopWords[term]
+	})
+
+	results := []WorkoutSearchResult{}
+	if len(terms) == 0 {
+		return results, nil
+	}
+
+	for _, workout := range ws.db.workouts {
+		if workout.UserID != userID || workout.DeletedAt != nil {
+			continue
+		}
+
+		fields := workoutSearchFields(workout)
+		var words []string
+		for _, field := range fields {
+			words = append(words, searchTerms(field.text)...)
+		}
+
+		matchesEveryTerm := !slices.ContainsFunc(terms, func(term string) bool {
+			return !slices.ContainsFunc(words, func(word string) bool {
+				return strings.HasPrefix(word, term)
+			})
+		})
+		if !matchesEveryTerm {
+			continue
+		}
+
+		workoutCopy := copyWorkout(workout)
+		workoutCopy.Exercises = nil
+		results = append(results, WorkoutSearchResult{
+			Workout: *workoutCopy,
+			Rank:    searchRank(fields, terms),
+			Snippet: markSearchMatches(workoutSearchDocument(workout), terms),
+		})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Rank != results[j].Rank {
+			return results[i].Rank > results[j].Rank
+		}
+		return results[i].Workout.ID > results[j].Workout.ID
+	})
+
+	results = results[min(offset, len(results)):]
+	return results[:min(limit, len(results))], nil
+}
+
+func workoutSearchFields(workout *Workout) []searchField {
+	fields := []searchField{{workout.Name, 1}, {workout.Description, 0.4}}
+	for _, exercise := range workout.Exercises {
+		fields = append(fields, searchField{exercise.Name, 0.4}, searchField{exercise.Notes, 0.2})
+	}
+
+	return fields
+}
+
+// workoutSearchDocument is the text that snippets are taken from.
+func workoutSearchDocument(workout *Workout) string {
+	parts := []string{workout.Name, workout.Description}
+	for _, exercise := range workout.Exercises {
+		parts = append(parts, exercise.Name, exercise.Notes)
+	}
+
+	return strings.Join(slices.DeleteFunc(parts, func(part string) bool {
+		return part == ""
+	}), " ")
+}
+
+// searchRank sums the weights of the words that match a term.
+func searchRank(fields []searchField, terms []string) float64 {
+	rank := 0.0
+	for _, field := range fields {
+		for _, word := range searchTerms(field.text) {
+			if matchesSearchTerm(word, terms) {
+				rank += field.weight
+			}
+		}
+	}
+
+	return rank
+}
+
+// markSearchMatches marks the words of text that match a term, escaping the
+// rest.
+func markSearchMatches(text string, terms []string) string {
+	var snippet strings.Builder
+
+	isWordRune := func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsDigit(r)
+	}
+
+	for text != "" {
+		end := strings.IndexFunc(text, func(r rune) bool { return !isWordRune(r) })
+		if end == 0 {
+			end = strings.IndexFunc(text, isWordRune)
+			if end < 0 {
+				end = len(text)
+			}
+			_, _ = searchSnippetEscaper.WriteString(&snippet, text[:end])
+			text = text[end:]
+			continue
+		}
+		if end < 0 {
+			end = len(text)
+		}
+
+		word := text[:end]
+		if matchesSearchTerm(strings.ToLower(word), terms) {
+			word = SearchMatchStart + word + SearchMatchEnd
+		}
+		snippet.WriteString(word)
+		text = text[end:]
+	}
+
+	return snippet.String()
+}
+
+func matchesSearchTerm(word string, terms []string) bool {
+	return slices.ContainsFunc(terms, func(term string) bool {
+		return strings.HasPrefix(word, term)
+	})
+}
@@ -0,0 +1,658 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+)
+
+var _ WorkoutStore = (*InMemoryWorkoutStore)(nil)
+
+type InMemoryWorkoutStore struct {
+	db memoryConn
+}
+
+func NewInMemoryWorkoutStore(db *MemoryDB) *InMemoryWorkoutStore {
+	return &InMemoryWorkoutStore{
+		db: memoryConn{MemoryDB: db},
+	}
+}
+
+func (ws *InMemoryWorkoutStore) PersistWorkout(workout *Workout) error {
+	return ws.PersistWorkouts([]*Workout{workout})
+}
+
+func (ws *InMemoryWorkoutStore) PersistWorkouts(workouts []*Workout) error {
+	unlock := ws.db.lock()
+	defer unlock()
+
+	// check every workout first, so that none is stored if one fails
+	now := time.Now()
+	for _, workout := range workouts {
+		if _, ok := ws.db.users[workout.UserID]; !ok {
+			return fmt.Errorf("%w: workouts.user_id", errForeignKeyViolation)
+		}
+		if workout.TemplateID != nil {
+			if _, ok := ws.db.templates[*workout.TemplateID]; !ok {
+				return fmt.Errorf("%w: workouts.template_id", errForeignKeyViolation)
+			}
+		}
+
+		startedAt := workout.StartedAt
+		if startedAt.IsZero() {
+			startedAt = now
+		}
+		err := checkWorkoutTimes(startedAt, workout.EndedAt)
+		if err != nil {
+			return err
+		}
+
+		err = ws.db.checkWorkoutExercises(workout.Exercises)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, workout := range workouts {
+		ws.db.lastWorkoutID++
+		workout.ID = ws.db.lastWorkoutID
+		workout.Version = 1
+		workout.CreatedAt = now
+		if workout.StartedAt.IsZero() {
+			workout.StartedAt = now
+		}
+		for i := range workout.Exercises {
+			ws.initExercise(&workout.Exercises[i])
+			numberWorkoutSets(&workout.Exercises[i])
+		}
+
+		ws.db.workouts[workout.ID] = copyWorkout(workout)
+	}
+
+	userIDs, userWorkouts := workoutsByUser(workouts)
+	for _, userID := range userIDs {
+		ws.db.addWorkoutDays(userID, startTimes(userWorkouts[userID]))
+		ws.db.refreshPersonalRecords(userID, earliestStart(userWorkouts[userID]), userWorkouts[userID]...)
+	}
+
+	return nil
+}
+
+func (ws *InMemoryWorkoutStore) GetWorkout(id int) (*Workout, error) {
+	unlock := ws.db.rlock()
+	defer unlock()
+
+	workout, ok := ws.db.activeWorkout(id)
+	if !ok {
+		return nil, nil
+	}
+
+	return copyWorkout(workout), nil
+}
+
+func (ws *InMemoryWorkoutStore) UpdateWorkout(workout *Workout) error {
+	unlock := ws.db.lock()
+	defer unlock()
+
+	existingWorkout, ok := ws.db.activeWorkout(workout.ID)
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	if existingWorkout.Version != workout.Version {
+		return ErrVersionConflict
+	}
+
+	err := checkWorkoutTimes(workout.StartedAt, workout.EndedAt)
+	if err != nil {
+		return err
+	}
+
+	err = ws.db.checkWorkoutExercises(workout.Exercises)
+	if err != nil {
+		return err
+	}
+
+	existingExercises := make(map[int]WorkoutExercise, len(existingWorkout.Exercises))
+	for _, exercise := range existingWorkout.Exercises {
+		existingExercises[exercise.ID] = exercise
+	}
+
+	now := time.Now()
+	for i := range workout.Exercises {
+		exercise := &workout.Exercises[i]
+		numberWorkoutSets(exercise)
+
+		existingExercise, ok := existingExercises[exercise.ID]
+		if ok && !sameWeights(existingExercise, *exercise) {
+			delete(ws.db.legacyWorkoutExercises, exercise.ID)
+		}
+		switch {
+		case !ok:
+			ws.initExercise(exercise)
+		case sameExerciseContent(existingExercise, *exercise) && existingExercise.OrderIndex == exercise.OrderIndex:
+			exercise.CreatedAt = existingExercise.CreatedAt
+			exercise.UpdatedAt = existingExercise.UpdatedAt
+		default:
+			exercise.CreatedAt = existingExercise.CreatedAt
+			exercise.UpdatedAt = now
+		}
+	}
+	workout.Version++
+	workout.CreatedAt = existingWorkout.CreatedAt
+
+	updatedWorkout := copyWorkout(workout)
+	updatedWorkout.UserID = existingWorkout.UserID
+	updatedWorkout.TemplateID = existingWorkout.TemplateID
+	updatedWorkout.DeletedAt = nil
+	ws.db.workouts[workout.ID] = updatedWorkout
+	if !existingWorkout.StartedAt.Equal(workout.StartedAt) {
+		ws.db.removeWorkoutDay(existingWorkout.UserID, existingWorkout.StartedAt)
+		ws.db.addWorkoutDay(existingWorkout.UserID, workout.StartedAt)
+	}
+	workout.UserID = existingWorkout.UserID
+	workout.Exercises = copyWorkout(updatedWorkout).Exercises
+	ws.db.refreshPersonalRecords(workout.UserID, earlier(existingWorkout.StartedAt, workout.StartedAt), workout)
+
+	return nil
+}
+
+func (ws *InMemoryWorkoutStore) DeleteWorkout(id int, version int) error {
+	unlock := ws.db.lock()
+	defer unlock()
+
+	workout, ok := ws.db.activeWorkout(id)
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	if version != 0 && workout.Version != version {
+		return ErrVersionConflict
+	}
+
+	deletedAt := time.Now()
+	workout.DeletedAt = &deletedAt
+	workout.Version++
+	ws.db.removeWorkoutDay(workout.UserID, workout.StartedAt)
+	ws.db.refreshPersonalRecords(workout.UserID, workout.StartedAt)
+
+	return nil
+}
+
+func (ws *InMemoryWorkoutStore) GetWorkoutOwner(id int) (int, error) {
+	unlock := ws.db.rlock()
+	defer unlock()
+
+	workout, ok := ws.db.activeWorkout(id)
+	if !ok {
+		return 0, sql.ErrNoRows
+	}
+
+	return workout.UserID, nil
+}
+
+func (ws *InMemoryWorkoutStore) ListWorkoutsStarted(userID int, from, to time.Time) ([]Workout, error) {
+	unlock := ws.db.rlock()
+	defer unlock()
+
+	workouts := []Workout{}
+	for _, workout := range ws.db.workouts {
+		if workout.UserID == userID && workout.DeletedAt == nil &&
+			!workout.StartedAt.Before(from) && workout.StartedAt.Before(to) {
+			workouts = append(workouts, *copyWorkout(workout))
+		}
+	}
+
+	sort.Slice(workouts, func(i, j int) bool {
+		if !workouts[i].StartedAt.Equal(workouts[j].StartedAt) {
+			return workouts[i].StartedAt.Before(workouts[j].StartedAt)
+		}
+		return workouts[i].ID < workouts[j].ID
+	})
+
+	return workouts, nil
+}
+
+func (ws *InMemoryWorkoutStore) ListWorkoutsAfter(userID, afterID, limit int, trashed bool) ([]Workout, error) {
+	unlock := ws.db.rlock()
+	defer unlock()
+
+	workouts := []Workout{}
+	for _, workout := range ws.db.workouts {
+		if workout.UserID == userID && (workout.DeletedAt != nil) == trashed && workout.ID > afterID {
+			workouts = append(workouts, *copyWorkout(workout))
+		}
+	}
+
+	sort.Slice(workouts, func(i, j int) bool {
+		return workouts[i].ID < workouts[j].ID
+	})
+
+	return workouts[:min(limit, len(workouts))], nil
+}
+
+func (ws *InMemoryWorkoutStore) CountWorkouts(userID int) (int, error) {
+	unlock := ws.db.rlock()
+	defer unlock()
+
+	count := 0
+	for _, workout := range ws.db.workouts {
+		if workout.UserID == userID && workout.DeletedAt == nil {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (ws *InMemoryWorkoutStore) ListTrashedWorkouts(userID int) ([]Workout, error) {
+	unlock := ws.db.rlock()
+	defer unlock()
+
+	workouts := []Workout{}
+	for _, workout := range ws.db.workouts {
+		if workout.UserID == userID && workout.DeletedAt != nil {
+			workoutCopy := copyWorkout(workout)
+			workoutCopy.Exercises = nil
+			workouts = append(workouts, *workoutCopy)
+		}
+	}
+
+	sort.Slice(workouts, func(i, j int) bool {
+		if !workouts[i].DeletedAt.Equal(*workouts[j].DeletedAt) {
+			return workouts[i].DeletedAt.After(*workouts[j].DeletedAt)
+		}
+		return workouts[i].ID > workouts[j].ID
+	})
+
+	return workouts, nil
+}
+
+func (ws *InMemoryWorkoutStore) GetTrashedWorkout(id int) (*Workout, error) {
+	unlock := ws.db.rlock()
+	defer unlock()
+
+	workout, ok := ws.db.trashedWorkout(id)
+	if !ok {
+		return nil, nil
+	}
+
+	return copyWorkout(workout), nil
+}
+
+func (ws *InMemoryWorkoutStore) RestoreWorkout(id int) error {
+	unlock := ws.db.lock()
+	defer unlock()
+
+	workout, ok := ws.db.trashedWorkout(id)
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	workout.DeletedAt = nil
+	workout.Version++
+	ws.db.addWorkoutDay(workout.UserID, workout.StartedAt)
+	ws.db.refreshPersonalRecords(workout.UserID, workout.StartedAt)
+
+	return nil
+}
+
+func (ws *InMemoryWorkoutStore) PurgeWorkout(id int) error {
+	unlock := ws.db.lock()
+	defer unlock()
+
+	if _, ok := ws.db.trashedWorkout(id); !ok {
+		return sql.ErrNoRows
+	}
+
+	ws.db.deleteWorkout(id)
+
+	return nil
+}
+
+func (ws *InMemoryWorkoutStore) PurgeTrashedWorkouts(deletedBefore time.Time) (int, error) {
+	unlock := ws.db.lock()
+	defer unlock()
+
+	purged := 0
+	for id, workout := range ws.db.workouts {
+		if workout.DeletedAt != nil && workout.DeletedAt.Before(deletedBefore) {
+			ws.db.deleteWorkout(id)
+			purged++
+		}
+	}
+
+	return purged, nil
+}
+
+// deleteWorkout deletes the sessions the workout completed, its personal
+// records and its revisions too. It must be called with the lock held.
+func (db *MemoryDB) deleteWorkout(id int) {
+	db.uncompleteSessions(func(session CompletedSession) bool {
+		return session.WorkoutID == id
+	})
+	db.deletePersonalRecords(id)
+	delete(db.workoutRevisions, id)
+
+	delete(db.workouts, id)
+}
+
+func (ws *InMemoryWorkoutStore) AddWorkoutExercise(workoutID int, exercise *WorkoutExercise) error {
+	unlock := ws.db.lock()
+	defer unlock()
+
+	workout, ok := ws.db.activeWorkout(workoutID)
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	err := ws.db.checkWorkoutExercises([]WorkoutExercise{*exercise})
+	if err != nil {
+		return err
+	}
+
+	position := exercise.OrderIndex
+	ws.initExercise(exercise)
+	numberWorkoutSets(exercise)
+	exercise.OrderIndex = len(workout.Exercises) + 1
+	workout.Exercises = append(workout.Exercises, copyWorkoutExercise(*exercise))
+
+	applyMemoryExerciseOrder(workout, moveExercise(orderedExerciseIDs(workout), exercise.ID, position))
+	*exercise = copyWorkoutExercise(*findExercise(workout, exercise.ID))
+	ws.db.refreshPersonalRecords(workout.UserID, workout.StartedAt)
+
+	return nil
+}
+
+func (ws *InMemoryWorkoutStore) UpdateWorkoutExercise(workoutID int, exercise *WorkoutExercise) error {
+	unlock := ws.db.lock()
+	defer unlock()
+
+	workout, ok := ws.db.activeWorkout(workoutID)
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	existingExercise := findExercise(workout, exercise.ID)
+	if existingExercise == nil {
+		return sql.ErrNoRows
+	}
+
+	err := ws.db.checkWorkoutExercises([]WorkoutExercise{*exercise})
+	if err != nil {
+		return err
+	}
+
+	if !sameWeights(*existingExercise, *exercise) {
+		delete(ws.db.legacyWorkoutExercises, exercise.ID)
+	}
+	existingExercise.ExerciseID = exercise.ExerciseID
+	existingExercise.Name = exercise.Name
+	existingExercise.Sets = exercise.Sets
+	existingExercise.Reps = exercise.Reps
+	existingExercise.DurationSeconds = exercise.DurationSeconds
+	existingExercise.Weight = exercise.Weight
+	existingExercise.WorkoutSets = exercise.WorkoutSets
+	numberWorkoutSets(existingExercise)
+	existingExercise.Notes = exercise.Notes
+	existingExercise.UpdatedAt = time.Now()
+	*existingExercise = copyWorkoutExercise(*existingExercise)
+
+	applyMemoryExerciseOrder(workout, moveExercise(orderedExerciseIDs(workout), exercise.ID, exercise.OrderIndex))
+	*exercise = copyWorkoutExercise(*findExercise(workout, exercise.ID))
+	ws.db.refreshPersonalRecords(workout.UserID, workout.StartedAt)
+
+	return nil
+}
+
+func (ws *InMemoryWorkoutStore) DeleteWorkoutExercise(workoutID, exerciseID int) error {
+	unlock := ws.db.lock()
+	defer unlock()
+
+	workout, ok := ws.db.activeWorkout(workoutID)
+	if !ok || findExercise(workout, exerciseID) == nil {
+		return sql.ErrNoRows
+	}
+
+	orderedIDs := removeExercise(orderedExerciseIDs(workout), exerciseID)
+	workout.Exercises = slices.DeleteFunc(workout.Exercises, func(exercise WorkoutExercise) bool {
+		return exercise.ID == exerciseID
+	})
+	applyMemoryExerciseOrder(workout, orderedIDs)
+	ws.db.refreshPersonalRecords(workout.UserID, workout.StartedAt)
+
+	return nil
+}
+
+func (ws *InMemoryWorkoutStore) ReorderWorkoutExercises(workoutID int, exerciseIDs []int) ([]WorkoutExercise, error) {
+	unlock := ws.db.lock()
+	defer unlock()
+
+	workout, ok := ws.db.activeWorkout(workoutID)
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	if !sameExercises(orderedExerciseIDs(workout), exerciseIDs) {
+		return nil, ErrInvalidExerciseOrder
+	}
+
+	applyMemoryExerciseOrder(workout, exerciseIDs)
+
+	return copyWorkout(workout).Exercises, nil
+}
+
+// activeWorkout returns a workout that is not in the trash. Like trashedWorkout,
+// it must be called with the lock held.
+func (db *MemoryDB) activeWorkout(id int) (*Workout, bool) {
+	workout, ok := db.workouts[id]
+	if !ok || workout.DeletedAt != nil {
+		return nil, false
+	}
+
+	return workout, true
+}
+
+func (db *MemoryDB) trashedWorkout(id int) (*Workout, bool) {
+	workout, ok := db.workouts[id]
+	if !ok || workout.DeletedAt == nil {
+		return nil, false
+	}
+
+	return workout, true
+}
+
+// initExercise must be called with the write lock held.
+func (ws *InMemoryWorkoutStore) initExercise(exercise *WorkoutExercise) {
+	ws.db.lastWorkoutExerciseID++
+	exercise.ID = ws.db.lastWorkoutExerciseID
+	exercise.CreatedAt = time.Now()
+	exercise.UpdatedAt = exercise.CreatedAt
+}
+
+func findExercise(workout *Workout, exerciseID int) *WorkoutExercise {
+	for i := range workout.Exercises {
+		if workout.Exercises[i].ID == exerciseID {
+			return &workout.Exercises[i]
+		}
+	}
+
+	return nil
+}
+
+func orderedExerciseIDs(workout *Workout) []int {
+	var ids []int
+	for _, exercise := range copyWorkout(workout).Exercises {
+		ids = append(ids, exercise.ID)
+	}
+
+	return ids
+}
+
+// applyMemoryExerciseOrder mirrors applyExerciseOrder and bumps the workout
+// version like lockWorkoutExercises does.
+func applyMemoryExerciseOrder(workout *Workout, orderedIDs []int) {
+	now := time.Now()
+	for position, id := range orderedIDs {
+		exercise := findExercise(workout, id)
+		if exercise.OrderIndex != position+1 {
+			exercise.OrderIndex = position + 1
+			exercise.UpdatedAt = now
+		}
+	}
+
+	workout.Version++
+}
+
+func sameExerciseContent(a, b WorkoutExercise) bool {
+	return equalPtr(a.ExerciseID, b.ExerciseID) &&
+		a.Name == b.Name &&
+		a.Sets == b.Sets &&
+		equalPtr(a.Reps, b.Reps) &&
+		equalPtr(a.DurationSeconds, b.DurationSeconds) &&
+		equalPtr(a.Weight, b.Weight) &&
+		a.Notes == b.Notes
+}
+
+func equalPtr[T comparable](a, b *T) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return *a == *b
+}
+
+// checkWorkoutExercises mirrors the check constraints of workout_exercises and
+// workout_sets. checkWorkoutExercises must be called with the lock held.
+func (db *MemoryDB) checkWorkoutExercises(exercises []WorkoutExercise) error {
+	for _, exercise := range exercises {
+		if (exercise.Reps == nil) == (exercise.DurationSeconds == nil) {
+			return fmt.Errorf("%w: workout_exercises.no_reps_and_duration_together", errCheckViolation)
+		}
+		for _, set := range exercise.WorkoutSets {
+			if !slices.Contains(WorkoutSetTypes, set.SetType) {
+				return fmt.Errorf("%w: workout_sets.set_type_known", errCheckViolation)
+			}
+			if (set.Reps == nil) == (set.DurationSeconds == nil) {
+				return fmt.Errorf("%w: workout_sets.no_set_reps_and_duration_together", errCheckViolation)
+			}
+			if set.RPE != nil && (*set.RPE < 1 || *set.RPE > 10) {
+				return fmt.Errorf("%w: workout_sets.rpe_between_1_and_10", errCheckViolation)
+			}
+		}
+		if exercise.ExerciseID != nil {
+			if _, ok := db.exercises[*exercise.ExerciseID]; !ok {
+				return fmt.Errorf("%w: workout_exercises.exercise_id", errForeignKeyViolation)
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkWorkoutTimes mirrors the ended_after_started check of the workouts
+// table.
+func checkWorkoutTimes(startedAt time.Time, endedAt *time.Time) error {
+	if endedAt != nil && endedAt.Before(startedAt) {
+		return fmt.Errorf("%w: workouts.ended_after_started", errCheckViolation)
+	}
+
+	return nil
+}
+
+func copyWorkout(workout *Workout) *Workout {
+	workoutCopy := *workout
+	workoutCopy.Exercises = nil
+
+	if workout.TemplateID != nil {
+		templateID := *workout.TemplateID
+		workoutCopy.TemplateID = &templateID
+	}
+
+	if workout.EndedAt != nil {
+		endedAt := *workout.EndedAt
+		workoutCopy.EndedAt = &endedAt
+	}
+
+	if workout.DeletedAt != nil {
+		deletedAt := *workout.DeletedAt
+		workoutCopy.DeletedAt = &deletedAt
+	}
+
+	if workout.CaloriesBurned != nil {
+		caloriesBurned := *workout.CaloriesBurned
+		workoutCopy.CaloriesBurned = &caloriesBurned
+	}
+
+	for _, exercise := range workout.Exercises {
+		workoutCopy.Exercises = append(workoutCopy.Exercises, copyWorkoutExercise(exercise))
+	}
+
+	sort.SliceStable(workoutCopy.Exercises, func(i, j int) bool {
+		return workoutCopy.Exercises[i].OrderIndex < workoutCopy.Exercises[j].OrderIndex
+	})
+
+	return &workoutCopy
+}
+
+func copyWorkoutExercise(exercise WorkoutExercise) WorkoutExercise {
+	if exercise.ExerciseID != nil {
+		exerciseID := *exercise.ExerciseID
+		exercise.ExerciseID = &exerciseID
+	}
+	if exercise.Reps != nil {
+		reps := *exercise.Reps
+		exercise.Reps = &reps
+	}
+	if exercise.DurationSeconds != nil {
+		durationSeconds := *exercise.DurationSeconds
+		exercise.DurationSeconds = &durationSeconds
+	}
+	if exercise.Weight != nil {
+		weight := *exercise.Weight
+		exercise.Weight = &weight
+	}
+
+	sets := exercise.WorkoutSets
+	exercise.WorkoutSets = nil
+	for _, set := range sets {
+		exercise.WorkoutSets = append(exercise.WorkoutSets, copyWorkoutSet(set))
+	}
+
+	return exercise
+}
+
+func copyWorkoutSet(set WorkoutSet) WorkoutSet {
+	if set.Reps != nil {
+		reps := *set.Reps
+		set.Reps = &reps
+	}
+	if set.Weight != nil {
+		weight := *set.Weight
+		set.Weight = &weight
+	}
+	if set.DurationSeconds != nil {
+		durationSeconds := *set.DurationSeconds
+		set.DurationSeconds = &durationSeconds
+	}
+	if set.DistanceMeters != nil {
+		distanceMeters := *set.DistanceMeters
+		set.DistanceMeters = &distanceMeters
+	}
+	if set.RPE != nil {
+		rpe := *set.RPE
+		set.RPE = &rpe
+	}
+	if set.RIR != nil {
+		rir := *set.RIR
+		set.RIR = &rir
+	}
+	if set.RestSeconds != nil {
+		restSeconds := *set.RestSeconds
+		set.RestSeconds = &restSeconds
+	}
+
+	return set
+}
@@ -0,0 +1,392 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PersonalRecord is a best performance of a user on an exercise, as set by a
+// workout. Records of the exercises linked to the exercise catalog are kept
+// per exercise_id, the others per name. Weight is the weight of a
+// RecordMaxReps record, and PreviousValue the record it beat, if any.
+// Estimated 1RMs use the Epley formula.
+type PersonalRecord struct {
+	ID            int       `json:"id"`
+	UserID        int       `json:"user_id"`
+	WorkoutID     int       `json:"workout_id"`
+	ExerciseID    *int      `json:"exercise_id"`
+	ExerciseName  string    `json:"exercise_name"`
+	RecordType    string    `json:"record_type"`
+	Weight        *float64  `json:"weight"`
+	Value         float64   `json:"value"`
+	PreviousValue *float64  `json:"previous_value"`
+	AchievedAt    time.Time `json:"achieved_at"`
+}
+
+const (
+	RecordMaxWeight    = "max_weight"
+	RecordMaxReps      = "max_reps"
+	RecordEstimated1RM = "estimated_1rm"
+	RecordMaxDuration  = "max_duration"
+	RecordMaxVolume    = "max_volume"
+)
+
+// RecordTypes are in the order records are listed in.
+var RecordTypes = []string{RecordMaxWeight, RecordMaxReps, RecordEstimated1RM, RecordMaxDuration, RecordMaxVolume}
+
+// WeightRecordTypes are the record types whose values are in kilograms.
+var WeightRecordTypes = []string{RecordMaxWeight, RecordEstimated1RM, RecordMaxVolume}
+
+type PersonalRecordStore interface {
+	// ListPersonalRecords returns the current records of a user, by exercise
+	// and record type, or with history every record they set, most recent
+	// first. The records of trashed workouts are left out.
+	ListPersonalRecords(userID int, history bool) ([]PersonalRecord, error)
+}
+
+var _ PersonalRecordStore = (*PostgresPersonalRecordStore)(nil)
+
+type PostgresPersonalRecordStore struct {
+	db DBTX
+}
+
+func NewPostgresPersonalRecordStore(db DBTX) *PostgresPersonalRecordStore {
+	return &PostgresPersonalRecordStore{
+		db: db,
+	}
+}
+
+func (rs *PostgresPersonalRecordStore) ListPersonalRecords(userID int, history bool) ([]PersonalRecord, error) {
+	records, err := getPersonalRecords(rs.db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if history {
+		return records, nil
+	}
+
+	return currentRecords(records), nil
+}
+
+const personalRecordColumns = `pr.id, pr.user_id, pr.workout_id, pr.exercise_id, pr.exercise_name, pr.record_type, pr.weight, pr.value, pr.previous_value, pr.achieved_at`
+
+// getPersonalRecords returns the records of a user, but the ones of trashed
+// workouts, most recent first.
+func getPersonalRecords(db DBTX, userID int) ([]PersonalRecord, error) {
+	query := `
+		SELECT ` + personalRecordColumns + `
+		FROM personal_records pr
+		JOIN workouts w ON w.id = pr.workout_id
+		WHERE pr.user_id = $1 AND w.deleted_at IS NULL
+		ORDER BY pr.achieved_at DESC, pr.id DESC
+	`
+
+	records := []PersonalRecord{}
+	err := queryRows(db, query, []any{userID}, func(rows *sql.Rows) error {
+		var record PersonalRecord
+		err := scanPersonalRecord(rows, &record)
+		records = append(records, record)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+func scanPersonalRecord(rows *sql.Rows, record *PersonalRecord) error {
+	return rows.Scan(
+		&record.ID,
+		&record.UserID,
+		&record.WorkoutID,
+		&record.ExerciseID,
+		&record.ExerciseName,
+		&record.RecordType,
+		&record.Weight,
+		&record.Value,
+		&record.PreviousValue,
+		&record.AchievedAt,
+	)
+}
+
+// refreshPersonalRecords recomputes the records of a user set by the workouts
+// started from from on, in the order they started, since a change to a
+// workout changes which of the later workouts beat the records and what they
+// beat. It sets the NewRecords of workouts to the records they set that they
+// did not hold before, then evaluates the goals of the user.
+func refreshPersonalRecords(tx DBTX, userID int, from time.Time, workouts ...*Workout) error {
+	workoutIDs := make([]int, len(workouts))
+	for i, workout := range workouts {
+		workoutIDs[i] = workout.ID
+	}
+
+	heldRecords := make(map[int][]PersonalRecord, len(workouts))
+	query := `SELECT ` + personalRecordColumns + ` FROM personal_records pr WHERE pr.workout_id = ANY($1)`
+	err := queryRows(tx, query, []any{workoutIDs}, func(rows *sql.Rows) error {
+		var record PersonalRecord
+		err := scanPersonalRecord(rows, &record)
+		heldRecords[record.WorkoutID] = append(heldRecords[record.WorkoutID], record)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		DELETE FROM personal_records pr
+		USING workouts w
+		WHERE w.id = pr.workout_id AND pr.user_id = $1 AND w.started_at >= $2
+	`, userID, from)
+	if err != nil {
+		return err
+	}
+
+	existingRecords, err := getPersonalRecords(tx, userID)
+	if err != nil {
+		return err
+	}
+
+	laterWorkouts, err := listWorkoutsStartedFrom(tx, userID, from)
+	if err != nil {
+		return err
+	}
+
+	setRecords := make(map[int][]PersonalRecord, len(laterWorkouts))
+	var records []PersonalRecord
+	for i := range laterWorkouts {
+		workout := &laterWorkouts[i]
+		beaten := beatenRecords(workout, existingRecords)
+		for j := range beaten {
+			beaten[j].AchievedAt = workout.StartedAt
+		}
+
+		existingRecords = append(existingRecords, beaten...)
+		records = append(records, beaten...)
+	}
+
+	recordIDs, err := nextIDs(tx, "personal_records", len(records))
+	if err != nil {
+		return err
+	}
+
+	recordRows := make([][]any, len(records))
+	for i := range records {
+		record := &records[i]
+		record.ID = recordIDs[i]
+		recordRows[i] = []any{record.ID, record.UserID, record.WorkoutID, record.ExerciseID, record.ExerciseName, record.RecordType, record.Weight, record.Value, record.PreviousValue, record.AchievedAt}
+		setRecords[record.WorkoutID] = append(setRecords[record.WorkoutID], *record)
+	}
+
+	insert := `INSERT INTO personal_records (id, user_id, workout_id, exercise_id, exercise_name, record_type, weight, value, previous_value, achieved_at)`
+	err = insertRows(tx, insert, recordRows, "", nil)
+	if err != nil {
+		return err
+	}
+
+	for _, workout := range workouts {
+		workout.NewRecords = unheldRecords(setRecords[workout.ID], heldRecords[workout.ID])
+	}
+
+	return refreshGoals(tx, userID)
+}
+
+// refreshWorkoutRecords is refreshPersonalRecords for a workout changed
+// exercise by exercise.
+func refreshWorkoutRecords(tx DBTX, workoutID int) error {
+	workout, err := getWorkout(tx, workoutID, false)
+	if err != nil {
+		return err
+	}
+
+	if workout == nil {
+		return sql.ErrNoRows
+	}
+
+	return refreshPersonalRecords(tx, workout.UserID, workout.StartedAt, workout)
+}
+
+// unheldRecords returns the records that are not among heldRecords, with the
+// same value, so that a change to a workout only reports the records it sets
+// anew.
+func unheldRecords(records, heldRecords []PersonalRecord) []PersonalRecord {
+	heldValues := make(map[string]float64, len(heldRecords))
+	for _, record := range heldRecords {
+		heldValues[recordKey(record)] = record.Value
+	}
+
+	unheld := []PersonalRecord{}
+	for _, record := range records {
+		if value, ok := heldValues[recordKey(record)]; !ok || value != record.Value {
+			unheld = append(unheld, record)
+		}
+	}
+
+	return unheld
+}
+
+// beatenRecords returns the records that the exercises of a workout set, that
+// is the performances better than every record in existingRecords.
+func beatenRecords(workout *Workout, existingRecords []PersonalRecord) []PersonalRecord {
+	bestValues := make(map[string]float64, len(existingRecords))
+	for _, record := range existingRecords {
+		if best, ok := bestValues[recordKey(record)]; !ok || record.Value > best {
+			bestValues[recordKey(record)] = record.Value
+		}
+	}
+
+	records := []PersonalRecord{}
+	for _, candidate := range recordCandidates(workout) {
+		best, ok := bestValues[recordKey(candidate)]
+		if ok && candidate.Value <= best {
+			continue
+		}
+
+		if ok {
+			candidate.PreviousValue = &best
+		}
+		bestValues[recordKey(candidate)] = candidate.Value
+		records = append(records, candidate)
+	}
+
+	return records
+}
+
+// recordCandidates returns the best performance of each exercise of a workout
+// for every record type it has a value for. Only the completed sets other than
+// warm-ups count, or all the sets of exercises logged without sets.
+func recordCandidates(workout *Workout) []PersonalRecord {
+	var candidates []PersonalRecord
+	for _, exercise := range workout.Exercises {
+		best := make(map[string]float64)
+		bestReps := make(map[float64]float64)
+		volume := 0.0
+
+		for _, set := range performedSets(exercise) {
+			weight := valueOrZero(set.Weight)
+			reps := float64(valueOrZero(set.Reps))
+
+			if set.DurationSeconds != nil {
+				best[RecordMaxDuration] = max(best[RecordMaxDuration], float64(*set.DurationSeconds))
+			}
+			if set.Reps != nil && reps > 0 {
+				bestReps[weight] = max(bestReps[weight], reps)
+			}
+			if reps > 0 && weight > 0 {
+				best[RecordMaxWeight] = max(best[RecordMaxWeight], weight)
+				oneRepMax, _ := estimateOneRepMax(OneRepMaxEpley, weight, reps)
+				best[RecordEstimated1RM] = max(best[RecordEstimated1RM], oneRepMax)
+				volume += weight * reps
+			}
+		}
+		if volume > 0 {
+			best[RecordMaxVolume] = volume
+		}
+
+		newCandidate := func(recordType string, weight *float64, value float64) PersonalRecord {
+			return PersonalRecord{
+				UserID:       workout.UserID,
+				WorkoutID:    workout.ID,
+				ExerciseID:   exercise.ExerciseID,
+				ExerciseName: exercise.Name,
+				RecordType:   recordType,
+				Weight:       weight,
+				Value:        math.Round(value*100) / 100,
+			}
+		}
+
+		for _, recordType := range RecordTypes {
+			if recordType == RecordMaxReps {
+				weights := make([]float64, 0, len(bestReps))
+				for weight := range bestReps {
+					weights = append(weights, weight)
+				}
+				slices.Sort(weights)
+
+				for _, weight := range weights {
+					candidates = append(candidates, newCandidate(RecordMaxReps, &weight, bestReps[weight]))
+				}
+				continue
+			}
+
+			if value, ok := best[recordType]; ok {
+				candidates = append(candidates, newCandidate(recordType, nil, value))
+			}
+		}
+	}
+
+	return candidates
+}
+
+func performedSets(exercise WorkoutExercise) []WorkoutSet {
+	if len(exercise.WorkoutSets) == 0 {
+		sets := make([]WorkoutSet, exercise.Sets)
+		for i := range sets {
+			sets[i] = WorkoutSet{Reps: exercise.Reps, Weight: exercise.Weight, DurationSeconds: exercise.DurationSeconds}
+		}
+		return sets
+	}
+
+	var sets []WorkoutSet
+	for _, set := range exercise.WorkoutSets {
+		if set.Completed && set.SetType != WorkoutSetWarmup {
+			sets = append(sets, set)
+		}
+	}
+
+	return sets
+}
+
+// recordKey identifies what a record is a record of.
+func recordKey(record PersonalRecord) string {
+	exercise := "name:" + strings.ToLower(strings.TrimSpace(record.ExerciseName))
+	if record.ExerciseID != nil {
+		exercise = fmt.Sprintf("id:%d", *record.ExerciseID)
+	}
+
+	key := exercise + "/" + record.RecordType
+	if record.Weight != nil {
+		key += fmt.Sprintf("/%g", *record.Weight)
+	}
+
+	return key
+}
+
+// currentRecords keeps the best of the records of each key, the earliest one
+// on ties, ordered by exercise name and record type.
+func currentRecords(records []PersonalRecord) []PersonalRecord {
+	best := make(map[string]PersonalRecord)
+	for _, record := range records {
+		current, ok := best[recordKey(record)]
+		if !ok || record.Value > current.Value ||
+			(record.Value == current.Value && record.AchievedAt.Before(current.AchievedAt)) {
+			best[recordKey(record)] = record
+		}
+	}
+
+	current := make([]PersonalRecord, 0, len(best))
+	for _, record := range best {
+		current = append(current, record)
+	}
+
+	sort.Slice(current, func(i, j int) bool {
+		if nameI, nameJ := strings.ToLower(current[i].ExerciseName), strings.ToLower(current[j].ExerciseName); nameI != nameJ {
+			return nameI < nameJ
+		}
+		if current[i].RecordType != current[j].RecordType {
+			return slices.Index(RecordTypes, current[i].RecordType) < slices.Index(RecordTypes, current[j].RecordType)
+		}
+		if weightI, weightJ := valueOrZero(current[i].Weight), valueOrZero(current[j].Weight); weightI != weightJ {
+			return weightI < weightJ
+		}
+		return current[i].ID < current[j].ID
+	})
+
+	return current
+}
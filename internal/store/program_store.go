@@ -0,0 +1,241 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Program is a training program of Weeks weeks, designed by the user UserID,
+// which any user can enroll in.
+type Program struct {
+	ID          int          `json:"id"`
+	UserID      int          `json:"user_id"`
+	Name        string       `json:"name"`
+	Description string       `json:"description"`
+	Weeks       int          `json:"weeks"`
+	Days        []ProgramDay `json:"days"`
+	CreatedAt   time.Time    `json:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+}
+
+// ProgramDay is a session of a template, planned on a day (1 to 7) of a week
+// of a program.
+type ProgramDay struct {
+	ID         int `json:"id"`
+	Week       int `json:"week"`
+	Day        int `json:"day"`
+	TemplateID int `json:"template_id"`
+}
+
+// ErrProgramInUse is returned when deleting a program that other users than
+// its designer are enrolled in.
+var ErrProgramInUse = errors.New("program has enrollments")
+
+type ProgramStore interface {
+	CreateProgram(program *Program) error
+	GetProgram(id int) (*Program, error)
+	// ListPrograms returns every program without its days, by name.
+	ListPrograms() ([]Program, error)
+	// UpdateProgram replaces the fields and the days of a program. Days are
+	// matched by week and day, so that the days kept keep their id and the
+	// sessions completed on them.
+	UpdateProgram(program *Program) error
+	// DeleteProgram deletes the enrollments of the designer in the program too.
+	// It returns ErrProgramInUse if other users are enrolled in it.
+	DeleteProgram(id int) error
+}
+
+var _ ProgramStore = (*PostgresProgramStore)(nil)
+
+type PostgresProgramStore struct {
+	db DBTX
+}
+
+func NewPostgresProgramStore(db DBTX) *PostgresProgramStore {
+	return &PostgresProgramStore{
+		db: db,
+	}
+}
+
+func (ps *PostgresProgramStore) CreateProgram(program *Program) error {
+	return runInTx(ps.db, func(tx DBTX) error {
+		query := `
+			INSERT INTO programs (user_id, name, description, weeks)
+			VALUES ($1, $2, $3, $4)
+			RETURNING id, created_at, updated_at
+		`
+
+		err := tx.QueryRow(query, program.UserID, program.Name, program.Description, program.Weeks).
+			Scan(&program.ID, &program.CreatedAt, &program.UpdatedAt)
+		if err != nil {
+			return err
+		}
+
+		return upsertProgramDays(tx, program)
+	})
+}
+
+const programColumns = `id, user_id, name, description, weeks, created_at, updated_at`
+
+func scanProgram(row interface{ Scan(dest ...any) error }, program *Program) error {
+	return row.Scan(
+		&program.ID,
+		&program.UserID,
+		&program.Name,
+		&program.Description,
+		&program.Weeks,
+		&program.CreatedAt,
+		&program.UpdatedAt,
+	)
+}
+
+func (ps *PostgresProgramStore) GetProgram(id int) (*Program, error) {
+	program := &Program{}
+
+	query := `SELECT ` + programColumns + ` FROM programs WHERE id = $1`
+
+	err := scanProgram(ps.db.QueryRow(query, id), program)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	daysQuery := `
+		SELECT id, week, day, template_id
+		FROM program_days
+		WHERE program_id = $1
+		ORDER BY week, day
+	`
+
+	program.Days = []ProgramDay{}
+	err = queryRows(ps.db, daysQuery, []any{id}, func(rows *sql.Rows) error {
+		var day ProgramDay
+		err := rows.Scan(&day.ID, &day.Week, &day.Day, &day.TemplateID)
+		program.Days = append(program.Days, day)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return program, nil
+}
+
+func (ps *PostgresProgramStore) ListPrograms() ([]Program, error) {
+	query := `SELECT ` + programColumns + ` FROM programs ORDER BY lower(name) COLLATE "C", id`
+
+	programs := []Program{}
+	err := queryRows(ps.db, query, nil, func(rows *sql.Rows) error {
+		var program Program
+		err := scanProgram(rows, &program)
+		programs = append(programs, program)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return programs, nil
+}
+
+func (ps *PostgresProgramStore) UpdateProgram(program *Program) error {
+	return runInTx(ps.db, func(tx DBTX) error {
+		query := `
+			UPDATE programs
+			SET name = $1, description = $2, weeks = $3, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $4
+			RETURNING user_id, created_at, updated_at
+		`
+
+		err := tx.QueryRow(query, program.Name, program.Description, program.Weeks, program.ID).
+			Scan(&program.UserID, &program.CreatedAt, &program.UpdatedAt)
+		if err != nil {
+			return err
+		}
+
+		weeks, days, _ := programDayColumns(program.Days)
+		deleteQuery := `
+			DELETE FROM program_days
+			WHERE program_id = $1
+			AND (week, day) NOT IN (SELECT * FROM unnest($2::integer[], $3::integer[]))
+		`
+
+		_, err = tx.Exec(deleteQuery, program.ID, weeks, days)
+		if err != nil {
+			return err
+		}
+
+		return upsertProgramDays(tx, program)
+	})
+}
+
+func (ps *PostgresProgramStore) DeleteProgram(id int) error {
+	return runInTx(ps.db, func(tx DBTX) error {
+		// locking the program holds off the enrollments in it until it is gone
+		var inUse bool
+		query := `
+			SELECT EXISTS (
+				SELECT 1 FROM enrollments e WHERE e.program_id = p.id AND e.user_id <> p.user_id
+			)
+			FROM programs p
+			WHERE p.id = $1
+			FOR UPDATE OF p
+		`
+
+		err := tx.QueryRow(query, id).Scan(&inUse)
+		if err != nil {
+			return err
+		}
+
+		if inUse {
+			return fmt.Errorf("%w: program %d", ErrProgramInUse, id)
+		}
+
+		return execAffectingRow(tx, `DELETE FROM programs WHERE id = $1`, id)
+	})
+}
+
+// upsertProgramDays inserts the days of a program, or updates the template of
+// the days it already has, and sets their ids.
+func upsertProgramDays(tx DBTX, program *Program) error {
+	weeks, days, templateIDs := programDayColumns(program.Days)
+	query := `
+		INSERT INTO program_days (program_id, week, day, template_id)
+		SELECT $1, week, day, template_id
+		FROM unnest($2::integer[], $3::integer[], $4::integer[]) AS days(week, day, template_id)
+		ON CONFLICT (program_id, week, day) DO UPDATE SET template_id = EXCLUDED.template_id
+		RETURNING id, week, day
+	`
+
+	ids := make(map[[2]int]int, len(program.Days))
+	err := queryRows(tx, query, []any{program.ID, weeks, days, templateIDs}, func(rows *sql.Rows) error {
+		var id, week, day int
+		err := rows.Scan(&id, &week, &day)
+		ids[[2]int{week, day}] = id
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	for i := range program.Days {
+		program.Days[i].ID = ids[[2]int{program.Days[i].Week, program.Days[i].Day}]
+	}
+
+	return nil
+}
+
+func programDayColumns(programDays []ProgramDay) (weeks, days, templateIDs []int) {
+	weeks = make([]int, len(programDays))
+	days = make([]int, len(programDays))
+	templateIDs = make([]int, len(programDays))
+	for i, programDay := range programDays {
+		weeks[i], days[i], templateIDs[i] = programDay.Week, programDay.Day, programDay.TemplateID
+	}
+
+	return weeks, days, templateIDs
+}
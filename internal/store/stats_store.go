@@ -0,0 +1,297 @@
+package store
+
+import (
+	"cmp"
+	"database/sql"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The buckets statistics are grouped in. Weeks start on Monday, and every
+// bucket is in the time zone of the stats query.
+const (
+	StatsBucketDay   = "day"
+	StatsBucketWeek  = "week"
+	StatsBucketMonth = "month"
+)
+
+var StatsBuckets = []string{StatsBucketDay, StatsBucketWeek, StatsBucketMonth}
+
+// StatsQuery selects the workouts started from From, included, to To,
+// excluded, and the buckets they are grouped in. The days and buckets are
+// those of TimeZone, an IANA time zone, or of UTC if empty.
+type StatsQuery struct {
+	From     time.Time
+	To       time.Time
+	Bucket   string
+	TimeZone string
+}
+
+// TrainingStats sums up the workouts of a user over a window. The volume load
+// of an exercise is the sum of weight × reps over its completed sets other
+// than warm-ups, or sets × reps × weight if it was not logged set by set.
+type TrainingStats struct {
+	From         string             `json:"from"`
+	To           string             `json:"to"`
+	Bucket       string             `json:"bucket"`
+	Totals       StatsTotals        `json:"totals"`
+	Buckets      []StatsBucket      `json:"buckets"`
+	Exercises    []ExerciseStats    `json:"exercises"`
+	MuscleGroups []MuscleGroupStats `json:"muscle_groups"`
+	Frequency    TrainingFrequency  `json:"frequency"`
+}
+
+type StatsTotals struct {
+	Workouts        int     `json:"workouts"`
+	DurationMinutes int     `json:"duration_minutes"`
+	CaloriesBurned  int     `json:"calories_burned"`
+	VolumeLoad      float64 `json:"volume_load"`
+}
+
+// StatsBucket holds the totals of the bucket starting on Start, every bucket
+// of the window included, empty or not.
+type StatsBucket struct {
+	Start string `json:"start"`
+	StatsTotals
+}
+
+// ExerciseStats are the totals of an exercise, the exercises linked to the
+// exercise catalog being told apart by exercise_id and the others by name.
+type ExerciseStats struct {
+	ExerciseID *int    `json:"exercise_id"`
+	Name       string  `json:"name"`
+	Workouts   int     `json:"workouts"`
+	Sets       int     `json:"sets"`
+	Reps       int     `json:"reps"`
+	VolumeLoad float64 `json:"volume_load"`
+}
+
+// MuscleGroupStats are the totals of the exercises that work a muscle group as
+// a primary muscle. Only the exercises linked to the catalog count.
+type MuscleGroupStats struct {
+	MuscleGroup string  `json:"muscle_group"`
+	Sets        int     `json:"sets"`
+	VolumeLoad  float64 `json:"volume_load"`
+}
+
+type TrainingFrequency struct {
+	ActiveDays      int     `json:"active_days"`
+	WorkoutsPerWeek float64 `json:"workouts_per_week"`
+}
+
+type StatsStore interface {
+	// GetTrainingStats and GetExerciseProgress leave out trashed workouts.
+	GetTrainingStats(userID int, query StatsQuery) (*TrainingStats, error)
+	// GetExerciseProgress returns the sessions of the exercise named name, case
+	// insensitively, oldest first, with 1RMs estimated by formula.
+	GetExerciseProgress(userID int, name string, formula string) ([]ProgressPoint, error)
+}
+
+var _ StatsStore = (*PostgresStatsStore)(nil)
+
+type PostgresStatsStore struct {
+	db DBTX
+}
+
+func NewPostgresStatsStore(db DBTX) *PostgresStatsStore {
+	return &PostgresStatsStore{
+		db: db,
+	}
+}
+
+// statsCTEs select the workouts of a stats query, and the sets, reps and
+// volume load of their exercises.
+const statsCTEs = `
+	WITH stats_workouts AS (
+		SELECT id, duration_minutes, calories_burned,
+			date_trunc($4, started_at AT TIME ZONE $5) AS bucket,
+			(started_at AT TIME ZONE $5)::date AS day
+		FROM workouts
+		WHERE user_id = $1 AND deleted_at IS NULL AND started_at >= $2 AND started_at < $3
+	),
+	stats_exercises AS (
+		SELECT we.workout_id, we.exercise_id, we.name,
+			COALESCE(s.sets, we.sets) AS sets,
+			COALESCE(s.reps, we.sets * COALESCE(we.reps, 0)) AS reps,
+			COALESCE(s.volume, we.sets * COALESCE(we.reps, 0) * COALESCE(we.weight, 0)) AS volume
+		FROM workout_exercises we
+		JOIN stats_workouts sw ON sw.id = we.workout_id
+		LEFT JOIN LATERAL (
+			SELECT count(*) FILTER (WHERE performed) AS sets,
+				COALESCE(sum(reps) FILTER (WHERE performed), 0) AS reps,
+				COALESCE(sum(reps * COALESCE(weight, 0)) FILTER (WHERE performed), 0) AS volume
+			FROM (
+				SELECT reps, weight, completed AND set_type <> 'warmup' AS performed
+				FROM workout_sets
+				WHERE workout_exercise_id = we.id
+			) sets
+			HAVING count(*) > 0
+		) s ON true
+	)
+`
+
+func (ss *PostgresStatsStore) GetTrainingStats(userID int, query StatsQuery) (*TrainingStats, error) {
+	args := []any{userID, query.From, query.To, query.Bucket, cmp.Or(query.TimeZone, "UTC")}
+	stats := newTrainingStats(query)
+
+	bucketsQuery := statsCTEs + `
+		SELECT sw.bucket, count(*), COALESCE(sum(sw.duration_minutes), 0), COALESCE(sum(sw.calories_burned), 0),
+			COALESCE(sum(v.volume), 0), count(DISTINCT sw.day)
+		FROM stats_workouts sw
+		LEFT JOIN (
+			SELECT workout_id, sum(volume) AS volume
+			FROM stats_exercises
+			GROUP BY workout_id
+		) v ON v.workout_id = sw.id
+		GROUP BY sw.bucket
+	`
+
+	buckets := make(map[int64]StatsTotals)
+	err := queryRows(ss.db, bucketsQuery, args, func(rows *sql.Rows) error {
+		var start time.Time
+		var totals StatsTotals
+		var activeDays int
+		err := rows.Scan(&start, &totals.Workouts, &totals.DurationMinutes, &totals.CaloriesBurned, &totals.VolumeLoad, &activeDays)
+		buckets[start.Unix()] = totals
+		stats.Frequency.ActiveDays += activeDays
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	exercisesQuery := statsCTEs + `
+		SELECT se.exercise_id, COALESCE(min(e.name), min(se.name COLLATE "C")), count(DISTINCT se.workout_id),
+			sum(se.sets)::integer, sum(se.reps)::integer, sum(se.volume)
+		FROM stats_exercises se
+		LEFT JOIN exercises e ON e.id = se.exercise_id
+		GROUP BY se.exercise_id, CASE WHEN se.exercise_id IS NULL THEN lower(trim(se.name)) END
+	`
+
+	err = queryRows(ss.db, exercisesQuery, args, func(rows *sql.Rows) error {
+		var exercise ExerciseStats
+		err := rows.Scan(&exercise.ExerciseID, &exercise.Name, &exercise.Workouts, &exercise.Sets, &exercise.Reps, &exercise.VolumeLoad)
+		stats.Exercises = append(stats.Exercises, exercise)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	muscleGroupsQuery := statsCTEs + `
+		SELECT m.muscle_group, sum(se.sets)::integer, sum(se.volume)
+		FROM stats_exercises se
+		JOIN exercises e ON e.id = se.exercise_id
+		CROSS JOIN LATERAL unnest(e.primary_muscles) AS m(muscle_group)
+		GROUP BY m.muscle_group
+	`
+
+	err = queryRows(ss.db, muscleGroupsQuery, args, func(rows *sql.Rows) error {
+		var muscleGroup MuscleGroupStats
+		err := rows.Scan(&muscleGroup.MuscleGroup, &muscleGroup.Sets, &muscleGroup.VolumeLoad)
+		stats.MuscleGroups = append(stats.MuscleGroups, muscleGroup)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	finishTrainingStats(stats, query, buckets)
+
+	return stats, nil
+}
+
+func newTrainingStats(query StatsQuery) *TrainingStats {
+	return &TrainingStats{
+		From:         localDay(query.From, query.TimeZone),
+		To:           wallClock(query.To, query.TimeZone).AddDate(0, 0, -1).Format(time.DateOnly),
+		Bucket:       query.Bucket,
+		Buckets:      []StatsBucket{},
+		Exercises:    []ExerciseStats{},
+		MuscleGroups: []MuscleGroupStats{},
+	}
+}
+
+// finishTrainingStats lists every bucket of the window with its totals, adds
+// them up, and orders the exercises and muscle groups by volume load, then
+// sets, then name.
+func finishTrainingStats(stats *TrainingStats, query StatsQuery, buckets map[int64]StatsTotals) {
+	// the buckets are keyed by the time they start at in the zone of the query
+	from, to := wallClock(query.From, query.TimeZone), wallClock(query.To, query.TimeZone)
+	for start := truncateToBucket(from, query.Bucket); start.Before(to); start = nextBucket(start, query.Bucket) {
+		totals := buckets[start.Unix()]
+		totals.VolumeLoad = RoundStat(totals.VolumeLoad)
+		stats.Buckets = append(stats.Buckets, StatsBucket{Start: start.Format(time.DateOnly), StatsTotals: totals})
+
+		stats.Totals.Workouts += totals.Workouts
+		stats.Totals.DurationMinutes += totals.DurationMinutes
+		stats.Totals.CaloriesBurned += totals.CaloriesBurned
+		stats.Totals.VolumeLoad += totals.VolumeLoad
+	}
+	stats.Totals.VolumeLoad = RoundStat(stats.Totals.VolumeLoad)
+
+	if weeks := to.Sub(from).Hours() / (7 * 24); weeks > 0 {
+		stats.Frequency.WorkoutsPerWeek = RoundStat(float64(stats.Totals.Workouts) / weeks)
+	}
+
+	for i := range stats.Exercises {
+		stats.Exercises[i].VolumeLoad = RoundStat(stats.Exercises[i].VolumeLoad)
+	}
+	sort.Slice(stats.Exercises, func(i, j int) bool {
+		a, b := stats.Exercises[i], stats.Exercises[j]
+		if a.VolumeLoad != b.VolumeLoad {
+			return a.VolumeLoad > b.VolumeLoad
+		}
+		if a.Sets != b.Sets {
+			return a.Sets > b.Sets
+		}
+		return strings.ToLower(a.Name) < strings.ToLower(b.Name)
+	})
+
+	for i := range stats.MuscleGroups {
+		stats.MuscleGroups[i].VolumeLoad = RoundStat(stats.MuscleGroups[i].VolumeLoad)
+	}
+	sort.Slice(stats.MuscleGroups, func(i, j int) bool {
+		a, b := stats.MuscleGroups[i], stats.MuscleGroups[j]
+		if a.VolumeLoad != b.VolumeLoad {
+			return a.VolumeLoad > b.VolumeLoad
+		}
+		if a.Sets != b.Sets {
+			return a.Sets > b.Sets
+		}
+		return a.MuscleGroup < b.MuscleGroup
+	})
+}
+
+// truncateToBucket returns the start of the bucket of t, like date_trunc.
+func truncateToBucket(t time.Time, bucket string) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+
+	switch bucket {
+	case StatsBucketWeek:
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	case StatsBucketMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return day
+	}
+}
+
+func nextBucket(start time.Time, bucket string) time.Time {
+	switch bucket {
+	case StatsBucketWeek:
+		return start.AddDate(0, 0, 7)
+	case StatsBucketMonth:
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
+
+// RoundStat rounds a statistic to two decimals.
+func RoundStat(value float64) float64 {
+	return math.Round(value*100) / 100
+}
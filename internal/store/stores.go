@@ -0,0 +1,103 @@
+package store
+
+import (
+	"database/sql"
+)
+
+// Stores bundles every store so they can be wired, and scoped to a
+// transaction through Tx, together.
+type Stores struct {
+	Tx        TxManager
+	Users     UserStore
+	Tokens    TokenStore
+	Workouts  WorkoutStore
+	Exercises ExerciseStore
+	Templates TemplateStore
+
+	Programs    ProgramStore
+	Enrollments EnrollmentStore
+
+	PersonalRecords PersonalRecordStore
+	Stats           StatsStore
+	Measurements    MeasurementStore
+	Goals           GoalStore
+	Streaks         StreakStore
+
+	WorkoutRevisions WorkoutRevisionStore
+	Idempotency      IdempotencyStore
+	Exports          ExportStore
+}
+
+func NewPostgresStores(db *sql.DB) *Stores {
+	stores := newPostgresStores(db)
+	stores.Tx = NewPostgresTxManager(db)
+
+	return stores
+}
+
+func newPostgresTxStores(tx *postgresTx) *Stores {
+	stores := newPostgresStores(tx)
+	stores.Tx = &postgresSavepointManager{tx: tx, stores: stores}
+
+	return stores
+}
+
+func newPostgresStores(db DBTX) *Stores {
+	return &Stores{
+		Users:     NewPostgresUserStore(db),
+		Tokens:    NewPostgresTokenStore(db),
+		Workouts:  NewPostgresWorkoutStore(db),
+		Exercises: NewPostgresExerciseStore(db),
+		Templates: NewPostgresTemplateStore(db),
+
+		Programs:    NewPostgresProgramStore(db),
+		Enrollments: NewPostgresEnrollmentStore(db),
+
+		PersonalRecords: NewPostgresPersonalRecordStore(db),
+		Stats:           NewPostgresStatsStore(db),
+		Measurements:    NewPostgresMeasurementStore(db),
+		Goals:           NewPostgresGoalStore(db),
+		Streaks:         NewPostgresStreakStore(db),
+
+		WorkoutRevisions: NewPostgresWorkoutRevisionStore(db),
+		Idempotency:      NewPostgresIdempotencyStore(db),
+		Exports:          NewPostgresExportStore(db),
+	}
+}
+
+func NewInMemoryStores(db *MemoryDB) *Stores {
+	stores := newInMemoryStores(memoryConn{MemoryDB: db})
+	stores.Tx = NewInMemoryTxManager(db)
+
+	return stores
+}
+
+func newInMemoryTxStores(conn memoryConn) *Stores {
+	stores := newInMemoryStores(conn)
+	stores.Tx = &inMemorySavepointManager{db: conn.MemoryDB, stores: stores}
+
+	return stores
+}
+
+func newInMemoryStores(conn memoryConn) *Stores {
+	return &Stores{
+		Users:     &InMemoryUserStore{db: conn},
+		Tokens:    &InMemoryTokenStore{db: conn},
+		Workouts:  &InMemoryWorkoutStore{db: conn},
+		Exercises: &InMemoryExerciseStore{db: conn},
+		Templates: &InMemoryTemplateStore{db: conn},
+
+		Programs:    &InMemoryProgramStore{db: conn},
+		Enrollments: &InMemoryEnrollmentStore{db: conn},
+
+		PersonalRecords: &InMemoryPersonalRecordStore{db: conn},
+		Stats:           &InMemoryStatsStore{db: conn},
+		Measurements:    &InMemoryMeasurementStore{db: conn},
+		Goals:           &InMemoryGoalStore{db: conn},
+		Streaks:         &InMemoryStreakStore{db: conn},
+
+		WorkoutRevisions: &InMemoryWorkoutRevisionStore{db: conn},
+		Idempotency:      &InMemoryIdempotencyStore{db: conn},
+		Exports:          &InMemoryExportStore{db: conn},
+	}
+}
@@ -0,0 +1,362 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"maps"
+	"math"
+	"slices"
+	"time"
+)
+
+// Streaks are the streaks of a user as of Today, in the TimeZone of the user.
+// A daily streak counts the training days in a row, a day counting as in a row
+// after at most RestDays days off. A weekly streak counts the weeks in a row,
+// from Monday, with at least a workout. A streak is current until a day, or a
+// week, it can no longer be continued on.
+type Streaks struct {
+	TimeZone      string  `json:"time_zone"`
+	RestDays      int     `json:"rest_days"`
+	Today         string  `json:"today"`
+	LastWorkoutOn *string `json:"last_workout_on"`
+	Daily         Streak  `json:"daily"`
+	Weekly        Streak  `json:"weekly"`
+}
+
+type Streak struct {
+	Current int `json:"current"`
+	Longest int `json:"longest"`
+}
+
+// MaxStreakRestDays bounds the rest days a daily streak survives.
+const MaxStreakRestDays = 6
+
+type StreakStore interface {
+	// GetStreaks returns nil if the user does not exist.
+	GetStreaks(userID int) (*Streaks, error)
+}
+
+var _ StreakStore = (*PostgresStreakStore)(nil)
+
+type PostgresStreakStore struct {
+	db DBTX
+}
+
+func NewPostgresStreakStore(db DBTX) *PostgresStreakStore {
+	return &PostgresStreakStore{
+		db: db,
+	}
+}
+
+func (ss *PostgresStreakStore) GetStreaks(userID int) (*Streaks, error) {
+	var streaks *Streaks
+
+	err := runInTx(ss.db, func(tx DBTX) error {
+		timeZone, restDays, err := streakSettings(tx, userID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		runs, ok, err := getStreakRuns(tx, userID)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			runs, err = rebuildStreaks(tx, userID, restDays)
+			if err != nil {
+				return err
+			}
+		}
+
+		streaks = runs.streaks(localDay(time.Now(), timeZone), timeZone, restDays)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return streaks, nil
+}
+
+// streakRuns are the streaks that end on lastDay, the last training day of a
+// user.
+type streakRuns struct {
+	lastDay       string
+	dailyRun      int
+	dailyLongest  int
+	weeklyRun     int
+	weeklyLongest int
+}
+
+// buildStreakRuns builds the runs of days, training days in order.
+func buildStreakRuns(days []string, restDays int) streakRuns {
+	var runs streakRuns
+	for _, day := range days {
+		runs.add(day, restDays)
+	}
+
+	return runs
+}
+
+// add extends the runs with a training day after lastDay.
+func (s *streakRuns) add(day string, restDays int) {
+	if s.lastDay != "" && daysBetween(s.lastDay, day) <= restDays+1 {
+		s.dailyRun++
+	} else {
+		s.dailyRun = 1
+	}
+
+	switch {
+	case s.lastDay != "" && weeksBetween(s.lastDay, day) == 0:
+	case s.lastDay != "" && weeksBetween(s.lastDay, day) == 1:
+		s.weeklyRun++
+	default:
+		s.weeklyRun = 1
+	}
+
+	s.lastDay = day
+	s.dailyLongest = max(s.dailyLongest, s.dailyRun)
+	s.weeklyLongest = max(s.weeklyLongest, s.weeklyRun)
+}
+
+// streaks returns the streaks the runs are as of today.
+func (s streakRuns) streaks(today, timeZone string, restDays int) *Streaks {
+	streaks := &Streaks{
+		TimeZone: timeZone,
+		RestDays: restDays,
+		Today:    today,
+		Daily:    Streak{Longest: s.dailyLongest},
+		Weekly:   Streak{Longest: s.weeklyLongest},
+	}
+	if s.lastDay == "" {
+		return streaks
+	}
+
+	lastDay := s.lastDay
+	streaks.LastWorkoutOn = &lastDay
+	if daysBetween(s.lastDay, today) <= restDays+1 {
+		streaks.Daily.Current = s.dailyRun
+	}
+	if weeksBetween(s.lastDay, today) <= 1 {
+		streaks.Weekly.Current = s.weeklyRun
+	}
+
+	return streaks
+}
+
+// daysBetween returns the days from from to to, two YYYY-MM-DD dates.
+func daysBetween(from, to string) int {
+	fromDate, _ := time.Parse(time.DateOnly, from)
+	toDate, _ := time.Parse(time.DateOnly, to)
+
+	return int(math.Round(toDate.Sub(fromDate).Hours() / 24))
+}
+
+// weeksBetween returns the weeks, from Monday, from the week of from to the
+// week of to.
+func weeksBetween(from, to string) int {
+	monday := func(day string) string {
+		date, _ := time.Parse(time.DateOnly, day)
+		return date.AddDate(0, 0, -(int(date.Weekday())+6)%7).Format(time.DateOnly)
+	}
+
+	return daysBetween(monday(from), monday(to)) / 7
+}
+
+// streakSettings returns the time zone and the rest days of a user.
+func streakSettings(tx DBTX, userID int) (string, int, error) {
+	var timeZone string
+	var restDays int
+	err := tx.QueryRow(`SELECT time_zone, streak_rest_days FROM users WHERE id = $1`, userID).Scan(&timeZone, &restDays)
+
+	return timeZone, restDays, err
+}
+
+// addWorkoutDay counts a workout of a user performed at performedAt in its
+// training day, and extends the streaks of the user if the day is a new one.
+func addWorkoutDay(tx DBTX, userID int, performedAt time.Time) error {
+	return addWorkoutDays(tx, userID, []time.Time{performedAt})
+}
+
+// addWorkoutDays counts several workouts of a user at once, so that the
+// streaks of the user are extended or rebuilt once for all of them.
+func addWorkoutDays(tx DBTX, userID int, performedAt []time.Time) error {
+	timeZone, restDays, err := streakSettings(tx, userID)
+	if err != nil {
+		return err
+	}
+
+	workouts := map[string]int{}
+	for _, at := range performedAt {
+		workouts[localDay(at, timeZone)]++
+	}
+
+	days := slices.Sorted(maps.Keys(workouts))
+	counts := make([]int, len(days))
+	for i, day := range days {
+		counts[i] = workouts[day]
+	}
+
+	query := `
+		INSERT INTO training_days (user_id, day, workouts)
+		SELECT $1, day::date, workouts
+		FROM unnest($2::text[], $3::integer[]) AS days(day, workouts)
+		ON CONFLICT (user_id, day) DO UPDATE SET workouts = training_days.workouts + EXCLUDED.workouts
+		RETURNING day::text, workouts
+	`
+
+	// a day whose count is only the workouts added is a new one
+	var newDays []string
+	err = queryRows(tx, query, []any{userID, days, counts}, func(rows *sql.Rows) error {
+		var day string
+		var count int
+		err := rows.Scan(&day, &count)
+		if count == workouts[day] {
+			newDays = append(newDays, day)
+		}
+		return err
+	})
+	if err != nil || len(newDays) == 0 {
+		return err
+	}
+	slices.Sort(newDays)
+
+	runs, ok, err := getStreakRuns(tx, userID)
+	if err != nil {
+		return err
+	}
+
+	// a day before the last one changes the runs from that day on
+	if !ok || newDays[0] < runs.lastDay {
+		_, err = rebuildStreaks(tx, userID, restDays)
+		return err
+	}
+
+	for _, day := range newDays {
+		runs.add(day, restDays)
+	}
+	return saveStreakRuns(tx, userID, runs)
+}
+
+// removeWorkoutDay is the counterpart of addWorkoutDay, for a workout deleted.
+func removeWorkoutDay(tx DBTX, userID int, performedAt time.Time) error {
+	timeZone, restDays, err := streakSettings(tx, userID)
+	if err != nil {
+		return err
+	}
+
+	day := localDay(performedAt, timeZone)
+	result, err := tx.Exec(`DELETE FROM training_days WHERE user_id = $1 AND day = $2 AND workouts = 1`, userID, day)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		_, err = tx.Exec(`UPDATE training_days SET workouts = workouts - 1 WHERE user_id = $1 AND day = $2`, userID, day)
+		return err
+	}
+
+	// the last workout of the day is gone
+	_, err = rebuildStreaks(tx, userID, restDays)
+	return err
+}
+
+// rebuildTrainingDays counts the workouts of a user in their training days
+// again, for a new time zone, and rebuilds the streaks of the user.
+func rebuildTrainingDays(tx DBTX, userID int) error {
+	timeZone, restDays, err := streakSettings(tx, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM training_days WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	workouts := map[string]int{}
+	query := `SELECT started_at FROM workouts WHERE user_id = $1 AND deleted_at IS NULL`
+	err = queryRows(tx, query, []any{userID}, func(rows *sql.Rows) error {
+		var startedAt time.Time
+		err := rows.Scan(&startedAt)
+		workouts[localDay(startedAt, timeZone)]++
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	dayRows := make([][]any, 0, len(workouts))
+	for day, count := range workouts {
+		dayRows = append(dayRows, []any{userID, day, count})
+	}
+
+	err = insertRows(tx, `INSERT INTO training_days (user_id, day, workouts)`, dayRows, "", nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = rebuildStreaks(tx, userID, restDays)
+	return err
+}
+
+// rebuildStreaks builds the streaks of a user from their training days.
+func rebuildStreaks(tx DBTX, userID, restDays int) (streakRuns, error) {
+	var days []string
+	query := `SELECT day::text FROM training_days WHERE user_id = $1 ORDER BY day`
+	err := queryRows(tx, query, []any{userID}, func(rows *sql.Rows) error {
+		var day string
+		err := rows.Scan(&day)
+		days = append(days, day)
+		return err
+	})
+	if err != nil {
+		return streakRuns{}, err
+	}
+
+	runs := buildStreakRuns(days, restDays)
+	if len(days) == 0 {
+		_, err = tx.Exec(`DELETE FROM streaks WHERE user_id = $1`, userID)
+		return runs, err
+	}
+
+	return runs, saveStreakRuns(tx, userID, runs)
+}
+
+func getStreakRuns(tx DBTX, userID int) (streakRuns, bool, error) {
+	var runs streakRuns
+
+	query := `
+		SELECT last_day::text, daily_run, daily_longest, weekly_run, weekly_longest
+		FROM streaks
+		WHERE user_id = $1
+	`
+
+	err := tx.QueryRow(query, userID).Scan(&runs.lastDay, &runs.dailyRun, &runs.dailyLongest, &runs.weeklyRun, &runs.weeklyLongest)
+	if errors.Is(err, sql.ErrNoRows) {
+		return runs, false, nil
+	}
+
+	return runs, err == nil, err
+}
+
+func saveStreakRuns(tx DBTX, userID int, runs streakRuns) error {
+	query := `
+		INSERT INTO streaks (user_id, last_day, daily_run, daily_longest, weekly_run, weekly_longest)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (user_id) DO UPDATE
+		SET last_day = EXCLUDED.last_day, daily_run = EXCLUDED.daily_run, daily_longest = EXCLUDED.daily_longest,
+			weekly_run = EXCLUDED.weekly_run, weekly_longest = EXCLUDED.weekly_longest, updated_at = CURRENT_TIMESTAMP
+	`
+
+	_, err := tx.Exec(query, userID, runs.lastDay, runs.dailyRun, runs.dailyLongest, runs.weeklyRun, runs.weeklyLongest)
+	return err
+}
@@ -0,0 +1,51 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreakRuns(t *testing.T) {
+	// 2024-01-01 is a Monday
+	days := []string{"2024-01-01", "2024-01-02", "2024-01-04", "2024-01-05", "2024-01-15", "2024-01-22", "2024-01-23"}
+
+	runs := buildStreakRuns(days, 0)
+	assert.Equal(t, streakRuns{lastDay: "2024-01-23", dailyRun: 2, dailyLongest: 2, weeklyRun: 2, weeklyLongest: 2}, runs)
+
+	runs = buildStreakRuns(days, 1)
+	assert.Equal(t, 4, runs.dailyLongest, "a day off in a row is a rest day")
+
+	// days added one by one extend the runs as a rebuild would
+	var added streakRuns
+	for _, day := range days {
+		added.add(day, 1)
+	}
+	assert.Equal(t, runs, added)
+
+	streaks := runs.streaks("2024-01-25", "UTC", 1)
+	assert.Equal(t, "2024-01-23", *streaks.LastWorkoutOn)
+	assert.Equal(t, Streak{Current: 2, Longest: 4}, streaks.Daily)
+	assert.Equal(t, Streak{Current: 2, Longest: 2}, streaks.Weekly)
+
+	streaks = runs.streaks("2024-01-26", "UTC", 1)
+	assert.Equal(t, Streak{Current: 0, Longest: 4}, streaks.Daily, "two days off break the streak")
+	assert.Equal(t, 2, streaks.Weekly.Current, "the week after is still ahead")
+
+	streaks = runs.streaks("2024-02-05", "UTC", 1)
+	assert.Zero(t, streaks.Weekly.Current)
+
+	streaks = streakRuns{}.streaks("2024-01-01", "UTC", 0)
+	assert.Nil(t, streaks.LastWorkoutOn)
+	assert.Equal(t, Streak{}, streaks.Daily)
+}
+
+func TestLocalDay(t *testing.T) {
+	at := time.Date(2024, 1, 1, 23, 30, 0, 0, time.UTC)
+
+	assert.Equal(t, "2024-01-01", localDay(at, "UTC"))
+	assert.Equal(t, "2024-01-02", localDay(at, "Europe/Paris"))
+	assert.Equal(t, "2024-01-01", localDay(at, "America/New_York"))
+	assert.Equal(t, "2024-01-01", localDay(at, "Nowhere/Else"), "unknown zones are UTC")
+}
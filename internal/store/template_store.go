@@ -0,0 +1,236 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// WorkoutTemplate is a routine that workouts can be started from. Its
+// exercises have the structure of the exercises of a workout, without sets.
+type WorkoutTemplate struct {
+	ID              int               `json:"id"`
+	UserID          int               `json:"user_id"`
+	Name            string            `json:"name"`
+	Description     string            `json:"description"`
+	DurationMinutes int               `json:"duration_minutes"`
+	CaloriesBurned  *int              `json:"calories_burned"`
+	Exercises       []WorkoutExercise `json:"exercises"`
+	CreatedAt       time.Time         `json:"created_at"`
+	UpdatedAt       time.Time         `json:"updated_at"`
+}
+
+// ErrTemplateInUse is returned when deleting a template that a program uses.
+var ErrTemplateInUse = errors.New("template used by a program")
+
+type TemplateStore interface {
+	CreateTemplate(template *WorkoutTemplate) error
+	GetTemplate(id int) (*WorkoutTemplate, error)
+	// ListTemplates returns the templates of a user without their exercises, by name.
+	ListTemplates(userID int) ([]WorkoutTemplate, error)
+	// UpdateTemplate replaces the fields and the exercises of a template, which
+	// get new ids.
+	UpdateTemplate(template *WorkoutTemplate) error
+	// DeleteTemplate keeps the workouts started from the template, which lose
+	// their template_id. It returns ErrTemplateInUse if a program uses it.
+	DeleteTemplate(id int) error
+}
+
+var _ TemplateStore = (*PostgresTemplateStore)(nil)
+
+type PostgresTemplateStore struct {
+	db DBTX
+}
+
+func NewPostgresTemplateStore(db DBTX) *PostgresTemplateStore {
+	return &PostgresTemplateStore{
+		db: db,
+	}
+}
+
+func (ts *PostgresTemplateStore) CreateTemplate(template *WorkoutTemplate) error {
+	return runInTx(ts.db, func(tx DBTX) error {
+		query := `
+			INSERT INTO workout_templates (user_id, name, description, duration_minutes, calories_burned)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING id, created_at, updated_at
+		`
+
+		err := tx.QueryRow(query, template.UserID, template.Name, template.Description, template.DurationMinutes, template.CaloriesBurned).
+			Scan(&template.ID, &template.CreatedAt, &template.UpdatedAt)
+		if err != nil {
+			return err
+		}
+
+		return insertTemplateExercises(tx, template, nil)
+	})
+}
+
+const templateColumns = `id, user_id, name, description, duration_minutes, calories_burned, created_at, updated_at`
+
+func scanTemplate(row interface{ Scan(dest ...any) error }, template *WorkoutTemplate) error {
+	return row.Scan(
+		&template.ID,
+		&template.UserID,
+		&template.Name,
+		&template.Description,
+		&template.DurationMinutes,
+		&template.CaloriesBurned,
+		&template.CreatedAt,
+		&template.UpdatedAt,
+	)
+}
+
+func (ts *PostgresTemplateStore) GetTemplate(id int) (*WorkoutTemplate, error) {
+	template := &WorkoutTemplate{}
+
+	query := `SELECT ` + templateColumns + ` FROM workout_templates WHERE id = $1`
+
+	err := scanTemplate(ts.db.QueryRow(query, id), template)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// the exercises of a template have the columns of the exercises of a workout
+	exercisesQuery := `
+		SELECT ` + workoutExerciseColumns + `
+		FROM workout_template_exercises
+		WHERE template_id = $1
+		ORDER BY order_index, id
+	`
+
+	err = queryRows(ts.db, exercisesQuery, []any{id}, func(rows *sql.Rows) error {
+		var exercise WorkoutExercise
+		err := scanWorkoutExercise(rows, &exercise)
+		template.Exercises = append(template.Exercises, exercise)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return template, nil
+}
+
+func (ts *PostgresTemplateStore) ListTemplates(userID int) ([]WorkoutTemplate, error) {
+	query := `
+		SELECT ` + templateColumns + `
+		FROM workout_templates
+		WHERE user_id = $1
+		ORDER BY lower(name) COLLATE "C", id
+	`
+
+	templates := []WorkoutTemplate{}
+	err := queryRows(ts.db, query, []any{userID}, func(rows *sql.Rows) error {
+		var template WorkoutTemplate
+		err := scanTemplate(rows, &template)
+		templates = append(templates, template)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return templates, nil
+}
+
+func (ts *PostgresTemplateStore) UpdateTemplate(template *WorkoutTemplate) error {
+	return runInTx(ts.db, func(tx DBTX) error {
+		query := `
+			UPDATE workout_templates
+			SET name = $1, description = $2, duration_minutes = $3, calories_burned = $4, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $5
+			RETURNING user_id, created_at, updated_at
+		`
+
+		err := tx.QueryRow(query, template.Name, template.Description, template.DurationMinutes, template.CaloriesBurned, template.ID).
+			Scan(&template.UserID, &template.CreatedAt, &template.UpdatedAt)
+		if err != nil {
+			return err
+		}
+
+		// an exercise rewritten with the legacy weight it had at its position
+		// keeps it, see UserStore.ResolveLegacyWeights
+		legacyWeights := make(map[int]float64)
+		query = `DELETE FROM workout_template_exercises WHERE template_id = $1 RETURNING order_index, weight, legacy_weight`
+		err = queryRows(tx, query, []any{template.ID}, func(rows *sql.Rows) error {
+			var orderIndex int
+			var weight *float64
+			var legacy bool
+			err := rows.Scan(&orderIndex, &weight, &legacy)
+			if legacy && weight != nil {
+				legacyWeights[orderIndex] = *weight
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		return insertTemplateExercises(tx, template, legacyWeights)
+	})
+}
+
+func (ts *PostgresTemplateStore) DeleteTemplate(id int) error {
+	query := `DELETE FROM workout_templates WHERE id = $1`
+
+	return templateInUse(execAffectingRow(ts.db, query, id))
+}
+
+// insertTemplateExercises allocates the ids of the exercises up front, like
+// insertWorkoutExercises. The exercises with the weight of legacyWeights at
+// their order index are flagged as legacy weights.
+func insertTemplateExercises(tx DBTX, template *WorkoutTemplate, legacyWeights map[int]float64) error {
+	exerciseIDs, err := nextIDs(tx, "workout_template_exercises", len(template.Exercises))
+	if err != nil {
+		return err
+	}
+
+	exerciseRows := make([][]any, 0, len(template.Exercises))
+	for i := range template.Exercises {
+		exercise := &template.Exercises[i]
+		exercise.ID = exerciseIDs[i]
+		// templates only keep the aggregate fields of their exercises
+		exercise.WorkoutSets = nil
+		legacyWeight, ok := legacyWeights[exercise.OrderIndex]
+		legacy := ok && equalPtr(exercise.Weight, &legacyWeight)
+		exerciseRows = append(exerciseRows, []any{exercise.ID, template.ID, exercise.ExerciseID, exercise.Name, exercise.Sets, exercise.Reps, exercise.DurationSeconds, exercise.Weight, exercise.Notes, exercise.OrderIndex, legacy})
+	}
+
+	insert := `INSERT INTO workout_template_exercises (id, template_id, exercise_id, name, sets, reps, duration_seconds, weight, notes, order_index, legacy_weight)`
+	timestamps := make(map[int][2]time.Time, len(template.Exercises))
+	err = insertRows(tx, insert, exerciseRows, "id, created_at, updated_at", func(rows *sql.Rows) error {
+		var id int
+		var createdAt, updatedAt time.Time
+		err := rows.Scan(&id, &createdAt, &updatedAt)
+		timestamps[id] = [2]time.Time{createdAt, updatedAt}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	for i := range template.Exercises {
+		exercise := &template.Exercises[i]
+		exercise.CreatedAt, exercise.UpdatedAt = timestamps[exercise.ID][0], timestamps[exercise.ID][1]
+	}
+
+	return nil
+}
+
+// templateInUse translates the violation of the foreign key of program_days
+// to a template.
+func templateInUse(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+		return fmt.Errorf("%w: %s", ErrTemplateInUse, pgErr.ConstraintName)
+	}
+
+	return err
+}
@@ -0,0 +1,31 @@
+package store
+
+import (
+	"time"
+	// the time zones of the users are resolved wherever the app runs
+	_ "time/tzdata"
+)
+
+// Location returns the location of timeZone, an IANA time zone, or UTC if the
+// zone is empty or unknown.
+func Location(timeZone string) *time.Location {
+	loc, err := time.LoadLocation(timeZone)
+	if err != nil {
+		return time.UTC
+	}
+
+	return loc
+}
+
+// localDay returns the day of t in timeZone.
+func localDay(t time.Time, timeZone string) string {
+	return t.In(Location(timeZone)).Format(time.DateOnly)
+}
+
+// wallClock returns the time t reads in timeZone, as a UTC time, which is how
+// the timestamps Postgres converts AT TIME ZONE are scanned.
+func wallClock(t time.Time, timeZone string) time.Time {
+	local := t.In(Location(timeZone))
+
+	return time.Date(local.Year(), local.Month(), local.Day(), local.Hour(), local.Minute(), local.Second(), local.Nanosecond(), time.UTC)
+}
@@ -1,8 +1,6 @@
 package store
 
 import (
-	"database/sql"
-
 	"fem-go-crud/internal/auth"
 )
 
@@ -14,10 +12,10 @@ type TokenStore interface {
 var _ TokenStore = (*PostgresTokenStore)(nil)
 
 type PostgresTokenStore struct {
-	db *sql.DB
+	db DBTX
 }
 
-func NewPostgresTokenStore(db *sql.DB) *PostgresTokenStore {
+func NewPostgresTokenStore(db DBTX) *PostgresTokenStore {
 	return &PostgresTokenStore{
 		db: db,
 	}
@@ -0,0 +1,254 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// DBTX is the subset of *sql.DB used by the Postgres stores. It is also
+// implemented by postgresTx, which lets the same stores run inside a transaction.
+type DBTX interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// TxManager runs units of work spanning several stores atomically.
+type TxManager interface {
+	// WithinTx calls fn with stores scoped to a single transaction, which is
+	// committed if fn returns nil and rolled back otherwise. Calling WithinTx
+	// on the TxManager of scoped stores opens a nested savepoint instead.
+	// fn may be retried, so it must not have side effects outside the stores.
+	WithinTx(fn func(stores *Stores) error) error
+	// WithinReadTx calls fn with stores scoped to a read-only transaction that
+	// sees the data as it was when the transaction started, which keeps reads
+	// spanning several queries consistent. fn is not retried. Calling it on
+	// the TxManager of scoped stores runs fn in their transaction.
+	WithinReadTx(fn func(stores *Stores) error) error
+}
+
+const (
+	txMaxAttempts  = 5
+	txRetryBackoff = 10 * time.Millisecond
+)
+
+var _ TxManager = (*PostgresTxManager)(nil)
+
+type PostgresTxManager struct {
+	db *sql.DB
+}
+
+func NewPostgresTxManager(db *sql.DB) *PostgresTxManager {
+	return &PostgresTxManager{
+		db: db,
+	}
+}
+
+// WithinTx runs fn in a serializable transaction, retrying it when Postgres
+// aborts the transaction because of a serialization failure or a deadlock.
+func (tm *PostgresTxManager) WithinTx(fn func(stores *Stores) error) error {
+	var err error
+
+	for attempt := 1; attempt <= txMaxAttempts; attempt++ {
+		err = tm.withinTx(fn)
+		if !isRetryableTxError(err) {
+			return err
+		}
+
+		time.Sleep(time.Duration(attempt) * txRetryBackoff)
+	}
+
+	return fmt.Errorf("transaction failed after %d attempts: %w", txMaxAttempts, err)
+}
+
+func (tm *PostgresTxManager) withinTx(fn func(stores *Stores) error) error {
+	tx, err := tm.db.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return err
+	}
+
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	err = fn(newPostgresTxStores(&postgresTx{tx: tx}))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// WithinReadTx runs fn in a read-only repeatable read transaction, which
+// Postgres never aborts for a serialization failure.
+func (tm *PostgresTxManager) WithinReadTx(fn func(stores *Stores) error) error {
+	tx, err := tm.db.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return err
+	}
+
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	err = fn(newPostgresTxStores(&postgresTx{tx: tx}))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func isRetryableTxError(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+
+	// serialization_failure, deadlock_detected
+	return pgErr.Code == "40001" || pgErr.Code == "40P01"
+}
+
+// postgresTx wraps a transaction shared by transaction-scoped stores and keeps
+// track of the savepoints opened on it.
+type postgresTx struct {
+	tx         *sql.Tx
+	savepoints int
+}
+
+func (t *postgresTx) Exec(query string, args ...any) (sql.Result, error) {
+	return t.tx.Exec(query, args...)
+}
+
+func (t *postgresTx) Query(query string, args ...any) (*sql.Rows, error) {
+	return t.tx.Query(query, args...)
+}
+
+func (t *postgresTx) QueryRow(query string, args ...any) *sql.Row {
+	return t.tx.QueryRow(query, args...)
+}
+
+func (t *postgresTx) withinSavepoint(fn func() error) error {
+	t.savepoints++
+	defer func() {
+		t.savepoints--
+	}()
+
+	name := fmt.Sprintf("sp_%d", t.savepoints)
+
+	_, err := t.tx.Exec("SAVEPOINT " + name)
+	if err != nil {
+		return err
+	}
+
+	err = fn()
+	if err != nil {
+		_, rollbackErr := t.tx.Exec("ROLLBACK TO SAVEPOINT " + name)
+		return errors.Join(err, rollbackErr)
+	}
+
+	_, err = t.tx.Exec("RELEASE SAVEPOINT " + name)
+
+	return err
+}
+
+// postgresSavepointManager is the TxManager of transaction-scoped stores.
+type postgresSavepointManager struct {
+	tx     *postgresTx
+	stores *Stores
+}
+
+func (sm *postgresSavepointManager) WithinTx(fn func(stores *Stores) error) error {
+	return sm.tx.withinSavepoint(func() error {
+		return fn(sm.stores)
+	})
+}
+
+func (sm *postgresSavepointManager) WithinReadTx(fn func(stores *Stores) error) error {
+	return fn(sm.stores)
+}
+
+// runInTx lets a store method that issues several statements run them
+// atomically, whether or not the store is already transaction-scoped.
+func runInTx(db DBTX, fn func(db DBTX) error) error {
+	switch db := db.(type) {
+	case *sql.DB:
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+
+		defer func(tx *sql.Tx) {
+			_ = tx.Rollback()
+		}(tx)
+
+		err = fn(&postgresTx{tx: tx})
+		if err != nil {
+			return err
+		}
+
+		return tx.Commit()
+	case *postgresTx:
+		return db.withinSavepoint(func() error {
+			return fn(db)
+		})
+	default:
+		return fn(db)
+	}
+}
+
+var _ TxManager = (*InMemoryTxManager)(nil)
+
+type InMemoryTxManager struct {
+	db *MemoryDB
+}
+
+func NewInMemoryTxManager(db *MemoryDB) *InMemoryTxManager {
+	return &InMemoryTxManager{
+		db: db,
+	}
+}
+
+// WithinTx holds the database write lock for the whole unit of work, which
+// makes in-memory transactions serializable by construction.
+func (tm *InMemoryTxManager) WithinTx(fn func(stores *Stores) error) error {
+	tm.db.mu.Lock()
+	defer tm.db.mu.Unlock()
+
+	stores := newInMemoryTxStores(memoryConn{MemoryDB: tm.db, inTx: true})
+
+	return tm.db.savepoint(func() error {
+		return fn(stores)
+	})
+}
+
+// WithinReadTx runs fn on a snapshot of the tables, so that it holds no lock
+// while it reads and writes to the snapshot are lost.
+func (tm *InMemoryTxManager) WithinReadTx(fn func(stores *Stores) error) error {
+	tm.db.mu.RLock()
+	snapshot := &MemoryDB{memoryTables: tm.db.memoryTables.clone()}
+	tm.db.mu.RUnlock()
+
+	return fn(newInMemoryTxStores(memoryConn{MemoryDB: snapshot, inTx: true}))
+}
+
+// inMemorySavepointManager is the TxManager of transaction-scoped in-memory stores.
+type inMemorySavepointManager struct {
+	db     *MemoryDB
+	stores *Stores
+}
+
+func (sm *inMemorySavepointManager) WithinTx(fn func(stores *Stores) error) error {
+	return sm.db.savepoint(func() error {
+		return fn(sm.stores)
+	})
+}
+
+func (sm *inMemorySavepointManager) WithinReadTx(fn func(stores *Stores) error) error {
+	return fn(sm.stores)
+}
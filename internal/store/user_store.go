@@ -2,22 +2,47 @@ package store
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
+	"slices"
 	"time"
 
 	"fem-go-crud/internal/auth"
 )
 
+// User is an account. BodyWeightKg is part of the profile of the user, which
+// calories are estimated from, and UnitSystem the units they read weights in.
+// TimeZone, an IANA time zone, tells the days the user trained on, and
+// StreakRestDays the days off their daily streaks survive.
+// LegacyWeightsBefore is set while the weights the user recorded before
+// weights had units are not resolved, see ResolveLegacyWeights.
 type User struct {
-	ID        int           `json:"id"`
-	Username  string        `json:"username"`
-	Email     string        `json:"email"`
-	Password  auth.Password `json:"-"`
-	CreatedAt string        `json:"created_at"`
-	UpdatedAt string        `json:"updated_at"`
+	ID                  int           `json:"id"`
+	Username            string        `json:"username"`
+	Email               string        `json:"email"`
+	Password            auth.Password `json:"-"`
+	BodyWeightKg        *float64      `json:"body_weight_kg,omitempty"`
+	UnitSystem          string        `json:"unit_system"`
+	LegacyWeightsBefore *time.Time    `json:"legacy_weights_before,omitempty"`
+	TimeZone            string        `json:"time_zone,omitempty"`
+	StreakRestDays      int           `json:"streak_rest_days"`
+	CreatedAt           time.Time     `json:"created_at"`
+	UpdatedAt           time.Time     `json:"updated_at"`
 }
 
+const (
+	UnitSystemMetric   = "metric"
+	UnitSystemImperial = "imperial"
+)
+
+var UnitSystems = []string{UnitSystemMetric, UnitSystemImperial}
+
+// ErrNoLegacyWeights is returned when resolving the legacy weights of a user
+// who has none left.
+var ErrNoLegacyWeights = errors.New("no legacy weights")
+
 var AnonymousUser = &User{}
 
 func (u *User) IsAnonymous() bool {
@@ -29,16 +54,25 @@ type UserStore interface {
 	PersistUser(user *User) error
 	GetUserByIdOrUsername(id int, username string) (*User, error)
 	UpdateUser(user *User) error
+	UpdatePassword(user *User) error
+	DeleteUser(id int) error
 	GetUserFromToken(token, scope string) (*User, error)
+	// ResolveLegacyWeights multiplies the weights that a user recorded before
+	// weights had units by kgPerUnit, the kilograms in the unit they were
+	// recorded in, and clears LegacyWeightsBefore. Only the workout and
+	// template exercises flagged as still holding such weights are converted,
+	// along with the revisions that hold them, and the personal records are
+	// recomputed. The workouts converted get a new version.
+	ResolveLegacyWeights(userID int, kgPerUnit float64) error
 }
 
 var _ UserStore = (*PostgresUserStore)(nil)
 
 type PostgresUserStore struct {
-	db *sql.DB
+	db DBTX
 }
 
-func NewPostgresUserStore(db *sql.DB) *PostgresUserStore {
+func NewPostgresUserStore(db DBTX) *PostgresUserStore {
 	return &PostgresUserStore{
 		db: db,
 	}
@@ -46,13 +80,16 @@ func NewPostgresUserStore(db *sql.DB) *PostgresUserStore {
 
 func (us *PostgresUserStore) PersistUser(user *User) error {
 	query := `
-		INSERT INTO users (username, email, password_hash)
-		VALUES ($1, $2, $3)
-		RETURNING id, created_at, updated_at
+		INSERT INTO users (username, email, password_hash, body_weight_kg, unit_system, time_zone, streak_rest_days)
+		VALUES ($1, $2, $3, $4, COALESCE(NULLIF($5, ''), 'metric'), COALESCE(NULLIF($6, ''), 'UTC'), $7)
+		RETURNING id, unit_system, time_zone, created_at, updated_at
 	`
 
-	err := us.db.QueryRow(query, user.Username, user.Email, user.Password.Hash).Scan(
+	err := us.db.QueryRow(query, user.Username, user.Email, user.Password.Hash, user.BodyWeightKg, user.UnitSystem,
+		user.TimeZone, user.StreakRestDays).Scan(
 		&user.ID,
+		&user.UnitSystem,
+		&user.TimeZone,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -82,7 +119,8 @@ func (us *PostgresUserStore) GetUserByIdOrUsername(id int, username string) (*Us
 	}
 
 	query := `
-		SELECT id, username, email, password_hash, created_at, updated_at
+		SELECT id, username, email, password_hash, body_weight_kg, unit_system, legacy_weights_before, time_zone, streak_rest_days,
+			created_at, updated_at
 		FROM users
 		WHERE %s = $1
 	`
@@ -92,6 +130,11 @@ func (us *PostgresUserStore) GetUserByIdOrUsername(id int, username string) (*Us
 		&user.Username,
 		&user.Email,
 		&user.Password.Hash,
+		&user.BodyWeightKg,
+		&user.UnitSystem,
+		&user.LegacyWeightsBefore,
+		&user.TimeZone,
+		&user.StreakRestDays,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -108,12 +151,71 @@ func (us *PostgresUserStore) GetUserByIdOrUsername(id int, username string) (*Us
 func (us *PostgresUserStore) UpdateUser(user *User) error {
 	query := `
 		UPDATE users
-		SET username = $1, email = $2, updated_at = CURRENT_TIMESTAMP
-		WHERE id = $4
-		RETURNING updated_at
+		SET username = $1, email = $2, body_weight_kg = $3, unit_system = $4, time_zone = $5, streak_rest_days = $6,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $7
 	`
 
-	result, err := us.db.Exec(query, user.Username, user.Email, user.ID)
+	return runInTx(us.db, func(tx DBTX) error {
+		timeZone, restDays, err := streakSettings(tx, user.ID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return sql.ErrNoRows
+		}
+		if err != nil {
+			return err
+		}
+
+		err = execAffectingRow(tx, query, user.Username, user.Email, user.BodyWeightKg, user.UnitSystem,
+			user.TimeZone, user.StreakRestDays, user.ID)
+		if err != nil {
+			return err
+		}
+
+		// goals of body weight are measured from the profile without measurements
+		err = refreshGoals(tx, user.ID)
+		if err != nil {
+			return err
+		}
+
+		if timeZone != user.TimeZone {
+			return rebuildTrainingDays(tx, user.ID)
+		}
+		if restDays != user.StreakRestDays {
+			_, err = rebuildStreaks(tx, user.ID, user.StreakRestDays)
+		}
+
+		return err
+	})
+}
+
+func (us *PostgresUserStore) UpdatePassword(user *User) error {
+	query := `
+		UPDATE users
+		SET password_hash = $1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2
+	`
+
+	result, err := us.db.Exec(query, user.Password.Hash, user.ID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (us *PostgresUserStore) DeleteUser(id int) error {
+	query := `DELETE FROM users WHERE id = $1`
+
+	result, err := us.db.Exec(query, id)
 	if err != nil {
 		return err
 	}
@@ -132,7 +234,8 @@ func (us *PostgresUserStore) UpdateUser(user *User) error {
 
 func (us *PostgresUserStore) GetUserFromToken(plainToken, scope string) (*User, error) {
 	query := `
-		SELECT u.id, u.username, u.email, u.created_at, u.updated_at
+		SELECT u.id, u.username, u.email, u.body_weight_kg, u.unit_system, u.legacy_weights_before, u.time_zone, u.streak_rest_days,
+			u.created_at, u.updated_at
 		FROM users u
 		INNER JOIN tokens t ON u.id = t.user_id
 		WHERE t.hash = $1 AND t.scope = $2 AND t.expires_at > $3
@@ -148,6 +251,11 @@ func (us *PostgresUserStore) GetUserFromToken(plainToken, scope string) (*User,
 		&user.ID,
 		&user.Username,
 		&user.Email,
+		&user.BodyWeightKg,
+		&user.UnitSystem,
+		&user.LegacyWeightsBefore,
+		&user.TimeZone,
+		&user.StreakRestDays,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -160,3 +268,245 @@ func (us *PostgresUserStore) GetUserFromToken(plainToken, scope string) (*User,
 
 	return user, nil
 }
+
+func (us *PostgresUserStore) ResolveLegacyWeights(userID int, kgPerUnit float64) error {
+	return runInTx(us.db, func(tx DBTX) error {
+		var before *time.Time
+		err := tx.QueryRow(`SELECT legacy_weights_before FROM users WHERE id = $1 FOR UPDATE`, userID).Scan(&before)
+		if err != nil {
+			return err
+		}
+		if before == nil {
+			return ErrNoLegacyWeights
+		}
+
+		queries := []string{
+			`UPDATE workouts w
+			SET version = version + 1
+			WHERE w.user_id = $1 AND EXISTS (SELECT 1 FROM workout_exercises we WHERE we.workout_id = w.id AND we.legacy_weight)`,
+			`UPDATE workout_sets ws
+			SET weight = ROUND(ws.weight * $2, 3)
+			FROM workout_exercises we
+			JOIN workouts w ON w.id = we.workout_id
+			WHERE we.id = ws.workout_exercise_id AND w.user_id = $1 AND we.legacy_weight AND ws.weight IS NOT NULL`,
+			`UPDATE workout_exercises we
+			SET weight = ROUND(we.weight * $2, 3), legacy_weight = FALSE
+			FROM workouts w
+			WHERE w.id = we.workout_id AND w.user_id = $1 AND we.legacy_weight`,
+			`UPDATE workout_template_exercises te
+			SET weight = ROUND(te.weight * $2, 3), legacy_weight = FALSE
+			FROM workout_templates t
+			WHERE t.id = te.template_id AND t.user_id = $1 AND te.legacy_weight`,
+		}
+		for _, query := range queries {
+			_, err = tx.Exec(query, userID, kgPerUnit)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = resolveLegacyRevisions(tx, userID, kgPerUnit)
+		if err != nil {
+			return err
+		}
+
+		// the records follow from the converted weights
+		err = refreshPersonalRecords(tx, userID, time.Time{})
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`UPDATE users SET legacy_weights_before = NULL WHERE id = $1`, userID)
+		return err
+	})
+}
+
+// resolveLegacyRevisions converts the legacy weights of the snapshots of the
+// workouts of a user, so that restoring them brings back converted weights.
+func resolveLegacyRevisions(tx DBTX, userID int, kgPerUnit float64) error {
+	legacyExerciseIDs := make(map[[2]int][]int)
+	query := `SELECT workout_id, revision, unnest(legacy_exercise_ids) FROM workout_revisions WHERE user_id = $1`
+	err := queryRows(tx, query, []any{userID}, func(rows *sql.Rows) error {
+		var key [2]int
+		var exerciseID int
+		err := rows.Scan(&key[0], &key[1], &exerciseID)
+		legacyExerciseIDs[key] = append(legacyExerciseIDs[key], exerciseID)
+		return err
+	})
+	if err != nil || len(legacyExerciseIDs) == 0 {
+		return err
+	}
+
+	workoutIDs := make([]int, 0, len(legacyExerciseIDs))
+	for key := range legacyExerciseIDs {
+		workoutIDs = append(workoutIDs, key[0])
+	}
+
+	// the diffs of the whole history of the workouts follow from the snapshots
+	query = `
+		SELECT workout_id, revision, action, snapshot
+		FROM workout_revisions
+		WHERE workout_id = ANY($1)
+		ORDER BY workout_id, revision
+	`
+
+	revisions := make(map[int][]*WorkoutRevision)
+	err = queryRows(tx, query, []any{workoutIDs}, func(rows *sql.Rows) error {
+		revision := &WorkoutRevision{}
+		var snapshot []byte
+		err := rows.Scan(&revision.WorkoutID, &revision.Revision, &revision.Action, &snapshot)
+		revision.Snapshot = snapshot
+		revision.legacyExerciseIDs = legacyExerciseIDs[[2]int{revision.WorkoutID, revision.Revision}]
+		revisions[revision.WorkoutID] = append(revisions[revision.WorkoutID], revision)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, workoutRevisions := range revisions {
+		err = convertRevisionWeights(workoutRevisions, kgPerUnit)
+		if err != nil {
+			return err
+		}
+
+		for _, revision := range workoutRevisions {
+			var diff []byte
+			if revision.Diff != nil {
+				diff = revision.Diff
+			}
+
+			_, err = tx.Exec(`
+				UPDATE workout_revisions
+				SET snapshot = $1, diff = $2, legacy_exercise_ids = '{}'
+				WHERE workout_id = $3 AND revision = $4
+			`, []byte(revision.Snapshot), diff, revision.WorkoutID, revision.Revision)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// convertRevisionWeights converts the legacy weights of the snapshots of the
+// revisions of a workout, in order, and diffs them anew.
+func convertRevisionWeights(revisions []*WorkoutRevision, kgPerUnit float64) error {
+	latest := make(map[int]*WorkoutRevision, 1)
+	for _, revision := range revisions {
+		snapshot, err := convertSnapshotWeights(revision.Snapshot, revision.legacyExerciseIDs, kgPerUnit)
+		if err != nil {
+			return err
+		}
+
+		revision.Snapshot = snapshot
+		revision.legacyExerciseIDs = nil
+
+		err = nextWorkoutRevision(revision, latest)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// convertSnapshotWeights multiplies by kgPerUnit the weights of the exercises
+// of a workout snapshot whose id is in exerciseIDs, and of their sets. The
+// rest of the snapshot is left as it is.
+func convertSnapshotWeights(snapshot json.RawMessage, exerciseIDs []int, kgPerUnit float64) (json.RawMessage, error) {
+	var workout map[string]json.RawMessage
+	err := json.Unmarshal(snapshot, &workout)
+	if err != nil || len(exerciseIDs) == 0 || workout["exercises"] == nil {
+		return snapshot, err
+	}
+
+	var exercises []map[string]json.RawMessage
+	err = json.Unmarshal(workout["exercises"], &exercises)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, exercise := range exercises {
+		var id int
+		err = json.Unmarshal(exercise["id"], &id)
+		if err != nil {
+			return nil, err
+		}
+		if !slices.Contains(exerciseIDs, id) {
+			continue
+		}
+
+		exercise["weight"], err = convertJSONWeight(exercise["weight"], kgPerUnit)
+		if err != nil {
+			return nil, err
+		}
+
+		if exercise["workout_sets"] == nil {
+			continue
+		}
+
+		var sets []map[string]json.RawMessage
+		err = json.Unmarshal(exercise["workout_sets"], &sets)
+		if err != nil {
+			return nil, err
+		}
+		for _, set := range sets {
+			set["weight"], err = convertJSONWeight(set["weight"], kgPerUnit)
+			if err != nil {
+				return nil, err
+			}
+		}
+		exercise["workout_sets"], err = json.Marshal(sets)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	workout["exercises"], err = json.Marshal(exercises)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(workout)
+}
+
+func convertJSONWeight(weight json.RawMessage, kgPerUnit float64) (json.RawMessage, error) {
+	var value *float64
+	if weight != nil {
+		err := json.Unmarshal(weight, &value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return json.Marshal(convertWeight(value, kgPerUnit))
+}
+
+// convertWeight converts a weight to kilograms, with the precision of the
+// weight columns.
+func convertWeight(weight *float64, kgPerUnit float64) *float64 {
+	if weight == nil {
+		return nil
+	}
+
+	converted := math.Round(*weight*kgPerUnit*1000) / 1000
+	return &converted
+}
+
+// sameWeights tells whether two versions of an exercise have the same weights,
+// its own and those of its sets, which keeps legacy weights legacy.
+func sameWeights(a, b WorkoutExercise) bool {
+	if !equalPtr(a.Weight, b.Weight) || len(a.WorkoutSets) != len(b.WorkoutSets) {
+		return false
+	}
+
+	for i := range a.WorkoutSets {
+		if !equalPtr(a.WorkoutSets[i].Weight, b.WorkoutSets[i].Weight) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,245 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"fem-go-crud/internal/jsonpatch"
+)
+
+const (
+	WorkoutRevisionCreate  = "create"
+	WorkoutRevisionUpdate  = "update"
+	WorkoutRevisionDelete  = "delete"
+	WorkoutRevisionRestore = "restore"
+)
+
+// WorkoutRevision is an immutable snapshot of a workout, recorded on every
+// change. Diff is the JSON patch from the previous snapshot, and is null for
+// the first revision and for deletions. The stores keep the ids of the
+// exercises of the snapshot that hold legacy weights, see
+// UserStore.ResolveLegacyWeights.
+type WorkoutRevision struct {
+	WorkoutID int             `json:"workout_id"`
+	Revision  int             `json:"revision"`
+	UserID    int             `json:"user_id"`
+	ActorID   int             `json:"actor_id"`
+	Action    string          `json:"action"`
+	Snapshot  json.RawMessage `json:"snapshot,omitempty"`
+	Diff      json.RawMessage `json:"diff"`
+	CreatedAt time.Time       `json:"created_at"`
+
+	legacyExerciseIDs []int
+}
+
+type WorkoutRevisionStore interface {
+	// CreateWorkoutRevision records revision as the next revision of its
+	// workout, filling in Revision, Diff and CreatedAt.
+	CreateWorkoutRevision(revision *WorkoutRevision) error
+	// CreateWorkoutRevisions records several revisions at once, in order.
+	CreateWorkoutRevisions(revisions []*WorkoutRevision) error
+	// ListWorkoutRevisions returns the revisions of a workout, oldest first and
+	// without their snapshots.
+	ListWorkoutRevisions(workoutID int) ([]WorkoutRevision, error)
+	GetWorkoutRevision(workoutID, revision int) (*WorkoutRevision, error)
+}
+
+var _ WorkoutRevisionStore = (*PostgresWorkoutRevisionStore)(nil)
+
+type PostgresWorkoutRevisionStore struct {
+	db DBTX
+}
+
+func NewPostgresWorkoutRevisionStore(db DBTX) *PostgresWorkoutRevisionStore {
+	return &PostgresWorkoutRevisionStore{
+		db: db,
+	}
+}
+
+func (rs *PostgresWorkoutRevisionStore) CreateWorkoutRevision(revision *WorkoutRevision) error {
+	return rs.CreateWorkoutRevisions([]*WorkoutRevision{revision})
+}
+
+func (rs *PostgresWorkoutRevisionStore) CreateWorkoutRevisions(revisions []*WorkoutRevision) error {
+	if len(revisions) == 0 {
+		return nil
+	}
+
+	return runInTx(rs.db, func(tx DBTX) error {
+		workoutIDs := make([]int, 0, len(revisions))
+		for _, revision := range revisions {
+			workoutIDs = append(workoutIDs, revision.WorkoutID)
+		}
+
+		query := `
+			SELECT DISTINCT ON (workout_id) workout_id, revision, snapshot
+			FROM workout_revisions
+			WHERE workout_id = ANY($1)
+			ORDER BY workout_id, revision DESC
+		`
+
+		latest := make(map[int]*WorkoutRevision, len(revisions))
+		err := queryRows(tx, query, []any{workoutIDs}, func(rows *sql.Rows) error {
+			revision := &WorkoutRevision{}
+			var snapshot []byte
+
+			err := rows.Scan(&revision.WorkoutID, &revision.Revision, &snapshot)
+			revision.Snapshot = snapshot
+			latest[revision.WorkoutID] = revision
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		// the snapshots are taken from the stored workouts, so they hold the
+		// legacy weights that the workouts hold
+		legacyExerciseIDs := make(map[int][]int)
+		query = `SELECT workout_id, id FROM workout_exercises WHERE workout_id = ANY($1) AND legacy_weight ORDER BY id`
+		err = queryRows(tx, query, []any{workoutIDs}, func(rows *sql.Rows) error {
+			var workoutID, exerciseID int
+			err := rows.Scan(&workoutID, &exerciseID)
+			legacyExerciseIDs[workoutID] = append(legacyExerciseIDs[workoutID], exerciseID)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		revisionRows := make([][]any, 0, len(revisions))
+		for _, revision := range revisions {
+			err = nextWorkoutRevision(revision, latest)
+			if err != nil {
+				return err
+			}
+
+			var diff []byte
+			if revision.Diff != nil {
+				diff = revision.Diff
+			}
+
+			revisionRows = append(revisionRows, []any{revision.WorkoutID, revision.Revision, revision.UserID, revision.ActorID, revision.Action, []byte(revision.Snapshot), diff, append([]int{}, legacyExerciseIDs[revision.WorkoutID]...)})
+		}
+
+		insert := `INSERT INTO workout_revisions (workout_id, revision, user_id, actor_id, action, snapshot, diff, legacy_exercise_ids)`
+		createdAt := make(map[[2]int]time.Time, len(revisions))
+		err = insertRows(tx, insert, revisionRows, "workout_id, revision, created_at", func(rows *sql.Rows) error {
+			var key [2]int
+			var timestamp time.Time
+			err := rows.Scan(&key[0], &key[1], &timestamp)
+			createdAt[key] = timestamp
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, revision := range revisions {
+			revision.CreatedAt = createdAt[[2]int{revision.WorkoutID, revision.Revision}]
+		}
+
+		return nil
+	})
+}
+
+func (rs *PostgresWorkoutRevisionStore) ListWorkoutRevisions(workoutID int) ([]WorkoutRevision, error) {
+	query := `
+		SELECT workout_id, revision, user_id, actor_id, action, diff, created_at
+		FROM workout_revisions
+		WHERE workout_id = $1
+		ORDER BY revision
+	`
+
+	rows, err := rs.db.Query(query, workoutID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	revisions := []WorkoutRevision{}
+	for rows.Next() {
+		var revision WorkoutRevision
+		var diff []byte
+
+		err = rows.Scan(
+			&revision.WorkoutID,
+			&revision.Revision,
+			&revision.UserID,
+			&revision.ActorID,
+			&revision.Action,
+			&diff,
+			&revision.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		revision.Diff = diff
+		revisions = append(revisions, revision)
+	}
+
+	return revisions, rows.Err()
+}
+
+func (rs *PostgresWorkoutRevisionStore) GetWorkoutRevision(workoutID, revisionNumber int) (*WorkoutRevision, error) {
+	query := `
+		SELECT workout_id, revision, user_id, actor_id, action, snapshot, diff, created_at
+		FROM workout_revisions
+		WHERE workout_id = $1 AND revision = $2
+	`
+
+	revision := &WorkoutRevision{}
+	var snapshot, diff []byte
+
+	err := rs.db.QueryRow(query, workoutID, revisionNumber).Scan(
+		&revision.WorkoutID,
+		&revision.Revision,
+		&revision.UserID,
+		&revision.ActorID,
+		&revision.Action,
+		&snapshot,
+		&diff,
+		&revision.CreatedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	revision.Snapshot = snapshot
+	revision.Diff = diff
+
+	return revision, nil
+}
+
+// nextWorkoutRevision numbers revision after the latest revision of its workout
+// and diffs it from that revision's snapshot, then makes it the latest.
+func nextWorkoutRevision(revision *WorkoutRevision, latest map[int]*WorkoutRevision) error {
+	revision.Revision = 1
+	revision.Diff = nil
+
+	previous, ok := latest[revision.WorkoutID]
+	if ok {
+		revision.Revision = previous.Revision + 1
+
+		// deletions have no diff
+		if revision.Action != WorkoutRevisionDelete {
+			diff, err := jsonpatch.Diff(previous.Snapshot, revision.Snapshot)
+			if err != nil {
+				return err
+			}
+			revision.Diff = diff
+		}
+	}
+
+	latest[revision.WorkoutID] = revision
+
+	return nil
+}
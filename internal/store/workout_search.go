@@ -0,0 +1,89 @@
+package store
+
+import (
+	"database/sql"
+	"strings"
+	"unicode"
+)
+
+// Search snippets mark the matching words like this.
+const (
+	SearchMatchStart = "<mark>"
+	SearchMatchEnd   = "</mark>"
+)
+
+// searchSnippetEscaper escapes the text of search snippets, so that the marks
+// are their only HTML.
+var searchSnippetEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// WorkoutSearchResult is a workout, without its exercises, that matches a
+// search. Snippet is an excerpt of the workout, escaped as HTML, with the
+// matching words marked.
+type WorkoutSearchResult struct {
+	Workout Workout `json:"workout"`
+	Rank    float64 `json:"rank"`
+	Snippet string  `json:"snippet"`
+}
+
+// searchTerms splits a search query into lowercased words, leaving out
+// punctuation and operators.
+func searchTerms(query string) []string {
+	return strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// prefixTSQuery builds a tsquery that matches the documents containing words
+// that start with every term.
+func prefixTSQuery(terms []string) string {
+	lexemes := make([]string, len(terms))
+	for i, term := range terms {
+		lexemes[i] = "'" + term + "':*"
+	}
+
+	return strings.Join(lexemes, " & ")
+}
+
+func (ws *PostgresWorkoutStore) SearchWorkouts(userID int, query string, limit, offset int) ([]WorkoutSearchResult, error) {
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return []WorkoutSearchResult{}, nil
+	}
+
+	// the snippets are only built for the page of results, from the text
+	// escaped as searchSnippetEscaper does
+	sqlQuery := `
+		SELECT ` + workoutColumns + `, rank,
+			ts_headline('english',
+				replace(replace(replace(concat_ws(' ', name, description, (
+					SELECT string_agg(concat_ws(' ', we.name, we.notes), ' ' ORDER BY we.order_index)
+					FROM workout_exercises we
+					WHERE we.workout_id = matches.id
+				)), '&', '&amp;'), '<', '&lt;'), '>', '&gt;'),
+				to_tsquery('english', $2),
+				'StartSel=` + SearchMatchStart + `, StopSel=` + SearchMatchEnd + `, MaxFragments=2, FragmentDelimiter=" ... "')
+		FROM (
+			SELECT ` + workoutColumns + `, ts_rank(search_vector, to_tsquery('english', $2)) AS rank
+			FROM workouts
+			WHERE user_id = $1 AND deleted_at IS NULL AND search_vector @@ to_tsquery('english', $2)
+			ORDER BY rank DESC, id DESC
+			LIMIT $3 OFFSET $4
+		) AS matches
+		ORDER BY rank DESC, id DESC
+	`
+
+	results := []WorkoutSearchResult{}
+	err := queryRows(ws.db, sqlQuery, []any{userID, prefixTSQuery(terms), limit, offset}, func(rows *sql.Rows) error {
+		var result WorkoutSearchResult
+		workout := &result.Workout
+		err := rows.Scan(&workout.ID, &workout.UserID, &workout.TemplateID, &workout.Name, &workout.Description, &workout.DurationMinutes,
+			&workout.CaloriesBurned, &workout.CaloriesEstimated, &workout.Version, &workout.StartedAt, &workout.EndedAt, &workout.CreatedAt, &workout.DeletedAt, &result.Rank, &result.Snippet)
+		results = append(results, result)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
@@ -0,0 +1,154 @@
+package store
+
+import (
+	"database/sql"
+)
+
+// WorkoutSet is a set of a workout exercise as performed. SetNumber is its
+// 1-based position in the exercise, which the stores assign.
+type WorkoutSet struct {
+	SetNumber       int      `json:"set_number"`
+	SetType         string   `json:"set_type"`
+	Reps            *int     `json:"reps"`
+	Weight          *float64 `json:"weight"`
+	DurationSeconds *int     `json:"duration_seconds"`
+	DistanceMeters  *float64 `json:"distance_meters"`
+	RPE             *float64 `json:"rpe"`
+	RIR             *int     `json:"rir"`
+	RestSeconds     *int     `json:"rest_seconds"`
+	Completed       bool     `json:"completed"`
+}
+
+const (
+	WorkoutSetWarmup  = "warmup"
+	WorkoutSetWorking = "working"
+	WorkoutSetDrop    = "drop"
+	WorkoutSetFailure = "failure"
+)
+
+var WorkoutSetTypes = []string{WorkoutSetWarmup, WorkoutSetWorking, WorkoutSetDrop, WorkoutSetFailure}
+
+// DeriveFromSets sets the aggregate fields of an exercise logged set by set,
+// which clients that predate sets still read: Sets counts the sets other than
+// warm-ups (or the warm-ups, if that is all there is), and Reps,
+// DurationSeconds and Weight are those of the top set among them, the
+// heaviest, then the one with the most reps or the longest.
+func (exercise *WorkoutExercise) DeriveFromSets() {
+	if len(exercise.WorkoutSets) == 0 {
+		return
+	}
+
+	counted := make([]WorkoutSet, 0, len(exercise.WorkoutSets))
+	for _, set := range exercise.WorkoutSets {
+		if set.SetType != WorkoutSetWarmup {
+			counted = append(counted, set)
+		}
+	}
+	if len(counted) == 0 {
+		counted = exercise.WorkoutSets
+	}
+
+	top := counted[0]
+	for _, set := range counted[1:] {
+		if isHeavierSet(set, top) {
+			top = set
+		}
+	}
+
+	exercise.Sets = len(counted)
+	exercise.Reps = top.Reps
+	exercise.DurationSeconds = top.DurationSeconds
+	exercise.Weight = top.Weight
+}
+
+func isHeavierSet(a, b WorkoutSet) bool {
+	weightA, weightB := valueOrZero(a.Weight), valueOrZero(b.Weight)
+	if weightA != weightB {
+		return weightA > weightB
+	}
+
+	if repsA, repsB := valueOrZero(a.Reps), valueOrZero(b.Reps); repsA != repsB {
+		return repsA > repsB
+	}
+
+	return valueOrZero(a.DurationSeconds) > valueOrZero(b.DurationSeconds)
+}
+
+func valueOrZero[T int | float64](value *T) T {
+	if value == nil {
+		return 0
+	}
+
+	return *value
+}
+
+// numberWorkoutSets numbers the sets of an exercise by their position.
+func numberWorkoutSets(exercise *WorkoutExercise) {
+	for i := range exercise.WorkoutSets {
+		exercise.WorkoutSets[i].SetNumber = i + 1
+	}
+}
+
+const workoutSetColumns = `set_number, set_type, reps, weight, duration_seconds, distance_meters, rpe, rir, rest_seconds, completed`
+
+// insertWorkoutSets inserts the sets of exercises that have none stored yet.
+func insertWorkoutSets(tx DBTX, exercises []*WorkoutExercise) error {
+	var setRows [][]any
+	for _, exercise := range exercises {
+		numberWorkoutSets(exercise)
+		for _, set := range exercise.WorkoutSets {
+			setRows = append(setRows, []any{exercise.ID, set.SetNumber, set.SetType, set.Reps, set.Weight, set.DurationSeconds, set.DistanceMeters, set.RPE, set.RIR, set.RestSeconds, set.Completed})
+		}
+	}
+
+	insert := `INSERT INTO workout_sets (workout_exercise_id, ` + workoutSetColumns + `)`
+
+	return insertRows(tx, insert, setRows, "", nil)
+}
+
+// replaceWorkoutSets replaces the stored sets of exercises with theirs. Sets
+// have no identity of their own, so they are simply rewritten.
+func replaceWorkoutSets(tx DBTX, exercises []*WorkoutExercise) error {
+	exerciseIDs := make([]int, len(exercises))
+	for i, exercise := range exercises {
+		exerciseIDs[i] = exercise.ID
+	}
+
+	_, err := tx.Exec(`DELETE FROM workout_sets WHERE workout_exercise_id = ANY($1)`, exerciseIDs)
+	if err != nil {
+		return err
+	}
+
+	return insertWorkoutSets(tx, exercises)
+}
+
+// loadWorkoutSets fills in the sets of exercises, in order.
+func loadWorkoutSets(db DBTX, exercises []WorkoutExercise) error {
+	if len(exercises) == 0 {
+		return nil
+	}
+
+	exerciseIndexes := make(map[int]int, len(exercises))
+	exerciseIDs := make([]int, len(exercises))
+	for i, exercise := range exercises {
+		exerciseIndexes[exercise.ID] = i
+		exerciseIDs[i] = exercise.ID
+		exercises[i].WorkoutSets = nil
+	}
+
+	query := `
+		SELECT workout_exercise_id, ` + workoutSetColumns + `
+		FROM workout_sets
+		WHERE workout_exercise_id = ANY($1)
+		ORDER BY workout_exercise_id, set_number
+	`
+
+	return queryRows(db, query, []any{exerciseIDs}, func(rows *sql.Rows) error {
+		var exerciseID int
+		var set WorkoutSet
+		err := rows.Scan(&exerciseID, &set.SetNumber, &set.SetType, &set.Reps, &set.Weight, &set.DurationSeconds, &set.DistanceMeters, &set.RPE, &set.RIR, &set.RestSeconds, &set.Completed)
+		exercise := &exercises[exerciseIndexes[exerciseID]]
+		exercise.WorkoutSets = append(exercise.WorkoutSets, set)
+		return err
+	})
+}
@@ -3,125 +3,691 @@ package store
 import (
 	"database/sql"
 	"errors"
+	"slices"
+	"time"
 )
 
+// Workout is a training session, performed from StartedAt to EndedAt, if known,
+// whatever the time it was logged at. TemplateID is the template it was
+// started from, if any. CaloriesEstimated tells CaloriesBurned was estimated
+// rather than measured. NewRecords are the personal records that the workout set
+// and did not hold before, which PersistWorkouts and UpdateWorkout fill in.
 type Workout struct {
-	ID              int               `json:"id"`
-	UserID          int               `json:"user_id"`
-	Name            string            `json:"name"`
-	Description     string            `json:"description"`
-	DurationMinutes int               `json:"duration_minutes"`
-	CaloriesBurned  int               `json:"calories_burned"`
-	Exercises       []WorkoutExercise `json:"exercises"`
+	ID                int               `json:"id"`
+	UserID            int               `json:"user_id"`
+	TemplateID        *int              `json:"template_id"`
+	Name              string            `json:"name"`
+	Description       string            `json:"description"`
+	DurationMinutes   int               `json:"duration_minutes"`
+	CaloriesBurned    *int              `json:"calories_burned"`
+	CaloriesEstimated bool              `json:"calories_estimated"`
+	Version           int               `json:"version"`
+	StartedAt         time.Time         `json:"started_at"`
+	EndedAt           *time.Time        `json:"ended_at"`
+	CreatedAt         time.Time         `json:"created_at"`
+	DeletedAt         *time.Time        `json:"deleted_at,omitempty"`
+	Exercises         []WorkoutExercise `json:"exercises"`
+	NewRecords        []PersonalRecord  `json:"-"`
 }
 
+// ErrVersionConflict is returned when a workout was modified since the version
+// the caller read, which is how concurrent edits are detected.
+var ErrVersionConflict = errors.New("workout version conflict")
+
+// WorkoutExercise is an exercise as performed in a workout. ExerciseID
+// optionally links it to the exercise catalog, or to a custom exercise. An
+// exercise is either logged set by set, in WorkoutSets, or only through the
+// aggregate Sets, Reps, DurationSeconds and Weight.
 type WorkoutExercise struct {
-	ID              int      `json:"id"`
-	Name            string   `json:"name"`
-	Sets            int      `json:"sets"`
-	Reps            *int     `json:"reps"`
-	DurationSeconds *int     `json:"duration_seconds"`
-	Weight          *float64 `json:"weight"`
-	Notes           string   `json:"notes"`
-	OrderIndex      int      `json:"order_index"`
+	ID              int          `json:"id"`
+	ExerciseID      *int         `json:"exercise_id"`
+	Name            string       `json:"name"`
+	Sets            int          `json:"sets"`
+	Reps            *int         `json:"reps"`
+	DurationSeconds *int         `json:"duration_seconds"`
+	Weight          *float64     `json:"weight"`
+	WorkoutSets     []WorkoutSet `json:"workout_sets,omitempty"`
+	Notes           string       `json:"notes"`
+	OrderIndex      int          `json:"order_index"`
+	CreatedAt       time.Time    `json:"created_at"`
+	UpdatedAt       time.Time    `json:"updated_at"`
 }
 
+// ErrInvalidExerciseOrder is returned when a reordering does not list exactly
+// the exercises of the workout.
+var ErrInvalidExerciseOrder = errors.New("invalid exercise order")
+
 type WorkoutStore interface {
+	// PersistWorkout, PersistWorkouts and UpdateWorkout detect the personal
+	// records the workouts set and fill in their NewRecords. Every write of a
+	// workout recomputes the records of the workouts started from it on.
+	// A workout persisted without StartedAt starts when it is persisted.
 	PersistWorkout(workout *Workout) error
+	// PersistWorkouts creates several workouts at once, all or none of them.
+	PersistWorkouts(workouts []*Workout) error
 	GetWorkout(id int) (*Workout, error)
+	// UpdateWorkout only applies if workout.Version is still the stored version,
+	// and increments it.
 	UpdateWorkout(workout *Workout) error
-	DeleteWorkout(id int) error
+	// DeleteWorkout moves a workout to the trash. It only applies if version is
+	// the stored version, unless it is 0, and increments it.
+	DeleteWorkout(id int, version int) error
 	GetWorkoutOwner(id int) (int, error)
+	// ListWorkoutsStarted returns the workouts of userID started from from,
+	// included, to to, excluded, with their exercises, earliest first.
+	ListWorkoutsStarted(userID int, from, to time.Time) ([]Workout, error)
+	// ListWorkoutsAfter returns up to limit workouts of userID whose id is
+	// greater than afterID, with their exercises, by id, which pages through
+	// every workout of a user, or through their trash if trashed.
+	ListWorkoutsAfter(userID, afterID, limit int, trashed bool) ([]Workout, error)
+	CountWorkouts(userID int) (int, error)
+	// SearchWorkouts returns the workouts of userID whose name, description, or
+	// exercise names and notes contain words starting with every word of query,
+	// best matches first.
+	SearchWorkouts(userID int, query string, limit, offset int) ([]WorkoutSearchResult, error)
+
+	// Trashed workouts are ignored by every other method but ListWorkoutsAfter. The trash methods
+	// return sql.ErrNoRows for workouts that are not in the trash.
+	// ListTrashedWorkouts returns the trash of a user without exercises, most
+	// recently deleted first.
+	ListTrashedWorkouts(userID int) ([]Workout, error)
+	GetTrashedWorkout(id int) (*Workout, error)
+	RestoreWorkout(id int) error
+	// PurgeWorkout permanently deletes a workout, with its revisions.
+	PurgeWorkout(id int) error
+	// PurgeTrashedWorkouts permanently deletes the workouts trashed before
+	// deletedBefore, with their revisions, and returns how many there were.
+	PurgeTrashedWorkouts(deletedBefore time.Time) (int, error)
+
+	// The exercise methods keep order_index a contiguous 1-based sequence,
+	// bump the version of the workout and refresh its personal records. An OrderIndex of 0 appends an added
+	// exercise and leaves an updated one in place.
+	AddWorkoutExercise(workoutID int, exercise *WorkoutExercise) error
+	UpdateWorkoutExercise(workoutID int, exercise *WorkoutExercise) error
+	DeleteWorkoutExercise(workoutID, exerciseID int) error
+	// ReorderWorkoutExercises returns the exercises in their new order.
+	ReorderWorkoutExercises(workoutID int, exerciseIDs []int) ([]WorkoutExercise, error)
 }
 
 var _ WorkoutStore = (*PostgresWorkoutStore)(nil)
 
 type PostgresWorkoutStore struct {
-	db *sql.DB
+	db DBTX
 }
 
-func NewPostgresWorkoutStore(db *sql.DB) *PostgresWorkoutStore {
+func NewPostgresWorkoutStore(db DBTX) *PostgresWorkoutStore {
 	return &PostgresWorkoutStore{
 		db: db,
 	}
 }
 
 func (ws *PostgresWorkoutStore) PersistWorkout(workout *Workout) error {
-	tx, err := ws.db.Begin()
-	if err != nil {
-		return err
+	return ws.PersistWorkouts([]*Workout{workout})
+}
+
+// PersistWorkouts allocates the ids of the workouts and their exercises up
+// front, so that each table takes multi-row inserts rather than one per row.
+func (ws *PostgresWorkoutStore) PersistWorkouts(workouts []*Workout) error {
+	if len(workouts) == 0 {
+		return nil
 	}
 
-	defer func(tx *sql.Tx) {
-		_ = tx.Rollback()
-	}(tx)
+	return runInTx(ws.db, func(tx DBTX) error {
+		workoutIDs, err := nextIDs(tx, "workouts", len(workouts))
+		if err != nil {
+			return err
+		}
 
-	query := `
-		INSERT INTO workouts (user_id, name, description, duration_minutes, calories_burned)
-		VALUES ($1, $2, $3, $4, $5)
-		RETURNING id
+		now := time.Now()
+		workoutRows := make([][]any, 0, len(workouts))
+		for i, workout := range workouts {
+			workout.ID = workoutIDs[i]
+			if workout.StartedAt.IsZero() {
+				workout.StartedAt = now
+			}
+			workoutRows = append(workoutRows, []any{workout.ID, workout.UserID, workout.TemplateID, workout.Name, workout.Description, workout.DurationMinutes, workout.CaloriesBurned, workout.CaloriesEstimated, workout.StartedAt, workout.EndedAt})
+		}
+
+		insert := `INSERT INTO workouts (id, user_id, template_id, name, description, duration_minutes, calories_burned, calories_estimated, started_at, ended_at)`
+		versions := make(map[int]int, len(workouts))
+		createdAt := make(map[int]time.Time, len(workouts))
+		err = insertRows(tx, insert, workoutRows, "id, version, created_at", func(rows *sql.Rows) error {
+			var id, version int
+			var at time.Time
+			err := rows.Scan(&id, &version, &at)
+			versions[id] = version
+			createdAt[id] = at
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, workout := range workouts {
+			workout.Version = versions[workout.ID]
+			workout.CreatedAt = createdAt[workout.ID]
+		}
+
+		err = insertWorkoutExercises(tx, workouts)
+		if err != nil {
+			return err
+		}
+
+		// the streaks and the records of a user are refreshed once for all their workouts
+		userIDs, userWorkouts := workoutsByUser(workouts)
+		for _, userID := range userIDs {
+			err = addWorkoutDays(tx, userID, startTimes(userWorkouts[userID]))
+			if err != nil {
+				return err
+			}
+
+			err = refreshPersonalRecords(tx, userID, earliestStart(userWorkouts[userID]), userWorkouts[userID]...)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (ws *PostgresWorkoutStore) GetWorkout(id int) (*Workout, error) {
+	return getWorkout(ws.db, id, false)
+}
+
+func (ws *PostgresWorkoutStore) GetTrashedWorkout(id int) (*Workout, error) {
+	return getWorkout(ws.db, id, true)
+}
+
+const workoutColumns = `id, user_id, template_id, name, description, duration_minutes, calories_burned, calories_estimated, version, started_at, ended_at, created_at, deleted_at`
+
+func scanWorkout(row interface{ Scan(dest ...any) error }, workout *Workout) error {
+	return row.Scan(
+		&workout.ID,
+		&workout.UserID,
+		&workout.TemplateID,
+		&workout.Name,
+		&workout.Description,
+		&workout.DurationMinutes,
+		&workout.CaloriesBurned,
+		&workout.CaloriesEstimated,
+		&workout.Version,
+		&workout.StartedAt,
+		&workout.EndedAt,
+		&workout.CreatedAt,
+		&workout.DeletedAt,
+	)
+}
+
+func getWorkout(db DBTX, id int, trashed bool) (*Workout, error) {
+	workout := &Workout{}
+
+	workoutQuery := `
+		SELECT ` + workoutColumns + `
+		FROM workouts
+		WHERE id = $1 AND (deleted_at IS NOT NULL) = $2
 	`
 
-	err = tx.QueryRow(query, workout.UserID, workout.Name, workout.Description, workout.DurationMinutes, workout.CaloriesBurned).Scan(&workout.ID)
+	err := scanWorkout(db.QueryRow(workoutQuery, id, trashed), workout)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	for i := range workout.Exercises {
-		// Question: Why do we need that?
-		exercise := &workout.Exercises[i]
+	workout.Exercises, err = getWorkoutExercises(db, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return workout, nil
+}
+
+func (ws *PostgresWorkoutStore) UpdateWorkout(workout *Workout) error {
+	return runInTx(ws.db, func(tx DBTX) error {
+		var startedAt time.Time
+		err := tx.QueryRow(`SELECT started_at FROM workouts WHERE id = $1 FOR UPDATE`, workout.ID).Scan(&startedAt)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
 
 		query := `
-			INSERT INTO workout_exercises (workout_id, name, sets, reps, duration_seconds, weight, notes, order_index)
-			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-			RETURNING id
+			UPDATE workouts
+			SET name = $1, description = $2, duration_minutes = $3, calories_burned = $4, calories_estimated = $5,
+				started_at = $6, ended_at = $7, version = version + 1, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $8 AND version = $9 AND deleted_at IS NULL
+			RETURNING version, user_id, created_at
 		`
 
-		err = tx.QueryRow(query, workout.ID, exercise.Name, exercise.Sets, exercise.Reps, exercise.DurationSeconds, exercise.Weight, exercise.Notes, exercise.OrderIndex).Scan(&exercise.ID)
+		err = tx.QueryRow(query, workout.Name, workout.Description, workout.DurationMinutes, workout.CaloriesBurned, workout.CaloriesEstimated,
+			workout.StartedAt, workout.EndedAt, workout.ID, workout.Version).Scan(&workout.Version, &workout.UserID, &workout.CreatedAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			return workoutNotFoundOrConflict(tx, workout.ID)
+		}
+		if err != nil {
+			return err
+		}
+
+		// a workout moved to another time may move to another training day
+		if !startedAt.Equal(workout.StartedAt) {
+			err = removeWorkoutDay(tx, workout.UserID, startedAt)
+			if err == nil {
+				err = addWorkoutDay(tx, workout.UserID, workout.StartedAt)
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		err = syncWorkoutExercises(tx, workout)
 		if err != nil {
 			return err
 		}
+
+		// the records of the workouts between where it started and where it
+		// starts now may change too
+		return refreshPersonalRecords(tx, workout.UserID, earlier(startedAt, workout.StartedAt), workout)
+	})
+}
+
+func (ws *PostgresWorkoutStore) DeleteWorkout(id int, version int) error {
+	query := `
+		UPDATE workouts
+		SET deleted_at = CURRENT_TIMESTAMP, version = version + 1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND ($2 = 0 OR version = $2) AND deleted_at IS NULL
+		RETURNING user_id, started_at
+	`
+
+	return runInTx(ws.db, func(tx DBTX) error {
+		var userID int
+		var startedAt time.Time
+		err := tx.QueryRow(query, id, version).Scan(&userID, &startedAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			return workoutNotFoundOrConflict(tx, id)
+		}
+		if err != nil {
+			return err
+		}
+
+		err = removeWorkoutDay(tx, userID, startedAt)
+		if err != nil {
+			return err
+		}
+
+		return refreshPersonalRecords(tx, userID, startedAt)
+	})
+}
+
+func (ws *PostgresWorkoutStore) GetWorkoutOwner(id int) (int, error) {
+	var userID int
+
+	query := `SELECT user_id FROM workouts WHERE id = $1 AND deleted_at IS NULL`
+
+	err := ws.db.QueryRow(query, id).Scan(&userID)
+	if err != nil {
+		return 0, err
 	}
 
-	err = tx.Commit()
+	return userID, nil
+}
+
+func (ws *PostgresWorkoutStore) ListWorkoutsStarted(userID int, from, to time.Time) ([]Workout, error) {
+	query := `
+		SELECT ` + workoutColumns + `
+		FROM workouts
+		WHERE user_id = $1 AND deleted_at IS NULL AND started_at >= $2 AND started_at < $3
+		ORDER BY started_at, id
+	`
+
+	workouts := []Workout{}
+	err := queryRows(ws.db, query, []any{userID, from, to}, func(rows *sql.Rows) error {
+		var workout Workout
+		err := scanWorkout(rows, &workout)
+		workouts = append(workouts, workout)
+		return err
+	})
 	if err != nil {
+		return nil, err
+	}
+
+	for i := range workouts {
+		workouts[i].Exercises, err = getWorkoutExercises(ws.db, workouts[i].ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return workouts, nil
+}
+
+func (ws *PostgresWorkoutStore) ListWorkoutsAfter(userID, afterID, limit int, trashed bool) ([]Workout, error) {
+	query := `
+		SELECT ` + workoutColumns + `
+		FROM workouts
+		WHERE user_id = $1 AND (deleted_at IS NOT NULL) = $2 AND id > $3
+		ORDER BY id
+		LIMIT $4
+	`
+
+	workouts := []Workout{}
+	err := queryRows(ws.db, query, []any{userID, trashed, afterID, limit}, func(rows *sql.Rows) error {
+		var workout Workout
+		err := scanWorkout(rows, &workout)
+		workouts = append(workouts, workout)
 		return err
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	err = loadWorkoutExercises(ws.db, workouts)
+	if err != nil {
+		return nil, err
+	}
+
+	return workouts, nil
 }
 
-func (ws *PostgresWorkoutStore) GetWorkout(id int) (*Workout, error) {
-	workout := &Workout{}
+func (ws *PostgresWorkoutStore) CountWorkouts(userID int) (int, error) {
+	query := `SELECT count(*) FROM workouts WHERE user_id = $1 AND deleted_at IS NULL`
 
-	workoutQuery := `
-		SELECT id, name, description, duration_minutes, calories_burned
+	var count int
+	err := ws.db.QueryRow(query, userID).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (ws *PostgresWorkoutStore) ListTrashedWorkouts(userID int) ([]Workout, error) {
+	query := `
+		SELECT ` + workoutColumns + `
 		FROM workouts
-		WHERE id = $1
+		WHERE user_id = $1 AND deleted_at IS NOT NULL
+		ORDER BY deleted_at DESC, id DESC
 	`
 
-	err := ws.db.QueryRow(workoutQuery, id).Scan(
-		&workout.ID,
-		&workout.Name,
-		&workout.Description,
-		&workout.DurationMinutes,
-		&workout.CaloriesBurned,
-	)
-	if errors.Is(err, sql.ErrNoRows) {
-		return nil, nil
+	rows, err := ws.db.Query(query, userID)
+	if err != nil {
+		return nil, err
 	}
+
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	workouts := []Workout{}
+	for rows.Next() {
+		var workout Workout
+		err = scanWorkout(rows, &workout)
+		if err != nil {
+			return nil, err
+		}
+
+		workouts = append(workouts, workout)
+	}
+
+	return workouts, rows.Err()
+}
+
+func (ws *PostgresWorkoutStore) RestoreWorkout(id int) error {
+	query := `
+		UPDATE workouts
+		SET deleted_at = NULL, version = version + 1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND deleted_at IS NOT NULL
+		RETURNING user_id, started_at
+	`
+
+	return runInTx(ws.db, func(tx DBTX) error {
+		var userID int
+		var startedAt time.Time
+		err := tx.QueryRow(query, id).Scan(&userID, &startedAt)
+		if err != nil {
+			return err
+		}
+
+		err = addWorkoutDay(tx, userID, startedAt)
+		if err != nil {
+			return err
+		}
+
+		return refreshPersonalRecords(tx, userID, startedAt)
+	})
+}
+
+func (ws *PostgresWorkoutStore) PurgeWorkout(id int) error {
+	return runInTx(ws.db, func(tx DBTX) error {
+		err := execAffectingRow(tx, `DELETE FROM workouts WHERE id = $1 AND deleted_at IS NOT NULL`, id)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`DELETE FROM workout_revisions WHERE workout_id = $1`, id)
+
+		return err
+	})
+}
+
+func (ws *PostgresWorkoutStore) PurgeTrashedWorkouts(deletedBefore time.Time) (int, error) {
+	query := `
+		WITH purged AS (
+			DELETE FROM workouts WHERE deleted_at < $1 RETURNING id
+		), purged_revisions AS (
+			DELETE FROM workout_revisions WHERE workout_id IN (SELECT id FROM purged)
+		)
+		SELECT COUNT(*) FROM purged
+	`
+
+	var purged int
+	err := ws.db.QueryRow(query, deletedBefore).Scan(&purged)
+
+	return purged, err
+}
+
+// execAffectingRow runs a statement that must affect a row, or returns sql.ErrNoRows.
+func execAffectingRow(db DBTX, query string, args ...any) error {
+	result, err := db.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (ws *PostgresWorkoutStore) AddWorkoutExercise(workoutID int, exercise *WorkoutExercise) error {
+	return runInTx(ws.db, func(tx DBTX) error {
+		orderedIDs, err := lockWorkoutExercises(tx, workoutID)
+		if err != nil {
+			return err
+		}
+
+		query := `
+			INSERT INTO workout_exercises (workout_id, exercise_id, name, sets, reps, duration_seconds, weight, notes, order_index)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			RETURNING id
+		`
+
+		err = tx.QueryRow(query, workoutID, exercise.ExerciseID, exercise.Name, exercise.Sets, exercise.Reps, exercise.DurationSeconds, exercise.Weight, exercise.Notes, len(orderedIDs)+1).Scan(&exercise.ID)
+		if err != nil {
+			return err
+		}
+
+		err = insertWorkoutSets(tx, []*WorkoutExercise{exercise})
+		if err != nil {
+			return err
+		}
+
+		orderedIDs = moveExercise(append(orderedIDs, exercise.ID), exercise.ID, exercise.OrderIndex)
+		err = applyExerciseOrder(tx, orderedIDs)
+		if err != nil {
+			return err
+		}
+
+		err = refreshWorkoutRecords(tx, workoutID)
+		if err != nil {
+			return err
+		}
+
+		return reloadWorkoutExercise(tx, exercise)
+	})
+}
+
+func (ws *PostgresWorkoutStore) UpdateWorkoutExercise(workoutID int, exercise *WorkoutExercise) error {
+	return runInTx(ws.db, func(tx DBTX) error {
+		orderedIDs, err := lockWorkoutExercises(tx, workoutID)
+		if err != nil {
+			return err
+		}
+
+		err = clearLegacyWeights(tx, []*WorkoutExercise{exercise})
+		if err != nil {
+			return err
+		}
+
+		query := `
+			UPDATE workout_exercises
+			SET exercise_id = $1, name = $2, sets = $3, reps = $4, duration_seconds = $5, weight = $6, notes = $7,
+				updated_at = CURRENT_TIMESTAMP
+			WHERE id = $8 AND workout_id = $9
+		`
+
+		result, err := tx.Exec(query, exercise.ExerciseID, exercise.Name, exercise.Sets, exercise.Reps, exercise.DurationSeconds, exercise.Weight, exercise.Notes, exercise.ID, workoutID)
+		if err != nil {
+			return err
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rowsAffected == 0 {
+			return sql.ErrNoRows
+		}
+
+		err = replaceWorkoutSets(tx, []*WorkoutExercise{exercise})
+		if err != nil {
+			return err
+		}
+
+		err = applyExerciseOrder(tx, moveExercise(orderedIDs, exercise.ID, exercise.OrderIndex))
+		if err != nil {
+			return err
+		}
+
+		err = refreshWorkoutRecords(tx, workoutID)
+		if err != nil {
+			return err
+		}
+
+		return reloadWorkoutExercise(tx, exercise)
+	})
+}
+
+func (ws *PostgresWorkoutStore) DeleteWorkoutExercise(workoutID, exerciseID int) error {
+	return runInTx(ws.db, func(tx DBTX) error {
+		orderedIDs, err := lockWorkoutExercises(tx, workoutID)
+		if err != nil {
+			return err
+		}
+
+		query := `DELETE FROM workout_exercises WHERE id = $1 AND workout_id = $2`
+
+		result, err := tx.Exec(query, exerciseID, workoutID)
+		if err != nil {
+			return err
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rowsAffected == 0 {
+			return sql.ErrNoRows
+		}
+
+		err = applyExerciseOrder(tx, removeExercise(orderedIDs, exerciseID))
+		if err != nil {
+			return err
+		}
+
+		return refreshWorkoutRecords(tx, workoutID)
+	})
+}
+
+func (ws *PostgresWorkoutStore) ReorderWorkoutExercises(workoutID int, exerciseIDs []int) ([]WorkoutExercise, error) {
+	var exercises []WorkoutExercise
+
+	err := runInTx(ws.db, func(tx DBTX) error {
+		orderedIDs, err := lockWorkoutExercises(tx, workoutID)
+		if err != nil {
+			return err
+		}
+
+		if !sameExercises(orderedIDs, exerciseIDs) {
+			return ErrInvalidExerciseOrder
+		}
+
+		err = applyExerciseOrder(tx, exerciseIDs)
+		if err != nil {
+			return err
+		}
+
+		exercises, err = getWorkoutExercises(tx, workoutID)
+
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	exerciseQuery := `
-		SELECT id, name, sets, reps, duration_seconds, weight, notes, order_index
+	return exercises, nil
+}
+
+const workoutExerciseColumns = `id, exercise_id, name, sets, reps, duration_seconds, weight, notes, order_index, created_at, updated_at`
+
+func scanWorkoutExercise(row interface{ Scan(dest ...any) error }, exercise *WorkoutExercise) error {
+	return row.Scan(workoutExerciseFields(exercise)...)
+}
+
+// workoutExerciseFields are the destinations of workoutExerciseColumns.
+func workoutExerciseFields(exercise *WorkoutExercise) []any {
+	return []any{
+		&exercise.ID,
+		&exercise.ExerciseID,
+		&exercise.Name,
+		&exercise.Sets,
+		&exercise.Reps,
+		&exercise.DurationSeconds,
+		&exercise.Weight,
+		&exercise.Notes,
+		&exercise.OrderIndex,
+		&exercise.CreatedAt,
+		&exercise.UpdatedAt,
+	}
+}
+
+func getWorkoutExercises(db DBTX, workoutID int) ([]WorkoutExercise, error) {
+	query := `
+		SELECT ` + workoutExerciseColumns + `
 		FROM workout_exercises
 		WHERE workout_id = $1
-		ORDER BY order_index
+		ORDER BY order_index, id
 	`
 
-	rows, err := ws.db.Query(exerciseQuery, id)
+	rows, err := db.Query(query, workoutID)
 	if err != nil {
 		return nil, err
 	}
@@ -130,50 +696,188 @@ func (ws *PostgresWorkoutStore) GetWorkout(id int) (*Workout, error) {
 		_ = rows.Close()
 	}(rows)
 
+	var exercises []WorkoutExercise
 	for rows.Next() {
 		var exercise WorkoutExercise
-		err = rows.Scan(&exercise.ID, &exercise.Name, &exercise.Sets, &exercise.Reps, &exercise.DurationSeconds, &exercise.Weight, &exercise.Notes, &exercise.OrderIndex)
+		err = scanWorkoutExercise(rows, &exercise)
 		if err != nil {
 			return nil, err
 		}
 
-		workout.Exercises = append(workout.Exercises, exercise)
+		exercises = append(exercises, exercise)
 	}
 
-	return workout, nil
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return exercises, loadWorkoutSets(db, exercises)
 }
 
-func (ws *PostgresWorkoutStore) UpdateWorkout(workout *Workout) error {
-	tx, err := ws.db.Begin()
+// loadWorkoutExercises fills in the exercises of workouts, with their sets,
+// in order.
+func loadWorkoutExercises(db DBTX, workouts []Workout) error {
+	if len(workouts) == 0 {
+		return nil
+	}
+
+	workoutIndexes := make(map[int]int, len(workouts))
+	workoutIDs := make([]int, len(workouts))
+	for i, workout := range workouts {
+		workoutIndexes[workout.ID] = i
+		workoutIDs[i] = workout.ID
+	}
+
+	query := `
+		SELECT workout_id, ` + workoutExerciseColumns + `
+		FROM workout_exercises
+		WHERE workout_id = ANY($1)
+		ORDER BY workout_id, order_index, id
+	`
+
+	var exercises []WorkoutExercise
+	var exerciseWorkoutIDs []int
+	err := queryRows(db, query, []any{workoutIDs}, func(rows *sql.Rows) error {
+		var workoutID int
+		var exercise WorkoutExercise
+		err := rows.Scan(append([]any{&workoutID}, workoutExerciseFields(&exercise)...)...)
+		exercises = append(exercises, exercise)
+		exerciseWorkoutIDs = append(exerciseWorkoutIDs, workoutID)
+		return err
+	})
 	if err != nil {
 		return err
 	}
 
-	defer func(tx *sql.Tx) {
-		_ = tx.Rollback()
-	}(tx)
+	err = loadWorkoutSets(db, exercises)
+	if err != nil {
+		return err
+	}
+
+	for i, exercise := range exercises {
+		workout := &workouts[workoutIndexes[exerciseWorkoutIDs[i]]]
+		workout.Exercises = append(workout.Exercises, exercise)
+	}
+
+	return nil
+}
 
+// listWorkoutsStartedFrom returns the workouts of userID started from from on,
+// with their exercises, in the order they started.
+func listWorkoutsStartedFrom(db DBTX, userID int, from time.Time) ([]Workout, error) {
 	query := `
-		UPDATE workouts
-		SET name = $1, description = $2, duration_minutes = $3, calories_burned = $4
-		WHERE id = $5
+		SELECT ` + workoutColumns + `
+		FROM workouts
+		WHERE user_id = $1 AND deleted_at IS NULL AND started_at >= $2
+		ORDER BY started_at, id
 	`
 
-	result, err := tx.Exec(query, workout.Name, workout.Description, workout.DurationMinutes, workout.CaloriesBurned, workout.ID)
+	workouts := []Workout{}
+	err := queryRows(db, query, []any{userID, from}, func(rows *sql.Rows) error {
+		var workout Workout
+		err := scanWorkout(rows, &workout)
+		workouts = append(workouts, workout)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return workouts, loadWorkoutExercises(db, workouts)
+}
+
+func reloadWorkoutExercise(db DBTX, exercise *WorkoutExercise) error {
+	query := `SELECT ` + workoutExerciseColumns + ` FROM workout_exercises WHERE id = $1`
+
+	err := scanWorkoutExercise(db.QueryRow(query, exercise.ID), exercise)
 	if err != nil {
 		return err
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	exercises := []WorkoutExercise{*exercise}
+	err = loadWorkoutSets(db, exercises)
+	*exercise = exercises[0]
+
+	return err
+}
+
+func insertWorkoutExercises(tx DBTX, workouts []*Workout) error {
+	var exercises []*WorkoutExercise
+	var exerciseRows [][]any
+	for _, workout := range workouts {
+		for i := range workout.Exercises {
+			exercise := &workout.Exercises[i]
+			exercises = append(exercises, exercise)
+			exerciseRows = append(exerciseRows, []any{workout.ID, exercise.ExerciseID, exercise.Name, exercise.Sets, exercise.Reps, exercise.DurationSeconds, exercise.Weight, exercise.Notes, exercise.OrderIndex})
+		}
+	}
+
+	exerciseIDs, err := nextIDs(tx, "workout_exercises", len(exercises))
 	if err != nil {
 		return err
 	}
 
-	if rowsAffected == 0 {
-		return sql.ErrNoRows
+	for i, exercise := range exercises {
+		exercise.ID = exerciseIDs[i]
+		exerciseRows[i] = append([]any{exercise.ID}, exerciseRows[i]...)
+	}
+
+	insert := `INSERT INTO workout_exercises (id, workout_id, exercise_id, name, sets, reps, duration_seconds, weight, notes, order_index)`
+	timestamps := make(map[int][2]time.Time, len(exercises))
+	err = insertRows(tx, insert, exerciseRows, "id, created_at, updated_at", func(rows *sql.Rows) error {
+		var id int
+		var createdAt, updatedAt time.Time
+		err := rows.Scan(&id, &createdAt, &updatedAt)
+		timestamps[id] = [2]time.Time{createdAt, updatedAt}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, exercise := range exercises {
+		exercise.CreatedAt, exercise.UpdatedAt = timestamps[exercise.ID][0], timestamps[exercise.ID][1]
+	}
+
+	return insertWorkoutSets(tx, exercises)
+}
+
+// syncWorkoutExercises brings the stored exercises in line with workout.Exercises
+// without recreating them: exercises are matched by id, so unchanged ones keep
+// their id and timestamps, changed ones are updated, unknown ones are inserted
+// and the ones left out are deleted. Their sets are rewritten.
+func syncWorkoutExercises(tx DBTX, workout *Workout) error {
+	existingIDs, err := getWorkoutExerciseIDs(tx, workout.ID)
+	if err != nil {
+		return err
+	}
+
+	existing := make(map[int]bool, len(existingIDs))
+	for _, id := range existingIDs {
+		existing[id] = true
+	}
+
+	keptIDs := []int{}
+	for _, exercise := range workout.Exercises {
+		if existing[exercise.ID] {
+			keptIDs = append(keptIDs, exercise.ID)
+		}
+	}
+
+	_, err = tx.Exec(`DELETE FROM workout_exercises WHERE workout_id = $1 AND NOT (id = ANY($2))`, workout.ID, keptIDs)
+	if err != nil {
+		return err
+	}
+
+	keptExercises := make([]*WorkoutExercise, 0, len(keptIDs))
+	for i := range workout.Exercises {
+		if existing[workout.Exercises[i].ID] {
+			keptExercises = append(keptExercises, &workout.Exercises[i])
+		}
 	}
 
-	_, err = tx.Exec(`DELETE FROM workout_exercises WHERE workout_id = $1`, workout.ID)
+	err = clearLegacyWeights(tx, keptExercises)
 	if err != nil {
 		return err
 	}
@@ -181,50 +885,253 @@ func (ws *PostgresWorkoutStore) UpdateWorkout(workout *Workout) error {
 	for i := range workout.Exercises {
 		exercise := &workout.Exercises[i]
 
+		if !existing[exercise.ID] {
+			query := `
+				INSERT INTO workout_exercises (workout_id, exercise_id, name, sets, reps, duration_seconds, weight, notes, order_index)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+				RETURNING id
+			`
+
+			err = tx.QueryRow(query, workout.ID, exercise.ExerciseID, exercise.Name, exercise.Sets, exercise.Reps, exercise.DurationSeconds, exercise.Weight, exercise.Notes, exercise.OrderIndex).Scan(&exercise.ID)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
 		query := `
-			INSERT INTO workout_exercises (workout_id, name, sets, reps, duration_seconds, weight, notes, order_index)
-			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-			RETURNING id
+			UPDATE workout_exercises
+			SET exercise_id = $1, name = $2, sets = $3, reps = $4, duration_seconds = $5, weight = $6, notes = $7, order_index = $8,
+				updated_at = CURRENT_TIMESTAMP
+			WHERE id = $9
+			AND (exercise_id, name, sets, reps, duration_seconds, weight, notes, order_index)
+				IS DISTINCT FROM ($1, $2, $3, $4, $5, $6, $7, $8)
 		`
 
-		err = tx.QueryRow(query, workout.ID, exercise.Name, exercise.Sets, exercise.Reps, exercise.DurationSeconds, exercise.Weight, exercise.Notes, exercise.OrderIndex).Scan(&exercise.ID)
+		_, err = tx.Exec(query, exercise.ExerciseID, exercise.Name, exercise.Sets, exercise.Reps, exercise.DurationSeconds, exercise.Weight, exercise.Notes, exercise.OrderIndex, exercise.ID)
 		if err != nil {
 			return err
 		}
 	}
 
-	return tx.Commit()
+	exercises := make([]*WorkoutExercise, len(workout.Exercises))
+	for i := range workout.Exercises {
+		exercises[i] = &workout.Exercises[i]
+	}
+
+	err = replaceWorkoutSets(tx, exercises)
+	if err != nil {
+		return err
+	}
+
+	workout.Exercises, err = getWorkoutExercises(tx, workout.ID)
+
+	return err
 }
 
-func (ws *PostgresWorkoutStore) DeleteWorkout(id int) error {
-	query := `DELETE FROM workouts WHERE id = $1`
+// clearLegacyWeights unflags the legacy weights of the stored exercises that
+// exercises are about to rewrite with other weights, see
+// UserStore.ResolveLegacyWeights. It must be called before the rewrite.
+func clearLegacyWeights(tx DBTX, exercises []*WorkoutExercise) error {
+	exerciseIDs := make([]int, len(exercises))
+	for i, exercise := range exercises {
+		exerciseIDs[i] = exercise.ID
+	}
+
+	query := `SELECT ` + workoutExerciseColumns + ` FROM workout_exercises WHERE id = ANY($1) AND legacy_weight`
 
-	result, err := ws.db.Exec(query, id)
+	var legacyExercises []WorkoutExercise
+	err := queryRows(tx, query, []any{exerciseIDs}, func(rows *sql.Rows) error {
+		var exercise WorkoutExercise
+		err := scanWorkoutExercise(rows, &exercise)
+		legacyExercises = append(legacyExercises, exercise)
+		return err
+	})
 	if err != nil {
 		return err
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	err = loadWorkoutSets(tx, legacyExercises)
 	if err != nil {
 		return err
 	}
 
+	legacyByID := make(map[int]WorkoutExercise, len(legacyExercises))
+	for _, exercise := range legacyExercises {
+		legacyByID[exercise.ID] = exercise
+	}
+
+	changedIDs := []int{}
+	for _, exercise := range exercises {
+		if legacyExercise, ok := legacyByID[exercise.ID]; ok && !sameWeights(legacyExercise, *exercise) {
+			changedIDs = append(changedIDs, exercise.ID)
+		}
+	}
+
+	if len(changedIDs) == 0 {
+		return nil
+	}
+
+	_, err = tx.Exec(`UPDATE workout_exercises SET legacy_weight = FALSE WHERE id = ANY($1)`, changedIDs)
+
+	return err
+}
+
+// lockWorkoutExercises bumps the version of the workout, which also locks it
+// for the rest of the transaction, and returns its exercise ids in order.
+func lockWorkoutExercises(tx DBTX, workoutID int) ([]int, error) {
+	query := `
+		UPDATE workouts
+		SET version = version + 1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND deleted_at IS NULL
+	`
+
+	result, err := tx.Exec(query, workoutID)
+	if err != nil {
+		return nil, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
 	if rowsAffected == 0 {
-		return sql.ErrNoRows
+		return nil, sql.ErrNoRows
 	}
 
-	return nil
+	return getWorkoutExerciseIDs(tx, workoutID)
 }
 
-func (ws *PostgresWorkoutStore) GetWorkoutOwner(id int) (int, error) {
-	var userID int
+func getWorkoutExerciseIDs(db DBTX, workoutID int) ([]int, error) {
+	rows, err := db.Query(`SELECT id FROM workout_exercises WHERE workout_id = $1 ORDER BY order_index, id`, workoutID)
+	if err != nil {
+		return nil, err
+	}
 
-	query := `SELECT user_id FROM workouts WHERE id = $1`
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
 
-	err := ws.db.QueryRow(query, id).Scan(&userID)
+	var ids []int
+	for rows.Next() {
+		var id int
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// applyExerciseOrder renumbers the given exercises 1..n, touching only the
+// rows whose position changed.
+func applyExerciseOrder(tx DBTX, orderedIDs []int) error {
+	if len(orderedIDs) == 0 {
+		return nil
+	}
+
+	query := `
+		UPDATE workout_exercises we
+		SET order_index = o.position, updated_at = CURRENT_TIMESTAMP
+		FROM unnest($1::INTEGER[]) WITH ORDINALITY AS o(id, position)
+		WHERE we.id = o.id AND we.order_index <> o.position
+	`
+
+	_, err := tx.Exec(query, orderedIDs)
+
+	return err
+}
+
+// workoutsByUser groups workouts by user, the users in the order they first
+// appear.
+func workoutsByUser(workouts []*Workout) ([]int, map[int][]*Workout) {
+	var userIDs []int
+	userWorkouts := make(map[int][]*Workout)
+	for _, workout := range workouts {
+		if _, ok := userWorkouts[workout.UserID]; !ok {
+			userIDs = append(userIDs, workout.UserID)
+		}
+		userWorkouts[workout.UserID] = append(userWorkouts[workout.UserID], workout)
+	}
+
+	return userIDs, userWorkouts
+}
+
+func startTimes(workouts []*Workout) []time.Time {
+	startedAt := make([]time.Time, len(workouts))
+	for i, workout := range workouts {
+		startedAt[i] = workout.StartedAt
+	}
+
+	return startedAt
+}
+
+// earliestStart returns when the earliest of workouts started.
+func earliestStart(workouts []*Workout) time.Time {
+	earliest := workouts[0].StartedAt
+	for _, workout := range workouts[1:] {
+		earliest = earlier(earliest, workout.StartedAt)
+	}
+
+	return earliest
+}
+
+func earlier(a, b time.Time) time.Time {
+	if b.Before(a) {
+		return b
+	}
+
+	return a
+}
+
+// workoutNotFoundOrConflict tells apart the two reasons a versioned write can miss its row.
+func workoutNotFoundOrConflict(db DBTX, id int) error {
+	var exists bool
+
+	err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM workouts WHERE id = $1 AND deleted_at IS NULL)`, id).Scan(&exists)
 	if err != nil {
-		return 0, err
+		return err
 	}
 
-	return userID, nil
+	if !exists {
+		return sql.ErrNoRows
+	}
+
+	return ErrVersionConflict
+}
+
+// moveExercise moves id to the 1-based position in orderedIDs. A position of 0
+// leaves it where it is, positions past the end move it last.
+func moveExercise(orderedIDs []int, id int, position int) []int {
+	if position <= 0 {
+		return orderedIDs
+	}
+
+	orderedIDs = removeExercise(orderedIDs, id)
+	position = min(position, len(orderedIDs)+1)
+
+	return slices.Insert(orderedIDs, position-1, id)
+}
+
+func removeExercise(orderedIDs []int, id int) []int {
+	return slices.DeleteFunc(slices.Clone(orderedIDs), func(orderedID int) bool {
+		return orderedID == id
+	})
+}
+
+func sameExercises(orderedIDs, exerciseIDs []int) bool {
+	if len(orderedIDs) != len(exerciseIDs) {
+		return false
+	}
+
+	sortedIDs := slices.Sorted(slices.Values(exerciseIDs))
+	if len(slices.Compact(slices.Clone(sortedIDs))) != len(sortedIDs) {
+		return false
+	}
+
+	return slices.Equal(slices.Sorted(slices.Values(orderedIDs)), sortedIDs)
 }
@@ -12,7 +12,13 @@ import (
 )
 
 // TODO: move to utils
+// setupTestDB connects to the test database, which the tests fail without
+// unless run with -short.
 func setupTestDB(t *testing.T) *sql.DB {
+	if testing.Short() {
+		t.Skip("skipping the test database in short mode")
+	}
+
 	if err := godotenv.Load("../../.env.test"); err != nil {
 		panic(err)
 	}
@@ -32,7 +38,7 @@ func setupTestDB(t *testing.T) *sql.DB {
 		t.Fatalf("failed to run migrations: %v", err)
 	}
 
-	_, err = db.Exec("TRUNCATE TABLE workouts, workout_exercises CASCADE")
+	_, err = db.Exec("TRUNCATE TABLE users, tokens, workouts, workout_exercises, workout_sets, workout_revisions, idempotency_keys, exercises, workout_templates, workout_template_exercises, programs, program_days, enrollments, enrollment_sessions, personal_records, body_measurements, goals, training_days, streaks, exports RESTART IDENTITY CASCADE")
 	if err != nil {
 		t.Fatalf("failed to truncate tables: %v", err)
 	}
@@ -40,6 +46,17 @@ func setupTestDB(t *testing.T) *sql.DB {
 	return db
 }
 
+func TestPostgresStores(t *testing.T) {
+	runStoreContracts(t, func(t *testing.T) *Stores {
+		db := setupTestDB(t)
+		t.Cleanup(func() {
+			_ = db.Close()
+		})
+
+		return NewPostgresStores(db)
+	})
+}
+
 func TestPersistWorkout(t *testing.T) {
 	db := setupTestDB(t)
 	defer func(db *sql.DB) {
@@ -47,6 +64,7 @@ func TestPersistWorkout(t *testing.T) {
 	}(db)
 
 	store := NewPostgresWorkoutStore(db)
+	user := createTestUser(t, NewPostgresStores(db), "workout-owner")
 
 	// arrange (table testing style)
 	testCases := []struct {
@@ -57,10 +75,11 @@ func TestPersistWorkout(t *testing.T) {
 		{
 			name: "valid workout",
 			workout: &Workout{
+				UserID:          user.ID,
 				Name:            "Valid Workout Name",
 				Description:     "Valid Workout Description",
 				DurationMinutes: 10,
-				CaloriesBurned:  500,
+				CaloriesBurned:  intPtr(500),
 				Exercises: []WorkoutExercise{
 					{
 						Name:            "Valid Exercise Name",
@@ -78,10 +97,11 @@ func TestPersistWorkout(t *testing.T) {
 		{
 			name: "invalid workout",
 			workout: &Workout{
+				UserID:          user.ID,
 				Name:            "Invalid Workout Name",
 				Description:     "Invalid Workout Description",
 				DurationMinutes: 10,
-				CaloriesBurned:  500,
+				CaloriesBurned:  intPtr(500),
 				Exercises: []WorkoutExercise{
 					{
 						Name:            "Invalid Exercise Name",
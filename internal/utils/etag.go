@@ -0,0 +1,33 @@
+package utils
+
+import (
+	"strings"
+)
+
+// MatchesETag reports whether an If-Match or If-None-Match header value matches
+// etag. The header can be "*" or a comma separated list of entity tags. With
+// weak set, entity tags are compared weakly (W/ prefixes are ignored), which is
+// what If-None-Match requires, otherwise only strong tags can match.
+func MatchesETag(header, etag string, weak bool) bool {
+	header = strings.TrimSpace(header)
+	if header == "*" {
+		return true
+	}
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+
+		if weak {
+			if strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+			continue
+		}
+
+		if !strings.HasPrefix(candidate, "W/") && candidate == etag {
+			return true
+		}
+	}
+
+	return false
+}
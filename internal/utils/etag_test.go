@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchesETag(t *testing.T) {
+	testCases := []struct {
+		name     string
+		header   string
+		etag     string
+		weak     bool
+		expected bool
+	}{
+		{name: "exact match", header: `"3"`, etag: `"3"`, expected: true},
+		{name: "mismatch", header: `"2"`, etag: `"3"`, expected: false},
+		{name: "wildcard", header: "*", etag: `"3"`, expected: true},
+		{name: "list", header: `"1", "3"`, etag: `"3"`, expected: true},
+		{name: "weak tag in strong comparison", header: `W/"3"`, etag: `"3"`, expected: false},
+		{name: "weak tag in weak comparison", header: `W/"3"`, etag: `"3"`, weak: true, expected: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, MatchesETag(tc.header, tc.etag, tc.weak))
+		})
+	}
+}
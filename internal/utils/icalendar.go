@@ -0,0 +1,153 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ICalendarContentType is the media type of iCalendar (RFC 5545) objects.
+const ICalendarContentType = "text/calendar; charset=utf-8"
+
+const (
+	iCalendarLocalTime = "20060102T150405"
+	iCalendarUTCTime   = "20060102T150405Z"
+	// iCalendarLineOctets is the length content lines are folded at, CRLF excluded.
+	iCalendarLineOctets = 75
+)
+
+// ICalendar builds an iCalendar object content line by content line.
+type ICalendar struct {
+	builder strings.Builder
+}
+
+// Property adds a content line whose value is written as is. Name may carry
+// parameters, as in "DTSTART;TZID=Europe/Paris".
+func (c *ICalendar) Property(name, value string) {
+	c.builder.WriteString(FoldICalendarLine(name + ":" + value))
+	c.builder.WriteString("\r\n")
+}
+
+// Text adds a content line whose value is of the TEXT type.
+func (c *ICalendar) Text(name, value string) {
+	c.Property(name, EscapeICalendarText(value))
+}
+
+// Time adds a content line whose value is the DATE-TIME t, as a local time
+// of its location with a TZID parameter, or in UTC if its location is UTC.
+// The location must be described by a VTIMEZONE of the object, see
+// TimeZone.
+func (c *ICalendar) Time(name string, t time.Time) {
+	if t.Location() == time.UTC {
+		c.Property(name, t.Format(iCalendarUTCTime))
+		return
+	}
+
+	c.Property(name+";TZID="+t.Location().String(), t.Format(iCalendarLocalTime))
+}
+
+// TimeZone adds the VTIMEZONE of location, holding the offsets in effect from
+// from to to and the transitions between them. UTC needs none.
+func (c *ICalendar) TimeZone(location *time.Location, from, to time.Time) {
+	if location == time.UTC {
+		return
+	}
+
+	c.Property("BEGIN", "VTIMEZONE")
+	c.Property("TZID", location.String())
+
+	// each observance starts at the local time it starts at in the offset
+	// that it replaces
+	t := from.In(location)
+	name, offset := t.Zone()
+	start, end := t.ZoneBounds()
+	previousOffset := offset
+	if !start.IsZero() {
+		_, previousOffset = start.Add(-time.Second).Zone()
+	} else {
+		start = t
+	}
+
+	for {
+		c.observance(start, name, previousOffset, offset)
+
+		if end.IsZero() || !end.Before(to) {
+			break
+		}
+
+		previousOffset = offset
+		name, offset = end.Zone()
+		start = end
+		_, end = end.ZoneBounds()
+	}
+
+	c.Property("END", "VTIMEZONE")
+}
+
+func (c *ICalendar) observance(start time.Time, name string, offsetFrom, offsetTo int) {
+	kind := "STANDARD"
+	if start.IsDST() {
+		kind = "DAYLIGHT"
+	}
+
+	c.Property("BEGIN", kind)
+	c.Property("DTSTART", start.In(time.FixedZone("", offsetFrom)).Format(iCalendarLocalTime))
+	c.Property("TZOFFSETFROM", iCalendarOffset(offsetFrom))
+	c.Property("TZOFFSETTO", iCalendarOffset(offsetTo))
+	c.Text("TZNAME", name)
+	c.Property("END", kind)
+}
+
+func (c *ICalendar) String() string {
+	return c.builder.String()
+}
+
+// iCalendarOffset formats an offset east of UTC, in seconds, as a UTC-OFFSET.
+func iCalendarOffset(offset int) string {
+	sign := '+'
+	if offset < 0 {
+		sign = '-'
+		offset = -offset
+	}
+
+	hours, minutes, seconds := offset/3600, offset/60%60, offset%60
+	if seconds != 0 {
+		return fmt.Sprintf("%c%02d%02d%02d", sign, hours, minutes, seconds)
+	}
+
+	return fmt.Sprintf("%c%02d%02d", sign, hours, minutes)
+}
+
+var iCalendarTextEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`)
+
+// EscapeICalendarText escapes a value of the TEXT type.
+func EscapeICalendarText(value string) string {
+	return iCalendarTextEscaper.Replace(value)
+}
+
+// FoldICalendarLine folds a content line into lines of at most 75 octets, the
+// continuation lines starting with a space, without splitting UTF-8 characters.
+func FoldICalendarLine(line string) string {
+	if len(line) <= iCalendarLineOctets {
+		return line
+	}
+
+	var folded strings.Builder
+	limit := iCalendarLineOctets
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+
+		folded.WriteString(line[:cut])
+		folded.WriteString("\r\n ")
+		line = line[cut:]
+		// the leading space counts
+		limit = iCalendarLineOctets - 1
+	}
+	folded.WriteString(line)
+
+	return folded.String()
+}
@@ -0,0 +1,75 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEscapeICalendarText(t *testing.T) {
+	assert.Equal(t, `Squat\, bench\; deadlift\nC:\\notes`, EscapeICalendarText("Squat, bench; deadlift\r\nC:\\notes"))
+}
+
+func TestFoldICalendarLine(t *testing.T) {
+	testCases := []struct {
+		name string
+		line string
+	}{
+		{name: "short", line: "SUMMARY:Leg Day"},
+		{name: "ascii", line: "DESCRIPTION:" + strings.Repeat("abcdefghij", 20)},
+		{name: "multibyte", line: "DESCRIPTION:" + strings.Repeat("é×💪", 40)},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			folded := FoldICalendarLine(tc.line)
+
+			lines := strings.Split(folded, "\r\n")
+			for i, line := range lines {
+				assert.LessOrEqual(t, len(line), 75)
+				if i > 0 {
+					assert.True(t, strings.HasPrefix(line, " "))
+				}
+			}
+			assert.Equal(t, tc.line, strings.ReplaceAll(folded, "\r\n ", ""))
+		})
+	}
+}
+
+func TestICalendarTimeZone(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	require.NoError(t, err)
+
+	var calendar ICalendar
+	from := time.Date(2026, time.January, 10, 0, 0, 0, 0, time.UTC)
+	calendar.TimeZone(paris, from, from.AddDate(0, 6, 0))
+	calendar.Time("DTSTART", time.Date(2026, time.April, 2, 18, 30, 0, 0, paris))
+
+	assert.Equal(t, strings.Join([]string{
+		"BEGIN:VTIMEZONE",
+		"TZID:Europe/Paris",
+		"BEGIN:STANDARD",
+		"DTSTART:20251026T030000",
+		"TZOFFSETFROM:+0200",
+		"TZOFFSETTO:+0100",
+		"TZNAME:CET",
+		"END:STANDARD",
+		"BEGIN:DAYLIGHT",
+		"DTSTART:20260329T020000",
+		"TZOFFSETFROM:+0100",
+		"TZOFFSETTO:+0200",
+		"TZNAME:CEST",
+		"END:DAYLIGHT",
+		"END:VTIMEZONE",
+		"DTSTART;TZID=Europe/Paris:20260402T183000",
+		"",
+	}, "\r\n"), calendar.String())
+
+	calendar = ICalendar{}
+	calendar.TimeZone(time.UTC, from, from.AddDate(0, 6, 0))
+	calendar.Time("DTSTART", time.Date(2026, time.April, 2, 18, 30, 0, 0, time.UTC))
+	assert.Equal(t, "DTSTART:20260402T183000Z\r\n", calendar.String())
+}
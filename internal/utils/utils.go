@@ -17,8 +17,8 @@ func WriteJSONResponse(w http.ResponseWriter, status int, data Envelope) error {
 		return err
 	}
 
-	w.WriteHeader(status)
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
 	output = append(output, '\n')
 	_, err = w.Write(output)
 	if err != nil {
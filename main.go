@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"flag"
 	"fmt"
@@ -31,6 +32,13 @@ func main() {
 		_ = DB.Close()
 	}(myApp.DB)
 
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go myApp.TrashPurger.Run(ctx)
+	go myApp.IdempotencyPurger.Run(ctx)
+	go myApp.Exporter.Run(ctx)
+
 	myApp.Logger.Printf("Server started on port %d", port)
 
 	server := http.Server{